@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"definitelynotaspy/crawler-service/internal/grpcapi"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// startGRPC serves the gRPC API on GRPC_PORT, when it is set. It returns
+// nil when gRPC is not enabled.
+func startGRPC() *grpc.Server {
+	port := os.Getenv("GRPC_PORT")
+	if port == "" {
+		return nil
+	}
+	server, err := grpcapi.NewServerFromEnv()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to configure gRPC")
+	}
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to listen for gRPC")
+	}
+
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			log.WithError(err).Error("gRPC server stopped")
+		}
+	}()
+	log.WithFields(log.Fields{
+		"port": port,
+		"tls":  os.Getenv("GRPC_TLS_CERT") != "",
+	}).Info("gRPC API listening")
+	return server
+}
+
+// stopGRPC stops the gRPC server, letting calls in progress finish while
+// ctx allows
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	if server == nil {
+		return
+	}
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Warn("gRPC server did not shut down cleanly")
+		server.Stop()
+	}
+}
@@ -0,0 +1,379 @@
+// Package apikey authenticates API clients by key. Keys are defined in the
+// file API_KEYS_FILE or created through the admin API, which keeps them in
+// Redis when connected. Only the SHA-256 digests of keys are stored. Each
+// key has a scope, may be bound to a tenant and may carry quotas: requests
+// per minute, which this package enforces, and concurrent jobs and pages
+// per day, which the API enforces when jobs start.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scopes, each allowing what the ones before it do
+const (
+	// ScopeRead reads jobs, results and exports
+	ScopeRead = "read"
+	// ScopeWrite also starts, changes, cancels and deletes jobs
+	ScopeWrite = "write"
+	// ScopeAdmin also uses the admin API
+	ScopeAdmin = "admin"
+)
+
+// Sources of keys
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+const (
+	keysKey    = "apikeys"
+	ratePrefix = "apikey:rate:"
+	// secretPrefix marks the keys this service generates
+	secretPrefix = "gek_"
+)
+
+var scopeRank = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Key is an API key's identity, scope and quotas. A zero quota is no limit.
+type Key struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Scope  string `json:"scope"`
+	Tenant string `json:"tenant,omitempty"`
+	// Role picks the field mask applied to results fetched with the key
+	Role string `json:"role,omitempty"`
+	// RequestsPerMinute limits API requests made with the key
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	// MaxConcurrentJobs limits the key's jobs pending or running at once
+	MaxConcurrentJobs int `json:"max_concurrent_jobs,omitempty"`
+	// MaxPagesPerDay limits the pages the key's jobs crawl per UTC day
+	MaxPagesPerDay int       `json:"max_pages_per_day,omitempty"`
+	Source         string    `json:"source"`
+	CreatedAt      time.Time `json:"created_at,omitempty"`
+	// Hash is the hex SHA-256 digest of the key
+	Hash string `json:"-"`
+}
+
+// Allows reports whether the key's scope includes scope
+func (k *Key) Allows(scope string) bool {
+	return scopeRank[k.Scope] >= scopeRank[scope]
+}
+
+// Validate checks a key's ID, scope, role and quotas
+func (k *Key) Validate() error {
+	if !idPattern.MatchString(k.ID) {
+		return errors.New("id must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if _, ok := scopeRank[k.Scope]; !ok {
+		return fmt.Errorf("scope must be %s, %s or %s", ScopeRead, ScopeWrite, ScopeAdmin)
+	}
+	if k.Role != "" && !idPattern.MatchString(k.Role) {
+		return errors.New("role must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if k.RequestsPerMinute < 0 || k.MaxConcurrentJobs < 0 || k.MaxPagesPerDay < 0 {
+		return errors.New("quotas must not be negative")
+	}
+	return nil
+}
+
+// storedKey is a key as kept in Redis and in the configuration file
+type storedKey struct {
+	Key
+	Hash string `json:"hash"`
+}
+
+// configKey is a key as defined in the configuration file, by the key
+// itself or by its digest
+type configKey struct {
+	Key
+	Secret string `json:"key"`
+	Hash   string `json:"hash"`
+}
+
+// Store holds the keys
+type Store struct {
+	mu       sync.RWMutex
+	config   map[string]Key
+	created  map[string]Key
+	required bool
+
+	rateMu sync.Mutex
+	rates  map[string]rateWindow
+}
+
+// rateWindow counts a key's requests in the minute starting at start
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewStore creates an empty store that requires no key
+func NewStore() *Store {
+	return &Store{
+		config:  make(map[string]Key),
+		created: make(map[string]Key),
+		rates:   make(map[string]rateWindow),
+	}
+}
+
+// NewStoreFromEnv loads the keys in API_KEYS_FILE, a JSON array of keys
+// each given by "key" or its SHA-256 "hash". Authentication is required
+// once that file defines a key, or when API_AUTH_REQUIRED=true.
+func NewStoreFromEnv() (*Store, error) {
+	s := NewStore()
+	s.required, _ = strconv.ParseBool(os.Getenv("API_AUTH_REQUIRED"))
+
+	path := os.Getenv("API_KEYS_FILE")
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	var defined []configKey
+	if err := json.Unmarshal(data, &defined); err != nil {
+		return s, fmt.Errorf("invalid API keys file: %w", err)
+	}
+	for _, d := range defined {
+		key := d.Key
+		key.Source = SourceConfig
+		key.Hash = d.Hash
+		if d.Secret != "" {
+			key.Hash = digest(d.Secret)
+		}
+		if len(key.Hash) != sha256.Size*2 {
+			return s, fmt.Errorf("API key %q needs a key or a SHA-256 hash", key.ID)
+		}
+		if err := key.Validate(); err != nil {
+			return s, fmt.Errorf("API key %q: %w", key.ID, err)
+		}
+		s.config[key.Hash] = key
+	}
+	s.required = s.required || len(s.config) > 0
+	return s, nil
+}
+
+// Required reports whether requests must present a key
+func (s *Store) Required() bool {
+	return s.required
+}
+
+// ErrUnavailable is returned when the keys kept in Redis cannot be read,
+// so a key cannot be told valid from revoked
+var ErrUnavailable = errors.New("API keys are unavailable")
+
+// Authenticate returns the key secret is, or nil when it is no key. Keys
+// created through the API are read from Redis when connected, so a key
+// revoked by any instance is refused by all; when Redis cannot be read,
+// it fails with ErrUnavailable rather than trust a local copy.
+func (s *Store) Authenticate(secret string) (*Key, error) {
+	if secret == "" {
+		return nil, nil
+	}
+	hash := digest(secret)
+
+	s.mu.RLock()
+	key, ok := s.config[hash]
+	s.mu.RUnlock()
+	if ok {
+		return &key, nil
+	}
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		data, err := rdb.HGet(ctx, keysKey, hash).Bytes()
+		switch {
+		case err == redis.Nil:
+			return nil, nil
+		case err != nil:
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		key, _ := decode(data)
+		return key, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.created[hash]; ok {
+		return &key, nil
+	}
+	return nil, nil
+}
+
+// Create stores a new key and returns it with its secret, which is not
+// kept and cannot be shown again
+func (s *Store) Create(key Key) (*Key, string, error) {
+	if err := key.Validate(); err != nil {
+		return nil, "", err
+	}
+	keys, err := s.List()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, existing := range keys {
+		if existing.ID == key.ID {
+			return nil, "", fmt.Errorf("API key %q already exists", key.ID)
+		}
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	secret := secretPrefix + hex.EncodeToString(raw)
+	key.Hash = digest(secret)
+	key.Source = SourceAPI
+	key.CreatedAt = time.Now().UTC()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(storedKey{Key: key, Hash: key.Hash})
+		if err != nil {
+			return nil, "", err
+		}
+		if err := rdb.HSet(context.Background(), keysKey, key.Hash, data).Err(); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return &key, secret, nil
+	}
+
+	s.mu.Lock()
+	s.created[key.Hash] = key
+	s.mu.Unlock()
+	return &key, secret, nil
+}
+
+// Delete revokes a key created through the API. Keys in the configuration
+// file are revoked by removing them from it.
+func (s *Store) Delete(id string) (bool, error) {
+	keys, err := s.List()
+	if err != nil {
+		return false, err
+	}
+	deleted := false
+	for _, key := range keys {
+		if key.ID != id || key.Source != SourceAPI {
+			continue
+		}
+		if rdb := database.GetRedisClient(); rdb != nil {
+			if err := rdb.HDel(context.Background(), keysKey, key.Hash).Err(); err != nil {
+				return deleted, fmt.Errorf("%w: %v", ErrUnavailable, err)
+			}
+		}
+		s.mu.Lock()
+		delete(s.created, key.Hash)
+		s.mu.Unlock()
+		deleted = true
+	}
+	return deleted, nil
+}
+
+// List returns every key sorted by ID. Keys created through the API are
+// read from Redis when connected, and else from this instance.
+func (s *Store) List() ([]Key, error) {
+	keys := make(map[string]Key)
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		items, err := rdb.HGetAll(ctx, keysKey).Result()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		for hash, value := range items {
+			if key, ok := decode([]byte(value)); ok {
+				keys[hash] = *key
+			}
+		}
+	} else {
+		s.mu.RLock()
+		for hash, key := range s.created {
+			keys[hash] = key
+		}
+		s.mu.RUnlock()
+	}
+
+	s.mu.RLock()
+	for hash, key := range s.config {
+		keys[hash] = key
+	}
+	s.mu.RUnlock()
+
+	list := make([]Key, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, key)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// Allow counts a request made with a key against its requests per minute.
+// When the minute's allowance is used up it returns false and how long
+// until the next minute.
+func (s *Store) Allow(key *Key) (bool, time.Duration) {
+	if key.RequestsPerMinute <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	window := now.Truncate(time.Minute)
+	retryAfter := window.Add(time.Minute).Sub(now)
+	counter := fmt.Sprintf("%s%s:%d", ratePrefix, key.ID, window.Unix())
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		pipe := rdb.TxPipeline()
+		count := pipe.Incr(ctx, counter)
+		pipe.Expire(ctx, counter, 2*time.Minute)
+		if _, err := pipe.Exec(ctx); err == nil {
+			return count.Val() <= int64(key.RequestsPerMinute), retryAfter
+		}
+		log.Warn("Failed to count API key requests in Redis, counting locally")
+	}
+
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+	w := s.rates[key.ID]
+	if !w.start.Equal(window) {
+		w = rateWindow{start: window}
+	}
+	w.count++
+	s.rates[key.ID] = w
+	return w.count <= key.RequestsPerMinute, retryAfter
+}
+
+func decode(data []byte) (*Key, bool) {
+	var stored storedKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, false
+	}
+	key := stored.Key
+	key.Hash = stored.Hash
+	return &key, true
+}
+
+func digest(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package apikey
+
+import (
+	"errors"
+	"testing"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// withRedis connects the database package to an in-memory Redis for the
+// test
+func withRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_HOST", mr.Addr())
+	if err := database.InitRedis(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseRedis() })
+	return mr
+}
+
+func TestRevokedKeyRefusedByEveryInstance(t *testing.T) {
+	withRedis(t)
+	a, b := NewStore(), NewStore()
+
+	key, secret, err := a.Create(Key{ID: "ci", Scope: ScopeWrite, Tenant: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Authenticate(secret)
+	if err != nil || got == nil || got.ID != key.ID || got.Tenant != "acme" {
+		t.Fatalf("Authenticate on another instance = %+v, %v", got, err)
+	}
+
+	deleted, err := b.Delete("ci")
+	if err != nil || !deleted {
+		t.Fatalf("Delete = %v, %v", deleted, err)
+	}
+	for name, s := range map[string]*Store{"creating": a, "revoking": b} {
+		if got, err := s.Authenticate(secret); err != nil || got != nil {
+			t.Errorf("%s instance authenticated a revoked key: %+v, %v", name, got, err)
+		}
+	}
+}
+
+func TestAuthenticateFailsClosedWithoutRedis(t *testing.T) {
+	mr := withRedis(t)
+	s := NewStore()
+	_, secret, err := s.Create(Key{ID: "ci", Scope: ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	got, err := s.Authenticate(secret)
+	if !errors.Is(err, ErrUnavailable) || got != nil {
+		t.Errorf("Authenticate with Redis failing = %+v, %v, want ErrUnavailable", got, err)
+	}
+	if _, err := s.List(); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("List with Redis failing = %v, want ErrUnavailable", err)
+	}
+	if _, err := s.Delete("ci"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Delete with Redis failing = %v, want ErrUnavailable", err)
+	}
+
+	mr.SetError("")
+	if got, err := s.Authenticate(secret); err != nil || got == nil {
+		t.Errorf("Authenticate once Redis recovered = %+v, %v", got, err)
+	}
+}
+
+func TestLocalKeysWithoutRedis(t *testing.T) {
+	s := NewStore()
+	_, secret, err := s.Create(Key{ID: "ci", Scope: ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Authenticate(secret); err != nil || got == nil || got.ID != "ci" {
+		t.Fatalf("Authenticate = %+v, %v", got, err)
+	}
+	if got, err := s.Authenticate("gek_unknown"); err != nil || got != nil {
+		t.Errorf("unknown key authenticated: %+v, %v", got, err)
+	}
+	if deleted, err := s.Delete("ci"); err != nil || !deleted {
+		t.Fatalf("Delete = %v, %v", deleted, err)
+	}
+	if got, _ := s.Authenticate(secret); got != nil {
+		t.Errorf("revoked key authenticated: %+v", got)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	tests := []struct {
+		scope, required string
+		want            bool
+	}{
+		{ScopeRead, ScopeRead, true},
+		{ScopeRead, ScopeWrite, false},
+		{ScopeWrite, ScopeWrite, true},
+		{ScopeWrite, ScopeAdmin, false},
+		{ScopeAdmin, ScopeRead, true},
+		{"", ScopeRead, false},
+	}
+	for _, tt := range tests {
+		if got := (&Key{Scope: tt.scope}).Allows(tt.required); got != tt.want {
+			t.Errorf("%q allows %q = %v, want %v", tt.scope, tt.required, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/blobstore"
+	"definitelynotaspy/crawler-service/internal/keyring"
+	"definitelynotaspy/crawler-service/internal/sanitize"
+)
+
+// Archive stores gzipped, sanitised HTML and screenshots of crawled pages,
+// on local disk or in an S3-compatible object store, so results can be
+// re-extracted and evidence produced later without touching the network.
+// With a keyring, entries are encrypted with their tenant's data key.
+type Archive struct {
+	store store
+	keys  *keyring.Keyring
+}
+
+// store holds archive entries under their references
+type store interface {
+	read(ref string) ([]byte, error)
+	write(ref string, data []byte) error
+	deleteJob(jobID string) error
+	uri(ref string) string
+}
+
+// NewFromEnv creates an archive, encrypting entries when keys is not nil.
+// ARCHIVE_STORE selects where entries go: "disk" (the default), under
+// ARCHIVE_DIR (default data/archive), or "s3", the configured bucket under
+// ARCHIVE_PREFIX (default archive/). On a configuration error the disk
+// archive is returned alongside the error.
+func NewFromEnv(keys *keyring.Keyring, s3 *blobstore.S3Client) (*Archive, error) {
+	dir := os.Getenv("ARCHIVE_DIR")
+	if dir == "" {
+		dir = filepath.Join("data", "archive")
+	}
+	disk := &Archive{store: diskStore{dir: dir}, keys: keys}
+
+	switch kind := os.Getenv("ARCHIVE_STORE"); kind {
+	case "", "disk":
+		return disk, nil
+	case "s3":
+		if s3 == nil {
+			return disk, fmt.Errorf("ARCHIVE_STORE=s3 needs S3_ENDPOINT and S3_BUCKET")
+		}
+		prefix := os.Getenv("ARCHIVE_PREFIX")
+		if prefix == "" {
+			prefix = "archive/"
+		}
+		return &Archive{store: s3Store{client: s3, prefix: prefix}, keys: keys}, nil
+	default:
+		return disk, fmt.Errorf("unknown ARCHIVE_STORE %q", kind)
+	}
+}
+
+// Kind names where the archive keeps its entries
+func (a *Archive) Kind() string {
+	if _, ok := a.store.(s3Store); ok {
+		return "s3"
+	}
+	return "disk"
+}
+
+// URI returns where the entry stored under ref lives, a file path or an
+// s3:// URI
+func (a *Archive) URI(ref string) string {
+	return a.store.uri(ref)
+}
+
+// Ref returns the archive reference for a page of a job
+func Ref(jobID, pageURL string) string {
+	return pageKey(jobID, pageURL) + ".html.gz"
+}
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ScreenshotRef returns the archive reference for a page's screenshot
+func ScreenshotRef(jobID, pageURL string) string {
+	return pageKey(jobID, pageURL) + ".png"
+}
+
+func pageKey(jobID, pageURL string) string {
+	sum := sha256.Sum256([]byte(pageURL))
+	return jobID + "/" + hex.EncodeToString(sum[:16])
+}
+
+// entryName matches the name of an archive entry within its job's prefix
+var entryName = regexp.MustCompile(`^[0-9a-f]{32}\.(html\.gz|png)$`)
+
+// RefJob returns the ID of the job a reference was archived under
+func RefJob(ref string) string {
+	jobID, _, _ := strings.Cut(ref, "/")
+	return jobID
+}
+
+// Rebase returns ref moved under the prefix of job jobID, refusing
+// anything but a page or screenshot reference. Entries imported from
+// another instance are stored under the importing job this way, so they
+// can't overwrite another job's.
+func Rebase(ref, jobID string) (string, error) {
+	_, name, ok := strings.Cut(ref, "/")
+	if !ok || !entryName.MatchString(name) {
+		return "", fmt.Errorf("invalid archive reference %q", ref)
+	}
+	return jobID + "/" + name, nil
+}
+
+// Store sanitises, gzips and writes the HTML of a page of a tenant's job,
+// returning its reference and the SHA-256 digest of the HTML as archived,
+// which Load returns
+func (a *Archive) Store(tenant, jobID, pageURL string, html []byte) (string, []byte, error) {
+	ref := Ref(jobID, pageURL)
+	digest, err := a.write(tenant, ref, html)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to archive %s: %w", pageURL, err)
+	}
+	return ref, digest, nil
+}
+
+// StoreCompressed stores gzipped HTML under ref, used when importing
+// archives from another instance. The HTML is sanitised like any other,
+// since the instance it came from may not have been.
+func (a *Archive) StoreCompressed(tenant, ref string, data []byte) error {
+	if !strings.HasSuffix(ref, ".html.gz") {
+		return fmt.Errorf("invalid archive reference %q", ref)
+	}
+	html, err := gunzip(data)
+	if err != nil {
+		return fmt.Errorf("corrupt archive entry %s: %w", ref, err)
+	}
+	_, err = a.write(tenant, ref, html)
+	return err
+}
+
+// StoreScreenshot writes the PNG screenshot of a page of a tenant's job,
+// returning its reference
+func (a *Archive) StoreScreenshot(tenant, jobID, pageURL string, png []byte) (string, error) {
+	ref := ScreenshotRef(jobID, pageURL)
+	if err := a.put(tenant, ref, png); err != nil {
+		return "", fmt.Errorf("failed to archive screenshot of %s: %w", pageURL, err)
+	}
+	return ref, nil
+}
+
+// StoreScreenshotRef stores a PNG screenshot under ref, used when
+// importing archives from another instance
+func (a *Archive) StoreScreenshotRef(tenant, ref string, png []byte) error {
+	if !strings.HasSuffix(ref, ".png") {
+		return fmt.Errorf("invalid screenshot reference %q", ref)
+	}
+	if !bytes.HasPrefix(png, pngSignature) {
+		return fmt.Errorf("archive entry %s is not a PNG", ref)
+	}
+	return a.put(tenant, ref, png)
+}
+
+// LoadScreenshot returns the PNG screenshot stored under ref
+func (a *Archive) LoadScreenshot(ref string) ([]byte, error) {
+	if !strings.HasSuffix(ref, ".png") {
+		return nil, fmt.Errorf("invalid screenshot reference %q", ref)
+	}
+	return a.LoadCompressed(ref)
+}
+
+// LoadCompressed returns the gzipped content stored under ref, decrypted
+func (a *Archive) LoadCompressed(ref string) ([]byte, error) {
+	if err := checkRef(ref); err != nil {
+		return nil, err
+	}
+	data, err := a.store.read(ref)
+	if err != nil || !keyring.IsEncrypted(data) {
+		return data, err
+	}
+	if a.keys == nil {
+		return nil, fmt.Errorf("archive entry %s is encrypted but no master key is configured", ref)
+	}
+	return a.keys.Decrypt(data)
+}
+
+// Load returns the HTML stored under ref. It is sanitised again on the way
+// out, which covers pages archived before sanitisation was introduced.
+func (a *Archive) Load(ref string) ([]byte, error) {
+	data, err := a.LoadCompressed(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	html, err := gunzip(data)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt archive entry %s: %w", ref, err)
+	}
+	return sanitize.HTML(html), nil
+}
+
+// DeleteJob removes all archived pages of a job
+func (a *Archive) DeleteJob(jobID string) error {
+	if jobID == "" || strings.ContainsAny(jobID, `/\`) || jobID == ".." {
+		return fmt.Errorf("invalid job ID %q", jobID)
+	}
+	return a.store.deleteJob(jobID)
+}
+
+// checkRef rejects references reaching outside the archive
+func checkRef(ref string) error {
+	clean := filepath.Clean(filepath.FromSlash(ref))
+	if ref == "" || filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return fmt.Errorf("invalid archive reference %q", ref)
+	}
+	return nil
+}
+
+// write sanitises and gzips HTML and stores it under ref, returning the
+// SHA-256 digest of the sanitised HTML
+func (a *Archive) write(tenant, ref string, html []byte) ([]byte, error) {
+	clean := sanitize.HTML(html)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(clean); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if err := a.put(tenant, ref, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(clean)
+	return sum[:], nil
+}
+
+// put encrypts data, with a keyring, and stores it under ref
+func (a *Archive) put(tenant, ref string, data []byte) error {
+	if err := checkRef(ref); err != nil {
+		return err
+	}
+	if a.keys != nil {
+		var err error
+		if data, err = a.keys.Encrypt(tenant, data); err != nil {
+			return fmt.Errorf("failed to encrypt archive entry: %w", err)
+		}
+	}
+	return a.store.write(ref, data)
+}
+
+// diskStore keeps entries as files under a directory
+type diskStore struct {
+	dir string
+}
+
+func (d diskStore) path(ref string) string {
+	return filepath.Join(d.dir, filepath.Clean(filepath.FromSlash(ref)))
+}
+
+func (d diskStore) read(ref string) ([]byte, error) {
+	return os.ReadFile(d.path(ref))
+}
+
+func (d diskStore) write(ref string, data []byte) error {
+	path := d.path(ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (d diskStore) deleteJob(jobID string) error {
+	return os.RemoveAll(filepath.Join(d.dir, jobID))
+}
+
+func (d diskStore) uri(ref string) string {
+	path := d.path(ref)
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return "file://" + filepath.ToSlash(path)
+}
+
+// s3Store keeps entries as objects under a key prefix
+type s3Store struct {
+	client *blobstore.S3Client
+	prefix string
+}
+
+func (s s3Store) read(ref string) ([]byte, error) {
+	return s.client.Get(context.Background(), s.prefix+ref)
+}
+
+func (s s3Store) write(ref string, data []byte) error {
+	return s.client.Put(context.Background(), s.prefix+ref, "application/octet-stream", data)
+}
+
+func (s s3Store) deleteJob(jobID string) error {
+	ctx := context.Background()
+	keys, err := s.client.List(ctx, s.prefix+jobID+"/")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.client.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s s3Store) uri(ref string) string {
+	return s.client.URI(s.prefix + ref)
+}
+
+// gunzip decompresses an archive entry
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redisKey is the Redis list audit records are appended to
+const redisKey = "audit_log"
+
+// maxInMemory bounds the in-process log used when Redis is unavailable
+const maxInMemory = 10000
+
+// Record describes one audited action
+type Record struct {
+	Time    time.Time              `json:"time"`
+	Action  string                 `json:"action"`
+	Tenant  string                 `json:"tenant,omitempty"`
+	JobID   string                 `json:"job_id,omitempty"`
+	Actor   string                 `json:"actor,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Log is an append-only audit trail. Records go to Redis when connected and
+// to a bounded in-process list otherwise; every record is also logged.
+type Log struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+// NewLog creates an empty audit log
+func NewLog() *Log {
+	return &Log{}
+}
+
+// Append stores a record, stamping it with the current time
+func (l *Log) Append(rec Record) {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+
+	log.WithFields(log.Fields{
+		"action": rec.Action,
+		"tenant": rec.Tenant,
+		"job_id": rec.JobID,
+		"actor":  rec.Actor,
+	}).Info("Audit record")
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(rec)
+		if err == nil {
+			err = rdb.RPush(context.Background(), redisKey, data).Err()
+		}
+		if err == nil {
+			return
+		}
+		log.WithError(err).Warn("Failed to persist audit record, keeping it in memory")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, rec)
+	if len(l.records) > maxInMemory {
+		l.records = l.records[len(l.records)-maxInMemory:]
+	}
+}
+
+// Records returns stored records, optionally only those of one tenant
+func (l *Log) Records(tenant string) ([]Record, error) {
+	var all []Record
+	if rdb := database.GetRedisClient(); rdb != nil {
+		items, err := rdb.LRange(context.Background(), redisKey, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var rec Record
+			if err := json.Unmarshal([]byte(item), &rec); err == nil {
+				all = append(all, rec)
+			}
+		}
+	}
+
+	l.mu.Lock()
+	all = append(all, l.records...)
+	l.mu.Unlock()
+
+	if tenant == "" {
+		return all, nil
+	}
+	filtered := make([]Record, 0, len(all))
+	for _, rec := range all {
+		if rec.Tenant == tenant {
+			filtered = append(filtered, rec)
+		}
+	}
+	return filtered, nil
+}
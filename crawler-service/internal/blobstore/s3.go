@@ -0,0 +1,210 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/sigv4"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// S3Client is a minimal client for S3-compatible object stores (AWS S3,
+// MinIO) supporting uploads, downloads, deletes and presigned GET URLs
+type S3Client struct {
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	signer    *sigv4.Signer
+	http      *http.Client
+}
+
+// NewS3ClientFromEnv creates a client from S3_ENDPOINT, S3_REGION, S3_BUCKET,
+// S3_ACCESS_KEY, S3_SECRET_KEY and S3_PATH_STYLE. It returns nil when no
+// endpoint or bucket is configured.
+func NewS3ClientFromEnv() (*S3Client, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	bucket := os.Getenv("S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", endpoint)
+	}
+
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3Client{
+		endpoint:  u,
+		bucket:    bucket,
+		pathStyle: os.Getenv("S3_PATH_STYLE") != "false",
+		signer: &sigv4.Signer{
+			Credentials: sigv4.Credentials{
+				AccessKey: os.Getenv("S3_ACCESS_KEY"),
+				SecretKey: os.Getenv("S3_SECRET_KEY"),
+			},
+			Region:  region,
+			Service: "s3",
+		},
+		http: &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Bucket returns the configured bucket name
+func (s *S3Client) Bucket() string {
+	return s.bucket
+}
+
+// WithBucket returns a client for another bucket on the same endpoint and
+// with the same credentials
+func (s *S3Client) WithBucket(bucket string) *S3Client {
+	c := *s
+	c.bucket = bucket
+	return &c
+}
+
+// URI returns the s3:// URI for an object key
+func (s *S3Client) URI(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key)
+}
+
+// Put uploads data under key
+func (s *S3Client) Put(ctx context.Context, key, contentType string, data []byte) error {
+	req, err := s.newSignedRequest(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("upload of %s failed with status %d: %s", key, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// Get downloads the object stored under key
+func (s *S3Client) Get(ctx context.Context, key string) ([]byte, error) {
+	req, err := s.newSignedRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("download of %s failed with status %d", key, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Delete removes the object stored under key
+func (s *S3Client) Delete(ctx context.Context, key string) error {
+	req, err := s.newSignedRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("delete of %s failed with status %d", key, resp.StatusCode)
+	}
+	return nil
+}
+
+// List returns the keys of the objects whose keys start with prefix
+func (s *S3Client) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		u := s.objectURL("")
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = query.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		s.signer.Sign(req, nil, time.Now())
+
+		resp, err := s.http.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if resp.StatusCode/100 != 2 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("listing of %s failed with status %d", prefix, resp.StatusCode)
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		for _, c := range page.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// PresignGet returns a URL granting time-limited read access to key
+func (s *S3Client) PresignGet(key string, expires time.Duration) string {
+	return s.signer.Presign(http.MethodGet, s.objectURL(key), expires, time.Now())
+}
+
+func (s *S3Client) newSignedRequest(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.signer.Sign(req, body, time.Now())
+	return req, nil
+}
+
+// objectURL returns the path-style or virtual-hosted URL of key
+func (s *S3Client) objectURL(key string) *url.URL {
+	u := &url.URL{Scheme: s.endpoint.Scheme, Host: s.endpoint.Host, Path: "/" + s.bucket + "/" + key}
+	if !s.pathStyle {
+		u.Host = s.bucket + "." + s.endpoint.Host
+		u.Path = "/" + key
+	}
+	return u
+}
@@ -0,0 +1,226 @@
+// Package browserprofile holds curated browser header profiles. Each
+// profile is a template of the headers one browser on one OS sends, so a
+// crawl can rotate whole, coherent header sets instead of pairing a random
+// user agent with Go's default headers.
+package browserprofile
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Browser families
+const (
+	Chrome  = "chrome"
+	Firefox = "firefox"
+	Safari  = "safari"
+)
+
+// versionPlaceholder is replaced in every header template with one of the
+// profile's versions, so the user agent and client hints agree
+const versionPlaceholder = "{version}"
+
+// Profile is a template for the headers a browser sends on a navigation
+type Profile struct {
+	Name    string `json:"name"`
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	// Versions are the major versions rotated through; each request picks
+	// one and substitutes it for {version} in every header
+	Versions []string          `json:"versions"`
+	Headers  map[string]string `json:"headers"`
+}
+
+// Chromium navigation headers shared by the Chrome profiles
+func chromeHeaders(ua, platform, mobile string) map[string]string {
+	return map[string]string{
+		"User-Agent":                ua,
+		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		"Accept-Language":           "en-US,en;q=0.9",
+		"Sec-Ch-Ua":                 `"Chromium";v="{version}", "Google Chrome";v="{version}", "Not?A_Brand";v="99"`,
+		"Sec-Ch-Ua-Mobile":          mobile,
+		"Sec-Ch-Ua-Platform":        `"` + platform + `"`,
+		"Sec-Fetch-Dest":            "document",
+		"Sec-Fetch-Mode":            "navigate",
+		"Sec-Fetch-Site":            "none",
+		"Sec-Fetch-User":            "?1",
+		"Upgrade-Insecure-Requests": "1",
+	}
+}
+
+func firefoxHeaders(ua string) map[string]string {
+	return map[string]string{
+		"User-Agent":                ua,
+		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		"Accept-Language":           "en-US,en;q=0.5",
+		"Sec-Fetch-Dest":            "document",
+		"Sec-Fetch-Mode":            "navigate",
+		"Sec-Fetch-Site":            "none",
+		"Sec-Fetch-User":            "?1",
+		"Upgrade-Insecure-Requests": "1",
+	}
+}
+
+func safariHeaders(ua string) map[string]string {
+	return map[string]string{
+		"User-Agent":      ua,
+		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"Accept-Language": "en-US,en;q=0.9",
+		"Sec-Fetch-Dest":  "document",
+		"Sec-Fetch-Mode":  "navigate",
+		"Sec-Fetch-Site":  "none",
+	}
+}
+
+var (
+	chromeVersions  = []string{"126", "127", "128", "129", "130"}
+	firefoxVersions = []string{"128", "129", "130", "131"}
+	safariVersions  = []string{"17.4", "17.5", "17.6", "18.0"}
+)
+
+// builtin are the profiles every deployment offers
+var builtin = []Profile{
+	{
+		Name: "chrome-windows", Browser: Chrome, OS: "windows", Versions: chromeVersions,
+		Headers: chromeHeaders("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/{version}.0.0.0 Safari/537.36", "Windows", "?0"),
+	},
+	{
+		Name: "chrome-macos", Browser: Chrome, OS: "macos", Versions: chromeVersions,
+		Headers: chromeHeaders("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/{version}.0.0.0 Safari/537.36", "macOS", "?0"),
+	},
+	{
+		Name: "chrome-linux", Browser: Chrome, OS: "linux", Versions: chromeVersions,
+		Headers: chromeHeaders("Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/{version}.0.0.0 Safari/537.36", "Linux", "?0"),
+	},
+	{
+		Name: "chrome-android", Browser: Chrome, OS: "android", Versions: chromeVersions,
+		Headers: chromeHeaders("Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/{version}.0.0.0 Mobile Safari/537.36", "Android", "?1"),
+	},
+	{
+		Name: "firefox-windows", Browser: Firefox, OS: "windows", Versions: firefoxVersions,
+		Headers: firefoxHeaders("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:{version}.0) Gecko/20100101 Firefox/{version}.0"),
+	},
+	{
+		Name: "firefox-macos", Browser: Firefox, OS: "macos", Versions: firefoxVersions,
+		Headers: firefoxHeaders("Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:{version}.0) Gecko/20100101 Firefox/{version}.0"),
+	},
+	{
+		Name: "firefox-linux", Browser: Firefox, OS: "linux", Versions: firefoxVersions,
+		Headers: firefoxHeaders("Mozilla/5.0 (X11; Linux x86_64; rv:{version}.0) Gecko/20100101 Firefox/{version}.0"),
+	},
+	{
+		Name: "safari-macos", Browser: Safari, OS: "macos", Versions: safariVersions,
+		Headers: safariHeaders("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/{version} Safari/605.1.15"),
+	},
+	{
+		Name: "safari-ios", Browser: Safari, OS: "ios", Versions: safariVersions,
+		Headers: safariHeaders("Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/{version} Mobile/15E148 Safari/604.1"),
+	},
+}
+
+// Registry holds the profiles available to jobs
+type Registry struct {
+	profiles map[string]Profile
+}
+
+// NewRegistryFromEnv offers the built-in profiles plus those defined in the
+// JSON array file BROWSER_PROFILES_FILE, which may also redefine built-ins.
+// On a configuration error the built-ins are returned alongside the error.
+func NewRegistryFromEnv() (*Registry, error) {
+	r := &Registry{profiles: make(map[string]Profile)}
+	for _, p := range builtin {
+		r.profiles[p.Name] = p
+	}
+
+	path := os.Getenv("BROWSER_PROFILES_FILE")
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	var defined []Profile
+	if err := json.Unmarshal(data, &defined); err != nil {
+		return r, fmt.Errorf("invalid browser profiles: %w", err)
+	}
+	for _, p := range defined {
+		if p.Name == "" || p.Headers["User-Agent"] == "" {
+			return r, fmt.Errorf("browser profiles need a name and a User-Agent header")
+		}
+		p.Name = strings.ToLower(p.Name)
+		p.Browser = strings.ToLower(p.Browser)
+		r.profiles[p.Name] = p
+	}
+	return r, nil
+}
+
+// Names returns the name of every profile, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.profiles))
+	for name := range r.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rotation picks a profile and version at random for each request
+type Rotation struct {
+	profiles []Profile
+}
+
+// Select returns a rotation over the named profiles; a browser family
+// (chrome, firefox or safari) selects all of its profiles and empty
+// selects every profile
+func (r *Registry) Select(names []string) (*Rotation, error) {
+	var selected []Profile
+	if len(names) == 0 {
+		for _, name := range r.Names() {
+			selected = append(selected, r.profiles[name])
+		}
+		return &Rotation{profiles: selected}, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		matched := false
+		for _, pname := range r.Names() {
+			p := r.profiles[pname]
+			if p.Name != name && p.Browser != name {
+				continue
+			}
+			matched = true
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				selected = append(selected, p)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("unknown browser profile %q", name)
+		}
+	}
+	return &Rotation{profiles: selected}, nil
+}
+
+// Apply sets the headers of a randomly chosen profile and version on a
+// request
+func (rt *Rotation) Apply(h *http.Header) {
+	if len(rt.profiles) == 0 {
+		return
+	}
+	p := rt.profiles[rand.Intn(len(rt.profiles))]
+	version := ""
+	if len(p.Versions) > 0 {
+		version = p.Versions[rand.Intn(len(p.Versions))]
+	}
+	for name, value := range p.Headers {
+		h.Set(name, strings.ReplaceAll(value, versionPlaceholder, version))
+	}
+}
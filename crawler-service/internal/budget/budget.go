@@ -0,0 +1,229 @@
+// Package budget holds the monthly consumption caps set for tenants: pages
+// crawled, render minutes and search API calls. Usage approaching a cap
+// raises alerts; usage reaching it stops new jobs until the month ends or
+// an admin overrides the caps.
+package budget
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// Capped metrics
+const (
+	MetricPages         = "pages"
+	MetricRenderMinutes = "render_minutes"
+	MetricSearchCalls   = "search_calls"
+)
+
+// searchService is the cost record's name for search API calls
+const searchService = "search"
+
+const (
+	capsKey     = "budget:caps"
+	alertPrefix = "budget:alerted:"
+	// alertTTL keeps alert markers past the end of their month
+	alertTTL = 40 * 24 * time.Hour
+)
+
+// Caps are a tenant's monthly limits; a zero limit is no limit
+type Caps struct {
+	Tenant        string    `json:"tenant"`
+	Pages         int       `json:"pages,omitempty"`
+	RenderMinutes float64   `json:"render_minutes,omitempty"`
+	SearchCalls   int       `json:"search_calls,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	// OverrideMonth (YYYY-MM) lets the tenant start jobs past its caps
+	// until that month ends
+	OverrideMonth string `json:"override_month,omitempty"`
+}
+
+// Status is the use of one capped metric this month
+type Status struct {
+	Metric  string  `json:"metric"`
+	Used    float64 `json:"used"`
+	Cap     float64 `json:"cap"`
+	Percent float64 `json:"percent"`
+}
+
+// Validate checks that the limits are not negative
+func (c Caps) Validate() error {
+	if c.Pages < 0 || c.RenderMinutes < 0 || c.SearchCalls < 0 {
+		return errors.New("caps must not be negative")
+	}
+	return nil
+}
+
+// Overridden reports whether the caps are lifted for month (YYYY-MM)
+func (c Caps) Overridden(month string) bool {
+	return c.OverrideMonth != "" && c.OverrideMonth == month
+}
+
+// Check returns the use of each capped metric for a month's cost
+func (c Caps) Check(cost models.JobCost) []Status {
+	var statuses []Status
+	add := func(metric string, used, limit float64) {
+		if limit <= 0 {
+			return
+		}
+		statuses = append(statuses, Status{Metric: metric, Used: used, Cap: limit, Percent: used / limit * 100})
+	}
+	add(MetricPages, float64(cost.Pages), float64(c.Pages))
+	add(MetricRenderMinutes, cost.RenderMinutes, c.RenderMinutes)
+	add(MetricSearchCalls, float64(cost.APICalls[searchService]), float64(c.SearchCalls))
+	return statuses
+}
+
+// Exceeded returns the metrics whose cap a month's cost has reached
+func (c Caps) Exceeded(cost models.JobCost) []string {
+	var hit []string
+	for _, s := range c.Check(cost) {
+		if s.Used >= s.Cap {
+			hit = append(hit, s.Metric)
+		}
+	}
+	return hit
+}
+
+// Store holds the caps per tenant, in Redis when connected so every
+// instance enforces the same caps
+type Store struct {
+	mu         sync.RWMutex
+	caps       map[string]Caps
+	alerted    map[string]bool
+	thresholds []float64
+}
+
+// NewStoreFromEnv creates an empty store alerting at the percentages of a
+// cap listed in BUDGET_ALERT_THRESHOLDS (default "80,100")
+func NewStoreFromEnv() *Store {
+	return &Store{
+		caps:       make(map[string]Caps),
+		alerted:    make(map[string]bool),
+		thresholds: parseThresholds(os.Getenv("BUDGET_ALERT_THRESHOLDS")),
+	}
+}
+
+func parseThresholds(s string) []float64 {
+	var thresholds []float64
+	for _, field := range strings.Split(s, ",") {
+		if p, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err == nil && p > 0 {
+			thresholds = append(thresholds, p)
+		}
+	}
+	if len(thresholds) == 0 {
+		return []float64{80, 100}
+	}
+	sort.Float64s(thresholds)
+	return thresholds
+}
+
+// Put stores a tenant's caps, replacing its previous ones
+func (s *Store) Put(caps Caps) error {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(caps)
+		if err != nil {
+			return err
+		}
+		if err := rdb.HSet(context.Background(), capsKey, caps.Tenant, data).Err(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.caps[caps.Tenant] = caps
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns a tenant's caps, or nil when it has none
+func (s *Store) Get(tenant string) *Caps {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		data, err := rdb.HGet(ctx, capsKey, tenant).Bytes()
+		switch {
+		case err == redis.Nil:
+			return nil
+		case err != nil:
+			log.WithError(err).WithField("tenant", tenant).Warn("Failed to read budget caps from Redis, using local copy")
+		default:
+			var caps Caps
+			if err := json.Unmarshal(data, &caps); err == nil {
+				return &caps
+			}
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if caps, ok := s.caps[tenant]; ok {
+		return &caps
+	}
+	return nil
+}
+
+// Delete removes a tenant's caps
+func (s *Store) Delete(tenant string) bool {
+	s.mu.Lock()
+	_, deleted := s.caps[tenant]
+	delete(s.caps, tenant)
+	s.mu.Unlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if n, err := rdb.HDel(context.Background(), capsKey, tenant).Result(); err == nil && n > 0 {
+			deleted = true
+		}
+	}
+	return deleted
+}
+
+// Crossed returns the alert thresholds (percentages) a metric has newly
+// crossed this month. Each threshold is reported once per tenant, metric
+// and month, across instances when Redis is connected.
+func (s *Store) Crossed(tenant, month string, status Status) []float64 {
+	var crossed []float64
+	for _, threshold := range s.thresholds {
+		if status.Percent < threshold {
+			break
+		}
+		key := fmt.Sprintf("%s%s:%s:%s:%g", alertPrefix, tenant, month, status.Metric, threshold)
+		if s.markAlerted(key) {
+			crossed = append(crossed, threshold)
+		}
+	}
+	return crossed
+}
+
+// markAlerted records an alert, reporting whether it was not yet recorded
+func (s *Store) markAlerted(key string) bool {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ok, err := rdb.SetNX(context.Background(), key, 1, alertTTL).Result()
+		if err == nil {
+			return ok
+		}
+		log.WithError(err).Warn("Failed to record budget alert in Redis, using local copy")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.alerted[key] {
+		return false
+	}
+	s.alerted[key] = true
+	return true
+}
@@ -0,0 +1,203 @@
+package bundle
+
+import (
+	"archive/tar"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format version written to the bundle manifest
+const Version = 1
+
+// Well-known entries in a bundle
+const (
+	manifestFile = "manifest.json"
+	jobFile      = "job.json"
+	resultsFile  = "results.json"
+	artifactsDir = "artifacts/"
+)
+
+// Limits on what Read unpacks, so a small bundle can't decompress into
+// enough data to exhaust memory
+var (
+	maxSize    int64 = 1 << 30
+	maxEntries       = 100000
+)
+
+// maxWindow bounds the memory the decoder keeps for back-references; Write
+// uses a far smaller window
+const maxWindow = 64 << 20
+
+// Manifest describes the contents of a job bundle
+type Manifest struct {
+	Version   int       `json:"version"`
+	JobID     string    `json:"job_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Results   int       `json:"results"`
+	Artifacts []string  `json:"artifacts"`
+}
+
+// Bundle is the decoded content of a job bundle
+type Bundle struct {
+	Manifest  Manifest
+	Job       models.CrawlJob
+	Results   []models.CrawlResult
+	Artifacts map[string][]byte
+}
+
+// Write encodes a job, its results and any artifacts (archived HTML,
+// screenshots) as a zstd-compressed tar stream. Each entry is compressed
+// and written to w as soon as it is added, so w can be a response being
+// sent.
+func Write(w io.Writer, b *Bundle) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	if err := writeTar(zw, b); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// writeTar writes the entries of a bundle as a tar stream
+func writeTar(w io.Writer, b *Bundle) error {
+	tw := tar.NewWriter(w)
+
+	job := b.Job
+	job.Results = nil
+	job.ResultsRef = ""
+
+	b.Manifest = Manifest{
+		Version:   Version,
+		JobID:     job.ID,
+		CreatedAt: time.Now().UTC(),
+		Results:   len(b.Results),
+	}
+	for name := range b.Artifacts {
+		b.Manifest.Artifacts = append(b.Manifest.Artifacts, name)
+	}
+
+	entries := []struct {
+		name  string
+		value interface{}
+	}{
+		{manifestFile, b.Manifest},
+		{jobFile, job},
+		{resultsFile, b.Results},
+	}
+	for _, entry := range entries {
+		data, err := json.MarshalIndent(entry.value, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", entry.name, err)
+		}
+		if err := writeFile(tw, entry.name, data); err != nil {
+			return err
+		}
+	}
+
+	for name, data := range b.Artifacts {
+		if err := writeFile(tw, artifactsDir+name, data); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now().UTC(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Read decodes a bundle produced by Write, refusing bundles that unpack
+// to more than 1 GiB or 100000 entries
+func Read(r io.Reader) (*Bundle, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderMaxWindow(maxWindow))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle compression: %w", err)
+	}
+	defer zr.Close()
+
+	b := &Bundle{Artifacts: make(map[string][]byte)}
+	var haveManifest, haveJob bool
+
+	// One byte over the limit tells a bundle of exactly maxSize from a
+	// larger one
+	limited := &io.LimitedReader{R: zr, N: maxSize + 1}
+	tooLarge := fmt.Errorf("bundle unpacks to more than %d bytes", maxSize)
+	tr := tar.NewReader(limited)
+	for entries := 1; ; entries++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if limited.N <= 0 {
+			return nil, tooLarge
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle archive: %w", err)
+		}
+		if entries > maxEntries {
+			return nil, fmt.Errorf("bundle has more than %d entries", maxEntries)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Size >= limited.N {
+			return nil, tooLarge
+		}
+
+		data, err := io.ReadAll(tr)
+		if limited.N <= 0 {
+			return nil, tooLarge
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch name := path.Clean(hdr.Name); {
+		case name == manifestFile:
+			if err := json.Unmarshal(data, &b.Manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			haveManifest = true
+		case name == jobFile:
+			if err := json.Unmarshal(data, &b.Job); err != nil {
+				return nil, fmt.Errorf("invalid job metadata: %w", err)
+			}
+			haveJob = true
+		case name == resultsFile:
+			if err := json.Unmarshal(data, &b.Results); err != nil {
+				return nil, fmt.Errorf("invalid results: %w", err)
+			}
+		case len(name) > len(artifactsDir) && name[:len(artifactsDir)] == artifactsDir:
+			b.Artifacts[name[len(artifactsDir):]] = data
+		}
+	}
+
+	if !haveManifest || !haveJob {
+		return nil, errors.New("bundle is missing manifest or job metadata")
+	}
+	if b.Manifest.Version > Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Manifest.Version)
+	}
+	return b, nil
+}
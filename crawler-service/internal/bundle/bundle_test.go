@@ -0,0 +1,73 @@
+package bundle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+func TestWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, &Bundle{
+		Job:       models.CrawlJob{ID: "job-1", Tenant: "acme", ResultsRef: "s3://bucket/results/acme/job-1.json"},
+		Results:   []models.CrawlResult{{URL: "https://example.com/"}},
+		Artifacts: map[string][]byte{"html/job-1/page.html.gz": []byte("page")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Job.ID != "job-1" || b.Job.ResultsRef != "" {
+		t.Errorf("job = %+v, want job-1 without a results reference", b.Job)
+	}
+	if len(b.Results) != 1 || b.Results[0].URL != "https://example.com/" {
+		t.Errorf("results = %+v", b.Results)
+	}
+	if got := string(b.Artifacts["html/job-1/page.html.gz"]); got != "page" {
+		t.Errorf("artifact = %q, want %q", got, "page")
+	}
+}
+
+func TestReadRefusesOversizedBundles(t *testing.T) {
+	defer func(size int64, entries int) { maxSize, maxEntries = size, entries }(maxSize, maxEntries)
+	maxSize, maxEntries = 1<<20, 10
+
+	tests := []struct {
+		name      string
+		artifacts map[string][]byte
+		want      string
+	}{
+		// Zeros compress to almost nothing, like a zstd bomb
+		{"large entry", map[string][]byte{"bomb": make([]byte, 2<<20)}, "more than 1048576 bytes"},
+		{"large total", map[string][]byte{"a": make([]byte, 600<<10), "b": make([]byte, 600<<10)}, "more than 1048576 bytes"},
+		{"many entries", manyArtifacts(20), "more than 10 entries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, &Bundle{Job: models.CrawlJob{ID: "job-1"}, Artifacts: tt.artifacts}); err != nil {
+				t.Fatal(err)
+			}
+			if buf.Len() > 64<<10 {
+				t.Fatalf("bundle compressed to %d bytes", buf.Len())
+			}
+			if _, err := Read(&buf); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Read error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func manyArtifacts(n int) map[string][]byte {
+	artifacts := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		artifacts[strings.Repeat("a", i+1)] = nil
+	}
+	return artifacts
+}
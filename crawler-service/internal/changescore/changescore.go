@@ -0,0 +1,165 @@
+package changescore
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/hibp"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Weights of the score components; they sum to 1
+const (
+	textWeight   = 0.5
+	entityWeight = 0.25
+	domainWeight = 0.25
+)
+
+// Component counts at which a component reaches its full weight
+const (
+	fullEntities = 3
+	fullDomains  = 2
+)
+
+// maxEntities caps the emails read from one snapshot
+const maxEntities = 200
+
+// Snapshot is the content of a watched target at one point in time
+type Snapshot struct {
+	Text  string
+	Links []string
+}
+
+// Change describes how significant the difference between two snapshots is
+type Change struct {
+	// Score runs from 0 (identical) to 1 (rewritten with new entities and
+	// domains)
+	Score float64 `json:"score"`
+	// TextChange is the share of words added or removed
+	TextChange  float64  `json:"text_change"`
+	NewEntities []string `json:"new_entities,omitempty"`
+	NewDomains  []string `json:"new_domains,omitempty"`
+}
+
+// Compare scores the change from before to after. Half of the score comes
+// from how much of the text changed, a quarter from email addresses and
+// links that were not there before and a quarter from links to domains
+// that were not linked before.
+func Compare(before, after Snapshot) Change {
+	change := Change{
+		TextChange:  textChange(before.Text, after.Text),
+		NewEntities: added(entities(before), entities(after)),
+		NewDomains:  added(domains(before.Links), domains(after.Links)),
+	}
+
+	score := textWeight*change.TextChange +
+		entityWeight*math.Min(1, float64(len(change.NewEntities))/fullEntities) +
+		domainWeight*math.Min(1, float64(len(change.NewDomains))/fullDomains)
+	change.Score = math.Round(score*1000) / 1000
+	return change
+}
+
+// textChange returns the share of words that differ between two texts,
+// counting repeated words separately
+func textChange(before, after string) float64 {
+	a, b := strings.Fields(strings.ToLower(before)), strings.Fields(strings.ToLower(after))
+	total := len(a) + len(b)
+	if total == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, w := range a {
+		counts[w]++
+	}
+	common := 0
+	for _, w := range b {
+		if counts[w] > 0 {
+			counts[w]--
+			common++
+		}
+	}
+	return float64(total-2*common) / float64(total)
+}
+
+// entities returns the email addresses and link targets of a snapshot
+func entities(s Snapshot) []string {
+	found := hibp.ExtractEmails(s.Text, maxEntities)
+	return append(found, s.Links...)
+}
+
+// domains returns the registrable domains of links
+func domains(links []string) []string {
+	var found []string
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+			host = domain
+		}
+		found = append(found, host)
+	}
+	return found
+}
+
+// added returns the distinct values of after missing from before, sorted
+func added(before, after []string) []string {
+	seen := make(map[string]bool, len(before))
+	for _, v := range before {
+		seen[v] = true
+	}
+
+	var fresh []string
+	for _, v := range after {
+		if !seen[v] {
+			seen[v] = true
+			fresh = append(fresh, v)
+		}
+	}
+	sort.Strings(fresh)
+	return fresh
+}
+
+// Lines returns the lines of text added from before to after and those
+// removed, in the order they appear and at most limit of each. Blank lines
+// are ignored and repeated lines counted separately.
+func Lines(before, after string, limit int) (addedLines, removedLines []string) {
+	a, b := nonBlankLines(before), nonBlankLines(after)
+	return lineDifference(b, a, limit), lineDifference(a, b, limit)
+}
+
+// lineDifference returns the lines of from not matched by a line of other
+func lineDifference(from, other []string, limit int) []string {
+	counts := make(map[string]int, len(other))
+	for _, line := range other {
+		counts[line]++
+	}
+	var diff []string
+	for _, line := range from {
+		if counts[line] > 0 {
+			counts[line]--
+			continue
+		}
+		if len(diff) == limit {
+			break
+		}
+		diff = append(diff, line)
+	}
+	return diff
+}
+
+func nonBlankLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,402 @@
+// Package cluster spreads crawls over several instances sharing a Redis.
+// A coordinator accepts jobs and queues their seed URLs; workers take URLs
+// from the shared queue, fetch them, queue the links they find and write
+// the results back. URLs are deduplicated per job in a Redis set, and the
+// worker finishing a job's last URL is the only one to mark it done.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Roles an instance plays, set by CRAWLER_ROLE
+const (
+	// RoleCoordinator instances accept jobs and queue their URLs for the
+	// workers, but fetch nothing themselves
+	RoleCoordinator = "coordinator"
+	// RoleWorker instances crawl the URLs queued by coordinators
+	RoleWorker = "worker"
+)
+
+// DefaultWorkers is how many URLs a worker instance fetches at once
+// without CLUSTER_WORKERS
+const DefaultWorkers = 4
+
+// Redis keys; per-job keys are suffixed with the job ID
+const (
+	keyQueue   = "cluster:queue"
+	keySpec    = "cluster:spec:"
+	keyVisited = "cluster:visited:"
+	keyPending = "cluster:pending:"
+	keyPages   = "cluster:pages:"
+	keyResults = "cluster:results:"
+	keyErrors  = "cluster:errors:"
+	keyDone    = "cluster:done:"
+	keyCancel  = "cluster:cancel:"
+)
+
+// redisTimeout bounds the Redis round trips other than waiting for work
+const redisTimeout = 10 * time.Second
+
+// ErrUnknownJob is returned for tasks of jobs whose keys were removed,
+// because the job finished or was stopped
+var ErrUnknownJob = errors.New("job is no longer distributed")
+
+// enqueue queues a URL of a job unless its key was already queued. The pending
+// count is raised before the task is visible, so the job cannot be seen
+// to finish while a task is in flight.
+var enqueue = redis.NewScript(`
+if redis.call('SADD', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('INCR', KEYS[2])
+redis.call('LPUSH', KEYS[3], ARGV[2])
+return 1
+`)
+
+// complete counts a task done. Only the caller completing the last pending
+// task gets 1, however many workers finish at once. Tasks of closed jobs
+// leave no keys behind.
+var complete = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 0 then
+	return 0
+end
+if redis.call('DECR', KEYS[1]) > 0 then
+	return 0
+end
+return redis.call('SETNX', KEYS[2], 1)
+`)
+
+// addResult writes a result back unless the job was closed meanwhile
+var addResult = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+return redis.call('RPUSH', KEYS[2], ARGV[1])
+`)
+
+// Task is a URL of a job waiting to be fetched
+type Task struct {
+	JobID string `json:"job_id"`
+	URL   string `json:"url"`
+	From  string `json:"from,omitempty"`
+	// Depth counts from 1 for seed URLs, as colly does
+	Depth int `json:"depth"`
+}
+
+// Spec is what workers need to know of a job to crawl its URLs
+type Spec struct {
+	Job     models.CrawlJob     `json:"job"`
+	Request models.CrawlRequest `json:"request"`
+	// Seeds are the URLs the crawl started from, which same-domain crawls
+	// stay on the sites of
+	Seeds []string `json:"seeds"`
+}
+
+// Progress is a distributed job's state as the workers left it
+type Progress struct {
+	// Pending counts the tasks queued or being fetched
+	Pending int
+	// Pages counts the pages taken against the job's budget
+	Pages int
+	// Found counts the URLs queued over the job's life
+	Found int
+	Done  bool
+}
+
+// Cluster is this instance's view of the shared queue
+type Cluster struct {
+	rdb     *redis.Client
+	role    string
+	workers int
+}
+
+// NewFromEnv returns the cluster this instance takes part in per
+// CRAWLER_ROLE, or nil when it crawls on its own. Workers run
+// CLUSTER_WORKERS fetches at once (default DefaultWorkers).
+func NewFromEnv() (*Cluster, error) {
+	role := strings.ToLower(strings.TrimSpace(os.Getenv("CRAWLER_ROLE")))
+	switch role {
+	case "", "standalone":
+		return nil, nil
+	case RoleCoordinator, RoleWorker:
+	default:
+		return nil, fmt.Errorf("unknown CRAWLER_ROLE %q, expected %s or %s", role, RoleCoordinator, RoleWorker)
+	}
+
+	rdb := database.GetRedisClient()
+	if rdb == nil {
+		return nil, fmt.Errorf("CRAWLER_ROLE %s needs Redis", role)
+	}
+	workers := DefaultWorkers
+	if n, err := strconv.Atoi(os.Getenv("CLUSTER_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+	return &Cluster{rdb: rdb, role: role, workers: workers}, nil
+}
+
+// Role returns RoleCoordinator or RoleWorker
+func (c *Cluster) Role() string {
+	return c.role
+}
+
+// Workers returns how many URLs a worker instance fetches at once
+func (c *Cluster) Workers() int {
+	return c.workers
+}
+
+// Open publishes a job's spec for the workers. URLs under the keys in
+// visited, those a continued crawl already fetched, are not queued again.
+func (c *Cluster) Open(spec Spec, visited []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	id := spec.Job.ID
+	if len(visited) > 0 {
+		members := make([]interface{}, len(visited))
+		for i, key := range visited {
+			members[i] = key
+		}
+		if err := c.rdb.SAdd(ctx, keyVisited+id, members...).Err(); err != nil {
+			return err
+		}
+	}
+	return c.rdb.Set(ctx, keySpec+id, data, 0).Err()
+}
+
+// Enqueue queues a task unless a URL under the same key was already queued
+// for the job, and reports whether it was
+func (c *Cluster) Enqueue(task Task, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return false, err
+	}
+	keys := []string{keyVisited + task.JobID, keyPending + task.JobID, keyQueue}
+	n, err := enqueue.Run(ctx, c.rdb, keys, key, data).Int()
+	return n == 1, err
+}
+
+// Requeue puts back a task taken but not fetched, at the head of the
+// queue; it stays pending meanwhile
+func (c *Cluster) Requeue(task Task) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return c.rdb.RPush(ctx, keyQueue, data).Err()
+}
+
+// Next waits up to wait for a task, returning nil if none came
+func (c *Cluster) Next(ctx context.Context, wait time.Duration) (*Task, error) {
+	res, err := c.rdb.BRPop(ctx, wait, keyQueue).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(res[1]), &task); err != nil {
+		return nil, fmt.Errorf("unreadable task: %w", err)
+	}
+	return &task, nil
+}
+
+// Spec returns a job's spec, or ErrUnknownJob
+func (c *Cluster) Spec(jobID string) (*Spec, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := c.rdb.Get(ctx, keySpec+jobID).Bytes()
+	if err == redis.Nil {
+		return nil, ErrUnknownJob
+	}
+	if err != nil {
+		return nil, err
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("unreadable job spec: %w", err)
+	}
+	return &spec, nil
+}
+
+// TakePage counts a page against a job's budget and reports whether it is
+// within max
+func (c *Cluster) TakePage(jobID string, max int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	n, err := c.rdb.Incr(ctx, keyPages+jobID).Result()
+	if err != nil {
+		return false, err
+	}
+	if max > 0 && int(n) > max {
+		c.rdb.Decr(ctx, keyPages+jobID)
+		return false, nil
+	}
+	return true, nil
+}
+
+// ReleasePage gives back a page taken by TakePage that turned out not to
+// count, such as a soft 404
+func (c *Cluster) ReleasePage(jobID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return c.rdb.Decr(ctx, keyPages+jobID).Err()
+}
+
+// AddResult writes a page's result back for the coordinator
+func (c *Cluster) AddResult(jobID string, result models.CrawlResult) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return addResult.Run(ctx, c.rdb, []string{keySpec + jobID, keyResults + jobID}, data).Err()
+}
+
+// CountError records a failed fetch of a job by error code
+func (c *Cluster) CountError(jobID, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return c.rdb.HIncrBy(ctx, keyErrors+jobID, code, 1).Err()
+}
+
+// Complete counts a task done and reports whether it was the job's last,
+// which happens for exactly one caller
+func (c *Cluster) Complete(task Task) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	keys := []string{keyPending + task.JobID, keyDone + task.JobID, keySpec + task.JobID}
+	n, err := complete.Run(ctx, c.rdb, keys).Int()
+	return n == 1, err
+}
+
+// Cancel tells the workers to drop a job's remaining tasks
+func (c *Cluster) Cancel(jobID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return c.rdb.Set(ctx, keyCancel+jobID, 1, 0).Err()
+}
+
+// Cancelled reports whether a job's tasks are to be dropped
+func (c *Cluster) Cancelled(jobID string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := c.rdb.Exists(ctx, keyCancel+jobID).Result()
+	return err == nil && n > 0
+}
+
+// Progress reads a job's pending tasks, pages taken and whether it is done
+func (c *Cluster) Progress(jobID string) (Progress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := c.rdb.Pipeline()
+	pending := pipe.Get(ctx, keyPending+jobID)
+	pages := pipe.Get(ctx, keyPages+jobID)
+	found := pipe.SCard(ctx, keyVisited+jobID)
+	done := pipe.Exists(ctx, keyDone+jobID)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return Progress{}, err
+	}
+	p := Progress{Found: int(found.Val()), Done: done.Val() > 0}
+	p.Pending, _ = strconv.Atoi(pending.Val())
+	p.Pages, _ = strconv.Atoi(pages.Val())
+	return p, nil
+}
+
+// Results reads the results written back for a job from index from on
+func (c *Cluster) Results(jobID string, from int) ([]models.CrawlResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	items, err := c.rdb.LRange(ctx, keyResults+jobID, int64(from), -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]models.CrawlResult, 0, len(items))
+	for _, item := range items {
+		var result models.CrawlResult
+		if err := json.Unmarshal([]byte(item), &result); err != nil {
+			return nil, fmt.Errorf("unreadable result: %w", err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ErrorCounts reads a job's failed fetches by error code
+func (c *Cluster) ErrorCounts(jobID string) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	counts, err := c.rdb.HGetAll(ctx, keyErrors+jobID).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int, len(counts))
+	for code, n := range counts {
+		out[code], _ = strconv.Atoi(n)
+	}
+	return out, nil
+}
+
+// Remaining returns the URLs of a job still waiting in the queue, for the
+// frontier of a stopped job
+func (c *Cluster) Remaining(jobID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	items, err := c.rdb.LRange(ctx, keyQueue, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	for i := len(items) - 1; i >= 0; i-- {
+		var task Task
+		if json.Unmarshal([]byte(items[i]), &task) == nil && task.JobID == jobID {
+			urls = append(urls, task.URL)
+		}
+	}
+	return urls, nil
+}
+
+// Close removes a job's keys. Tasks of the job still queued are dropped by
+// the workers that take them.
+func (c *Cluster) Close(jobID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	keys := []string{keySpec, keyVisited, keyPending, keyPages, keyResults, keyErrors, keyDone, keyCancel}
+	for i, prefix := range keys {
+		keys[i] = prefix + jobID
+	}
+	return c.rdb.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,125 @@
+package codesearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxFileBytes caps the size of a fetched file
+const MaxFileBytes = 1 << 20
+
+// Hit is a file matching a code search query
+type Hit struct {
+	Provider string
+	Repo     string
+	Path     string
+	Ref      string
+	URL      string // web URL of the file
+
+	fetchURL string
+}
+
+// Provider searches one code hosting service
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, query string, limit int) ([]Hit, error)
+	Fetch(ctx context.Context, hit Hit) ([]byte, error)
+}
+
+// Registry holds the configured code search providers
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistryFromEnv enables GitHub when GITHUB_TOKEN is set (code search
+// requires authentication) and GitLab when GITLAB_TOKEN is set, against
+// GITLAB_URL (default https://gitlab.com)
+func NewRegistryFromEnv() *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		r.Register(NewGitHub(os.Getenv("GITHUB_API_URL"), token))
+	}
+	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		r.Register(NewGitLab(os.Getenv("GITLAB_URL"), token))
+	}
+	return r
+}
+
+// Register adds a provider, replacing one with the same name
+func (r *Registry) Register(p Provider) {
+	r.providers[p.Name()] = p
+}
+
+// Names returns the configured provider names in order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the named providers, or all of them when names is empty
+func (r *Registry) Select(names []string) ([]Provider, error) {
+	if len(names) == 0 {
+		names = r.Names()
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no code search providers configured")
+	}
+
+	selected := make([]Provider, 0, len(names))
+	for _, name := range names {
+		p, ok := r.providers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown code search provider %q (configured: %s)", name, strings.Join(r.Names(), ", "))
+		}
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
+
+// apiClient is the HTTP plumbing shared by the providers
+type apiClient struct {
+	http   *http.Client
+	header http.Header
+}
+
+func newAPIClient(header http.Header) apiClient {
+	return apiClient{http: &http.Client{Timeout: 30 * time.Second}, header: header}
+}
+
+func (c apiClient) get(ctx context.Context, url string, extra http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	for k, v := range extra {
+		req.Header[k] = v
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxFileBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d: %.200s", req.URL.Host, resp.StatusCode, body)
+	}
+	return body, nil
+}
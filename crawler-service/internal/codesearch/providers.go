@@ -0,0 +1,209 @@
+package codesearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// GitHub searches code through the GitHub REST API
+type GitHub struct {
+	baseURL string
+	client  apiClient
+}
+
+// NewGitHub creates a GitHub provider; baseURL defaults to api.github.com
+func NewGitHub(baseURL, token string) *GitHub {
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	return &GitHub{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client: newAPIClient(http.Header{
+			"Authorization":        {"Bearer " + token},
+			"X-Github-Api-Version": {"2022-11-28"},
+		}),
+	}
+}
+
+// Name implements Provider
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+// Search implements Provider
+func (g *GitHub) Search(ctx context.Context, query string, limit int) ([]Hit, error) {
+	perPage := limit
+	if perPage > 100 {
+		perPage = 100
+	}
+
+	var hits []Hit
+	for page := 1; len(hits) < limit; page++ {
+		q := url.Values{
+			"q":        {query},
+			"per_page": {fmt.Sprint(perPage)},
+			"page":     {fmt.Sprint(page)},
+		}
+		body, err := g.client.get(ctx, g.baseURL+"/search/code?"+q.Encode(), nil)
+		if err != nil {
+			return hits, err
+		}
+
+		var res struct {
+			Items []struct {
+				Path       string `json:"path"`
+				SHA        string `json:"sha"`
+				URL        string `json:"url"`
+				HTMLURL    string `json:"html_url"`
+				Repository struct {
+					FullName string `json:"full_name"`
+				} `json:"repository"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return hits, fmt.Errorf("invalid GitHub search response: %w", err)
+		}
+
+		for _, item := range res.Items {
+			hits = append(hits, Hit{
+				Provider: g.Name(),
+				Repo:     item.Repository.FullName,
+				Path:     item.Path,
+				Ref:      item.SHA,
+				URL:      item.HTMLURL,
+				fetchURL: item.URL,
+			})
+		}
+		if len(res.Items) < perPage {
+			break
+		}
+	}
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// Fetch implements Provider
+func (g *GitHub) Fetch(ctx context.Context, hit Hit) ([]byte, error) {
+	return g.client.get(ctx, hit.fetchURL, http.Header{"Accept": {"application/vnd.github.raw"}})
+}
+
+// GitLab searches code through the GitLab REST API
+type GitLab struct {
+	baseURL  string
+	client   apiClient
+	mu       sync.Mutex
+	projects map[int]gitlabProject
+}
+
+type gitlabProject struct {
+	Path   string `json:"path_with_namespace"`
+	WebURL string `json:"web_url"`
+}
+
+// NewGitLab creates a GitLab provider; baseURL defaults to gitlab.com
+func NewGitLab(baseURL, token string) *GitLab {
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	return &GitLab{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		client:   newAPIClient(http.Header{"Private-Token": {token}}),
+		projects: make(map[int]gitlabProject),
+	}
+}
+
+// Name implements Provider
+func (g *GitLab) Name() string {
+	return "gitlab"
+}
+
+// Search implements Provider
+func (g *GitLab) Search(ctx context.Context, query string, limit int) ([]Hit, error) {
+	perPage := limit
+	if perPage > 100 {
+		perPage = 100
+	}
+
+	var hits []Hit
+	for page := 1; len(hits) < limit; page++ {
+		q := url.Values{
+			"scope":    {"blobs"},
+			"search":   {query},
+			"per_page": {fmt.Sprint(perPage)},
+			"page":     {fmt.Sprint(page)},
+		}
+		body, err := g.client.get(ctx, g.baseURL+"/api/v4/search?"+q.Encode(), nil)
+		if err != nil {
+			return hits, err
+		}
+
+		var items []struct {
+			Path      string `json:"path"`
+			Ref       string `json:"ref"`
+			ProjectID int    `json:"project_id"`
+		}
+		if err := json.Unmarshal(body, &items); err != nil {
+			return hits, fmt.Errorf("invalid GitLab search response: %w", err)
+		}
+
+		for _, item := range items {
+			project, err := g.project(ctx, item.ProjectID)
+			if err != nil {
+				continue
+			}
+			hits = append(hits, Hit{
+				Provider: g.Name(),
+				Repo:     project.Path,
+				Path:     item.Path,
+				Ref:      item.Ref,
+				URL:      fmt.Sprintf("%s/-/blob/%s/%s", project.WebURL, item.Ref, item.Path),
+				fetchURL: fmt.Sprintf("%s/api/v4/projects/%d/repository/files/%s/raw?ref=%s",
+					g.baseURL, item.ProjectID, url.PathEscape(item.Path), url.QueryEscape(item.Ref)),
+			})
+		}
+		if len(items) < perPage {
+			break
+		}
+	}
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// project looks up and caches a project's path and web URL
+func (g *GitLab) project(ctx context.Context, id int) (gitlabProject, error) {
+	g.mu.Lock()
+	p, ok := g.projects[id]
+	g.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	body, err := g.client.get(ctx, fmt.Sprintf("%s/api/v4/projects/%d", g.baseURL, id), nil)
+	if err != nil {
+		return gitlabProject{}, err
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return gitlabProject{}, err
+	}
+
+	g.mu.Lock()
+	g.projects[id] = p
+	g.mu.Unlock()
+	return p, nil
+}
+
+// Fetch implements Provider
+func (g *GitLab) Fetch(ctx context.Context, hit Hit) ([]byte, error) {
+	return g.client.get(ctx, hit.fetchURL, nil)
+}
@@ -0,0 +1,166 @@
+// Package compliance defines the named constraint profiles jobs run under
+// and checks requests against them.
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// Built-in profile names
+const (
+	Strict     = "strict"
+	Standard   = "standard"
+	Permissive = "permissive"
+)
+
+// builtin are the profiles every deployment offers
+var builtin = []models.ComplianceProfile{
+	{Name: Strict, RespectRobots: true, PublicOnly: true},
+	{Name: Standard, RespectRobots: true, AllowLogins: true, PublicOnly: true},
+	{Name: Permissive, AllowLogins: true, AllowTor: true},
+}
+
+// loginHeaders carry credentials or sessions
+var loginHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// Registry holds the profiles available to jobs
+type Registry struct {
+	profiles map[string]models.ComplianceProfile
+	fallback string
+}
+
+// NewRegistryFromEnv offers the built-in profiles plus those defined in the
+// JSON array file COMPLIANCE_PROFILES_FILE, which may also redefine
+// built-ins. COMPLIANCE_DEFAULT_PROFILE (default permissive) applies to jobs
+// that name none. On a configuration error the built-ins are returned with
+// strict as the default, alongside the error.
+func NewRegistryFromEnv() (*Registry, error) {
+	r := &Registry{profiles: make(map[string]models.ComplianceProfile), fallback: Permissive}
+	for _, p := range builtin {
+		r.profiles[p.Name] = p
+	}
+	if err := r.configure(); err != nil {
+		strict := &Registry{profiles: make(map[string]models.ComplianceProfile), fallback: Strict}
+		for _, p := range builtin {
+			strict.profiles[p.Name] = p
+		}
+		return strict, err
+	}
+	return r, nil
+}
+
+func (r *Registry) configure() error {
+	if path := os.Getenv("COMPLIANCE_PROFILES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var defined []models.ComplianceProfile
+		if err := json.Unmarshal(data, &defined); err != nil {
+			return fmt.Errorf("invalid compliance profiles: %w", err)
+		}
+		for _, p := range defined {
+			if p.Name == "" {
+				return fmt.Errorf("compliance profiles need a name")
+			}
+			p.Name = strings.ToLower(p.Name)
+			r.profiles[p.Name] = p
+		}
+	}
+
+	if name := strings.ToLower(os.Getenv("COMPLIANCE_DEFAULT_PROFILE")); name != "" {
+		if _, ok := r.profiles[name]; !ok {
+			return fmt.Errorf("unknown COMPLIANCE_DEFAULT_PROFILE %q", name)
+		}
+		r.fallback = name
+	}
+	return nil
+}
+
+// Get returns the named profile, or the default one for ""
+func (r *Registry) Get(name string) (models.ComplianceProfile, error) {
+	if name == "" {
+		name = r.fallback
+	}
+	p, ok := r.profiles[strings.ToLower(name)]
+	if !ok {
+		return models.ComplianceProfile{}, fmt.Errorf("unknown compliance profile %q", name)
+	}
+	return p, nil
+}
+
+// Default returns the name of the profile used when a job names none
+func (r *Registry) Default() string {
+	return r.fallback
+}
+
+// List returns every profile, sorted by name
+func (r *Registry) List() []models.ComplianceProfile {
+	list := make([]models.ComplianceProfile, 0, len(r.profiles))
+	for _, p := range r.profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Violations lists what in a request the profile forbids
+func Violations(p models.ComplianceProfile, req models.CrawlRequest) []string {
+	var violations []string
+
+	if !p.AllowLogins {
+		if len(req.DomainCredentials) > 0 {
+			violations = append(violations, "domain_credentials are not allowed")
+		}
+		if len(req.ClientCertificates) > 0 {
+			violations = append(violations, "client_certificates are not allowed")
+		}
+		for name := range req.Headers {
+			for _, h := range loginHeaders {
+				if http.CanonicalHeaderKey(name) == h {
+					violations = append(violations, fmt.Sprintf("the %s header is not allowed", h))
+				}
+			}
+		}
+	}
+
+	if p.RespectRobots && req.IgnoreRobots {
+		violations = append(violations, "ignore_robots is not allowed")
+	}
+
+	if u, err := url.Parse(req.Query); err == nil && u.Host != "" {
+		if !p.AllowTor && IsOnion(u.Hostname()) {
+			violations = append(violations, "onion services are not allowed")
+		}
+	}
+	if p.PublicOnly && strings.HasPrefix(strings.ToLower(req.Query), "file:") {
+		violations = append(violations, "local files are not allowed")
+	}
+
+	sort.Strings(violations)
+	return violations
+}
+
+// IsOnion reports whether host is a Tor onion service
+func IsOnion(host string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), ".onion")
+}
+
+// Refuses reports why the profile forbids fetching a URL, or ""
+func Refuses(p models.ComplianceProfile, u *url.URL) string {
+	switch {
+	case !p.AllowTor && IsOnion(u.Hostname()):
+		return "onion services are not allowed"
+	case p.PublicOnly && u.Scheme == "file":
+		return "local files are not allowed"
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package compliance
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+func TestRegistryFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "Research", "respect_robots": true, "public_only": true, "allow_tor": true}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("COMPLIANCE_PROFILES_FILE", path)
+	t.Setenv("COMPLIANCE_DEFAULT_PROFILE", "research")
+
+	r, err := NewRegistryFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := r.Get("")
+	if err != nil || p.Name != "research" || !p.AllowTor {
+		t.Errorf("default profile = %+v, %v; want research", p, err)
+	}
+	if p, err := r.Get("STRICT"); err != nil || !p.PublicOnly || p.AllowLogins {
+		t.Errorf("built-in strict = %+v, %v", p, err)
+	}
+	if _, err := r.Get("lenient"); err == nil {
+		t.Error("unknown profile accepted")
+	}
+	if got := len(r.List()); got != 4 {
+		t.Errorf("List has %d profiles, want 4", got)
+	}
+}
+
+func TestRegistryFallsBackToStrict(t *testing.T) {
+	for name, env := range map[string]map[string]string{
+		"unknown default": {"COMPLIANCE_DEFAULT_PROFILE": "lenient"},
+		"missing file":    {"COMPLIANCE_PROFILES_FILE": filepath.Join(t.TempDir(), "missing.json")},
+		"unnamed profile": {"COMPLIANCE_PROFILES_FILE": writeProfiles(t, `[{"allow_tor": true}]`)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			r, err := NewRegistryFromEnv()
+			if err == nil {
+				t.Fatal("configuration error not reported")
+			}
+			if r.Default() != Strict {
+				t.Errorf("default after a configuration error = %s, want %s", r.Default(), Strict)
+			}
+		})
+	}
+}
+
+func writeProfiles(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestViolations(t *testing.T) {
+	strict := builtin[0]
+	permissive := builtin[2]
+	login := models.CrawlRequest{
+		Query:             "https://example.com",
+		Headers:           map[string]string{"cookie": "session=1", "X-Trace": "1"},
+		DomainCredentials: map[string]models.DomainCredential{"example.com": {}},
+		IgnoreRobots:      true,
+	}
+
+	tests := []struct {
+		name    string
+		profile models.ComplianceProfile
+		req     models.CrawlRequest
+		want    []string
+	}{
+		{"strict login", strict, login, []string{
+			"domain_credentials are not allowed",
+			"ignore_robots is not allowed",
+			"the Cookie header is not allowed",
+		}},
+		{"permissive login", permissive, login, nil},
+		{"strict onion", strict, models.CrawlRequest{Query: "http://abc.onion/"}, []string{"onion services are not allowed"}},
+		{"permissive onion", permissive, models.CrawlRequest{Query: "http://abc.onion/"}, nil},
+		{"strict file", strict, models.CrawlRequest{Query: "FILE:///etc/passwd"}, []string{"local files are not allowed"}},
+		{"strict public site", strict, models.CrawlRequest{Query: "https://example.com"}, nil},
+	}
+	for _, tt := range tests {
+		if got := Violations(tt.profile, tt.req); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Violations = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRefuses(t *testing.T) {
+	strict := builtin[0]
+	for raw, want := range map[string]string{
+		"http://hidden.onion./page": "onion services are not allowed",
+		"file:///etc/passwd":        "local files are not allowed",
+		"https://example.com/":      "",
+	} {
+		u, _ := url.Parse(raw)
+		if got := Refuses(strict, u); got != want {
+			t.Errorf("Refuses(%s) = %q, want %q", raw, got, want)
+		}
+	}
+	u, _ := url.Parse("http://hidden.onion/")
+	if got := Refuses(builtin[2], u); got != "" {
+		t.Errorf("permissive refuses onion services: %q", got)
+	}
+}
@@ -0,0 +1,305 @@
+// Package confidence scores how far the entities extracted from a page can
+// be trusted, from 0 to 1. A score starts from the weight of the method
+// the entity was extracted by, gains for corroborating context (an address
+// on the page's own domain, a number in the page's country) and for passing
+// validation (an email domain accepting mail, a GTIN check digit), and
+// loses for failing it. Weights are configurable.
+package confidence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/mailcheck"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/phone"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Entity kinds, as named in the weights
+const (
+	KindEmail        = "email"
+	KindPhone        = "phone"
+	KindProduct      = "product"
+	KindOrganization = "organization"
+)
+
+// methodOrganization is the one method organisations are extracted by
+const methodOrganization = "imprint"
+
+// Weights configure scoring. Methods maps entity kinds to the base score of
+// each extraction method; Context, Validated and Invalid are added to or,
+// for Invalid, taken from it.
+type Weights struct {
+	Methods   map[string]map[string]float64 `json:"methods"`
+	Context   float64                       `json:"context"`
+	Validated float64                       `json:"validated"`
+	Invalid   float64                       `json:"invalid"`
+}
+
+// DefaultWeights returns the weights used unless configured otherwise
+func DefaultWeights() Weights {
+	return Weights{
+		Methods: map[string]map[string]float64{
+			KindEmail: {models.EntitySourceLink: 0.8, models.EntitySourceText: 0.6},
+			KindPhone: {models.EntitySourceLink: 0.8, models.EntitySourceText: 0.5},
+			KindProduct: {
+				"schema":    0.8,
+				"microdata": 0.75,
+				"meta":      0.65,
+				"selector":  0.4,
+			},
+			KindOrganization: {methodOrganization: 0.6},
+		},
+		Context:   0.1,
+		Validated: 0.1,
+		Invalid:   0.4,
+	}
+}
+
+// Scorer scores entities
+type Scorer struct {
+	weights Weights
+}
+
+// NewScorerFromEnv returns a scorer using the default weights, overridden
+// by those in the JSON file CONFIDENCE_WEIGHTS_FILE. On a configuration
+// error the scorer uses the defaults alongside the error.
+func NewScorerFromEnv() (*Scorer, error) {
+	s := &Scorer{weights: DefaultWeights()}
+
+	path := os.Getenv("CONFIDENCE_WEIGHTS_FILE")
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	var configured struct {
+		Methods   map[string]map[string]float64 `json:"methods"`
+		Context   *float64                      `json:"context"`
+		Validated *float64                      `json:"validated"`
+		Invalid   *float64                      `json:"invalid"`
+	}
+	if err := json.Unmarshal(data, &configured); err != nil {
+		return s, fmt.Errorf("invalid confidence weights: %w", err)
+	}
+
+	weights := DefaultWeights()
+	for kind, methods := range configured.Methods {
+		if weights.Methods[kind] == nil {
+			return s, fmt.Errorf("unknown entity kind %q", kind)
+		}
+		for method, w := range methods {
+			if w < 0 || w > 1 {
+				return s, errors.New("confidence weights must be between 0 and 1")
+			}
+			weights.Methods[kind][method] = w
+		}
+	}
+	for _, w := range []struct {
+		configured *float64
+		weight     *float64
+	}{
+		{configured.Context, &weights.Context},
+		{configured.Validated, &weights.Validated},
+		{configured.Invalid, &weights.Invalid},
+	} {
+		if w.configured == nil {
+			continue
+		}
+		if *w.configured < 0 || *w.configured > 1 {
+			return s, errors.New("confidence weights must be between 0 and 1")
+		}
+		*w.weight = *w.configured
+	}
+	s.weights = weights
+	return s, nil
+}
+
+// Weights returns the weights in use
+func (s *Scorer) Weights() Weights {
+	return s.weights
+}
+
+// Score sets the confidence of every entity extracted from a page. Emails
+// are validated by their deliverability, when it was checked.
+func (s *Scorer) Score(result *models.CrawlResult) {
+	domain := registrableDomain(result.URL)
+
+	for i := range result.Emails {
+		e := &result.Emails[i]
+		score := s.weights.Methods[KindEmail][e.Source]
+		at := strings.LastIndex(e.Address, "@")
+		if at < 0 {
+			continue
+		}
+		emailDomain := strings.ToLower(e.Address[at+1:])
+		if domain != "" && registrableDomain("http://"+emailDomain) == domain {
+			score += s.weights.Context
+		}
+		switch e.Deliverability {
+		case mailcheck.Deliverable:
+			score += s.validation(true)
+		case mailcheck.Undeliverable:
+			score += s.validation(false)
+		}
+		e.Confidence = clamp(score)
+	}
+
+	country := pageCountry(result.URL)
+	for i := range result.Phones {
+		p := &result.Phones[i]
+		score := s.weights.Methods[KindPhone][p.Source]
+		if country != "" && p.Country == country {
+			score += s.weights.Context
+		}
+		if p.Type != "" && p.Type != phone.TypeUnknown {
+			score += s.weights.Validated
+		}
+		p.Confidence = clamp(score)
+	}
+
+	for i := range result.Products {
+		p := &result.Products[i]
+		score := s.weights.Methods[KindProduct][p.Source]
+		if p.Name != "" && p.Price > 0 && p.Currency != "" {
+			score += s.weights.Context
+		}
+		if p.GTIN != "" {
+			score += s.validation(validGTIN(p.GTIN))
+		}
+		p.Confidence = clamp(score)
+	}
+
+	if org := result.Organization; org != nil {
+		score := s.weights.Methods[KindOrganization][methodOrganization]
+		if org.Name != "" && len(org.Addresses) > 0 {
+			score += s.weights.Context
+		}
+		if len(org.RegistrationNumbers) > 0 || len(org.VATIDs) > 0 {
+			valid := len(org.RegistrationNumbers) > 0
+			for _, id := range org.VATIDs {
+				valid = valid || vatPattern.MatchString(id)
+			}
+			score += s.validation(valid)
+		}
+		org.Confidence = clamp(score)
+	}
+}
+
+// validation returns the adjustment for passing or failing validation
+func (s *Scorer) validation(valid bool) float64 {
+	if valid {
+		return s.weights.Validated
+	}
+	return -s.weights.Invalid
+}
+
+// Filter returns copies of results without the entities scored below min.
+// Entities without a score, such as those of pages crawled before scoring,
+// are removed too. A min of 0 returns results unchanged.
+func Filter(results []models.CrawlResult, min float64) []models.CrawlResult {
+	if min <= 0 {
+		return results
+	}
+	filtered := make([]models.CrawlResult, len(results))
+	for i, r := range results {
+		var emails []models.EmailEntity
+		for _, e := range r.Emails {
+			if e.Confidence >= min {
+				emails = append(emails, e)
+			}
+		}
+		var phones []models.PhoneEntity
+		for _, p := range r.Phones {
+			if p.Confidence >= min {
+				phones = append(phones, p)
+			}
+		}
+		var products []models.Product
+		for _, p := range r.Products {
+			if p.Confidence >= min {
+				products = append(products, p)
+			}
+		}
+		r.Emails, r.Phones, r.Products = emails, phones, products
+		if r.Organization != nil && r.Organization.Confidence < min {
+			r.Organization = nil
+		}
+		filtered[i] = r
+	}
+	return filtered
+}
+
+// vatPattern matches EU-style VAT IDs: a country prefix and 8-12 digits
+// or letters
+var vatPattern = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z]{8,12}$`)
+
+// validGTIN reports whether a GTIN-8, -12, -13 or -14 has a valid check
+// digit
+func validGTIN(gtin string) bool {
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	sum := 0
+	for i := len(gtin) - 2; i >= 0; i-- {
+		d := gtin[i]
+		if d < '0' || d > '9' {
+			return false
+		}
+		weight := 3
+		if (len(gtin)-2-i)%2 == 1 {
+			weight = 1
+		}
+		sum += int(d-'0') * weight
+	}
+	check := gtin[len(gtin)-1]
+	return check >= '0' && check <= '9' && int(check-'0') == (10-sum%10)%10
+}
+
+func registrableDomain(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// pageCountry returns the country of a page's country-code TLD
+func pageCountry(raw string) string {
+	domain := registrableDomain(raw)
+	tld := strings.ToUpper(domain[strings.LastIndex(domain, ".")+1:])
+	switch {
+	case tld == "UK":
+		return "GB"
+	case len(tld) == 2:
+		return tld
+	}
+	return ""
+}
+
+// clamp bounds a score to 0-1, rounded to two decimals
+func clamp(score float64) float64 {
+	switch {
+	case score < 0:
+		return 0
+	case score > 1:
+		return 1
+	}
+	return math.Round(score*100) / 100
+}
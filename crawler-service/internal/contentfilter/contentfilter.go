@@ -0,0 +1,134 @@
+// Package contentfilter decides which pages a crawl keeps by their
+// content: the language they are in, the keywords or patterns they
+// mention and how much content they carry.
+package contentfilter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"definitelynotaspy/crawler-service/internal/extractor"
+	"definitelynotaspy/crawler-service/internal/hreflang"
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// Filters a page can fail, in the order they are checked
+const (
+	FilterLanguage  = "language"
+	FilterRequire   = "require"
+	FilterExclude   = "exclude"
+	FilterMinLength = "min_length"
+)
+
+// Actions taken on pages failing a filter
+const (
+	ActionDrop = "drop"
+	ActionFlag = "flag"
+)
+
+// Filter is a compiled set of content filters
+type Filter struct {
+	languages []string
+	require   []matcher
+	exclude   []matcher
+	minLength int
+}
+
+// matcher reports whether a page's text, given as is and lowercased,
+// matches a pattern
+type matcher func(text, lower string) bool
+
+// New compiles a request's content filters
+func New(f *models.ContentFilters) (*Filter, error) {
+	switch f.Action {
+	case "", ActionDrop, ActionFlag:
+	default:
+		return nil, errors.New("filters.action must be drop or flag")
+	}
+	if f.MinContentLength < 0 {
+		return nil, errors.New("filters.min_content_length must not be negative")
+	}
+	for _, lang := range f.Languages {
+		if strings.TrimSpace(lang) == "" {
+			return nil, errors.New("filters.languages must not be empty")
+		}
+	}
+	require, err := compile("require", f.Require)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compile("exclude", f.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		languages: f.Languages,
+		require:   require,
+		exclude:   exclude,
+		minLength: f.MinContentLength,
+	}, nil
+}
+
+// compile compiles patterns. A pattern between slashes (/breach(ed)?/) is
+// a regular expression searched for in the text; any other is a keyword
+// found anywhere in it, ignoring case.
+func compile(field string, patterns []string) ([]matcher, error) {
+	matchers := make([]matcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("filters.%s patterns must not be empty", field)
+		}
+		if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid filters.%s pattern %q: %w", field, pattern, err)
+			}
+			matchers = append(matchers, func(text, _ string) bool { return re.MatchString(text) })
+			continue
+		}
+		keyword := strings.ToLower(pattern)
+		matchers = append(matchers, func(_, lower string) bool { return strings.Contains(lower, keyword) })
+	}
+	return matchers, nil
+}
+
+// Failed returns the filters a page fails. A page whose language cannot
+// be told passes the language filter.
+func (f *Filter) Failed(result models.CrawlResult) []string {
+	var failed []string
+	if len(f.languages) > 0 {
+		lang := result.Language
+		if lang == "" {
+			lang = extractor.DetectLanguage(result.Content)
+		}
+		if lang != "" && !hreflang.Match(lang, f.languages) {
+			failed = append(failed, FilterLanguage)
+		}
+	}
+
+	text := result.Title + "\n" + result.Content
+	lower := strings.ToLower(text)
+	if len(f.require) > 0 && !matchesAny(f.require, text, lower) {
+		failed = append(failed, FilterRequire)
+	}
+	if matchesAny(f.exclude, text, lower) {
+		failed = append(failed, FilterExclude)
+	}
+
+	if f.minLength > 0 && utf8.RuneCountInString(strings.Join(strings.Fields(result.Content), " ")) < f.minLength {
+		failed = append(failed, FilterMinLength)
+	}
+	return failed
+}
+
+func matchesAny(matchers []matcher, text, lower string) bool {
+	for _, m := range matchers {
+		if m(text, lower) {
+			return true
+		}
+	}
+	return false
+}
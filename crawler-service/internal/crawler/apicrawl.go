@@ -0,0 +1,450 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/compliance"
+	"definitelynotaspy/crawler-service/internal/dedup"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/jsonpath"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/policy"
+	"definitelynotaspy/crawler-service/internal/secrets"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxAPIResponseBytes bounds the JSON read from one API response
+	maxAPIResponseBytes = 10 << 20
+	// apiRequestDelay spaces the requests of an api crawl, like the
+	// collectors' per-domain delay
+	apiRequestDelay = 1 * time.Second
+	// apiRateLimitRetries is how often a page refused with 429 is retried
+	// after its host cooled down
+	apiRateLimitRetries = 3
+)
+
+// apiRules are compiled APIRules
+type apiRules struct {
+	items       *jsonpath.Path
+	fields      map[string]jsonpath.Path
+	next        *jsonpath.Path
+	cursorParam string
+}
+
+// ValidateAPIRules checks the rules of an api mode crawl
+func ValidateAPIRules(rules *models.APIRules) error {
+	if rules == nil {
+		return nil
+	}
+	for _, endpoint := range rules.Endpoints {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("api endpoint %q is not an http(s) URL", endpoint)
+		}
+	}
+	if rules.CursorParam != "" && rules.Next == "" {
+		return errors.New("api cursor_param needs a next path")
+	}
+	_, err := compileAPIRules(rules)
+	return err
+}
+
+func compileAPIRules(rules *models.APIRules) (*apiRules, error) {
+	compiled := &apiRules{fields: make(map[string]jsonpath.Path)}
+	if rules == nil {
+		return compiled, nil
+	}
+	compiled.cursorParam = rules.CursorParam
+
+	if rules.Items != "" {
+		p, err := jsonpath.Compile(rules.Items)
+		if err != nil {
+			return nil, fmt.Errorf("invalid api items: %w", err)
+		}
+		compiled.items = &p
+	}
+	if rules.Next != "" {
+		p, err := jsonpath.Compile(rules.Next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid api next: %w", err)
+		}
+		compiled.next = &p
+	}
+	for name, expr := range rules.Fields {
+		if name == "" {
+			return nil, errors.New("api field names must not be empty")
+		}
+		p, err := jsonpath.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid api field %s: %w", name, err)
+		}
+		compiled.fields[name] = p
+	}
+	return compiled, nil
+}
+
+// apiPage is an API URL waiting to be fetched
+type apiPage struct {
+	url      string
+	from     string
+	depth    int
+	attempts int
+}
+
+// CrawlAPI reads the JSON API endpoints of an api mode job, the query URL
+// first, following each one's next page pointers until max_pages responses
+// have been read. Every record a response holds becomes a result with the
+// fields its rules extract.
+func (cs *CrawlerService) CrawlAPI(job *models.CrawlJob, req models.CrawlRequest) error {
+	cs.mu.Lock()
+	job.Status = "running"
+	cs.mu.Unlock()
+	cs.publishStatus(job, "running")
+
+	run := cs.register(job, req)
+	defer cs.unregister(run)
+
+	maxRuntime := jobMaxRuntime(req.MaxRuntimeSeconds)
+	killTimer := time.AfterFunc(time.Until(job.StartedAt.Add(maxRuntime)), func() {
+		log.WithField("job_id", job.ID).Warn("Job exceeded maximum runtime, stopping")
+		cs.stop(run, stopMaxRuntime)
+	})
+	defer killTimer.Stop()
+
+	rules, err := compileAPIRules(req.API)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+
+	secretCtx, cancelSecrets := context.WithTimeout(context.Background(), 30*time.Second)
+	secretValues, err := cs.secrets.ResolveAll(secretCtx, req.Secrets)
+	cancelSecrets()
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.SecretUnavailable, err))
+	}
+	profile := cs.jobCompliance(job)
+	transport, err := cs.buildTransport(req, profile, secretValues)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: cs.charged(job, transport)}
+	userAgent := resolveUserAgent(req.UserAgent)
+
+	stopWebhooks := cs.startWebhooks(job, req, secretValues)
+	defer stopWebhooks()
+
+	// A continuation resumes from the pages its parent did not reach
+	queue := []apiPage{{url: req.Query}}
+	if req.API != nil {
+		for _, endpoint := range req.API.Endpoints {
+			queue = append(queue, apiPage{url: endpoint})
+		}
+	}
+	if len(req.SeedURLs) > 0 {
+		queue = queue[:0]
+		for _, seed := range req.SeedURLs {
+			queue = append(queue, apiPage{url: seed})
+		}
+	}
+	seen := make(map[string]bool)
+	for _, page := range queue {
+		seen[page.url] = true
+	}
+
+	var results []models.CrawlResult
+	var lastErr error
+	fetched := 0
+	for len(queue) > 0 && fetched < req.MaxPages && run.ctx.Err() == nil {
+		page := queue[0]
+		queue = queue[1:]
+
+		u, err := url.Parse(page.url)
+		if err != nil {
+			cs.countAPIError(job, errcode.Wrap(errcode.InvalidRequest, err))
+			continue
+		}
+		if cs.policies.Denied(u.Hostname()) {
+			cs.countAPIError(job, errcode.Wrap(errcode.PolicyDenied, fmt.Errorf("%s is denied by policy", u.Hostname())))
+			continue
+		}
+		if reason := compliance.Refuses(profile, u); reason != "" {
+			cs.countAPIError(job, errcode.Wrap(errcode.ComplianceDenied, errors.New(reason)))
+			continue
+		}
+		if err := cs.waitCooldown(run, u.Hostname()); err != nil {
+			break
+		}
+		if fetched > 0 {
+			select {
+			case <-time.After(apiRequestDelay):
+			case <-run.ctx.Done():
+			}
+			if run.ctx.Err() != nil {
+				break
+			}
+		}
+
+		httpReq, err := http.NewRequestWithContext(run.ctx, http.MethodGet, page.url, nil)
+		if err != nil {
+			cs.countAPIError(job, errcode.Wrap(errcode.InvalidRequest, err))
+			continue
+		}
+		httpReq.Header.Set("User-Agent", userAgent)
+		httpReq.Header.Set("Accept", "application/json")
+		for name, value := range req.Headers {
+			httpReq.Header.Set(name, secrets.Interpolate(value, secretValues))
+		}
+		applyDomainHeaders(req, secretValues, u.Hostname(), &httpReq.Header)
+		if hostProfile := cs.policies.Current().Profile(u.Hostname()); hostProfile != nil {
+			hostProfile.Apply(&httpReq.Header)
+		}
+
+		status, doc, err := cs.fetchJSON(client, httpReq)
+		cs.touch(run)
+		if status == http.StatusTooManyRequests && page.attempts < apiRateLimitRetries {
+			page.attempts++
+			queue = append([]apiPage{page}, queue...)
+			continue
+		}
+		fetched++
+		if err != nil {
+			lastErr = err
+			cs.countAPIError(job, err)
+			log.WithError(err).WithFields(log.Fields{
+				"job_id": job.ID,
+				"url":    page.url,
+			}).Warn("API request failed")
+			cs.publishFailed(job, page.url, status, errcode.Classify(err, status), err)
+			continue
+		}
+
+		for i, record := range rules.records(doc) {
+			result := rules.result(record, page, i, status)
+			result.Provenance = cs.provenance(job, models.RenderAPI)
+			results = append(results, result)
+			cs.publishPage(job, result)
+		}
+
+		if next := rules.nextURL(doc, u); next != "" && !seen[next] {
+			seen[next] = true
+			queue = append(queue, apiPage{url: next, from: page.url, depth: page.depth + 1})
+		}
+
+		cs.mu.Lock()
+		job.PagesCrawled = fetched
+		job.URLsFound = len(seen)
+		cs.mu.Unlock()
+	}
+
+	cs.mu.Lock()
+	for _, page := range queue {
+		job.Frontier = append(job.Frontier, page.url)
+	}
+	cs.mu.Unlock()
+
+	if len(results) == 0 && lastErr != nil && run.ctx.Err() == nil {
+		return cs.failJob(job, nil, fmt.Errorf("no API response could be read: %w", lastErr))
+	}
+
+	switch cs.stopReasonOf(run) {
+	case stopDeleted:
+		log.WithField("job_id", job.ID).Info("Deleted job stopped")
+		return nil
+	case stopCheckpoint:
+		return cs.cancelJob(job, results, errcode.Maintenance, fmt.Errorf("job checkpointed for maintenance; continue it to resume from its frontier"))
+	case stopCancelled:
+		return cs.cancelJob(job, results, errcode.Cancelled, fmt.Errorf("job cancelled by request"))
+	case stopStalled, stopRestart:
+		return cs.cancelJob(job, results, errcode.Stalled, fmt.Errorf("job stalled: no API response within the watchdog period"))
+	case stopMaxRuntime:
+		cs.mu.Lock()
+		job.Partial = true
+		job.ErrorCode = errcode.MaxRuntimeExceeded
+		job.Error = fmt.Sprintf("maximum runtime of %s exceeded", maxRuntime)
+		cs.mu.Unlock()
+	}
+
+	cs.mu.Lock()
+	job.Status = "completed"
+	numberResults(job, results)
+	job.Results = results
+	job.CompletedAt = time.Now().UTC()
+	cs.mu.Unlock()
+	cs.publishFinished(job)
+
+	go func() {
+		cs.deliverResults(job, job.Results)
+		cs.offloadResults(job)
+	}()
+
+	log.WithFields(log.Fields{
+		"job_id":        job.ID,
+		"pages_crawled": fetched,
+		"records":       len(results),
+	}).Info("API crawl completed")
+
+	return nil
+}
+
+// countAPIError records a failed API request on the job
+func (cs *CrawlerService) countAPIError(job *models.CrawlJob, err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if job.ErrorCounts == nil {
+		job.ErrorCounts = make(map[string]int)
+	}
+	job.ErrorCounts[errcode.Classify(err, 0)]++
+}
+
+// fetchJSON sends an API request and decodes its JSON response. A host
+// answering 429 is cooled down for every job.
+func (cs *CrawlerService) fetchJSON(client *http.Client, req *http.Request) (int, interface{}, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		cs.policies.CoolDown(req.URL.Hostname(), policy.RetryAfter(resp.Header))
+	}
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, nil, errcode.Wrap(errcode.Classify(nil, resp.StatusCode), fmt.Errorf("API returned %d", resp.StatusCode))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAPIResponseBytes))
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("response is not JSON: %w", err)
+	}
+	return resp.StatusCode, doc, nil
+}
+
+// records returns the records of a response
+func (r *apiRules) records(doc interface{}) []interface{} {
+	if r.items == nil {
+		return []interface{}{doc}
+	}
+	var records []interface{}
+	for _, v := range r.items.Eval(doc) {
+		if arr, ok := v.([]interface{}); ok {
+			records = append(records, arr...)
+		} else {
+			records = append(records, v)
+		}
+	}
+	return records
+}
+
+// result builds the result of the index-th record of a page
+func (r *apiRules) result(record interface{}, page apiPage, index int, status int) models.CrawlResult {
+	result := models.CrawlResult{
+		URL:            page.url + "#" + strconv.Itoa(index),
+		CrawledAt:      time.Now().UTC(),
+		StatusCode:     status,
+		Depth:          page.depth,
+		DiscoveredFrom: page.from,
+		Source:         models.SourceAPI,
+	}
+	if r.items == nil {
+		result.URL = page.url
+	}
+
+	for name, path := range r.fields {
+		value, ok := flatten(path.Eval(record))
+		if !ok {
+			continue
+		}
+		switch name {
+		case "url":
+			result.URL = resolveRef(page.url, value)
+		case "title":
+			result.Title = value
+		case "content":
+			result.Content = value
+		default:
+			if result.Fields == nil {
+				result.Fields = make(map[string]string)
+			}
+			result.Fields[name] = value
+		}
+	}
+
+	if result.Content == "" {
+		if data, err := json.Marshal(record); err == nil {
+			result.Content = string(data)
+		}
+	}
+	result.ContentHash = dedup.HashContent(result.Content)
+	return result
+}
+
+// nextURL returns the URL of the page after the one at current, or ""
+func (r *apiRules) nextURL(doc interface{}, current *url.URL) string {
+	if r.next == nil {
+		return ""
+	}
+	pointer, ok := flatten(r.next.Eval(doc))
+	if !ok || pointer == "" || pointer == "null" {
+		return ""
+	}
+	if r.cursorParam != "" {
+		next := *current
+		q := next.Query()
+		q.Set(r.cursorParam, pointer)
+		next.RawQuery = q.Encode()
+		return next.String()
+	}
+	return resolveRef(current.String(), pointer)
+}
+
+// flatten turns the values a path selected into one field value: strings
+// and numbers as written, anything else, or several values, as JSON
+func flatten(values []interface{}) (string, bool) {
+	switch len(values) {
+	case 0:
+		return "", false
+	case 1:
+		switch v := values[0].(type) {
+		case nil:
+			return "", false
+		case string:
+			return v, true
+		case json.Number:
+			return v.String(), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+		data, err := json.Marshal(values[0])
+		return string(data), err == nil
+	}
+	data, err := json.Marshal(values)
+	return string(data), err == nil
+}
+
+// resolveRef resolves a possibly relative reference against base
+func resolveRef(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	u, err := b.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// callbackTimeout bounds one callback attempt
+const callbackTimeout = 10 * time.Second
+
+// CallbackPayload is the body POSTed to a job's callback URL once it has
+// finished
+type CallbackPayload struct {
+	Event        string    `json:"event"`
+	JobID        string    `json:"job_id"`
+	ExternalID   string    `json:"external_id,omitempty"`
+	CaseID       string    `json:"case_id,omitempty"`
+	Tenant       string    `json:"tenant"`
+	Type         string    `json:"type,omitempty"`
+	Status       string    `json:"status"`
+	Partial      bool      `json:"partial,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ErrorCode    string    `json:"error_code,omitempty"`
+	PagesCrawled int       `json:"pages_crawled"`
+	Results      int       `json:"results"`
+	LastSeq      int64     `json:"last_seq,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	CompletedAt  time.Time `json:"completed_at"`
+	// ResultsURL is where the job's results are fetched from, absolute
+	// when PUBLIC_BASE_URL is set
+	ResultsURL string    `json:"results_url"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// notifyCallback POSTs a finished job's summary to its callback URL in the
+// background. The body is signed with CALLBACK_SECRET when it is set.
+func (cs *CrawlerService) notifyCallback(job *models.CrawlJob) {
+	cs.mu.Lock()
+	if job.Callback == nil {
+		cs.mu.Unlock()
+		return
+	}
+	target := job.Callback.URL
+	payload := CallbackPayload{
+		Event:        events.JobFinished,
+		JobID:        job.ID,
+		ExternalID:   job.ExternalID,
+		CaseID:       job.CaseID,
+		Tenant:       job.Tenant,
+		Type:         job.Type,
+		Status:       job.Status,
+		Partial:      job.Partial,
+		Error:        job.Error,
+		ErrorCode:    job.ErrorCode,
+		PagesCrawled: job.PagesCrawled,
+		Results:      len(job.Results),
+		LastSeq:      job.ResultSeq,
+		StartedAt:    job.StartedAt,
+		CompletedAt:  job.CompletedAt,
+		ResultsURL:   strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/") + "/api/v1/jobs/" + job.ID + "/results",
+	}
+	cs.mu.Unlock()
+
+	go cs.deliverCallback(job, target, payload)
+}
+
+// deliverCallback makes up to outputAttempts attempts at a callback,
+// backing off exponentially, and records each on the job
+func (cs *CrawlerService) deliverCallback(job *models.CrawlJob, target string, payload CallbackPayload) {
+	secret := os.Getenv("CALLBACK_SECRET")
+	backoff := outputBackoff
+	for attempt := 1; ; attempt++ {
+		payload.SentAt = time.Now().UTC()
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+		err = cs.postOutput(ctx, target, "application/json", body, secret)
+		cancel()
+		switch {
+		case err == nil:
+			cs.recordCallback(job, models.OutputDelivered, nil)
+			return
+		case attempt == outputAttempts:
+			cs.recordCallback(job, models.OutputFailed, err)
+			log.WithError(err).WithFields(log.Fields{
+				"job_id":   job.ID,
+				"attempts": attempt,
+			}).Error("Failed to deliver job callback")
+			return
+		}
+		cs.recordCallback(job, models.OutputRetrying, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// recordCallback updates the delivery state of a job's callback after an
+// attempt, and persists it; err is nil when the attempt succeeded
+func (cs *CrawlerService) recordCallback(job *models.CrawlJob, status string, err error) {
+	cs.mu.Lock()
+	d := job.Callback
+	d.Status = status
+	d.Attempts++
+	if err != nil {
+		d.Error = err.Error()
+	} else {
+		d.Error = ""
+		now := time.Now().UTC()
+		d.DeliveredAt = &now
+	}
+	cs.mu.Unlock()
+
+	if cs.saveJob != nil {
+		cs.saveJob(job)
+	}
+}
@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkpointPrefix keys saved runs in Redis
+const checkpointPrefix = "checkpoint:"
+
+// checkpointTTL is how long a saved run is kept for resuming
+const checkpointTTL = 7 * 24 * time.Hour
+
+// SavedRun is the progress of a crawl, saved while it runs so a crawl the
+// process did not live to stop can be resumed from it
+type SavedRun struct {
+	// Frontier holds the URLs queued or discovered but not yet requested
+	Frontier []string `json:"frontier"`
+	// Visited holds the URLs already requested
+	Visited      []string             `json:"visited"`
+	Results      []models.CrawlResult `json:"results"`
+	PagesCrawled int                  `json:"pages_crawled"`
+	Cookies      []models.JobCookie   `json:"cookies,omitempty"`
+	SavedAt      time.Time            `json:"saved_at"`
+}
+
+// checkpoints keeps saved runs in Redis, so they outlive the process, or in
+// memory without it
+type checkpoints struct {
+	mu    sync.Mutex
+	local map[string][]byte
+}
+
+func newCheckpoints() *checkpoints {
+	return &checkpoints{local: make(map[string][]byte)}
+}
+
+// checkpointInterval returns how often running crawls save their progress:
+// CHECKPOINT_INTERVAL, default 30s; 0 turns saving off
+func checkpointInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CHECKPOINT_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+func (s *checkpoints) save(jobID string, run SavedRun) {
+	data, err := json.Marshal(run)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Warn("Failed to encode crawl checkpoint")
+		return
+	}
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if err := rdb.Set(context.Background(), checkpointPrefix+jobID, data, checkpointTTL).Err(); err == nil {
+			return
+		}
+		log.WithError(err).WithField("job_id", jobID).Warn("Failed to save crawl checkpoint to Redis, keeping it locally")
+	}
+
+	s.mu.Lock()
+	s.local[jobID] = data
+	s.mu.Unlock()
+}
+
+func (s *checkpoints) load(jobID string) (*SavedRun, bool) {
+	var data []byte
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, _ = rdb.Get(context.Background(), checkpointPrefix+jobID).Bytes()
+	}
+	if data == nil {
+		s.mu.Lock()
+		data = s.local[jobID]
+		s.mu.Unlock()
+	}
+	if data == nil {
+		return nil, false
+	}
+
+	var run SavedRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		log.WithError(err).WithField("job_id", jobID).Warn("Discarding unreadable crawl checkpoint")
+		return nil, false
+	}
+	return &run, true
+}
+
+func (s *checkpoints) drop(jobID string) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		rdb.Del(context.Background(), checkpointPrefix+jobID)
+	}
+	s.mu.Lock()
+	delete(s.local, jobID)
+	s.mu.Unlock()
+}
+
+// saveProgress saves the snapshot of a run every checkpointInterval until
+// the returned function is called. That function drops the saved run: a
+// run that ends, however it ends, records its own frontier and results.
+func (cs *CrawlerService) saveProgress(run *activeJob, snapshot func() SavedRun) func() {
+	interval := checkpointInterval()
+	if interval == 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-run.ctx.Done():
+				return
+			case <-ticker.C:
+				saved := snapshot()
+				saved.SavedAt = time.Now().UTC()
+				cs.checkpoints.save(run.job.ID, saved)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		cs.checkpoints.drop(run.job.ID)
+	}
+}
+
+// SavedRun returns the progress last saved by a crawl that did not finish
+func (cs *CrawlerService) SavedRun(jobID string) (*SavedRun, bool) {
+	return cs.checkpoints.load(jobID)
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/codesearch"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/pipeline"
+	"errors"
+	"fmt"
+	"html"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SearchCode queries the selected code hosts for the job's query and runs
+// each matching file through the result pipeline
+func (cs *CrawlerService) SearchCode(job *models.CrawlJob, req models.CrawlRequest) error {
+	cs.mu.Lock()
+	job.Status = "running"
+	cs.mu.Unlock()
+
+	providers, err := cs.codeSearch.Select(req.CodeSearchProviders)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+	processors, err := cs.pipeline.Select(req.Processors)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobMaxRuntime(req.MaxRuntimeSeconds))
+	defer cancel()
+
+	var results []models.CrawlResult
+	var searchErr error
+	for _, p := range providers {
+		cs.chargeAPICall(job, APICodeSearch)
+		hits, err := p.Search(ctx, req.Query, req.MaxPages-len(results))
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id":   job.ID,
+				"provider": p.Name(),
+			}).Warn("Code search failed")
+			searchErr = err
+		}
+
+		for _, hit := range hits {
+			result, err := cs.codeResult(ctx, job, &req, processors, p, hit)
+			if errors.Is(err, pipeline.ErrDrop) {
+				continue
+			}
+			if err != nil {
+				cs.mu.Lock()
+				if job.ErrorCounts == nil {
+					job.ErrorCounts = make(map[string]int)
+				}
+				job.ErrorCounts[errcode.Classify(err, 0)]++
+				cs.mu.Unlock()
+				continue
+			}
+
+			results = append(results, *result)
+			cs.mu.Lock()
+			job.PagesCrawled = len(results)
+			cs.mu.Unlock()
+		}
+
+		if len(results) >= req.MaxPages {
+			break
+		}
+	}
+
+	if len(results) == 0 && searchErr != nil {
+		return cs.failJob(job, nil, fmt.Errorf("code search failed: %w", searchErr))
+	}
+
+	cs.mu.Lock()
+	job.Status = "completed"
+	numberResults(job, results)
+	job.Results = results
+	job.CompletedAt = time.Now().UTC()
+	cs.mu.Unlock()
+	cs.publishFinished(job)
+
+	go func() {
+		cs.deliverResults(job, job.Results)
+		cs.offloadResults(job)
+	}()
+
+	log.WithFields(log.Fields{
+		"job_id": job.ID,
+		"files":  len(results),
+	}).Info("Code search completed")
+
+	return nil
+}
+
+// codeResult fetches one matching file and runs it through the pipeline
+func (cs *CrawlerService) codeResult(ctx context.Context, job *models.CrawlJob, req *models.CrawlRequest, processors []pipeline.ResultProcessor, p codesearch.Provider, hit codesearch.Hit) (*models.CrawlResult, error) {
+	content, err := p.Fetch(ctx, hit)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := fmt.Sprintf("<html><head><title>%s</title></head><body><pre>%s</pre></body></html>",
+		html.EscapeString(hit.Repo+"/"+hit.Path), html.EscapeString(string(content)))
+	e, err := htmlElement(hit.URL, []byte(doc), 200, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var result models.CrawlResult
+	if err := pipeline.Run(processors, &pipeline.Context{Job: job, Request: req, Element: e}, &result); err != nil {
+		return nil, err
+	}
+
+	result.Source = models.SourceCode
+	result.Provenance = cs.provenance(job, models.RenderAPI)
+	if result.Fields == nil {
+		result.Fields = make(map[string]string)
+	}
+	result.Fields["code_provider"] = hit.Provider
+	result.Fields["repo"] = hit.Repo
+	result.Fields["path"] = hit.Path
+	if hit.Ref != "" {
+		result.Fields["ref"] = hit.Ref
+	}
+	return &result, nil
+}
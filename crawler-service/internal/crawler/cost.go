@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// External services whose calls are charged to a job
+const (
+	APISearch       = "search"
+	APICodeSearch   = "code_search"
+	APICertificates = "ct_log"
+	APITimestamp    = "tsa"
+	APIEnrichment   = "enrichment"
+	APIBreaches     = "hibp"
+	APIReverseImage = "reverse_image"
+)
+
+// costTransport charges the requests made through it, and the response
+// bytes read, to a job. Bytes of URLs the environment routes through a
+// proxy, and of jobs routed to a region, also count as proxy bandwidth.
+type costTransport struct {
+	cs   *CrawlerService
+	job  *models.CrawlJob
+	next http.RoundTripper
+}
+
+// charged wraps a job's transport to account for its consumption
+func (cs *CrawlerService) charged(job *models.CrawlJob, next http.RoundTripper) http.RoundTripper {
+	return costTransport{cs: cs, job: job, next: next}
+}
+
+func (t costTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.cs.mu.Lock()
+	t.job.Cost.Requests++
+	t.cs.mu.Unlock()
+
+	resp, err := t.next.RoundTrip(r)
+	if resp != nil && resp.Body != nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, charge: func(n int64) {
+			t.cs.chargeBytes(t.job, r.URL, n)
+		}}
+	}
+	return resp, err
+}
+
+// countingBody counts the bytes read from a response body and charges them
+// when it is closed
+type countingBody struct {
+	io.ReadCloser
+	n      int64
+	charge func(int64)
+	once   sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.once.Do(func() { b.charge(b.n) })
+	return b.ReadCloser.Close()
+}
+
+// chargeBytes charges response bytes to a job
+func (cs *CrawlerService) chargeBytes(job *models.CrawlJob, u *url.URL, n int64) {
+	proxied := job.Region != "" || proxyFor(u) != ""
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	job.Cost.Bytes += n
+	if proxied {
+		job.Cost.ProxyBytes += n
+	}
+}
+
+// chargeAPICall charges one call of an external service to the job
+func (cs *CrawlerService) chargeAPICall(job *models.CrawlJob, service string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if job.Cost.APICalls == nil {
+		job.Cost.APICalls = make(map[string]int)
+	}
+	job.Cost.APICalls[service]++
+}
+
+// JobCost returns the resources a job has consumed so far
+func (cs *CrawlerService) JobCost(job *models.CrawlJob) models.JobCost {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cost := job.Cost
+	cost.Pages = job.PagesCrawled
+	if len(job.Cost.APICalls) > 0 {
+		cost.APICalls = make(map[string]int, len(job.Cost.APICalls))
+		for service, n := range job.Cost.APICalls {
+			cost.APICalls[service] = n
+		}
+	}
+	return cost
+}
@@ -0,0 +1,237 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Reasons a discovered URL was not visited
+const (
+	gapBudget    = "budget"
+	gapDepth     = "depth"
+	gapRobots    = "robots"
+	gapFilter    = "filter"
+	gapDuplicate = "duplicate"
+	gapVariant   = "variant"
+	gapLanguage  = "language"
+	gapQuota     = "quota"
+	gapStopped   = "stopped"
+	// gapDenied marks URLs on hosts denied by operator policy or opted out
+	gapDenied = "denied"
+	// gapCompliance marks URLs the job's compliance profile forbids
+	gapCompliance = "compliance"
+	// gapCategory marks URLs on hosts of a category the job excludes
+	gapCategory = "category"
+	// gapRateLimited marks URLs requested but refused with 429 Too Many
+	// Requests
+	gapRateLimited = "rate_limited"
+	// gapWindow marks URLs refused because their host's crawl window
+	// closed
+	gapWindow = "window"
+	// gapDocument marks documents the job does not include, or that were
+	// too large or unreadable
+	gapDocument = "document"
+)
+
+// resumable are the reasons a continuation job revisits: the URLs were
+// wanted but the crawl ran out of budget, depth, storage, time or the
+// server's patience
+var resumable = map[string]bool{
+	gapBudget:      true,
+	gapDepth:       true,
+	gapQuota:       true,
+	gapStopped:     true,
+	gapRateLimited: true,
+	gapWindow:      true,
+}
+
+// maxFrontier caps the unvisited URLs kept on a job for continuation
+const maxFrontier = 10000
+
+// maxGapSamples is how many skipped URLs a coverage report lists per domain
+// and reason; the counts cover all of them
+const maxGapSamples = 25
+
+// coverage tracks the URLs a crawl discovered but did not visit
+type coverage struct {
+	mu        sync.Mutex
+	skipped   map[string]string
+	attempted map[string]bool
+}
+
+func newCoverage() *coverage {
+	return &coverage{
+		skipped:   make(map[string]string),
+		attempted: make(map[string]bool),
+	}
+}
+
+// skip records why a URL was not visited; the first reason recorded stands
+func (c *coverage) skip(link, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.skipped[link]; !ok {
+		c.skipped[link] = reason
+	}
+}
+
+// visitFailed records a URL colly refused to visit, ignoring URLs it had
+// already visited
+func (c *coverage) visitFailed(link string, err error) {
+	switch {
+	case errors.Is(err, colly.ErrAlreadyVisited):
+	case errors.Is(err, colly.ErrMaxDepth):
+		c.skip(link, gapDepth)
+	case errors.Is(err, colly.ErrRobotsTxtBlocked):
+		c.skip(link, gapRobots)
+	case errors.Is(err, colly.ErrForbiddenDomain), errors.Is(err, colly.ErrForbiddenURL), errors.Is(err, colly.ErrNoURLFiltersMatch):
+		c.skip(link, gapFilter)
+	}
+}
+
+// attempt records a URL the crawl requested
+func (c *coverage) attempt(link string) {
+	c.mu.Lock()
+	c.attempted[link] = true
+	c.mu.Unlock()
+}
+
+// rateLimited records a requested URL the server refused to serve for now;
+// it counts as not visited
+func (c *coverage) rateLimited(link string) {
+	c.mu.Lock()
+	delete(c.attempted, link)
+	c.skipped[link] = gapRateLimited
+	c.mu.Unlock()
+}
+
+// unvisited records a requested URL that was never fetched or whose page
+// was dropped, because the run was stopped or policy denied the host
+func (c *coverage) unvisited(link, reason string) {
+	c.mu.Lock()
+	delete(c.attempted, link)
+	c.skipped[link] = reason
+	c.mu.Unlock()
+}
+
+// frontier returns the URLs never requested for a reason a continuation of
+// the crawl can make up for, sorted and capped at maxFrontier
+func (c *coverage) frontier() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var links []string
+	for link, reason := range c.skipped {
+		if resumable[reason] && !c.attempted[link] {
+			links = append(links, link)
+		}
+	}
+	sort.Strings(links)
+	if len(links) > maxFrontier {
+		links = links[:maxFrontier]
+	}
+	return links
+}
+
+// requested returns the URLs the crawl requested
+func (c *coverage) requested() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	links := make([]string, 0, len(c.attempted))
+	for link := range c.attempted {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+	return links
+}
+
+// unrequested returns the frontier together with the queued URLs not yet
+// requested, leaving out those a previous run visited, for resuming a run
+// that has not ended. It is capped at maxFrontier.
+func (c *coverage) unrequested(queued, visited []string) []string {
+	links := c.frontier()
+	skip := make(map[string]bool, len(links)+len(visited))
+	for _, link := range append(links, visited...) {
+		skip[link] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, link := range queued {
+		if !skip[link] && !c.attempted[link] {
+			skip[link] = true
+			links = append(links, link)
+		}
+	}
+	if len(links) > maxFrontier {
+		links = links[:maxFrontier]
+	}
+	return links
+}
+
+// report groups the URLs that were never requested by domain. A URL
+// skipped once, say for depth, but requested later from a shallower page
+// is not a gap.
+func (c *coverage) report() map[string]models.DomainCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	domains := make(map[string]*models.DomainCoverage)
+	domain := func(link string) *models.DomainCoverage {
+		host := link
+		if u, err := url.Parse(link); err == nil && u.Hostname() != "" {
+			host = strings.ToLower(u.Hostname())
+		}
+		d, ok := domains[host]
+		if !ok {
+			d = &models.DomainCoverage{Skipped: make(map[string]int)}
+			domains[host] = d
+		}
+		return d
+	}
+
+	for link := range c.attempted {
+		domain(link).Visited++
+	}
+
+	links := make([]string, 0, len(c.skipped))
+	for link := range c.skipped {
+		if !c.attempted[link] {
+			links = append(links, link)
+		}
+	}
+	sort.Strings(links)
+	for _, link := range links {
+		reason := c.skipped[link]
+		d := domain(link)
+		d.Skipped[reason]++
+		if d.Samples == nil {
+			d.Samples = make(map[string][]string)
+		}
+		if len(d.Samples[reason]) < maxGapSamples {
+			d.Samples[reason] = append(d.Samples[reason], link)
+		}
+	}
+
+	report := make(map[string]models.DomainCoverage, len(domains))
+	for host, d := range domains {
+		report[host] = *d
+	}
+	return report
+}
+
+// robotsBlocked counts the URLs of a coverage report robots.txt disallowed
+func robotsBlocked(report map[string]models.DomainCoverage) int {
+	total := 0
+	for _, d := range report {
+		total += d.Skipped[gapRobots]
+	}
+	return total
+}
@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/fixture"
+	"definitelynotaspy/crawler-service/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestStartCrawlFixtureSite crawls the fixture site, served under several
+// hosts so requests are in flight at once, with a page budget smaller than
+// the site, so links are followed while pages are taken; run it with -race
+func TestStartCrawlFixtureSite(t *testing.T) {
+	t.Setenv("GODS_EYE_FIXTURE", "1")
+	t.Setenv("POLICY_DIR", t.TempDir())
+	cs := NewCrawlerService()
+
+	seed := "https://" + fixture.Host + "/"
+	seeds := []string{seed, "https://www." + fixture.Host + "/", "https://docs." + fixture.Host + "/"}
+	job := &models.CrawlJob{
+		ID:        uuid.New().String(),
+		Type:      models.JobTypeCrawl,
+		Query:     seed,
+		Status:    "running",
+		MaxPages:  6,
+		MaxDepth:  2,
+		StartedAt: time.Now().UTC(),
+	}
+	req := models.CrawlRequest{
+		Type:              models.JobTypeCrawl,
+		Query:             seed,
+		SeedURLs:          seeds,
+		MaxPages:          6,
+		MaxDepth:          2,
+		MaxParallelism:    4,
+		MaxRuntimeSeconds: 60,
+	}
+	if err := cs.StartCrawl(job, req); err != nil {
+		t.Fatalf("crawl failed: %v", err)
+	}
+
+	if job.Status != "completed" {
+		t.Fatalf("status = %s (%s), want completed", job.Status, job.Error)
+	}
+	if job.PagesCrawled != 6 || len(job.Results) != 6 {
+		t.Errorf("crawled %d pages with %d results, want 6 of each", job.PagesCrawled, len(job.Results))
+	}
+	skipped := 0
+	for _, domain := range job.Coverage {
+		skipped += domain.Skipped[gapBudget]
+	}
+	if skipped == 0 {
+		t.Errorf("coverage = %+v, want links skipped for the page budget", job.Coverage)
+	}
+}
@@ -1,27 +1,493 @@
 package crawler
 
 import (
-	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/archive"
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/blobstore"
+	"definitelynotaspy/crawler-service/internal/browserprofile"
+	"definitelynotaspy/crawler-service/internal/budget"
+	"definitelynotaspy/crawler-service/internal/cluster"
+	"definitelynotaspy/crawler-service/internal/codesearch"
+	"definitelynotaspy/crawler-service/internal/compliance"
+	"definitelynotaspy/crawler-service/internal/confidence"
+	"definitelynotaspy/crawler-service/internal/ctlog"
+	"definitelynotaspy/crawler-service/internal/custody"
+	"definitelynotaspy/crawler-service/internal/dedup"
+	"definitelynotaspy/crawler-service/internal/document"
+	"definitelynotaspy/crawler-service/internal/enrich"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/extractor"
+	"definitelynotaspy/crawler-service/internal/fieldmask"
+	"definitelynotaspy/crawler-service/internal/fixture"
+	"definitelynotaspy/crawler-service/internal/geoip"
+	"definitelynotaspy/crawler-service/internal/graph"
+	"definitelynotaspy/crawler-service/internal/hibp"
+	"definitelynotaspy/crawler-service/internal/hostjar"
+	"definitelynotaspy/crawler-service/internal/hreflang"
+	"definitelynotaspy/crawler-service/internal/httpauth"
+	"definitelynotaspy/crawler-service/internal/keyring"
+	"definitelynotaspy/crawler-service/internal/mailcheck"
+	"definitelynotaspy/crawler-service/internal/markdown"
 	"definitelynotaspy/crawler-service/internal/models"
-	"encoding/json"
+	"definitelynotaspy/crawler-service/internal/paste"
+	"definitelynotaspy/crawler-service/internal/pipeline"
+	"definitelynotaspy/crawler-service/internal/policy"
+	"definitelynotaspy/crawler-service/internal/priority"
+	"definitelynotaspy/crawler-service/internal/protocols"
+	"definitelynotaspy/crawler-service/internal/proxy"
+	"definitelynotaspy/crawler-service/internal/quota"
+	"definitelynotaspy/crawler-service/internal/region"
+	"definitelynotaspy/crawler-service/internal/render"
+	"definitelynotaspy/crawler-service/internal/reverseimage"
+	"definitelynotaspy/crawler-service/internal/revisit"
+	"definitelynotaspy/crawler-service/internal/scripts"
+	"definitelynotaspy/crawler-service/internal/search"
+	"definitelynotaspy/crawler-service/internal/secrets"
+	"definitelynotaspy/crawler-service/internal/store"
+	"definitelynotaspy/crawler-service/internal/textenc"
+	"definitelynotaspy/crawler-service/internal/tsa"
+	"definitelynotaspy/crawler-service/internal/urlkey"
+	"definitelynotaspy/crawler-service/internal/variants"
+	"definitelynotaspy/crawler-service/internal/views"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly/v2"
-	"github.com/gocolly/colly/v2/extensions"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
 type CrawlerService struct {
-	mu sync.Mutex
+	mu           sync.Mutex
+	contentIndex *dedup.ContentIndex
+	revisits     *revisit.Store
+	quota        *quota.Tracker
+	s3           *blobstore.S3Client
+	archive      *archive.Archive
+	pipeline     *pipeline.Registry
+	scripts      *scripts.Store
+	fieldMasks   *fieldmask.Store
+	views        *views.Store
+	secrets      *secrets.Resolver
+	events       *events.Bus
+	active       map[string]*activeJob
+	checkpoints  *checkpoints
+	intel        *intelOutbox
+	pastes       *paste.Monitor
+	pasteWatches map[string]*pasteWatch
+	codeSearch   *codesearch.Registry
+	search       *search.Registry
+	budgets      *budget.Store
+	ctlog        *ctlog.Client
+	enricher     *enrich.Enricher
+	hibp         *hibp.Client
+	mailcheck    *mailcheck.Checker
+	tsa          *tsa.Client
+	signer       *custody.Signer
+	keys         *keyring.Keyring
+	reverseImage reverseimage.Provider
+	geo          *geoip.Locator
+	policies     *policy.Store
+	// delivery posts outputs, job webhooks and callbacks under the
+	// policies
+	delivery   *http.Client
+	compliance *compliance.Registry
+	regions    *region.Registry
+	proxies    *proxy.Pool
+	renderer   *render.Renderer
+	cluster    *cluster.Cluster
+	browsers   *browserprofile.Registry
+	confidence *confidence.Scorer
+	scorer     priority.URLScorer
+	documents  document.Converter
+	neo4j      *graph.Neo4jWriter
+	audit      *audit.Log
+	results    store.ResultStore
+	saveJob    func(*models.CrawlJob)
 }
 
+// Reasons a running crawl was stopped early
+const (
+	stopStalled    = "stalled"
+	stopRestart    = "restart"
+	stopMaxRuntime = "max_runtime"
+	stopDeleted    = "deleted"
+	stopCheckpoint = "checkpoint"
+	stopCancelled  = "cancelled"
+	stopPreempted  = "preempted"
+)
+
+// slowDomainDelay is the delay between requests to a domain that rate
+// limited the crawl being continued
+const slowDomainDelay = 5 * time.Second
+
+// encodingKey holds the original character encoding of a response in its
+// colly context
+const encodingKey = "encoding"
+
+// requestedURLKey holds the URL a request was made for in its colly context
+const requestedURLKey = "requested_url"
+
+// Headers carrying the replay protection of signed intel service pushes.
+// Each attempt has a timestamp and nonce of its own; the delivery ID is
+// the batch's, the same on every attempt, so the intel service processes a
+// batch once however often it is retried.
+const (
+	intelTimestampHeader = "X-GodsEye-Timestamp"
+	intelNonceHeader     = "X-GodsEye-Nonce"
+	intelDeliveryHeader  = "X-GodsEye-Delivery"
+)
+
 func NewCrawlerService() *CrawlerService {
-	return &CrawlerService{}
+	s3, err := blobstore.NewS3ClientFromEnv()
+	if err != nil {
+		log.WithError(err).Warn("Object storage disabled")
+	}
+
+	reverseImage, err := reverseimage.NewProviderFromEnv()
+	if err != nil {
+		log.WithError(err).Warn("Reverse image search disabled")
+	}
+
+	neo4j, err := graph.NewNeo4jWriterFromEnv()
+	if err != nil {
+		log.WithError(err).Warn("Neo4j export disabled")
+	}
+
+	profiles, err := compliance.NewRegistryFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid compliance profile configuration, defaulting to strict")
+	}
+
+	regions, err := region.NewRegistryFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid region configuration, crawling from the local egress only")
+	}
+
+	proxies, err := proxy.NewPoolFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid proxy pool configuration, crawling without proxies")
+	}
+
+	policies := policy.NewStoreFromEnv()
+
+	renderer, err := render.NewFromEnv(browserDial(policies))
+	if err != nil {
+		log.WithError(err).Error("Invalid rendering configuration, JS rendering disabled")
+	}
+
+	nodes, err := cluster.NewFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid cluster configuration, crawling on this instance only")
+	}
+
+	browsers, err := browserprofile.NewRegistryFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid browser profile configuration, using built-in profiles")
+	}
+
+	scorer, err := confidence.NewScorerFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid confidence weights, using the defaults")
+	}
+
+	urlScorer, err := priority.NewFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid URL scorer configuration, using the heuristic")
+	}
+
+	converter, err := document.NewFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid document converter configuration, using the built-in converter")
+	}
+
+	keys, err := keyring.NewFromEnv()
+	if err != nil {
+		log.WithError(err).Error("Invalid encryption master keys, archived HTML will not be encrypted")
+	}
+
+	archived, err := archive.NewFromEnv(keys, s3)
+	if err != nil {
+		log.WithError(err).Error("Invalid archive configuration, archiving to local disk")
+	}
+
+	signer, err := custody.NewSignerFromEnv()
+	if err != nil {
+		log.WithError(err).Warn("Evidence export signing disabled")
+	}
+
+	cs := &CrawlerService{
+		contentIndex: dedup.NewContentIndex(),
+		revisits:     revisit.NewStore(),
+		quota:        quota.NewTrackerFromEnv(),
+		s3:           s3,
+		archive:      archived,
+		keys:         keys,
+		pipeline:     pipeline.NewRegistry(),
+		scripts:      scripts.NewStore(),
+		fieldMasks:   fieldmask.NewStore(),
+		views:        views.NewStore(),
+		secrets:      secrets.NewResolverFromEnv(),
+		events:       events.NewBus(),
+		active:       make(map[string]*activeJob),
+		checkpoints:  newCheckpoints(),
+		intel:        newIntelOutbox(),
+		pastes:       paste.NewMonitorFromEnv(),
+		pasteWatches: make(map[string]*pasteWatch),
+		codeSearch:   codesearch.NewRegistryFromEnv(),
+		search:       search.NewRegistryFromEnv(),
+		budgets:      budget.NewStoreFromEnv(),
+		ctlog:        ctlog.NewClientFromEnv(),
+		enricher:     enrich.NewEnricherFromEnv(),
+		hibp:         hibp.NewClientFromEnv(),
+		mailcheck:    mailcheck.NewCheckerFromEnv(),
+		tsa:          tsa.NewClientFromEnv(),
+		signer:       signer,
+		reverseImage: reverseImage,
+		geo:          geoip.NewLocatorFromEnv(),
+		policies:     policies,
+		delivery:     policies.Client(0),
+		compliance:   profiles,
+		regions:      regions,
+		proxies:      proxies,
+		renderer:     renderer,
+		cluster:      nodes,
+		browsers:     browsers,
+		confidence:   scorer,
+		scorer:       urlScorer,
+		documents:    converter,
+		neo4j:        neo4j,
+		audit:        audit.NewLog(),
+	}
+	cs.registerDefaultProcessors()
+
+	return cs
+}
+
+// Archive returns the raw HTML archive
+func (cs *CrawlerService) Archive() *archive.Archive {
+	return cs.archive
+}
+
+// CodeSearchProviders returns the configured code search providers
+func (cs *CrawlerService) CodeSearchProviders() *codesearch.Registry {
+	return cs.codeSearch
+}
+
+// Budgets returns the tenants' monthly consumption caps
+func (cs *CrawlerService) Budgets() *budget.Store {
+	return cs.budgets
+}
+
+// SearchProviders returns the configured web search providers
+func (cs *CrawlerService) SearchProviders() *search.Registry {
+	return cs.search
+}
+
+// Regions returns the regions crawls can be routed to
+func (cs *CrawlerService) Regions() *region.Registry {
+	return cs.regions
+}
+
+// Proxies returns the proxy pool crawls not routed to a region go through
+func (cs *CrawlerService) Proxies() *proxy.Pool {
+	return cs.proxies
+}
+
+// Enricher returns the host enrichment service
+func (cs *CrawlerService) Enricher() *enrich.Enricher {
+	return cs.enricher
+}
+
+// TimestampingEnabled reports whether a timestamping authority is
+// configured
+func (cs *CrawlerService) TimestampingEnabled() bool {
+	return cs.tsa != nil
+}
+
+// Keyring returns the tenant encryption keys, nil when encryption at rest
+// is not configured
+func (cs *CrawlerService) Keyring() *keyring.Keyring {
+	return cs.keys
+}
+
+// CustodySigner returns the key evidence bundles are signed with, nil when
+// none is configured
+func (cs *CrawlerService) CustodySigner() *custody.Signer {
+	return cs.signer
+}
+
+// BreachLookupEnabled reports whether Have I Been Pwned is configured
+func (cs *CrawlerService) BreachLookupEnabled() bool {
+	return cs.hibp != nil
+}
+
+// ReverseImageSearchEnabled reports whether a reverse image search provider
+// is configured
+func (cs *CrawlerService) ReverseImageSearchEnabled() bool {
+	return cs.reverseImage != nil
+}
+
+// RenderingEnabled reports whether headless Chrome is configured for
+// render_js
+func (cs *CrawlerService) RenderingEnabled() bool {
+	return cs.renderer != nil
+}
+
+// StopRendering stops the headless browser, if one is running
+func (cs *CrawlerService) StopRendering() {
+	if cs.renderer != nil {
+		cs.renderer.Close()
+	}
+}
+
+// TorEnabled reports whether onion services can be reached; the crawler does
+// not route through Tor, so compliance profiles allowing it have no effect
+func (cs *CrawlerService) TorEnabled() bool {
+	return false
+}
+
+// withoutDenied drops URLs on hosts denied by operator policy
+func (cs *CrawlerService) withoutDenied(urls []string) []string {
+	kept := make([]string, 0, len(urls))
+	for _, raw := range urls {
+		if u, err := url.Parse(raw); err == nil && cs.policies.Denied(u.Hostname()) {
+			continue
+		}
+		kept = append(kept, raw)
+	}
+	return kept
+}
+
+// excludedCategory returns the first of the excluded categories host is
+// listed in, or ""
+func (cs *CrawlerService) excludedCategory(host string, excluded []string) string {
+	if len(excluded) == 0 {
+		return ""
+	}
+	for _, category := range cs.policies.Current().Categories(host) {
+		for _, name := range excluded {
+			if category == name {
+				return category
+			}
+		}
+	}
+	return ""
+}
+
+// PurgeDenied removes URLs on hosts now denied by operator policy from the
+// frontiers of stopped jobs, so continuations do not queue them. It returns
+// the jobs changed and how many URLs were removed.
+func (cs *CrawlerService) PurgeDenied(jobs []*models.CrawlJob) ([]*models.CrawlJob, int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var changed []*models.CrawlJob
+	purged := 0
+	for _, job := range jobs {
+		kept := cs.withoutDenied(job.Frontier)
+		if len(kept) < len(job.Frontier) {
+			purged += len(job.Frontier) - len(kept)
+			job.Frontier = kept
+			changed = append(changed, job)
+		}
+	}
+	return changed, purged
+}
+
+// Compliance returns the compliance profile registry
+func (cs *CrawlerService) Compliance() *compliance.Registry {
+	return cs.compliance
+}
+
+// BrowserProfiles returns the browser header profile registry
+func (cs *CrawlerService) BrowserProfiles() *browserprofile.Registry {
+	return cs.browsers
+}
+
+// jobCompliance returns the profile a job runs under; jobs without one
+// recorded run under the deployment default
+func (cs *CrawlerService) jobCompliance(job *models.CrawlJob) models.ComplianceProfile {
+	if job.Compliance != nil {
+		return *job.Compliance
+	}
+	p, _ := cs.compliance.Get("")
+	return p
+}
+
+// Policies returns the operator policy store
+func (cs *CrawlerService) Policies() *policy.Store {
+	return cs.policies
+}
+
+// GeoIP returns the GeoIP locator
+func (cs *CrawlerService) GeoIP() *geoip.Locator {
+	return cs.geo
+}
+
+// Neo4j returns the graph database writer, or nil when not configured
+func (cs *CrawlerService) Neo4j() *graph.Neo4jWriter {
+	return cs.neo4j
+}
+
+// UseResultStore sets where the results of jobs loaded from persistent
+// storage are read from
+func (cs *CrawlerService) UseResultStore(results store.ResultStore) {
+	cs.results = results
+}
+
+// UseJobSaver sets how changes the crawler makes to a job after it has
+// finished, such as the delivery state of its callback, are persisted
+func (cs *CrawlerService) UseJobSaver(save func(*models.CrawlJob)) {
+	cs.saveJob = save
+}
+
+// Audit returns the audit log of destructive operations
+func (cs *CrawlerService) Audit() *audit.Log {
+	return cs.audit
+}
+
+// Scripts returns the tenant extraction script store
+func (cs *CrawlerService) Scripts() *scripts.Store {
+	return cs.scripts
+}
+
+// FieldMasks returns the result fields hidden per role
+func (cs *CrawlerService) FieldMasks() *fieldmask.Store {
+	return cs.fieldMasks
+}
+
+// Views returns the saved result views
+func (cs *CrawlerService) Views() *views.Store {
+	return cs.views
+}
+
+// Events returns the job event bus
+func (cs *CrawlerService) Events() *events.Bus {
+	return cs.events
+}
+
+// Secrets returns the secret manager resolver
+func (cs *CrawlerService) Secrets() *secrets.Resolver {
+	return cs.secrets
+}
+
+// Quota returns the storage quota tracker
+func (cs *CrawlerService) Quota() *quota.Tracker {
+	return cs.quota
 }
 
 // StartCrawl initiates a web crawl based on the provided job and request
@@ -29,79 +495,348 @@ func (cs *CrawlerService) StartCrawl(job *models.CrawlJob, req models.CrawlReque
 	cs.mu.Lock()
 	job.Status = "running"
 	cs.mu.Unlock()
+	cs.publishStatus(job, "running")
+
+	run := cs.register(job, req)
+	defer cs.unregister(run)
+	if req.DedupeScope == models.DedupeScopeJob {
+		defer cs.contentIndex.ForgetScope(dedup.JobScope(job.ID))
+	}
+
+	// Enforce the absolute runtime ceiling, measured from job start, or
+	// from when it was last resumed, so watchdog restarts do not extend it
+	maxRuntime := jobMaxRuntime(req.MaxRuntimeSeconds)
+	started := job.StartedAt
+	if job.ResumedAt != nil {
+		started = *job.ResumedAt
+	}
+	killTimer := time.AfterFunc(time.Until(started.Add(maxRuntime)), func() {
+		log.WithField("job_id", job.ID).Warn("Job exceeded maximum runtime, stopping")
+		cs.stop(run, stopMaxRuntime)
+	})
+	defer killTimer.Stop()
 
 	// Create collector
 	c := colly.NewCollector(
 		colly.MaxDepth(req.MaxDepth),
 		colly.Async(true),
 	)
+	profile := cs.jobCompliance(job)
+	c.IgnoreRobotsTxt = !obeysRobots(profile, req)
+	c.AllowedDomains = req.AllowedDomains
+	if limit := documentMaxBytes(req) + 1; req.IncludeDocuments && limit > int64(c.MaxBodySize) {
+		// Documents over the limit are cut off one byte past it, so they
+		// are told from those at it
+		c.MaxBodySize = int(limit)
+	}
+	follow, err := newLinkFilter(req)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
 
-	// Set user agent
-	userAgent := req.UserAgent
-	if userAgent == "" {
-		userAgent = os.Getenv("USER_AGENT")
-		if userAgent == "" {
-			userAgent = "DefinitelyNotASpy/1.0"
+	// Set user agent; without an explicit one, each request takes its
+	// user agent and headers from a rotated browser profile, unless the
+	// crawler identifies itself
+	c.UserAgent = resolveUserAgent(req.UserAgent)
+	identifies := identifying(req.Identify)
+	var browsers *browserprofile.Rotation
+	if req.UserAgent == "" && !identifies {
+		rotation, err := cs.browsers.Select(req.BrowserProfiles)
+		if err != nil {
+			return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
 		}
+		browsers = rotation
 	}
-	c.UserAgent = userAgent
 
-	// Add random user agent extension
-	extensions.RandomUserAgent(c)
-
-	// Set rate limiting
+	// Set rate limiting; domains that rate limited the crawl this one
+	// continues get one request at a time and a longer delay. Colly applies
+	// the first matching rule.
+	for _, domain := range req.SlowDomains {
+		for _, glob := range []string{domain, "*." + domain} {
+			c.Limit(&colly.LimitRule{
+				DomainGlob:  glob,
+				Parallelism: 1,
+				Delay:       slowDomainDelay,
+				RandomDelay: slowDomainDelay,
+			})
+		}
+	}
+	// Requests beyond the first are let through by the concurrency ramp
+	// as the targets show they can take them
+	parallelism := jobParallelism(req.MaxParallelism)
+	retries := jobRetryPolicy(req)
 	c.Limit(&colly.LimitRule{
 		DomainGlob:  "*",
-		Parallelism: 2,
+		Parallelism: parallelism,
 		Delay:       1 * time.Second,
 	})
 
-	// Track crawled pages
+	processors, err := cs.pipeline.Select(req.Processors)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+
+	urlKeys, err := urlkey.New(req.QueryParams)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+
+	// Resolve secrets for this run only; they are never stored on the job
+	secretCtx, cancelSecrets := context.WithTimeout(context.Background(), 30*time.Second)
+	secretValues, err := cs.secrets.ResolveAll(secretCtx, req.Secrets)
+	cancelSecrets()
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.SecretUnavailable, err))
+	}
+	redactions := credentialValues(req, secretValues)
+
+	// Deliver page and completion events to the job's webhooks
+	stopWebhooks := cs.startWebhooks(job, req, secretValues)
+	defer stopWebhooks()
+
+	// Apply per-domain client certificates and HTTP authentication
+	transport, err := cs.buildTransport(req, profile, secretValues)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+	// Give each host a request timeout adapted to its response times, and
+	// ramp parallelism with the error rate
+	timings := newDomainTimings()
+	stats := newDomainStats()
+	ramp := newParallelismRamp(parallelism, func(state models.ParallelismRamp) {
+		cs.mu.Lock()
+		job.Parallelism = &state
+		cs.mu.Unlock()
+		log.WithFields(log.Fields{
+			"job_id":      job.ID,
+			"parallelism": state.Current,
+			"state":       state.State,
+			"error_rate":  state.ErrorRate,
+		}).Debug("Parallelism changed")
+	})
+	c.WithTransport(runTransport{next: rampTransport{next: adaptiveTransport{next: cs.charged(job, transport), timings: timings}, ramp: ramp}, run: run})
+
+	// Space requests to each host by its robots.txt Crawl-delay
+	var delays *crawlDelays
+	if !c.IgnoreRobotsTxt {
+		delays = newCrawlDelays(cs.charged(job, transport), c.UserAgent)
+	}
+	// Pages rendered in headless Chrome make their requests as the crawl does
+	renderAccess := cs.renderAccess(req, profile, cs.charged(job, transport), secretValues, delays)
+
+	// Keep each host's cookies to itself, resuming the sessions of the run
+	// this one restarts or continues
+	saved := job.Cookies
+	if len(saved) == 0 {
+		saved = req.Cookies
+	}
+	jar := hostjar.New(saved)
+	c.SetCookieJar(jar)
+
+	// Track crawled pages; a resumed crawl carries on from the pages its
+	// interrupted run kept
 	pageCount := 0
 	var results []models.CrawlResult
+	if req.Resume {
+		pageCount = job.PagesCrawled
+		results = append(results, job.Results...)
+	}
 	var resultsMu sync.Mutex
+	var crawlErr error
+
+	// The HTML callback updates the page count, quota status and error
+	// under resultsMu; the callbacks running alongside it read them here
+	state := func() (int, string, error) {
+		resultsMu.Lock()
+		defer resultsMu.Unlock()
+		return pageCount, job.QuotaStatus, crawlErr
+	}
+
+	// Track which page each URL was discovered from
+	discoveredFrom := make(map[string]string)
+	var linksMu sync.Mutex
+
+	// AMP and print versions map to the page they are a version of, so the
+	// same page is only taken once in whichever form is reached first
+	variantOf := make(map[string]string)
+	taken := make(map[string]bool)
+
+	// Language alternates of taken pages: their language, and the index of
+	// the result they are folded into
+	alternateLang := make(map[string]string)
+	alternateOf := make(map[string]int)
+
+	// Discovered URLs that were not visited, for the coverage report
+	gaps := newCoverage()
+
+	// The first URL queued under each key; keys ignore query parameters
+	// that do not change the page
+	queued := make(map[string]string)
+
+	// A crawl strategy orders the links followed across all pages: they
+	// are queued on a frontier visited a batch at a time. Focused crawls
+	// keep how relevant each queued URL looked.
+	var ordered *frontier
+	if req.CrawlStrategy != "" {
+		ordered = newFrontier(req.CrawlStrategy)
+	}
+	focused := req.CrawlStrategy == models.CrawlStrategyFocused
+	relevance := make(map[string]float64)
 
-	// Set timeout
-	c.SetRequestTimeout(30 * time.Second)
+	// Save the run's progress while it lasts, so it can be resumed should
+	// the process die before the run ends
+	stopSaving := cs.saveProgress(run, func() SavedRun {
+		resultsMu.Lock()
+		saved := SavedRun{
+			Results:      append([]models.CrawlResult(nil), results...),
+			PagesCrawled: pageCount,
+		}
+		resultsMu.Unlock()
+
+		linksMu.Lock()
+		pending := make([]string, 0, len(queued))
+		for _, link := range queued {
+			pending = append(pending, link)
+		}
+		linksMu.Unlock()
+
+		saved.Visited = append(gaps.requested(), req.Visited...)
+		saved.Frontier = cs.withoutDenied(gaps.unrequested(pending, req.Visited))
+		saved.Cookies = jar.Snapshot()
+		return saved
+	})
+	defer stopSaving()
+
+	// Set timeout; waiting for response headers is bounded per host by
+	// the adaptive transport
+	c.SetRequestTimeout(maxRequestTimeout)
 
 	// On HTML response
 	c.OnHTML("html", func(e *colly.HTMLElement) {
 		resultsMu.Lock()
 		defer resultsMu.Unlock()
 
-		if pageCount >= req.MaxPages {
+		if run.ctx.Err() != nil {
+			gaps.unvisited(e.Request.Ctx.Get(requestedURLKey), gapStopped)
 			return
 		}
+		if pageCount >= req.MaxPages || job.QuotaStatus != "" || crawlErr != nil {
+			return
+		}
+
+		// A panicking processor fails the job but keeps what was collected
+		defer func() {
+			if r := recover(); r != nil {
+				crawlErr = errcode.Wrap(errcode.Internal, fmt.Errorf("result processing panicked: %v", r))
+				log.WithField("job_id", job.ID).Errorf("Result processing panicked: %v", r)
+			}
+		}()
+
+		pageURL := e.Request.URL.String()
+		links := variants.Find(e.DOM, e.Request.URL)
+		original, kind := pageURL, links.Kind
+
+		linksMu.Lock()
+		parentURL := discoveredFrom[pageURL]
+		relevanceScore := relevance[pageURL]
+		if of, ok := variantOf[pageURL]; ok {
+			original = of
+			if kind == "" {
+				kind = req.PreferVariant
+			}
+		} else if links.Of != "" {
+			original = links.Of
+		}
+		linksMu.Unlock()
+
+		if taken[original] {
+			return
+		}
+		if kind == "" {
+			linksMu.Lock()
+			for _, variant := range []string{links.AMP, links.Print} {
+				if variant != "" {
+					variantOf[variant] = pageURL
+				}
+			}
+			linksMu.Unlock()
+
+			// Fall back to the page itself when the variant cannot be
+			// visited, e.g. at max_depth
+			if variant := links.Preferred(req.PreferVariant); variant != "" && e.Request.Visit(variant) == nil {
+				return
+			}
+		}
+		taken[original] = true
 
 		pageCount++
 		job.PagesCrawled = pageCount
+		cs.touch(run)
 
-		// Extract title
-		title := e.ChildText("title")
+		var result models.CrawlResult
+		pctx := &pipeline.Context{Job: job, Request: &req, Element: e, DiscoveredFrom: parentURL}
+		if err := pipeline.Run(processors, pctx, &result); err != nil {
+			if errors.Is(err, pipeline.ErrSkip) {
+				pageCount--
+				job.PagesCrawled = pageCount
+			} else if !errors.Is(err, pipeline.ErrDrop) {
+				log.WithError(err).WithField("job_id", job.ID).Error("Result processing failed")
+			}
+			return
+		}
+		result.Provenance = cs.responseProvenance(job, e.Response)
+		result.RelevanceScore = relevanceScore
 
-		// Extract main content
-		content := extractContent(e)
+		// Soft 404s are kept but are not pages of the site
+		if result.Soft404 {
+			pageCount--
+			job.PagesCrawled = pageCount
+		}
 
-		// Extract links
-		var links []string
-		e.ForEach("a[href]", func(_ int, el *colly.HTMLElement) {
-			link := el.Attr("href")
-			if link != "" {
-				links = append(links, link)
+		if kind != "" {
+			result.Variant = kind
+			if original != pageURL {
+				result.VariantOf = original
 			}
-		})
+		}
+
+		// An alternate of a page already taken becomes one of its
+		// translations
+		if i, ok := alternateOf[pageURL]; ok {
+			results[i].Translations = append(results[i].Translations, models.Translation{
+				Language:        result.Language,
+				URL:             result.URL,
+				Title:           result.Title,
+				Content:         result.Content,
+				ContentMarkdown: result.ContentMarkdown,
+			})
+			return
+		}
 
-		result := models.CrawlResult{
-			URL:        e.Request.URL.String(),
-			Title:      title,
-			Content:    content,
-			Links:      links,
-			CrawledAt:  time.Now().UTC(),
-			StatusCode: e.Response.StatusCode,
+		linksMu.Lock()
+		for _, alt := range result.Alternates {
+			if _, ok := alternateOf[alt.URL]; !ok {
+				alternateOf[alt.URL] = len(results)
+				alternateLang[alt.URL] = alt.Language
+			}
+		}
+		linksMu.Unlock()
+		if len(req.Languages) > 0 && !req.SkipAlternates {
+			for _, alt := range result.Alternates {
+				if hreflang.Match(alt.Language, req.Languages) {
+					if err := e.Request.Visit(alt.URL); err != nil {
+						gaps.visitFailed(alt.URL, err)
+					}
+				}
+			}
 		}
 
 		results = append(results, result)
-		job.URLsFound = len(links)
+		stats.page(result.URL)
+		job.URLsFound = len(result.Links)
+		if !result.Soft404 && result.DuplicateOf == "" {
+			cs.publishPage(job, result)
+		}
 
 		log.WithFields(log.Fields{
 			"job_id": job.ID,
@@ -110,20 +845,185 @@ func (cs *CrawlerService) StartCrawl(job *models.CrawlJob, req models.CrawlReque
 		}).Info("Page crawled")
 	})
 
-	// Follow links
-	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
-		if pageCount >= req.MaxPages {
+	// Follow links, the most promising of each page first
+	followLink := func(link string, score float64, from *colly.Request) {
+		pages, quota, _ := state()
+		switch {
+		case pages >= req.MaxPages:
+			gaps.skip(link, gapBudget)
+			return
+		case quota != "":
+			gaps.skip(link, gapQuota)
+			return
+		}
+
+		// Local files are only reachable from other local files, never from
+		// links on remote pages
+		if strings.HasPrefix(link, "file:") && from.URL.Scheme != "file" {
+			gaps.skip(link, gapFilter)
+			return
+		}
+		if !follow.allows(link) {
+			gaps.skip(link, gapFilter)
+			return
+		}
+
+		// Remember the first page that linked to each URL; versions of pages
+		// already taken are not fetched
+		linksMu.Lock()
+		if _, ok := variantOf[link]; ok {
+			linksMu.Unlock()
+			gaps.skip(link, gapVariant)
+			return
+		}
+		if lang, ok := alternateLang[link]; ok && (req.SkipAlternates || (len(req.Languages) > 0 && !hreflang.Match(lang, req.Languages))) {
+			linksMu.Unlock()
+			gaps.skip(link, gapLanguage)
+			return
+		}
+		if _, ok := discoveredFrom[link]; !ok {
+			discoveredFrom[link] = from.URL.String()
+		}
+		key := urlKeys.Key(link)
+		first, seen := queued[key]
+		if !seen {
+			queued[key] = link
+			if focused {
+				relevance[link] = score
+			}
+		}
+		linksMu.Unlock()
+
+		if seen {
+			// Repeats of the same URL are colly's to skip; only count the
+			// URLs these rules saved a fetch of
+			if first != link {
+				cs.mu.Lock()
+				job.DuplicateURLs++
+				cs.mu.Unlock()
+				gaps.skip(link, gapDuplicate)
+			}
+			return
+		}
+		if ordered != nil {
+			ordered.push(frontierLink{url: link, from: from, depth: from.Depth + 1, score: score})
+		} else if err := from.Visit(link); err != nil {
+			gaps.visitFailed(link, err)
+			return
+		}
+		cs.publishDiscovered(job, link, from.URL.String())
+	}
+
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		if _, _, err := state(); err != nil {
 			return
 		}
-		
-		link := e.Attr("href")
-		if link != "" {
-			e.Request.Visit(link)
+
+		var links []priority.Link
+		e.ForEach("a[href]", func(_ int, a *colly.HTMLElement) {
+			if link := e.Request.AbsoluteURL(a.Attr("href")); link != "" {
+				links = append(links, priority.Link{
+					URL:    link,
+					Anchor: strings.TrimSpace(a.Text),
+					From:   e.Request.URL.String(),
+					Depth:  e.Request.Depth + 1,
+					Query:  req.Query,
+				})
+				if focused {
+					links[len(links)-1].Context = linkContext(a)
+				}
+			}
+		})
+		if ordered == nil {
+			links = priority.Rank(run.ctx, cs.scorer, links)
+		}
+		for _, link := range links {
+			if _, _, err := state(); err != nil {
+				return
+			}
+			var score float64
+			if focused {
+				score = priority.Relevance(link)
+			}
+			followLink(link.URL, score, e.Request)
 		}
 	})
 
+	c.OnResponse(markFetchTiming)
+	c.OnResponse(observeResponse)
+	c.OnResponse(func(r *colly.Response) {
+		stats.response(r, "")
+	})
+	c.OnResponse(cs.convertDocuments(run.ctx, req, func(r *colly.Response) {
+		gaps.unvisited(r.Request.URL.String(), gapDocument)
+	}))
+	c.OnResponse(normalizeEncoding)
+	if req.RenderJS && cs.renderer != nil {
+		c.OnResponse(cs.renderShells(run.ctx, render.Page{Access: renderAccess, Emulation: renderEmulation(req.Emulation)}, func(took time.Duration) {
+			cs.mu.Lock()
+			job.PagesRendered++
+			job.Cost.RenderMinutes += took.Minutes()
+			cs.mu.Unlock()
+		}))
+	}
+
 	// On request
 	c.OnRequest(func(r *colly.Request) {
+		if run.ctx.Err() != nil {
+			gaps.skip(r.URL.String(), gapStopped)
+			r.Abort()
+			return
+		}
+		if cs.policies.Denied(r.URL.Hostname()) {
+			gaps.skip(r.URL.String(), gapDenied)
+			r.Abort()
+			return
+		}
+		if reason := compliance.Refuses(profile, r.URL); reason != "" {
+			log.WithField("job_id", job.ID).Debugf("Skipping %s: %s", r.URL, reason)
+			gaps.skip(r.URL.String(), gapCompliance)
+			r.Abort()
+			return
+		}
+		if category := cs.excludedCategory(r.URL.Hostname(), req.ExcludeCategories); category != "" {
+			log.WithField("job_id", job.ID).Debugf("Skipping %s: %s category excluded", r.URL, category)
+			gaps.skip(r.URL.String(), gapCategory)
+			r.Abort()
+			return
+		}
+		if err := cs.waitCooldown(run, r.URL.Hostname()); err != nil {
+			gaps.skip(r.URL.String(), gapStopped)
+			r.Abort()
+			return
+		}
+		if delays != nil {
+			if err := delays.wait(cs, run, r.URL); err != nil {
+				gaps.skip(r.URL.String(), gapStopped)
+				r.Abort()
+				return
+			}
+		}
+		gaps.attempt(r.URL.String())
+
+		if browsers != nil {
+			browsers.Apply(r.Headers)
+		}
+		if identifies {
+			identify(r.Headers)
+		}
+		for name, value := range req.Headers {
+			r.Headers.Set(name, secrets.Interpolate(value, secretValues))
+		}
+		applyDomainHeaders(req, secretValues, r.URL.Hostname(), r.Headers)
+		if profile := cs.policies.Current().Profile(r.URL.Hostname()); profile != nil {
+			profile.Apply(r.Headers)
+		}
+		cs.conditional(job, req, r)
+
+		// Redirects replace the request URL, so keep the one asked for
+		r.Ctx.Put(requestedURLKey, r.URL.String())
+		r.Ctx.Put(renderAccessKey, renderAccess)
+
 		log.WithFields(log.Fields{
 			"job_id": job.ID,
 			"url":    r.URL.String(),
@@ -132,32 +1032,234 @@ func (cs *CrawlerService) StartCrawl(job *models.CrawlJob, req models.CrawlReque
 
 	// On error
 	c.OnError(func(r *colly.Response, err error) {
+		markFetchTiming(r)
+		if notModified(req, r) {
+			stats.response(r, "")
+			cs.mu.Lock()
+			job.PagesUnchanged++
+			cs.mu.Unlock()
+			log.WithFields(log.Fields{
+				"job_id": job.ID,
+				"url":    r.Request.URL.String(),
+			}).Debug("Page not modified")
+			return
+		}
+
+		code := errcode.Classify(err, r.StatusCode)
+		err = redactError(err, redactions)
+		observeError(r, code)
+		if r.StatusCode == http.StatusTooManyRequests {
+			cs.coolDown(r)
+		}
+		if cs.retry(run, retries, r, code) {
+			resultsMu.Lock()
+			job.Retries++
+			resultsMu.Unlock()
+			log.WithFields(log.Fields{
+				"job_id":     job.ID,
+				"url":        r.Request.URL.String(),
+				"error_code": code,
+				"attempt":    retryAttempts(r.Request),
+			}).Warn("Retrying request")
+			return
+		}
+
+		stats.response(r, code)
+
+		switch {
+		case r.StatusCode == http.StatusTooManyRequests:
+			gaps.rateLimited(r.Request.URL.String())
+		case code == errcode.PolicyDenied:
+			gaps.unvisited(r.Request.URL.String(), gapDenied)
+		case code == errcode.ComplianceDenied:
+			gaps.unvisited(r.Request.URL.String(), gapCompliance)
+		case code == errcode.OutsideWindow:
+			gaps.unvisited(r.Request.URL.String(), gapWindow)
+		}
+
+		resultsMu.Lock()
+		if job.ErrorCounts == nil {
+			job.ErrorCounts = make(map[string]int)
+		}
+		job.ErrorCounts[code]++
+		if len(job.FailedURLs) < maxFailedURLs && !deniedError(code) {
+			job.FailedURLs = append(job.FailedURLs, failedURL(r, code, err))
+		}
+		resultsMu.Unlock()
+
 		log.WithFields(log.Fields{
-			"job_id": job.ID,
-			"url":    r.Request.URL.String(),
-			"error":  err.Error(),
+			"job_id":     job.ID,
+			"url":        r.Request.URL.String(),
+			"error":      err.Error(),
+			"error_code": code,
 		}).Error("Crawl error")
+		cs.publishFailed(job, r.Request.URL.String(), r.StatusCode, code, err)
 	})
 
-	// Start crawling from search results
-	searchURLs := performSearch(req.Query, 10)
-	
+	// Start crawling from search results, or from the seeds given, plus a
+	// warm start's pages of a prior crawl. URLs a continued crawl already
+	// visited count as queued. Continued and resumed crawls start from the
+	// best of the frontier they inherit.
+	searchURLs := req.SeedURLs
+	if len(searchURLs) == 0 {
+		var err error
+		if searchURLs, err = cs.seedURLs(run.ctx, job, req); err != nil {
+			return cs.failJob(job, nil, err)
+		}
+	} else if req.ContinueOf != "" || req.Resume {
+		searchURLs = cs.rankFrontier(run.ctx, searchURLs, req.Query)
+	}
+	searchURLs = append(searchURLs, req.WarmSeeds...)
+	searchURLs = append(searchURLs, cs.monitoredPages(job, req)...)
+	for _, seed := range searchURLs {
+		follow.addSeed(seed)
+	}
+	if req.DiscoverSeeds {
+		searchURLs = append(searchURLs, cs.discoverSeeds(run.ctx, job, req, cs.charged(job, transport), c.UserAgent, follow, gaps, searchURLs)...)
+	}
+	linksMu.Lock()
+	for _, visited := range req.Visited {
+		queued[urlKeys.Key(visited)] = visited
+	}
+	linksMu.Unlock()
+
+	var visitErr error
+	visited := 0
 	for _, url := range searchURLs {
-		c.Visit(url)
+		key := urlKeys.Key(url)
+		linksMu.Lock()
+		_, dup := queued[key]
+		if !dup {
+			queued[key] = url
+			if focused {
+				relevance[url] = priority.Relevance(priority.Link{URL: url, Query: req.Query})
+			}
+		}
+		linksMu.Unlock()
+		if dup {
+			continue
+		}
+		if err := c.Visit(url); err != nil {
+			gaps.visitFailed(url, err)
+			visitErr = err
+			continue
+		}
+		visited++
 	}
 
-	// Wait for completion
-	c.Wait()
+	// Wait for completion, abandoning in-flight requests once a stopped run's
+	// grace period has passed
+	results = cs.waitCollector(c, run, &resultsMu, &results)
+
+	// With a crawl strategy, visit the frontier a batch at a time, each as
+	// large as the parallelism and the pages left in the budget allow, so
+	// the budget goes to the first links in the strategy's order
+	for ordered != nil && run.ctx.Err() == nil {
+		pages, quota, err := state()
+		left := req.MaxPages - pages
+		if left <= 0 || quota != "" || err != nil {
+			break
+		}
+		batch := ordered.next(min(parallelism, left))
+		if len(batch) == 0 {
+			break
+		}
+		for _, link := range batch {
+			if err := link.from.Visit(link.url); err != nil {
+				gaps.visitFailed(link.url, err)
+			}
+		}
+		results = cs.waitCollector(c, run, &resultsMu, &results)
+	}
+	// Requests abandoned by a stopped run may still be finishing, so the
+	// state they update is read under its lock
+	_, quota, runErr := state()
+	if ordered != nil {
+		reason := gapBudget
+		switch {
+		case run.ctx.Err() != nil:
+			reason = gapStopped
+		case quota != "":
+			reason = gapQuota
+		}
+		for _, link := range ordered.drain() {
+			gaps.skip(link.url, reason)
+		}
+	}
+
+	cs.mu.Lock()
+	job.Coverage = gaps.report()
+	job.RobotsBlocked = robotsBlocked(job.Coverage)
+	job.Frontier = cs.withoutDenied(gaps.frontier())
+	job.Cookies = jar.Snapshot()
+	job.ResponseTimes = timings.report()
+	job.DomainStats = stats.report()
+	cs.mu.Unlock()
+
+	if runErr == nil && visited == 0 && visitErr != nil {
+		runErr = fmt.Errorf("no seed URL could be visited: %w", visitErr)
+	}
+	if runErr != nil {
+		return cs.failJob(job, results, runErr)
+	}
+
+	// Handle runs stopped by the watchdog, the runtime ceiling or deletion
+	switch cs.stopReasonOf(run) {
+	case stopDeleted:
+		// The job was deleted while running; keep nothing it collected
+		log.WithField("job_id", job.ID).Info("Deleted job stopped")
+		return nil
+	case stopRestart:
+		cs.mu.Lock()
+		job.Restarts++
+		job.PagesCrawled = 0
+		job.URLsFound = 0
+		job.Retries = 0
+		job.FailedURLs = nil
+		job.DuplicatePages = 0
+		job.PagesUnchanged = 0
+		cs.mu.Unlock()
+		// The restarted run crawls the pages again
+		cs.contentIndex.ForgetScope(dedup.JobScope(job.ID))
+
+		log.WithFields(log.Fields{
+			"job_id":   job.ID,
+			"restarts": job.Restarts,
+		}).Warn("Restarting stalled job")
+
+		cs.unregister(run)
+		stopWebhooks()
+		return cs.StartCrawl(job, req)
+	case stopStalled:
+		return cs.cancelJob(job, results, errcode.Stalled, fmt.Errorf("job stalled: no page crawled within the watchdog period"))
+	case stopCheckpoint:
+		return cs.cancelJob(job, results, errcode.Maintenance, fmt.Errorf("job checkpointed for maintenance; continue it to resume from its frontier"))
+	case stopCancelled:
+		return cs.cancelJob(job, results, errcode.Cancelled, fmt.Errorf("job cancelled by request"))
+	case stopPreempted:
+		return cs.pauseJob(job, results)
+	case stopMaxRuntime:
+		cs.mu.Lock()
+		job.Partial = true
+		job.ErrorCode = errcode.MaxRuntimeExceeded
+		job.Error = fmt.Sprintf("maximum runtime of %s exceeded", maxRuntime)
+		cs.mu.Unlock()
+	}
 
 	// Update job
 	cs.mu.Lock()
 	job.Status = "completed"
+	numberResults(job, results)
 	job.Results = results
 	job.CompletedAt = time.Now().UTC()
 	cs.mu.Unlock()
+	cs.publishFinished(job)
 
-	// Send results to intel service
-	go cs.sendToIntelService(job)
+	// Deliver results to the job's outputs, then offload large result sets
+	go func() {
+		cs.deliverResults(job, job.Results)
+		cs.offloadResults(job)
+	}()
 
 	log.WithFields(log.Fields{
 		"job_id":        job.ID,
@@ -167,22 +1269,407 @@ func (cs *CrawlerService) StartCrawl(job *models.CrawlJob, req models.CrawlReque
 	return nil
 }
 
+// cancelJob marks a job cancelled, keeping and forwarding any results
+// collected before it was stopped
+func (cs *CrawlerService) cancelJob(job *models.CrawlJob, results []models.CrawlResult, code string, reason error) error {
+	cs.mu.Lock()
+	job.Status = "cancelled"
+	job.Error = reason.Error()
+	job.ErrorCode = code
+	job.CompletedAt = time.Now().UTC()
+	numberResults(job, results)
+	job.Results = results
+	job.Partial = len(results) > 0
+	cs.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"job_id":  job.ID,
+		"reason":  reason.Error(),
+		"results": len(results),
+	}).Warn("Crawl cancelled")
+	cs.publishFinished(job)
+
+	if len(results) > 0 {
+		go cs.deliverResults(job, job.Results)
+	}
+	return nil
+}
+
+// pauseJob marks a job stopped for one of higher priority paused, keeping
+// the results collected and the frontier recorded to resume from. Nothing
+// is delivered until the resumed crawl finishes.
+func (cs *CrawlerService) pauseJob(job *models.CrawlJob, results []models.CrawlResult) error {
+	cs.mu.Lock()
+	job.Status = "paused"
+	job.Error = "job paused for a job of higher priority"
+	job.ErrorCode = errcode.Preempted
+	job.Preemptions++
+	numberResults(job, results)
+	job.Results = results
+	cs.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"job_id":   job.ID,
+		"results":  len(results),
+		"frontier": len(job.Frontier),
+	}).Info("Crawl paused for a job of higher priority")
+	cs.publishStatus(job, "paused")
+	return nil
+}
+
+// failJob marks a job failed. Results collected before the failure are kept
+// as a partial result set and still delivered to the job's outputs.
+func (cs *CrawlerService) failJob(job *models.CrawlJob, results []models.CrawlResult, err error) error {
+	cs.mu.Lock()
+	job.Status = "failed"
+	job.Error = err.Error()
+	job.ErrorCode = errcode.Classify(err, 0)
+	job.CompletedAt = time.Now().UTC()
+	if len(results) > 0 {
+		numberResults(job, results)
+		job.Results = results
+		job.Partial = true
+	}
+	cs.mu.Unlock()
+
+	log.WithError(err).WithFields(log.Fields{
+		"job_id":  job.ID,
+		"partial": len(results),
+	}).Error("Crawl failed")
+	cs.publishFinished(job)
+
+	if len(results) > 0 {
+		go cs.deliverResults(job, job.Results)
+	}
+
+	return err
+}
+
+// newBaseTransport returns a fresh HTTP transport for a collector, with the
+// supported non-HTTP protocols (ftp://, operator-enabled file://) registered.
+// In fixture mode HTTP and HTTPS are answered by the built-in test site.
+// Operator policies are checked on every request and connection, whatever
+// its scheme, so policy changes apply to requests of running jobs too.
+func (cs *CrawlerService) newBaseTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	envProxy := t.Proxy
+	t.Proxy = func(r *http.Request) (*url.URL, error) {
+		if err := cs.policies.Check(r); err != nil {
+			return nil, err
+		}
+		if regional := region.ProxyFromContext(r.Context()); regional != nil {
+			return regional, nil
+		}
+		if pooled := proxy.FromContext(r.Context()); pooled != nil {
+			return pooled, nil
+		}
+		if envProxy == nil {
+			return nil, nil
+		}
+		return envProxy(r)
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   cs.policies.Control,
+	}
+	t.DialContext = dialer.DialContext
+
+	protocols.Register(t, cs.policies.Guard)
+	if fixture.Enabled() {
+		t.RegisterProtocol("http", cs.policies.Guard(fixture.Transport{}))
+		t.RegisterProtocol("https", cs.policies.Guard(fixture.Transport{}))
+	}
+	return t
+}
+
+// buildTransport layers client certificates and HTTP authentication over a
+// base transport that honours the job's compliance profile
+func (cs *CrawlerService) buildTransport(req models.CrawlRequest, profile models.ComplianceProfile, secretValues map[string]string) (http.RoundTripper, error) {
+	if req.Region != "" && !cs.regions.Has(req.Region) {
+		return nil, fmt.Errorf("unknown region %q", req.Region)
+	}
+	creds := domainCredentials(req, secretValues)
+	base := cs.newBaseTransport()
+	if profile.PublicOnly {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   publicOnly(cs.policies.Control),
+		}
+		base.DialContext = dialer.DialContext
+	}
+	var transport http.RoundTripper = base
+
+	if len(req.ClientCertificates) > 0 {
+		certs := make([]httpauth.ClientCert, 0, len(req.ClientCertificates))
+		for _, cc := range req.ClientCertificates {
+			certs = append(certs, httpauth.ClientCert{
+				Domains: cc.Domains,
+				CertPEM: secrets.Interpolate(cc.Certificate, secretValues),
+				KeyPEM:  secrets.Interpolate(cc.PrivateKey, secretValues),
+			})
+		}
+		certTransport, err := httpauth.NewCertTransport(base, certs)
+		if err != nil {
+			return nil, err
+		}
+		transport = certTransport
+	}
+
+	if len(creds) > 0 {
+		transport = httpauth.NewTransport(transport, creds)
+	}
+	if req.Region != "" {
+		transport = cs.regions.Transport(req.Region, transport)
+	} else {
+		transport = cs.proxies.Transport(transport)
+	}
+	return timedTransport{next: transport}, nil
+}
+
+// publicOnly extends a dialer check to refuse private and loopback
+// addresses, whatever the operator network policy allows
+func publicOnly(control func(string, string, syscall.RawConn) error) func(string, string, syscall.RawConn) error {
+	return func(network, address string, conn syscall.RawConn) error {
+		if err := control(network, address, conn); err != nil {
+			return err
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip != nil && policy.Private(ip) {
+			return errcode.Wrap(errcode.ComplianceDenied, fmt.Errorf("connection to %s is not public", ip))
+		}
+		return nil
+	}
+}
+
+// domainCredentials converts request credentials into transport credentials,
+// substituting resolved secrets
+func domainCredentials(req models.CrawlRequest, secretValues map[string]string) []httpauth.Credential {
+	creds := make([]httpauth.Credential, 0, len(req.DomainCredentials))
+	for domain, cred := range req.DomainCredentials {
+		if cred.Username == "" {
+			// Only headers or cookies, applied as requests are made
+			continue
+		}
+		creds = append(creds, httpauth.Credential{
+			Domain:   domain,
+			Type:     cred.Type,
+			Username: secrets.Interpolate(cred.Username, secretValues),
+			Password: secrets.Interpolate(cred.Password, secretValues),
+			TokenURL: cred.TokenURL,
+			Scopes:   cred.Scopes,
+		})
+	}
+	return creds
+}
+
+// applyDomainHeaders sets the headers and cookies of the domain credentials
+// matching host, substituting resolved secrets. Cookies join those already
+// on the request; the collector's jar adds its own as the request is sent.
+func applyDomainHeaders(req models.CrawlRequest, secretValues map[string]string, host string, headers *http.Header) {
+	for domain, cred := range req.DomainCredentials {
+		if !httpauth.MatchDomain(domain, host) {
+			continue
+		}
+		for name, value := range cred.Headers {
+			headers.Set(name, secrets.Interpolate(value, secretValues))
+		}
+		if len(cred.Cookies) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(cred.Cookies))
+		for name := range cred.Cookies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(names)+1)
+		if existing := headers.Get("Cookie"); existing != "" {
+			pairs = append(pairs, existing)
+		}
+		for _, name := range names {
+			pairs = append(pairs, name+"="+secrets.Interpolate(cred.Cookies[name], secretValues))
+		}
+		headers.Set("Cookie", strings.Join(pairs, "; "))
+	}
+}
+
+// credentialValues returns what a crawl authenticates with: its resolved
+// secrets and the passwords, header values and cookie values of its domain
+// credentials, which errors are redacted of before they are logged or
+// recorded on the job
+func credentialValues(req models.CrawlRequest, secretValues map[string]string) map[string]string {
+	values := make(map[string]string, len(secretValues))
+	for name, value := range secretValues {
+		values["secret:"+name] = value
+	}
+	for domain, cred := range req.DomainCredentials {
+		values[domain+":password"] = secrets.Interpolate(cred.Password, secretValues)
+		for name, value := range cred.Headers {
+			values[domain+":header:"+name] = secrets.Interpolate(value, secretValues)
+		}
+		for name, value := range cred.Cookies {
+			values[domain+":cookie:"+name] = secrets.Interpolate(value, secretValues)
+		}
+	}
+	return values
+}
+
+// redactError returns err with the given values redacted from its message
+func redactError(err error, values map[string]string) error {
+	if message := secrets.Redact(err.Error(), values); message != err.Error() {
+		return errors.New(message)
+	}
+	return err
+}
+
+// resolveUserAgent returns the requested user agent, falling back to USER_AGENT
+// and then the service default
+func resolveUserAgent(userAgent string) string {
+	if userAgent != "" {
+		return userAgent
+	}
+	if userAgent = os.Getenv("USER_AGENT"); userAgent != "" {
+		return userAgent
+	}
+	return identifyingUserAgent()
+}
+
+// buildResult extracts title, main content, links, metadata and images
+// from a crawled page
+func buildResult(e *colly.HTMLElement) models.CrawlResult {
+	// Extract title
+	title := e.ChildText("title")
+
+	// Extract main content, flattened and as Markdown
+	content := extractContent(e)
+	contentMarkdown := extractMarkdown(e)
+
+	// Extract links with anchor text and relationship
+	var links []models.Link
+	e.ForEach("a[href]", func(_ int, el *colly.HTMLElement) {
+		href := el.Request.AbsoluteURL(el.Attr("href"))
+		if href == "" {
+			return
+		}
+		links = append(links, models.Link{
+			URL:      href,
+			Text:     strings.Join(strings.Fields(el.Text), " "),
+			Rel:      el.Attr("rel"),
+			External: isExternal(e.Request.URL, href),
+		})
+	})
+
+	// Read metadata, headings and images
+	meta := extractor.Extract(e.DOM, e.Request.URL, content)
+
+	result := models.CrawlResult{
+		URL:             e.Request.URL.String(),
+		Title:           title,
+		Content:         content,
+		ContentMarkdown: contentMarkdown,
+		Links:           links,
+		Media:           meta.Images,
+		CrawledAt:       time.Now().UTC(),
+		StatusCode:      e.Response.StatusCode,
+		Depth:           linkDepth(e.Request),
+		MetaDescription: meta.Description,
+		CanonicalURL:    meta.Canonical,
+		OpenGraph:       meta.OpenGraph,
+		TwitterCard:     meta.TwitterCard,
+		Headings:        meta.Headings,
+		PublishedAt:     meta.PublishedAt,
+	}
+	if e.Response.Headers != nil {
+		result.CID = e.Response.Headers.Get(protocols.CIDHeader)
+	}
+	result.Encoding = e.Response.Ctx.Get(encodingKey)
+	result.ContentType, result.SizeBytes = servedAs(e.Response)
+	if hint := e.Response.Ctx.Get(renderedKey); hint != "" {
+		result.Rendered, result.RenderHint = true, hint
+	}
+
+	result.Language, result.Alternates = hreflang.Find(e.DOM, e.Request.URL)
+	if result.Language == "" {
+		result.Language = meta.Language
+	}
+
+	versions := variants.Find(e.DOM, e.Request.URL)
+	result.AMPURL, result.PrintURL = versions.AMP, versions.Print
+	result.Variant, result.VariantOf = versions.Kind, versions.Of
+	return result
+}
+
+// normalizeEncoding transcodes a response body to UTF-8 before it is parsed
+// and records the original encoding. Colly has already transcoded bodies
+// whose Content-Type declares a charset; the rest are detected here.
+func normalizeEncoding(r *colly.Response) {
+	if r.Headers == nil || len(r.Body) == 0 {
+		return
+	}
+	contentType := r.Headers.Get("Content-Type")
+	if name := textenc.HeaderCharset(contentType); name != "" {
+		r.Ctx.Put(encodingKey, name)
+		return
+	}
+	if contentType != "" && !strings.Contains(strings.ToLower(contentType), "html") {
+		return
+	}
+
+	body, name, err := textenc.Decode(r.Body)
+	if err != nil {
+		log.WithError(err).WithField("url", r.Request.URL.String()).Warn("Failed to normalise page encoding")
+		return
+	}
+	r.Body = body
+	r.Ctx.Put(encodingKey, name)
+}
+
+// isExternal reports whether href points to a different site than page,
+// ignoring a leading www.
+func isExternal(page *url.URL, href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return true
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") !=
+		strings.TrimPrefix(strings.ToLower(page.Hostname()), "www.")
+}
+
+// linkDepth returns how many links away from a seed URL a request is; colly
+// counts seed requests as depth 1
+func linkDepth(r *colly.Request) int {
+	if r.Depth <= 1 {
+		return 0
+	}
+	return r.Depth - 1
+}
+
+// contentSelectors are the areas main content is taken from, most specific
+// first
+var contentSelectors = []string{
+	"article",
+	"main",
+	".content",
+	"#content",
+	".post-content",
+	".entry-content",
+	"p",
+}
+
+// maxMarkdownBytes caps the Markdown rendering of a page's main content
+const maxMarkdownBytes = 10000
+
 // extractContent extracts meaningful text content from HTML
 func extractContent(e *colly.HTMLElement) string {
 	var content strings.Builder
 
 	// Try to extract from common content areas
-	selectors := []string{
-		"article",
-		"main",
-		".content",
-		"#content",
-		".post-content",
-		".entry-content",
-		"p",
-	}
-
-	for _, selector := range selectors {
+	for _, selector := range contentSelectors {
 		e.ForEach(selector, func(_ int, el *colly.HTMLElement) {
 			text := strings.TrimSpace(el.Text)
 			if len(text) > 50 {
@@ -205,56 +1692,126 @@ func extractContent(e *colly.HTMLElement) string {
 	return result
 }
 
-// performSearch simulates a search and returns URLs (in production, integrate with Google Custom Search API)
-func performSearch(query string, maxResults int) []string {
-	// For now, return some placeholder URLs
-	// In production, integrate with Google Custom Search API or similar
-	log.WithField("query", query).Info("Performing search")
-	
-	// This is a placeholder. In production, you would:
-	// 1. Use Google Custom Search API
-	// 2. Use SerpAPI
-	// 3. Use Bing Search API
-	// 4. Or implement your own search scraper
-	
-	return []string{
-		fmt.Sprintf("https://en.wikipedia.org/wiki/%s", strings.ReplaceAll(query, " ", "_")),
-	}
-}
-
-// sendToIntelService sends crawl results to the intel service for processing
-func (cs *CrawlerService) sendToIntelService(job *models.CrawlJob) error {
-	intelURL := os.Getenv("PYTHON_SERVICE_URL")
-	if intelURL == "" {
-		log.Warn("PYTHON_SERVICE_URL not set, skipping intel service")
-		return nil
+// extractMarkdown renders the content areas extractContent reads as Markdown,
+// keeping headings, lists and links
+func extractMarkdown(e *colly.HTMLElement) string {
+	var parts []string
+	size := 0
+
+	for _, selector := range contentSelectors {
+		e.DOM.Find(selector).Each(func(_ int, s *goquery.Selection) {
+			if len(strings.TrimSpace(s.Text())) <= 50 {
+				return
+			}
+			if md := markdown.Convert(s, e.Request.URL); md != "" {
+				parts = append(parts, md)
+				size += len(md)
+			}
+		})
+
+		if size > 500 {
+			break
+		}
 	}
 
-	payload := models.IntelServiceRequest{
-		JobID:   job.ID,
-		Results: job.Results,
+	result := strings.Join(parts, "\n\n")
+	if len(result) > maxMarkdownBytes {
+		// Cut at a line break so no link or table row is left half-written
+		result = result[:maxMarkdownBytes]
+		if cut := strings.LastIndex(result, "\n"); cut > 0 {
+			result = result[:cut]
+		}
 	}
+	return result
+}
 
-	jsonData, err := json.Marshal(payload)
+// NormalizeSeedURL checks a seed URL and puts it in canonical form: https
+// is assumed without a scheme, scheme and host are lowercased and the
+// fragment is dropped
+func NormalizeSeedURL(raw string) (string, error) {
+	seed := strings.TrimSpace(raw)
+	if seed == "" {
+		return "", errors.New("seed URL is empty")
+	}
+	if !strings.Contains(seed, "://") {
+		seed = "https://" + seed
+	}
+	u, err := url.Parse(seed)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return "", fmt.Errorf("seed URL %q is invalid: %w", raw, err)
 	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !protocols.Supported(u.Scheme) || u.Host == "" {
+		return "", fmt.Errorf("seed URL %q needs a host and a supported scheme", raw)
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return u.String(), nil
+}
 
-	resp, err := http.Post(
-		fmt.Sprintf("%s/api/v1/process", intelURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		log.WithError(err).Error("Failed to send to intel service")
-		return err
+// defaultSearchResults is the number of search results a crawl starts from
+// when the request does not say
+const defaultSearchResults = 10
+
+// seedURLs returns the URLs a crawl starts from. A query that is itself an
+// absolute URL of a supported scheme is crawled directly; any other query
+// is searched for with the request's search provider. A search that fails
+// before finding anything is an error; otherwise the results found so far
+// are crawled.
+func (cs *CrawlerService) seedURLs(ctx context.Context, job *models.CrawlJob, req models.CrawlRequest) ([]string, error) {
+	query := req.Query
+	if u, err := url.Parse(query); err == nil && u.IsAbs() && u.Host != "" && protocols.Supported(u.Scheme) {
+		return []string{query}, nil
+	}
+
+	limit := req.SearchResults
+	if limit <= 0 {
+		limit = defaultSearchResults
+	}
+	if fixture.Enabled() {
+		return fixture.Search(query, limit), nil
 	}
-	defer resp.Body.Close()
 
 	log.WithFields(log.Fields{
-		"job_id": job.ID,
-		"status": resp.StatusCode,
-	}).Info("Sent to intel service")
+		"job_id":   job.ID,
+		"query":    query,
+		"provider": req.SearchProvider,
+	}).Info("Performing search")
 
-	return nil
+	cs.chargeAPICall(job, APISearch)
+	results, err := cs.search.Search(ctx, req.SearchProvider, query, limit)
+	if err != nil && len(results) == 0 {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"job_id":  job.ID,
+			"results": len(results),
+		}).Warn("Search failed")
+	}
+
+	urls := make([]string, 0, len(results))
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	return urls, nil
+}
+
+// signIntelRequest signs a push to the intel service with the shared
+// INTEL_SHARED_SECRET. The signature covers the timestamp, a one-time nonce
+// and the body, so the intel service can reject stale or replayed requests.
+// The delivery header repeats the batch ID the body carries, signed with it.
+func signIntelRequest(r *http.Request, body []byte) {
+	secret := os.Getenv("INTEL_SHARED_SECRET")
+	if secret == "" {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := uuid.New().String()
+	signed := append([]byte(timestamp+"."+nonce+"."), body...)
+
+	r.Header.Set(intelTimestampHeader, timestamp)
+	r.Header.Set(intelNonceHeader, nonce)
+	r.Header.Set(events.SignatureHeader, "sha256="+events.Sign(secret, signed))
 }
@@ -0,0 +1,166 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/ctlog"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ctPollInterval returns how often ct_monitor jobs poll crt.sh, from
+// CT_POLL_INTERVAL (default 10m)
+func ctPollInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CT_POLL_INTERVAL")); err == nil && d >= time.Minute {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+// MonitorCertificates polls certificate transparency logs for the job's
+// domain patterns until the job is cancelled. Certificates already logged
+// when the job starts form the baseline; each certificate logged later
+// becomes a result and a CertificateIssued event, and hosts not seen before
+// are announced with a HostsDiscovered event.
+func (cs *CrawlerService) MonitorCertificates(job *models.CrawlJob, req models.CrawlRequest) error {
+	cs.mu.Lock()
+	job.Status = "running"
+	cs.mu.Unlock()
+
+	seenCerts := make(map[int64]bool)
+	seenHosts := make(map[string]bool)
+	baseline := true
+
+	ticker := time.NewTicker(ctPollInterval())
+	defer ticker.Stop()
+
+	for {
+		cs.mu.Lock()
+		cancelled := job.Status == "cancelled"
+		cs.mu.Unlock()
+		if cancelled {
+			return nil
+		}
+
+		for _, pattern := range req.DomainPatterns {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			cs.chargeAPICall(job, APICertificates)
+			certs, err := cs.ctlog.Search(ctx, pattern)
+			cancel()
+			if err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"job_id":  job.ID,
+					"pattern": pattern,
+				}).Warn("Certificate transparency search failed")
+				continue
+			}
+
+			var results []models.CrawlResult
+			var newHosts []string
+			for _, cert := range certs {
+				if seenCerts[cert.ID] {
+					continue
+				}
+				seenCerts[cert.ID] = true
+
+				for _, host := range cert.Hosts() {
+					if !seenHosts[host] {
+						seenHosts[host] = true
+						newHosts = append(newHosts, host)
+					}
+				}
+				if baseline {
+					continue
+				}
+
+				result := certificateResult(cert)
+				result.Provenance = cs.provenance(job, models.RenderAPI)
+				results = append(results, result)
+				cs.events.Publish(events.Event{
+					Type:   events.CertificateIssued,
+					JobID:  job.ID,
+					Tenant: job.Tenant,
+					Data: map[string]interface{}{
+						"certificate_id": cert.ID,
+						"issuer":         cert.Issuer,
+						"names":          cert.Hosts(),
+						"not_before":     cert.NotBefore,
+					},
+				})
+			}
+
+			if baseline || len(results) == 0 {
+				continue
+			}
+
+			cs.mu.Lock()
+			job.Results = append(job.Results, results...)
+			numberResults(job, job.Results)
+			job.PagesCrawled = len(job.Results)
+			job.URLsFound = len(seenHosts)
+			cs.mu.Unlock()
+
+			go cs.deliverResults(job, results)
+
+			if len(newHosts) > 0 {
+				cs.events.Publish(events.Event{
+					Type:   events.HostsDiscovered,
+					JobID:  job.ID,
+					Tenant: job.Tenant,
+					Data: map[string]interface{}{
+						"hosts":     newHosts,
+						"pattern":   pattern,
+						"follow_up": req.FollowUpCrawl,
+						"max_pages": req.MaxPages,
+						"max_depth": req.MaxDepth,
+					},
+				})
+			}
+		}
+
+		if baseline {
+			baseline = false
+			cs.mu.Lock()
+			job.URLsFound = len(seenHosts)
+			cs.mu.Unlock()
+			log.WithFields(log.Fields{
+				"job_id":       job.ID,
+				"certificates": len(seenCerts),
+				"hosts":        len(seenHosts),
+			}).Info("Certificate transparency baseline recorded")
+		}
+
+		<-ticker.C
+	}
+}
+
+// certificateResult describes a newly logged certificate as a result
+func certificateResult(cert ctlog.Certificate) models.CrawlResult {
+	hosts := cert.Hosts()
+	links := make([]models.Link, 0, len(hosts))
+	for _, host := range hosts {
+		links = append(links, models.Link{URL: "https://" + host + "/", Text: host, External: true})
+	}
+
+	return models.CrawlResult{
+		URL:        fmt.Sprintf("https://crt.sh/?id=%d", cert.ID),
+		Title:      cert.CommonName,
+		Content:    strings.Join(hosts, "\n"),
+		Links:      links,
+		CrawledAt:  time.Now().UTC(),
+		StatusCode: 200,
+		Source:     models.SourceCT,
+		Fields: map[string]string{
+			"issuer":     cert.Issuer,
+			"serial":     cert.Serial,
+			"not_before": cert.NotBefore.Format(time.RFC3339),
+			"not_after":  cert.NotAfter.Format(time.RFC3339),
+			"logged_at":  cert.LoggedAt.Format(time.RFC3339),
+		},
+	}
+}
@@ -0,0 +1,611 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/browserprofile"
+	"definitelynotaspy/crawler-service/internal/cluster"
+	"definitelynotaspy/crawler-service/internal/compliance"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/pipeline"
+	"definitelynotaspy/crawler-service/internal/render"
+	"definitelynotaspy/crawler-service/internal/secrets"
+	"definitelynotaspy/crawler-service/internal/urlkey"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// clusterPollInterval is how often a coordinator reads the progress of
+	// its distributed crawls
+	clusterPollInterval = time.Second
+	// clusterTaskWait is how long a worker waits on the queue before
+	// checking whether it is stopping
+	clusterTaskWait = 5 * time.Second
+	// clusterHostDelay spaces a worker's requests to each host, like the
+	// collectors' per-domain delay
+	clusterHostDelay = 1 * time.Second
+	// clusterJobIdle is how long a worker keeps what it prepared for a job
+	// it has had no URL of
+	clusterJobIdle = 10 * time.Minute
+)
+
+// Cluster returns the cluster this instance takes part in, nil when it
+// crawls on its own
+func (cs *CrawlerService) Cluster() *cluster.Cluster {
+	return cs.cluster
+}
+
+// Distributed reports whether this instance hands the web crawls it
+// accepts to the cluster's workers
+func (cs *CrawlerService) Distributed() bool {
+	return cs.cluster != nil && cs.cluster.Role() == cluster.RoleCoordinator
+}
+
+// CrawlDistributed runs a web crawl on the cluster's workers: it queues the
+// seed URLs, then gathers the results the workers write back until the
+// last queued URL is done or the run is stopped. Workers follow links
+// within the job's limits, each URL once per job.
+func (cs *CrawlerService) CrawlDistributed(job *models.CrawlJob, req models.CrawlRequest) error {
+	cs.mu.Lock()
+	job.Status = "running"
+	cs.mu.Unlock()
+	cs.publishStatus(job, "running")
+
+	run := cs.register(job, req)
+	defer cs.unregister(run)
+
+	maxRuntime := jobMaxRuntime(req.MaxRuntimeSeconds)
+	killTimer := time.AfterFunc(time.Until(job.StartedAt.Add(maxRuntime)), func() {
+		log.WithField("job_id", job.ID).Warn("Job exceeded maximum runtime, stopping")
+		cs.stop(run, stopMaxRuntime)
+	})
+	defer killTimer.Stop()
+
+	if _, err := newLinkFilter(req); err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+	urlKeys, err := urlkey.New(req.QueryParams)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+
+	secretCtx, cancelSecrets := context.WithTimeout(context.Background(), 30*time.Second)
+	secretValues, err := cs.secrets.ResolveAll(secretCtx, req.Secrets)
+	cancelSecrets()
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.SecretUnavailable, err))
+	}
+	stopWebhooks := cs.startWebhooks(job, req, secretValues)
+	defer stopWebhooks()
+
+	seeds := req.SeedURLs
+	if len(seeds) == 0 {
+		if seeds, err = cs.seedURLs(run.ctx, job, req); err != nil {
+			return cs.failJob(job, nil, err)
+		}
+	}
+	seeds = append(seeds, req.WarmSeeds...)
+	seeds = append(seeds, cs.monitoredPages(job, req)...)
+
+	// Workers read the job as it was accepted; seeds and the URLs a
+	// continued crawl visited only travel as tasks and keys
+	cs.mu.Lock()
+	spec := cluster.Spec{Job: *job, Request: req, Seeds: seeds}
+	cs.mu.Unlock()
+	visited := make([]string, len(req.Visited))
+	for i, u := range req.Visited {
+		visited[i] = urlKeys.Key(u)
+	}
+	defer func() {
+		if err := cs.cluster.Close(job.ID); err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to remove distributed job")
+		}
+	}()
+	if err := cs.cluster.Open(spec, visited); err != nil {
+		return cs.failJob(job, nil, fmt.Errorf("failed to distribute job: %w", err))
+	}
+	queued := 0
+	var queueErr error
+	for _, seed := range seeds {
+		ok, err := cs.cluster.Enqueue(cluster.Task{JobID: job.ID, URL: seed, Depth: 1}, urlKeys.Key(seed))
+		if err != nil {
+			queueErr = err
+			continue
+		}
+		if ok {
+			queued++
+		}
+	}
+	if queued == 0 {
+		if queueErr == nil {
+			queueErr = errors.New("every seed URL was already visited")
+		}
+		return cs.failJob(job, nil, fmt.Errorf("no seed URL could be queued: %w", queueErr))
+	}
+
+	log.WithFields(log.Fields{
+		"job_id": job.ID,
+		"seeds":  queued,
+	}).Info("Distributed crawl started")
+
+	var results []models.CrawlResult
+	collect := func() {
+		fresh, err := cs.cluster.Results(job.ID, len(results))
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to read distributed results")
+			return
+		}
+		for _, result := range fresh {
+			results = append(results, result)
+			if !result.Soft404 && result.DuplicateOf == "" {
+				cs.publishPage(job, result)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(clusterPollInterval)
+	defer ticker.Stop()
+	var last cluster.Progress
+	for !last.Done && run.ctx.Err() == nil {
+		select {
+		case <-ticker.C:
+		case <-run.ctx.Done():
+			continue
+		}
+
+		progress, err := cs.cluster.Progress(job.ID)
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to read distributed progress")
+			continue
+		}
+		seen := len(results)
+		collect()
+		if progress != last || len(results) > seen {
+			cs.touch(run)
+		}
+		last = progress
+
+		cs.mu.Lock()
+		job.PagesCrawled = progress.Pages
+		job.URLsFound = progress.Found
+		cs.mu.Unlock()
+	}
+
+	// A stopped run keeps what the workers had written back and leaves the
+	// URLs still queued as its frontier
+	var frontier []string
+	if !last.Done {
+		if err := cs.cluster.Cancel(job.ID); err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to cancel distributed job")
+		}
+		if frontier, err = cs.cluster.Remaining(job.ID); err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to read distributed frontier")
+		}
+	}
+	collect()
+	counts, err := cs.cluster.ErrorCounts(job.ID)
+	if err != nil {
+		log.WithError(err).WithField("job_id", job.ID).Warn("Failed to read distributed error counts")
+	}
+
+	cs.mu.Lock()
+	if len(counts) > 0 && job.ErrorCounts == nil {
+		job.ErrorCounts = make(map[string]int)
+	}
+	for code, n := range counts {
+		job.ErrorCounts[code] += n
+	}
+	job.Frontier = cs.withoutDenied(frontier)
+	cs.mu.Unlock()
+
+	switch cs.stopReasonOf(run) {
+	case stopDeleted:
+		log.WithField("job_id", job.ID).Info("Deleted job stopped")
+		return nil
+	case stopCheckpoint:
+		return cs.cancelJob(job, results, errcode.Maintenance, fmt.Errorf("job checkpointed for maintenance; continue it to resume from its frontier"))
+	case stopCancelled:
+		return cs.cancelJob(job, results, errcode.Cancelled, fmt.Errorf("job cancelled by request"))
+	case stopStalled, stopRestart:
+		return cs.cancelJob(job, results, errcode.Stalled, fmt.Errorf("job stalled: no worker made progress within the watchdog period"))
+	case stopMaxRuntime:
+		cs.mu.Lock()
+		job.Partial = true
+		job.ErrorCode = errcode.MaxRuntimeExceeded
+		job.Error = fmt.Sprintf("maximum runtime of %s exceeded", maxRuntime)
+		cs.mu.Unlock()
+	}
+
+	cs.mu.Lock()
+	job.Status = "completed"
+	numberResults(job, results)
+	job.Results = results
+	job.CompletedAt = time.Now().UTC()
+	cs.mu.Unlock()
+	cs.publishFinished(job)
+
+	go func() {
+		cs.deliverResults(job, job.Results)
+		cs.offloadResults(job)
+	}()
+
+	log.WithFields(log.Fields{
+		"job_id":        job.ID,
+		"pages_crawled": job.PagesCrawled,
+	}).Info("Distributed crawl completed")
+
+	return nil
+}
+
+// clusterJob is what a worker prepared to crawl the URLs of a job
+type clusterJob struct {
+	follow     *linkFilter
+	urlKeys    *urlkey.Normalizer
+	processors []pipeline.ResultProcessor
+	profile    models.ComplianceProfile
+	transport  http.RoundTripper
+	// render is how the pages the worker renders for the job reach the web
+	render     render.Access
+	userAgent  string
+	browsers   *browserprofile.Rotation
+	secrets    map[string]string
+	redactions map[string]string
+	usedAt     time.Time
+}
+
+// clusterWorker crawls URLs taken from the cluster's queue
+type clusterWorker struct {
+	cs *CrawlerService
+
+	mu    sync.Mutex
+	jobs  map[string]*clusterJob
+	hosts map[string]time.Time
+}
+
+// RunWorker crawls URLs from the cluster's queue on CLUSTER_WORKERS
+// goroutines until ctx is done. A URL being fetched when ctx is done is
+// finished first; one still held for its host is put back.
+func (cs *CrawlerService) RunWorker(ctx context.Context) {
+	w := &clusterWorker{
+		cs:    cs,
+		jobs:  make(map[string]*clusterJob),
+		hosts: make(map[string]time.Time),
+	}
+	log.WithField("workers", cs.cluster.Workers()).Info("Cluster worker started")
+
+	var wg sync.WaitGroup
+	for i := 0; i < cs.cluster.Workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				task, err := cs.cluster.Next(ctx, clusterTaskWait)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.WithError(err).Warn("Failed to take a task from the cluster queue")
+						select {
+						case <-time.After(clusterTaskWait):
+						case <-ctx.Done():
+						}
+					}
+					continue
+				}
+				if task != nil {
+					w.crawl(ctx, *task)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	log.Info("Cluster worker stopped")
+}
+
+// crawl fetches the URL of a task, writing its result back and queueing
+// the links it finds
+func (w *clusterWorker) crawl(ctx context.Context, task cluster.Task) {
+	cs := w.cs
+	logger := log.WithFields(log.Fields{
+		"job_id": task.JobID,
+		"url":    task.URL,
+	})
+
+	spec, err := cs.cluster.Spec(task.JobID)
+	if errors.Is(err, cluster.ErrUnknownJob) {
+		// The job finished or was stopped; its leftover URLs are dropped
+		w.forget(task.JobID)
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read job spec, putting task back")
+		if err := cs.cluster.Requeue(task); err != nil {
+			logger.WithError(err).Error("Failed to put task back")
+		}
+		return
+	}
+
+	requeued := false
+	defer func() {
+		if requeued {
+			return
+		}
+		last, err := cs.cluster.Complete(task)
+		if err != nil {
+			logger.WithError(err).Error("Failed to complete task")
+		}
+		if last {
+			log.WithField("job_id", task.JobID).Info("Last URL of distributed crawl done")
+		}
+	}()
+
+	if cs.cluster.Cancelled(task.JobID) {
+		return
+	}
+	job := &spec.Job
+	req := spec.Request
+	prepared, err := w.prepare(spec)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to prepare distributed job")
+		cs.cluster.CountError(task.JobID, errcode.Classify(err, 0))
+		return
+	}
+	if progress, err := cs.cluster.Progress(task.JobID); err == nil && req.MaxPages > 0 && progress.Pages >= req.MaxPages {
+		return
+	}
+
+	u, err := url.Parse(task.URL)
+	if err != nil {
+		cs.cluster.CountError(task.JobID, errcode.InvalidRequest)
+		return
+	}
+	host := u.Hostname()
+	switch {
+	case cs.policies.Denied(host):
+		cs.cluster.CountError(task.JobID, errcode.PolicyDenied)
+		return
+	case compliance.Refuses(prepared.profile, u) != "":
+		cs.cluster.CountError(task.JobID, errcode.ComplianceDenied)
+		return
+	case cs.excludedCategory(host, req.ExcludeCategories) != "":
+		return
+	}
+	if err := w.hold(ctx, host); err != nil {
+		requeued = cs.cluster.Requeue(task) == nil
+		return
+	}
+
+	c := colly.NewCollector()
+	c.IgnoreRobotsTxt = !obeysRobots(prepared.profile, req)
+	c.AllowedDomains = req.AllowedDomains
+	c.UserAgent = prepared.userAgent
+	c.WithTransport(prepared.transport)
+	c.SetRequestTimeout(maxRequestTimeout)
+	if limit := documentMaxBytes(req) + 1; req.IncludeDocuments && limit > int64(c.MaxBodySize) {
+		c.MaxBodySize = int(limit)
+	}
+
+	c.OnRequest(func(r *colly.Request) {
+		if prepared.browsers != nil {
+			prepared.browsers.Apply(r.Headers)
+		}
+		if identifying(req.Identify) {
+			identify(r.Headers)
+		}
+		for name, value := range req.Headers {
+			r.Headers.Set(name, secrets.Interpolate(value, prepared.secrets))
+		}
+		applyDomainHeaders(req, prepared.secrets, r.URL.Hostname(), r.Headers)
+		if profile := cs.policies.Current().Profile(r.URL.Hostname()); profile != nil {
+			profile.Apply(r.Headers)
+		}
+		cs.conditional(job, req, r)
+		r.Ctx.Put(renderAccessKey, prepared.render)
+	})
+	c.OnResponse(markFetchTiming)
+	c.OnResponse(cs.convertDocuments(ctx, req, func(*colly.Response) {}))
+	c.OnResponse(normalizeEncoding)
+
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		if ok, err := cs.cluster.TakePage(task.JobID, req.MaxPages); err != nil || !ok {
+			return
+		}
+
+		var result models.CrawlResult
+		pctx := &pipeline.Context{Job: job, Request: &req, Element: e, DiscoveredFrom: task.From}
+		if err := pipeline.Run(prepared.processors, pctx, &result); err != nil {
+			cs.cluster.ReleasePage(task.JobID)
+			if !errors.Is(err, pipeline.ErrDrop) {
+				logger.WithError(err).Error("Result processing failed")
+			}
+			return
+		}
+		result.Provenance = cs.responseProvenance(job, e.Response)
+		result.Depth = task.Depth - 1
+		if result.Soft404 {
+			cs.cluster.ReleasePage(task.JobID)
+		}
+		if err := cs.cluster.AddResult(task.JobID, result); err != nil {
+			logger.WithError(err).Error("Failed to write result back")
+			return
+		}
+		logger.Info("Page crawled")
+
+		if req.MaxDepth > 0 && task.Depth >= req.MaxDepth {
+			return
+		}
+		for _, link := range result.Links {
+			if !w.follows(prepared, req, e.Request.URL, link.URL) {
+				continue
+			}
+			next := cluster.Task{JobID: task.JobID, URL: link.URL, From: task.URL, Depth: task.Depth + 1}
+			if _, err := cs.cluster.Enqueue(next, prepared.urlKeys.Key(link.URL)); err != nil {
+				logger.WithError(err).Warn("Failed to queue link")
+			}
+		}
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		if notModified(req, r) {
+			logger.Debug("Page not modified")
+			return
+		}
+		if r.StatusCode == http.StatusTooManyRequests {
+			cs.coolDown(r)
+		}
+		code := errcode.Classify(err, r.StatusCode)
+		err = redactError(err, prepared.redactions)
+		cs.cluster.CountError(task.JobID, code)
+		logger.WithError(err).WithField("error_code", code).Error("Crawl error")
+	})
+
+	if err := c.Visit(task.URL); err != nil && !errors.Is(err, colly.ErrAlreadyVisited) {
+		cs.cluster.CountError(task.JobID, errcode.Classify(err, 0))
+	}
+}
+
+// follows reports whether a link found on page is queued for the job
+func (w *clusterWorker) follows(prepared *clusterJob, req models.CrawlRequest, page *url.URL, link string) bool {
+	// Local files are only reachable from other local files
+	if strings.HasPrefix(link, "file:") && page.Scheme != "file" {
+		return false
+	}
+	if !prepared.follow.allows(link) {
+		return false
+	}
+	if len(req.AllowedDomains) == 0 {
+		return true
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	for _, domain := range req.AllowedDomains {
+		if strings.EqualFold(u.Hostname(), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// hold waits out a host's cool-down and crawl window, then this worker's
+// spacing of requests to it
+func (w *clusterWorker) hold(ctx context.Context, host string) error {
+	for left := w.cs.holdLeft(ctx, host); left > 0; left = w.cs.holdLeft(ctx, host) {
+		select {
+		case <-time.After(left):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	w.mu.Lock()
+	now := time.Now()
+	slot := w.hosts[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	w.hosts[host] = slot.Add(clusterHostDelay)
+	w.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(slot)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// prepare returns what the worker needs to crawl a job's URLs, set up on
+// the job's first URL
+func (w *clusterWorker) prepare(spec *cluster.Spec) (*clusterJob, error) {
+	cs := w.cs
+	id := spec.Job.ID
+
+	w.mu.Lock()
+	now := time.Now()
+	for other, prepared := range w.jobs {
+		if now.Sub(prepared.usedAt) > clusterJobIdle {
+			delete(w.jobs, other)
+		}
+	}
+	if prepared, ok := w.jobs[id]; ok {
+		prepared.usedAt = now
+		w.mu.Unlock()
+		return prepared, nil
+	}
+	w.mu.Unlock()
+
+	req := spec.Request
+	follow, err := newLinkFilter(req)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.InvalidRequest, err)
+	}
+	urlKeys, err := urlkey.New(req.QueryParams)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.InvalidRequest, err)
+	}
+	processors, err := cs.pipeline.Select(req.Processors)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.InvalidRequest, err)
+	}
+	secretCtx, cancelSecrets := context.WithTimeout(context.Background(), 30*time.Second)
+	secretValues, err := cs.secrets.ResolveAll(secretCtx, req.Secrets)
+	cancelSecrets()
+	if err != nil {
+		return nil, errcode.Wrap(errcode.SecretUnavailable, err)
+	}
+	profile := cs.jobCompliance(&spec.Job)
+	transport, err := cs.buildTransport(req, profile, secretValues)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.InvalidRequest, err)
+	}
+	var browsers *browserprofile.Rotation
+	if req.UserAgent == "" && !identifying(req.Identify) {
+		if browsers, err = cs.browsers.Select(req.BrowserProfiles); err != nil {
+			return nil, errcode.Wrap(errcode.InvalidRequest, err)
+		}
+	}
+
+	for _, seed := range spec.Seeds {
+		follow.addSeed(seed)
+	}
+
+	userAgent := resolveUserAgent(req.UserAgent)
+	var robots *crawlDelays
+	if obeysRobots(profile, req) {
+		robots = newCrawlDelays(transport, userAgent)
+	}
+
+	prepared := &clusterJob{
+		follow:     follow,
+		urlKeys:    urlKeys,
+		processors: processors,
+		profile:    profile,
+		transport:  transport,
+		render:     cs.renderAccess(req, profile, transport, secretValues, robots),
+		userAgent:  userAgent,
+		browsers:   browsers,
+		secrets:    secretValues,
+		redactions: credentialValues(req, secretValues),
+		usedAt:     now,
+	}
+	w.mu.Lock()
+	w.jobs[id] = prepared
+	w.mu.Unlock()
+	return prepared, nil
+}
+
+// forget drops what the worker prepared for a job that ended
+func (w *clusterWorker) forget(jobID string) {
+	w.mu.Lock()
+	delete(w.jobs, jobID)
+	w.mu.Unlock()
+}
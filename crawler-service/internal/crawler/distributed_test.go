@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/cluster"
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestDistributedCrawlHandsOffToWorker runs a coordinator and a worker
+// against the Redis at REDIS_HOST, as main builds them once Redis is up,
+// and checks the worker crawls the job the coordinator accepted
+func TestDistributedCrawlHandsOffToWorker(t *testing.T) {
+	if err := database.InitRedis(); err != nil {
+		t.Skipf("Redis unavailable: %v", err)
+	}
+	defer database.CloseRedis()
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><title>Home</title></head><body><p>Welcome</p><a href="/about">About</a></body></html>`)
+		case "/about":
+			fmt.Fprint(w, `<html><head><title>About</title></head><body><p>About us</p></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	t.Setenv("CRAWLER_ROLE", cluster.RoleCoordinator)
+	coordinator := NewCrawlerService()
+	if !coordinator.Distributed() {
+		t.Fatal("coordinator does not hand crawls to the cluster")
+	}
+	t.Setenv("CRAWLER_ROLE", cluster.RoleWorker)
+	worker := NewCrawlerService()
+	if nodes := worker.Cluster(); nodes == nil || nodes.Role() != cluster.RoleWorker {
+		t.Fatal("worker did not join the cluster")
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		worker.RunWorker(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		stop()
+		<-stopped
+	}()
+
+	seed := site.URL + "/"
+	job := &models.CrawlJob{
+		ID:        uuid.New().String(),
+		Type:      models.JobTypeCrawl,
+		Query:     seed,
+		Status:    "pending",
+		MaxPages:  5,
+		MaxDepth:  2,
+		StartedAt: time.Now().UTC(),
+	}
+	req := models.CrawlRequest{
+		Type:              models.JobTypeCrawl,
+		Query:             seed,
+		SeedURLs:          []string{seed},
+		MaxPages:          5,
+		MaxDepth:          2,
+		MaxRuntimeSeconds: 60,
+	}
+	if err := coordinator.CrawlDistributed(job, req); err != nil {
+		t.Fatalf("distributed crawl failed: %v", err)
+	}
+
+	if job.Status != "completed" {
+		t.Fatalf("job status = %q, want completed (error: %s)", job.Status, job.Error)
+	}
+	crawled := make(map[string]bool)
+	for _, result := range job.Results {
+		crawled[result.URL] = true
+	}
+	for _, want := range []string{seed, site.URL + "/about"} {
+		if !crawled[want] {
+			t.Errorf("worker did not crawl %s; results: %v", want, crawled)
+		}
+	}
+}
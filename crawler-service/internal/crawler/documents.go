@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/document"
+	"definitelynotaspy/crawler-service/internal/models"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Context keys holding the media type and size of a document as served,
+// before it was converted into a page
+const (
+	documentTypeKey = "document_type"
+	documentSizeKey = "document_size"
+)
+
+// documentTimeout bounds the conversion of one document
+const documentTimeout = time.Minute
+
+// documentMaxBytes returns the largest document a crawl takes: the
+// request's max_document_bytes, else DOCUMENT_MAX_BYTES, default 20MB
+func documentMaxBytes(req models.CrawlRequest) int64 {
+	if req.MaxDocumentBytes > 0 {
+		return req.MaxDocumentBytes
+	}
+	if n, err := strconv.ParseInt(os.Getenv("DOCUMENT_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return 20 << 20
+}
+
+// convertDocuments returns a response callback that turns the documents a
+// crawl reaches into HTML pages holding their text, so they go through the
+// result pipeline like any other page. Documents the crawl does not take,
+// because it does not include documents or they are too large or
+// unreadable, are passed to skipped.
+func (cs *CrawlerService) convertDocuments(ctx context.Context, req models.CrawlRequest, skipped func(r *colly.Response)) func(*colly.Response) {
+	maxBytes := documentMaxBytes(req)
+	return func(r *colly.Response) {
+		if r.Headers == nil || len(r.Body) == 0 {
+			return
+		}
+		mediaType := document.MediaType(r.Headers.Get("Content-Type"), r.Request.URL, r.Body)
+		if document.IsHTML(mediaType) || !cs.documents.Supports(mediaType) {
+			return
+		}
+		fields := log.Fields{
+			"url":          r.Request.URL.String(),
+			"content_type": mediaType,
+			"bytes":        len(r.Body),
+		}
+		switch {
+		case !req.IncludeDocuments:
+			skipped(r)
+			return
+		case int64(len(r.Body)) > maxBytes:
+			log.WithFields(fields).Info("Skipping document over the size limit")
+			skipped(r)
+			return
+		}
+
+		convertCtx, cancel := context.WithTimeout(ctx, documentTimeout)
+		defer cancel()
+		doc, err := cs.documents.Convert(convertCtx, mediaType, r.Body)
+		if err != nil {
+			log.WithError(err).WithFields(fields).Warn("Failed to read document")
+			skipped(r)
+			return
+		}
+		if doc.Title == "" {
+			doc.Title = documentName(r.Request.URL)
+		}
+
+		r.Ctx.Put(documentTypeKey, mediaType)
+		r.Ctx.Put(documentSizeKey, strconv.Itoa(len(r.Body)))
+		r.Body = documentPage(doc)
+		r.Headers.Set("Content-Type", "text/html; charset=utf-8")
+		log.WithFields(fields).Debug("Document converted")
+	}
+}
+
+// documentName returns the file name of a document's URL
+func documentName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	if name == "." || name == "/" {
+		return u.Hostname()
+	}
+	return name
+}
+
+// documentPage wraps a document's text in a page, a paragraph per block of
+// lines, in the main element content is extracted from
+func documentPage(doc document.Document) []byte {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>")
+	b.WriteString(html.EscapeString(doc.Title))
+	b.WriteString("</title></head><body><main>")
+	for _, block := range strings.Split(strings.ReplaceAll(doc.Text, "\r\n", "\n"), "\n\n") {
+		if block = strings.TrimSpace(block); block == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(block), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	b.WriteString("</main></body></html>")
+	return []byte(b.String())
+}
+
+// servedAs returns the media type and size of a response as served: those
+// of the document it was converted from, if any
+func servedAs(r *colly.Response) (string, int) {
+	if mediaType := r.Ctx.Get(documentTypeKey); mediaType != "" {
+		size, _ := strconv.Atoi(r.Ctx.Get(documentSizeKey))
+		return mediaType, size
+	}
+	var contentType string
+	if r.Headers != nil {
+		contentType = r.Headers.Get("Content-Type")
+	}
+	var u *url.URL
+	if r.Request != nil {
+		u = r.Request.URL
+	}
+	return document.MediaType(contentType, u, r.Body), len(r.Body)
+}
+
+// DocumentConverter returns the converter that reads documents crawls reach
+func (cs *CrawlerService) DocumentConverter() document.Converter {
+	return cs.documents
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/document"
+	"definitelynotaspy/crawler-service/internal/models"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// maxContentTypes is how many content types a domain's statistics list,
+// the most frequent first
+const maxContentTypes = 5
+
+// hostStats accumulates the requests a crawl made to one host
+type hostStats struct {
+	models.DomainStats
+	answered     int
+	responseTime time.Duration
+	contentTypes map[string]int
+}
+
+// domainStats aggregates a crawl's requests, responses and pages per host
+type domainStats struct {
+	mu    sync.Mutex
+	hosts map[string]*hostStats
+}
+
+func newDomainStats() *domainStats {
+	return &domainStats{hosts: make(map[string]*hostStats)}
+}
+
+func (d *domainStats) host(host string) *hostStats {
+	host = strings.ToLower(host)
+	h, ok := d.hosts[host]
+	if !ok {
+		h = &hostStats{
+			DomainStats:  models.DomainStats{StatusCodes: make(map[string]int)},
+			contentTypes: make(map[string]int),
+		}
+		d.hosts[host] = h
+	}
+	return h
+}
+
+// response records an answered request; code is the error code of a
+// request that failed, else empty
+func (d *domainStats) response(r *colly.Response, code string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h := d.host(r.Request.URL.Hostname())
+	h.Requests++
+	h.Bytes += int64(len(r.Body))
+	if r.StatusCode > 0 {
+		h.StatusCodes[strconv.Itoa(r.StatusCode)]++
+	}
+	if duration, ok := r.Ctx.GetAny(fetchDurationKey).(time.Duration); ok {
+		h.answered++
+		h.responseTime += duration
+	}
+	if code != "" {
+		h.Errors++
+		if h.ErrorCodes == nil {
+			h.ErrorCodes = make(map[string]int)
+		}
+		h.ErrorCodes[code]++
+		return
+	}
+	if r.Headers != nil && len(r.Body) > 0 {
+		if mediaType := document.MediaType(r.Headers.Get("Content-Type"), r.Request.URL, r.Body); mediaType != "" {
+			h.contentTypes[mediaType]++
+		}
+	}
+}
+
+// page records a page the crawl kept
+func (d *domainStats) page(pageURL string) {
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Hostname() == "" {
+		return
+	}
+	d.mu.Lock()
+	d.host(u.Hostname()).Pages++
+	d.mu.Unlock()
+}
+
+// report returns the statistics of every host
+func (d *domainStats) report() map[string]models.DomainStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.hosts) == 0 {
+		return nil
+	}
+	report := make(map[string]models.DomainStats, len(d.hosts))
+	for host, h := range d.hosts {
+		stats := h.DomainStats
+		if h.answered > 0 {
+			stats.AvgResponseMS = (h.responseTime / time.Duration(h.answered)).Milliseconds()
+		}
+		stats.ContentTypes = topContentTypes(h.contentTypes)
+		report[host] = stats
+	}
+	return report
+}
+
+// topContentTypes returns the most frequent content types, at most
+// maxContentTypes of them
+func topContentTypes(counts map[string]int) []models.ContentTypeCount {
+	if len(counts) == 0 {
+		return nil
+	}
+	types := make([]models.ContentTypeCount, 0, len(counts))
+	for t, n := range counts {
+		types = append(types, models.ContentTypeCount{ContentType: t, Responses: n})
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Responses != types[j].Responses {
+			return types[i].Responses > types[j].Responses
+		}
+		return types[i].ContentType < types[j].ContentType
+	})
+	if len(types) > maxContentTypes {
+		types = types[:maxContentTypes]
+	}
+	return types
+}
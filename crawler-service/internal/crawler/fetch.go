@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/render"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrRenderUnavailable is returned when a fetch asks for JS rendering or a
+// screenshot but no browser is configured
+var ErrRenderUnavailable = errors.New("JS rendering is not configured in this deployment")
+
+// defaultScrollInterval is how long a scrolled page is given to load more
+// content when the fetch does not say
+const defaultScrollInterval = time.Second
+
+// languageTag loosely matches BCP 47 language tags (en, de-DE, zh-Hant-TW)
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ValidateEmulation checks the device and locale settings of a render
+func ValidateEmulation(e *models.RenderEmulation) error {
+	if e == nil {
+		return nil
+	}
+	if e.ViewportWidth < 0 || e.ViewportWidth > 8192 || e.ViewportHeight < 0 || e.ViewportHeight > 8192 {
+		return errors.New("viewport_width and viewport_height must be 0-8192")
+	}
+	if e.DeviceScaleFactor < 0 || e.DeviceScaleFactor > 5 {
+		return errors.New("device_scale_factor must be 0-5")
+	}
+	if e.Timezone != "" {
+		if _, err := time.LoadLocation(e.Timezone); err != nil || e.Timezone == "Local" {
+			return fmt.Errorf("unknown timezone %q", e.Timezone)
+		}
+	}
+	if e.Language != "" && !languageTag.MatchString(e.Language) {
+		return fmt.Errorf("language %q is not a BCP 47 tag", e.Language)
+	}
+	return nil
+}
+
+// fetchPage returns how a fetch's page is loaded in the browser, and
+// whether the fetch asks for more than rendering shells
+func fetchPage(req models.FetchRequest) (render.Page, bool) {
+	page := render.Page{
+		CaptureNetwork: req.CaptureNetwork,
+		Scrolls:        req.ScrollCount,
+		ScrollInterval: defaultScrollInterval,
+		Emulation:      renderEmulation(req.Emulation),
+		Screenshot:     req.Screenshot,
+	}
+	if req.ScrollIntervalMS > 0 {
+		page.ScrollInterval = time.Duration(req.ScrollIntervalMS) * time.Millisecond
+	}
+	return page, len(page.CaptureNetwork) > 0 || page.Scrolls > 0 || page.Emulation != nil || req.CompareRender || page.Screenshot
+}
+
+// Fetch synchronously fetches a single URL and returns the extracted result
+// without creating a crawl job
+func (cs *CrawlerService) Fetch(req models.FetchRequest) (*models.CrawlResult, error) {
+	if (req.RenderJS || req.Screenshot) && !cs.RenderingEnabled() {
+		return nil, ErrRenderUnavailable
+	}
+
+	c := colly.NewCollector(colly.MaxDepth(1))
+	c.UserAgent = resolveUserAgent(req.UserAgent)
+	if identifying(false) {
+		c.OnRequest(func(r *colly.Request) { identify(r.Headers) })
+	}
+	transport := timedTransport{next: cs.newBaseTransport()}
+	c.WithTransport(transport)
+
+	timeout := 30 * time.Second
+	if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	c.SetRequestTimeout(timeout)
+
+	var result *models.CrawlResult
+	var fetchErr error
+	var rendered *render.Result
+	var renderErr error
+	var static []byte
+
+	c.OnResponse(markFetchTiming)
+	c.OnResponse(normalizeEncoding)
+	if req.CompareRender {
+		c.OnResponse(func(r *colly.Response) { static = r.Body })
+	}
+	if req.RenderJS || req.Screenshot {
+		page, loads := fetchPage(req)
+		// Waiting for a browser context is bounded by the fetch timeout,
+		// extended by the time scrolling may take
+		ctx, cancel := context.WithTimeout(context.Background(), timeout+time.Duration(page.Scrolls)*page.ScrollInterval)
+		defer cancel()
+		access := render.Access{Transport: transport}
+		if loads {
+			// Options of the rendered page need it rendered, shell or not.
+			// Without render_js a screenshot is taken but the static page
+			// is extracted.
+			page.Access = access
+			c.OnResponse(cs.renderFetch(ctx, page, req.RenderJS, func(r *render.Result, err error) {
+				rendered, renderErr = r, err
+			}))
+		} else {
+			c.OnResponse(cs.renderShells(ctx, render.Page{Access: access}, nil))
+		}
+	}
+
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		r := buildResult(e)
+		r.Provenance = cs.responseProvenance(nil, e.Response)
+		result = &r
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		fetchErr = err
+		if result == nil {
+			markFetchTiming(r)
+			result = &models.CrawlResult{
+				URL:        r.Request.URL.String(),
+				CrawledAt:  time.Now().UTC(),
+				StatusCode: r.StatusCode,
+				Error:      err.Error(),
+				ErrorCode:  errcode.Classify(err, r.StatusCode),
+				Provenance: cs.responseProvenance(nil, r),
+			}
+		}
+	})
+
+	if err := c.Visit(req.URL); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", req.URL, err)
+	}
+	if renderErr != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", req.URL, renderErr)
+	}
+
+	if result == nil {
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return nil, fmt.Errorf("no HTML content returned from %s", req.URL)
+	}
+
+	if rendered != nil {
+		for _, capture := range rendered.Network {
+			result.Network = append(result.Network, models.NetworkCapture{
+				URL:         capture.URL,
+				Method:      capture.Method,
+				StatusCode:  capture.StatusCode,
+				ContentType: capture.ContentType,
+				Body:        capture.Body,
+			})
+		}
+		if req.CompareRender {
+			result.RenderDiff = compareRender(static, rendered.DOM)
+		}
+		result.Screenshot = rendered.Screenshot
+	}
+
+	log.WithFields(log.Fields{
+		"url":    result.URL,
+		"status": result.StatusCode,
+	}).Info("Single URL fetched")
+
+	return result, nil
+}
@@ -0,0 +1,112 @@
+package crawler
+
+import (
+	"container/heap"
+	"definitelynotaspy/crawler-service/internal/models"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// maxLinkContext is how much of the text around a link a focused crawl
+// scores it on
+const maxLinkContext = 300
+
+// frontierLink is a link a crawl has queued but not visited
+type frontierLink struct {
+	url   string
+	from  *colly.Request
+	depth int
+	score float64
+	// seq is the order links were queued in
+	seq int
+}
+
+// frontier holds the links a crawl with a crawl strategy has queued and
+// hands them out in the strategy's order: shallowest, deepest or most
+// relevant first. Breadth first and equally relevant links go in the order
+// they were queued, shallowest first; depth first takes the latest first.
+type frontier struct {
+	mu       sync.Mutex
+	strategy string
+	links    []frontierLink
+	seq      int
+}
+
+func newFrontier(strategy string) *frontier {
+	return &frontier{strategy: strategy}
+}
+
+// push queues a link
+func (f *frontier) push(link frontierLink) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	link.seq = f.seq
+	heap.Push((*frontierHeap)(f), link)
+}
+
+// next takes up to n links, the first in the strategy's order first
+func (f *frontier) next(n int) []frontierLink {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var links []frontierLink
+	for len(links) < n && len(f.links) > 0 {
+		links = append(links, heap.Pop((*frontierHeap)(f)).(frontierLink))
+	}
+	return links
+}
+
+// drain takes every link left
+func (f *frontier) drain() []frontierLink {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	links := f.links
+	f.links = nil
+	return links
+}
+
+// linkContext returns the text of the element a link sits in, with its
+// whitespace collapsed, cut to maxLinkContext characters
+func linkContext(a *colly.HTMLElement) string {
+	text := []rune(strings.Join(strings.Fields(a.DOM.Parent().Text()), " "))
+	if len(text) > maxLinkContext {
+		text = text[:maxLinkContext]
+	}
+	return string(text)
+}
+
+// frontierHeap orders a frontier's links; callers hold its lock
+type frontierHeap frontier
+
+func (h *frontierHeap) Len() int { return len(h.links) }
+
+func (h *frontierHeap) Less(i, j int) bool {
+	a, b := h.links[i], h.links[j]
+	switch h.strategy {
+	case models.CrawlStrategyFocused:
+		if a.score != b.score {
+			return a.score > b.score
+		}
+	case models.CrawlStrategyDFS:
+		if a.depth != b.depth {
+			return a.depth > b.depth
+		}
+		return a.seq > b.seq
+	}
+	if a.depth != b.depth {
+		return a.depth < b.depth
+	}
+	return a.seq < b.seq
+}
+
+func (h *frontierHeap) Swap(i, j int) { h.links[i], h.links[j] = h.links[j], h.links[i] }
+
+func (h *frontierHeap) Push(x interface{}) { h.links = append(h.links, x.(frontierLink)) }
+
+func (h *frontierHeap) Pop() interface{} {
+	last := h.links[len(h.links)-1]
+	h.links = h.links[:len(h.links)-1]
+	return last
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// botName is the product token the crawler identifies itself by, and the
+// user agent robots.txt rules address it as
+const (
+	botName    = "DefinitelyNotASpy"
+	botVersion = "1.0"
+)
+
+// CrawlerInfoPath is where the public page describing the crawler is served
+const CrawlerInfoPath = "/.well-known/crawler-info"
+
+// crawlerInfoURL returns the absolute address of the crawler info page, or
+// "" without PUBLIC_BASE_URL
+func crawlerInfoURL() string {
+	base := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if base == "" {
+		return ""
+	}
+	return base + CrawlerInfoPath
+}
+
+// identifyingUserAgent names the crawler and, when the service's public
+// address is known, links to its info page
+func identifyingUserAgent() string {
+	ua := botName + "/" + botVersion
+	if info := crawlerInfoURL(); info != "" {
+		ua += " (+" + info + ")"
+	}
+	return ua
+}
+
+// identifying reports whether a job's requests identify the crawler: when
+// the job asks to, or every job does with CRAWLER_IDENTIFY=true
+func identifying(requested bool) bool {
+	if requested {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv("CRAWLER_IDENTIFY"))
+	return enabled
+}
+
+// identify adds the From header (RFC 9110), naming the operator's contact
+// address, to an identifying request
+func identify(headers *http.Header) {
+	if contact := os.Getenv("CRAWLER_CONTACT"); contact != "" {
+		headers.Set("From", contact)
+	}
+}
+
+// CrawlerInfo describes the crawler to the sites it visits: who operates
+// it, why, and how to keep it out
+func CrawlerInfo() models.CrawlerInfo {
+	info := models.CrawlerInfo{
+		Name:        botName,
+		UserAgent:   identifyingUserAgent(),
+		RobotsToken: botName,
+		Operator:    os.Getenv("CRAWLER_OPERATOR"),
+		Contact:     os.Getenv("CRAWLER_CONTACT"),
+		Purpose:     os.Getenv("CRAWLER_PURPOSE"),
+		InfoURL:     crawlerInfoURL(),
+		OptOut:      os.Getenv("CRAWLER_OPT_OUT"),
+	}
+	if info.OptOut == "" {
+		info.OptOut = fmt.Sprintf("Disallow the %s user agent in your robots.txt.", botName)
+		if info.Contact != "" {
+			info.OptOut += fmt.Sprintf(" To have a domain excluded permanently, write to %s; opted-out domains are never crawled again.", info.Contact)
+		}
+	}
+	return info
+}
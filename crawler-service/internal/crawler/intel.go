@@ -0,0 +1,548 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Results bound for the intel service wait in an outbox until it takes
+// them. In Redis, intelOutboxKey orders the queued batch IDs by when they
+// are next attempted, intelBatchesKey holds the batches, and each job's
+// delivery state is kept under intelDeliveryPrefix.
+const (
+	intelOutboxKey      = "intel:outbox"
+	intelBatchesKey     = "intel:outbox:batches"
+	intelDeliveryPrefix = "intel:delivery:"
+)
+
+const (
+	// intelDeliveryTTL is how long a job's delivery state is kept
+	intelDeliveryTTL = 30 * 24 * time.Hour
+	// intelRecentBatches is how many batches a delivery state lists
+	intelRecentBatches = 100
+	// intelMaxBackoff caps the wait between attempts at a batch
+	intelMaxBackoff = time.Hour
+	// intelPollInterval is how often the outbox is checked for due batches
+	intelPollInterval = time.Second
+	// intelSenders is how many batches are sent at once
+	intelSenders = 4
+)
+
+// intelConfig holds the settings of intel service delivery
+type intelConfig struct {
+	batchSize  int
+	batchBytes int
+	timeout    time.Duration
+	attempts   int
+	backoff    time.Duration
+}
+
+// intelConfigFromEnv reads INTEL_BATCH_SIZE (results per batch, default
+// 100), INTEL_BATCH_BYTES (default 5MB), INTEL_TIMEOUT (per attempt,
+// default 30s), INTEL_MAX_ATTEMPTS (default 10) and INTEL_RETRY_BACKOFF
+// (the first wait between attempts, doubling after each, default 10s)
+func intelConfigFromEnv() intelConfig {
+	cfg := intelConfig{
+		batchSize:  100,
+		batchBytes: 5 << 20,
+		timeout:    30 * time.Second,
+		attempts:   10,
+		backoff:    10 * time.Second,
+	}
+	if n, err := strconv.Atoi(os.Getenv("INTEL_BATCH_SIZE")); err == nil && n > 0 {
+		cfg.batchSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("INTEL_BATCH_BYTES")); err == nil && n > 0 {
+		cfg.batchBytes = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("INTEL_TIMEOUT")); err == nil && d > 0 {
+		cfg.timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("INTEL_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.attempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("INTEL_RETRY_BACKOFF")); err == nil && d > 0 {
+		cfg.backoff = d
+	}
+	return cfg
+}
+
+// intelBackoff returns the wait after a batch's attempt-th failed attempt
+func (cfg intelConfig) intelBackoff(attempt int) time.Duration {
+	wait := cfg.backoff
+	for i := 1; i < attempt && wait < intelMaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > intelMaxBackoff {
+		wait = intelMaxBackoff
+	}
+	return wait
+}
+
+// intelBatch is a batch of results queued for the intel service
+type intelBatch struct {
+	ID       string                     `json:"id"`
+	Request  models.IntelServiceRequest `json:"request"`
+	Bytes    int                        `json:"bytes"`
+	Attempts int                        `json:"attempts"`
+	QueuedAt time.Time                  `json:"queued_at"`
+}
+
+// intelOutbox keeps queued batches and delivery states in Redis, so batches
+// outlive the process, or in memory without it
+type intelOutbox struct {
+	mu sync.Mutex
+	// updating serialises changes to delivery states
+	updating   sync.Mutex
+	batches    map[string]intelBatch
+	due        map[string]time.Time
+	deliveries map[string]*models.IntelDelivery
+}
+
+func newIntelOutbox() *intelOutbox {
+	return &intelOutbox{
+		batches:    make(map[string]intelBatch),
+		due:        make(map[string]time.Time),
+		deliveries: make(map[string]*models.IntelDelivery),
+	}
+}
+
+// push queues a batch, or requeues it, to be attempted at at
+func (o *intelOutbox) push(b intelBatch, at time.Time) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		log.WithError(err).WithField("job_id", b.Request.JobID).Error("Failed to encode intel batch")
+		return
+	}
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, intelBatchesKey, b.ID, data)
+			pipe.ZAdd(ctx, intelOutboxKey, &redis.Z{Score: float64(at.UnixMilli()), Member: b.ID})
+			return nil
+		})
+		if err == nil {
+			return
+		}
+		log.WithError(err).WithField("job_id", b.Request.JobID).Warn("Failed to queue intel batch in Redis, keeping it locally")
+	}
+
+	o.mu.Lock()
+	o.batches[b.ID] = b
+	o.due[b.ID] = at
+	o.mu.Unlock()
+}
+
+// claim takes up to n batches that are due, pushing each back by lease so
+// that no one else attempts it meanwhile, and so that it is attempted again
+// should this process die before it is resolved
+func (o *intelOutbox) claim(now time.Time, lease time.Duration, n int) []intelBatch {
+	var claimed []intelBatch
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		ids, err := rdb.ZRangeByScore(ctx, intelOutboxKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(now.UnixMilli(), 10),
+			Count: int64(n),
+		}).Result()
+		if err != nil {
+			log.WithError(err).Warn("Failed to read the intel outbox from Redis")
+		}
+		for _, id := range ids {
+			// Whoever removes the ID holds the batch
+			if removed, err := rdb.ZRem(ctx, intelOutboxKey, id).Result(); err != nil || removed == 0 {
+				continue
+			}
+			data, err := rdb.HGet(ctx, intelBatchesKey, id).Bytes()
+			if err != nil {
+				continue
+			}
+			rdb.ZAdd(ctx, intelOutboxKey, &redis.Z{Score: float64(now.Add(lease).UnixMilli()), Member: id})
+
+			var b intelBatch
+			if err := json.Unmarshal(data, &b); err != nil {
+				log.WithError(err).WithField("batch_id", id).Warn("Discarding unreadable intel batch")
+				o.remove(id)
+				continue
+			}
+			claimed = append(claimed, b)
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for id, at := range o.due {
+		if len(claimed) >= n {
+			break
+		}
+		if at.After(now) {
+			continue
+		}
+		o.due[id] = now.Add(lease)
+		claimed = append(claimed, o.batches[id])
+	}
+	return claimed
+}
+
+// remove takes a batch out of the outbox
+func (o *intelOutbox) remove(id string) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRem(ctx, intelOutboxKey, id)
+			pipe.HDel(ctx, intelBatchesKey, id)
+			return nil
+		})
+	}
+	o.mu.Lock()
+	delete(o.batches, id)
+	delete(o.due, id)
+	o.mu.Unlock()
+}
+
+// requeueOrphans makes every batch held in Redis due again if it dropped out of the
+// queue, which happens when a process dies while claiming it
+func (o *intelOutbox) requeueOrphans() {
+	rdb := database.GetRedisClient()
+	if rdb == nil {
+		return
+	}
+	ctx := context.Background()
+	ids, err := rdb.HKeys(ctx, intelBatchesKey).Result()
+	if err != nil {
+		log.WithError(err).Warn("Failed to read the intel outbox from Redis")
+		return
+	}
+	now := float64(time.Now().UnixMilli())
+	for _, id := range ids {
+		rdb.ZAddNX(ctx, intelOutboxKey, &redis.Z{Score: now, Member: id})
+	}
+}
+
+// delivery returns a job's intel delivery state
+func (o *intelOutbox) delivery(jobID string) (*models.IntelDelivery, bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := rdb.Get(context.Background(), intelDeliveryPrefix+jobID).Bytes()
+		if err == nil {
+			var d models.IntelDelivery
+			if err := json.Unmarshal(data, &d); err == nil {
+				return &d, true
+			}
+		} else if err != redis.Nil {
+			log.WithError(err).WithField("job_id", jobID).Warn("Failed to read intel delivery from Redis, using local copy")
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	d, ok := o.deliveries[jobID]
+	if !ok {
+		return nil, false
+	}
+	copied := *d
+	copied.Recent = append([]models.IntelBatchDelivery(nil), d.Recent...)
+	return &copied, true
+}
+
+// updateDelivery applies update to a job's intel delivery state and saves it
+func (o *intelOutbox) updateDelivery(jobID string, update func(d *models.IntelDelivery)) {
+	o.updating.Lock()
+	defer o.updating.Unlock()
+
+	d, ok := o.delivery(jobID)
+	if !ok {
+		d = &models.IntelDelivery{}
+	}
+	update(d)
+	if len(d.Recent) > intelRecentBatches {
+		d.Recent = d.Recent[len(d.Recent)-intelRecentBatches:]
+	}
+	d.Status = intelStatus(d)
+	d.UpdatedAt = time.Now().UTC()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(d)
+		if err == nil {
+			err = rdb.Set(context.Background(), intelDeliveryPrefix+jobID, data, intelDeliveryTTL).Err()
+		}
+		if err == nil {
+			return
+		}
+		log.WithError(err).WithField("job_id", jobID).Warn("Failed to save intel delivery to Redis, keeping it locally")
+	}
+
+	o.mu.Lock()
+	o.deliveries[jobID] = d
+	o.mu.Unlock()
+}
+
+// intelStatus sums up a delivery state: pending or retrying while batches
+// wait in the outbox, then failed if any batch gave up, or delivered
+func intelStatus(d *models.IntelDelivery) string {
+	if d.Batches > d.BatchesDelivered+d.BatchesFailed {
+		for _, b := range d.Recent {
+			if b.Status == models.OutputRetrying {
+				return models.OutputRetrying
+			}
+		}
+		return models.OutputPending
+	}
+	if d.BatchesFailed > 0 {
+		return models.OutputFailed
+	}
+	return models.OutputDelivered
+}
+
+// splitIntel splits results into batches of at most size results and, but
+// for a single result larger than that, maxBytes of JSON
+func splitIntel(results []models.CrawlResult, size, maxBytes int) ([][]models.CrawlResult, []int, error) {
+	var batches [][]models.CrawlResult
+	var sizes []int
+	var batch []models.CrawlResult
+	n := 0
+	for _, result := range results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal result: %w", err)
+		}
+		if len(batch) > 0 && (len(batch) == size || n+len(data) > maxBytes) {
+			batches = append(batches, batch)
+			sizes = append(sizes, n)
+			batch, n = nil, 0
+		}
+		batch = append(batch, result)
+		n += len(data)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+		sizes = append(sizes, n)
+	}
+	return batches, sizes, nil
+}
+
+// queueIntel queues a batch of a job's results for the intel service,
+// split to fit INTEL_BATCH_SIZE and INTEL_BATCH_BYTES. It returns how many
+// results were queued.
+func (cs *CrawlerService) queueIntel(job *models.CrawlJob, results []models.CrawlResult) (int, error) {
+	if os.Getenv("PYTHON_SERVICE_URL") == "" {
+		log.Warn("PYTHON_SERVICE_URL not set, skipping intel service")
+		return 0, nil
+	}
+
+	// Duplicates of previously crawled content have already been processed,
+	// and soft 404s carry no content
+	forward := make([]models.CrawlResult, 0, len(results))
+	for _, result := range results {
+		if result.DuplicateOf == "" && !result.Soft404 {
+			forward = append(forward, result)
+		}
+	}
+	if len(forward) == 0 {
+		log.WithField("job_id", job.ID).Info("No new content to send to intel service")
+		return 0, nil
+	}
+
+	cfg := intelConfigFromEnv()
+	split, sizes, err := splitIntel(forward, cfg.batchSize, cfg.batchBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	batches := make([]intelBatch, len(split))
+	for i, results := range split {
+		id := uuid.New().String()
+		batches[i] = intelBatch{
+			ID: id,
+			Request: models.IntelServiceRequest{
+				JobID:   job.ID,
+				Tenant:  job.Tenant,
+				Results: results,
+				Partial: job.Partial,
+				BatchID: id,
+				Batch:   i + 1,
+				Batches: len(split),
+			},
+			Bytes:    sizes[i],
+			QueuedAt: now,
+		}
+		if job.Partial {
+			batches[i].Request.FailureReason = job.Error
+		}
+	}
+
+	// The state is recorded before the batches are queued so that an
+	// attempt never finds its batch missing from it
+	cs.intel.updateDelivery(job.ID, func(d *models.IntelDelivery) {
+		for _, b := range batches {
+			d.Batches++
+			d.Results += len(b.Request.Results)
+			d.Recent = append(d.Recent, models.IntelBatchDelivery{
+				ID:            b.ID,
+				Results:       len(b.Request.Results),
+				Bytes:         b.Bytes,
+				Status:        models.OutputPending,
+				QueuedAt:      now,
+				NextAttemptAt: &now,
+			})
+		}
+	})
+	for _, b := range batches {
+		cs.intel.push(b, now)
+	}
+
+	log.WithFields(log.Fields{
+		"job_id":  job.ID,
+		"results": len(forward),
+		"batches": len(batches),
+	}).Info("Queued results for intel service")
+	return len(forward), nil
+}
+
+// StartIntelDelivery sends the batches queued for the intel service until
+// ctx is done, retrying each with exponential backoff. Batches queued in
+// Redis by an instance that stopped are sent too.
+func (cs *CrawlerService) StartIntelDelivery(ctx context.Context) {
+	cfg := intelConfigFromEnv()
+	client := &http.Client{Timeout: cfg.timeout}
+	cs.intel.requeueOrphans()
+
+	log.WithFields(log.Fields{
+		"batch_size":   cfg.batchSize,
+		"timeout":      cfg.timeout.String(),
+		"max_attempts": cfg.attempts,
+	}).Info("Intel delivery started")
+
+	go func() {
+		ticker := time.NewTicker(intelPollInterval)
+		defer ticker.Stop()
+
+		senders := make(chan struct{}, intelSenders)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// A batch is held for longer than an attempt can take
+			for _, b := range cs.intel.claim(time.Now(), cfg.timeout+time.Minute, intelSenders-len(senders)) {
+				senders <- struct{}{}
+				go func(b intelBatch) {
+					defer func() { <-senders }()
+					cs.sendIntelBatch(client, cfg, b)
+				}(b)
+			}
+		}
+	}()
+}
+
+// sendIntelBatch makes one attempt at a batch, then takes it out of the
+// outbox, or requeues it when it has attempts left
+func (cs *CrawlerService) sendIntelBatch(client *http.Client, cfg intelConfig, b intelBatch) {
+	b.Attempts++
+	err := postIntel(client, b.Request)
+	now := time.Now().UTC()
+
+	fields := log.Fields{
+		"job_id":   b.Request.JobID,
+		"batch_id": b.ID,
+		"results":  len(b.Request.Results),
+		"attempts": b.Attempts,
+	}
+	status := models.OutputDelivered
+	var next *time.Time
+	switch {
+	case err == nil:
+		cs.intel.remove(b.ID)
+		log.WithFields(fields).Info("Sent to intel service")
+	case b.Attempts >= cfg.attempts:
+		intelFailures.Inc()
+		status = models.OutputFailed
+		cs.intel.remove(b.ID)
+		log.WithError(err).WithFields(fields).Error("Failed to send to intel service, giving up on batch")
+	default:
+		intelFailures.Inc()
+		status = models.OutputRetrying
+		at := now.Add(cfg.intelBackoff(b.Attempts))
+		next = &at
+		cs.intel.push(b, at)
+		log.WithError(err).WithFields(fields).Warn("Failed to send to intel service, will retry")
+	}
+
+	cs.intel.updateDelivery(b.Request.JobID, func(d *models.IntelDelivery) {
+		switch status {
+		case models.OutputDelivered:
+			d.BatchesDelivered++
+			d.ResultsDelivered += len(b.Request.Results)
+		case models.OutputFailed:
+			d.BatchesFailed++
+		}
+		for i := range d.Recent {
+			r := &d.Recent[i]
+			if r.ID != b.ID {
+				continue
+			}
+			r.Status = status
+			r.Attempts = b.Attempts
+			r.NextAttemptAt = next
+			r.Error = ""
+			if err != nil {
+				r.Error = err.Error()
+			}
+			if status == models.OutputDelivered {
+				r.DeliveredAt = &now
+			}
+		}
+	})
+}
+
+// postIntel posts a batch to the intel service
+func postIntel(client *http.Client, payload models.IntelServiceRequest) error {
+	intelURL := os.Getenv("PYTHON_SERVICE_URL")
+	if intelURL == "" {
+		return errors.New("PYTHON_SERVICE_URL is not configured")
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/v1/process", intelURL), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(intelDeliveryHeader, payload.BatchID)
+	signIntelRequest(httpReq, jsonData)
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("intel service returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// IntelDelivery returns the state of a job's deliveries to the intel
+// service, if any of its results were queued for it
+func (cs *CrawlerService) IntelDelivery(jobID string) (*models.IntelDelivery, bool) {
+	return cs.intel.delivery(jobID)
+}
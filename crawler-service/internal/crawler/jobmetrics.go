@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// JobMetrics is the summary of a finished job posted to METRICS_WEBHOOK_URL,
+// small enough for analytics pipelines tracking crawl SLOs to ingest every
+// job without fetching its results
+type JobMetrics struct {
+	JobID      string    `json:"job_id"`
+	Tenant     string    `json:"tenant"`
+	Type       string    `json:"type,omitempty"`
+	Status     string    `json:"status"`
+	ErrorCode  string    `json:"error_code,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// DurationSeconds is the time from start to finish, including restarts
+	DurationSeconds float64 `json:"duration_seconds"`
+	PagesCrawled    int     `json:"pages_crawled"`
+	PagesPerSecond  float64 `json:"pages_per_second"`
+	// Errors counts failed requests; ErrorRate is their share of all
+	// requests made
+	Errors      int            `json:"errors"`
+	ErrorRate   float64        `json:"error_rate"`
+	ErrorCounts map[string]int `json:"error_counts,omitempty"`
+	Bytes       int64          `json:"bytes"`
+	Restarts    int            `json:"restarts,omitempty"`
+	Budget      BudgetOutcome  `json:"budget"`
+}
+
+// BudgetOutcome reports which of a job's limits stopped it short
+type BudgetOutcome struct {
+	MaxPages int `json:"max_pages"`
+	MaxDepth int `json:"max_depth"`
+	// PagesExhausted is set when the crawl used its whole page budget
+	PagesExhausted bool   `json:"pages_exhausted"`
+	Partial        bool   `json:"partial"`
+	QuotaStatus    string `json:"quota_status,omitempty"`
+	// Skipped counts discovered URLs left unvisited per limit: budget,
+	// depth, quota or stopped
+	Skipped  map[string]int `json:"skipped,omitempty"`
+	Frontier int            `json:"frontier"`
+}
+
+// budgetGaps are the coverage gaps caused by a job's limits rather than by
+// policy or filters
+var budgetGaps = []string{gapBudget, gapDepth, gapQuota, gapStopped}
+
+// reportMetrics posts a finished job's metrics to METRICS_WEBHOOK_URL, if
+// set, signed with METRICS_WEBHOOK_SECRET
+func (cs *CrawlerService) reportMetrics(job *models.CrawlJob) {
+	endpoint := os.Getenv("METRICS_WEBHOOK_URL")
+	if endpoint == "" {
+		return
+	}
+
+	cs.mu.Lock()
+	metrics := jobMetrics(job)
+	cs.mu.Unlock()
+
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		log.WithError(err).WithField("job_id", job.ID).Error("Failed to encode job metrics")
+		return
+	}
+
+	go func() {
+		secret := os.Getenv("METRICS_WEBHOOK_SECRET")
+		backoff := outputBackoff
+		for attempt := 1; ; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := cs.postOutput(ctx, endpoint, "application/json", data, secret)
+			cancel()
+			if err == nil {
+				return
+			}
+			if attempt == outputAttempts {
+				log.WithError(err).WithFields(log.Fields{
+					"job_id":   job.ID,
+					"attempts": attempt,
+				}).Warn("Failed to post job metrics")
+				return
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}()
+}
+
+// jobMetrics summarises a finished job; the caller holds cs.mu
+func jobMetrics(job *models.CrawlJob) JobMetrics {
+	finished := job.CompletedAt
+	if finished.IsZero() {
+		finished = time.Now()
+	}
+	m := JobMetrics{
+		JobID:        job.ID,
+		Tenant:       job.Tenant,
+		Type:         job.Type,
+		Status:       job.Status,
+		ErrorCode:    job.ErrorCode,
+		StartedAt:    job.StartedAt,
+		FinishedAt:   finished,
+		PagesCrawled: job.PagesCrawled,
+		Bytes:        job.StorageBytes,
+		Restarts:     job.Restarts,
+		Budget: BudgetOutcome{
+			MaxPages:       job.MaxPages,
+			MaxDepth:       job.MaxDepth,
+			PagesExhausted: job.MaxPages > 0 && job.PagesCrawled >= job.MaxPages,
+			Partial:        job.Partial,
+			QuotaStatus:    job.QuotaStatus,
+			Frontier:       len(job.Frontier),
+		},
+	}
+
+	if !job.StartedAt.IsZero() {
+		m.DurationSeconds = finished.Sub(job.StartedAt).Seconds()
+	}
+	if m.DurationSeconds > 0 {
+		m.PagesPerSecond = float64(job.PagesCrawled) / m.DurationSeconds
+	}
+
+	if len(job.ErrorCounts) > 0 {
+		m.ErrorCounts = make(map[string]int, len(job.ErrorCounts))
+		for code, n := range job.ErrorCounts {
+			m.ErrorCounts[code] = n
+			m.Errors += n
+		}
+	}
+	if attempted := job.PagesCrawled + m.Errors; attempted > 0 {
+		m.ErrorRate = float64(m.Errors) / float64(attempted)
+	}
+
+	for _, coverage := range job.Coverage {
+		for _, gap := range budgetGaps {
+			if n := coverage.Skipped[gap]; n > 0 {
+				if m.Budget.Skipped == nil {
+					m.Budget.Skipped = make(map[string]int)
+				}
+				m.Budget.Skipped[gap] += n
+			}
+		}
+	}
+	return m
+}
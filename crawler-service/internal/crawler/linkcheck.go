@@ -0,0 +1,386 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/compliance"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/hostjar"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/secrets"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxLinkReferrers caps the referring pages kept per checked link
+	maxLinkReferrers = 10
+	// externalCheckWorkers bounds concurrent checks of external links
+	externalCheckWorkers = 4
+)
+
+// linkStatus is the outcome of checking one URL
+type linkStatus struct {
+	checked    bool
+	statusCode int
+	err        string
+	external   bool
+	referrers  []models.LinkReferrer
+}
+
+// broken reports whether the check failed
+func (s *linkStatus) broken() bool {
+	return s.checked && (s.err != "" || s.statusCode >= 400)
+}
+
+// linkChecker collects link statuses for a linkcheck crawl
+type linkChecker struct {
+	mu    sync.Mutex
+	links map[string]*linkStatus
+	pages int
+}
+
+// refer records that page links to target with the given anchor text and
+// reports whether target was new
+func (lc *linkChecker) refer(target, page, anchor string, external bool) bool {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	s, ok := lc.links[target]
+	if !ok {
+		s = &linkStatus{external: external}
+		lc.links[target] = s
+	}
+	if page != "" && len(s.referrers) < maxLinkReferrers {
+		s.referrers = append(s.referrers, models.LinkReferrer{Page: page, AnchorText: anchor})
+	}
+	return !ok
+}
+
+// record stores the result of checking target
+func (lc *linkChecker) record(target string, statusCode int, err error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	s, ok := lc.links[target]
+	if !ok {
+		s = &linkStatus{}
+		lc.links[target] = s
+	}
+	s.checked = true
+	s.statusCode = statusCode
+	if err != nil && statusCode < 400 {
+		s.err = err.Error()
+	}
+}
+
+// report returns the broken links, most referenced first
+func (lc *linkChecker) report() *models.LinkCheckReport {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	report := &models.LinkCheckReport{PagesCrawled: lc.pages, Broken: []models.BrokenLink{}}
+	for target, s := range lc.links {
+		if !s.checked {
+			continue
+		}
+		report.LinksChecked++
+		if s.broken() {
+			report.Broken = append(report.Broken, models.BrokenLink{
+				URL:        target,
+				StatusCode: s.statusCode,
+				Error:      s.err,
+				External:   s.external,
+				Referrers:  s.referrers,
+			})
+		}
+	}
+	sort.Slice(report.Broken, func(i, j int) bool {
+		a, b := report.Broken[i], report.Broken[j]
+		if len(a.Referrers) != len(b.Referrers) {
+			return len(a.Referrers) > len(b.Referrers)
+		}
+		return a.URL < b.URL
+	})
+	return report
+}
+
+// checkableLink resolves an href against its page, dropping the fragment,
+// and returns "" for links that cannot be checked (mailto:, javascript:)
+func checkableLink(e *colly.HTMLElement) string {
+	u, err := url.Parse(e.Request.AbsoluteURL(e.Attr("href")))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// sameSite reports whether host belongs to the site being checked, ignoring
+// a leading www.
+func sameSite(host, site string) bool {
+	return strings.TrimPrefix(strings.ToLower(host), "www.") == site
+}
+
+// CheckLinks crawls the site at the job's query URL, following internal
+// links up to the page and depth limits, and checks every internal and
+// external link found. Only the broken link report is kept; page content
+// is neither stored nor forwarded.
+func (cs *CrawlerService) CheckLinks(job *models.CrawlJob, req models.CrawlRequest) error {
+	cs.mu.Lock()
+	job.Status = "running"
+	cs.mu.Unlock()
+	cs.publishStatus(job, "running")
+
+	run := cs.register(job, req)
+	defer cs.unregister(run)
+
+	maxRuntime := jobMaxRuntime(req.MaxRuntimeSeconds)
+	killTimer := time.AfterFunc(time.Until(job.StartedAt.Add(maxRuntime)), func() {
+		log.WithField("job_id", job.ID).Warn("Job exceeded maximum runtime, stopping")
+		cs.stop(run, stopMaxRuntime)
+	})
+	defer killTimer.Stop()
+
+	start, err := url.Parse(req.Query)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+	site := strings.TrimPrefix(strings.ToLower(start.Hostname()), "www.")
+
+	secretCtx, cancelSecrets := context.WithTimeout(context.Background(), 30*time.Second)
+	secretValues, err := cs.secrets.ResolveAll(secretCtx, req.Secrets)
+	cancelSecrets()
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.SecretUnavailable, err))
+	}
+	profile := cs.jobCompliance(job)
+	transport, err := cs.buildTransport(req, profile, secretValues)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+	transport = cs.charged(job, transport)
+
+	stopWebhooks := cs.startWebhooks(job, req, secretValues)
+	defer stopWebhooks()
+
+	c := colly.NewCollector(
+		colly.MaxDepth(req.MaxDepth),
+		colly.Async(true),
+	)
+	c.UserAgent = resolveUserAgent(req.UserAgent)
+	c.IgnoreRobotsTxt = !obeysRobots(profile, req)
+	c.Limit(&colly.LimitRule{
+		DomainGlob:  "*",
+		Parallelism: 2,
+		Delay:       1 * time.Second,
+	})
+	c.SetRequestTimeout(30 * time.Second)
+	c.WithTransport(runTransport{next: transport, run: run})
+	c.SetCookieJar(hostjar.New(nil))
+	var delays *crawlDelays
+	if !c.IgnoreRobotsTxt {
+		delays = newCrawlDelays(transport, c.UserAgent)
+	}
+
+	checker := &linkChecker{links: make(map[string]*linkStatus)}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+
+	// External links are checked once each, but never crawled
+	externals := make(chan string, 1000)
+	var externalWG sync.WaitGroup
+	for i := 0; i < externalCheckWorkers; i++ {
+		externalWG.Add(1)
+		go func() {
+			defer externalWG.Done()
+			for target := range externals {
+				if run.ctx.Err() != nil {
+					continue
+				}
+				status, err := checkURL(run.ctx, client, c.UserAgent, target)
+				checker.record(target, status, err)
+			}
+		}()
+	}
+
+	queued := 0
+	var queuedMu sync.Mutex
+
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		if !sameSite(e.Request.URL.Hostname(), site) {
+			return
+		}
+		target := checkableLink(e)
+		if target == "" {
+			return
+		}
+		u, _ := url.Parse(target)
+		external := !sameSite(u.Hostname(), site)
+		if !checker.refer(target, e.Request.URL.String(), strings.TrimSpace(e.Text), external) {
+			return
+		}
+
+		if external {
+			select {
+			case externals <- target:
+			case <-run.ctx.Done():
+			}
+			return
+		}
+
+		queuedMu.Lock()
+		full := queued >= req.MaxPages
+		if !full {
+			queued++
+		}
+		queuedMu.Unlock()
+		if full {
+			return
+		}
+		if err := e.Request.Visit(target); err != nil {
+			// Links past the depth limit or disallowed by robots.txt are
+			// left unchecked
+			switch err {
+			case colly.ErrMaxDepth, colly.ErrAlreadyVisited:
+			case colly.ErrRobotsTxtBlocked:
+				cs.mu.Lock()
+				job.RobotsBlocked++
+				cs.mu.Unlock()
+			default:
+				checker.record(target, 0, err)
+			}
+		}
+	})
+
+	c.OnRequest(func(r *colly.Request) {
+		if run.ctx.Err() != nil || cs.policies.Denied(r.URL.Hostname()) || compliance.Refuses(profile, r.URL) != "" {
+			r.Abort()
+			return
+		}
+		if err := cs.waitCooldown(run, r.URL.Hostname()); err != nil {
+			r.Abort()
+			return
+		}
+		if delays != nil {
+			if err := delays.wait(cs, run, r.URL); err != nil {
+				r.Abort()
+				return
+			}
+		}
+		if identifying(req.Identify) {
+			identify(r.Headers)
+		}
+		for name, value := range req.Headers {
+			r.Headers.Set(name, secrets.Interpolate(value, secretValues))
+		}
+		applyDomainHeaders(req, secretValues, r.URL.Hostname(), r.Headers)
+		if profile := cs.policies.Current().Profile(r.URL.Hostname()); profile != nil {
+			profile.Apply(r.Headers)
+		}
+	})
+
+	c.OnResponse(func(r *colly.Response) {
+		checker.record(r.Request.URL.String(), r.StatusCode, nil)
+		checker.mu.Lock()
+		checker.pages++
+		checker.mu.Unlock()
+
+		cs.mu.Lock()
+		job.PagesCrawled++
+		cs.mu.Unlock()
+		cs.touch(run)
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		checker.record(r.Request.URL.String(), r.StatusCode, err)
+		if r.StatusCode == http.StatusTooManyRequests {
+			cs.coolDown(r)
+		}
+		cs.touch(run)
+	})
+
+	checker.refer(start.String(), "", "", false)
+	queued++
+	visitErr := c.Visit(start.String())
+
+	var results []models.CrawlResult
+	var resultsMu sync.Mutex
+	cs.waitCollector(c, run, &resultsMu, &results)
+	close(externals)
+	externalWG.Wait()
+
+	report := checker.report()
+	cs.mu.Lock()
+	job.LinkCheck = report
+	job.URLsFound = len(checker.links)
+	cs.mu.Unlock()
+
+	if visitErr != nil {
+		return cs.failJob(job, nil, fmt.Errorf("site could not be visited: %w", visitErr))
+	}
+
+	switch cs.stopReasonOf(run) {
+	case stopDeleted:
+		log.WithField("job_id", job.ID).Info("Deleted job stopped")
+		return nil
+	case stopCheckpoint:
+		return cs.cancelJob(job, nil, errcode.Maintenance, fmt.Errorf("job checkpointed for maintenance"))
+	case stopCancelled:
+		return cs.cancelJob(job, nil, errcode.Cancelled, fmt.Errorf("job cancelled by request"))
+	case stopStalled, stopRestart:
+		return cs.cancelJob(job, nil, errcode.Stalled, fmt.Errorf("job stalled: no link checked within the watchdog period"))
+	case stopMaxRuntime:
+		cs.mu.Lock()
+		job.Partial = true
+		job.ErrorCode = errcode.MaxRuntimeExceeded
+		job.Error = fmt.Sprintf("maximum runtime of %s exceeded", maxRuntime)
+		cs.mu.Unlock()
+	}
+
+	cs.mu.Lock()
+	job.Status = "completed"
+	job.CompletedAt = time.Now().UTC()
+	cs.mu.Unlock()
+	cs.publishFinished(job)
+
+	log.WithFields(log.Fields{
+		"job_id":        job.ID,
+		"pages_crawled": report.PagesCrawled,
+		"links_checked": report.LinksChecked,
+		"broken_links":  len(report.Broken),
+	}).Info("Link check completed")
+
+	return nil
+}
+
+// checkURL requests a URL with HEAD, falling back to GET for servers that
+// do not support HEAD, and returns the final status code
+func checkURL(ctx context.Context, client *http.Client, userAgent, target string) (int, error) {
+	status, err := requestStatus(ctx, client, http.MethodHead, userAgent, target)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented || status == http.StatusForbidden) {
+		status, err = requestStatus(ctx, client, http.MethodGet, userAgent, target)
+	}
+	return status, err
+}
+
+func requestStatus(ctx context.Context, client *http.Client, method, userAgent, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
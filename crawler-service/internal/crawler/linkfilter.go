@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// linkFilter decides which discovered links a crawl follows: links must
+// match an include pattern, when there are any, and no exclude pattern and,
+// with same_domain_only, stay on the hosts the crawl started from
+type linkFilter struct {
+	include    []*regexp.Regexp
+	exclude    []*regexp.Regexp
+	sameDomain bool
+	seedHosts  map[string]bool
+}
+
+// compilePattern compiles a link pattern. A pattern between slashes
+// (/\.pdf$/) is a regular expression searched for in the URL; any other
+// is a glob the whole URL must match, where * matches any run of
+// characters and ? any one character.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid link pattern %q: %w", pattern, err)
+		}
+		return re, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("link patterns must not be empty")
+		}
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// ValidateLinkPatterns reports whether a request's include and exclude
+// patterns compile
+func ValidateLinkPatterns(req models.CrawlRequest) error {
+	_, err := newLinkFilter(req)
+	return err
+}
+
+func newLinkFilter(req models.CrawlRequest) (*linkFilter, error) {
+	include, err := compilePatterns(req.IncludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(req.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &linkFilter{
+		include:    include,
+		exclude:    exclude,
+		sameDomain: req.SameDomainOnly,
+		seedHosts:  make(map[string]bool),
+	}, nil
+}
+
+// addSeed records a host the crawl starts from. Seeds must be added before
+// the crawl starts, as the set is read without locking.
+func (f *linkFilter) addSeed(seed string) {
+	if u, err := url.Parse(seed); err == nil && u.Hostname() != "" {
+		f.seedHosts[siteHost(u.Hostname())] = true
+	}
+}
+
+// allows reports whether a discovered link is followed
+func (f *linkFilter) allows(link string) bool {
+	if f.sameDomain {
+		u, err := url.Parse(link)
+		if err != nil || (u.Hostname() != "" && !f.seedHosts[siteHost(u.Hostname())]) {
+			return false
+		}
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(link) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// siteHost normalises a host for same-domain checks, so example.com and
+// www.example.com count as one site
+func siteHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
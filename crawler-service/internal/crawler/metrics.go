@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/metrics"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsCrawled = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_requests_total",
+		Help: "Requests crawled, successful or not, by domain.",
+	}, []string{"domain"})
+	requestErrors = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_request_errors_total",
+		Help: "Requests that failed, by domain and error code.",
+	}, []string{"domain", "error_code"})
+	bytesDownloaded = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_downloaded_bytes_total",
+		Help: "Response body bytes downloaded, by domain.",
+	}, []string{"domain"})
+	responseLatency = promauto.With(metrics.Registry).NewHistogram(prometheus.HistogramOpts{
+		Name:    "crawler_response_duration_seconds",
+		Help:    "Round-trip time of successful responses.",
+		Buckets: prometheus.DefBuckets,
+	})
+	intelFailures = promauto.With(metrics.Registry).NewCounter(prometheus.CounterOpts{
+		Name: "crawler_intel_delivery_failures_total",
+		Help: "Failed attempts to send results to the intel service.",
+	})
+)
+
+// observeResponse counts a successful response; it runs after
+// markFetchTiming has put the round-trip time in its context
+func observeResponse(r *colly.Response) {
+	domain := metrics.Domain(r.Request.URL.Hostname())
+	requestsCrawled.WithLabelValues(domain).Inc()
+	bytesDownloaded.WithLabelValues(domain).Add(float64(len(r.Body)))
+	if d, ok := r.Ctx.GetAny(fetchDurationKey).(time.Duration); ok {
+		responseLatency.Observe(d.Seconds())
+	}
+}
+
+// observeError counts a failed request under its error code
+func observeError(r *colly.Response, code string) {
+	domain := metrics.Domain(r.Request.URL.Hostname())
+	requestsCrawled.WithLabelValues(domain).Inc()
+	requestErrors.WithLabelValues(domain, code).Inc()
+	bytesDownloaded.WithLabelValues(domain).Add(float64(len(r.Body)))
+}
@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// numberResults gives each of a job's results without a sequence number the
+// next one. Callers hold cs.mu.
+func numberResults(job *models.CrawlJob, results []models.CrawlResult) {
+	for i := range results {
+		if results[i].Seq == 0 {
+			job.ResultSeq++
+			results[i].Seq = job.ResultSeq
+		}
+	}
+}
+
+// offloadThreshold returns the stored size above which completed job results
+// are moved to object storage
+func offloadThreshold() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("RESULT_OFFLOAD_THRESHOLD_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 5 << 20
+}
+
+// resultURLTTL returns how long presigned result URLs stay valid
+func resultURLTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("RESULT_URL_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 15 * time.Minute
+}
+
+// offloadResults moves the results of a large completed job to object
+// storage, keeping only a reference on the job
+func (cs *CrawlerService) offloadResults(job *models.CrawlJob) error {
+	if cs.s3 == nil || job.StorageBytes < offloadThreshold() {
+		return nil
+	}
+
+	cs.mu.Lock()
+	results := job.Results
+	cs.mu.Unlock()
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	key := resultsKey(job)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if err := cs.s3.Put(ctx, key, "application/json", data); err != nil {
+		log.WithError(err).WithField("job_id", job.ID).Error("Failed to offload results")
+		return err
+	}
+
+	cs.mu.Lock()
+	job.ResultsRef = cs.s3.URI(key)
+	job.Results = nil
+	cs.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"job_id": job.ID,
+		"ref":    job.ResultsRef,
+		"bytes":  len(data),
+	}).Info("Results offloaded to object storage")
+
+	return nil
+}
+
+// resultsKey returns the object key a job's results are offloaded to
+func resultsKey(job *models.CrawlJob) string {
+	return fmt.Sprintf("results/%s/%s.json", job.Tenant, job.ID)
+}
+
+// offloadedKey returns the object key of a job's offloaded results,
+// refusing a results reference to anything but the job's own object
+func (cs *CrawlerService) offloadedKey(job *models.CrawlJob) (string, error) {
+	if cs.s3 == nil {
+		return "", fmt.Errorf("object storage is not configured")
+	}
+	key := resultsKey(job)
+	if job.ResultsRef != cs.s3.URI(key) {
+		return "", fmt.Errorf("results reference %q does not belong to job %s", job.ResultsRef, job.ID)
+	}
+	return key, nil
+}
+
+// JobResults returns the full results of a job, downloading them from object
+// storage when they have been offloaded and reading them from the result
+// store for jobs loaded from persistent storage
+func (cs *CrawlerService) JobResults(job *models.CrawlJob) ([]models.CrawlResult, error) {
+	if job.ResultsRef == "" {
+		if len(job.Results) > 0 || cs.results == nil {
+			return job.Results, nil
+		}
+		results, err := cs.results.LoadResults(job.ID)
+		if errors.Is(err, store.ErrNoResults) {
+			return nil, nil
+		}
+		return results, err
+	}
+	key, err := cs.offloadedKey(job)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	data, err := cs.s3.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.CrawlResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode offloaded results: %w", err)
+	}
+	return results, nil
+}
+
+// ResultsDownloadURL returns a presigned URL for offloaded job results and
+// its expiry time
+func (cs *CrawlerService) ResultsDownloadURL(job *models.CrawlJob) (string, time.Time, error) {
+	key, err := cs.offloadedKey(job)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	ttl := resultURLTTL()
+	url := cs.s3.PresignGet(key, ttl)
+	return url, time.Now().UTC().Add(ttl), nil
+}
@@ -0,0 +1,311 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Output kinds a job may deliver its results to
+const (
+	OutputIntel   = "intel"
+	OutputS3      = "s3"
+	OutputKafka   = "kafka"
+	OutputWebhook = "webhook"
+)
+
+const (
+	outputAttempts = 5
+	outputBackoff  = 2 * time.Second
+)
+
+// output is a parsed output declaration
+type output struct {
+	kind   string
+	target string // s3: bucket/prefix, kafka: topic, webhook: URL
+}
+
+// OutputBatch is the body delivered to s3 and webhook outputs
+type OutputBatch struct {
+	JobID   string               `json:"job_id"`
+	Tenant  string               `json:"tenant,omitempty"`
+	Status  string               `json:"status"`
+	Partial bool                 `json:"partial,omitempty"`
+	Results []models.CrawlResult `json:"results"`
+	SentAt  time.Time            `json:"sent_at"`
+}
+
+// parseOutput parses an output declaration: intel, s3://bucket/prefix,
+// kafka:topic or webhook:url
+func parseOutput(spec string) (output, error) {
+	switch {
+	case spec == OutputIntel:
+		return output{kind: OutputIntel}, nil
+	case strings.HasPrefix(spec, "s3://"):
+		target := strings.Trim(strings.TrimPrefix(spec, "s3://"), "/")
+		if target == "" || strings.HasPrefix(target, "/") {
+			return output{}, fmt.Errorf("s3 output %q needs a bucket", spec)
+		}
+		return output{kind: OutputS3, target: target}, nil
+	case strings.HasPrefix(spec, "kafka:"):
+		topic := strings.TrimPrefix(spec, "kafka:")
+		if topic == "" || strings.ContainsAny(topic, "/ ") {
+			return output{}, fmt.Errorf("kafka output %q needs a topic name", spec)
+		}
+		return output{kind: OutputKafka, target: topic}, nil
+	case strings.HasPrefix(spec, "webhook:"):
+		target := strings.TrimPrefix(spec, "webhook:")
+		if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return output{}, fmt.Errorf("webhook output %q needs an http or https url", spec)
+		}
+		return output{kind: OutputWebhook, target: target}, nil
+	}
+	return output{}, fmt.Errorf("unknown output %q", spec)
+}
+
+// ValidateOutput checks that an output declaration is well formed and that
+// the service is configured to deliver to it
+func (cs *CrawlerService) ValidateOutput(spec string) error {
+	out, err := parseOutput(spec)
+	if err != nil {
+		return err
+	}
+	switch out.kind {
+	case OutputIntel:
+		if os.Getenv("PYTHON_SERVICE_URL") == "" {
+			return errors.New("intel outputs need PYTHON_SERVICE_URL to be configured")
+		}
+	case OutputS3:
+		if cs.s3 == nil {
+			return errors.New("s3 outputs need object storage to be configured")
+		}
+	case OutputKafka:
+		if os.Getenv("KAFKA_REST_URL") == "" {
+			return errors.New("kafka outputs need KAFKA_REST_URL to be configured")
+		}
+	}
+	return nil
+}
+
+// deliverResults hands a batch of a job's results to each of its outputs.
+// Every output is delivered to concurrently and retried on its own, so an
+// unavailable consumer delays only its own delivery. It returns once every
+// output has succeeded or given up.
+func (cs *CrawlerService) deliverResults(job *models.CrawlJob, results []models.CrawlResult) {
+	cs.mu.Lock()
+	var specs []string
+	if job.Options != nil {
+		specs = job.Options.Outputs
+	}
+	if len(specs) > 0 && len(job.Outputs) == 0 {
+		job.Outputs = make([]models.OutputDelivery, len(specs))
+		for i, spec := range specs {
+			job.Outputs[i] = models.OutputDelivery{Output: spec, Status: models.OutputPending}
+		}
+	}
+	cs.mu.Unlock()
+
+	// Jobs that declare no outputs go to the intel service
+	if len(specs) == 0 {
+		if _, err := cs.queueIntel(job, results); err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Error("Failed to queue results for intel service")
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		out, err := parseOutput(spec)
+		if err != nil {
+			cs.recordDelivery(job, i, models.OutputFailed, 0, err)
+			continue
+		}
+		// The intel outbox retries its batches itself
+		if out.kind == OutputIntel {
+			queued, err := cs.queueIntel(job, results)
+			status := models.OutputQueued
+			if err != nil {
+				status = models.OutputFailed
+			}
+			cs.recordDelivery(job, i, status, queued, err)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, out output) {
+			defer wg.Done()
+			cs.deliverWithRetry(job, i, out, results)
+		}(i, out)
+	}
+	wg.Wait()
+}
+
+// deliverWithRetry delivers to one output, backing off exponentially
+// between attempts
+func (cs *CrawlerService) deliverWithRetry(job *models.CrawlJob, index int, out output, results []models.CrawlResult) {
+	backoff := outputBackoff
+	for attempt := 1; ; attempt++ {
+		err := cs.deliver(job, out, results)
+		switch {
+		case err == nil:
+			cs.recordDelivery(job, index, models.OutputDelivered, len(results), nil)
+			return
+		case attempt == outputAttempts:
+			cs.recordDelivery(job, index, models.OutputFailed, 0, err)
+			log.WithError(err).WithFields(log.Fields{
+				"job_id":   job.ID,
+				"output":   out.kind,
+				"attempts": attempt,
+			}).Error("Failed to deliver results to output")
+			return
+		}
+		cs.recordDelivery(job, index, models.OutputRetrying, 0, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// recordDelivery updates the delivery state of one of a job's outputs after
+// an attempt; err is nil when the attempt succeeded
+func (cs *CrawlerService) recordDelivery(job *models.CrawlJob, index int, status string, delivered int, err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if index >= len(job.Outputs) {
+		return
+	}
+	d := &job.Outputs[index]
+	d.Status = status
+	d.Attempts++
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	d.Error = ""
+	d.Results += delivered
+	if status == models.OutputDelivered {
+		now := time.Now().UTC()
+		d.DeliveredAt = &now
+	}
+}
+
+// deliver makes one attempt to hand results to an output
+func (cs *CrawlerService) deliver(job *models.CrawlJob, out output, results []models.CrawlResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	cs.mu.Lock()
+	batch := OutputBatch{
+		JobID:   job.ID,
+		Tenant:  job.Tenant,
+		Status:  job.Status,
+		Partial: job.Partial,
+		Results: results,
+		SentAt:  time.Now().UTC(),
+	}
+	cs.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch out.kind {
+	case OutputS3:
+		return cs.deliverS3(ctx, out.target, batch)
+	case OutputKafka:
+		return cs.deliverKafka(ctx, out.target, batch)
+	case OutputWebhook:
+		return cs.deliverWebhook(ctx, out.target, batch)
+	}
+	return fmt.Errorf("unknown output %q", out.kind)
+}
+
+// deliverS3 writes a batch to bucket/prefix/<job>/<time>.json
+func (cs *CrawlerService) deliverS3(ctx context.Context, target string, batch OutputBatch) error {
+	if cs.s3 == nil {
+		return errors.New("object storage is not configured")
+	}
+	bucket, prefix, _ := strings.Cut(target, "/")
+	key := fmt.Sprintf("%s/%d.json", batch.JobID, batch.SentAt.UnixNano())
+	if prefix != "" {
+		key = prefix + "/" + key
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+	return cs.s3.WithBucket(bucket).Put(ctx, key, "application/json", data)
+}
+
+// deliverKafka produces one record per result, keyed by job ID, through the
+// Kafka REST proxy at KAFKA_REST_URL
+func (cs *CrawlerService) deliverKafka(ctx context.Context, topic string, batch OutputBatch) error {
+	proxy := os.Getenv("KAFKA_REST_URL")
+	if proxy == "" {
+		return errors.New("KAFKA_REST_URL is not configured")
+	}
+
+	type record struct {
+		Key   string      `json:"key"`
+		Value interface{} `json:"value"`
+	}
+	records := make([]record, len(batch.Results))
+	for i, result := range batch.Results {
+		records[i] = record{Key: batch.JobID, Value: map[string]interface{}{
+			"job_id": batch.JobID,
+			"tenant": batch.Tenant,
+			"result": result,
+		}}
+	}
+	data, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return fmt.Errorf("failed to marshal records: %w", err)
+	}
+
+	endpoint := strings.TrimSuffix(proxy, "/") + "/topics/" + url.PathEscape(topic)
+	return cs.postOutput(ctx, endpoint, "application/vnd.kafka.json.v2+json", data, "")
+}
+
+// deliverWebhook posts a batch to a URL, signed with OUTPUT_WEBHOOK_SECRET
+// when it is set
+func (cs *CrawlerService) deliverWebhook(ctx context.Context, target string, batch OutputBatch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+	return cs.postOutput(ctx, target, "application/json", data, os.Getenv("OUTPUT_WEBHOOK_SECRET"))
+}
+
+// postOutput posts a delivery through the policy-guarded delivery client,
+// so outputs cannot reach hosts or networks crawls may not; any non-2xx
+// response fails the attempt
+func (cs *CrawlerService) postOutput(ctx context.Context, endpoint, contentType string, body []byte, secret string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if secret != "" {
+		req.Header.Set(events.SignatureHeader, "sha256="+events.Sign(secret, body))
+	}
+
+	resp, err := cs.delivery.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("output returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/changescore"
+	"definitelynotaspy/crawler-service/internal/dedup"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxMonitoredPageBytes caps how much of a monitored page is read
+const maxMonitoredPageBytes = 10 << 20
+
+// Section changes reported by page_monitor jobs
+const (
+	sectionChanged  = "changed"
+	sectionAppeared = "appeared"
+	sectionRemoved  = "removed"
+)
+
+// ValidateSelector reports whether sel is a valid CSS selector
+func ValidateSelector(sel string) error {
+	if _, err := cascadia.Compile(sel); err != nil {
+		return fmt.Errorf("invalid watch_selector: %w", err)
+	}
+	return nil
+}
+
+// pageMonitorInterval returns how often a page_monitor job polls: the
+// request's interval, else PAGE_MONITOR_INTERVAL (default 1h), never less
+// than a minute
+func pageMonitorInterval(req models.CrawlRequest) time.Duration {
+	d := time.Duration(req.MonitorIntervalSeconds) * time.Second
+	if d <= 0 {
+		d, _ = time.ParseDuration(os.Getenv("PAGE_MONITOR_INTERVAL"))
+	}
+	if d <= 0 {
+		return time.Hour
+	}
+	if d < time.Minute {
+		return time.Minute
+	}
+	return d
+}
+
+// pageMonitorMinScore returns the change significance below which a
+// page_monitor job records a change without alerting: the request's
+// threshold, else PAGE_MONITOR_MIN_SCORE (default 0.1)
+func pageMonitorMinScore(req models.CrawlRequest) float64 {
+	if req.MinChangeScore > 0 {
+		return req.MinChangeScore
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("PAGE_MONITOR_MIN_SCORE"), 64); err == nil && v >= 0 {
+		return v
+	}
+	return 0.1
+}
+
+// watchedSection is the state of the monitored section of a page
+type watchedSection struct {
+	title string
+	text  string
+	links []string
+	hash  string // empty when the selector matched nothing
+}
+
+// snapshot returns the section in the form change scoring compares
+func (s *watchedSection) snapshot() changescore.Snapshot {
+	return changescore.Snapshot{Text: s.text, Links: s.links}
+}
+
+// MonitorPage polls the job's URL until the job is cancelled, hashing only
+// the inner HTML of the elements matching the watch selector. The first
+// poll records the baseline; afterwards a result is produced whenever the
+// section changes, appears or disappears, while changes elsewhere on the
+// page are ignored. Each change is scored for significance and only those
+// reaching the job's threshold raise a SectionChanged event.
+func (cs *CrawlerService) MonitorPage(job *models.CrawlJob, req models.CrawlRequest) error {
+	cs.mu.Lock()
+	job.Status = "running"
+	cs.mu.Unlock()
+
+	client := &http.Client{Timeout: time.Minute, Transport: cs.charged(job, cs.newBaseTransport())}
+	userAgent := resolveUserAgent(req.UserAgent)
+
+	var previous *watchedSection
+	ticker := time.NewTicker(pageMonitorInterval(req))
+	defer ticker.Stop()
+
+	for {
+		cs.mu.Lock()
+		cancelled := job.Status == "cancelled"
+		cs.mu.Unlock()
+		if cancelled {
+			return nil
+		}
+
+		section, err := fetchSection(client, userAgent, req.Query, req.WatchSelector)
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Monitored page fetch failed")
+		} else {
+			cs.mu.Lock()
+			job.PagesCrawled++
+			cs.mu.Unlock()
+
+			if previous == nil {
+				log.WithFields(log.Fields{
+					"job_id":  job.ID,
+					"matched": section.hash != "",
+				}).Info("Page monitor baseline recorded")
+			} else if change := sectionChange(previous.hash, section.hash); change != "" {
+				cs.reportSectionChange(job, req, previous, section, change)
+			}
+			previous = section
+		}
+
+		<-ticker.C
+	}
+}
+
+// reportSectionChange records a changed section as a result and alerts on
+// it when the change is significant enough
+func (cs *CrawlerService) reportSectionChange(job *models.CrawlJob, req models.CrawlRequest, previous, section *watchedSection, change string) {
+	significance := changescore.Compare(previous.snapshot(), section.snapshot())
+	if change != sectionChanged {
+		// A section appearing or disappearing is always significant
+		significance.Score = 1
+	}
+	notify := significance.Score >= pageMonitorMinScore(req)
+
+	result := models.CrawlResult{
+		URL:         req.Query,
+		Title:       section.title,
+		Content:     section.text,
+		CrawledAt:   time.Now().UTC(),
+		StatusCode:  200,
+		ContentHash: section.hash,
+		Source:      models.SourceMonitor,
+		Provenance:  cs.provenance(job, models.RenderStatic),
+		Fields: map[string]string{
+			"selector":      req.WatchSelector,
+			"change":        change,
+			"previous_hash": previous.hash,
+			"previous_text": previous.text,
+			"change_score":  strconv.FormatFloat(significance.Score, 'f', 3, 64),
+			"text_change":   strconv.FormatFloat(significance.TextChange, 'f', 3, 64),
+			"new_entities":  strings.Join(significance.NewEntities, " "),
+			"new_domains":   strings.Join(significance.NewDomains, " "),
+			"notified":      strconv.FormatBool(notify),
+		},
+	}
+
+	cs.mu.Lock()
+	job.Results = append(job.Results, result)
+	numberResults(job, job.Results)
+	job.URLsFound = len(job.Results)
+	cs.mu.Unlock()
+
+	go cs.deliverResults(job, []models.CrawlResult{result})
+
+	log.WithFields(log.Fields{
+		"job_id": job.ID,
+		"change": change,
+		"score":  significance.Score,
+	}).Info("Monitored section changed")
+
+	if !notify {
+		return
+	}
+	cs.events.Publish(events.Event{
+		Type:   events.SectionChanged,
+		JobID:  job.ID,
+		Tenant: job.Tenant,
+		Data: map[string]interface{}{
+			"url":           req.Query,
+			"selector":      req.WatchSelector,
+			"change":        change,
+			"hash":          section.hash,
+			"previous_hash": previous.hash,
+			"score":         significance.Score,
+			"text_change":   significance.TextChange,
+			"new_entities":  significance.NewEntities,
+			"new_domains":   significance.NewDomains,
+		},
+	})
+}
+
+// sectionChange classifies the difference between two section hashes,
+// returning "" when they are equal
+func sectionChange(before, after string) string {
+	switch {
+	case before == after:
+		return ""
+	case before == "":
+		return sectionAppeared
+	case after == "":
+		return sectionRemoved
+	default:
+		return sectionChanged
+	}
+}
+
+// fetchSection downloads a page and extracts the section matching selector
+func fetchSection(client *http.Client, userAgent, pageURL, selector string) (*watchedSection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMonitoredPageBytes))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	section := &watchedSection{title: strings.TrimSpace(doc.Find("title").First().Text())}
+	matched := doc.Find(selector)
+	if matched.Length() == 0 {
+		return section, nil
+	}
+
+	var html, text strings.Builder
+	matched.Each(func(_ int, s *goquery.Selection) {
+		inner, _ := s.Html()
+		html.WriteString(inner)
+		text.WriteString(strings.Join(strings.Fields(s.Text()), " "))
+		text.WriteString("\n")
+	})
+	matched.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		if u, err := resp.Request.URL.Parse(strings.TrimSpace(a.AttrOr("href", ""))); err == nil && u.Host != "" {
+			section.links = append(section.links, u.String())
+		}
+	})
+	section.hash = dedup.HashContent(html.String())
+	section.text = strings.TrimSpace(text.String())
+	return section, nil
+}
@@ -0,0 +1,167 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/paste"
+	"definitelynotaspy/crawler-service/internal/pipeline"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pasteWatch is a tenant's subscription to pastes matching its keywords.
+// Matches are appended to a long-running paste_monitor job.
+type pasteWatch struct {
+	job        *models.CrawlJob
+	keywords   []string
+	processors []pipeline.ResultProcessor
+}
+
+// PasteSources returns the names of the configured paste sources
+func (cs *CrawlerService) PasteSources() []string {
+	return cs.pastes.Sources()
+}
+
+// WatchPastes starts collecting pastes matching keywords into job,
+// replacing the tenant's previous watch, which is returned so the caller can
+// report it as superseded
+func (cs *CrawlerService) WatchPastes(job *models.CrawlJob, keywords []string) (*models.CrawlJob, error) {
+	processors, err := cs.pipeline.Select(job.Processors)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.InvalidRequest, err)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var previous *models.CrawlJob
+	if w, ok := cs.pasteWatches[job.Tenant]; ok {
+		previous = w.job
+		previous.Status = "cancelled"
+		previous.CompletedAt = time.Now().UTC()
+	}
+
+	job.Status = "running"
+	cs.pasteWatches[job.Tenant] = &pasteWatch{
+		job:        job,
+		keywords:   keywords,
+		processors: processors,
+	}
+	return previous, nil
+}
+
+// PasteWatch returns a tenant's active paste watch job and keywords
+func (cs *CrawlerService) PasteWatch(tenant string) (*models.CrawlJob, []string, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	w, ok := cs.pasteWatches[tenant]
+	if !ok {
+		return nil, nil, false
+	}
+	return w.job, w.keywords, true
+}
+
+// UnwatchPastes stops a tenant's paste watch and completes its job
+func (cs *CrawlerService) UnwatchPastes(tenant string) (*models.CrawlJob, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	w, ok := cs.pasteWatches[tenant]
+	if !ok {
+		return nil, false
+	}
+	delete(cs.pasteWatches, tenant)
+
+	w.job.Status = "completed"
+	w.job.CompletedAt = time.Now().UTC()
+	return w.job, true
+}
+
+// StartPasteMonitor polls the configured paste sources in the background
+// and routes matching pastes to the tenants watching for them
+func (cs *CrawlerService) StartPasteMonitor(ctx context.Context) {
+	go cs.pastes.Run(ctx, cs.handlePaste)
+}
+
+func (cs *CrawlerService) handlePaste(p paste.Paste) {
+	cs.mu.Lock()
+	watches := make([]*pasteWatch, 0, len(cs.pasteWatches))
+	for _, w := range cs.pasteWatches {
+		watches = append(watches, w)
+	}
+	cs.mu.Unlock()
+
+	for _, w := range watches {
+		matched := paste.Match(p.Title+"\n"+p.Content, w.keywords)
+		if len(matched) == 0 {
+			continue
+		}
+
+		result, err := cs.pasteResult(w, p, matched)
+		if errors.Is(err, pipeline.ErrDrop) {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id": w.job.ID,
+				"url":    p.URL,
+			}).Warn("Failed to process paste")
+			continue
+		}
+
+		cs.mu.Lock()
+		w.job.Results = append(w.job.Results, *result)
+		numberResults(w.job, w.job.Results)
+		w.job.PagesCrawled = len(w.job.Results)
+		cs.mu.Unlock()
+
+		go cs.deliverResults(w.job, []models.CrawlResult{*result})
+	}
+}
+
+// pasteResult runs a matching paste through the watch's result pipeline
+func (cs *CrawlerService) pasteResult(w *pasteWatch, p paste.Paste, matched []string) (*models.CrawlResult, error) {
+	title := p.Title
+	if title == "" {
+		title = p.Key
+	}
+	doc := fmt.Sprintf("<html><head><title>%s</title></head><body><pre>%s</pre></body></html>",
+		html.EscapeString(title), html.EscapeString(p.Content))
+
+	e, err := htmlElement(p.URL, []byte(doc), 200, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var result models.CrawlResult
+	req := models.CrawlRequest{Tenant: w.job.Tenant, Processors: w.job.Processors}
+	if err := pipeline.Run(w.processors, &pipeline.Context{Job: w.job, Request: &req, Element: e}, &result); err != nil {
+		return nil, err
+	}
+
+	result.Source = models.SourcePaste
+	result.Provenance = cs.provenance(w.job, models.RenderAPI)
+	if result.Fields == nil {
+		result.Fields = make(map[string]string)
+	}
+	result.Fields["paste_site"] = p.Site
+	result.Fields["paste_key"] = p.Key
+	result.Fields["matched_keywords"] = strings.Join(matched, ",")
+	if p.Author != "" {
+		result.Fields["paste_author"] = p.Author
+	}
+	if p.Syntax != "" {
+		result.Fields["paste_syntax"] = p.Syntax
+	}
+	if !p.PostedAt.IsZero() {
+		result.Fields["paste_posted_at"] = p.PostedAt.Format(time.RFC3339)
+	}
+	return &result, nil
+}
@@ -0,0 +1,848 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/contentfilter"
+	"definitelynotaspy/crawler-service/internal/dedup"
+	"definitelynotaspy/crawler-service/internal/document"
+	"definitelynotaspy/crawler-service/internal/enrich"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/geotag"
+	"definitelynotaspy/crawler-service/internal/hibp"
+	"definitelynotaspy/crawler-service/internal/htmltable"
+	"definitelynotaspy/crawler-service/internal/imprint"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/parked"
+	"definitelynotaspy/crawler-service/internal/phone"
+	"definitelynotaspy/crawler-service/internal/pipeline"
+	"definitelynotaspy/crawler-service/internal/product"
+	"definitelynotaspy/crawler-service/internal/quality"
+	"definitelynotaspy/crawler-service/internal/quota"
+	"definitelynotaspy/crawler-service/internal/recipe"
+	"definitelynotaspy/crawler-service/internal/render"
+	"definitelynotaspy/crawler-service/internal/scripts"
+	"definitelynotaspy/crawler-service/internal/soft404"
+	"definitelynotaspy/crawler-service/internal/spa"
+	"definitelynotaspy/crawler-service/internal/timeline"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/publicsuffix"
+)
+
+// registerDefaultProcessors installs the built-in result processors in the
+// order they run for every page
+func (cs *CrawlerService) registerDefaultProcessors() {
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "extract", Fn: cs.extractProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "extraction_rules", Fn: cs.extractionRulesProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "categories", Fn: cs.categoriesProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "soft_404", Fn: cs.soft404Processor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "spa", Fn: cs.spaProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "quality", Fn: cs.qualityProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "parked", Fn: cs.parkedProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "filters", Fn: cs.filtersProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "changes", Fn: cs.changesProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "archive", Fn: cs.archiveProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "scripts", Fn: cs.scriptsProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "dedup", Fn: cs.dedupProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "quota", Fn: cs.quotaProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "screenshot", Fn: cs.screenshotProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "geoip", Fn: cs.geoipProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "geotag", Fn: cs.geotagProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "dates", Fn: cs.datesProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "tables", Fn: cs.tablesProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "products", Fn: cs.productsProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "organizations", Fn: cs.organizationsProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "outlinks", Fn: cs.outlinksProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "enrich", Fn: cs.enrichProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "emails", Fn: cs.emailsProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "breaches", Fn: cs.breachesProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "deliverability", Fn: cs.deliverabilityProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "phones", Fn: cs.phonesProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "reverse_image", Fn: cs.reverseImageProcessor})
+	cs.pipeline.Register(pipeline.ProcessorFunc{ProcessorName: "confidence", Fn: cs.confidenceProcessor})
+}
+
+// RegisterProcessor adds a custom result processor to the end of the pipeline
+func (cs *CrawlerService) RegisterProcessor(p pipeline.ResultProcessor) {
+	cs.pipeline.Register(p)
+}
+
+// Processors returns the registered result processor names in order
+func (cs *CrawlerService) Processors() []string {
+	return cs.pipeline.Names()
+}
+
+// ValidateProcessors checks that every requested processor is registered
+func (cs *CrawlerService) ValidateProcessors(names []string) error {
+	_, err := cs.pipeline.Select(names)
+	return err
+}
+
+// extractProcessor fills title, content and links from the page
+func (cs *CrawlerService) extractProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	*result = buildResult(ctx.Element)
+	result.DiscoveredFrom = ctx.DiscoveredFrom
+	return nil
+}
+
+// soft404Processor marks pages served with a success status that are really
+// error pages. They are kept for inspection but not counted as crawled or
+// forwarded.
+func (cs *CrawlerService) soft404Processor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	// Pastes, code hits and profiles are wrapped in synthetic pages
+	switch ctx.Job.Type {
+	case "", models.JobTypeCrawl, models.JobTypeReplay:
+	default:
+		return nil
+	}
+
+	body := ctx.Element.DOM.Find("body").Clone()
+	body.Find("script, style, noscript").Remove()
+
+	requested := ctx.Element.Request.Ctx.Get(requestedURLKey)
+	reason, ok := soft404.Detect(soft404.Page{
+		RequestedURL: requested,
+		URL:          result.URL,
+		Title:        result.Title,
+		Heading:      strings.TrimSpace(ctx.Element.DOM.Find("h1").First().Text()),
+		Text:         strings.Join(strings.Fields(body.Text()), " "),
+		Size:         len(ctx.Element.Response.Body),
+	})
+	if !ok {
+		return nil
+	}
+	result.Soft404 = true
+	result.Soft404Reason = reason
+
+	cs.mu.Lock()
+	ctx.Job.Soft404Pages++
+	cs.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"job_id": ctx.Job.ID,
+		"url":    result.URL,
+		"reason": reason,
+	}).Debug("Soft 404 detected")
+	return nil
+}
+
+// spaProcessor flags near-empty pages that look rendered by scripts, whose
+// content a static fetch cannot see
+func (cs *CrawlerService) spaProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	switch ctx.Job.Type {
+	case "", models.JobTypeCrawl:
+	default:
+		return nil
+	}
+	if result.Soft404 || result.Rendered {
+		return nil
+	}
+
+	body := ctx.Element.DOM.Find("body").Clone()
+	body.Find("script, style, noscript, template").Remove()
+	hint, ok := spa.Detect(ctx.Element.DOM, body.Text(), string(ctx.Element.Response.Body))
+	if !ok {
+		return nil
+	}
+	result.NeedsRender = true
+	result.RenderHint = hint
+
+	cs.mu.Lock()
+	ctx.Job.RenderCandidates++
+	cs.mu.Unlock()
+	return nil
+}
+
+// categoriesProcessor tags the result with its host's operator categories.
+// Pages a redirect took to a host of an excluded category are skipped.
+func (cs *CrawlerService) categoriesProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	u, err := url.Parse(result.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	result.Categories = cs.policies.Current().Categories(u.Hostname())
+	if category := cs.excludedCategory(u.Hostname(), ctx.Request.ExcludeCategories); category != "" {
+		log.WithFields(log.Fields{
+			"job_id":   ctx.Job.ID,
+			"url":      result.URL,
+			"category": category,
+		}).Debug("Skipping page in excluded category")
+		return pipeline.ErrSkip
+	}
+	return nil
+}
+
+// qualityProcessor scores how much real content the page carries. Pages
+// below the job's min_quality are skipped before they use storage or page
+// budget.
+func (cs *CrawlerService) qualityProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	assessment := quality.Assess(ctx.Element.DOM, ctx.Element.Response.Body)
+	result.QualityScore = assessment.Score
+
+	if ctx.Request.MinQuality <= 0 || assessment.Score >= ctx.Request.MinQuality {
+		return nil
+	}
+
+	cs.mu.Lock()
+	ctx.Job.LowQualityPages++
+	cs.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"job_id": ctx.Job.ID,
+		"url":    result.URL,
+		"score":  assessment.Score,
+		"words":  assessment.WordCount,
+	}).Debug("Skipping low-quality page")
+	return pipeline.ErrSkip
+}
+
+// parkedProcessor flags domain-parking and for-sale landers and records
+// their hosts on the job
+func (cs *CrawlerService) parkedProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	body := ctx.Element.DOM.Find("body").Clone()
+	body.Find("script, style, noscript").Remove()
+
+	provider, ok := parked.Detect(ctx.Element.Response.Body, body.Text())
+	if !ok {
+		return nil
+	}
+	result.Parked = true
+	result.ParkingProvider = provider
+
+	if u, err := url.Parse(result.URL); err == nil && u.Hostname() != "" {
+		cs.mu.Lock()
+		if ctx.Job.ParkedDomains == nil {
+			ctx.Job.ParkedDomains = make(map[string]string)
+		}
+		ctx.Job.ParkedDomains[strings.ToLower(u.Hostname())] = provider
+		cs.mu.Unlock()
+	}
+	return nil
+}
+
+// filtersProcessor applies the job's content filters. Pages failing one
+// are counted and skipped before they use storage or page budget, or with
+// the flag action kept and marked with the filters they failed.
+func (cs *CrawlerService) filtersProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if ctx.Request.Filters == nil {
+		return nil
+	}
+	filter, err := contentfilter.New(ctx.Request.Filters)
+	if err != nil {
+		return err
+	}
+	failed := filter.Failed(*result)
+	if len(failed) == 0 {
+		return nil
+	}
+
+	cs.mu.Lock()
+	if ctx.Job.FilteredPages == nil {
+		ctx.Job.FilteredPages = make(map[string]int)
+	}
+	for _, name := range failed {
+		ctx.Job.FilteredPages[name]++
+	}
+	cs.mu.Unlock()
+
+	if ctx.Request.Filters.Action == contentfilter.ActionFlag {
+		result.FilteredBy = failed
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"job_id":  ctx.Job.ID,
+		"url":     result.URL,
+		"filters": failed,
+	}).Debug("Skipping filtered page")
+	return pipeline.ErrSkip
+}
+
+// archiveProcessor stores the raw HTML when the job captures it
+func (cs *CrawlerService) archiveProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !ctx.Request.CaptureHTML {
+		return nil
+	}
+
+	ref, digest, err := cs.archive.Store(ctx.Job.Tenant, ctx.Job.ID, result.URL, ctx.Element.Response.Body)
+	if err != nil {
+		log.WithError(err).WithField("job_id", ctx.Job.ID).Warn("Failed to archive page HTML")
+		return nil
+	}
+	result.HTMLRef = ref
+	result.HTMLSHA256 = hex.EncodeToString(digest)
+
+	if ctx.Request.TimestampHTML && cs.tsa != nil {
+		tsCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		cs.chargeAPICall(ctx.Job, APITimestamp)
+		token, err := cs.tsa.Timestamp(tsCtx, digest)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id": ctx.Job.ID,
+				"url":    result.URL,
+			}).Warn("Failed to timestamp archived HTML")
+			return nil
+		}
+		result.HTMLTimestamp = token
+	}
+	return nil
+}
+
+// screenshotProcessor stores a screenshot of the page when the job
+// captures them. Documents read into pages are not captured.
+func (cs *CrawlerService) screenshotProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !ctx.Request.CaptureScreenshot || cs.renderer == nil || !document.IsHTML(result.ContentType) {
+		return nil
+	}
+
+	// Waiting for a browser context is bounded too, so a busy renderer
+	// does not hold up the crawl indefinitely
+	shotCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	start := time.Now()
+	png, err := cs.renderer.Screenshot(shotCtx, render.Page{
+		URL:       result.URL,
+		UserAgent: ctx.Element.Request.Headers.Get("User-Agent"),
+		Access:    cs.requestRenderAccess(ctx.Element.Request),
+		Emulation: renderEmulation(ctx.Request.Emulation),
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"job_id": ctx.Job.ID,
+			"url":    result.URL,
+		}).Warn("Failed to take page screenshot")
+		return nil
+	}
+	cs.mu.Lock()
+	ctx.Job.PagesRendered++
+	ctx.Job.Cost.RenderMinutes += time.Since(start).Minutes()
+	cs.mu.Unlock()
+
+	ref, err := cs.archive.StoreScreenshot(ctx.Job.Tenant, ctx.Job.ID, result.URL, png)
+	if err != nil {
+		log.WithError(err).WithField("job_id", ctx.Job.ID).Warn("Failed to archive page screenshot")
+		return nil
+	}
+	result.ScreenshotRef = ref
+	return nil
+}
+
+// scriptsProcessor runs the tenant extraction scripts selected by the job and
+// merges the fields they return into the result
+func (cs *CrawlerService) scriptsProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if len(ctx.Request.Scripts) == 0 {
+		return nil
+	}
+
+	page := scripts.Page{
+		URL:     result.URL,
+		Title:   result.Title,
+		Text:    strings.TrimSpace(ctx.Element.Text),
+		Content: result.Content,
+	}
+
+	for _, name := range ctx.Request.Scripts {
+		script, ok, err := cs.scripts.Get(ctx.Job.Tenant, name)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id": ctx.Job.ID,
+				"script": name,
+			}).Warn("Failed to load extraction script")
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		fields, err := script.Run(page)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id": ctx.Job.ID,
+				"script": name,
+				"url":    result.URL,
+			}).Warn("Extraction script failed")
+			continue
+		}
+
+		if result.Fields == nil {
+			result.Fields = make(map[string]string, len(fields))
+		}
+		for k, v := range fields {
+			result.Fields[k] = v
+		}
+	}
+	return nil
+}
+
+// dedupProcessor records the content hash tenant-wide and flags pages
+// duplicating one seen before in the job's dedupe scope, or tenant-wide
+// for skip_previously_seen. Near duplicates are looked for in the same
+// scope.
+func (cs *CrawlerService) dedupProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	req := ctx.Request
+	result.ContentHash = dedup.HashContent(result.Content)
+	firstURL, seen := cs.contentIndex.Record(ctx.Job.Tenant, result.ContentHash, result.URL)
+
+	scope := ctx.Job.Tenant
+	switch {
+	case req.DedupeScope == models.DedupeScopeJob:
+		scope = dedup.JobScope(ctx.Job.ID)
+		firstURL, seen = cs.contentIndex.Record(scope, result.ContentHash, result.URL)
+	case req.DedupeScope == "" && !req.SkipPreviouslySeen:
+		return nil
+	}
+	if !seen && req.NearDuplicates {
+		if hash, ok := dedup.SimHash(result.Content); ok {
+			firstURL, seen = cs.contentIndex.RecordNear(scope, hash, result.URL)
+		}
+	}
+	if !seen {
+		return nil
+	}
+
+	result.DuplicateOf = firstURL
+	cs.mu.Lock()
+	ctx.Job.DuplicatePages++
+	cs.mu.Unlock()
+	if req.DropDuplicates {
+		return pipeline.ErrSkip
+	}
+	return nil
+}
+
+// quotaProcessor enforces the storage quota before the result is kept
+func (cs *CrawlerService) quotaProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	job := ctx.Job
+	size := quota.ResultSize(*result)
+	allowed := cs.quota.Reserve(job.Tenant, job.StorageBytes, cs.quota.JobLimit(ctx.Request.MaxStorageBytes), size)
+	if allowed < size {
+		if allowed == 0 {
+			if job.ErrorCounts == nil {
+				job.ErrorCounts = make(map[string]int)
+			}
+			job.ErrorCounts[errcode.QuotaExceeded]++
+			job.QuotaStatus = quota.StatusRejected
+			log.WithField("job_id", job.ID).Warn("Storage quota exceeded, result rejected")
+			return pipeline.ErrDrop
+		}
+		quota.TruncateResult(result, allowed)
+		job.QuotaStatus = quota.StatusTruncated
+		log.WithField("job_id", job.ID).Warn("Storage quota reached, result truncated")
+	}
+	job.StorageBytes += allowed
+	return nil
+}
+
+// enrichProcessor attaches Shodan/Censys data about the page's host when a
+// provider is configured. It runs last so dropped pages spend no lookups, and
+// skips paste and code results, whose hosts are the third-party sites.
+func (cs *CrawlerService) enrichProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !cs.enricher.Enabled() || result.Source != "" {
+		return nil
+	}
+
+	u, err := url.Parse(result.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cs.chargeAPICall(ctx.Job, APIEnrichment)
+	intel, err := cs.enricher.Enrich(lookupCtx, ctx.Job.Tenant, u.Hostname())
+	if errors.Is(err, enrich.ErrLookupQuotaExhausted) {
+		log.WithFields(log.Fields{
+			"job_id": ctx.Job.ID,
+			"tenant": ctx.Job.Tenant,
+		}).Debug("Enrichment lookup quota exhausted")
+	}
+	for i := range intel {
+		intel[i].Geo = cs.geo.Lookup(intel[i].IP)
+	}
+	result.HostIntel = intel
+	return nil
+}
+
+// maxEmailsPerPage bounds breach lookups for pages listing many addresses
+const maxEmailsPerPage = 20
+
+// emailsProcessor lists the email addresses on the page when the job
+// checks them for breaches or deliverability. Duplicate pages are skipped,
+// as their addresses were checked on the first copy.
+func (cs *CrawlerService) emailsProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	wanted := ctx.Request.CheckBreaches && cs.hibp != nil || ctx.Request.VerifyEmails
+	if !wanted || result.DuplicateOf != "" {
+		return nil
+	}
+
+	linked := make(map[string]bool)
+	ctx.Element.DOM.Find(`a[href^="mailto:"]`).Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		address, _, _ := strings.Cut(strings.TrimPrefix(href, "mailto:"), "?")
+		linked[strings.ToLower(strings.TrimSpace(address))] = true
+	})
+
+	for _, email := range hibp.ExtractEmails(result.Content, maxEmailsPerPage) {
+		entity := models.EmailEntity{Address: email, Source: models.EntitySourceText}
+		if linked[email] {
+			entity.Source = models.EntitySourceLink
+		}
+		result.Emails = append(result.Emails, entity)
+	}
+	return nil
+}
+
+// breachesProcessor attaches to each email address on the page the
+// breaches it appeared in when the job asks for it. Lookups wait for the
+// HIBP rate limit.
+func (cs *CrawlerService) breachesProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !ctx.Request.CheckBreaches || cs.hibp == nil || len(result.Emails) == 0 {
+		return nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	for i := range result.Emails {
+		entity := &result.Emails[i]
+		cs.chargeAPICall(ctx.Job, APIBreaches)
+		breaches, err := cs.hibp.Breaches(lookupCtx, entity.Address)
+		if err != nil {
+			log.WithError(err).WithField("job_id", ctx.Job.ID).Warn("Breach lookup failed")
+		}
+		for _, b := range breaches {
+			entity.Breaches = append(entity.Breaches, models.BreachSummary(b))
+		}
+	}
+	return nil
+}
+
+// deliverabilityProcessor marks each email address on the page deliverable
+// or not by the MX records of its domain when the job asks for it
+func (cs *CrawlerService) deliverabilityProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !ctx.Request.VerifyEmails || len(result.Emails) == 0 {
+		return nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for i := range result.Emails {
+		result.Emails[i].Deliverability = cs.mailcheck.Check(lookupCtx, result.Emails[i].Address)
+	}
+	return nil
+}
+
+// maxPhonesPerPage bounds the numbers kept for pages such as directories
+const maxPhonesPerPage = 50
+
+// phonesProcessor lists the phone numbers on the page, normalised to E.164,
+// when the job asks for it. Parking landers only show the parking
+// provider's numbers.
+func (cs *CrawlerService) phonesProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !ctx.Request.ExtractPhones || result.Parked {
+		return nil
+	}
+	region := phone.RegionForURL(result.URL, ctx.Request.PhoneRegion)
+	result.Phones = phone.Find(ctx.Element.DOM, result.Content, region, maxPhonesPerPage)
+	return nil
+}
+
+// reverseImagesPerPage returns how many images per page are submitted to
+// reverse image search, from REVERSE_IMAGE_MAX_PER_PAGE (default 5)
+func reverseImagesPerPage() int {
+	if n, err := strconv.Atoi(os.Getenv("REVERSE_IMAGE_MAX_PER_PAGE")); err == nil && n >= 0 {
+		return n
+	}
+	return 5
+}
+
+// reverseImageProcessor attaches reverse image search matches to the first
+// images of the page when the job asks for it
+func (cs *CrawlerService) reverseImageProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !ctx.Request.ReverseImageSearch || cs.reverseImage == nil || result.DuplicateOf != "" {
+		return nil
+	}
+
+	searchCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	limit := reverseImagesPerPage()
+	for i := range result.Media {
+		if i >= limit {
+			break
+		}
+		asset := &result.Media[i]
+
+		cs.chargeAPICall(ctx.Job, APIReverseImage)
+		matches, err := cs.reverseImage.Search(searchCtx, asset.URL)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id": ctx.Job.ID,
+				"image":  asset.URL,
+			}).Warn("Reverse image search failed")
+			continue
+		}
+		for _, m := range matches {
+			asset.Matches = append(asset.Matches, models.ImageMatch{
+				URL:      m.URL,
+				ImageURL: m.ImageURL,
+				Domain:   m.Domain,
+				Score:    m.Score,
+				Provider: cs.reverseImage.Name(),
+			})
+		}
+	}
+	return nil
+}
+
+// geoipProcessor locates the host a page was served from and counts the page
+// towards its hosting country
+func (cs *CrawlerService) geoipProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !cs.geo.Enabled() || result.Source != "" {
+		return nil
+	}
+
+	u, err := url.Parse(result.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result.Hosting = cs.geo.LookupHost(lookupCtx, u.Hostname())
+	if result.Hosting == nil || result.Hosting.Country == "" || result.Parked {
+		return nil
+	}
+
+	cs.mu.Lock()
+	if ctx.Job.CountryCounts == nil {
+		ctx.Job.CountryCounts = make(map[string]int)
+	}
+	ctx.Job.CountryCounts[result.Hosting.Country]++
+	cs.mu.Unlock()
+	return nil
+}
+
+// Limits for EXIF GPS extraction
+const (
+	exifImagesPerPage = 5
+	maxEXIFImageBytes = 10 << 20
+)
+
+// geotagProcessor extracts the locations the page refers to and, when the
+// job asks for it, the GPS positions and capture times embedded in its first
+// images
+func (cs *CrawlerService) geotagProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	geo := geotag.Extract(ctx.Element.DOM, result.Content)
+
+	if ctx.Request.GeoEXIF {
+		client := &http.Client{Transport: cs.charged(ctx.Job, cs.newBaseTransport()), Timeout: 20 * time.Second}
+		for i, asset := range result.Media {
+			if i == exifImagesPerPage {
+				break
+			}
+			info, ok := imageEXIF(client, asset.URL)
+			if !ok {
+				continue
+			}
+			if info.HasGPS {
+				if geo == nil {
+					geo = &models.ContentGeo{}
+				}
+				geo.AddPoint(models.GeoPoint{Lat: info.Lat, Lon: info.Lon, Source: geotag.SourceEXIF, Image: asset.URL})
+			}
+			if !info.Taken.IsZero() {
+				result.Dates = append(result.Dates, models.DatedEvent{
+					Time:   info.Taken,
+					Kind:   timeline.KindEXIF,
+					Source: "exif",
+					Image:  asset.URL,
+				})
+			}
+		}
+	}
+
+	if geo != nil && (len(geo.Points) > 0 || len(geo.Places) > 0) {
+		result.Geo = geo
+	}
+	return nil
+}
+
+// imageEXIF downloads an image and reads its EXIF data
+func imageEXIF(client *http.Client, imageURL string) (geotag.EXIF, bool) {
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return geotag.EXIF{}, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return geotag.EXIF{}, false
+	}
+	return geotag.ReadEXIF(io.LimitReader(resp.Body, maxEXIFImageBytes))
+}
+
+// datesProcessor records the publication and modification dates of the page
+func (cs *CrawlerService) datesProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	result.Dates = append(timeline.Extract(ctx.Element.DOM), result.Dates...)
+	return nil
+}
+
+// tablesProcessor extracts the page's data tables into rows and columns
+func (cs *CrawlerService) tablesProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	result.Tables = htmltable.Extract(ctx.Element.DOM)
+	return nil
+}
+
+// productsProcessor extracts the page's product offers when the job asks
+// for them
+func (cs *CrawlerService) productsProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if ctx.Request.ExtractProducts {
+		result.Products = product.Extract(ctx.Element.DOM, result.URL)
+	}
+	return nil
+}
+
+// extractionRulesProcessor reads the fields the job's extraction rules for
+// the page's domain select. Title and content fields stand in for what the
+// generic extraction found, before later processors see it.
+func (cs *CrawlerService) extractionRulesProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if len(ctx.Request.ExtractionRules) == 0 && len(ctx.Request.DomainExtractionRules) == 0 {
+		return nil
+	}
+	u, err := url.Parse(result.URL)
+	if err != nil {
+		return nil
+	}
+	rules := recipe.ForHost(ctx.Request.ExtractionRules, ctx.Request.DomainExtractionRules, u.Hostname())
+	fields := recipe.Extract(ctx.Element.DOM, u, rules)
+	if title, ok := fields["title"]; ok {
+		result.Title = title
+		delete(fields, "title")
+	}
+	if content, ok := fields["content"]; ok {
+		result.Content = content
+		delete(fields, "content")
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	if result.Fields == nil {
+		result.Fields = make(map[string]string, len(fields))
+	}
+	for field, value := range fields {
+		result.Fields[field] = value
+	}
+	return nil
+}
+
+// organizationsProcessor reads the organisation described on contact, about
+// and imprint pages when the job asks for it, and merges what the pages of
+// each registrable domain say into one record on the job
+func (cs *CrawlerService) organizationsProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if !ctx.Request.ExtractOrganizations || result.Soft404 || result.Parked || !imprint.IsContactPage(result.URL, result.Title) {
+		return nil
+	}
+	u, err := url.Parse(result.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+
+	org, ok := imprint.Extract(ctx.Element.DOM, result.URL, hibp.ExtractEmails(result.Content, maxEmailsPerPage))
+	if !ok {
+		return nil
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(u.Hostname()))
+	if err != nil {
+		domain = strings.ToLower(u.Hostname())
+	}
+	org.Domain = domain
+	region := phone.RegionForURL(result.URL, ctx.Request.PhoneRegion)
+	seen := make(map[string]bool, len(org.Phones))
+	phones := org.Phones[:0]
+	for _, raw := range org.Phones {
+		if number := phone.Normalize(raw, region); !seen[number] {
+			seen[number] = true
+			phones = append(phones, number)
+		}
+	}
+	org.Phones = phones
+	result.Organization = &org
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if ctx.Job.Organizations == nil {
+		ctx.Job.Organizations = make(map[string]*models.Organization)
+	}
+	merged, ok := ctx.Job.Organizations[domain]
+	if !ok {
+		merged = &models.Organization{Domain: domain}
+		ctx.Job.Organizations[domain] = merged
+	}
+	imprint.Merge(merged, org)
+	return nil
+}
+
+// outlinksProcessor counts the page's links to external domains on the job,
+// grouped by registrable domain so subdomains and mirrors add up. Links on
+// parking landers are ads, not affiliations, and are not counted.
+func (cs *CrawlerService) outlinksProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if result.Parked {
+		return nil
+	}
+
+	links := make(map[string]int)
+	for _, link := range result.Links {
+		if !link.External {
+			continue
+		}
+		u, err := url.Parse(link.URL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(u.Hostname()))
+		if err != nil {
+			domain = strings.ToLower(u.Hostname())
+		}
+		links[domain]++
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if ctx.Job.LinkedDomains == nil {
+		ctx.Job.LinkedDomains = make(map[string]models.LinkedDomain)
+	}
+	for domain, n := range links {
+		counts := ctx.Job.LinkedDomains[domain]
+		counts.Links += n
+		counts.Pages++
+		ctx.Job.LinkedDomains[domain] = counts
+	}
+	return nil
+}
+
+// confidenceProcessor scores every entity extracted from the page, so
+// exports can leave out those scored below a minimum
+func (cs *CrawlerService) confidenceProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	if len(result.Emails) == 0 && len(result.Phones) == 0 && len(result.Products) == 0 && result.Organization == nil {
+		return nil
+	}
+	cs.confidence.Score(result)
+	return nil
+}
@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Version identifies the crawler build in result provenance. Release builds
+// set it with -ldflags "-X definitelynotaspy/crawler-service/internal/crawler.Version=..."
+var Version = "dev"
+
+// workerID identifies this process in result provenance: WORKER_ID, else
+// the host name and process ID
+var workerID = func() string {
+	if id := os.Getenv("WORKER_ID"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+// Headers the timing transport adds to responses; they are removed again
+// before results are built
+const (
+	fetchStartHeader    = "X-Godseye-Fetch-Started"
+	fetchDurationHeader = "X-Godseye-Fetch-Duration"
+)
+
+// fetchStartKey and fetchDurationKey hold when a response was requested and
+// how long it took in its colly context
+const (
+	fetchStartKey    = "fetch_started"
+	fetchDurationKey = "fetch_duration"
+)
+
+// timedTransport stamps responses with when they were requested and how
+// long the round trip took on the monotonic clock. Rate limiting delays
+// happen before the round trip and are not counted.
+type timedTransport struct {
+	next http.RoundTripper
+}
+
+func (t timedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	if resp != nil {
+		if resp.Header == nil {
+			resp.Header = make(http.Header)
+		}
+		resp.Header.Set(fetchStartHeader, start.UTC().Format(time.RFC3339Nano))
+		resp.Header.Set(fetchDurationHeader, strconv.FormatInt(time.Since(start).Microseconds(), 10))
+	}
+	return resp, err
+}
+
+// markFetchTiming moves the timing transport's headers into the response
+// context
+func markFetchTiming(r *colly.Response) {
+	if r.Headers == nil {
+		return
+	}
+	if start, err := time.Parse(time.RFC3339Nano, r.Headers.Get(fetchStartHeader)); err == nil {
+		r.Ctx.Put(fetchStartKey, start)
+	}
+	if us, err := strconv.ParseInt(r.Headers.Get(fetchDurationHeader), 10, 64); err == nil {
+		r.Ctx.Put(fetchDurationKey, time.Duration(us)*time.Microsecond)
+	}
+	r.Headers.Del(fetchStartHeader)
+	r.Headers.Del(fetchDurationHeader)
+}
+
+// provenance describes a result produced for job, which is nil for one-off
+// fetches
+func (cs *CrawlerService) provenance(job *models.CrawlJob, renderMode string) *models.Provenance {
+	p := &models.Provenance{
+		CrawlerVersion: Version,
+		WorkerID:       workerID,
+		RenderMode:     renderMode,
+		FetchedAt:      time.Now().UTC(),
+	}
+	if job != nil {
+		p.PolicyProfile = cs.jobCompliance(job).Name
+		p.Region = job.Region
+	}
+	return p
+}
+
+// responseProvenance describes a result extracted from a fetched response
+func (cs *CrawlerService) responseProvenance(job *models.CrawlJob, r *colly.Response) *models.Provenance {
+	p := cs.provenance(job, models.RenderStatic)
+	p.UserAgent = r.Request.Headers.Get("User-Agent")
+	if p.Region == "" {
+		p.Proxy = proxyFor(r.Request.URL)
+	}
+	if start, ok := r.Ctx.GetAny(fetchStartKey).(time.Time); ok {
+		p.FetchedAt = start.UTC()
+	}
+	if d, ok := r.Ctx.GetAny(fetchDurationKey).(time.Duration); ok {
+		p.FetchDurationMs = d.Milliseconds()
+	}
+	return p
+}
+
+// proxyFor returns the proxy the environment routes u through, without
+// credentials
+func proxyFor(u *url.URL) string {
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u})
+	if err != nil || proxy == nil {
+		return ""
+	}
+	return proxy.Redacted()
+}
+
+// ServiceIdentity names this build and worker, e.g. in exported evidence
+func ServiceIdentity() string {
+	return fmt.Sprintf("crawler-service %s (%s)", Version, workerID)
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Halt stops a job that is still running or watching, marking it cancelled.
+// It is a no-op for finished jobs.
+func (cs *CrawlerService) Halt(job *models.CrawlJob) {
+	cs.mu.Lock()
+	run := cs.active[job.ID]
+	watch, watching := cs.pasteWatches[job.Tenant]
+	if watching && watch.job == job {
+		delete(cs.pasteWatches, job.Tenant)
+	}
+	if job.Status != "completed" && job.Status != "failed" && job.Status != "cancelled" {
+		job.Status = "cancelled"
+		job.CompletedAt = time.Now().UTC()
+	}
+	cs.mu.Unlock()
+
+	if run != nil {
+		cs.stop(run, stopDeleted)
+	}
+}
+
+// PurgeJob halts a job and removes everything stored for it: archived
+// pages, offloaded results, content-index entries pointing at its pages and
+// its share of the tenant storage quota. The job itself is left to the
+// caller to forget.
+func (cs *CrawlerService) PurgeJob(job *models.CrawlJob) (models.PurgeReport, error) {
+	cs.Halt(job)
+	return cs.DeleteResults(job)
+}
+
+// DeleteResults removes what a finished job stored, as PurgeJob does, but
+// keeps the job and its statistics
+func (cs *CrawlerService) DeleteResults(job *models.CrawlJob) (models.PurgeReport, error) {
+	var report models.PurgeReport
+	results, err := cs.JobResults(job)
+	if err != nil {
+		return report, fmt.Errorf("failed to load results: %w", err)
+	}
+	report.Results = len(results)
+
+	for _, result := range results {
+		if result.ContentHash != "" && cs.contentIndex.Forget(job.Tenant, result.ContentHash, result.URL) {
+			report.IndexEntries++
+		}
+	}
+
+	if cs.results != nil {
+		if err := cs.results.DeleteResults(job.ID); err != nil {
+			return report, fmt.Errorf("failed to delete stored results: %w", err)
+		}
+	}
+
+	if err := cs.archive.DeleteJob(job.ID); err != nil {
+		return report, fmt.Errorf("failed to delete archive: %w", err)
+	}
+	report.ArchiveDeleted = true
+
+	// Only the job's own offloaded results are deleted, whatever its
+	// reference says
+	if key, err := cs.offloadedKey(job); job.ResultsRef != "" && err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := cs.s3.Delete(ctx, key); err != nil {
+			return report, fmt.Errorf("failed to delete offloaded results: %w", err)
+		}
+		report.OffloadDeleted = true
+	}
+
+	cs.mu.Lock()
+	report.BytesReleased = job.StorageBytes
+	job.Results = nil
+	job.ResultsRef = ""
+	job.StorageBytes = 0
+	cs.mu.Unlock()
+	cs.quota.Release(job.Tenant, report.BytesReleased)
+
+	log.WithFields(log.Fields{
+		"job_id":  job.ID,
+		"tenant":  job.Tenant,
+		"results": report.Results,
+	}).Info("Job results deleted")
+
+	return report, nil
+}
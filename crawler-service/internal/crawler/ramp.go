@@ -0,0 +1,195 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/models"
+	"net/http"
+	"sync"
+)
+
+// Concurrency ramp: a crawl starts with one request in flight. After every
+// rampWindow requests it allows one more, up to its maximum, if no more
+// than rampUpErrorRate of them failed, and halves its parallelism if
+// rampDownErrorRate or more did. rampSpike failures in a row halve it at
+// once. Server errors, 429s and transport errors (timeouts included) count
+// as failures.
+const (
+	rampWindow         = 10
+	rampUpErrorRate    = 0.05
+	rampDownErrorRate  = 0.2
+	rampSpike          = 3
+	defaultParallelism = 4
+	maxParallelism     = 16
+)
+
+// Ramp states reported on jobs
+const (
+	rampStateUp     = "ramping_up"
+	rampStateSteady = "steady"
+	rampStateDown   = "cooling_down"
+)
+
+// parallelismRamp limits how many requests of a crawl are in flight,
+// adjusting the limit to the error rate the targets answer with
+type parallelismRamp struct {
+	mu       sync.Mutex
+	limit    int
+	max      int
+	inFlight int
+	state    string
+	changes  int
+	// requests and failures count the current window; streak counts
+	// failures in a row
+	requests  int
+	failures  int
+	streak    int
+	errorRate float64
+	// wake is closed whenever a request finishes, to wake waiters
+	wake chan struct{}
+	// update receives the ramp's state whenever it changes
+	update func(models.ParallelismRamp)
+}
+
+// jobParallelism returns the most requests a job may have in flight:
+// max_parallelism, capped, or defaultParallelism
+func jobParallelism(requested int) int {
+	switch {
+	case requested <= 0:
+		return defaultParallelism
+	case requested > maxParallelism:
+		return maxParallelism
+	}
+	return requested
+}
+
+func newParallelismRamp(max int, update func(models.ParallelismRamp)) *parallelismRamp {
+	r := &parallelismRamp{
+		limit:  1,
+		max:    max,
+		state:  rampStateUp,
+		wake:   make(chan struct{}),
+		update: update,
+	}
+	if max <= 1 {
+		r.state = rampStateSteady
+	}
+	r.update(r.report())
+	return r
+}
+
+// acquire waits for a request slot
+func (r *parallelismRamp) acquire(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		if r.inFlight < r.limit {
+			r.inFlight++
+			r.mu.Unlock()
+			return nil
+		}
+		wake := r.wake
+		r.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees a request slot, recording whether the request failed
+func (r *parallelismRamp) release(failed bool) {
+	r.mu.Lock()
+	prev := r.state
+	r.inFlight--
+	r.requests++
+	if failed {
+		r.failures++
+		r.streak++
+	} else {
+		r.streak = 0
+	}
+
+	changed := false
+	switch {
+	case r.streak >= rampSpike:
+		changed = r.coolDown()
+	case r.requests >= rampWindow:
+		r.errorRate = float64(r.failures) / float64(r.requests)
+		switch {
+		case r.errorRate >= rampDownErrorRate:
+			changed = r.coolDown()
+		case r.errorRate <= rampUpErrorRate && r.limit < r.max:
+			r.limit++
+			r.state = rampStateUp
+			if r.limit == r.max {
+				r.state = rampStateSteady
+			}
+			changed = true
+		default:
+			r.state = rampStateSteady
+		}
+		r.requests, r.failures = 0, 0
+	}
+	if changed {
+		r.changes++
+	}
+	report := r.report()
+
+	close(r.wake)
+	r.wake = make(chan struct{})
+	r.mu.Unlock()
+
+	if changed || report.State != prev {
+		r.update(report)
+	}
+}
+
+// coolDown halves the limit and starts a new window; r.mu must be held
+func (r *parallelismRamp) coolDown() bool {
+	if r.requests > 0 {
+		r.errorRate = float64(r.failures) / float64(r.requests)
+	}
+	r.requests, r.failures, r.streak = 0, 0, 0
+	r.state = rampStateDown
+	if r.limit == 1 {
+		return false
+	}
+	r.limit /= 2
+	return true
+}
+
+// report returns the ramp's state; r.mu must be held, or the ramp unshared
+func (r *parallelismRamp) report() models.ParallelismRamp {
+	return models.ParallelismRamp{
+		Current:   r.limit,
+		Max:       r.max,
+		State:     r.state,
+		Changes:   r.changes,
+		ErrorRate: r.errorRate,
+	}
+}
+
+// rampTransport holds each request until the ramp has a slot for it. The
+// slot is kept until the response body is closed.
+type rampTransport struct {
+	next http.RoundTripper
+	ramp *parallelismRamp
+}
+
+func (t rampTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.ramp.acquire(r.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		t.ramp.release(true)
+		return nil, err
+	}
+	failed := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+	var once sync.Once
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() {
+		once.Do(func() { t.ramp.release(failed) })
+	}}
+	return resp, nil
+}
@@ -0,0 +1,26 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/priority"
+)
+
+// rankFrontier orders inherited frontier URLs best first. The pages that
+// linked to them and their depth are not kept, so they are scored on the
+// URL and the crawl's query alone.
+func (cs *CrawlerService) rankFrontier(ctx context.Context, urls []string, query string) []string {
+	links := make([]priority.Link, len(urls))
+	for i, u := range urls {
+		links[i] = priority.Link{URL: u, Query: query}
+	}
+	ranked := make([]string, 0, len(urls))
+	for _, link := range priority.Rank(ctx, cs.scorer, links) {
+		ranked = append(ranked, link.URL)
+	}
+	return ranked
+}
+
+// URLScorer returns the scorer that orders the links crawls follow
+func (cs *CrawlerService) URLScorer() priority.URLScorer {
+	return cs.scorer
+}
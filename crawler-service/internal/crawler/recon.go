@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/pipeline"
+	"definitelynotaspy/crawler-service/internal/recon"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reconConcurrency returns how many platforms are probed at once, from
+// USERNAME_RECON_CONCURRENCY (default 10)
+func reconConcurrency() int {
+	if n, err := strconv.Atoi(os.Getenv("USERNAME_RECON_CONCURRENCY")); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// ReconUsername probes the platform catalog for the job's username. Each
+// existing profile is run through the result pipeline and, when the job asks
+// for it, announced for follow-up content crawls.
+func (cs *CrawlerService) ReconUsername(job *models.CrawlJob, req models.CrawlRequest) error {
+	cs.mu.Lock()
+	job.Status = "running"
+	cs.mu.Unlock()
+
+	catalog, err := recon.Catalog()
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.Internal, err))
+	}
+	processors, err := cs.pipeline.Select(req.Processors)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobMaxRuntime(req.MaxRuntimeSeconds))
+	defer cancel()
+
+	client := &http.Client{Transport: cs.charged(job, cs.newBaseTransport()), Timeout: 15 * time.Second}
+
+	var mu sync.Mutex
+	var results []models.CrawlResult
+	var profileURLs []string
+
+	recon.Probe(ctx, client, resolveUserAgent(req.UserAgent), req.Username, catalog, reconConcurrency(), func(p recon.Profile) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		job.URLsFound++
+		if p.Err != nil {
+			cs.mu.Lock()
+			if job.ErrorCounts == nil {
+				job.ErrorCounts = make(map[string]int)
+			}
+			job.ErrorCounts[errcode.Classify(p.Err, 0)]++
+			cs.mu.Unlock()
+			return
+		}
+		if !p.Exists {
+			return
+		}
+
+		result, err := cs.profileResult(job, &req, processors, p)
+		if errors.Is(err, pipeline.ErrDrop) {
+			return
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id":   job.ID,
+				"platform": p.Platform,
+			}).Warn("Failed to process profile")
+			return
+		}
+
+		results = append(results, *result)
+		profileURLs = append(profileURLs, p.URL)
+		cs.mu.Lock()
+		job.PagesCrawled = len(results)
+		cs.mu.Unlock()
+	})
+
+	cs.mu.Lock()
+	job.Status = "completed"
+	numberResults(job, results)
+	job.Results = results
+	job.CompletedAt = time.Now().UTC()
+	cs.mu.Unlock()
+	cs.publishFinished(job)
+
+	if len(profileURLs) > 0 {
+		cs.events.Publish(events.Event{
+			Type:   events.ProfilesFound,
+			JobID:  job.ID,
+			Tenant: job.Tenant,
+			Data: map[string]interface{}{
+				"username":  req.Username,
+				"urls":      profileURLs,
+				"follow_up": req.FollowUpCrawl,
+				"max_pages": req.MaxPages,
+				"max_depth": req.MaxDepth,
+			},
+		})
+	}
+
+	go func() {
+		cs.deliverResults(job, job.Results)
+		cs.offloadResults(job)
+	}()
+
+	log.WithFields(log.Fields{
+		"job_id":    job.ID,
+		"username":  req.Username,
+		"platforms": len(catalog),
+		"profiles":  len(results),
+	}).Info("Username recon completed")
+
+	return nil
+}
+
+// profileResult runs an existing profile page through the pipeline
+func (cs *CrawlerService) profileResult(job *models.CrawlJob, req *models.CrawlRequest, processors []pipeline.ResultProcessor, p recon.Profile) (*models.CrawlResult, error) {
+	e, err := htmlElement(p.URL, p.Body, p.Status, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var result models.CrawlResult
+	if err := pipeline.Run(processors, &pipeline.Context{Job: job, Request: req, Element: e}, &result); err != nil {
+		return nil, err
+	}
+
+	result.Source = models.SourceUsername
+	result.Provenance = cs.provenance(job, models.RenderStatic)
+	if result.Fields == nil {
+		result.Fields = make(map[string]string)
+	}
+	result.Fields["platform"] = p.Platform
+	result.Fields["username"] = req.Username
+	if p.Avatar != "" {
+		result.Fields["avatar"] = p.Avatar
+	}
+	return &result, nil
+}
@@ -0,0 +1,242 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/compliance"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/policy"
+	"definitelynotaspy/crawler-service/internal/render"
+	"definitelynotaspy/crawler-service/internal/secrets"
+	"definitelynotaspy/crawler-service/internal/spa"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// renderedKey holds in a response's colly context why its body was
+	// replaced by the page as headless Chrome renders it
+	renderedKey = "rendered"
+	// renderAccessKey holds in a request's colly context how the page
+	// reaches the web if it is rendered
+	renderAccessKey = "render_access"
+)
+
+// renderShells returns a response callback that replaces the body of a
+// statically fetched page with the page as headless Chrome renders it, when
+// the static page is a script-rendered shell. Pages with content of their
+// own keep their static body, as do shells that fail to render; rendered is
+// called with how long each page took to render. Pages are loaded as page
+// says: their requests are made through its access, as its emulated
+// device. Renders wait for a browser context as long as ctx allows.
+func (cs *CrawlerService) renderShells(ctx context.Context, page render.Page, rendered func(time.Duration)) colly.ResponseCallback {
+	return func(r *colly.Response) {
+		if r.Request.URL.Scheme != "http" && r.Request.URL.Scheme != "https" || len(r.Body) == 0 {
+			return
+		}
+		if r.Headers != nil {
+			if contentType := r.Headers.Get("Content-Type"); contentType != "" && !strings.Contains(strings.ToLower(contentType), "html") {
+				return
+			}
+		}
+
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+		if err != nil {
+			return
+		}
+		body := doc.Find("body").Clone()
+		body.Find("script, style, noscript, template").Remove()
+		hint, ok := spa.Detect(doc.Selection, body.Text(), string(r.Body))
+		if !ok {
+			return
+		}
+
+		page := page
+		page.URL = r.Request.URL.String()
+		page.UserAgent = r.Request.Headers.Get("User-Agent")
+		start := time.Now()
+		dom, err := cs.renderer.Render(ctx, page)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"url":  page.URL,
+				"hint": hint,
+			}).Warn("Failed to render page, keeping the static fetch")
+			return
+		}
+		r.Body = dom
+		r.Ctx.Put(renderedKey, hint)
+		if rendered != nil {
+			rendered(time.Since(start))
+		}
+	}
+}
+
+// renderFetch returns a response callback that loads a fetched HTML page
+// in headless Chrome as page asks, whether or not the static page is a
+// shell, and when replace is set replaces its body with the rendered DOM.
+// The render, or why it failed, is handed to done.
+func (cs *CrawlerService) renderFetch(ctx context.Context, page render.Page, replace bool, done func(*render.Result, error)) colly.ResponseCallback {
+	return func(r *colly.Response) {
+		if r.Request.URL.Scheme != "http" && r.Request.URL.Scheme != "https" {
+			return
+		}
+		if r.Headers != nil {
+			if contentType := r.Headers.Get("Content-Type"); contentType != "" && !strings.Contains(strings.ToLower(contentType), "html") {
+				return
+			}
+		}
+
+		page.URL = r.Request.URL.String()
+		page.UserAgent = r.Request.Headers.Get("User-Agent")
+		result, err := cs.renderer.Load(ctx, page)
+		if err != nil {
+			done(nil, err)
+			return
+		}
+		if replace {
+			r.Body = result.DOM
+			r.Ctx.Put(renderedKey, "requested")
+		}
+		done(result, nil)
+	}
+}
+
+// renderAccess returns how the pages a crawl renders reach the web: through
+// the crawl's transport, with the crawl's headers and domain credentials,
+// and not where its compliance profile or, when robots is set, robots.txt
+// does not let it go
+func (cs *CrawlerService) renderAccess(req models.CrawlRequest, profile models.ComplianceProfile, transport http.RoundTripper, secretValues map[string]string, robots *crawlDelays) render.Access {
+	return render.Access{
+		Transport: renderTransport{
+			req:      req,
+			secrets:  secretValues,
+			policies: cs.policies,
+			next:     transport,
+		},
+		Allow: func(ctx context.Context, u *url.URL) bool {
+			if compliance.Refuses(profile, u) != "" {
+				return false
+			}
+			return robots == nil || robots.allows(ctx, u)
+		},
+	}
+}
+
+// requestRenderAccess returns the render access a crawl put in a request's
+// context, or access through the operator policies only
+func (cs *CrawlerService) requestRenderAccess(r *colly.Request) render.Access {
+	if access, ok := r.Ctx.GetAny(renderAccessKey).(render.Access); ok {
+		return access
+	}
+	return render.Access{Transport: cs.newBaseTransport()}
+}
+
+// renderEmulation converts a request's emulation settings for the renderer
+func renderEmulation(e *models.RenderEmulation) *render.Emulation {
+	if e == nil {
+		return nil
+	}
+	return &render.Emulation{
+		Width:             e.ViewportWidth,
+		Height:            e.ViewportHeight,
+		DeviceScaleFactor: e.DeviceScaleFactor,
+		Timezone:          e.Timezone,
+		Language:          e.Language,
+	}
+}
+
+// renderTransport sets a crawl's headers on the requests of the pages it
+// renders, as the crawl's own requests get them
+type renderTransport struct {
+	req      models.CrawlRequest
+	secrets  map[string]string
+	policies *policy.Store
+	next     http.RoundTripper
+}
+
+func (t renderTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	if identifying(t.req.Identify) {
+		identify(&r.Header)
+	}
+	for name, value := range t.req.Headers {
+		r.Header.Set(name, secrets.Interpolate(value, t.secrets))
+	}
+	applyDomainHeaders(t.req, t.secrets, r.URL.Hostname(), &r.Header)
+	if profile := t.policies.Current().Profile(r.URL.Hostname()); profile != nil {
+		profile.Apply(&r.Header)
+	}
+	return t.next.RoundTrip(r)
+}
+
+// browserDial returns how the renderer's browser connects to what it
+// reaches by itself, outside the requests of the pages it renders: under
+// the operator's denylist and network policy, as crawls connect
+func browserDial(policies *policy.Store) render.DialFunc {
+	return policies.DialContext
+}
+
+// A rendered page needs rendering when at least renderGainThreshold of its
+// words are missing from its static fetch and it has at least
+// renderGainMinWords more words than that, so pages that only render a
+// cookie banner or a date are not flagged
+const (
+	renderGainThreshold = 0.3
+	renderGainMinWords  = 50
+)
+
+// compareRender compares the text and links of a page fetched statically
+// with those of its rendered DOM
+func compareRender(static, rendered []byte) *models.RenderDiff {
+	staticWords, staticLinks := pageContent(static)
+	renderedWords, renderedLinks := pageContent(rendered)
+
+	seen := make(map[string]bool, len(staticWords))
+	for _, word := range staticWords {
+		seen[word] = true
+	}
+	missing := 0
+	for _, word := range renderedWords {
+		if !seen[word] {
+			missing++
+		}
+	}
+
+	diff := &models.RenderDiff{
+		StaticWords:   len(staticWords),
+		RenderedWords: len(renderedWords),
+		StaticLinks:   staticLinks,
+		RenderedLinks: renderedLinks,
+	}
+	if len(renderedWords) > 0 {
+		diff.Gain = float64(missing) / float64(len(renderedWords))
+	}
+	diff.NeedsRender = diff.Gain >= renderGainThreshold && diff.RenderedWords-diff.StaticWords >= renderGainMinWords
+	return diff
+}
+
+// pageContent returns the lowercased words of a page's visible text and
+// how many distinct links it has
+func pageContent(html []byte) ([]string, int) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		return nil, 0
+	}
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript, template").Remove()
+	words := strings.Fields(strings.ToLower(body.Text()))
+
+	links := make(map[string]bool)
+	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		if href := strings.TrimSpace(a.AttrOr("href", "")); href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			links[href] = true
+		}
+	})
+	return words, len(links)
+}
@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"bytes"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/pipeline"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Replay re-runs extraction over the archived raw HTML of a previous job,
+// producing a new result set without any network access
+func (cs *CrawlerService) Replay(job *models.CrawlJob, parent *models.CrawlJob) error {
+	cs.mu.Lock()
+	job.Status = "running"
+	cs.mu.Unlock()
+	cs.publishStatus(job, "running")
+
+	processors, err := cs.pipeline.Select(job.Processors)
+	if err != nil {
+		return cs.failJob(job, nil, errcode.Wrap(errcode.InvalidRequest, err))
+	}
+
+	parentResults, err := cs.JobResults(parent)
+	if err != nil {
+		return cs.failJob(job, nil, fmt.Errorf("failed to load results of job %s: %w", parent.ID, err))
+	}
+
+	var results []models.CrawlResult
+	for _, prev := range parentResults {
+		if prev.HTMLRef == "" {
+			continue
+		}
+
+		result, err := cs.replayPage(job, processors, prev)
+		if errors.Is(err, pipeline.ErrDrop) {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id": job.ID,
+				"url":    prev.URL,
+			}).Warn("Failed to replay archived page")
+			continue
+		}
+
+		results = append(results, *result)
+		job.PagesCrawled = len(results)
+		job.URLsFound = len(result.Links)
+	}
+
+	cs.mu.Lock()
+	job.Status = "completed"
+	numberResults(job, results)
+	job.Results = results
+	job.CompletedAt = time.Now().UTC()
+	cs.mu.Unlock()
+	cs.publishFinished(job)
+
+	go cs.deliverResults(job, job.Results)
+
+	log.WithFields(log.Fields{
+		"job_id":    job.ID,
+		"replay_of": parent.ID,
+		"pages":     len(results),
+	}).Info("Replay completed")
+
+	return nil
+}
+
+// replayPage runs the extraction pipeline over one archived page
+func (cs *CrawlerService) replayPage(job *models.CrawlJob, processors []pipeline.ResultProcessor, prev models.CrawlResult) (*models.CrawlResult, error) {
+	html, err := cs.archive.Load(prev.HTMLRef)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := htmlElement(prev.URL, html, prev.StatusCode, prev.Depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	var result models.CrawlResult
+	req := models.CrawlRequest{Tenant: job.Tenant, Processors: job.Processors}
+	if err := pipeline.Run(processors, &pipeline.Context{Job: job, Request: &req, Element: e, DiscoveredFrom: prev.DiscoveredFrom}, &result); err != nil {
+		return nil, err
+	}
+	result.CrawledAt = prev.CrawledAt
+	result.HTMLRef = prev.HTMLRef
+	result.HTMLSHA256 = prev.HTMLSHA256
+	result.HTMLTimestamp = prev.HTMLTimestamp
+	result.CID = prev.CID
+	result.Encoding = prev.Encoding
+
+	// Re-extraction keeps how the archived page was originally fetched
+	result.Provenance = cs.provenance(job, models.RenderArchive)
+	if fetched := prev.Provenance; fetched != nil {
+		result.Provenance.UserAgent = fetched.UserAgent
+		result.Provenance.Proxy = fetched.Proxy
+		result.Provenance.FetchedAt = fetched.FetchedAt
+		result.Provenance.FetchDurationMs = fetched.FetchDurationMs
+	}
+
+	return &result, nil
+}
+
+// htmlElement parses a stored HTML document into the element the result
+// pipeline runs on, as if colly had fetched it from pageURL
+func htmlElement(pageURL string, html []byte, status, depth int) (*colly.HTMLElement, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	root := doc.Find("html")
+	if len(root.Nodes) == 0 {
+		return nil, fmt.Errorf("document has no html element")
+	}
+
+	ctx := colly.NewContext()
+	resp := &colly.Response{
+		StatusCode: status,
+		Body:       html,
+		Ctx:        ctx,
+		Request:    &colly.Request{URL: u, Method: "GET", Depth: depth, Ctx: ctx},
+	}
+	return colly.NewHTMLElementFromSelectionNode(resp, root.First(), root.Nodes[0], 0), nil
+}
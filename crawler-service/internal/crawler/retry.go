@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/policy"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Retries of transient failures: requests answered with 429 or a server
+// error, or that timed out or were refused, are retried up to
+// CRAWL_MAX_RETRIES times (default 2, at most 10). The n-th retry waits a
+// random time between half and all of CRAWL_RETRY_BASE_DELAY (default 1s)
+// times 2^n, up to retryMaxDelay, or as long as a Retry-After header asks
+// if that is longer.
+const (
+	defaultMaxRetries     = 2
+	maxMaxRetries         = 10
+	defaultRetryBaseDelay = time.Second
+	retryMaxDelay         = time.Minute
+	// maxFailedURLs bounds the failed URLs recorded on a job; the rest
+	// are only counted in its error counts
+	maxFailedURLs = 1000
+)
+
+// retryAttemptsKey holds in a request's context how often it was retried
+const retryAttemptsKey = "retryAttempts"
+
+// retryPolicy decides whether and when failed requests are retried
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+// jobRetryPolicy returns the retry policy of a crawl: max_retries, capped,
+// or CRAWL_MAX_RETRIES. A negative max_retries turns retries off.
+func jobRetryPolicy(req models.CrawlRequest) retryPolicy {
+	p := retryPolicy{maxRetries: defaultMaxRetries, baseDelay: defaultRetryBaseDelay}
+	if n, err := strconv.Atoi(os.Getenv("CRAWL_MAX_RETRIES")); err == nil && n >= 0 {
+		p.maxRetries = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("CRAWL_RETRY_BASE_DELAY")); err == nil && d > 0 {
+		p.baseDelay = d
+	}
+	switch {
+	case req.MaxRetries < 0:
+		p.maxRetries = 0
+	case req.MaxRetries > 0:
+		p.maxRetries = req.MaxRetries
+	}
+	if p.maxRetries > maxMaxRetries {
+		p.maxRetries = maxMaxRetries
+	}
+	return p
+}
+
+// transientFailure reports whether a failed request may succeed if retried
+func transientFailure(statusCode int, code string) bool {
+	switch {
+	case statusCode == http.StatusTooManyRequests, statusCode >= http.StatusInternalServerError:
+		return true
+	case code == errcode.Timeout, code == errcode.ConnectionRefused:
+		return true
+	}
+	return false
+}
+
+// deniedError reports whether a request was refused before it was sent,
+// rather than failing
+func deniedError(code string) bool {
+	switch code {
+	case errcode.PolicyDenied, errcode.ComplianceDenied, errcode.OutsideWindow, errcode.RobotsBlocked:
+		return true
+	}
+	return false
+}
+
+// delay returns how long to wait before retrying a request retried
+// attempt times before, honouring the response's Retry-After
+func (p retryPolicy) delay(attempt int, h http.Header) time.Duration {
+	d := p.baseDelay << uint(attempt)
+	if d > retryMaxDelay || d <= 0 {
+		d = retryMaxDelay
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if h != nil && strings.TrimSpace(h.Get("Retry-After")) != "" {
+		if after := policy.RetryAfter(h); after > d {
+			d = after
+		}
+	}
+	return d
+}
+
+// retryAttempts returns how often a request was retried
+func retryAttempts(r *colly.Request) int {
+	n, _ := r.Ctx.GetAny(retryAttemptsKey).(int)
+	return n
+}
+
+// retry resubmits a request that failed transiently once its backoff has
+// passed, and reports whether it did. Requests of stopped runs, and those
+// out of retries, are not retried.
+func (cs *CrawlerService) retry(run *activeJob, p retryPolicy, r *colly.Response, code string) bool {
+	attempt := retryAttempts(r.Request)
+	if attempt >= p.maxRetries || !transientFailure(r.StatusCode, code) {
+		return false
+	}
+
+	var h http.Header
+	if r.Headers != nil {
+		h = *r.Headers
+	}
+	timer := time.NewTimer(p.delay(attempt, h))
+	select {
+	case <-timer.C:
+	case <-run.ctx.Done():
+		timer.Stop()
+		return false
+	}
+	cs.touch(run)
+
+	r.Request.Ctx.Put(retryAttemptsKey, attempt+1)
+	return r.Request.Retry() == nil
+}
+
+// failedURL records a request that failed for good
+func failedURL(r *colly.Response, code string, err error) models.FailedURL {
+	return models.FailedURL{
+		URL:        r.Request.URL.String(),
+		StatusCode: r.StatusCode,
+		Error:      err.Error(),
+		ErrorCode:  code,
+		Attempts:   retryAttempts(r.Request) + 1,
+		FailedAt:   time.Now().UTC(),
+	}
+}
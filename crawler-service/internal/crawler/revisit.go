@@ -0,0 +1,139 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/changescore"
+	"definitelynotaspy/crawler-service/internal/dedup"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/pipeline"
+	"definitelynotaspy/crawler-service/internal/revisit"
+	"net/http"
+
+	"github.com/gocolly/colly/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxChangedLines caps the added and removed lines reported of a change
+const maxChangedLines = 50
+
+// monitoredPages returns the pages a monitoring crawl revisits: those
+// earlier crawls under its monitor key saw
+func (cs *CrawlerService) monitoredPages(job *models.CrawlJob, req models.CrawlRequest) []string {
+	if !req.Monitor {
+		return nil
+	}
+	pages := cs.revisits.URLs(job.Tenant, req.MonitorKey)
+	log.WithFields(log.Fields{
+		"job_id":      job.ID,
+		"monitor_key": req.MonitorKey,
+		"pages":       len(pages),
+	}).Info("Revisiting monitored pages")
+	return pages
+}
+
+// conditional makes a monitoring crawl's request for a page it has seen
+// conditional on the page having changed since
+func (cs *CrawlerService) conditional(job *models.CrawlJob, req models.CrawlRequest, r *colly.Request) {
+	if !req.Monitor {
+		return
+	}
+	page, seen := cs.revisits.Get(job.Tenant, req.MonitorKey, r.URL.String())
+	if !seen {
+		return
+	}
+	if page.ETag != "" {
+		r.Headers.Set("If-None-Match", page.ETag)
+	}
+	if page.LastModified != "" {
+		r.Headers.Set("If-Modified-Since", page.LastModified)
+	}
+}
+
+// notModified reports whether a monitoring crawl's conditional request
+// found the page unchanged. Colly hands 304 responses to the error
+// callbacks.
+func notModified(req models.CrawlRequest, r *colly.Response) bool {
+	return req.Monitor && r.StatusCode == http.StatusNotModified
+}
+
+// changesProcessor compares the pages of monitoring crawls with what the
+// monitor last saw of them, and records what it sees now. Pages whose
+// content is the same are skipped as unchanged; new and changed pages
+// carry their change.
+func (cs *CrawlerService) changesProcessor(ctx *pipeline.Context, result *models.CrawlResult) error {
+	req, job := ctx.Request, ctx.Job
+	if !req.Monitor {
+		return nil
+	}
+
+	previous, seen := cs.revisits.Get(job.Tenant, req.MonitorKey, result.URL)
+	if seen && previous.JobID == job.ID {
+		// An earlier run of this job, since restarted, compared the page
+		if previous.Change == nil {
+			return cs.unchanged(job)
+		}
+		result.Change = previous.Change
+		return nil
+	}
+
+	page := revisit.Page{
+		ContentHash: dedup.HashContent(result.Content),
+		Title:       result.Title,
+		Text:        result.Content,
+		CrawledAt:   result.CrawledAt,
+		JobID:       job.ID,
+	}
+	for _, link := range result.Links {
+		page.Links = append(page.Links, link.URL)
+	}
+	if headers := ctx.Element.Response.Headers; headers != nil {
+		page.ETag = headers.Get("ETag")
+		page.LastModified = headers.Get("Last-Modified")
+	}
+
+	switch {
+	case !seen:
+		page.Change = &models.PageChange{Status: models.ChangeNew}
+	case previous.ContentHash != page.ContentHash:
+		page.Change = pageChange(previous, page)
+	}
+	cs.revisits.Put(job.Tenant, req.MonitorKey, result.URL, page)
+
+	if page.Change == nil {
+		return cs.unchanged(job)
+	}
+	result.Change = page.Change
+	return nil
+}
+
+// unchanged counts a page found unchanged and skips it
+func (cs *CrawlerService) unchanged(job *models.CrawlJob) error {
+	cs.mu.Lock()
+	job.PagesUnchanged++
+	cs.mu.Unlock()
+	return pipeline.ErrSkip
+}
+
+// pageChange describes how a page changed from previous to now
+func pageChange(previous, now revisit.Page) *models.PageChange {
+	significance := changescore.Compare(
+		changescore.Snapshot{Text: previous.Text, Links: previous.Links},
+		changescore.Snapshot{Text: now.Text, Links: now.Links},
+	)
+	change := &models.PageChange{
+		Status:       models.ChangeChanged,
+		PreviousHash: previous.ContentHash,
+		Score:        significance.Score,
+		TextChange:   significance.TextChange,
+		NewEntities:  significance.NewEntities,
+		NewDomains:   significance.NewDomains,
+	}
+	if !previous.CrawledAt.IsZero() {
+		crawledAt := previous.CrawledAt
+		change.PreviousCrawledAt = &crawledAt
+	}
+	if previous.Title != now.Title {
+		change.PreviousTitle = previous.Title
+	}
+	change.Added, change.Removed = changescore.Lines(previous.Text, now.Text, maxChangedLines)
+	return change
+}
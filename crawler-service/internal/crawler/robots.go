@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/models"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+const (
+	// maxCrawlDelay caps the Crawl-delay a robots.txt can impose, so a
+	// site cannot hold a crawl up indefinitely
+	maxCrawlDelay = 60 * time.Second
+	// maxRobotsBytes bounds the robots.txt read for its rules
+	maxRobotsBytes = 512 << 10
+	// robotsTimeout bounds the fetch of a robots.txt
+	robotsTimeout = 10 * time.Second
+)
+
+// obeysRobots reports whether a job keeps to robots.txt: always under a
+// compliance profile that requires it, otherwise unless the request opts
+// out with ignore_robots
+func obeysRobots(profile models.ComplianceProfile, req models.CrawlRequest) bool {
+	return profile.RespectRobots || !req.IgnoreRobots
+}
+
+// crawlDelays spaces a crawl's requests to each host by the Crawl-delay of
+// the host's robots.txt. Colly enforces the Disallow rules on the pages it
+// visits; the delay, and the rules for the requests of rendered pages, are
+// read from a separate fetch of the file, once per host.
+type crawlDelays struct {
+	client    *http.Client
+	userAgent string
+
+	mu    sync.Mutex
+	hosts map[string]*hostDelay
+}
+
+// hostDelay is the Crawl-delay of one host and when it next may be asked
+type hostDelay struct {
+	once  sync.Once
+	delay time.Duration
+	// rules are the robots.txt rules for the crawl's user agent; nil
+	// allows everything
+	rules *robotstxt.Group
+	next  time.Time
+}
+
+func newCrawlDelays(transport http.RoundTripper, userAgent string) *crawlDelays {
+	return &crawlDelays{
+		client:    &http.Client{Timeout: robotsTimeout, Transport: transport},
+		userAgent: userAgent,
+		hosts:     make(map[string]*hostDelay),
+	}
+}
+
+// wait blocks until a request to u keeps to its host's Crawl-delay,
+// fetching the host's robots.txt first if it has not been yet. It returns
+// early with the run's error if the run is stopped.
+func (d *crawlDelays) wait(cs *CrawlerService, run *activeJob, u *url.URL) error {
+	h := d.host(run.ctx, u)
+	if h.delay <= 0 {
+		return nil
+	}
+
+	// Reserve the host's next slot, so concurrent requests queue up behind
+	// each other rather than all leaving when the delay is up
+	d.mu.Lock()
+	at := time.Now()
+	if h.next.After(at) {
+		at = h.next
+	}
+	h.next = at.Add(h.delay)
+	d.mu.Unlock()
+
+	for left := time.Until(at); left > 0; left = time.Until(at) {
+		if left > cooldownTouchInterval {
+			left = cooldownTouchInterval
+		}
+		timer := time.NewTimer(left)
+		select {
+		case <-timer.C:
+		case <-run.ctx.Done():
+			timer.Stop()
+			return run.ctx.Err()
+		}
+		cs.touch(run)
+	}
+	return nil
+}
+
+// allows reports whether the robots.txt of u's host lets the crawl's user
+// agent fetch u, fetching the file first if it has not been yet
+func (d *crawlDelays) allows(ctx context.Context, u *url.URL) bool {
+	h := d.host(ctx, u)
+	return h.rules == nil || h.rules.Test(u.EscapedPath())
+}
+
+// host returns the robots.txt settings of u's host, fetched once
+func (d *crawlDelays) host(ctx context.Context, u *url.URL) *hostDelay {
+	origin := u.Scheme + "://" + u.Host
+
+	d.mu.Lock()
+	h, ok := d.hosts[origin]
+	if !ok {
+		h = &hostDelay{}
+		d.hosts[origin] = h
+	}
+	d.mu.Unlock()
+
+	h.once.Do(func() {
+		h.delay, h.rules = d.fetch(ctx, origin)
+	})
+	return h
+}
+
+// fetch returns the Crawl-delay and rules the robots.txt of origin sets for
+// the crawl's user agent; a missing or unreadable file sets neither
+func (d *crawlDelays) fetch(ctx context.Context, origin string) (time.Duration, *robotstxt.Group) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return 0, nil
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsBytes))
+	if err != nil {
+		return 0, nil
+	}
+	var rules *robotstxt.Group
+	if robots, err := robotstxt.FromBytes(body); err == nil {
+		rules = robots.FindGroup(d.userAgent)
+	}
+	return parseCrawlDelay(bytes.NewReader(body), d.userAgent), rules
+}
+
+// parseCrawlDelay reads the Crawl-delay of the robots.txt group that
+// matches userAgent most closely, falling back to the * group. Delays
+// are capped at maxCrawlDelay.
+func parseCrawlDelay(r io.Reader, userAgent string) time.Duration {
+	agent := strings.ToLower(userAgent)
+
+	var (
+		agents   []string
+		inRules  bool
+		best     = -1
+		delay    time.Duration
+		wildcard time.Duration
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "crawl-delay":
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			d := time.Duration(seconds * float64(time.Second))
+			for _, a := range agents {
+				switch {
+				case a == "*":
+					wildcard = d
+				case a != "" && strings.Contains(agent, a) && len(a) > best:
+					best, delay = len(a), d
+				}
+			}
+		default:
+			inRules = true
+		}
+	}
+
+	if best < 0 {
+		delay = wildcard
+	}
+	if delay > maxCrawlDelay {
+		delay = maxCrawlDelay
+	}
+	return delay
+}
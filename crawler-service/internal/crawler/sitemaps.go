@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/discovery"
+	"definitelynotaspy/crawler-service/internal/models"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// discoveryTimeout bounds reading a crawl's sitemaps and feeds
+	discoveryTimeout = 2 * time.Minute
+	// maxDiscoverySeeds is how many seeds have their sitemaps and feeds
+	// read; further seeds are crawled without
+	maxDiscoverySeeds = 10
+)
+
+// discoverSeeds returns the pages the sitemaps and advertised feeds of a
+// crawl's seeds list, most recently changed first, so they are crawled at
+// seed depth. Pages the link filter refuses are left out, and those beyond
+// what max_pages leaves room for are recorded as gaps rather than queued.
+func (cs *CrawlerService) discoverSeeds(ctx context.Context, job *models.CrawlJob, req models.CrawlRequest, transport http.RoundTripper, userAgent string, follow *linkFilter, gaps *coverage, seeds []string) []string {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	d := discovery.New(&http.Client{Timeout: robotsTimeout, Transport: transport}, userAgent)
+	seen := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		seen[seed] = true
+	}
+	room := req.MaxPages - len(seeds)
+	if len(seeds) > maxDiscoverySeeds {
+		seeds = seeds[:maxDiscoverySeeds]
+	}
+
+	var found []string
+	for _, seed := range seeds {
+		for _, entry := range d.Discover(ctx, seed) {
+			if seen[entry.URL] {
+				continue
+			}
+			seen[entry.URL] = true
+			switch {
+			case !follow.allows(entry.URL):
+				gaps.skip(entry.URL, gapFilter)
+			case len(found) >= room:
+				gaps.skip(entry.URL, gapBudget)
+			default:
+				found = append(found, entry.URL)
+			}
+		}
+	}
+
+	cs.mu.Lock()
+	job.SeedsDiscovered = len(found)
+	cs.mu.Unlock()
+	log.WithFields(log.Fields{
+		"job_id":     job.ID,
+		"discovered": len(found),
+	}).Info("Seeded crawl from sitemaps and feeds")
+	return found
+}
@@ -0,0 +1,164 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Adaptive request timeouts: once a host has answered timingMinSamples
+// requests, its requests wait timeoutP95Factor times its p95 response time
+// for response headers, between minRequestTimeout and maxRequestTimeout.
+// Hosts without enough samples get the ceiling.
+const (
+	minRequestTimeout = 5 * time.Second
+	maxRequestTimeout = 30 * time.Second
+	timeoutP95Factor  = 3
+	timingMinSamples  = 5
+	// timingWindow is how many recent response times are kept per host
+	timingWindow = 100
+)
+
+// hostTiming holds the recent response times of one host
+type hostTiming struct {
+	samples  []time.Duration
+	next     int
+	requests int
+	timedOut int
+}
+
+// p95 returns the 95th percentile of the recent response times
+func (h *hostTiming) p95() time.Duration {
+	if len(h.samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), h.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)*95-1)/100]
+}
+
+// timeout returns the time to wait for the host's response headers
+func (h *hostTiming) timeout() time.Duration {
+	if h == nil || len(h.samples) < timingMinSamples {
+		return maxRequestTimeout
+	}
+	t := h.p95() * timeoutP95Factor
+	if t < minRequestTimeout {
+		return minRequestTimeout
+	}
+	if t > maxRequestTimeout {
+		return maxRequestTimeout
+	}
+	return t
+}
+
+// domainTimings tracks response times per host over a crawl
+type domainTimings struct {
+	mu    sync.Mutex
+	hosts map[string]*hostTiming
+}
+
+func newDomainTimings() *domainTimings {
+	return &domainTimings{hosts: make(map[string]*hostTiming)}
+}
+
+func (d *domainTimings) timeout(host string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.hosts[host].timeout()
+}
+
+// record adds a request's outcome; elapsed is only kept for answered
+// requests, so timeouts do not lengthen the host's own timeout
+func (d *domainTimings) record(host string, elapsed time.Duration, timedOut bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h, ok := d.hosts[host]
+	if !ok {
+		h = &hostTiming{}
+		d.hosts[host] = h
+	}
+	h.requests++
+	if timedOut {
+		h.timedOut++
+		return
+	}
+	if len(h.samples) < timingWindow {
+		h.samples = append(h.samples, elapsed)
+		return
+	}
+	h.samples[h.next] = elapsed
+	h.next = (h.next + 1) % timingWindow
+}
+
+// report returns the response time summary of every host
+func (d *domainTimings) report() map[string]models.DomainTiming {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.hosts) == 0 {
+		return nil
+	}
+	report := make(map[string]models.DomainTiming, len(d.hosts))
+	for host, h := range d.hosts {
+		report[host] = models.DomainTiming{
+			Requests:  h.requests,
+			TimedOut:  h.timedOut,
+			P95MS:     h.p95().Milliseconds(),
+			TimeoutMS: h.timeout().Milliseconds(),
+		}
+	}
+	return report
+}
+
+// adaptiveTransport bounds the wait for response headers by the host's
+// adaptive timeout and records how long each host takes to answer. Reading
+// the body is bounded by the collector's request timeout only.
+type adaptiveTransport struct {
+	next    http.RoundTripper
+	timings *domainTimings
+}
+
+func (t adaptiveTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	host := strings.ToLower(r.URL.Hostname())
+	timeout := t.timings.timeout(host)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	timer := time.AfterFunc(timeout, cancel)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r.WithContext(ctx))
+	elapsed := time.Since(start)
+
+	if !timer.Stop() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		t.timings.record(host, 0, true)
+		return nil, fmt.Errorf("no response from %s within %s: %w", host, timeout, context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	t.timings.record(host, elapsed, false)
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
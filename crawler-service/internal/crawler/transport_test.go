@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/policy"
+)
+
+// listen accepts connections on a loopback port, counting them, so a test
+// can tell a refused fetch from one that reached the server
+func listen(t *testing.T) (string, *int32) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var accepted int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), &accepted
+}
+
+// policyService creates a service under the policies written to a
+// temporary POLICY_DIR
+func policyService(t *testing.T, files map[string]string) *CrawlerService {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("POLICY_DIR", dir)
+	return NewCrawlerService()
+}
+
+func TestNonHTTPSchemesFollowPolicy(t *testing.T) {
+	cs := policyService(t, map[string]string{
+		policy.NetworksFile: `{"block_private": true}`,
+		policy.DenylistFile: "denied.example\n",
+	})
+	addr, accepted := listen(t)
+	client := &http.Client{Transport: cs.newBaseTransport()}
+
+	tests := []struct {
+		url  string
+		code string
+	}{
+		{"gopher://" + addr + "/", errcode.PolicyDenied},
+		{"ftp://" + addr + "/", errcode.PolicyDenied},
+		{"gemini://" + addr + "/", errcode.PolicyDenied},
+		{"gopher://denied.example/", errcode.PolicyDenied},
+		{"ftp://denied.example/", errcode.PolicyDenied},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.url)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("%s fetched with status %d", tt.url, resp.StatusCode)
+			continue
+		}
+		if code := errcode.Classify(err, 0); code != tt.code {
+			t.Errorf("%s: error %v classified %s, want %s", tt.url, err, code, tt.code)
+		}
+	}
+	if n := atomic.LoadInt32(accepted); n != 0 {
+		t.Errorf("%d connections reached the private address", n)
+	}
+}
+
+func TestNonHTTPSchemesFollowPublicOnly(t *testing.T) {
+	cs := policyService(t, nil)
+	addr, accepted := listen(t)
+	transport, err := cs.buildTransport(models.CrawlRequest{}, models.ComplianceProfile{PublicOnly: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+
+	for _, u := range []string{"gopher://" + addr + "/", "ftp://" + addr + "/"} {
+		resp, err := client.Get(u)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("%s fetched with status %d", u, resp.StatusCode)
+			continue
+		}
+		if code := errcode.Classify(err, 0); code != errcode.ComplianceDenied {
+			t.Errorf("%s: error %v classified %s, want %s", u, err, code, errcode.ComplianceDenied)
+		}
+	}
+	if n := atomic.LoadInt32(accepted); n != 0 {
+		t.Errorf("%d connections reached the private address", n)
+	}
+
+	// Without the restriction the same fetch connects
+	client.Transport = cs.newBaseTransport()
+	if resp, err := client.Get("gopher://" + addr + "/"); err == nil {
+		resp.Body.Close()
+	}
+	if n := atomic.LoadInt32(accepted); n == 0 {
+		t.Error("unrestricted gopher fetch did not connect")
+	}
+}
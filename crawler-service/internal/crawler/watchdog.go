@@ -0,0 +1,383 @@
+package crawler
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/policy"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Watchdog actions taken when a job stalls
+const (
+	WatchdogActionNone    = "none"
+	WatchdogActionCancel  = "cancel"
+	WatchdogActionRestart = "restart"
+)
+
+// activeJob tracks a crawl that is currently executing
+type activeJob struct {
+	job          *models.CrawlJob
+	req          models.CrawlRequest
+	ctx          context.Context
+	cancel       context.CancelFunc
+	lastActivity time.Time
+	stopReason   string
+}
+
+// register records a job as running and returns its run state
+func (cs *CrawlerService) register(job *models.CrawlJob, req models.CrawlRequest) *activeJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &activeJob{
+		job:          job,
+		req:          req,
+		ctx:          ctx,
+		cancel:       cancel,
+		lastActivity: time.Now(),
+	}
+
+	cs.mu.Lock()
+	cs.active[job.ID] = run
+	cs.mu.Unlock()
+	return run
+}
+
+// unregister removes a job from the running set
+func (cs *CrawlerService) unregister(run *activeJob) {
+	run.cancel()
+
+	cs.mu.Lock()
+	if cs.active[run.job.ID] == run {
+		delete(cs.active, run.job.ID)
+	}
+	cs.mu.Unlock()
+}
+
+// touch records crawl progress, clearing a stalled state
+func (cs *CrawlerService) touch(run *activeJob) {
+	cs.mu.Lock()
+	run.lastActivity = time.Now()
+	resumed := run.job.Status == "stalled"
+	if resumed {
+		run.job.Status = "running"
+	}
+	cs.mu.Unlock()
+
+	if resumed {
+		cs.publishStatus(run.job, "running")
+	}
+}
+
+// stop cancels a running job, recording why
+func (cs *CrawlerService) stop(run *activeJob, reason string) {
+	cs.mu.Lock()
+	if run.stopReason == "" {
+		run.stopReason = reason
+	}
+	cs.mu.Unlock()
+	run.cancel()
+}
+
+// Cancel stops a running crawl at a user's request. In-flight requests are
+// aborted and the job is marked cancelled, keeping and delivering the
+// results collected so far. It reports false if the job is not running in
+// this instance.
+func (cs *CrawlerService) Cancel(job *models.CrawlJob) bool {
+	cs.mu.Lock()
+	run := cs.active[job.ID]
+	cs.mu.Unlock()
+	if run == nil {
+		return false
+	}
+
+	log.WithField("job_id", job.ID).Info("Cancelling running job")
+	cs.stop(run, stopCancelled)
+	return true
+}
+
+// Preempt stops a running crawl so a job of higher priority can have its
+// worker. In-flight requests are aborted and the job is marked paused,
+// keeping its results and frontier so it can be resumed. It reports false
+// if the job is not running in this instance.
+func (cs *CrawlerService) Preempt(job *models.CrawlJob) bool {
+	cs.mu.Lock()
+	run := cs.active[job.ID]
+	cs.mu.Unlock()
+	if run == nil {
+		return false
+	}
+
+	log.WithField("job_id", job.ID).Info("Preempting running job")
+	cs.stop(run, stopPreempted)
+	return true
+}
+
+// runTransport ties the requests of a run to its lifetime, so stopping the
+// run aborts them instead of waiting for slow hosts to answer
+type runTransport struct {
+	next http.RoundTripper
+	run  *activeJob
+}
+
+func (t runTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(r.Context())
+	stop := context.AfterFunc(t.run.ctx, cancel)
+	resp, err := t.next.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		stop()
+		cancel()
+		return nil, err
+	}
+	// The body is still read under the request's context; release it once
+	// the body is closed
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() {
+		stop()
+		cancel()
+	}}
+	return resp, nil
+}
+
+// releasingBody runs release when the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// stopReasonOf returns why a run was stopped, if it was
+func (cs *CrawlerService) stopReasonOf(run *activeJob) string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return run.stopReason
+}
+
+// cooldownTouchInterval is how often a run waiting for a host's cool-down
+// is marked active
+const cooldownTouchInterval = 30 * time.Second
+
+// waitCooldown holds a request of a run while its host cools down after
+// answering 429, or until its profile's next crawl window opens. The run
+// counts as active while it waits, so the watchdog does not take a paused
+// host for a stall.
+func (cs *CrawlerService) waitCooldown(run *activeJob, host string) error {
+	for left := cs.holdLeft(run.ctx, host); left > 0; left = cs.holdLeft(run.ctx, host) {
+		if left > cooldownTouchInterval {
+			left = cooldownTouchInterval
+		}
+		timer := time.NewTimer(left)
+		select {
+		case <-timer.C:
+		case <-run.ctx.Done():
+			timer.Stop()
+			return run.ctx.Err()
+		}
+		cs.touch(run)
+	}
+	return nil
+}
+
+// holdLeft returns how long requests to host are held back
+func (cs *CrawlerService) holdLeft(ctx context.Context, host string) time.Duration {
+	left := cs.policies.CooldownLeft(ctx, host)
+	if wait := cs.policies.WindowWait(host); wait > left {
+		left = wait
+	}
+	return left
+}
+
+// coolDown pauses the host of a response refused with 429 for as long as
+// its Retry-After asks, across every job
+func (cs *CrawlerService) coolDown(r *colly.Response) {
+	var h http.Header
+	if r.Headers != nil {
+		h = *r.Headers
+	}
+	cs.policies.CoolDown(r.Request.URL.Hostname(), policy.RetryAfter(h))
+}
+
+// Checkpoint stops every running crawl, keeping its results and recording
+// its frontier so it can be continued later, and returns the IDs of the
+// jobs stopped. Monitors are left running.
+func (cs *CrawlerService) Checkpoint() []string {
+	cs.mu.Lock()
+	runs := make([]*activeJob, 0, len(cs.active))
+	for _, run := range cs.active {
+		runs = append(runs, run)
+	}
+	cs.mu.Unlock()
+
+	ids := make([]string, 0, len(runs))
+	for _, run := range runs {
+		cs.stop(run, stopCheckpoint)
+		ids = append(ids, run.job.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Running returns the number of crawls currently executing
+func (cs *CrawlerService) Running() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return len(cs.active)
+}
+
+// stopGracePeriod is how long a stopped run may wait for in-flight requests
+const stopGracePeriod = 5 * time.Second
+
+// waitCollector waits for the collector to finish. Once the run is stopped
+// it waits at most stopGracePeriod and returns a snapshot of the results,
+// leaving any hung requests behind.
+func (cs *CrawlerService) waitCollector(c *colly.Collector, run *activeJob, mu *sync.Mutex, results *[]models.CrawlResult) []models.CrawlResult {
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-run.ctx.Done():
+		select {
+		case <-done:
+		case <-time.After(stopGracePeriod):
+			log.WithField("job_id", run.job.ID).Warn("Abandoning in-flight requests of stopped job")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]models.CrawlResult(nil), (*results)...)
+}
+
+// jobMaxRuntime returns the wall-clock ceiling for a job: JOB_MAX_RUNTIME
+// (default 2h), lowered by a smaller per-request limit
+func jobMaxRuntime(requestedSeconds int) time.Duration {
+	limit := JobMaxRuntime()
+	if requested := time.Duration(requestedSeconds) * time.Second; requested > 0 && requested < limit {
+		return requested
+	}
+	return limit
+}
+
+// JobMaxRuntime returns the deployment's runtime ceiling for jobs,
+// JOB_MAX_RUNTIME (default 2h)
+func JobMaxRuntime() time.Duration {
+	limit := 2 * time.Hour
+	if d, err := time.ParseDuration(os.Getenv("JOB_MAX_RUNTIME")); err == nil && d > 0 {
+		limit = d
+	}
+	return limit
+}
+
+// watchdogConfig holds stall detection settings
+type watchdogConfig struct {
+	stallAfter  time.Duration
+	action      string
+	maxRestarts int
+}
+
+func watchdogConfigFromEnv() watchdogConfig {
+	cfg := watchdogConfig{
+		stallAfter:  5 * time.Minute,
+		action:      WatchdogActionNone,
+		maxRestarts: 1,
+	}
+	if d, err := time.ParseDuration(os.Getenv("WATCHDOG_STALL_AFTER")); err == nil && d > 0 {
+		cfg.stallAfter = d
+	}
+	switch a := os.Getenv("WATCHDOG_ACTION"); a {
+	case WatchdogActionCancel, WatchdogActionRestart:
+		cfg.action = a
+	}
+	if n, err := strconv.Atoi(os.Getenv("WATCHDOG_MAX_RESTARTS")); err == nil && n >= 0 {
+		cfg.maxRestarts = n
+	}
+	return cfg
+}
+
+// StartWatchdog periodically marks running jobs without recent progress as
+// stalled, publishes an alert event and applies the configured action
+func (cs *CrawlerService) StartWatchdog(ctx context.Context) {
+	cfg := watchdogConfigFromEnv()
+	interval := cfg.stallAfter / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	log.WithFields(log.Fields{
+		"stall_after": cfg.stallAfter.String(),
+		"action":      cfg.action,
+	}).Info("Job watchdog started")
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				cs.checkStalled(cfg)
+			}
+		}
+	}()
+}
+
+func (cs *CrawlerService) checkStalled(cfg watchdogConfig) {
+	var stalled []*activeJob
+
+	cs.mu.Lock()
+	for _, run := range cs.active {
+		if run.job.Status == "running" && time.Since(run.lastActivity) >= cfg.stallAfter {
+			run.job.Status = "stalled"
+			stalled = append(stalled, run)
+		}
+	}
+	cs.mu.Unlock()
+
+	for _, run := range stalled {
+		idle := time.Since(run.lastActivity).Round(time.Second)
+
+		log.WithFields(log.Fields{
+			"job_id": run.job.ID,
+			"idle":   idle.String(),
+			"action": cfg.action,
+		}).Warn("Job stalled")
+
+		cs.events.Publish(events.Event{
+			Type:   events.JobStalled,
+			JobID:  run.job.ID,
+			Tenant: run.job.Tenant,
+			Data: map[string]interface{}{
+				"idle_seconds":  int(idle.Seconds()),
+				"pages_crawled": run.job.PagesCrawled,
+				"action":        cfg.action,
+			},
+		})
+
+		switch {
+		case cfg.action == WatchdogActionCancel:
+			cs.stop(run, stopStalled)
+		case cfg.action == WatchdogActionRestart && run.job.Restarts < cfg.maxRestarts:
+			cs.stop(run, stopRestart)
+		case cfg.action == WatchdogActionRestart:
+			cs.stop(run, stopStalled)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/secrets"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// startWebhooks subscribes the job's webhooks to the event bus. The returned
+// function flushes and removes them; it is safe to call more than once.
+func (cs *CrawlerService) startWebhooks(job *models.CrawlJob, req models.CrawlRequest, secretValues map[string]string) func() {
+	var hooks []*events.BatchWebhook
+	var unsubscribe []func()
+	for _, hook := range req.Webhooks {
+		w := events.NewBatchWebhook(
+			cs.delivery,
+			hook.URL,
+			secrets.Interpolate(hook.Secret, secretValues),
+			job.ID,
+			hook.BatchSize,
+			time.Duration(hook.BatchSeconds)*time.Second,
+			webhookFilter(hook),
+		)
+		hooks = append(hooks, w)
+		unsubscribe = append(unsubscribe, cs.events.Subscribe(w.Handle))
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			for i, w := range hooks {
+				unsubscribe[i]()
+				w.Close()
+			}
+		})
+	}
+}
+
+// publishPage announces a crawled page to the job's subscribers
+func (cs *CrawlerService) publishPage(job *models.CrawlJob, result models.CrawlResult) {
+	cs.events.Publish(events.Event{
+		Type:   events.PageCrawled,
+		JobID:  job.ID,
+		Tenant: job.Tenant,
+		Data:   map[string]interface{}{"result": result},
+	})
+}
+
+// publishStatus announces that a running job changed status
+func (cs *CrawlerService) publishStatus(job *models.CrawlJob, status string) {
+	cs.events.Publish(events.Event{
+		Type:   events.JobStatusChanged,
+		JobID:  job.ID,
+		Tenant: job.Tenant,
+		Data:   map[string]interface{}{"status": status},
+	})
+}
+
+// publishDiscovered announces a URL a crawl queued, and the page it was
+// found on
+func (cs *CrawlerService) publishDiscovered(job *models.CrawlJob, link, from string) {
+	cs.events.Publish(events.Event{
+		Type:   events.URLDiscovered,
+		JobID:  job.ID,
+		Tenant: job.Tenant,
+		Data:   map[string]interface{}{"url": link, "from": from},
+	})
+}
+
+// publishFailed announces a page that could not be crawled
+func (cs *CrawlerService) publishFailed(job *models.CrawlJob, link string, statusCode int, code string, err error) {
+	cs.events.Publish(events.Event{
+		Type:   events.PageFailed,
+		JobID:  job.ID,
+		Tenant: job.Tenant,
+		Data: map[string]interface{}{
+			"url":         link,
+			"status_code": statusCode,
+			"error_code":  code,
+			"error":       err.Error(),
+		},
+	})
+}
+
+// publishFinished announces that a job reached a final status, reports its
+// metrics and calls its callback URL back
+func (cs *CrawlerService) publishFinished(job *models.CrawlJob) {
+	cs.mu.Lock()
+	data := map[string]interface{}{
+		"status":        job.Status,
+		"pages_crawled": job.PagesCrawled,
+		"partial":       job.Partial,
+	}
+	if job.Error != "" {
+		data["error"] = job.Error
+		data["error_code"] = job.ErrorCode
+	}
+	cs.mu.Unlock()
+
+	cs.events.Publish(events.Event{
+		Type:   events.JobFinished,
+		JobID:  job.ID,
+		Tenant: job.Tenant,
+		Data:   data,
+	})
+	cs.reportMetrics(job)
+	cs.notifyCallback(job)
+}
+
+// webhookFilter accepts the event types a webhook asked for and, for page
+// events, only pages matching its domain, quality and keyword criteria
+func webhookFilter(hook models.Webhook) func(events.Event) bool {
+	// Progress events are for live streams, not webhooks
+	types := map[string]bool{events.PageCrawled: true, events.JobFinished: true}
+	if len(hook.Events) > 0 {
+		types = map[string]bool{}
+		for _, t := range hook.Events {
+			types[t] = true
+		}
+	}
+	keywords := make([]string, len(hook.Keywords))
+	for i, k := range hook.Keywords {
+		keywords[i] = strings.ToLower(k)
+	}
+
+	return func(e events.Event) bool {
+		if !types[e.Type] {
+			return false
+		}
+		if e.Type != events.PageCrawled {
+			return true
+		}
+		result, ok := e.Data["result"].(models.CrawlResult)
+		if !ok {
+			return false
+		}
+		if len(hook.Domains) > 0 && !onDomain(result.URL, hook.Domains) {
+			return false
+		}
+		if result.QualityScore < hook.MinQuality {
+			return false
+		}
+		if len(keywords) > 0 {
+			text := strings.ToLower(result.Title + "\n" + result.Content)
+			for _, k := range keywords {
+				if strings.Contains(text, k) {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	}
+}
+
+// onDomain reports whether a URL's host is one of the domains or a subdomain
+// of one
+func onDomain(rawURL string, domains []string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "www."))
+		if host == d || strings.HasSuffix(host, "."+d) || host == "www."+d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package ctlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Certificate is a logged certificate as reported by crt.sh
+type Certificate struct {
+	ID         int64     `json:"id"`
+	Issuer     string    `json:"issuer"`
+	CommonName string    `json:"common_name"`
+	Names      []string  `json:"names"`
+	Serial     string    `json:"serial"`
+	NotBefore  time.Time `json:"not_before"`
+	NotAfter   time.Time `json:"not_after"`
+	LoggedAt   time.Time `json:"logged_at"`
+}
+
+// Client queries the crt.sh certificate transparency search
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClientFromEnv creates a client for CRTSH_URL (default https://crt.sh)
+func NewClientFromEnv() *Client {
+	baseURL := os.Getenv("CRTSH_URL")
+	if baseURL == "" {
+		baseURL = "https://crt.sh"
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		// crt.sh is slow for broad patterns
+		http: &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+type crtshEntry struct {
+	ID             int64  `json:"id"`
+	IssuerName     string `json:"issuer_name"`
+	CommonName     string `json:"common_name"`
+	NameValue      string `json:"name_value"`
+	SerialNumber   string `json:"serial_number"`
+	NotBefore      string `json:"not_before"`
+	NotAfter       string `json:"not_after"`
+	EntryTimestamp string `json:"entry_timestamp"`
+}
+
+// Search returns certificates whose names match pattern, where a leading
+// "*." matches any subdomain (e.g. *.example.com)
+func (c *Client) Search(ctx context.Context, pattern string) ([]Certificate, error) {
+	q := url.Values{
+		"q":       {strings.ReplaceAll(pattern, "*", "%")},
+		"output":  {"json"},
+		"exclude": {"expired"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("crt.sh returned %d: %s", resp.StatusCode, body)
+	}
+
+	var entries []crtshEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid crt.sh response: %w", err)
+	}
+
+	certs := make([]Certificate, 0, len(entries))
+	for _, e := range entries {
+		certs = append(certs, Certificate{
+			ID:         e.ID,
+			Issuer:     e.IssuerName,
+			CommonName: e.CommonName,
+			Names:      splitNames(e.NameValue),
+			Serial:     e.SerialNumber,
+			NotBefore:  parseTime(e.NotBefore),
+			NotAfter:   parseTime(e.NotAfter),
+			LoggedAt:   parseTime(e.EntryTimestamp),
+		})
+	}
+	return certs, nil
+}
+
+// Hosts returns the distinct host names a certificate covers, with
+// wildcard labels removed
+func (cert Certificate) Hosts() []string {
+	seen := make(map[string]bool)
+	for _, name := range append([]string{cert.CommonName}, cert.Names...) {
+		host := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "*.")
+		if host != "" && !strings.ContainsAny(host, " @/") {
+			seen[host] = true
+		}
+	}
+
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func splitNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseTime parses crt.sh timestamps, which are UTC without a zone
+func parseTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,280 @@
+// Package custody writes chain-of-custody evidence bundles: a job's
+// results with their archived pages, content digests, provenance and
+// trusted timestamp tokens, inventoried in a manifest signed with the
+// service key so a recipient can verify nothing was added, removed or
+// altered since export.
+package custody
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format version written to the manifest
+const Version = 1
+
+// Well-known entries in an evidence bundle
+const (
+	ManifestFile  = "manifest.json"
+	SignatureFile = "manifest.sig"
+	jobFile       = "job.json"
+	resultsFile   = "results.json"
+	htmlDir       = "html/"
+	timestampDir  = "timestamps/"
+)
+
+// Signer signs manifests with the service's Ed25519 key
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSignerFromEnv loads the PEM (PKCS #8) Ed25519 private key in the file
+// SERVICE_SIGNING_KEY_FILE. It returns nil without an error when the
+// variable is unset.
+func NewSignerFromEnv() (*Signer, error) {
+	path := os.Getenv("SERVICE_SIGNING_KEY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key file holds no PEM block")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key must be an Ed25519 key")
+	}
+	return NewSigner(key), nil
+}
+
+// NewSigner returns a signer for key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	pub := key.Public().(ed25519.PublicKey)
+	sum := sha256.Sum256(pub)
+	return &Signer{key: key, keyID: hex.EncodeToString(sum[:8])}
+}
+
+// PublicKey describes the key manifests are signed with
+type PublicKey struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	// Key is the base64 raw Ed25519 public key
+	Key string `json:"key"`
+	// PEM is the key as a PKIX public key
+	PEM string `json:"pem"`
+}
+
+// PublicKey returns the verification key
+func (s *Signer) PublicKey() PublicKey {
+	pub := s.key.Public().(ed25519.PublicKey)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	return PublicKey{
+		Algorithm: "ed25519",
+		KeyID:     s.keyID,
+		Key:       base64.StdEncoding.EncodeToString(pub),
+		PEM:       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+}
+
+// Manifest inventories an evidence bundle. manifest.sig holds the base64
+// Ed25519 signature of the exact bytes of manifest.json.
+type Manifest struct {
+	Version    int       `json:"version"`
+	JobID      string    `json:"job_id"`
+	Tenant     string    `json:"tenant,omitempty"`
+	CaseID     string    `json:"case_id,omitempty"`
+	Query      string    `json:"query"`
+	ExportedAt time.Time `json:"exported_at"`
+	ExportedBy string    `json:"exported_by,omitempty"`
+	// Service identifies the build and worker that produced the export
+	Service    string    `json:"service"`
+	SigningKey PublicKey `json:"signing_key"`
+	// Files lists every other entry of the bundle with its digest
+	Files []File `json:"files"`
+	// Evidence links each result to its archived page and timestamp
+	Evidence []Evidence `json:"evidence"`
+}
+
+// File is one inventoried entry of a bundle
+type File struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// Evidence ties a collected page to its integrity proofs
+type Evidence struct {
+	URL        string             `json:"url"`
+	CrawledAt  time.Time          `json:"crawled_at"`
+	StatusCode int                `json:"status_code"`
+	Provenance *models.Provenance `json:"provenance,omitempty"`
+	// HTML is the bundle path of the archived page (gzipped) and
+	// HTMLSHA256 the digest of its decompressed content
+	HTML       string `json:"html,omitempty"`
+	HTMLSHA256 string `json:"html_sha256,omitempty"`
+	// Timestamp is the bundle path of the DER RFC 3161 token for
+	// HTMLSHA256, issued by TimestampAuthority at TimestampedAt
+	Timestamp          string     `json:"timestamp,omitempty"`
+	TimestampAuthority string     `json:"timestamp_authority,omitempty"`
+	TimestampedAt      *time.Time `json:"timestamped_at,omitempty"`
+}
+
+// Export is the content of an evidence bundle
+type Export struct {
+	Job     models.CrawlJob
+	Results []models.CrawlResult
+	// HTML maps archive references to gzipped archived pages
+	HTML       map[string][]byte
+	ExportedBy string
+	Service    string
+}
+
+// Write encodes an evidence bundle as a zstd-compressed tar stream and
+// returns its signed manifest
+func Write(w io.Writer, e *Export, signer *Signer) (*Manifest, error) {
+	job := e.Job
+	job.Results = nil
+	job.ResultsRef = ""
+	job.Cookies = nil
+
+	manifest := &Manifest{
+		Version:    Version,
+		JobID:      job.ID,
+		Tenant:     job.Tenant,
+		CaseID:     job.CaseID,
+		Query:      job.Query,
+		ExportedAt: time.Now().UTC(),
+		ExportedBy: e.ExportedBy,
+		Service:    e.Service,
+		SigningKey: signer.PublicKey(),
+		Files:      []File{},
+		Evidence:   make([]Evidence, 0, len(e.Results)),
+	}
+
+	files := make(map[string][]byte)
+	add := func(path string, data []byte) {
+		files[path] = data
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, File{Path: path, SHA256: hex.EncodeToString(sum[:]), Size: len(data)})
+	}
+
+	for _, entry := range []struct {
+		name  string
+		value interface{}
+	}{{jobFile, job}, {resultsFile, e.Results}} {
+		data, err := json.MarshalIndent(entry.value, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", entry.name, err)
+		}
+		add(entry.name, data)
+	}
+
+	for i, r := range e.Results {
+		ev := Evidence{
+			URL:        r.URL,
+			CrawledAt:  r.CrawledAt,
+			StatusCode: r.StatusCode,
+			Provenance: r.Provenance,
+			HTMLSHA256: r.HTMLSHA256,
+		}
+		if data, ok := e.HTML[r.HTMLRef]; ok && r.HTMLRef != "" {
+			ev.HTML = htmlDir + r.HTMLRef
+			if _, done := files[ev.HTML]; !done {
+				add(ev.HTML, data)
+			}
+		}
+		if ts := r.HTMLTimestamp; ts != nil {
+			ev.Timestamp = fmt.Sprintf("%s%d-%s.tsr", timestampDir, i, shortDigest(r.HTMLSHA256))
+			ev.TimestampAuthority = ts.Authority
+			genTime := ts.GenTime
+			ev.TimestampedAt = &genTime
+			add(ev.Timestamp, ts.Token)
+		}
+		manifest.Evidence = append(manifest.Evidence, ev)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(signer.key, manifestData))
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(zw)
+	if err := writeFile(tw, ManifestFile, manifestData, manifest.ExportedAt); err != nil {
+		return nil, err
+	}
+	if err := writeFile(tw, SignatureFile, []byte(signature+"\n"), manifest.ExportedAt); err != nil {
+		return nil, err
+	}
+	for _, f := range manifest.Files {
+		if err := writeFile(tw, f.Path, files[f.Path], manifest.ExportedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, zw.Close()
+}
+
+// Digest returns the SHA-256 digest of a manifest as written, for
+// recording the export in the audit trail
+func Digest(m *Manifest) string {
+	data, _ := json.MarshalIndent(m, "", "  ")
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func shortDigest(digest string) string {
+	if digest == "" {
+		return "unhashed"
+	}
+	if len(digest) > 16 {
+		return digest[:16]
+	}
+	return digest
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	_, err := tw.Write(data)
+	return err
+}
@@ -34,6 +34,8 @@ func InitRedis() error {
 	_, err := rdb.Ping(ctx).Result()
 	if err != nil {
 		log.WithError(err).Error("Failed to connect to Redis")
+		rdb.Close()
+		rdb = nil
 		return err
 	}
 
@@ -41,7 +43,7 @@ func InitRedis() error {
 	return nil
 }
 
-// GetRedisClient returns the Redis client
+// GetRedisClient returns the Redis client, or nil if Redis is not connected
 func GetRedisClient() *redis.Client {
 	return rdb
 }
@@ -49,7 +51,9 @@ func GetRedisClient() *redis.Client {
 // CloseRedis closes the Redis connection
 func CloseRedis() error {
 	if rdb != nil {
-		return rdb.Close()
+		err := rdb.Close()
+		rdb = nil
+		return err
 	}
 	return nil
 }
@@ -0,0 +1,152 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// jobScopeTTL is how long the index of a single job's pages is kept in
+// Redis after it was last added to
+const jobScopeTTL = 7 * 24 * time.Hour
+
+// jobScopePrefix starts the scopes of single jobs; other scopes are tenants
+const jobScopePrefix = "job:"
+
+// ContentIndex records content hashes per scope, a tenant or a single job,
+// so pages already seen in the scope can be recognised. It uses Redis when
+// connected and falls back to an in-process map otherwise.
+type ContentIndex struct {
+	mu        sync.Mutex
+	hashes    map[string]map[string]string
+	simHashes map[string]map[string][]simEntry
+}
+
+// NewContentIndex creates a new content-hash index
+func NewContentIndex() *ContentIndex {
+	return &ContentIndex{
+		hashes:    make(map[string]map[string]string),
+		simHashes: make(map[string]map[string][]simEntry),
+	}
+}
+
+// JobScope returns the scope of the pages of a single job
+func JobScope(jobID string) string {
+	return jobScopePrefix + jobID
+}
+
+// expire lets the Redis index of a job scope lapse once the job is over
+func expire(ctx context.Context, rdb *redis.Client, scope, key string) {
+	if strings.HasPrefix(scope, jobScopePrefix) {
+		rdb.Expire(ctx, key, jobScopeTTL)
+	}
+}
+
+// HashContent returns the hex SHA-256 of whitespace-normalised content
+func HashContent(content string) string {
+	normalized := strings.Join(strings.Fields(content), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// Record stores hash in scope, pointing at url. If the hash was already
+// recorded it returns the URL of the first page seen with that content.
+func (ci *ContentIndex) Record(scope, hash, url string) (firstURL string, seen bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		firstURL, seen, err := recordRedis(scope, hash, url)
+		if err == nil {
+			return firstURL, seen
+		}
+		log.WithError(err).Warn("Content index lookup failed, using in-memory index")
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	scopeHashes, ok := ci.hashes[scope]
+	if !ok {
+		scopeHashes = make(map[string]string)
+		ci.hashes[scope] = scopeHashes
+	}
+	if existing, ok := scopeHashes[hash]; ok {
+		return existing, true
+	}
+	scopeHashes[hash] = url
+	return url, false
+}
+
+func recordRedis(scope, hash, url string) (string, bool, error) {
+	ctx := context.Background()
+	rdb := database.GetRedisClient()
+	key := "content_hashes:" + scope
+
+	added, err := rdb.HSetNX(ctx, key, hash, url).Result()
+	if err != nil {
+		return "", false, err
+	}
+	if added {
+		expire(ctx, rdb, scope, key)
+		return url, false, nil
+	}
+
+	existing, err := rdb.HGet(ctx, key, hash).Result()
+	if err != nil {
+		return "", false, err
+	}
+	return existing, true, nil
+}
+
+// Forget removes hash for the tenant if it still points at url, so a purged
+// page no longer marks later copies as duplicates. It reports whether an
+// entry was removed.
+func (ci *ContentIndex) Forget(tenant, hash, url string) bool {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		key := "content_hashes:" + tenant
+		existing, err := rdb.HGet(ctx, key, hash).Result()
+		if err == nil {
+			if existing != url {
+				return false
+			}
+			var removed int64
+			if removed, err = rdb.HDel(ctx, key, hash).Result(); err == nil {
+				return removed > 0
+			}
+		}
+		if err != redis.Nil {
+			log.WithError(err).Warn("Content index removal failed, using in-memory index")
+		}
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	tenantHashes := ci.hashes[tenant]
+	if tenantHashes == nil || tenantHashes[hash] != url {
+		return false
+	}
+	delete(tenantHashes, hash)
+	return true
+}
+
+// ForgetScope drops everything recorded in scope
+func (ci *ContentIndex) ForgetScope(scope string) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if err := rdb.Del(context.Background(), "content_hashes:"+scope, "content_simhashes:"+scope).Err(); err != nil {
+			log.WithError(err).WithField("scope", scope).Warn("Failed to clear content index")
+		}
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	delete(ci.hashes, scope)
+	delete(ci.simHashes, scope)
+}
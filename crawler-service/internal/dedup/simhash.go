@@ -0,0 +1,190 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// NearDistance is the most bits in which the SimHashes of near
+	// duplicates differ
+	NearDistance = 3
+	// minSimHashWords is the fewest words content needs for a meaningful
+	// SimHash; thinner pages are only compared exactly
+	minSimHashWords = 20
+	// shingleSize is how many consecutive words are hashed together
+	shingleSize = 3
+	// maxBucketEntries bounds the pages kept per SimHash band value
+	maxBucketEntries = 32
+)
+
+// SimHash returns the 64-bit SimHash of content's word shingles. Pages
+// whose content differs only in a few words, such as dates or navigation,
+// get hashes differing in a few bits. ok is false for content too short to
+// compare this way.
+func SimHash(content string) (hash uint64, ok bool) {
+	words := strings.Fields(strings.ToLower(content))
+	if len(words) < minSimHashWords {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	for bit, w := range weights {
+		if w > 0 {
+			hash |= 1 << uint(bit)
+		}
+	}
+	return hash, true
+}
+
+// bands splits a SimHash into four 16-bit bands. Hashes within
+// NearDistance bits of each other share at least one band, so only pages
+// sharing a band need comparing.
+func bands(hash uint64) []string {
+	keys := make([]string, 4)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%d:%04x", i, uint16(hash>>(16*uint(i))))
+	}
+	return keys
+}
+
+type simEntry struct {
+	hash uint64
+	url  string
+}
+
+func (e simEntry) String() string {
+	return strconv.FormatUint(e.hash, 16) + " " + e.url
+}
+
+func parseSimEntries(raw string) []simEntry {
+	var entries []simEntry
+	for _, line := range strings.Split(raw, "\n") {
+		h, u, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		hash, err := strconv.ParseUint(h, 16, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, simEntry{hash: hash, url: u})
+	}
+	return entries
+}
+
+// nearest returns the entry closest to hash among candidates, if one is
+// within NearDistance bits and is not url itself
+func nearest(candidates []simEntry, hash uint64, url string) (simEntry, bool) {
+	best, found := simEntry{}, false
+	bestDistance := NearDistance + 1
+	for _, e := range candidates {
+		if e.url == url {
+			continue
+		}
+		if d := bits.OnesCount64(e.hash ^ hash); d < bestDistance {
+			best, bestDistance, found = e, d, true
+		}
+	}
+	return best, found
+}
+
+// RecordNear stores a page's SimHash in scope, returning the URL of a page
+// recorded before whose content is a near duplicate of it
+func (ci *ContentIndex) RecordNear(scope string, hash uint64, url string) (firstURL string, seen bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		firstURL, seen, err := recordNearRedis(rdb, scope, hash, url)
+		if err == nil {
+			return firstURL, seen
+		}
+		log.WithError(err).Warn("Near-duplicate lookup failed, using in-memory index")
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	buckets, ok := ci.simHashes[scope]
+	if !ok {
+		buckets = make(map[string][]simEntry)
+		ci.simHashes[scope] = buckets
+	}
+	var candidates []simEntry
+	for _, band := range bands(hash) {
+		candidates = append(candidates, buckets[band]...)
+	}
+	if e, ok := nearest(candidates, hash, url); ok {
+		return e.url, true
+	}
+	for _, band := range bands(hash) {
+		if len(buckets[band]) < maxBucketEntries {
+			buckets[band] = append(buckets[band], simEntry{hash: hash, url: url})
+		}
+	}
+	return url, false
+}
+
+// recordNearRedis keeps each band's pages in a field of the scope's hash.
+// Concurrent records of a band may drop one another's entry, which only
+// lets a near duplicate through.
+func recordNearRedis(rdb *redis.Client, scope string, hash uint64, url string) (string, bool, error) {
+	ctx := context.Background()
+	key := "content_simhashes:" + scope
+	keys := bands(hash)
+
+	values, err := rdb.HMGet(ctx, key, keys...).Result()
+	if err != nil {
+		return "", false, err
+	}
+	buckets := make([][]simEntry, len(keys))
+	var candidates []simEntry
+	for i, v := range values {
+		if raw, ok := v.(string); ok {
+			buckets[i] = parseSimEntries(raw)
+			candidates = append(candidates, buckets[i]...)
+		}
+	}
+	if e, ok := nearest(candidates, hash, url); ok {
+		return e.url, true, nil
+	}
+
+	fields := make(map[string]interface{}, len(keys))
+	for i, band := range keys {
+		if len(buckets[i]) >= maxBucketEntries {
+			continue
+		}
+		entries := append(buckets[i], simEntry{hash: hash, url: url})
+		lines := make([]string, len(entries))
+		for j, e := range entries {
+			lines[j] = e.String()
+		}
+		fields[band] = strings.Join(lines, "\n")
+	}
+	if len(fields) > 0 {
+		if err := rdb.HSet(ctx, key, fields).Err(); err != nil {
+			return "", false, err
+		}
+	}
+	expire(ctx, rdb, scope, key)
+	return url, false, nil
+}
@@ -0,0 +1,329 @@
+// Package discovery finds the pages a site lists in its sitemaps and feeds,
+// so a crawl can start from them rather than reach them link by link.
+// Sitemaps are read from /sitemap.xml and the Sitemap lines of robots.txt,
+// following sitemap indexes and gzipped sitemaps; feeds are the RSS and
+// Atom feeds a page advertises in its head.
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// maxDocumentBytes bounds a sitemap, feed or page read, uncompressed;
+	// sitemaps may be 50MB
+	maxDocumentBytes = 50 << 20
+	// maxSitemaps bounds how many sitemaps are read per site, counting
+	// those listed in indexes
+	maxSitemaps = 50
+	// maxIndexDepth is how deep sitemap indexes are followed
+	maxIndexDepth = 2
+	// maxFeeds bounds how many advertised feeds are read per page
+	maxFeeds = 5
+)
+
+// feedTypes are the link types of advertised feeds
+var feedTypes = map[string]bool{
+	"application/rss+xml":  true,
+	"application/atom+xml": true,
+	"application/rdf+xml":  true,
+}
+
+// Entry is a page listed in a sitemap or feed, with when it last changed if
+// the listing says
+type Entry struct {
+	URL      string
+	Modified time.Time
+}
+
+// Discoverer reads sitemaps and feeds over an HTTP client
+type Discoverer struct {
+	client    *http.Client
+	userAgent string
+}
+
+// New returns a discoverer sending its requests with client as userAgent
+func New(client *http.Client, userAgent string) *Discoverer {
+	return &Discoverer{client: client, userAgent: userAgent}
+}
+
+// Discover returns the pages on the host of seed that its sitemaps and the
+// feeds the seed page advertises list, most recently changed first and
+// undated ones last. Sources that cannot be read are skipped.
+func (d *Discoverer) Discover(ctx context.Context, seed string) []Entry {
+	u, err := url.Parse(seed)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+	origin := u.Scheme + "://" + u.Host
+
+	var found []Entry
+	sitemaps := append([]string{origin + "/sitemap.xml"}, d.robotsSitemaps(ctx, origin)...)
+	read := make(map[string]bool)
+	for _, sitemap := range sitemaps {
+		found = append(found, d.sitemap(ctx, sitemap, 0, read)...)
+	}
+	for _, feed := range d.feedLinks(ctx, u) {
+		found = append(found, d.feed(ctx, feed)...)
+	}
+
+	seen := make(map[string]bool, len(found))
+	kept := found[:0]
+	for _, e := range found {
+		if seen[e.URL] || !sameSite(u, e.URL) {
+			continue
+		}
+		seen[e.URL] = true
+		kept = append(kept, e)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Modified.After(kept[j].Modified)
+	})
+	return kept
+}
+
+// sameSite reports whether link is on the host of seed, ignoring a leading
+// www.
+func sameSite(seed *url.URL, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") ==
+		strings.TrimPrefix(strings.ToLower(seed.Hostname()), "www.")
+}
+
+// get fetches a document, gunzipping it when it is compressed
+func (d *Discoverer) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", target, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentBytes))
+	if err != nil {
+		return nil, err
+	}
+	// Gzipped sitemaps are served as files, not with a Content-Encoding
+	// the transport would undo
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(io.LimitReader(zr, maxDocumentBytes))
+	}
+	return data, nil
+}
+
+// robotsSitemaps returns the sitemaps the robots.txt of origin lists
+func (d *Discoverer) robotsSitemaps(ctx context.Context, origin string) []string {
+	data, err := d.get(ctx, origin+"/robots.txt")
+	if err != nil {
+		return nil
+	}
+	var sitemaps []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			continue
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			sitemaps = append(sitemaps, value)
+		}
+	}
+	return sitemaps
+}
+
+type sitemapDocument struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemap returns the pages a sitemap lists, reading the sitemaps of an
+// index up to maxIndexDepth deep. read holds the sitemaps already read.
+func (d *Discoverer) sitemap(ctx context.Context, target string, depth int, read map[string]bool) []Entry {
+	if read[target] || len(read) >= maxSitemaps || ctx.Err() != nil {
+		return nil
+	}
+	read[target] = true
+
+	data, err := d.get(ctx, target)
+	if err != nil {
+		return nil
+	}
+	var doc sitemapDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+
+	var entries []Entry
+	switch doc.XMLName.Local {
+	case "urlset":
+		for _, u := range doc.URLs {
+			if loc := strings.TrimSpace(u.Loc); loc != "" {
+				entries = append(entries, Entry{URL: loc, Modified: parseTime(u.LastMod)})
+			}
+		}
+	case "sitemapindex":
+		if depth >= maxIndexDepth {
+			return nil
+		}
+		for _, s := range doc.Sitemaps {
+			if loc := strings.TrimSpace(s.Loc); loc != "" {
+				entries = append(entries, d.sitemap(ctx, loc, depth+1, read)...)
+			}
+		}
+	}
+	return entries
+}
+
+// feedLinks returns the feeds a page advertises in its head
+func (d *Discoverer) feedLinks(ctx context.Context, page *url.URL) []string {
+	data, err := d.get(ctx, page.String())
+	if err != nil {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	var feeds []string
+	doc.Find(`link[rel~="alternate"][href]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		kind, _ := s.Attr("type")
+		if !feedTypes[strings.ToLower(strings.TrimSpace(kind))] {
+			return true
+		}
+		href, _ := s.Attr("href")
+		if ref, err := page.Parse(strings.TrimSpace(href)); err == nil {
+			feeds = append(feeds, ref.String())
+		}
+		return len(feeds) < maxFeeds
+	})
+	return feeds
+}
+
+type feedDocument struct {
+	XMLName xml.Name
+	// RSS 2.0 items sit in the channel, RSS 1.0 items beside it
+	ChannelItems []feedItem `xml:"channel>item"`
+	Items        []feedItem `xml:"item"`
+	Entries      []struct {
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Updated   string `xml:"updated"`
+		Published string `xml:"published"`
+	} `xml:"entry"`
+}
+
+type feedItem struct {
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"date"`
+}
+
+// feed returns the pages an RSS or Atom feed links to
+func (d *Discoverer) feed(ctx context.Context, target string) []Entry {
+	data, err := d.get(ctx, target)
+	if err != nil {
+		return nil
+	}
+	var doc feedDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+
+	var entries []Entry
+	for _, item := range append(doc.ChannelItems, doc.Items...) {
+		link := strings.TrimSpace(item.Link)
+		if link == "" && strings.HasPrefix(item.GUID, "http") {
+			link = strings.TrimSpace(item.GUID)
+		}
+		if link == "" {
+			continue
+		}
+		modified := parseTime(item.PubDate)
+		if modified.IsZero() {
+			modified = parseTime(item.Date)
+		}
+		entries = append(entries, Entry{URL: link, Modified: modified})
+	}
+	for _, entry := range doc.Entries {
+		for _, l := range entry.Links {
+			if l.Href == "" || (l.Rel != "" && l.Rel != "alternate") {
+				continue
+			}
+			modified := parseTime(entry.Updated)
+			if modified.IsZero() {
+				modified = parseTime(entry.Published)
+			}
+			entries = append(entries, Entry{URL: strings.TrimSpace(l.Href), Modified: modified})
+			break
+		}
+	}
+	return entries
+}
+
+// timeLayouts are the date formats of sitemaps (W3C datetime) and feeds
+// (RFC 822 and RFC 3339)
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+}
+
+// parseTime reads a sitemap or feed date, returning the zero time if it is
+// missing or malformed
+func parseTime(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,245 @@
+// Package document turns the documents crawls come across besides HTML
+// pages (PDFs, Word files and plain text) into text. The built-in
+// converter handles plain text and DOCX fully and reads the text of simple
+// PDFs; deployments can hand conversion to a service such as Apache Tika
+// for the rest.
+package document
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/textenc"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Media types of the documents the built-in converter reads
+const (
+	TypePDF      = "application/pdf"
+	TypeDOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	TypeText     = "text/plain"
+	TypeMarkdown = "text/markdown"
+	TypeCSV      = "text/csv"
+)
+
+// maxTextBytes bounds the text kept from a document
+const maxTextBytes = 5 << 20
+
+// ErrUnsupported is returned for documents a converter cannot read
+var ErrUnsupported = errors.New("unsupported document type")
+
+// Document is the text of a converted document
+type Document struct {
+	Title string
+	Text  string
+}
+
+// Converter turns documents into text
+type Converter interface {
+	Name() string
+	// Supports reports whether the converter reads documents of a media
+	// type
+	Supports(mediaType string) bool
+	Convert(ctx context.Context, mediaType string, body []byte) (Document, error)
+}
+
+// officeTypes are the further document types handed to a converter
+// service
+var officeTypes = map[string]bool{
+	"application/msword":                                                        true,
+	"application/rtf":                                                           true,
+	"application/vnd.ms-excel":                                                  true,
+	"application/vnd.ms-powerpoint":                                             true,
+	"application/vnd.oasis.opendocument.text":                                   true,
+	"application/vnd.oasis.opendocument.spreadsheet":                            true,
+	"application/vnd.oasis.opendocument.presentation":                           true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/epub+zip":                                                      true,
+}
+
+// extensions map file extensions to the media type of documents served
+// without a useful Content-Type
+var extensions = map[string]string{
+	".pdf":  TypePDF,
+	".docx": TypeDOCX,
+	".txt":  TypeText,
+	".md":   TypeMarkdown,
+	".csv":  TypeCSV,
+	".doc":  "application/msword",
+	".rtf":  "application/rtf",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// MediaType returns the media type of a response from its Content-Type
+// header, lower-cased and without parameters. Generic binary types and a
+// missing header are resolved from the URL's extension, then by sniffing.
+func MediaType(contentType string, u *url.URL, body []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	mediaType = strings.ToLower(mediaType)
+	if mediaType != "" && mediaType != "application/octet-stream" && mediaType != "binary/octet-stream" {
+		return mediaType
+	}
+	if u != nil {
+		if t, ok := extensions[strings.ToLower(path.Ext(u.Path))]; ok {
+			return t
+		}
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(body))
+	return sniffed
+}
+
+// IsHTML reports whether a media type is a web page
+func IsHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// Builtin converts plain text, DOCX and simple PDFs
+type Builtin struct{}
+
+// Name implements Converter
+func (Builtin) Name() string {
+	return "builtin"
+}
+
+// Supports implements Converter
+func (Builtin) Supports(mediaType string) bool {
+	switch mediaType {
+	case TypePDF, TypeDOCX, TypeText, TypeMarkdown, TypeCSV:
+		return true
+	}
+	return false
+}
+
+// Convert implements Converter
+func (Builtin) Convert(_ context.Context, mediaType string, body []byte) (Document, error) {
+	var doc Document
+	var err error
+	switch mediaType {
+	case TypePDF:
+		doc, err = readPDF(body)
+	case TypeDOCX:
+		doc, err = readDOCX(body)
+	case TypeText, TypeMarkdown, TypeCSV:
+		text, _, decodeErr := textenc.Decode(body)
+		if decodeErr != nil {
+			text = body
+		}
+		doc.Text = string(bytes.ToValidUTF8(text, nil))
+	default:
+		return Document{}, ErrUnsupported
+	}
+	if err != nil {
+		return Document{}, err
+	}
+	doc.Text = strings.TrimSpace(doc.Text)
+	if len(doc.Text) > maxTextBytes {
+		doc.Text = strings.ToValidUTF8(doc.Text[:maxTextBytes], "")
+	}
+	return doc, nil
+}
+
+// Remote converts documents with a Tika-compatible service: the document
+// is PUT to the endpoint with its Content-Type and the service answers
+// with its text. Documents the service fails on go to the fallback.
+type Remote struct {
+	endpoint string
+	http     *http.Client
+	fallback Converter
+}
+
+// NewRemote returns a converter calling endpoint, falling back to fallback
+func NewRemote(endpoint string, timeout time.Duration, fallback Converter) *Remote {
+	return &Remote{
+		endpoint: endpoint,
+		http:     &http.Client{Timeout: timeout},
+		fallback: fallback,
+	}
+}
+
+// Name implements Converter
+func (r *Remote) Name() string {
+	return "remote"
+}
+
+// Supports implements Converter
+func (r *Remote) Supports(mediaType string) bool {
+	return officeTypes[mediaType] || (r.fallback != nil && r.fallback.Supports(mediaType))
+}
+
+// Convert implements Converter
+func (r *Remote) Convert(ctx context.Context, mediaType string, body []byte) (Document, error) {
+	text, err := r.convert(ctx, mediaType, body)
+	if err != nil {
+		if r.fallback == nil || !r.fallback.Supports(mediaType) {
+			return Document{}, err
+		}
+		log.WithError(err).WithField("endpoint", r.endpoint).Debug("Remote document conversion failed, converting locally")
+		return r.fallback.Convert(ctx, mediaType, body)
+	}
+	text = strings.TrimSpace(text)
+	if len(text) > maxTextBytes {
+		text = strings.ToValidUTF8(text[:maxTextBytes], "")
+	}
+	return Document{Text: text}, nil
+}
+
+func (r *Remote) convert(ctx context.Context, mediaType string, body []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mediaType)
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("document converter returned %d", resp.StatusCode)
+	}
+	text, err := io.ReadAll(io.LimitReader(resp.Body, maxTextBytes+1))
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.ToValidUTF8(text, nil)), nil
+}
+
+// NewFromEnv returns the converter the deployment configures: with
+// DOCUMENT_CONVERTER_URL set, documents go to that service (timeout
+// DOCUMENT_CONVERTER_TIMEOUT, default 30s) and the built-in converter
+// stands in when it fails; otherwise the built-in converter alone. On a
+// configuration error the built-in converter is used alongside the error.
+func NewFromEnv() (Converter, error) {
+	var builtin Converter = Builtin{}
+	endpoint := os.Getenv("DOCUMENT_CONVERTER_URL")
+	if endpoint == "" {
+		return builtin, nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return builtin, fmt.Errorf("invalid DOCUMENT_CONVERTER_URL %q", endpoint)
+	}
+	timeout := 30 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("DOCUMENT_CONVERTER_TIMEOUT")); err == nil && d > 0 {
+		timeout = d
+	}
+	return NewRemote(endpoint, timeout, builtin), nil
+}
@@ -0,0 +1,103 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDOCXPartBytes bounds the uncompressed size of a DOCX part read, so a
+// small archive cannot expand without limit
+const maxDOCXPartBytes = 50 << 20
+
+// readDOCX reads the paragraphs of a Word document, and its title from the
+// document properties
+func readDOCX(body []byte) (Document, error) {
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return Document{}, fmt.Errorf("invalid docx: %w", err)
+	}
+
+	var doc Document
+	found := false
+	for _, f := range archive.File {
+		switch f.Name {
+		case "word/document.xml":
+			text, err := readDOCXPart(f, docxText)
+			if err != nil {
+				return Document{}, err
+			}
+			doc.Text = text
+			found = true
+		case "docProps/core.xml":
+			// A missing or unreadable title is no reason to fail
+			doc.Title, _ = readDOCXPart(f, docxTitle)
+		}
+	}
+	if !found {
+		return Document{}, errors.New("invalid docx: no word/document.xml")
+	}
+	return doc, nil
+}
+
+func readDOCXPart(f *zip.File, read func(*xml.Decoder) (string, error)) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("invalid docx: %w", err)
+	}
+	defer rc.Close()
+	return read(xml.NewDecoder(io.LimitReader(rc, maxDOCXPartBytes)))
+}
+
+// docxText collects the runs of text of each paragraph, a line per
+// paragraph
+func docxText(d *xml.Decoder) (string, error) {
+	var b strings.Builder
+	inText := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid docx: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+}
+
+// docxTitle reads dc:title from the core document properties
+func docxTitle(d *xml.Decoder) (string, error) {
+	var props struct {
+		Title string `xml:"title"`
+	}
+	if err := d.Decode(&props); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(props.Title), nil
+}
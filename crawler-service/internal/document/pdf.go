@@ -0,0 +1,245 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// The built-in PDF reader takes the text shown by the content streams of a
+// PDF: its uncompressed and Flate-compressed streams are scanned for text
+// objects, and the strings of their show-text operators read in order. It
+// does not map glyphs through font encodings, so text set in embedded
+// subset fonts, and scanned pages, come out empty or garbled; a document
+// converter service reads those.
+
+var (
+	pdfStream = regexp.MustCompile(`>>\s*stream\r?\n`)
+	pdfTitle  = regexp.MustCompile(`/Title\s*\(`)
+)
+
+// maxPDFStreamBytes bounds the size a stream is inflated to
+const maxPDFStreamBytes = 20 << 20
+
+// readPDF reads the text of a PDF
+func readPDF(body []byte) (Document, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(body, "\x00\t\r\n "), []byte("%PDF-")) {
+		return Document{}, errors.New("invalid pdf: missing header")
+	}
+
+	var doc Document
+	if loc := pdfTitle.FindIndex(body); loc != nil {
+		if title, _, ok := pdfString(body, loc[1]-1); ok {
+			doc.Title = strings.TrimSpace(title)
+		}
+	}
+
+	var b strings.Builder
+	for _, m := range pdfStream.FindAllIndex(body, -1) {
+		// The stream's dictionary follows the "N 0 obj" that opens it
+		from := bytes.LastIndex(body[:m[0]], []byte("obj"))
+		if from < 0 {
+			from = 0
+		}
+		dict := body[from:m[0]]
+		start := m[1]
+		end := bytes.Index(body[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		data := body[start : start+end]
+
+		switch {
+		case bytes.Contains(dict, []byte("/FlateDecode")):
+			inflated, err := inflate(data)
+			if err != nil {
+				continue
+			}
+			data = inflated
+		case bytes.Contains(dict, []byte("/Filter")):
+			// Image and other encodings carry no text
+			continue
+		}
+		if !bytes.Contains(data, []byte("BT")) {
+			continue
+		}
+		showText(&b, data)
+	}
+
+	doc.Text = b.String()
+	return doc, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, maxPDFStreamBytes))
+	// Streams are often followed by stray bytes; keep what inflated
+	if len(out) > 0 {
+		return out, nil
+	}
+	return nil, err
+}
+
+// showText writes the strings shown in a content stream's text objects.
+// Strings shown together on a line are joined, with a space where a TJ
+// array moves the next one well to the right; moving to a new line and
+// ending a text object start a new line.
+func showText(b *strings.Builder, content []byte) {
+	inText, inArray := false, false
+	line := false
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next, ok := pdfString(content, i)
+			if !ok {
+				return
+			}
+			if inText {
+				b.WriteString(s)
+				line = true
+			}
+			i = next
+			continue
+		case c == '[':
+			inArray = true
+		case c == ']':
+			inArray = false
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			// Hex strings hold glyph IDs more often than text; skip them
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return
+			}
+			i += end + 1
+			continue
+		case isPDFRegular(c):
+			start := i
+			for i < len(content) && isPDFRegular(content[i]) {
+				i++
+			}
+			token := string(content[start:i])
+			if inText && inArray && line {
+				if n, err := strconv.ParseFloat(token, 64); err == nil && n <= -200 {
+					b.WriteByte(' ')
+				}
+				continue
+			}
+			switch token {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				if line {
+					b.WriteByte('\n')
+					line = false
+				}
+			case "Td", "TD", "T*", "'", "\"":
+				if line {
+					b.WriteByte('\n')
+					line = false
+				}
+			}
+			continue
+		}
+		i++
+	}
+}
+
+// isPDFRegular reports whether c may be part of a name, number or operator
+func isPDFRegular(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return false
+	}
+	return true
+}
+
+// pdfString reads the literal string opening at data[start], returning it
+// and the index after it
+func pdfString(data []byte, start int) (string, int, bool) {
+	var raw []byte
+	depth := 0
+	for i := start; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				raw = append(raw, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfText(raw), i + 1, true
+			}
+			raw = append(raw, c)
+		case '\\':
+			i++
+			if i >= len(data) {
+				return "", 0, false
+			}
+			switch e := data[i]; e {
+			case 'n':
+				raw = append(raw, '\n')
+			case 'r':
+				raw = append(raw, '\r')
+			case 't':
+				raw = append(raw, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// A backslash at the end of a line continues the string
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					for j := 0; j < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; j++ {
+						n = n*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					raw = append(raw, byte(n))
+				} else {
+					raw = append(raw, e)
+				}
+			}
+		default:
+			if depth > 0 {
+				raw = append(raw, c)
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// pdfText decodes the bytes of a string: UTF-16BE after a byte order mark,
+// else taken as Latin-1, close enough to PDFDocEncoding for text
+func pdfText(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, len(raw))
+	for i, c := range raw {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,229 @@
+package enrich
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrLookupQuotaExhausted is returned once a tenant has used its daily
+// enrichment lookups
+var ErrLookupQuotaExhausted = errors.New("enrichment lookup quota exhausted")
+
+// Provider looks up third-party data about a host IP
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, ip string) (*models.HostIntel, error)
+}
+
+// Enricher attaches host intelligence to crawled hosts. Lookups are cached
+// per provider and IP, and every uncached lookup is charged against the
+// tenant's daily allowance before it is made.
+type Enricher struct {
+	providers  []Provider
+	cacheTTL   time.Duration
+	dailyLimit int64
+
+	mu       sync.Mutex
+	cache    map[string]cachedIntel
+	usage    map[string]int64
+	usageDay string
+}
+
+type cachedIntel struct {
+	intel   *models.HostIntel
+	expires time.Time
+}
+
+// NewEnricherFromEnv enables Shodan when SHODAN_API_KEY is set and Censys
+// when CENSYS_API_ID and CENSYS_API_SECRET are set. ENRICHMENT_CACHE_TTL
+// (default 24h) and ENRICHMENT_DAILY_LOOKUPS (per tenant, default 100)
+// bound cost.
+func NewEnricherFromEnv() *Enricher {
+	var providers []Provider
+	if key := os.Getenv("SHODAN_API_KEY"); key != "" {
+		providers = append(providers, NewShodan(key))
+	}
+	if id, secret := os.Getenv("CENSYS_API_ID"), os.Getenv("CENSYS_API_SECRET"); id != "" && secret != "" {
+		providers = append(providers, NewCensys(id, secret))
+	}
+
+	ttl := 24 * time.Hour
+	if d, err := time.ParseDuration(os.Getenv("ENRICHMENT_CACHE_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+	limit := int64(100)
+	if n, err := strconv.ParseInt(os.Getenv("ENRICHMENT_DAILY_LOOKUPS"), 10, 64); err == nil && n >= 0 {
+		limit = n
+	}
+
+	return &Enricher{
+		providers:  providers,
+		cacheTTL:   ttl,
+		dailyLimit: limit,
+		cache:      make(map[string]cachedIntel),
+		usage:      make(map[string]int64),
+	}
+}
+
+// Enabled reports whether any provider is configured
+func (en *Enricher) Enabled() bool {
+	return len(en.providers) > 0
+}
+
+// DailyLimit returns the per-tenant daily lookup allowance
+func (en *Enricher) DailyLimit() int64 {
+	return en.dailyLimit
+}
+
+// Enrich returns host data for host from every provider. Cached data is
+// returned without charging the tenant; ErrLookupQuotaExhausted is returned
+// alongside whatever was cached once the allowance is spent.
+func (en *Enricher) Enrich(ctx context.Context, tenant, host string) ([]models.HostIntel, error) {
+	ip := host
+	if net.ParseIP(host) == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return nil, err
+		}
+		ip = addrs[0].IP.String()
+	}
+
+	var intel []models.HostIntel
+	var quotaErr error
+	for _, p := range en.providers {
+		if cached := en.cached(p.Name(), ip); cached != nil {
+			intel = append(intel, *cached)
+			continue
+		}
+		if quotaErr != nil {
+			continue
+		}
+		if !en.charge(tenant) {
+			quotaErr = ErrLookupQuotaExhausted
+			continue
+		}
+
+		result, err := p.Lookup(ctx, ip)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"provider": p.Name(),
+				"ip":       ip,
+			}).Warn("Host enrichment lookup failed")
+			continue
+		}
+		result.Host = host
+		en.store(p.Name(), ip, result)
+		intel = append(intel, *result)
+	}
+	return intel, quotaErr
+}
+
+// Usage returns the lookups a tenant has been charged today
+func (en *Enricher) Usage(tenant string) int64 {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		n, err := rdb.Get(context.Background(), usageKey(tenant)).Int64()
+		if err == nil {
+			return n
+		}
+	}
+
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	en.rollDay()
+	return en.usage[tenant]
+}
+
+// charge reserves one lookup for tenant, reporting false when the daily
+// allowance is spent
+func (en *Enricher) charge(tenant string) bool {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		key := usageKey(tenant)
+		n, err := rdb.Incr(ctx, key).Result()
+		if err == nil {
+			rdb.Expire(ctx, key, 48*time.Hour)
+			if n > en.dailyLimit {
+				rdb.Decr(ctx, key)
+				return false
+			}
+			return true
+		}
+		log.WithError(err).Warn("Enrichment quota lookup failed, using in-memory counters")
+	}
+
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	en.rollDay()
+	if en.usage[tenant] >= en.dailyLimit {
+		return false
+	}
+	en.usage[tenant]++
+	return true
+}
+
+// rollDay resets the in-memory counters at UTC midnight; callers hold mu
+func (en *Enricher) rollDay() {
+	if day := today(); day != en.usageDay {
+		en.usage = make(map[string]int64)
+		en.usageDay = day
+	}
+}
+
+func (en *Enricher) cached(provider, ip string) *models.HostIntel {
+	key := cacheKey(provider, ip)
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := rdb.Get(context.Background(), key).Bytes()
+		if err == nil {
+			var intel models.HostIntel
+			if json.Unmarshal(data, &intel) == nil {
+				return &intel
+			}
+		}
+	}
+
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	entry, ok := en.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		delete(en.cache, key)
+		return nil
+	}
+	return entry.intel
+}
+
+func (en *Enricher) store(provider, ip string, intel *models.HostIntel) {
+	key := cacheKey(provider, ip)
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if data, err := json.Marshal(intel); err == nil {
+			if rdb.Set(context.Background(), key, data, en.cacheTTL).Err() == nil {
+				return
+			}
+		}
+	}
+
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	en.cache[key] = cachedIntel{intel: intel, expires: time.Now().Add(en.cacheTTL)}
+}
+
+func cacheKey(provider, ip string) string {
+	return "host_intel:" + provider + ":" + ip
+}
+
+func usageKey(tenant string) string {
+	return "enrich_lookups:" + tenant + ":" + today()
+}
+
+func today() string {
+	return time.Now().UTC().Format("20060102")
+}
@@ -0,0 +1,161 @@
+package enrich
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxBannerBytes truncates service banners kept on results
+const maxBannerBytes = 512
+
+// Shodan looks up hosts through the Shodan host API
+type Shodan struct {
+	key  string
+	http *http.Client
+}
+
+// NewShodan creates a Shodan provider
+func NewShodan(key string) *Shodan {
+	return &Shodan{key: key, http: &http.Client{Timeout: 20 * time.Second}}
+}
+
+// Name implements Provider
+func (s *Shodan) Name() string {
+	return "shodan"
+}
+
+// Lookup implements Provider
+func (s *Shodan) Lookup(ctx context.Context, ip string) (*models.HostIntel, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://api.shodan.io/shodan/host/"+url.PathEscape(ip)+"?key="+url.QueryEscape(s.key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Ports []int    `json:"ports"`
+		Tags  []string `json:"tags"`
+		Org   string   `json:"org"`
+		Data  []struct {
+			Port      int    `json:"port"`
+			Transport string `json:"transport"`
+			Product   string `json:"product"`
+			Banner    string `json:"data"`
+		} `json:"data"`
+	}
+	if err := doJSON(s.http, req, &res); err != nil {
+		return nil, err
+	}
+
+	intel := &models.HostIntel{
+		IP:        ip,
+		Provider:  s.Name(),
+		Ports:     res.Ports,
+		Tags:      res.Tags,
+		Org:       res.Org,
+		FetchedAt: time.Now().UTC(),
+	}
+	for _, d := range res.Data {
+		intel.Services = append(intel.Services, models.HostService{
+			Port:      d.Port,
+			Transport: d.Transport,
+			Product:   d.Product,
+			Banner:    truncate(d.Banner),
+		})
+	}
+	return intel, nil
+}
+
+// Censys looks up hosts through the Censys Search v2 API
+type Censys struct {
+	id, secret string
+	http       *http.Client
+}
+
+// NewCensys creates a Censys provider
+func NewCensys(id, secret string) *Censys {
+	return &Censys{id: id, secret: secret, http: &http.Client{Timeout: 20 * time.Second}}
+}
+
+// Name implements Provider
+func (c *Censys) Name() string {
+	return "censys"
+}
+
+// Lookup implements Provider
+func (c *Censys) Lookup(ctx context.Context, ip string) (*models.HostIntel, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://search.censys.io/api/v2/hosts/"+url.PathEscape(ip), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.id, c.secret)
+
+	var res struct {
+		Result struct {
+			Labels   []string `json:"labels"`
+			Services []struct {
+				Port      int    `json:"port"`
+				Transport string `json:"transport_protocol"`
+				Name      string `json:"service_name"`
+				Banner    string `json:"banner"`
+			} `json:"services"`
+			AutonomousSystem struct {
+				Name string `json:"name"`
+			} `json:"autonomous_system"`
+		} `json:"result"`
+	}
+	if err := doJSON(c.http, req, &res); err != nil {
+		return nil, err
+	}
+
+	intel := &models.HostIntel{
+		IP:        ip,
+		Provider:  c.Name(),
+		Tags:      res.Result.Labels,
+		Org:       res.Result.AutonomousSystem.Name,
+		FetchedAt: time.Now().UTC(),
+	}
+	for _, s := range res.Result.Services {
+		intel.Ports = append(intel.Ports, s.Port)
+		intel.Services = append(intel.Services, models.HostService{
+			Port:      s.Port,
+			Transport: s.Transport,
+			Product:   s.Name,
+			Banner:    truncate(s.Banner),
+		})
+	}
+	return intel, nil
+}
+
+// doJSON performs req and decodes a successful JSON response into v. A 404
+// means the provider has no data on the host and yields an empty result.
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func truncate(s string) string {
+	if len(s) > maxBannerBytes {
+		return s[:maxBannerBytes]
+	}
+	return s
+}
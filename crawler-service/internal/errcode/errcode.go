@@ -0,0 +1,132 @@
+package errcode
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Machine-readable error codes recorded on jobs and results
+const (
+	DNSFailure         = "dns_failure"
+	ConnectionRefused  = "connection_refused"
+	TLSError           = "tls_error"
+	Timeout            = "timeout"
+	HTTP4xx            = "http_4xx"
+	HTTP5xx            = "http_5xx"
+	RobotsBlocked      = "robots_blocked"
+	ForbiddenURL       = "forbidden_url"
+	BudgetExhausted    = "budget_exhausted"
+	QuotaExceeded      = "quota_exceeded"
+	SecretUnavailable  = "secret_unavailable"
+	InvalidRequest     = "invalid_request"
+	Cancelled          = "cancelled"
+	Stalled            = "stalled"
+	MaxRuntimeExceeded = "max_runtime_exceeded"
+	Maintenance        = "maintenance"
+	Interrupted        = "interrupted"
+	Preempted          = "preempted"
+	PolicyDenied       = "policy_denied"
+	OutsideWindow      = "outside_window"
+	ComplianceDenied   = "compliance_denied"
+	Internal           = "internal"
+	Unknown            = "unknown"
+)
+
+// Machine-readable codes of API error responses, besides the codes above
+const (
+	NotFound       = "not_found"
+	Conflict       = "conflict"
+	Unavailable    = "unavailable"
+	Upstream       = "upstream_error"
+	NotImplemented = "not_implemented"
+	ReadOnly       = "read_only"
+	Unauthorized   = "unauthorized"
+	Forbidden      = "forbidden"
+	RateLimited    = "rate_limited"
+)
+
+// Error attaches a code to an underlying error
+type Error struct {
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Wrap returns err annotated with code, or nil if err is nil
+func Wrap(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Classify maps an error and optional HTTP status code to an error code
+func Classify(err error, statusCode int) string {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+
+	switch {
+	case statusCode >= 500:
+		return HTTP5xx
+	case statusCode >= 400:
+		return HTTP4xx
+	}
+
+	if err == nil {
+		return ""
+	}
+
+	var dnsErr *net.DNSError
+	var certErr *x509.CertificateInvalidError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Cancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, colly.ErrRobotsTxtBlocked):
+		return RobotsBlocked
+	case errors.Is(err, colly.ErrForbiddenDomain), errors.Is(err, colly.ErrForbiddenURL),
+		errors.Is(err, colly.ErrNoURLFiltersMatch):
+		return ForbiddenURL
+	case errors.As(err, &dnsErr):
+		return DNSFailure
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthErr),
+		errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		return TLSError
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ConnectionRefused
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return Timeout
+	}
+
+	// Fall back to message inspection for errors that lost their type
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "no such host"):
+		return DNSFailure
+	case strings.Contains(msg, "tls:") || strings.Contains(msg, "x509:"):
+		return TLSError
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "deadline exceeded"):
+		return Timeout
+	case strings.Contains(msg, "connection refused"):
+		return ConnectionRefused
+	}
+	return Unknown
+}
@@ -0,0 +1,171 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of a delivery body, as "sha256=<hex>"
+const SignatureHeader = "X-GodsEye-Signature"
+
+const (
+	batchQueueSize  = 1000
+	deliveryRetries = 3
+	deliveryTimeout = 10 * time.Second
+)
+
+// Batch is the body of one batched webhook delivery
+type Batch struct {
+	JobID  string    `json:"job_id"`
+	Events []Event   `json:"events"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// BatchWebhook posts one job's events to a URL in signed batches. A batch is
+// sent when it reaches its size, when the interval elapses or when the job
+// finishes.
+type BatchWebhook struct {
+	url      string
+	secret   string
+	jobID    string
+	size     int
+	interval time.Duration
+	filter   func(Event) bool
+	queue    chan Event
+	http     *http.Client
+}
+
+// NewBatchWebhook starts a webhook for the job's events accepted by filter.
+// Batches are posted with client, which decides what the URL may reach.
+func NewBatchWebhook(client *http.Client, url, secret, jobID string, size int, interval time.Duration, filter func(Event) bool) *BatchWebhook {
+	if size < 1 {
+		size = 1
+	}
+	w := &BatchWebhook{
+		url:      url,
+		secret:   secret,
+		jobID:    jobID,
+		size:     size,
+		interval: interval,
+		filter:   filter,
+		queue:    make(chan Event, batchQueueSize),
+		http:     client,
+	}
+	go w.run()
+	return w
+}
+
+// Handle queues a matching event without blocking; events are dropped when
+// the receiver cannot keep up
+func (w *BatchWebhook) Handle(e Event) {
+	if e.JobID != w.jobID || !w.filter(e) {
+		return
+	}
+
+	select {
+	case w.queue <- e:
+	default:
+		log.WithFields(log.Fields{
+			"job_id": w.jobID,
+			"event":  e.Type,
+		}).Warn("Webhook queue full, dropping event")
+	}
+}
+
+// Close flushes queued events and stops the webhook
+func (w *BatchWebhook) Close() {
+	close(w.queue)
+}
+
+func (w *BatchWebhook) run() {
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var pending []Event
+	for {
+		select {
+		case e, ok := <-w.queue:
+			if !ok {
+				w.send(pending)
+				return
+			}
+			pending = append(pending, e)
+			if len(pending) >= w.size {
+				w.send(pending)
+				pending = nil
+			}
+		case <-tick:
+			w.send(pending)
+			pending = nil
+		}
+	}
+}
+
+// send delivers a batch, retrying network errors and 5xx responses
+func (w *BatchWebhook) send(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(Batch{JobID: w.jobID, Events: events, SentAt: time.Now().UTC()})
+	if err != nil {
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = w.post(body)
+		if err == nil || attempt == deliveryRetries {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"job_id": w.jobID,
+			"events": len(events),
+		}).Warn("Failed to deliver webhook batch")
+	}
+}
+
+func (w *BatchWebhook) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.secret, body))
+	}
+
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body under secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
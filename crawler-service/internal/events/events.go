@@ -0,0 +1,74 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the crawler
+const (
+	JobStalled        = "job.stalled"
+	CertificateIssued = "ct.certificate_issued"
+	HostsDiscovered   = "ct.hosts_discovered"
+	ProfilesFound     = "recon.profiles_found"
+	SectionChanged    = "monitor.section_changed"
+	PageCrawled       = "page.crawled"
+	PageFailed        = "page.failed"
+	URLDiscovered     = "url.discovered"
+	JobStatusChanged  = "job.status"
+	JobFinished       = "job.finished"
+	BudgetThreshold   = "tenant.budget_threshold"
+)
+
+// Event is a notification about a job
+type Event struct {
+	Type   string                 `json:"type"`
+	JobID  string                 `json:"job_id"`
+	Tenant string                 `json:"tenant,omitempty"`
+	Time   time.Time              `json:"time"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// Handler receives published events; it must not block
+type Handler func(Event)
+
+// Bus is an in-process publish/subscribe event bus
+type Bus struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[int]Handler
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[int]Handler)}
+}
+
+// Subscribe registers a handler and returns a function removing it
+func (b *Bus) Subscribe(h Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = h
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Publish delivers an event to every subscriber
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, h := range b.handlers {
+		h(e)
+	}
+}
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookNotifier posts selected events as JSON to a URL
+type WebhookNotifier struct {
+	url   string
+	types map[string]bool
+	http  *http.Client
+}
+
+// NewWebhookNotifier creates a notifier for the given event types
+func NewWebhookNotifier(url string, types ...string) *WebhookNotifier {
+	n := &WebhookNotifier{
+		url:   url,
+		types: make(map[string]bool, len(types)),
+		http:  &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, t := range types {
+		n.types[t] = true
+	}
+	return n
+}
+
+// Handle delivers matching events asynchronously
+func (n *WebhookNotifier) Handle(e Event) {
+	if !n.types[e.Type] {
+		return
+	}
+
+	go func() {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+
+		resp, err := n.http.Post(n.url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			log.WithError(err).WithField("event", e.Type).Warn("Failed to deliver alert")
+			return
+		}
+		resp.Body.Close()
+	}()
+}
@@ -0,0 +1,175 @@
+// Package extractor reads the structured metadata of a page: its
+// description, canonical URL, Open Graph and Twitter card properties,
+// headings, images, publication date and language.
+package extractor
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/hreflang"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/timeline"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Bounds on what is recorded per page
+const (
+	maxImages   = 50
+	maxHeadings = 100
+)
+
+// Metadata is the structured data read from a page
+type Metadata struct {
+	Description string
+	Canonical   string
+	// OpenGraph and TwitterCard are keyed without the og: and twitter:
+	// prefixes; the first value of a repeated property is kept
+	OpenGraph   map[string]string
+	TwitterCard map[string]string
+	Headings    []models.Heading
+	Images      []models.MediaAsset
+	PublishedAt *time.Time
+	// Language is declared by the page or, failing that, detected from
+	// text
+	Language string
+}
+
+// Extract reads the metadata of the page at pageURL. text is the page's
+// main content, used to detect its language when it declares none.
+func Extract(doc *goquery.Selection, pageURL *url.URL, text string) Metadata {
+	m := Metadata{
+		Description: collapse(doc.Find(`meta[name="description" i]`).First().AttrOr("content", "")),
+		Canonical:   resolve(pageURL, doc.Find(`link[rel~="canonical"]`).First().AttrOr("href", "")),
+		OpenGraph:   properties(doc, "og:"),
+		TwitterCard: properties(doc, "twitter:"),
+		Headings:    headings(doc),
+		Images:      images(doc, pageURL),
+		PublishedAt: published(doc),
+	}
+	m.Language = declaredLanguage(doc, m.OpenGraph["locale"])
+	if m.Language == "" {
+		m.Language = DetectLanguage(text)
+	}
+	return m
+}
+
+// properties returns the meta properties starting with prefix, keyed
+// without it. Sites use both property and name for them.
+func properties(doc *goquery.Selection, prefix string) map[string]string {
+	props := make(map[string]string)
+	doc.Find("meta[content]").Each(func(_ int, s *goquery.Selection) {
+		key := s.AttrOr("property", "")
+		if key == "" {
+			key = s.AttrOr("name", "")
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !strings.HasPrefix(key, prefix) || len(key) == len(prefix) {
+			return
+		}
+		key = strings.TrimPrefix(key, prefix)
+		value := collapse(s.AttrOr("content", ""))
+		if _, ok := props[key]; ok || value == "" {
+			return
+		}
+		props[key] = value
+	})
+	if len(props) == 0 {
+		return nil
+	}
+	return props
+}
+
+// headings returns the page's h1-h3 headings in document order
+func headings(doc *goquery.Selection) []models.Heading {
+	var list []models.Heading
+	doc.Find("h1, h2, h3").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		text := collapse(s.Text())
+		if text == "" {
+			return true
+		}
+		list = append(list, models.Heading{
+			Level: int(goquery.NodeName(s)[1] - '0'),
+			Text:  text,
+		})
+		return len(list) < maxHeadings
+	})
+	return list
+}
+
+// images returns the page's images with their alt text. Lazily loaded
+// images are read from data-src.
+func images(doc *goquery.Selection, pageURL *url.URL) []models.MediaAsset {
+	var media []models.MediaAsset
+	seen := make(map[string]bool)
+	doc.Find("img[src], img[data-src]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		raw := strings.TrimSpace(s.AttrOr("src", ""))
+		if raw == "" || strings.HasPrefix(raw, "data:") {
+			raw = s.AttrOr("data-src", "")
+		}
+		src := resolve(pageURL, raw)
+		if src == "" || seen[src] {
+			return true
+		}
+		seen[src] = true
+		media = append(media, models.MediaAsset{URL: src, Alt: collapse(s.AttrOr("alt", ""))})
+		return len(media) < maxImages
+	})
+	return media
+}
+
+// published returns the earliest publication date the page states
+func published(doc *goquery.Selection) *time.Time {
+	var earliest *time.Time
+	for _, event := range timeline.Extract(doc) {
+		if event.Kind != timeline.KindPublished {
+			continue
+		}
+		if earliest == nil || event.Time.Before(*earliest) {
+			t := event.Time
+			earliest = &t
+		}
+	}
+	return earliest
+}
+
+// declaredLanguage returns the language the page declares in <html lang>,
+// a Content-Language meta tag or its og:locale
+func declaredLanguage(doc *goquery.Selection, locale string) string {
+	html := doc.Closest("html")
+	if html.Length() == 0 {
+		html = doc.Find("html").First()
+	}
+	for _, tag := range []string{
+		html.AttrOr("lang", ""),
+		doc.Find(`meta[http-equiv="content-language" i]`).First().AttrOr("content", ""),
+		locale,
+	} {
+		// Content-Language may list several languages
+		tag = strings.TrimSpace(strings.Split(tag, ",")[0])
+		if tag != "" {
+			return hreflang.Normalize(tag)
+		}
+	}
+	return ""
+}
+
+// resolve returns href as an absolute http(s) URL against pageURL, or ""
+func resolve(pageURL *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return ""
+	}
+	u, err := pageURL.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,69 @@
+package extractor
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Language detection counts common words distinctive of each language over
+// the first maxLanguageWords words of a text. The language with the most
+// hits wins if it has at least minLanguageHits and no other ties it.
+const (
+	maxLanguageWords = 1000
+	minLanguageHits  = 5
+)
+
+// stopwords are frequent words of each language, leaving out those common
+// to several of them
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "that", "with", "was", "are", "this", "for", "have", "from", "which"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "eine", "auf", "sich", "von", "auch"},
+	"fr": {"les", "et", "des", "est", "une", "pour", "dans", "qui", "pas", "sur", "du", "au", "avec", "sont"},
+	"es": {"el", "los", "las", "y", "más", "pero", "sus", "fue", "también", "muy", "hay", "donde"},
+	"it": {"il", "che", "di", "gli", "della", "sono", "non", "anche", "nel", "alla", "questo", "è", "più"},
+	"pt": {"os", "não", "com", "em", "são", "é", "também", "pelo", "pela", "ao", "mas", "nos"},
+	"nl": {"het", "een", "van", "dat", "niet", "op", "zijn", "voor", "ook", "wordt", "maar", "bij"},
+}
+
+// stopwordLanguages maps each stopword to its language
+var stopwordLanguages = func() map[string]string {
+	m := make(map[string]string)
+	for lang, words := range stopwords {
+		for _, w := range words {
+			m[w] = lang
+		}
+	}
+	return m
+}()
+
+// DetectLanguage guesses the language of text, returning "" when it cannot
+// tell
+func DetectLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) > maxLanguageWords {
+		words = words[:maxLanguageWords]
+	}
+
+	hits := make(map[string]int)
+	for _, w := range words {
+		if lang, ok := stopwordLanguages[w]; ok {
+			hits[lang]++
+		}
+	}
+
+	best, bestHits, tied := "", 0, false
+	for lang, n := range hits {
+		switch {
+		case n > bestHits:
+			best, bestHits, tied = lang, n, false
+		case n == bestHits:
+			tied = true
+		}
+	}
+	if bestHits < minLanguageHits || tied {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,265 @@
+// Package fieldmask hides result fields from roles that must not see them,
+// so a viewer can be given titles and URLs without page content or the
+// personal data extracted from it.
+package fieldmask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// rulesKey is the Redis hash of role rules, keyed by role
+const rulesKey = "field_masks"
+
+var rolePattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// Groups name sets of fields that are usually hidden together
+var Groups = map[string][]string{
+	"content": {"content", "content_markdown", "tables", "translations", "network", "html_ref", "screenshot_ref", "screenshot"},
+	"pii":     {"emails", "phones", "fields", "geo", "host_intel", "organization"},
+}
+
+// resultFields maps the JSON name of every result field to its index
+var resultFields = func() map[string]int {
+	t := reflect.TypeOf(models.CrawlResult{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// Rule lists the result fields hidden from a role
+type Rule struct {
+	Role      string    `json:"role"`
+	Hidden    []string  `json:"hidden"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Apply returns copies of results with the rule's fields cleared. A nil
+// rule returns results unchanged.
+func (r *Rule) Apply(results []models.CrawlResult) []models.CrawlResult {
+	if r == nil || len(r.Hidden) == 0 {
+		return results
+	}
+	masked := make([]models.CrawlResult, len(results))
+	for i := range results {
+		masked[i] = results[i]
+		v := reflect.ValueOf(&masked[i]).Elem()
+		for _, name := range r.Hidden {
+			if idx, ok := resultFields[name]; ok {
+				f := v.Field(idx)
+				f.Set(reflect.Zero(f.Type()))
+			}
+		}
+	}
+	return masked
+}
+
+// Hides reports whether the rule hides a result field. A nil rule hides
+// nothing.
+func (r *Rule) Hides(field string) bool {
+	if r == nil {
+		return false
+	}
+	for _, name := range r.Hidden {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Store holds the rules per role, in Redis when connected so every
+// instance enforces the same rules
+type Store struct {
+	mu    sync.RWMutex
+	rules map[string]Rule
+}
+
+// NewStore creates an empty rule store
+func NewStore() *Store {
+	return &Store{rules: make(map[string]Rule)}
+}
+
+// NewRule validates a role's rule. Hidden may name result fields or
+// groups; groups are expanded.
+func NewRule(role string, hidden []string) (*Rule, error) {
+	if !rolePattern.MatchString(role) {
+		return nil, errors.New("role must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+
+	set := make(map[string]bool)
+	for _, name := range hidden {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if group, ok := Groups[name]; ok {
+			for _, field := range group {
+				set[field] = true
+			}
+			continue
+		}
+		if _, ok := resultFields[name]; !ok {
+			return nil, fmt.Errorf("unknown result field %q", name)
+		}
+		if name == "url" {
+			return nil, errors.New("url cannot be hidden")
+		}
+		set[name] = true
+	}
+
+	rule := Rule{Role: role, Hidden: make([]string, 0, len(set)), UpdatedAt: time.Now().UTC()}
+	for name := range set {
+		rule.Hidden = append(rule.Hidden, name)
+	}
+	sort.Strings(rule.Hidden)
+	return &rule, nil
+}
+
+// Put stores a rule, replacing the role's previous one
+func (s *Store) Put(rule Rule) error {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(rule)
+		if err != nil {
+			return err
+		}
+		if err := rdb.HSet(context.Background(), rulesKey, rule.Role, data).Err(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.rules[rule.Role] = rule
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns a role's rule, or nil when the role sees every field
+func (s *Store) Get(role string) *Rule {
+	if role == "" {
+		return nil
+	}
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		data, err := rdb.HGet(ctx, rulesKey, role).Bytes()
+		switch {
+		case err == redis.Nil:
+			return nil
+		case err != nil:
+			log.WithError(err).WithField("role", role).Warn("Failed to read field mask from Redis, using local copy")
+		default:
+			var rule Rule
+			if err := json.Unmarshal(data, &rule); err == nil {
+				return &rule
+			}
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if rule, ok := s.rules[role]; ok {
+		return &rule
+	}
+	return nil
+}
+
+// ForRole returns the rule applied to a role: its own, else the strictest
+// rule, so a role without a rule never sees more than a role with one. It
+// is nil only while no rules are set.
+func (s *Store) ForRole(role string) *Rule {
+	if rule := s.Get(role); rule != nil {
+		return rule
+	}
+	return s.Strictest()
+}
+
+// Strictest returns a rule hiding every field any rule hides, or nil when
+// no rules are set
+func (s *Store) Strictest() *Rule {
+	rules := s.List()
+	if len(rules) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool)
+	strictest := Rule{Hidden: []string{}}
+	for _, rule := range rules {
+		for _, name := range rule.Hidden {
+			if !set[name] {
+				set[name] = true
+				strictest.Hidden = append(strictest.Hidden, name)
+			}
+		}
+		if rule.UpdatedAt.After(strictest.UpdatedAt) {
+			strictest.UpdatedAt = rule.UpdatedAt
+		}
+	}
+	sort.Strings(strictest.Hidden)
+	return &strictest
+}
+
+// List returns every rule sorted by role
+func (s *Store) List() []Rule {
+	rules := make(map[string]Rule)
+
+	s.mu.RLock()
+	for role, rule := range s.rules {
+		rules[role] = rule
+	}
+	s.mu.RUnlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		items, err := rdb.HGetAll(ctx, rulesKey).Result()
+		if err != nil {
+			log.WithError(err).Warn("Failed to read field masks from Redis")
+		}
+		for role, value := range items {
+			var rule Rule
+			if err := json.Unmarshal([]byte(value), &rule); err == nil {
+				rules[role] = rule
+			}
+		}
+	}
+
+	list := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		list = append(list, rule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Role < list[j].Role })
+	return list
+}
+
+// Delete removes a role's rule, so it sees every field again
+func (s *Store) Delete(role string) bool {
+	s.mu.Lock()
+	_, deleted := s.rules[role]
+	delete(s.rules, role)
+	s.mu.Unlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if n, err := rdb.HDel(context.Background(), rulesKey, role).Result(); err == nil && n > 0 {
+			deleted = true
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,128 @@
+package fixture
+
+import (
+	"bytes"
+	"embed"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Host is the host search results in fixture mode point at. Fetches of any
+// host are answered from the same site.
+const Host = "fixture.godseye.test"
+
+//go:embed site
+var site embed.FS
+
+// Enabled reports whether fixture mode is on (GODS_EYE_FIXTURE=1), in which
+// searches and fetches are answered from the built-in test site instead of
+// the network
+func Enabled() bool {
+	v := os.Getenv("GODS_EYE_FIXTURE")
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+// Transport answers HTTP requests from the built-in test site
+type Transport struct{}
+
+// RoundTrip serves the page at the request path, index.html for
+// directories, and 404 for anything else
+func (Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	name := sitePath(req.URL.Path)
+	data, err := site.ReadFile(name)
+	if err != nil {
+		if data, err = site.ReadFile(path.Join(name, "index.html")); err == nil {
+			name = path.Join(name, "index.html")
+		}
+	}
+
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	if err != nil {
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = "404 Not Found"
+		data = []byte("not found\n")
+		resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		resp.Header.Set("Content-Type", contentType)
+	}
+
+	resp.ContentLength = int64(len(data))
+	if req.Method == http.MethodHead {
+		resp.Body = http.NoBody
+	} else {
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	return resp, nil
+}
+
+// Search returns up to max fixture page URLs whose text mentions any word
+// of the query, in path order, or the home page when none does
+func Search(query string, max int) []string {
+	words := strings.Fields(strings.ToLower(query))
+
+	var pages []string
+	fs.WalkDir(site, "site", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".html" {
+			return nil
+		}
+		data, err := site.ReadFile(name)
+		if err != nil {
+			return nil
+		}
+		text := strings.ToLower(string(data))
+		for _, w := range words {
+			if strings.Contains(text, w) {
+				pages = append(pages, pageURL(name))
+				break
+			}
+		}
+		return nil
+	})
+	sort.Strings(pages)
+
+	if len(pages) == 0 {
+		return []string{pageURL("site/index.html")}
+	}
+	if max > 0 && len(pages) > max {
+		pages = pages[:max]
+	}
+	return pages
+}
+
+// sitePath maps a URL path to a name inside the embedded site
+func sitePath(urlPath string) string {
+	clean := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if clean == "" {
+		return "site"
+	}
+	return path.Join("site", clean)
+}
+
+// pageURL returns the fixture URL of an embedded file
+func pageURL(name string) string {
+	p := strings.TrimPrefix(name, "site")
+	p = strings.TrimSuffix(p, "index.html")
+	return "https://" + Host + p
+}
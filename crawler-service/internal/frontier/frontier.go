@@ -0,0 +1,559 @@
+// Package frontier keeps, per tenant, the URLs of the domains the tenant
+// crawls continuously, across job boundaries: when each page was last
+// fetched and when it is due again. A page's first revisit interval
+// depends on what it looks like, hourly for front pages and news, monthly
+// for static pages such as an imprint, daily otherwise. After that it
+// halves each time the page has changed and doubles each time it has not.
+package frontier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// Revisit intervals
+const (
+	Hourly  = time.Hour
+	Daily   = 24 * time.Hour
+	Monthly = 30 * 24 * time.Hour
+
+	// MinInterval and MaxInterval bound adapted intervals
+	MinInterval = Hourly
+	MaxInterval = Monthly
+)
+
+// DefaultPagesPerRun is how many due pages a continuous crawl fetches per
+// job unless configured otherwise
+const DefaultPagesPerRun = 100
+
+const (
+	configsKey    = "frontier:configs"
+	entriesPrefix = "frontier:urls:"
+	duePrefix     = "frontier:due:"
+	leasePrefix   = "frontier:lease:"
+)
+
+var (
+	newsPath   = regexp.MustCompile(`(?i)(/news|/blog|/press|/latest|/updates|/articles?/|/category/|/feed|/(19|20)\d{2}/\d{1,2}/)`)
+	staticPath = regexp.MustCompile(`(?i)(/about|/contact|/imprint|/impressum|/legal|/privacy|/terms|/team|/careers|\.(pdf|docx?|xlsx?|pptx?)$)`)
+)
+
+// Config is a tenant's continuous crawl
+type Config struct {
+	Tenant string `json:"tenant"`
+	// Domains are crawled with their subdomains
+	Domains     []string  `json:"domains"`
+	PagesPerRun int       `json:"pages_per_run"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate normalises the domains and checks the configuration
+func (c *Config) Validate() error {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, d := range c.Domains {
+		d = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+		if u, err := url.Parse(d); err == nil && u.Hostname() != "" {
+			d = strings.ToLower(u.Hostname())
+		}
+		if d == "" || strings.ContainsAny(d, "/: ") {
+			return fmt.Errorf("invalid domain %q", d)
+		}
+		if !seen[d] {
+			seen[d] = true
+			domains = append(domains, d)
+		}
+	}
+	if len(domains) == 0 {
+		return errors.New("at least one domain is required")
+	}
+	sort.Strings(domains)
+	c.Domains = domains
+
+	if c.PagesPerRun < 0 {
+		return errors.New("pages_per_run must not be negative")
+	}
+	if c.PagesPerRun == 0 {
+		c.PagesPerRun = DefaultPagesPerRun
+	}
+	return nil
+}
+
+// Covers reports whether a URL is on one of the configured domains
+func (c Config) Covers(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range c.Domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry is a URL of a tenant's frontier
+type Entry struct {
+	URL          string    `json:"url"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+	// LastVisited is zero until the page is first scheduled
+	LastVisited time.Time `json:"last_visited,omitempty"`
+	NextVisit   time.Time `json:"next_visit"`
+	// IntervalSeconds is the current revisit interval
+	IntervalSeconds int64  `json:"interval_seconds"`
+	ContentHash     string `json:"content_hash,omitempty"`
+	Visits          int    `json:"visits"`
+	Changes         int    `json:"changes"`
+}
+
+func (e Entry) interval() time.Duration {
+	return time.Duration(e.IntervalSeconds) * time.Second
+}
+
+// Stats summarise a tenant's frontier
+type Stats struct {
+	URLs    int `json:"urls"`
+	Due     int `json:"due"`
+	Visited int `json:"visited"`
+	// Intervals counts URLs by revisit interval: hourly (under a day),
+	// daily (under a week), weekly (under a month) and monthly
+	Intervals map[string]int `json:"intervals"`
+	NextDue   *time.Time     `json:"next_due,omitempty"`
+}
+
+// InitialInterval is how soon a page is revisited after its first fetch
+func InitialInterval(link string) time.Duration {
+	u, err := url.Parse(link)
+	if err != nil {
+		return Daily
+	}
+	switch {
+	case u.Path == "" || u.Path == "/" || newsPath.MatchString(u.Path):
+		return Hourly
+	case staticPath.MatchString(u.Path):
+		return Monthly
+	}
+	return Daily
+}
+
+// Store keeps continuous crawl configurations and frontiers, in Redis when
+// connected so every instance schedules from the same frontier
+type Store struct {
+	mu         sync.Mutex
+	configs    map[string]Config
+	entries    map[string]map[string]Entry
+	leases     map[string]time.Time
+	maxEntries int
+}
+
+// NewStoreFromEnv creates an empty store keeping at most
+// CONTINUOUS_MAX_URLS URLs per tenant (default 100000)
+func NewStoreFromEnv() *Store {
+	max := 100000
+	if n, err := strconv.Atoi(os.Getenv("CONTINUOUS_MAX_URLS")); err == nil && n > 0 {
+		max = n
+	}
+	return &Store{
+		configs:    make(map[string]Config),
+		entries:    make(map[string]map[string]Entry),
+		leases:     make(map[string]time.Time),
+		maxEntries: max,
+	}
+}
+
+// PutConfig stores a tenant's continuous crawl, replacing its previous one
+func (s *Store) PutConfig(cfg Config) error {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		if err := rdb.HSet(context.Background(), configsKey, cfg.Tenant, data).Err(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.configs[cfg.Tenant] = cfg
+	s.mu.Unlock()
+	return nil
+}
+
+// Config returns a tenant's continuous crawl, or nil when it has none
+func (s *Store) Config(tenant string) *Config {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := rdb.HGet(context.Background(), configsKey, tenant).Bytes()
+		switch {
+		case err == redis.Nil:
+			return nil
+		case err != nil:
+			log.WithError(err).WithField("tenant", tenant).Warn("Failed to read continuous crawl from Redis, using local copy")
+		default:
+			var cfg Config
+			if err := json.Unmarshal(data, &cfg); err == nil {
+				return &cfg
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cfg, ok := s.configs[tenant]; ok {
+		return &cfg
+	}
+	return nil
+}
+
+// Configs returns every tenant's continuous crawl
+func (s *Store) Configs() []Config {
+	var configs []Config
+	if rdb := database.GetRedisClient(); rdb != nil {
+		all, err := rdb.HGetAll(context.Background(), configsKey).Result()
+		if err == nil {
+			for _, data := range all {
+				var cfg Config
+				if json.Unmarshal([]byte(data), &cfg) == nil {
+					configs = append(configs, cfg)
+				}
+			}
+			sort.Slice(configs, func(i, j int) bool { return configs[i].Tenant < configs[j].Tenant })
+			return configs
+		}
+		log.WithError(err).Warn("Failed to read continuous crawls from Redis, using local copy")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cfg := range s.configs {
+		configs = append(configs, cfg)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Tenant < configs[j].Tenant })
+	return configs
+}
+
+// DeleteConfig stops a tenant's continuous crawl and drops its frontier
+func (s *Store) DeleteConfig(tenant string) bool {
+	s.mu.Lock()
+	_, deleted := s.configs[tenant]
+	delete(s.configs, tenant)
+	delete(s.entries, tenant)
+	delete(s.leases, tenant)
+	s.mu.Unlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		if n, err := rdb.HDel(ctx, configsKey, tenant).Result(); err == nil && n > 0 {
+			deleted = true
+		}
+		rdb.Del(ctx, entriesPrefix+tenant, duePrefix+tenant, leasePrefix+tenant)
+	}
+	return deleted
+}
+
+// Add puts URLs not yet in a tenant's frontier into it, due at once, and
+// returns how many were added. URLs past the frontier's size limit are
+// left out.
+func (s *Store) Add(tenant string, links []string) int {
+	now := time.Now().UTC()
+	added := 0
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		size, err := rdb.HLen(ctx, entriesPrefix+tenant).Result()
+		if err == nil {
+			for _, link := range links {
+				if int(size) >= s.maxEntries {
+					break
+				}
+				data, _ := json.Marshal(Entry{URL: link, DiscoveredAt: now, NextVisit: now})
+				ok, err := rdb.HSetNX(ctx, entriesPrefix+tenant, link, data).Result()
+				if err != nil || !ok {
+					continue
+				}
+				rdb.ZAdd(ctx, duePrefix+tenant, &redis.Z{Score: float64(now.Unix()), Member: link})
+				size++
+				added++
+			}
+			return added
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to update frontier in Redis, using local copy")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.local(tenant)
+	for _, link := range links {
+		if len(entries) >= s.maxEntries {
+			break
+		}
+		if _, ok := entries[link]; !ok {
+			entries[link] = Entry{URL: link, DiscoveredAt: now, NextVisit: now}
+			added++
+		}
+	}
+	return added
+}
+
+// local returns a tenant's in-memory frontier; s.mu must be held
+func (s *Store) local(tenant string) map[string]Entry {
+	entries, ok := s.entries[tenant]
+	if !ok {
+		entries = make(map[string]Entry)
+		s.entries[tenant] = entries
+	}
+	return entries
+}
+
+// Due returns up to limit of a tenant's URLs due for a visit at now, the
+// longest overdue first
+func (s *Store) Due(tenant string, now time.Time, limit int) []Entry {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		links, err := rdb.ZRangeByScore(ctx, duePrefix+tenant, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(now.Unix(), 10),
+			Count: int64(limit),
+		}).Result()
+		if err == nil {
+			return s.load(ctx, rdb, tenant, links)
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to read frontier from Redis, using local copy")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Entry
+	for _, e := range s.entries[tenant] {
+		if !e.NextVisit.After(now) {
+			due = append(due, e)
+		}
+	}
+	sortByNextVisit(due)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due
+}
+
+func (s *Store) load(ctx context.Context, rdb *redis.Client, tenant string, links []string) []Entry {
+	if len(links) == 0 {
+		return nil
+	}
+	values, err := rdb.HMGet(ctx, entriesPrefix+tenant, links...).Result()
+	if err != nil {
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to read frontier entries from Redis")
+		return nil
+	}
+	entries := make([]Entry, 0, len(values))
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var e Entry
+		if json.Unmarshal([]byte(data), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// List returns up to limit of a tenant's URLs, the soonest due first
+func (s *Store) List(tenant string, limit int) []Entry {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		links, err := rdb.ZRange(ctx, duePrefix+tenant, 0, int64(limit)-1).Result()
+		if err == nil {
+			return s.load(ctx, rdb, tenant, links)
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to read frontier from Redis, using local copy")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]Entry, 0, len(s.entries[tenant]))
+	for _, e := range s.entries[tenant] {
+		entries = append(entries, e)
+	}
+	sortByNextVisit(entries)
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+func sortByNextVisit(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].NextVisit.Equal(entries[j].NextVisit) {
+			return entries[i].NextVisit.Before(entries[j].NextVisit)
+		}
+		return entries[i].URL < entries[j].URL
+	})
+}
+
+// Scheduled pushes back the URLs handed to a job by their current
+// interval, so the next run does not pick them again while this one
+// fetches them. Visited then records what the fetch found.
+func (s *Store) Scheduled(tenant string, entries []Entry, at time.Time) {
+	for _, e := range entries {
+		interval := e.interval()
+		if interval == 0 {
+			interval = InitialInterval(e.URL)
+		}
+		e.NextVisit = at.Add(interval)
+		s.put(tenant, e)
+	}
+}
+
+// Visited records that a page of a tenant's frontier was fetched at at
+// with content hash hash, and schedules its next visit: the page's
+// initial interval after its first visit, then half the interval when the
+// page has changed and twice the interval when it has not
+func (s *Store) Visited(tenant, link, hash string, at time.Time) {
+	e, ok := s.get(tenant, link)
+	if !ok {
+		e = Entry{URL: link, DiscoveredAt: at}
+	}
+
+	interval := e.interval()
+	switch {
+	case e.ContentHash == "" || interval == 0:
+		interval = InitialInterval(link)
+	case hash != "" && hash != e.ContentHash:
+		interval /= 2
+		e.Changes++
+	default:
+		interval *= 2
+	}
+	if interval < MinInterval {
+		interval = MinInterval
+	}
+	if interval > MaxInterval {
+		interval = MaxInterval
+	}
+
+	e.Visits++
+	e.LastVisited = at
+	if hash != "" {
+		e.ContentHash = hash
+	}
+	e.IntervalSeconds = int64(interval / time.Second)
+	e.NextVisit = at.Add(interval)
+	s.put(tenant, e)
+}
+
+func (s *Store) get(tenant, link string) (Entry, bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := rdb.HGet(context.Background(), entriesPrefix+tenant, link).Bytes()
+		if err == nil {
+			var e Entry
+			if json.Unmarshal(data, &e) == nil {
+				return e, true
+			}
+		}
+		if err == redis.Nil {
+			return Entry{}, false
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[tenant][link]
+	return e, ok
+}
+
+func (s *Store) put(tenant string, e Entry) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		data, err := json.Marshal(e)
+		if err == nil {
+			if err = rdb.HSet(ctx, entriesPrefix+tenant, e.URL, data).Err(); err == nil {
+				rdb.ZAdd(ctx, duePrefix+tenant, &redis.Z{Score: float64(e.NextVisit.Unix()), Member: e.URL})
+				return
+			}
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to update frontier in Redis, using local copy")
+	}
+
+	s.mu.Lock()
+	s.local(tenant)[e.URL] = e
+	s.mu.Unlock()
+}
+
+// Stats summarises a tenant's frontier
+func (s *Store) Stats(tenant string) Stats {
+	entries := s.List(tenant, s.maxEntries)
+	now := time.Now()
+	stats := Stats{URLs: len(entries), Intervals: make(map[string]int)}
+	for _, e := range entries {
+		if !e.NextVisit.After(now) {
+			stats.Due++
+		} else if stats.NextDue == nil || e.NextVisit.Before(*stats.NextDue) {
+			next := e.NextVisit
+			stats.NextDue = &next
+		}
+		if e.Visits == 0 {
+			continue
+		}
+		stats.Visited++
+		switch interval := e.interval(); {
+		case interval < Daily:
+			stats.Intervals["hourly"]++
+		case interval < 7*Daily:
+			stats.Intervals["daily"]++
+		case interval < Monthly:
+			stats.Intervals["weekly"]++
+		default:
+			stats.Intervals["monthly"]++
+		}
+	}
+	return stats
+}
+
+// Lease reserves a tenant's next run for one instance for up to ttl,
+// reporting whether it was free. Release frees it once the run is over.
+func (s *Store) Lease(tenant string, ttl time.Duration) bool {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ok, err := rdb.SetNX(context.Background(), leasePrefix+tenant, time.Now().UTC().Format(time.RFC3339), ttl).Result()
+		if err == nil {
+			return ok
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to lease continuous crawl in Redis, using local copy")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until, ok := s.leases[tenant]; ok && time.Now().Before(until) {
+		return false
+	}
+	s.leases[tenant] = time.Now().Add(ttl)
+	return true
+}
+
+// Release frees a tenant's lease
+func (s *Store) Release(tenant string) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		rdb.Del(context.Background(), leasePrefix+tenant)
+	}
+	s.mu.Lock()
+	delete(s.leases, tenant)
+	s.mu.Unlock()
+}
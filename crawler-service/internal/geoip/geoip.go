@@ -0,0 +1,175 @@
+package geoip
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/models"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+	log "github.com/sirupsen/logrus"
+)
+
+// Locator maps IPs to country and network owner using MaxMind GeoLite2
+// databases. The databases are reopened whenever their files change, so
+// they can be replaced in place by geoipupdate.
+type Locator struct {
+	countryPath string
+	asnPath     string
+
+	mu         sync.RWMutex
+	country    *geoip2.Reader
+	asn        *geoip2.Reader
+	countryMod time.Time
+	asnMod     time.Time
+
+	hostsMu sync.Mutex
+	hosts   map[string]resolvedHost
+}
+
+type resolvedHost struct {
+	ip      string
+	expires time.Time
+}
+
+// hostTTL is how long resolved host addresses are reused
+const hostTTL = 10 * time.Minute
+
+// NewLocatorFromEnv opens GEOIP_COUNTRY_DB (a GeoLite2-Country or City
+// database) and GEOIP_ASN_DB (GeoLite2-ASN). Either may be unset.
+func NewLocatorFromEnv() *Locator {
+	l := &Locator{
+		countryPath: os.Getenv("GEOIP_COUNTRY_DB"),
+		asnPath:     os.Getenv("GEOIP_ASN_DB"),
+		hosts:       make(map[string]resolvedHost),
+	}
+	l.reload()
+	return l
+}
+
+// Enabled reports whether any database is loaded
+func (l *Locator) Enabled() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.country != nil || l.asn != nil
+}
+
+// Watch reloads changed databases every interval until ctx is done
+func (l *Locator) Watch(ctx context.Context, interval time.Duration) {
+	if l.countryPath == "" && l.asnPath == "" {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.reload()
+			}
+		}
+	}()
+}
+
+// reload reopens each database whose file changed since it was loaded
+func (l *Locator) reload() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.country, l.countryMod = reopen(l.countryPath, l.country, l.countryMod)
+	l.asn, l.asnMod = reopen(l.asnPath, l.asn, l.asnMod)
+}
+
+func reopen(path string, current *geoip2.Reader, loaded time.Time) (*geoip2.Reader, time.Time) {
+	if path == "" {
+		return current, loaded
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Warn("GeoIP database unavailable")
+		return current, loaded
+	}
+	if current != nil && !info.ModTime().After(loaded) {
+		return current, loaded
+	}
+
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Warn("Failed to open GeoIP database")
+		return current, loaded
+	}
+	if current != nil {
+		current.Close()
+	}
+	log.WithField("path", path).Info("GeoIP database loaded")
+	return reader, info.ModTime()
+}
+
+// Lookup returns location and network data for ip, or nil if unknown
+func (l *Locator) Lookup(ip string) *models.GeoInfo {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	geo := &models.GeoInfo{IP: ip}
+	if l.country != nil {
+		if rec, err := l.country.Country(addr); err == nil {
+			geo.Country = rec.Country.IsoCode
+			geo.CountryName = rec.Country.Names["en"]
+		}
+	}
+	if l.asn != nil {
+		if rec, err := l.asn.ASN(addr); err == nil {
+			geo.ASN = rec.AutonomousSystemNumber
+			geo.Organization = rec.AutonomousSystemOrganization
+		}
+	}
+	if geo.Country == "" && geo.ASN == 0 {
+		return nil
+	}
+	return geo
+}
+
+// LookupHost resolves host and looks up its first address
+func (l *Locator) LookupHost(ctx context.Context, host string) *models.GeoInfo {
+	ip, err := l.resolve(ctx, host)
+	if err != nil {
+		return nil
+	}
+	return l.Lookup(ip)
+}
+
+func (l *Locator) resolve(ctx context.Context, host string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+
+	now := time.Now()
+	l.hostsMu.Lock()
+	entry, ok := l.hosts[host]
+	l.hostsMu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.ip, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return "", err
+	}
+	ip := addrs[0].IP.String()
+
+	l.hostsMu.Lock()
+	l.hosts[host] = resolvedHost{ip: ip, expires: now.Add(hostTTL)}
+	l.hostsMu.Unlock()
+	return ip, nil
+}
@@ -0,0 +1,146 @@
+package geotag
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Sources of an extracted point
+const (
+	SourceText   = "text"
+	SourceMeta   = "meta"
+	SourceSchema = "schema"
+	SourceEXIF   = "exif"
+)
+
+// maxTextPoints bounds coordinates taken from free text
+const maxTextPoints = 20
+
+// coordPattern matches decimal "lat, lon" pairs with at least three
+// decimals, which keeps version numbers and prices out
+var coordPattern = regexp.MustCompile(`(-?\d{1,2}\.\d{3,})\s*[,;]\s*(-?\d{1,3}\.\d{3,})`)
+
+// Extract collects coordinates and place names from a page's geo meta
+// tags, schema.org markup and text
+func Extract(doc *goquery.Selection, text string) *models.ContentGeo {
+	g := &models.ContentGeo{}
+
+	// geo.position "lat;lon" and ICBM "lat, lon"
+	for _, name := range []string{"geo.position", "ICBM"} {
+		content, _ := doc.Find(`meta[name="` + name + `"]`).Attr("content")
+		if m := coordPattern.FindStringSubmatch(content); m != nil {
+			g.Add(m[1], m[2], SourceMeta)
+		}
+	}
+	for _, prefix := range []string{"place:location:", "og:"} {
+		lat, _ := doc.Find(`meta[property="` + prefix + `latitude"]`).Attr("content")
+		lon, _ := doc.Find(`meta[property="` + prefix + `longitude"]`).Attr("content")
+		g.Add(lat, lon, SourceMeta)
+	}
+	for _, name := range []string{"geo.placename", "geo.region"} {
+		if content, _ := doc.Find(`meta[name="` + name + `"]`).Attr("content"); content != "" {
+			g.AddPlace(content)
+		}
+	}
+
+	// schema.org microdata
+	doc.Find(`[itemprop="geo"]`).Each(func(_ int, s *goquery.Selection) {
+		g.Add(itemprop(s, "latitude"), itemprop(s, "longitude"), SourceSchema)
+	})
+	doc.Find(`[itemprop="addressLocality"], [itemprop="addressRegion"], [itemprop="addressCountry"]`).Each(func(_ int, s *goquery.Selection) {
+		g.AddPlace(s.Text())
+	})
+
+	// schema.org JSON-LD
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var data interface{}
+		if json.Unmarshal([]byte(s.Text()), &data) == nil {
+			walkJSONLD(g, data)
+		}
+	})
+
+	for i, m := range coordPattern.FindAllStringSubmatch(text, -1) {
+		if i == maxTextPoints {
+			break
+		}
+		g.Add(m[1], m[2], SourceText)
+	}
+
+	if len(g.Points) == 0 && len(g.Places) == 0 {
+		return nil
+	}
+	return g
+}
+
+func itemprop(s *goquery.Selection, name string) string {
+	el := s.Find(`[itemprop="` + name + `"]`).First()
+	if content, ok := el.Attr("content"); ok {
+		return content
+	}
+	return strings.TrimSpace(el.Text())
+}
+
+// walkJSONLD collects GeoCoordinates and PostalAddress values
+func walkJSONLD(g *models.ContentGeo, v interface{}) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			walkJSONLD(g, item)
+		}
+	case map[string]interface{}:
+		if lat, ok := v["latitude"]; ok {
+			g.Add(jsonString(lat), jsonString(v["longitude"]), SourceSchema)
+		}
+		for _, key := range []string{"addressLocality", "addressRegion", "addressCountry"} {
+			if s, ok := v[key].(string); ok {
+				g.AddPlace(s)
+			}
+		}
+		for _, child := range v {
+			walkJSONLD(g, child)
+		}
+	}
+}
+
+func jsonString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// EXIF is the location and capture time read from an image
+type EXIF struct {
+	Lat, Lon float64
+	HasGPS   bool
+	Taken    time.Time
+}
+
+// ReadEXIF reads the GPS position and capture time from an image's EXIF
+// data
+func ReadEXIF(r io.Reader) (EXIF, bool) {
+	x, err := exif.Decode(r)
+	if err != nil {
+		return EXIF{}, false
+	}
+
+	var info EXIF
+	if lat, lon, err := x.LatLong(); err == nil {
+		info.Lat, info.Lon, info.HasGPS = lat, lon, true
+	}
+	if taken, err := x.DateTime(); err == nil {
+		info.Taken = taken.UTC()
+	}
+	return info, info.HasGPS || !info.Taken.IsZero()
+}
@@ -0,0 +1,114 @@
+package graph
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cypher renders the graph as idempotent MERGE statements
+func (g *Graph) Cypher() string {
+	var b strings.Builder
+	for _, n := range g.Nodes() {
+		fmt.Fprintf(&b, "MERGE (n:%s {name: %s})", n.Label, cypherValue(n.Name))
+		if len(n.Props) > 0 {
+			b.WriteString(" SET n += {")
+			for i, k := range sortedKeys(n.Props) {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "%s: %s", k, cypherValue(n.Props[k]))
+			}
+			b.WriteString("}")
+		}
+		b.WriteString(";\n")
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(&b, "MATCH (a:%s {name: %s}), (b:%s {name: %s}) MERGE (a)-[:%s]->(b);\n",
+			e.FromLabel, cypherValue(e.From), e.ToLabel, cypherValue(e.To), e.Type)
+	}
+	return b.String()
+}
+
+func cypherValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		r := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
+		return "'" + r.Replace(v) + "'"
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return cypherValue(fmt.Sprint(v))
+}
+
+// WriteCSV writes a zip with nodes.csv and relationships.csv in the
+// neo4j-admin bulk import format
+func (g *Graph) WriteCSV(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	nodes := g.Nodes()
+	propKeys := make(map[string]bool)
+	for _, n := range nodes {
+		for k := range n.Props {
+			propKeys[k] = true
+		}
+	}
+	keys := sortedKeys(propKeys)
+
+	f, err := zw.Create("nodes.csv")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	cw.Write(append([]string{"id:ID", "name", ":LABEL"}, keys...))
+	for _, n := range nodes {
+		row := []string{nodeID(n.Label, n.Name), n.Name, n.Label}
+		for _, k := range keys {
+			if v, ok := n.Props[k]; ok {
+				row = append(row, fmt.Sprint(v))
+			} else {
+				row = append(row, "")
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	f, err = zw.Create("relationships.csv")
+	if err != nil {
+		return err
+	}
+	cw = csv.NewWriter(f)
+	cw.Write([]string{":START_ID", ":END_ID", ":TYPE"})
+	for _, e := range g.Edges() {
+		cw.Write([]string{nodeID(e.FromLabel, e.From), nodeID(e.ToLabel, e.To), e.Type})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func nodeID(label, name string) string {
+	return label + ":" + name
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
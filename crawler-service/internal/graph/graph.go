@@ -0,0 +1,209 @@
+package graph
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Node labels
+const (
+	LabelJob    = "Job"
+	LabelPage   = "Page"
+	LabelDomain = "Domain"
+	LabelEmail  = "Email"
+	LabelPhone  = "Phone"
+	LabelBreach = "Breach"
+	LabelPerson = "Person"
+	LabelIP     = "IP"
+)
+
+// Relationship types
+const (
+	RelCrawled    = "CRAWLED"
+	RelHostedOn   = "HOSTED_ON"
+	RelLinksTo    = "LINKS_TO"
+	RelMentions   = "MENTIONS"
+	RelExposedIn  = "EXPOSED_IN"
+	RelHasProfile = "HAS_PROFILE"
+	RelResolvesTo = "RESOLVES_TO"
+)
+
+// Node is an entity keyed by label and name, matching the intel service's
+// graph where every entity carries a unique name
+type Node struct {
+	Label string
+	Name  string
+	Props map[string]interface{}
+}
+
+// Edge is a relationship between two nodes
+type Edge struct {
+	FromLabel, From string
+	Type            string
+	ToLabel, To     string
+}
+
+// Graph is the entity graph of a job
+type Graph struct {
+	nodes map[string]*Node
+	edges map[Edge]bool
+}
+
+func newGraph() *Graph {
+	return &Graph{nodes: make(map[string]*Node), edges: make(map[Edge]bool)}
+}
+
+// Build derives the entity graph of a job from its results
+func Build(job *models.CrawlJob, results []models.CrawlResult) *Graph {
+	g := newGraph()
+	g.node(LabelJob, job.ID, map[string]interface{}{
+		"query":      job.Query,
+		"tenant":     job.Tenant,
+		"type":       job.Type,
+		"started_at": job.StartedAt.Format(time.RFC3339),
+	})
+
+	for _, r := range results {
+		props := map[string]interface{}{
+			"title":       r.Title,
+			"status_code": r.StatusCode,
+			"crawled_at":  r.CrawledAt.Format(time.RFC3339),
+		}
+		if r.Source != "" {
+			props["source"] = r.Source
+		}
+		g.page(r.URL, props)
+		if domain := hostname(r.URL); r.Parked && domain != "" {
+			g.node(LabelDomain, domain, map[string]interface{}{"parked": true, "parking_provider": r.ParkingProvider})
+		}
+		g.edge(LabelJob, job.ID, RelCrawled, LabelPage, r.URL)
+
+		if r.Hosting != nil {
+			if domain := hostname(r.URL); domain != "" {
+				ip := map[string]interface{}{"country": r.Hosting.Country, "organization": r.Hosting.Organization}
+				if r.Hosting.ASN != 0 {
+					ip["asn"] = int64(r.Hosting.ASN)
+				}
+				g.node(LabelIP, r.Hosting.IP, ip)
+				g.edge(LabelDomain, domain, RelResolvesTo, LabelIP, r.Hosting.IP)
+			}
+		}
+
+		for _, link := range r.Links {
+			g.page(link.URL, nil)
+			g.edge(LabelPage, r.URL, RelLinksTo, LabelPage, link.URL)
+		}
+
+		for _, email := range r.Emails {
+			g.node(LabelEmail, email.Address, confidenceProps(email.Confidence))
+			g.edge(LabelPage, r.URL, RelMentions, LabelEmail, email.Address)
+			for _, b := range email.Breaches {
+				g.node(LabelBreach, b.Name, map[string]interface{}{"domain": b.Domain, "breach_date": b.BreachDate})
+				g.edge(LabelEmail, email.Address, RelExposedIn, LabelBreach, b.Name)
+			}
+		}
+
+		for _, number := range r.Phones {
+			props := confidenceProps(number.Confidence)
+			props["country"], props["type"] = number.Country, number.Type
+			g.node(LabelPhone, number.Number, props)
+			g.edge(LabelPage, r.URL, RelMentions, LabelPhone, number.Number)
+		}
+
+		if username := r.Fields["username"]; r.Source == models.SourceUsername && username != "" {
+			g.node(LabelPerson, username, nil)
+			g.edge(LabelPerson, username, RelHasProfile, LabelPage, r.URL)
+		}
+	}
+	return g
+}
+
+// confidenceProps returns the props of an entity node with its confidence
+// score, if it has one. Nodes keep the highest score of their mentions.
+func confidenceProps(score float64) map[string]interface{} {
+	props := make(map[string]interface{})
+	if score > 0 {
+		props["confidence"] = score
+	}
+	return props
+}
+
+// page adds a URL node and the domain hosting it
+func (g *Graph) page(u string, props map[string]interface{}) {
+	g.node(LabelPage, u, props)
+	if domain := hostname(u); domain != "" {
+		g.node(LabelDomain, domain, nil)
+		g.edge(LabelPage, u, RelHostedOn, LabelDomain, domain)
+	}
+}
+
+// node adds a node or merges props into an existing one, keeping the
+// highest confidence
+func (g *Graph) node(label, name string, props map[string]interface{}) {
+	key := label + "\x00" + name
+	n, ok := g.nodes[key]
+	if !ok {
+		n = &Node{Label: label, Name: name, Props: make(map[string]interface{})}
+		g.nodes[key] = n
+	}
+	for k, v := range props {
+		if v == "" {
+			continue
+		}
+		if score, ok := v.(float64); ok && k == "confidence" {
+			if prev, ok := n.Props[k].(float64); ok && prev >= score {
+				continue
+			}
+		}
+		n.Props[k] = v
+	}
+}
+
+func (g *Graph) edge(fromLabel, from, relType, toLabel, to string) {
+	g.edges[Edge{FromLabel: fromLabel, From: from, Type: relType, ToLabel: toLabel, To: to}] = true
+}
+
+// Nodes returns the nodes ordered by label and name
+func (g *Graph) Nodes() []Node {
+	nodes := make([]Node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, *n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Label != nodes[j].Label {
+			return nodes[i].Label < nodes[j].Label
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes
+}
+
+// Edges returns the relationships in a stable order
+func (g *Graph) Edges() []Edge {
+	edges := make([]Edge, 0, len(g.edges))
+	for e := range g.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return edges
+}
+
+func hostname(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
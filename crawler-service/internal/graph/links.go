@@ -0,0 +1,192 @@
+package graph
+
+import (
+	"bufio"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LinkNode is a page of a link graph. Pages linked to but not crawled
+// carry only their URL.
+type LinkNode struct {
+	URL        string `json:"url"`
+	Title      string `json:"title,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Depth      int    `json:"depth"`
+	Crawled    bool   `json:"crawled"`
+	// InDegree and OutDegree count the distinct pages linking to and
+	// linked from the page
+	InDegree  int `json:"in_degree"`
+	OutDegree int `json:"out_degree"`
+}
+
+// LinkEdge is a link from one page to another; Count is how many links
+// on the source page point to the target
+type LinkEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Count  int    `json:"count"`
+}
+
+// LinkGraph is the graph of links between the pages of a job
+type LinkGraph struct {
+	Nodes []LinkNode `json:"nodes"`
+	Edges []LinkEdge `json:"edges"`
+}
+
+// NormalizeLink resolves a link against the URL of the page it was found
+// on and puts it in canonical form: scheme and host lowercased, default
+// ports and the fragment dropped, and an empty path made "/". Links that
+// are not http(s) report false.
+func NormalizeLink(base *url.URL, ref string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), true
+}
+
+// Links derives the link graph of a job's results. With crawledOnly, only
+// links between pages the job crawled are kept; otherwise the pages they
+// link to are nodes as well. Links from a page to itself are left out.
+func Links(results []models.CrawlResult, crawledOnly bool) *LinkGraph {
+	nodes := make(map[string]*LinkNode)
+	for _, r := range results {
+		u, ok := NormalizeLink(nil, r.URL)
+		if !ok {
+			continue
+		}
+		if _, seen := nodes[u]; seen {
+			continue
+		}
+		nodes[u] = &LinkNode{URL: u, Title: r.Title, StatusCode: r.StatusCode, Depth: r.Depth, Crawled: true}
+	}
+
+	counts := make(map[[2]string]int)
+	for _, r := range results {
+		base, err := url.Parse(r.URL)
+		if err != nil {
+			continue
+		}
+		source, ok := NormalizeLink(nil, r.URL)
+		if !ok {
+			continue
+		}
+		for _, link := range r.Links {
+			target, ok := NormalizeLink(base, link.URL)
+			if !ok || target == source {
+				continue
+			}
+			if _, crawled := nodes[target]; !crawled {
+				if crawledOnly {
+					continue
+				}
+				nodes[target] = &LinkNode{URL: target}
+			}
+			counts[[2]string{source, target}]++
+		}
+	}
+
+	g := &LinkGraph{Nodes: make([]LinkNode, 0, len(nodes)), Edges: make([]LinkEdge, 0, len(counts))}
+	for key, count := range counts {
+		nodes[key[0]].OutDegree++
+		nodes[key[1]].InDegree++
+		g.Edges = append(g.Edges, LinkEdge{Source: key[0], Target: key[1], Count: count})
+	}
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].URL < g.Nodes[j].URL })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].Source != g.Edges[j].Source {
+			return g.Edges[i].Source < g.Edges[j].Source
+		}
+		return g.Edges[i].Target < g.Edges[j].Target
+	})
+	return g
+}
+
+// WriteGraphML writes the link graph as a directed GraphML document, as
+// read by Gephi, Cytoscape and yEd. Nodes are keyed by their URL.
+func (g *LinkGraph) WriteGraphML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, key := range []struct{ id, target, name, kind string }{
+		{"url", "node", "url", "string"},
+		{"title", "node", "title", "string"},
+		{"status_code", "node", "status_code", "int"},
+		{"depth", "node", "depth", "int"},
+		{"crawled", "node", "crawled", "boolean"},
+		{"in_degree", "node", "in_degree", "int"},
+		{"out_degree", "node", "out_degree", "int"},
+		{"count", "edge", "count", "int"},
+	} {
+		fmt.Fprintf(bw, `  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n", key.id, key.target, key.name, key.kind)
+	}
+	bw.WriteString(`  <graph id="links" edgedefault="directed">` + "\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(bw, `    <node id="%s">`, xmlAttr(n.URL))
+		graphMLData(bw, "url", n.URL)
+		if n.Title != "" {
+			graphMLData(bw, "title", n.Title)
+		}
+		if n.Crawled {
+			graphMLData(bw, "status_code", strconv.Itoa(n.StatusCode))
+			graphMLData(bw, "depth", strconv.Itoa(n.Depth))
+		}
+		graphMLData(bw, "crawled", strconv.FormatBool(n.Crawled))
+		graphMLData(bw, "in_degree", strconv.Itoa(n.InDegree))
+		graphMLData(bw, "out_degree", strconv.Itoa(n.OutDegree))
+		bw.WriteString("</node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(bw, `    <edge id="e%d" source="%s" target="%s">`, i, xmlAttr(e.Source), xmlAttr(e.Target))
+		graphMLData(bw, "count", strconv.Itoa(e.Count))
+		bw.WriteString("</edge>\n")
+	}
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+func graphMLData(w *bufio.Writer, key, value string) {
+	fmt.Fprintf(w, `<data key="%s">`, key)
+	xml.EscapeText(w, []byte(value))
+	w.WriteString("</data>")
+}
+
+func xmlAttr(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
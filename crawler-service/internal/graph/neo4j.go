@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// batchSize bounds the rows sent per UNWIND statement
+const batchSize = 500
+
+// Neo4jWriter writes graphs into Neo4j over Bolt
+type Neo4jWriter struct {
+	driver neo4j.DriverWithContext
+}
+
+// NewNeo4jWriterFromEnv connects with NEO4J_URI, NEO4J_USER and
+// NEO4J_PASSWORD, the same settings the intel service uses. It returns nil
+// when NEO4J_URI is unset.
+func NewNeo4jWriterFromEnv() (*Neo4jWriter, error) {
+	uri := os.Getenv("NEO4J_URI")
+	if uri == "" {
+		return nil, nil
+	}
+	user := os.Getenv("NEO4J_USER")
+	if user == "" {
+		user = "neo4j"
+	}
+
+	driver, err := neo4j.NewDriverWithContext(uri, neo4j.BasicAuth(user, os.Getenv("NEO4J_PASSWORD"), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Neo4j driver: %w", err)
+	}
+	return &Neo4jWriter{driver: driver}, nil
+}
+
+// Write merges the graph's nodes and relationships into the database
+func (w *Neo4jWriter) Write(ctx context.Context, g *Graph) error {
+	session := w.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	nodesByLabel := make(map[string][]map[string]interface{})
+	for _, n := range g.Nodes() {
+		nodesByLabel[n.Label] = append(nodesByLabel[n.Label], map[string]interface{}{
+			"name":  n.Name,
+			"props": n.Props,
+		})
+	}
+	for _, label := range sortedKeys(nodesByLabel) {
+		query := fmt.Sprintf("UNWIND $rows AS row MERGE (n:%s {name: row.name}) SET n += row.props", label)
+		if err := w.run(ctx, session, query, nodesByLabel[label]); err != nil {
+			return err
+		}
+	}
+
+	edgesByShape := make(map[string][]map[string]interface{})
+	for _, e := range g.Edges() {
+		shape := fmt.Sprintf("MATCH (a:%s {name: row.from}), (b:%s {name: row.to}) MERGE (a)-[:%s]->(b)", e.FromLabel, e.ToLabel, e.Type)
+		edgesByShape[shape] = append(edgesByShape[shape], map[string]interface{}{"from": e.From, "to": e.To})
+	}
+	for _, shape := range sortedKeys(edgesByShape) {
+		if err := w.run(ctx, session, "UNWIND $rows AS row "+shape, edgesByShape[shape]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Neo4jWriter) run(ctx context.Context, session neo4j.SessionWithContext, query string, rows []map[string]interface{}) error {
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := rows[start:end]
+
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx, query, map[string]interface{}{"rows": batch})
+			if err != nil {
+				return nil, err
+			}
+			return result.Consume(ctx)
+		})
+		if err != nil {
+			return fmt.Errorf("neo4j write failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close releases the driver
+func (w *Neo4jWriter) Close(ctx context.Context) error {
+	return w.driver.Close(ctx)
+}
@@ -0,0 +1,155 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+	crawlerv1 "definitelynotaspy/crawler-service/proto/crawler/v1"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// crawlRequest converts a crawler.v1.CrawlRequest: options_json first, then
+// the message's own fields over it
+func crawlRequest(msg *crawlerv1.CrawlRequest) (models.CrawlRequest, error) {
+	var req models.CrawlRequest
+	if msg.OptionsJson != "" {
+		if err := json.Unmarshal([]byte(msg.OptionsJson), &req); err != nil {
+			return req, fmt.Errorf("invalid options_json: %w", err)
+		}
+	}
+
+	setString(&req.Query, msg.Query)
+	setString(&req.Type, msg.Type)
+	setString(&req.Mode, msg.Mode)
+	setString(&req.Tenant, msg.Tenant)
+	setString(&req.UserAgent, msg.UserAgent)
+	setString(&req.Region, msg.Region)
+	setString(&req.ExternalID, msg.ExternalId)
+	setString(&req.CaseID, msg.CaseId)
+	if msg.MaxPages != 0 {
+		req.MaxPages = int(msg.MaxPages)
+	}
+	if msg.MaxDepth != 0 {
+		req.MaxDepth = int(msg.MaxDepth)
+	}
+	req.SeedURLs = append(req.SeedURLs, msg.SeedUrls...)
+	req.AllowedDomains = append(req.AllowedDomains, msg.AllowedDomains...)
+	req.RenderJS = req.RenderJS || msg.RenderJs
+	req.CaptureHTML = req.CaptureHTML || msg.CaptureHtml
+	req.CaptureScreenshot = req.CaptureScreenshot || msg.CaptureScreenshot
+	req.IncludeDocuments = req.IncludeDocuments || msg.IncludeDocuments
+	for key, value := range msg.Headers {
+		if req.Headers == nil {
+			req.Headers = make(map[string]string)
+		}
+		req.Headers[key] = value
+	}
+	return req, nil
+}
+
+// setString sets *field to value unless value is empty, proto3's unset
+func setString(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+// timestamp converts a time, leaving the zero time unset
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// crawlJob converts a job to a crawler.v1.CrawlJob
+func crawlJob(job *models.CrawlJob) *crawlerv1.CrawlJob {
+	return &crawlerv1.CrawlJob{
+		Id:           job.ID,
+		Query:        job.Query,
+		Status:       job.Status,
+		Type:         job.Type,
+		Tenant:       job.Tenant,
+		ExternalId:   job.ExternalID,
+		CaseId:       job.CaseID,
+		MaxPages:     int32(job.MaxPages),
+		MaxDepth:     int32(job.MaxDepth),
+		PagesCrawled: int32(job.PagesCrawled),
+		UrlsFound:    int32(job.URLsFound),
+		StartedAt:    timestamp(job.StartedAt),
+		CompletedAt:  timestamp(job.CompletedAt),
+		Error:        job.Error,
+		ErrorCode:    job.ErrorCode,
+		Partial:      job.Partial,
+		Region:       job.Region,
+	}
+}
+
+// crawlResult converts a result to a crawler.v1.CrawlResult
+func crawlResult(r *models.CrawlResult) *crawlerv1.CrawlResult {
+	msg := &crawlerv1.CrawlResult{
+		Url:            r.URL,
+		Title:          r.Title,
+		Content:        r.Content,
+		StatusCode:     int32(r.StatusCode),
+		CrawledAt:      timestamp(r.CrawledAt),
+		Depth:          int32(r.Depth),
+		DiscoveredFrom: r.DiscoveredFrom,
+		Error:          r.Error,
+		ErrorCode:      r.ErrorCode,
+		ContentHash:    r.ContentHash,
+		ContentType:    r.ContentType,
+		SizeBytes:      int64(r.SizeBytes),
+		HtmlRef:        r.HTMLRef,
+		ScreenshotRef:  r.ScreenshotRef,
+		Fields:         r.Fields,
+	}
+	for _, link := range r.Links {
+		msg.Links = append(msg.Links, link.URL)
+	}
+	return msg
+}
+
+// jobStatus converts a status to a crawler.v1.JobStatus carrying results
+func jobStatus(s *models.StatusResponse, results []models.CrawlResult) *crawlerv1.JobStatus {
+	msg := &crawlerv1.JobStatus{
+		JobId:         s.JobID,
+		Status:        s.Status,
+		QueuePosition: int32(s.QueuePosition),
+		PagesCrawled:  int32(s.PagesCrawled),
+		UrlsFound:     int32(s.URLsFound),
+		Progress:      s.Progress,
+		StartedAt:     timestamp(s.StartedAt),
+		CompletedAt:   timestamp(s.CompletedAt),
+		Error:         s.Error,
+		ErrorCode:     s.ErrorCode,
+		Partial:       s.Partial,
+		Retries:       int32(s.Retries),
+		StorageBytes:  s.StorageBytes,
+	}
+	if len(s.ErrorCounts) > 0 {
+		msg.ErrorCounts = make(map[string]int32, len(s.ErrorCounts))
+		for code, n := range s.ErrorCounts {
+			msg.ErrorCounts[code] = int32(n)
+		}
+	}
+	for i := range results {
+		msg.Results = append(msg.Results, crawlResult(&results[i]))
+	}
+	return msg
+}
+
+// listJobsResponse converts a page of jobs to a crawler.v1.ListJobsResponse
+func listJobsResponse(page models.JobListResponse) *crawlerv1.ListJobsResponse {
+	msg := &crawlerv1.ListJobsResponse{
+		Total:      int32(page.Total),
+		NextCursor: page.NextCursor,
+	}
+	for _, job := range page.Jobs {
+		msg.Jobs = append(msg.Jobs, crawlJob(job))
+	}
+	return msg
+}
@@ -0,0 +1,307 @@
+// Package grpcapi serves the crawler's gRPC API (proto/crawler/v1) beside
+// the REST API, with grpc-go. Calls are made on the crawler service through
+// handlers.Caller, so they are authenticated, validated and limited exactly
+// like their REST counterparts. The server also offers the standard health
+// and reflection services.
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/handlers"
+	"definitelynotaspy/crawler-service/internal/models"
+	crawlerv1 "definitelynotaspy/crawler-service/proto/crawler/v1"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// statusInterval is how often GetStatus checks a job for changes
+	statusInterval = time.Second
+	// resultsPerMessage is how many results a GetStatus message carries
+	resultsPerMessage = 100
+)
+
+// NewServerFromEnv returns a gRPC server of the crawler service, the health
+// service and reflection. With GRPC_TLS_CERT and GRPC_TLS_KEY set it serves
+// TLS with that certificate and key, else plaintext.
+func NewServerFromEnv() (*grpc.Server, error) {
+	var opts []grpc.ServerOption
+	if certFile, keyFile := os.Getenv("GRPC_TLS_CERT"), os.Getenv("GRPC_TLS_KEY"); certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})))
+	}
+	return NewServer(opts...), nil
+}
+
+// NewServer returns a gRPC server of the crawler service, the health
+// service and reflection, with the given options
+func NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(logUnary, authenticateUnary),
+		grpc.ChainStreamInterceptor(logStream, authenticateStream),
+	)
+	server := grpc.NewServer(opts...)
+	crawlerv1.RegisterCrawlerServiceServer(server, &service{})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	return server
+}
+
+// service implements crawler.v1.CrawlerService
+type service struct {
+	crawlerv1.UnimplementedCrawlerServiceServer
+}
+
+func (s *service) StartCrawl(ctx context.Context, msg *crawlerv1.CrawlRequest) (*crawlerv1.CrawlJob, error) {
+	req, err := crawlRequest(msg)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp, apiErr := callerOf(ctx).StartCrawl(req)
+	if apiErr != nil {
+		return nil, toStatus(apiErr)
+	}
+	return crawlJob(resp.Job), nil
+}
+
+func (s *service) GetStatus(req *crawlerv1.GetStatusRequest, stream crawlerv1.CrawlerService_GetStatusServer) error {
+	if req.JobId == "" {
+		return status.Error(codes.InvalidArgument, "job_id is required")
+	}
+	caller := callerOf(stream.Context())
+
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	var last *crawlerv1.JobStatus
+	for {
+		job, apiErr := caller.Status(req.JobId)
+		if apiErr != nil {
+			return toStatus(apiErr)
+		}
+		msg := jobStatus(&job, nil)
+		if !proto.Equal(msg, last) {
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+			last = msg
+		}
+		if finished(job.Status) {
+			if req.IncludeResults {
+				return sendResults(caller, &job, stream)
+			}
+			return nil
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return toStatus(stream.Context().Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// finished reports whether a job with status has finished
+func finished(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled"
+}
+
+// sendResults sends a finished job's results after its final status, in
+// messages repeating that status
+func sendResults(caller *handlers.Caller, job *models.StatusResponse, stream crawlerv1.CrawlerService_GetStatusServer) error {
+	results, apiErr := caller.Results(job.JobID)
+	if apiErr != nil {
+		return toStatus(apiErr)
+	}
+	for len(results) > 0 {
+		n := min(len(results), resultsPerMessage)
+		if err := stream.Send(jobStatus(job, results[:n])); err != nil {
+			return err
+		}
+		results = results[n:]
+	}
+	return nil
+}
+
+func (s *service) ListJobs(ctx context.Context, req *crawlerv1.ListJobsRequest) (*crawlerv1.ListJobsResponse, error) {
+	page, apiErr := callerOf(ctx).ListJobs(handlers.JobListing{
+		Statuses:   req.Status,
+		Query:      req.Query,
+		ExternalID: req.ExternalId,
+		CaseID:     req.CaseId,
+		Limit:      int(req.Limit),
+		Cursor:     req.Cursor,
+	})
+	if apiErr != nil {
+		return nil, toStatus(apiErr)
+	}
+	return listJobsResponse(page), nil
+}
+
+func (s *service) CancelJob(ctx context.Context, req *crawlerv1.CancelJobRequest) (*crawlerv1.CancelJobResponse, error) {
+	if req.JobId == "" {
+		return nil, status.Error(codes.InvalidArgument, "job_id is required")
+	}
+	job, apiErr := callerOf(ctx).CancelJob(req.JobId)
+	if apiErr != nil {
+		return nil, toStatus(apiErr)
+	}
+	return &crawlerv1.CancelJobResponse{JobId: job.ID, Status: job.Status}, nil
+}
+
+// callerKey is the context key of a call's handlers.Caller
+type callerKey struct{}
+
+// callerOf returns the caller authenticateUnary or authenticateStream put
+// in ctx
+func callerOf(ctx context.Context) *handlers.Caller {
+	caller, _ := ctx.Value(callerKey{}).(*handlers.Caller)
+	return caller
+}
+
+// public reports whether a method needs no API key: the health checks of
+// load balancers and orchestrators
+func public(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/")
+}
+
+// authenticate authenticates a call by its x-api-key or authorization
+// metadata, returning ctx with the call's caller
+func authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(name string) string {
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	caller, apiErr := handlers.AuthenticateCaller(first("x-api-key"), first("authorization"))
+	if apiErr != nil {
+		return nil, toStatus(apiErr)
+	}
+	return context.WithValue(ctx, callerKey{}, caller), nil
+}
+
+func authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if public(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func authenticateStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if public(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ctx, err := authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream is a server stream carrying its caller in its context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(info.FullMethod, start, err)
+	return resp, err
+}
+
+func logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(info.FullMethod, start, err)
+	return err
+}
+
+// logCall logs a finished call, at warning level when it failed
+// unexpectedly
+func logCall(method string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := log.Fields{
+		"method":      method,
+		"code":        code.String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if code == codes.Internal || code == codes.Unknown {
+		log.WithFields(fields).WithError(err).Warn("gRPC call failed")
+	} else {
+		log.WithFields(fields).Debug("gRPC call")
+	}
+}
+
+// toStatus maps an error of a call to a gRPC status: a refusal by the
+// crawler service to the code matching its REST status
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "call cancelled")
+	}
+	var apiErr *handlers.APIError
+	if !errors.As(err, &apiErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	code := codes.Unknown
+	switch apiErr.Status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+		if apiErr.Details["external_id"] != nil {
+			code = codes.AlreadyExists
+		}
+	case http.StatusTooManyRequests, http.StatusPaymentRequired, http.StatusInsufficientStorage:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	default:
+		if apiErr.Status >= 500 {
+			code = codes.Internal
+		}
+	}
+	return status.Error(code, apiErr.Message)
+}
@@ -0,0 +1,251 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/fixture"
+	"definitelynotaspy/crawler-service/internal/handlers"
+	crawlerv1 "definitelynotaspy/crawler-service/proto/crawler/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// API keys of the tests
+const (
+	writerKey = "gek_test_writer"
+	readerKey = "gek_test_reader"
+	acmeKey   = "gek_test_acme"
+)
+
+// TestMain runs the handlers on the fixture site, with an in-memory job
+// store and the tests' API keys
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "grpcapi")
+	if err != nil {
+		panic(err)
+	}
+	keys := `[
+		{"id": "writer", "key": "` + writerKey + `", "scope": "write"},
+		{"id": "reader", "key": "` + readerKey + `", "scope": "read"},
+		{"id": "acme", "key": "` + acmeKey + `", "scope": "write", "tenant": "acme"}
+	]`
+	keysFile := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(keysFile, []byte(keys), 0o600); err != nil {
+		panic(err)
+	}
+	os.Setenv("GODS_EYE_FIXTURE", "1")
+	os.Setenv("POLICY_DIR", dir)
+	os.Setenv("API_KEYS_FILE", keysFile)
+	os.Setenv("ENCRYPTION_MASTER_KEYS", "")
+
+	handlers.Init(handlers.NewServicesFromEnv())
+	if err := handlers.InitJobStore(); err != nil {
+		panic(err)
+	}
+	if err := handlers.InitAPIKeys(); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// dial serves the API on an in-memory listener and returns a client
+// connection to it
+func dial(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	server := NewServer()
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// withKey returns a context sending key as a bearer token
+func withKey(key string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+key), cancel
+}
+
+func TestCallsNeedAnAPIKey(t *testing.T) {
+	client := crawlerv1.NewCrawlerServiceClient(dial(t))
+
+	_, err := client.ListJobs(context.Background(), &crawlerv1.ListJobsRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListJobs without a key = %v, want Unauthenticated", err)
+	}
+	ctx, cancel := withKey("gek_unknown")
+	defer cancel()
+	_, err = client.ListJobs(ctx, &crawlerv1.ListJobsRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListJobs with an unknown key = %v, want Unauthenticated", err)
+	}
+
+	// Streams are authenticated too
+	stream, err := client.GetStatus(context.Background(), &crawlerv1.GetStatusRequest{JobId: "job"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("GetStatus without a key = %v, want Unauthenticated", err)
+	}
+}
+
+func TestScopesAndTenants(t *testing.T) {
+	client := crawlerv1.NewCrawlerServiceClient(dial(t))
+
+	ctx, cancel := withKey(readerKey)
+	defer cancel()
+	_, err := client.StartCrawl(ctx, &crawlerv1.CrawlRequest{Query: "https://" + fixture.Host + "/"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StartCrawl with a read key = %v, want PermissionDenied", err)
+	}
+	_, err = client.CancelJob(ctx, &crawlerv1.CancelJobRequest{JobId: "job"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("CancelJob with a read key = %v, want PermissionDenied", err)
+	}
+
+	ctx, cancel = withKey(acmeKey)
+	defer cancel()
+	_, err = client.StartCrawl(ctx, &crawlerv1.CrawlRequest{Query: "https://" + fixture.Host + "/", Tenant: "other"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("StartCrawl for another tenant = %v, want PermissionDenied", err)
+	}
+	_, err = client.StartCrawl(ctx, &crawlerv1.CrawlRequest{OptionsJson: "{"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("StartCrawl with invalid options_json = %v, want InvalidArgument", err)
+	}
+	_, err = client.CancelJob(ctx, &crawlerv1.CancelJobRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CancelJob without a job ID = %v, want InvalidArgument", err)
+	}
+	_, err = client.CancelJob(ctx, &crawlerv1.CancelJobRequest{JobId: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("CancelJob of an unknown job = %v, want NotFound", err)
+	}
+}
+
+func TestCrawlAndStreamStatus(t *testing.T) {
+	client := crawlerv1.NewCrawlerServiceClient(dial(t))
+	ctx, cancel := withKey(writerKey)
+	defer cancel()
+
+	job, err := client.StartCrawl(ctx, &crawlerv1.CrawlRequest{
+		Query:      "https://" + fixture.Host + "/",
+		MaxPages:   3,
+		MaxDepth:   1,
+		ExternalId: "grpc-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Id == "" || job.ExternalId != "grpc-test" {
+		t.Fatalf("StartCrawl = %+v", job)
+	}
+
+	stream, err := client.GetStatus(ctx, &crawlerv1.GetStatusRequest{JobId: job.Id, IncludeResults: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last *crawlerv1.JobStatus
+	results := 0
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = msg
+		results += len(msg.Results)
+	}
+	if last == nil || last.Status != "completed" {
+		t.Fatalf("last status = %+v, want completed", last)
+	}
+	if results != int(last.PagesCrawled) || results == 0 {
+		t.Errorf("streamed %d results for %d pages crawled", results, last.PagesCrawled)
+	}
+
+	page, err := client.ListJobs(ctx, &crawlerv1.ListJobsRequest{ExternalId: "grpc-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || len(page.Jobs) != 1 || page.Jobs[0].Id != job.Id {
+		t.Errorf("ListJobs = %+v, want the started job", page)
+	}
+
+	// A key bound to another tenant does not find the job
+	acme, cancel := withKey(acmeKey)
+	defer cancel()
+	stream, err = client.GetStatus(acme, &crawlerv1.GetStatusRequest{JobId: job.Id})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetStatus of another tenant's job = %v, want NotFound", err)
+	}
+	if page, err := client.ListJobs(acme, &crawlerv1.ListJobsRequest{ExternalId: "grpc-test"}); err != nil || len(page.Jobs) != 0 {
+		t.Errorf("ListJobs of another tenant = %+v, %v; want no jobs", page, err)
+	}
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	conn := dial(t)
+
+	// Health checks need no key
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("health check = %v, %v; want SERVING", resp, err)
+	}
+
+	ctx, cancel := withKey(readerKey)
+	defer cancel()
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, service := range reply.GetListServicesResponse().GetService() {
+		found = found || service.Name == "crawler.v1.CrawlerService"
+	}
+	if !found {
+		t.Errorf("reflection lists %v, want crawler.v1.CrawlerService", reply.GetListServicesResponse().GetService())
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Bounds on job annotations
+const (
+	maxNoteLength     = 10000
+	maxAssignees      = 20
+	maxAnnotationName = 128
+)
+
+// annotations reports a job's operational context
+func annotations(job *models.CrawlJob) fiber.Map {
+	return fiber.Map{
+		"job_id":    job.ID,
+		"case_id":   job.CaseID,
+		"assignees": job.Assignees,
+		"notes":     job.Notes,
+		"history":   job.History,
+	}
+}
+
+// normalizeAssignees trims and dedupes assignees, keeping their order
+func normalizeAssignees(raw []string) ([]string, error) {
+	assignees := make([]string, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for _, a := range raw {
+		a = strings.TrimSpace(a)
+		if a == "" || seen[a] {
+			continue
+		}
+		if len(a) > maxAnnotationName {
+			return nil, fmt.Errorf("assignees must be at most %d characters", maxAnnotationName)
+		}
+		seen[a] = true
+		assignees = append(assignees, a)
+	}
+	if len(assignees) > maxAssignees {
+		return nil, fmt.Errorf("a job has at most %d assignees", maxAssignees)
+	}
+	return assignees, nil
+}
+
+func sameAssignees(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetJobAnnotations returns a job's case, assignees, notes and their history
+func GetJobAnnotations(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	return c.JSON(annotations(job))
+}
+
+// AnnotateJob links a job to a case, assigns analysts to it or adds a note
+// after it was created. Every change is kept in the job's history.
+func AnnotateJob(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists || job.DeletedAt != nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	var req models.JobAnnotationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+	if req.CaseID == nil && req.Assignees == nil && req.Note == "" {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Give case_id, assignees or note", nil)
+	}
+
+	var caseID string
+	if req.CaseID != nil {
+		caseID = strings.TrimSpace(*req.CaseID)
+		if len(caseID) > maxAnnotationName {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("case_id must be at most %d characters", maxAnnotationName), nil)
+		}
+	}
+	var assignees []string
+	if req.Assignees != nil {
+		var err error
+		if assignees, err = normalizeAssignees(*req.Assignees); err != nil {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+		}
+	}
+	note := strings.TrimSpace(req.Note)
+	if len(note) > maxNoteLength {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("note must be at most %d characters", maxNoteLength), nil)
+	}
+
+	actor := c.Get("X-Actor", c.IP())
+	now := time.Now().UTC()
+	var changes []models.JobChange
+	if req.CaseID != nil && caseID != job.CaseID {
+		changes = append(changes, models.JobChange{At: now, Actor: actor, Field: "case_id", From: job.CaseID, To: caseID})
+		job.CaseID = caseID
+	}
+	if req.Assignees != nil && !sameAssignees(assignees, job.Assignees) {
+		changes = append(changes, models.JobChange{At: now, Actor: actor, Field: "assignees", From: job.Assignees, To: assignees})
+		job.Assignees = assignees
+	}
+	if note != "" {
+		changes = append(changes, models.JobChange{At: now, Actor: actor, Field: "notes", To: note})
+		job.Notes = append(job.Notes, models.JobNote{At: now, Author: actor, Text: note})
+	}
+	if len(changes) == 0 {
+		return c.JSON(annotations(job))
+	}
+	job.History = append(job.History, changes...)
+	saveJob(job)
+
+	fields := make([]string, len(changes))
+	for i, change := range changes {
+		fields[i] = change.Field
+	}
+	crawlerService.Audit().Append(audit.Record{
+		Action: "job.annotate",
+		Tenant: job.Tenant,
+		JobID:  job.ID,
+		Actor:  actor,
+		Details: map[string]interface{}{
+			"fields":  fields,
+			"case_id": job.CaseID,
+		},
+	})
+
+	return c.JSON(annotations(job))
+}
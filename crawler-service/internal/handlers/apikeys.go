@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/apikey"
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// apiKeyLocal holds the authenticated key in a request's locals
+const apiKeyLocal = "api_key"
+
+var apiKeys = apikey.NewStore()
+
+// InitAPIKeys loads the API keys configured in the environment. It must
+// run before the API serves requests.
+func InitAPIKeys() error {
+	s, err := apikey.NewStoreFromEnv()
+	if err != nil {
+		return err
+	}
+	apiKeys = s
+	log.WithField("required", s.Required()).Info("API keys loaded")
+	return nil
+}
+
+// Authenticate requires a valid API key, in "Authorization: Bearer" or
+// X-API-Key, once keys are configured. Requests past a key's per-minute
+// allowance are refused with 429. The scope each route needs is declared
+// on the route, with ReadAccess, WriteAccess or AdminAccess.
+func Authenticate(c *fiber.Ctx) error {
+	if !apiKeys.Required() {
+		return c.Next()
+	}
+
+	key, retryAfter, err := authenticateSecret(apiKeySecret(c.Get("X-API-Key"), c.Get(fiber.HeaderAuthorization)))
+	if err != nil {
+		if retryAfter > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		return respondAPIError(c, err)
+	}
+
+	c.Locals(apiKeyLocal, key)
+	return c.Next()
+}
+
+// apiKeySecret returns the key sent in X-API-Key, else as a bearer token
+func apiKeySecret(apiKey, authorization string) string {
+	if apiKey == "" && len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return apiKey
+}
+
+// authenticateSecret returns the key of a secret once keys are required,
+// refusing a missing or unknown secret and, with how long to wait, a key
+// past its per-minute allowance
+func authenticateSecret(secret string) (*apikey.Key, time.Duration, *APIError) {
+	if !apiKeys.Required() {
+		return nil, 0, nil
+	}
+	if secret == "" {
+		return nil, 0, refuse(fiber.StatusUnauthorized, errcode.Unauthorized, "An API key is required", nil)
+	}
+	key, err := apiKeys.Authenticate(secret)
+	if err != nil {
+		log.WithError(err).Error("Failed to authenticate API key")
+		return nil, 0, refuse(fiber.StatusServiceUnavailable, errcode.Unavailable, "API keys are currently unavailable", nil)
+	}
+	if key == nil {
+		return nil, 0, refuse(fiber.StatusUnauthorized, errcode.Unauthorized, "Invalid API key", nil)
+	}
+
+	if ok, retryAfter := apiKeys.Allow(key); !ok {
+		return nil, retryAfter, refuse(fiber.StatusTooManyRequests, errcode.RateLimited, "API key request rate exceeded", fiber.Map{
+			"requests_per_minute": key.RequestsPerMinute,
+		})
+	}
+	return key, 0, nil
+}
+
+// ReadAccess declares a route any API key may use
+func ReadAccess(c *fiber.Ctx) error {
+	return requireScope(c, apikey.ScopeRead)
+}
+
+// WriteAccess declares a route needing a write or admin key
+func WriteAccess(c *fiber.Ctx) error {
+	return requireScope(c, apikey.ScopeWrite)
+}
+
+// AdminAccess declares a route of the admin API. Admin routes act across
+// tenants, so keys bound to a tenant may not use them whatever their scope.
+func AdminAccess(c *fiber.Ctx) error {
+	return requireScope(c, apikey.ScopeAdmin)
+}
+
+// requireScope refuses requests whose API key's scope does not include
+// scope
+func requireScope(c *fiber.Ctx, scope string) error {
+	if err := scopeError(requestKey(c), scope); err != nil {
+		return respondAPIError(c, err)
+	}
+	return c.Next()
+}
+
+// scopeError refuses calls made with a key, nil when keys are not
+// required, whose scope does not include scope
+func scopeError(key *apikey.Key, scope string) *APIError {
+	if key == nil {
+		return nil
+	}
+	if !key.Allows(scope) {
+		return refuse(fiber.StatusForbidden, errcode.Forbidden, "API key scope does not allow this request", fiber.Map{
+			"scope":    key.Scope,
+			"required": scope,
+		})
+	}
+	if scope == apikey.ScopeAdmin && key.Tenant != "" {
+		return refuse(fiber.StatusForbidden, errcode.Forbidden, "API keys bound to a tenant may not use the admin API", fiber.Map{
+			"tenant": key.Tenant,
+		})
+	}
+	return nil
+}
+
+// boundTenant returns the tenant the request's API key is bound to, empty
+// when it is not bound or keys are not required
+func boundTenant(c *fiber.Ctx) string {
+	if key := requestKey(c); key != nil {
+		return key.Tenant
+	}
+	return ""
+}
+
+// tenantAllowed reports whether the request may act for tenant: every
+// request may, except those with a key bound to another tenant
+func tenantAllowed(c *fiber.Ctx, tenant string) bool {
+	return keyAllowsTenant(requestKey(c), tenant)
+}
+
+// keyAllowsTenant reports whether a call made with key, nil when keys are
+// not required, may act for tenant
+func keyAllowsTenant(key *apikey.Key, tenant string) bool {
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+	return key == nil || key.Tenant == "" || key.Tenant == tenant
+}
+
+// authorizeTenant refuses requests for a tenant their API key is not bound
+// to. When the request is refused it responds and returns false.
+func authorizeTenant(c *fiber.Ctx, tenant string) (bool, error) {
+	if tenantAllowed(c, tenant) {
+		return true, nil
+	}
+	return false, respondError(c, fiber.StatusForbidden, errcode.Forbidden, "API key may not act for this tenant", fiber.Map{
+		"tenant": tenant,
+	})
+}
+
+// findJob returns a job the request may see. Jobs of other tenants are not
+// found by keys bound to a tenant, so their IDs give nothing away.
+func findJob(c *fiber.Ctx, id string) (*models.CrawlJob, bool) {
+	return keyJob(requestKey(c), id)
+}
+
+// keyJob returns a job a call made with key may see, as findJob does
+func keyJob(key *apikey.Key, id string) (*models.CrawlJob, bool) {
+	job, exists := jobs.Get(id)
+	if !exists || !keyAllowsTenant(key, job.Tenant) {
+		return nil, false
+	}
+	return job, true
+}
+
+// requestKey returns the key a request authenticated with, nil when keys
+// are not required
+func requestKey(c *fiber.Ctx) *apikey.Key {
+	key, _ := c.Locals(apiKeyLocal).(*apikey.Key)
+	return key
+}
+
+// bindAPIKey ties a job request to the key it was made with, nil when keys
+// are not required: a key bound to a tenant starts jobs for that tenant
+// only, and none once its job quotas are used up
+func bindAPIKey(key *apikey.Key, req *models.CrawlRequest) *APIError {
+	req.APIKeyID = ""
+	if key == nil {
+		return nil
+	}
+
+	if key.Tenant != "" {
+		if req.Tenant != "" && req.Tenant != key.Tenant {
+			return refuse(fiber.StatusForbidden, errcode.Forbidden, "API key may not start jobs for this tenant", fiber.Map{
+				"tenant": req.Tenant,
+			})
+		}
+		req.Tenant = key.Tenant
+	}
+
+	running, pagesToday, err := apiKeyUsage(key.ID)
+	if err != nil {
+		return jobsUnavailable(err)
+	}
+	if key.MaxConcurrentJobs > 0 && running >= key.MaxConcurrentJobs {
+		return refuse(fiber.StatusTooManyRequests, errcode.QuotaExceeded, "API key concurrent job limit reached", fiber.Map{
+			"running":             running,
+			"max_concurrent_jobs": key.MaxConcurrentJobs,
+		})
+	}
+	if key.MaxPagesPerDay > 0 && pagesToday >= key.MaxPagesPerDay {
+		return refuse(fiber.StatusTooManyRequests, errcode.QuotaExceeded, "API key daily page limit reached", fiber.Map{
+			"pages_today":       pagesToday,
+			"max_pages_per_day": key.MaxPagesPerDay,
+		})
+	}
+
+	req.APIKeyID = key.ID
+	return nil
+}
+
+// apiKeyUsage counts a key's pending and running jobs and the pages its
+// jobs started today (UTC) have crawled, reading only the key's unfinished
+// jobs and those started today
+func apiKeyUsage(id string) (running, pagesToday int, err error) {
+	unfinished, err := jobs.Find(store.JobFilter{APIKey: id, Unfinished: true})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, job := range unfinished {
+		if job.Status == "pending" || job.Status == "running" {
+			running++
+		}
+	}
+
+	today, err := jobs.Find(store.JobFilter{APIKey: id, Since: time.Now().UTC().Truncate(24 * time.Hour)})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, job := range today {
+		pagesToday += job.PagesCrawled
+	}
+	return running, pagesToday, nil
+}
+
+// apiKeyRequest creates an API key
+type apiKeyRequest struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Scope             string `json:"scope"`
+	Tenant            string `json:"tenant"`
+	Role              string `json:"role"`
+	RequestsPerMinute int    `json:"requests_per_minute"`
+	MaxConcurrentJobs int    `json:"max_concurrent_jobs"`
+	MaxPagesPerDay    int    `json:"max_pages_per_day"`
+}
+
+// ListAPIKeys lists the API keys, without their secrets
+func ListAPIKeys(c *fiber.Ctx) error {
+	keys, err := apiKeys.List()
+	if err != nil {
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "API keys are currently unavailable", nil)
+	}
+	return c.JSON(fiber.Map{
+		"keys":     keys,
+		"total":    len(keys),
+		"required": apiKeys.Required(),
+	})
+}
+
+// CreateAPIKey creates an API key. The key is returned once, in the
+// response, and cannot be retrieved again.
+func CreateAPIKey(c *fiber.Ctx) error {
+	var req apiKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	key, secret, err := apiKeys.Create(apikey.Key{
+		ID:                req.ID,
+		Name:              req.Name,
+		Scope:             req.Scope,
+		Tenant:            req.Tenant,
+		Role:              req.Role,
+		RequestsPerMinute: req.RequestsPerMinute,
+		MaxConcurrentJobs: req.MaxConcurrentJobs,
+		MaxPagesPerDay:    req.MaxPagesPerDay,
+	})
+	if errors.Is(err, apikey.ErrUnavailable) {
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "API keys are currently unavailable", nil)
+	}
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "auth.api_key",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Tenant: key.Tenant,
+		Details: map[string]interface{}{
+			"id":    key.ID,
+			"scope": key.Scope,
+			"role":  key.Role,
+		},
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"key":     secret,
+		"api_key": key,
+	})
+}
+
+// DeleteAPIKey revokes an API key created through the API
+func DeleteAPIKey(c *fiber.Ctx) error {
+	id := c.Params("id")
+	deleted, err := apiKeys.Delete(id)
+	if err != nil {
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "API keys are currently unavailable", nil)
+	}
+	if !deleted {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "API key not found, or defined in API_KEYS_FILE", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action:  "auth.api_key_delete",
+		Actor:   c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{"id": id},
+	})
+
+	return c.JSON(models.DeletedResponse{ID: id, Deleted: true, Message: "API key revoked"})
+}
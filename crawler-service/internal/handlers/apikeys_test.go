@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/apikey"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// keyedApp serves routes under test behind API-key authentication, with
+// the keys of a fresh store and one job of tenants acme and other. It
+// returns the app and the secrets by key ID.
+func keyedApp(t *testing.T, keys ...apikey.Key) (*fiber.App, map[string]string) {
+	t.Helper()
+	app := contractApp(t)
+
+	t.Setenv("API_KEYS", "")
+	t.Setenv("API_AUTH_REQUIRED", "true")
+	s, err := apikey.NewStoreFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := apiKeys
+	apiKeys = s
+	t.Cleanup(func() { apiKeys = previous })
+
+	secrets := make(map[string]string)
+	for _, key := range keys {
+		_, secret, err := s.Create(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[key.ID] = secret
+	}
+
+	for _, tenant := range []string{"acme", "other"} {
+		jobs.Put(&models.CrawlJob{
+			ID:          tenant + "-job",
+			Tenant:      tenant,
+			Status:      "completed",
+			StartedAt:   time.Now().UTC(),
+			CompletedAt: time.Now().UTC(),
+		})
+	}
+
+	api := app.Group("/keyed", Authenticate)
+	api.Get("/status/:id", ReadAccess, GetCrawlStatus)
+	api.Get("/jobs/:id/results", ReadAccess, GetJobResults)
+	api.Post("/jobs/:id/cancel", WriteAccess, CancelJob)
+	api.Get("/tenants/:id/usage", ReadAccess, GetTenantUsage)
+	api.Put("/tenants/:id/scripts/:name", WriteAccess, PutScript)
+	api.Get("/admin/maintenance", AdminAccess, GetMaintenance)
+	return app, secrets
+}
+
+// callWithKey makes a request with an API key, returning the status
+func callWithKey(t *testing.T, app *fiber.App, method, path, secret string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(`{"source": "def extract(page):\n    return {}\n"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-API-Key", secret)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAPIKeysRequired(t *testing.T) {
+	app, secrets := keyedApp(t, apikey.Key{ID: "reader", Scope: apikey.ScopeRead})
+
+	if status := callWithKey(t, app, http.MethodGet, "/keyed/status/acme-job", ""); status != fiber.StatusUnauthorized {
+		t.Errorf("request without a key = %d, want 401", status)
+	}
+	if status := callWithKey(t, app, http.MethodGet, "/keyed/status/acme-job", "gek_unknown"); status != fiber.StatusUnauthorized {
+		t.Errorf("request with an unknown key = %d, want 401", status)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/keyed/status/acme-job", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+secrets["reader"])
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("request with a bearer key = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	app, secrets := keyedApp(t,
+		apikey.Key{ID: "reader", Scope: apikey.ScopeRead},
+		apikey.Key{ID: "writer", Scope: apikey.ScopeWrite},
+		apikey.Key{ID: "admin", Scope: apikey.ScopeAdmin},
+		apikey.Key{ID: "tenant-admin", Scope: apikey.ScopeAdmin, Tenant: "acme"},
+	)
+
+	tests := []struct {
+		key, method, path string
+		want              int
+	}{
+		{"reader", http.MethodGet, "/keyed/jobs/acme-job/results", fiber.StatusOK},
+		{"reader", http.MethodPost, "/keyed/jobs/acme-job/cancel", fiber.StatusForbidden},
+		{"reader", http.MethodPut, "/keyed/tenants/acme/scripts/extract", fiber.StatusForbidden},
+		{"writer", http.MethodPut, "/keyed/tenants/acme/scripts/extract", fiber.StatusOK},
+		{"writer", http.MethodGet, "/keyed/admin/maintenance", fiber.StatusForbidden},
+		{"admin", http.MethodGet, "/keyed/admin/maintenance", fiber.StatusOK},
+		// Admin routes act across tenants, so bound keys may not use them
+		{"tenant-admin", http.MethodGet, "/keyed/admin/maintenance", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if status := callWithKey(t, app, tt.method, tt.path, secrets[tt.key]); status != tt.want {
+			t.Errorf("%s %s with %s = %d, want %d", tt.method, tt.path, tt.key, status, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyTenantIsolation(t *testing.T) {
+	app, secrets := keyedApp(t,
+		apikey.Key{ID: "acme", Scope: apikey.ScopeWrite, Tenant: "acme"},
+		apikey.Key{ID: "unbound", Scope: apikey.ScopeWrite},
+	)
+
+	tests := []struct {
+		key, method, path string
+		want              int
+	}{
+		{"acme", http.MethodGet, "/keyed/status/acme-job", fiber.StatusOK},
+		{"acme", http.MethodGet, "/keyed/jobs/acme-job/results", fiber.StatusOK},
+		{"acme", http.MethodGet, "/keyed/tenants/acme/usage", fiber.StatusOK},
+		// Other tenants' jobs are not found, so their IDs give nothing away
+		{"acme", http.MethodGet, "/keyed/status/other-job", fiber.StatusNotFound},
+		{"acme", http.MethodGet, "/keyed/jobs/other-job/results", fiber.StatusNotFound},
+		{"acme", http.MethodPost, "/keyed/jobs/other-job/cancel", fiber.StatusNotFound},
+		{"acme", http.MethodGet, "/keyed/tenants/other/usage", fiber.StatusForbidden},
+		{"acme", http.MethodPut, "/keyed/tenants/other/scripts/extract", fiber.StatusForbidden},
+		{"unbound", http.MethodGet, "/keyed/status/other-job", fiber.StatusOK},
+		{"unbound", http.MethodGet, "/keyed/tenants/other/usage", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		if status := callWithKey(t, app, tt.method, tt.path, secrets[tt.key]); status != tt.want {
+			t.Errorf("%s %s with %s = %d, want %d", tt.method, tt.path, tt.key, status, tt.want)
+		}
+	}
+}
+
+func TestBindAPIKey(t *testing.T) {
+	contractApp(t)
+	key := &apikey.Key{ID: "acme", Scope: apikey.ScopeWrite, Tenant: "acme", MaxConcurrentJobs: 1}
+
+	req := models.CrawlRequest{}
+	if err := bindAPIKey(key, &req); err != nil || req.Tenant != "acme" || req.APIKeyID != "acme" {
+		t.Fatalf("bindAPIKey = %v, request tenant %q key %q", err, req.Tenant, req.APIKeyID)
+	}
+
+	req = models.CrawlRequest{Tenant: "other"}
+	if err := bindAPIKey(key, &req); err == nil || err.Status != fiber.StatusForbidden {
+		t.Errorf("job for another tenant = %v, want 403", err)
+	}
+
+	jobs.Put(&models.CrawlJob{ID: "running", Tenant: "acme", APIKey: "acme", Status: "running", StartedAt: time.Now().UTC()})
+	req = models.CrawlRequest{}
+	if err := bindAPIKey(key, &req); err == nil || err.Status != fiber.StatusTooManyRequests {
+		t.Errorf("job past the concurrent limit = %v, want 429", err)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/archive"
+	"definitelynotaspy/crawler-service/internal/models"
+	"fmt"
+)
+
+// maxReplayChain bounds how far ownsArtifact follows replays back to the
+// job that archived a page
+const maxReplayChain = 16
+
+// ownsArtifact reports whether the archive entry ref belongs to job:
+// archived by the job itself or, since a replay keeps the references of the
+// pages it re-extracted, by a job of the same tenant it replayed
+func ownsArtifact(job *models.CrawlJob, ref string) bool {
+	owner := archive.RefJob(ref)
+	for i := 0; i < maxReplayChain; i++ {
+		if job.ID == owner {
+			return true
+		}
+		if job.ReplayOf == "" {
+			return false
+		}
+		parent, exists := jobs.Get(job.ReplayOf)
+		if !exists || parent.Tenant != job.Tenant {
+			return false
+		}
+		job = parent
+	}
+	return false
+}
+
+// loadArtifact returns the gzipped archive entry ref of one of job's
+// results, refusing references to other jobs' entries
+func loadArtifact(job *models.CrawlJob, ref string) ([]byte, error) {
+	if !ownsArtifact(job, ref) {
+		return nil, fmt.Errorf("archive reference %q does not belong to job %s", ref, job.ID)
+	}
+	return crawlerService.Archive().LoadCompressed(ref)
+}
+
+// loadScreenshot returns the archived screenshot ref of one of job's
+// results, refusing references to other jobs' screenshots
+func loadScreenshot(job *models.CrawlJob, ref string) ([]byte, error) {
+	if !ownsArtifact(job, ref) {
+		return nil, fmt.Errorf("archive reference %q does not belong to job %s", ref, job.ID)
+	}
+	return crawlerService.Archive().LoadScreenshot(ref)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/budget"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/events"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// budgetRequest sets a tenant's monthly caps; zero is no cap
+type budgetRequest struct {
+	Pages         int     `json:"pages"`
+	RenderMinutes float64 `json:"render_minutes"`
+	SearchCalls   int     `json:"search_calls"`
+}
+
+// budgetOverrideRequest names the month whose caps an override lifts
+type budgetOverrideRequest struct {
+	Month string `json:"month"`
+}
+
+// budgetExceeded returns the caps a tenant has reached this month, unless
+// they are overridden
+func budgetExceeded(tenant string) ([]string, error) {
+	caps := crawlerService.Budgets().Get(tenant)
+	if caps == nil {
+		return nil, nil
+	}
+	month := currentMonth()
+	if caps.Overridden(month.Format("2006-01")) {
+		return nil, nil
+	}
+	_, total, err := tenantMonthUsage(tenant, month)
+	if err != nil {
+		return nil, err
+	}
+	return caps.Exceeded(total), nil
+}
+
+// BudgetAlerts raises a BudgetThreshold event, sent to the alert channels,
+// the first time a finished job takes its tenant's monthly use of a capped
+// metric past an alert threshold
+func BudgetAlerts(e events.Event) {
+	if e.Type != events.JobFinished || e.Tenant == "" {
+		return
+	}
+
+	// Publishing from within a handler would hold up the bus
+	go func() {
+		caps := crawlerService.Budgets().Get(e.Tenant)
+		if caps == nil {
+			return
+		}
+		month := currentMonth()
+		period := month.Format("2006-01")
+		_, total, err := tenantMonthUsage(e.Tenant, month)
+		if err != nil {
+			log.WithError(err).WithField("tenant", e.Tenant).Warn("Failed to check tenant budget thresholds")
+			return
+		}
+
+		for _, status := range caps.Check(total) {
+			for _, threshold := range crawlerService.Budgets().Crossed(e.Tenant, period, status) {
+				log.WithFields(log.Fields{
+					"tenant":    e.Tenant,
+					"metric":    status.Metric,
+					"used":      status.Used,
+					"cap":       status.Cap,
+					"threshold": threshold,
+				}).Warn("Tenant budget threshold crossed")
+
+				crawlerService.Events().Publish(events.Event{
+					Type:   events.BudgetThreshold,
+					JobID:  e.JobID,
+					Tenant: e.Tenant,
+					Data: map[string]interface{}{
+						"month":      period,
+						"metric":     status.Metric,
+						"used":       status.Used,
+						"cap":        status.Cap,
+						"percent":    status.Percent,
+						"threshold":  threshold,
+						"overridden": caps.Overridden(period),
+					},
+				})
+			}
+		}
+	}()
+}
+
+// GetTenantBudget returns a tenant's monthly caps and its use of them this
+// month
+func GetTenantBudget(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	caps := crawlerService.Budgets().Get(tenant)
+	if caps == nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Tenant has no budget caps", nil)
+	}
+
+	month := currentMonth()
+	period := month.Format("2006-01")
+	_, total, err := tenantMonthUsage(tenant, month)
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+	exceeded := caps.Exceeded(total)
+
+	return c.JSON(fiber.Map{
+		"caps":       caps,
+		"month":      period,
+		"usage":      caps.Check(total),
+		"exceeded":   exceeded,
+		"overridden": caps.Overridden(period),
+		"blocked":    len(exceeded) > 0 && !caps.Overridden(period),
+	})
+}
+
+// PutTenantBudget sets a tenant's monthly caps, keeping a current override
+func PutTenantBudget(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+
+	var req budgetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+	caps := budget.Caps{
+		Tenant:        tenant,
+		Pages:         req.Pages,
+		RenderMinutes: req.RenderMinutes,
+		SearchCalls:   req.SearchCalls,
+		UpdatedAt:     time.Now().UTC(),
+	}
+	if err := caps.Validate(); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	if previous := crawlerService.Budgets().Get(tenant); previous != nil {
+		caps.OverrideMonth = previous.OverrideMonth
+	}
+
+	if err := crawlerService.Budgets().Put(caps); err != nil {
+		log.WithError(err).WithField("tenant", tenant).Error("Failed to persist budget caps")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to save budget caps", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Tenant: tenant,
+		Action: "budget.caps",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"pages":          caps.Pages,
+			"render_minutes": caps.RenderMinutes,
+			"search_calls":   caps.SearchCalls,
+		},
+	})
+
+	return c.JSON(caps)
+}
+
+// DeleteTenantBudget removes a tenant's caps
+func DeleteTenantBudget(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if !crawlerService.Budgets().Delete(tenant) {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Tenant has no budget caps", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Tenant: tenant,
+		Action: "budget.caps_delete",
+		Actor:  c.Get("X-Actor", c.IP()),
+	})
+
+	return c.JSON(fiber.Map{
+		"tenant":  tenant,
+		"message": "Budget caps removed",
+	})
+}
+
+// OverrideTenantBudget lets a tenant start jobs past its caps until the
+// end of a month, the current one unless the body names another
+// (YYYY-MM). Alerts are still raised.
+func OverrideTenantBudget(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	caps := crawlerService.Budgets().Get(tenant)
+	if caps == nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Tenant has no budget caps", nil)
+	}
+
+	var req budgetOverrideRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+		}
+	}
+	month := currentMonth().Format("2006-01")
+	if req.Month != "" {
+		parsed, err := time.Parse("2006-01", req.Month)
+		if err != nil || parsed.Before(currentMonth()) {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "month must be the current or a later month, formatted YYYY-MM", fiber.Map{
+				"month": req.Month,
+			})
+		}
+		month = req.Month
+	}
+
+	caps.OverrideMonth = month
+	caps.UpdatedAt = time.Now().UTC()
+	if err := crawlerService.Budgets().Put(*caps); err != nil {
+		log.WithError(err).WithField("tenant", tenant).Error("Failed to persist budget override")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to save budget override", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Tenant:  tenant,
+		Action:  "budget.override",
+		Actor:   c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{"month": month},
+	})
+
+	return c.JSON(caps)
+}
+
+// ClearTenantBudgetOverride enforces a tenant's caps again
+func ClearTenantBudgetOverride(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	caps := crawlerService.Budgets().Get(tenant)
+	if caps == nil || caps.OverrideMonth == "" {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Tenant has no budget override", nil)
+	}
+
+	caps.OverrideMonth = ""
+	caps.UpdatedAt = time.Now().UTC()
+	if err := crawlerService.Budgets().Put(*caps); err != nil {
+		log.WithError(err).WithField("tenant", tenant).Error("Failed to persist budget override")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to save budget override", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Tenant: tenant,
+		Action: "budget.override_delete",
+		Actor:  c.Get("X-Actor", c.IP()),
+	})
+
+	return c.JSON(caps)
+}
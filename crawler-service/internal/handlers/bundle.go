@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"definitelynotaspy/crawler-service/internal/archive"
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/bundle"
+	"definitelynotaspy/crawler-service/internal/confidence"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportJobBundle streams a tar.zst bundle of a job for offline transfer
+func ExportJobBundle(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	if job.Status == "pending" || job.Status == "running" {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Job is still in progress", nil)
+	}
+
+	minConf, err := minConfidence(c)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load results for bundle")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	results = confidence.Filter(roleMask(c).Apply(results), minConf)
+
+	// Include archived raw HTML and screenshots so the bundle can be
+	// replayed offline
+	artifacts := make(map[string][]byte)
+	for _, result := range results {
+		if result.HTMLRef != "" {
+			data, err := loadArtifact(job, result.HTMLRef)
+			if err != nil {
+				log.WithError(err).WithField("ref", result.HTMLRef).Warn("Archived HTML missing from bundle")
+			} else {
+				artifacts["html/"+result.HTMLRef] = data
+			}
+		}
+		if result.ScreenshotRef != "" {
+			png, err := loadScreenshot(job, result.ScreenshotRef)
+			if err != nil {
+				log.WithError(err).WithField("ref", result.ScreenshotRef).Warn("Archived screenshot missing from bundle")
+			} else {
+				artifacts["screenshots/"+result.ScreenshotRef] = png
+			}
+		}
+	}
+
+	b := &bundle.Bundle{Job: *job, Results: results, Artifacts: artifacts}
+	c.Set(fiber.HeaderContentType, "application/zstd")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"job-%s.tar.zst\"", job.ID))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The bundle is compressed as it is sent; a failure midway leaves
+		// the client a truncated bundle, which fails to import
+		err := bundle.Write(w, b)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Bundle stream interrupted")
+		}
+	})
+	return nil
+}
+
+// ImportJobBundle loads a job bundle exported by another instance. The job
+// gets a fresh ID and its archived pages and screenshots are stored under
+// it, so nothing in the bundle can name or overwrite another job's data.
+func ImportJobBundle(c *fiber.Ctx) error {
+	b, err := bundle.Read(bytes.NewReader(c.Body()))
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	if b.Job.ID == "" {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Bundle job has no ID", nil)
+	}
+
+	job := b.Job
+	job.ID = uuid.New().String()
+	// Offloaded results live in the exporting instance's bucket, and quotas
+	// count against the key importing the job
+	job.ResultsRef = ""
+	job.APIKey = ""
+	if key := requestKey(c); key != nil {
+		job.APIKey = key.ID
+	}
+
+	if job.Tenant == "" {
+		job.Tenant = boundTenant(c)
+	}
+	if job.Tenant == "" {
+		job.Tenant = defaultTenant
+	}
+	if ok, err := authorizeTenant(c, job.Tenant); !ok {
+		return err
+	}
+
+	// refs maps the bundle's archive references to the new job's
+	refs := make(map[string]string, len(b.Artifacts))
+	for name := range b.Artifacts {
+		_, ref, _ := strings.Cut(name, "/")
+		rebased, err := archive.Rebase(ref, job.ID)
+		if err != nil {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("Invalid bundle artifact %q", name), nil)
+		}
+		refs[name] = rebased
+	}
+
+	stored := make(map[string]string, len(refs))
+	for name, data := range b.Artifacts {
+		kind, ref, _ := strings.Cut(name, "/")
+		var err error
+		switch kind {
+		case "html":
+			err = crawlerService.Archive().StoreCompressed(job.Tenant, refs[name], data)
+		case "screenshots":
+			err = crawlerService.Archive().StoreScreenshotRef(job.Tenant, refs[name], data)
+		default:
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithField("ref", ref).Warn("Failed to import archived " + kind)
+			continue
+		}
+		stored[name] = refs[name]
+	}
+
+	// Results keep only references to entries the bundle carried
+	for i := range b.Results {
+		b.Results[i].HTMLRef = stored["html/"+b.Results[i].HTMLRef]
+		b.Results[i].ScreenshotRef = stored["screenshots/"+b.Results[i].ScreenshotRef]
+	}
+	job.Results = b.Results
+	saveJob(&job)
+
+	log.WithFields(log.Fields{
+		"job_id":    job.ID,
+		"source_id": b.Job.ID,
+		"results":   len(job.Results),
+	}).Info("Job bundle imported")
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":       "Job imported successfully",
+		"job_id":        job.ID,
+		"source_job_id": b.Job.ID,
+		"results":       len(job.Results),
+		"artifacts":     len(stored),
+	})
+}
+
+// ImportJobs loads jobs exported by a legacy JSON store or another
+// instance: a JSON array of jobs or NDJSON, one job per line, each carrying
+// its results. Jobs already held are skipped unless overwrite=true.
+func ImportJobs(c *fiber.Ctx) error {
+	overwrite := c.QueryBool("overwrite")
+
+	var report store.MigrateReport
+	importJob := func(job *models.CrawlJob) {
+		if job.Tenant == "" {
+			job.Tenant = defaultTenant
+		}
+		report.Record(job, store.Import(jobs, job, overwrite))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	if body := bytes.TrimSpace(c.Body()); len(body) > 0 && body[0] == '[' {
+		var list []*models.CrawlJob
+		if err := dec.Decode(&list); err != nil {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid job list: "+err.Error(), nil)
+		}
+		for _, job := range list {
+			importJob(job)
+		}
+	} else {
+		for line := 1; ; line++ {
+			var job models.CrawlJob
+			err := dec.Decode(&job)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("Invalid job %d: %v", line, err), fiber.Map{
+					"report": report,
+				})
+			}
+			importJob(&job)
+		}
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "jobs.import",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"imported":  report.Imported,
+			"skipped":   report.Skipped,
+			"failed":    report.Failed,
+			"overwrite": overwrite,
+		},
+	})
+
+	log.WithFields(log.Fields{
+		"imported": report.Imported,
+		"skipped":  report.Skipped,
+		"failed":   report.Failed,
+	}).Info("Jobs imported")
+
+	return c.JSON(report)
+}
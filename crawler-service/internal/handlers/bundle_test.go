@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/archive"
+	"definitelynotaspy/crawler-service/internal/bundle"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// bundleApp serves bundle export and import over an empty job store and
+// an archive in a temporary directory
+func bundleApp(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("ENCRYPTION_MASTER_KEYS", "")
+	t.Setenv("ARCHIVE_STORE", "disk")
+	t.Setenv("ARCHIVE_DIR", t.TempDir())
+	Init(NewServicesFromEnv())
+	jobs = store.NewMemory()
+
+	app := fiber.New()
+	app.Get("/jobs/:id/bundle", ExportJobBundle)
+	app.Post("/jobs/import", ImportJobBundle)
+	return app
+}
+
+// gzipped compresses an archive entry as the archive stores it
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(data))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportJobBundleRebasesForgedRefs(t *testing.T) {
+	app := bundleApp(t)
+
+	// Another tenant's job with an archived page
+	victimRef, _, err := crawlerService.Archive().Store("victim", "victim-job", "https://example.com/", []byte("<p>secret</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs.Put(&models.CrawlJob{ID: "victim-job", Tenant: "victim", Status: "completed"})
+
+	// A bundle reusing the victim's job ID and archive reference, and
+	// pointing a second result at the victim's page without carrying it
+	forged := archive.Ref("victim-job", "https://example.com/other")
+	var buf bytes.Buffer
+	err = bundle.Write(&buf, &bundle.Bundle{
+		Job: models.CrawlJob{ID: "victim-job", Tenant: defaultTenant, Status: "completed", ResultsRef: "s3://bucket/results/victim/victim-job.json"},
+		Results: []models.CrawlResult{
+			{URL: "https://example.com/other", HTMLRef: forged},
+			{URL: "https://example.com/", HTMLRef: victimRef},
+		},
+		Artifacts: map[string][]byte{"html/" + forged: gzipped(t, "<p>overwritten</p>")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs/import", &buf)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("import status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	var imported struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&imported); err != nil {
+		t.Fatal(err)
+	}
+	if imported.JobID == "" || imported.JobID == "victim-job" {
+		t.Fatalf("imported job ID = %q, want a fresh ID", imported.JobID)
+	}
+
+	job, exists := jobs.Get(imported.JobID)
+	if !exists {
+		t.Fatal("imported job not stored")
+	}
+	if job.ResultsRef != "" {
+		t.Errorf("results reference %q kept", job.ResultsRef)
+	}
+	if ref := job.Results[0].HTMLRef; !strings.HasPrefix(ref, imported.JobID+"/") {
+		t.Errorf("carried page stored under %q, want the imported job's prefix", ref)
+	}
+	if ref := job.Results[1].HTMLRef; ref != "" {
+		t.Errorf("reference %q to a page the bundle did not carry kept", ref)
+	}
+
+	victim, _ := jobs.Get("victim-job")
+	if victim.Tenant != "victim" {
+		t.Errorf("victim job overwritten: %+v", victim)
+	}
+	if _, err := crawlerService.Archive().Load(forged); err == nil {
+		t.Error("bundle wrote into the victim job's archive")
+	}
+	if html, err := crawlerService.Archive().Load(victimRef); err != nil || !strings.Contains(string(html), "secret") {
+		t.Errorf("victim page = %q, %v", html, err)
+	}
+}
+
+func TestImportJobBundleRefusesInvalidArtifacts(t *testing.T) {
+	app := bundleApp(t)
+
+	for _, name := range []string{"html/job/page.txt", "html/job/../../x.html.gz", "screenshots/job/shot.png", "html/page.html.gz"} {
+		var buf bytes.Buffer
+		err := bundle.Write(&buf, &bundle.Bundle{
+			Job:       models.CrawlJob{ID: "job-1", Status: "completed"},
+			Artifacts: map[string][]byte{name: gzipped(t, "<p>page</p>")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/jobs/import", &buf)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("artifact %q: status = %d, want %d", name, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestExportJobBundleSkipsOtherJobsArtifacts(t *testing.T) {
+	app := bundleApp(t)
+
+	victimRef, _, err := crawlerService.Archive().Store("victim", "victim-job", "https://example.com/", []byte("<p>secret</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownRef, _, err := crawlerService.Archive().Store(defaultTenant, "own-job", "https://example.org/", []byte("<p>own</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs.Put(&models.CrawlJob{ID: "victim-job", Tenant: "victim", Status: "completed"})
+	jobs.Put(&models.CrawlJob{
+		ID:          "own-job",
+		Tenant:      defaultTenant,
+		Status:      "completed",
+		CompletedAt: time.Now().UTC(),
+		Results: []models.CrawlResult{
+			{URL: "https://example.org/", HTMLRef: ownRef},
+			{URL: "https://example.com/", HTMLRef: victimRef},
+		},
+	})
+	// A replay of the job may read the pages it re-extracted, but not one of
+	// another tenant's job
+	jobs.Put(&models.CrawlJob{ID: "replay-job", Tenant: defaultTenant, Status: "completed", ReplayOf: "own-job",
+		Results: []models.CrawlResult{{URL: "https://example.org/", HTMLRef: ownRef}}})
+	jobs.Put(&models.CrawlJob{ID: "foreign-replay", Tenant: defaultTenant, Status: "completed", ReplayOf: "victim-job",
+		Results: []models.CrawlResult{{URL: "https://example.com/", HTMLRef: victimRef}}})
+
+	tests := []struct {
+		job  string
+		want []string
+	}{
+		{"own-job", []string{"html/" + ownRef}},
+		{"replay-job", []string{"html/" + ownRef}},
+		{"foreign-replay", nil},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/jobs/"+tt.job+"/bundle", nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := bundle.Read(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.job, err)
+		}
+		if len(b.Artifacts) != len(tt.want) {
+			t.Errorf("%s: artifacts = %d, want %v", tt.job, len(b.Artifacts), tt.want)
+		}
+		for _, name := range tt.want {
+			if _, ok := b.Artifacts[name]; !ok {
+				t.Errorf("%s: artifact %s missing", tt.job, name)
+			}
+		}
+	}
+}
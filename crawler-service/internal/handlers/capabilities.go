@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/crawler"
+	"definitelynotaspy/crawler-service/internal/models"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Crawl size used when a request does not set one
+const (
+	defaultMaxPages = 50
+	defaultMaxDepth = 2
+)
+
+// crawlLimit reads a deployment limit on crawl size from the environment;
+// zero means unlimited
+func crawlLimit(name string) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// GetCapabilities describes what this deployment supports, so clients can
+// adapt their requests to it
+func GetCapabilities(c *fiber.Ctx) error {
+	_, _, workers := queue.Stats()
+	limits := fiber.Map{
+		"default_max_pages":   defaultMaxPages,
+		"default_max_depth":   defaultMaxDepth,
+		"max_runtime_seconds": int(crawler.JobMaxRuntime().Seconds()),
+		"max_concurrent_jobs": workers,
+	}
+	// Unset limits are left out rather than reported as zero
+	if n := crawlLimit("CRAWL_MAX_PAGES"); n > 0 {
+		limits["max_pages"] = n
+	}
+	if n := crawlLimit("CRAWL_MAX_DEPTH"); n > 0 {
+		limits["max_depth"] = n
+	}
+
+	return c.JSON(fiber.Map{
+		"version": crawler.Version,
+		"features": fiber.Map{
+			"render_js":            crawlerService.RenderingEnabled(),
+			"screenshots":          false,
+			"crawl_screenshots":    crawlerService.RenderingEnabled(),
+			"network_capture":      false,
+			"infinite_scroll":      false,
+			"render_emulation":     false,
+			"render_comparison":    false,
+			"tor":                  crawlerService.TorEnabled(),
+			"breach_lookup":        crawlerService.BreachLookupEnabled(),
+			"trusted_timestamps":   crawlerService.TimestampingEnabled(),
+			"signed_evidence":      crawlerService.CustodySigner() != nil,
+			"encryption_at_rest":   crawlerService.Keyring() != nil,
+			"reverse_image_search": crawlerService.ReverseImageSearchEnabled(),
+			"geoip":                crawlerService.GeoIP().Enabled(),
+			"neo4j":                crawlerService.Neo4j() != nil,
+			"distributed":          crawlerService.Distributed(),
+		},
+		"providers": fiber.Map{
+			"code_search":        crawlerService.CodeSearchProviders().Names(),
+			"search":             crawlerService.SearchProviders().Names(),
+			"paste_sites":        crawlerService.PasteSources(),
+			"url_scorer":         crawlerService.URLScorer().Name(),
+			"document_converter": crawlerService.DocumentConverter().Name(),
+			"archive_store":      crawlerService.Archive().Kind(),
+		},
+		"job_types": []string{
+			models.JobTypeCrawl,
+			models.JobTypeReplay,
+			models.JobTypePasteMonitor,
+			models.JobTypeCodeSearch,
+			models.JobTypeCTMonitor,
+			models.JobTypeUsername,
+			models.JobTypePageMonitor,
+		},
+		"crawl_modes":         []string{models.CrawlModeLinkCheck, models.CrawlModeAPI},
+		"processors":          crawlerService.Processors(),
+		"compliance_profiles": crawlerService.Compliance().List(),
+		"browser_profiles":    crawlerService.BrowserProfiles().Names(),
+		"regions":             crawlerService.Regions().Names(),
+		"categories":          crawlerService.Policies().Current().CategoryNames(),
+		"limits":              limits,
+	})
+}
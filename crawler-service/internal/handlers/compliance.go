@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListComplianceProfiles returns the compliance profiles jobs may name and
+// the one applied when they name none
+func ListComplianceProfiles(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"default":  crawlerService.Compliance().Default(),
+		"profiles": crawlerService.Compliance().List(),
+	})
+}
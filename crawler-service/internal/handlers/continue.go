@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// continueRequest optionally changes the budget of a continuation job
+type continueRequest struct {
+	MaxPages int `json:"max_pages"`
+	MaxDepth int `json:"max_depth"`
+}
+
+// ContinueJob starts a crawl seeded with the URLs a finished crawl
+// discovered but did not visit. The new job inherits the parent's options
+// while the service that ran the parent is up, skips every URL the parent
+// or the crawls it continued already visited, and crawls the domains that
+// rate limited the parent one request at a time.
+func ContinueJob(c *fiber.Ctx) error {
+	if inMaintenance() {
+		return rejectForMaintenance(c)
+	}
+
+	parent, exists := findJob(c, c.Params("id"))
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	if parent.Type != "" && parent.Type != models.JobTypeCrawl {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Only crawl jobs can be continued", nil)
+	}
+	if parent.Status == "pending" || parent.Status == "running" || parent.Status == "stalled" {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Cannot continue a job that is still in progress", nil)
+	}
+	if len(parent.Frontier) == 0 {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Job has no unvisited URLs to continue from", nil)
+	}
+
+	var body continueRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+		}
+	}
+
+	req := requestOf(parent)
+	req.Type = models.JobTypeCrawl
+	req.ExternalID = ""
+	req.FollowUpOf = ""
+	req.WarmStart = false
+	req.WarmStartOf = ""
+	req.WarmSeeds = nil
+	req.ContinueOf = parent.ID
+	req.SeedURLs = parent.Frontier
+	req.Visited = visitedURLs(parent)
+	req.SlowDomains = rateLimitedDomains(parent)
+	req.Cookies = parent.Cookies
+	if body.MaxPages > 0 {
+		req.MaxPages = body.MaxPages
+	}
+	if body.MaxDepth > 0 {
+		req.MaxDepth = body.MaxDepth
+	}
+	if err := bindAPIKey(requestKey(c), &req); err != nil {
+		return respondAPIError(c, err)
+	}
+
+	if crawlerService.Quota().TenantExceeded(req.Tenant) {
+		return respondError(c, fiber.StatusInsufficientStorage, errcode.QuotaExceeded, "Tenant storage quota exceeded", fiber.Map{
+			"tenant": req.Tenant,
+		})
+	}
+	exceeded, err := budgetExceeded(req.Tenant)
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+	if len(exceeded) > 0 {
+		return respondError(c, fiber.StatusPaymentRequired, errcode.BudgetExhausted, "Tenant monthly budget exhausted", fiber.Map{
+			"tenant":   req.Tenant,
+			"exceeded": exceeded,
+		})
+	}
+
+	job := launchJob(req, nil)
+
+	log.WithFields(log.Fields{
+		"job_id":       job.ID,
+		"continue_of":  parent.ID,
+		"seeds":        len(req.SeedURLs),
+		"slow_domains": len(req.SlowDomains),
+	}).Info("Continuation crawl started")
+
+	return c.Status(fiber.StatusCreated).JSON(models.JobResponse{
+		JobID:      job.ID,
+		Status:     "pending",
+		Message:    "Continuation job created successfully",
+		ContinueOf: parent.ID,
+		Seeds:      len(req.SeedURLs),
+		Job:        job,
+	})
+}
+
+// requestOf returns the request a job was started with, or as much of it
+// as the job records once the service that ran it is gone
+func requestOf(job *models.CrawlJob) models.CrawlRequest {
+	if job.Options != nil {
+		return *job.Options
+	}
+	return models.CrawlRequest{
+		Query:      job.Query,
+		Tenant:     job.Tenant,
+		CaseID:     job.CaseID,
+		MaxPages:   job.MaxPages,
+		MaxDepth:   job.MaxDepth,
+		Processors: job.Processors,
+	}
+}
+
+// visitedURLs returns the pages crawled by a job and by the jobs it
+// continues
+func visitedURLs(job *models.CrawlJob) []string {
+	var visited []string
+	seen := make(map[string]bool)
+	for job != nil && !seen[job.ID] {
+		seen[job.ID] = true
+
+		results, err := crawlerService.JobResults(job)
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to load results of continued job")
+		}
+		for _, result := range results {
+			visited = append(visited, result.URL)
+			for _, t := range result.Translations {
+				visited = append(visited, t.URL)
+			}
+		}
+
+		next, ok := jobs.Get(job.ContinueOf)
+		if !ok {
+			break
+		}
+		job = next
+	}
+	return visited
+}
+
+// rateLimitedDomains returns the domains that refused some of a job's
+// requests with 429 Too Many Requests
+func rateLimitedDomains(job *models.CrawlJob) []string {
+	var domains []string
+	for domain, cov := range job.Coverage {
+		if cov.Skipped["rate_limited"] > 0 {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
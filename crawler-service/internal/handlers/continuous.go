@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/crawler"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/frontier"
+	"definitelynotaspy/crawler-service/internal/models"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// continuous holds the tenants' continuous crawls and their frontiers
+var continuous *frontier.Store
+
+// continuousRequest configures a tenant's continuous crawl
+type continuousRequest struct {
+	Domains     []string `json:"domains"`
+	PagesPerRun int      `json:"pages_per_run"`
+}
+
+// continuousCheckInterval returns how often due pages are looked for:
+// CONTINUOUS_CHECK_INTERVAL, default 5m
+func continuousCheckInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CONTINUOUS_CHECK_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// StartContinuousCrawls starts a crawl of each tenant's due pages every
+// continuousCheckInterval until ctx is done. A tenant has one run at a
+// time, across instances when Redis is connected.
+func StartContinuousCrawls(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(continuousCheckInterval())
+		defer ticker.Stop()
+		for {
+			if !inMaintenance() {
+				for _, cfg := range continuous.Configs() {
+					runContinuousCrawl(cfg)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runContinuousCrawl starts a job fetching up to a run's worth of a
+// tenant's due pages, unless the tenant has a run in progress or is out of
+// quota or budget. It returns the job, or nil when none was started.
+func runContinuousCrawl(cfg frontier.Config) *models.CrawlJob {
+	now := time.Now().UTC()
+	due := continuous.Due(cfg.Tenant, now, cfg.PagesPerRun)
+	if len(due) == 0 {
+		return nil
+	}
+	if crawlerService.Quota().TenantExceeded(cfg.Tenant) {
+		log.WithField("tenant", cfg.Tenant).Warn("Skipping continuous crawl, tenant storage quota exceeded")
+		return nil
+	}
+	exceeded, err := budgetExceeded(cfg.Tenant)
+	if err != nil {
+		log.WithError(err).WithField("tenant", cfg.Tenant).Warn("Skipping continuous crawl, tenant budget could not be checked")
+		return nil
+	}
+	if len(exceeded) > 0 {
+		log.WithFields(log.Fields{
+			"tenant":   cfg.Tenant,
+			"exceeded": exceeded,
+		}).Warn("Skipping continuous crawl, tenant monthly budget exhausted")
+		return nil
+	}
+	// The lease outlives the longest a run may take, in case the instance
+	// running it dies
+	if !continuous.Lease(cfg.Tenant, crawler.JobMaxRuntime()+time.Hour) {
+		return nil
+	}
+
+	seeds := make([]string, len(due))
+	for i, e := range due {
+		seeds[i] = e.URL
+	}
+	continuous.Scheduled(cfg.Tenant, due, now)
+
+	// Runs fetch the due pages only; the links found on them join the
+	// frontier and are fetched when they fall due
+	job := launchJob(models.CrawlRequest{
+		Type:       models.JobTypeCrawl,
+		Query:      "continuous crawl of " + strings.Join(cfg.Domains, ", "),
+		Tenant:     cfg.Tenant,
+		SeedURLs:   seeds,
+		MaxPages:   len(seeds),
+		MaxDepth:   1,
+		Continuous: true,
+	}, nil)
+
+	log.WithFields(log.Fields{
+		"job_id": job.ID,
+		"tenant": cfg.Tenant,
+		"pages":  len(seeds),
+	}).Info("Continuous crawl run started")
+	return job
+}
+
+// ContinuousCoverage feeds each finished continuous crawl run back into
+// its tenant's frontier: the pages fetched are rescheduled by how they
+// changed, and links to the tenant's domains not yet known are added
+func ContinuousCoverage(e events.Event) {
+	if e.Type != events.JobFinished {
+		return
+	}
+	job, ok := jobs.Get(e.JobID)
+	if !ok || !job.Continuous {
+		return
+	}
+
+	// Loading results from within a handler would hold up the bus
+	go func() {
+		defer continuous.Release(job.Tenant)
+
+		cfg := continuous.Config(job.Tenant)
+		if cfg == nil {
+			return
+		}
+		results, err := crawlerService.JobResults(job)
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to load continuous crawl results")
+			return
+		}
+
+		var links []string
+		for _, result := range results {
+			if result.Error != "" || !cfg.Covers(result.URL) {
+				continue
+			}
+			continuous.Visited(job.Tenant, result.URL, result.ContentHash, result.CrawledAt)
+			for _, link := range result.Links {
+				if cfg.Covers(link.URL) {
+					links = append(links, withoutFragment(link.URL))
+				}
+			}
+		}
+		added := continuous.Add(job.Tenant, links)
+
+		log.WithFields(log.Fields{
+			"job_id":     job.ID,
+			"tenant":     job.Tenant,
+			"visited":    len(results),
+			"discovered": added,
+		}).Info("Continuous crawl run recorded")
+	}()
+}
+
+func withoutFragment(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// GetContinuousCrawl returns a tenant's continuous crawl and a summary of
+// its frontier
+func GetContinuousCrawl(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+	cfg := continuous.Config(tenant)
+	if cfg == nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "No continuous crawl for tenant", nil)
+	}
+	return c.JSON(fiber.Map{
+		"continuous": cfg,
+		"frontier":   continuous.Stats(tenant),
+	})
+}
+
+// PutContinuousCrawl starts or reconfigures a tenant's continuous crawl of
+// a set of domains. Their front pages seed the frontier, and the first run
+// starts at once.
+func PutContinuousCrawl(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+
+	var req continuousRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	now := time.Now().UTC()
+	cfg := frontier.Config{
+		Tenant:      tenant,
+		Domains:     req.Domains,
+		PagesPerRun: req.PagesPerRun,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := cfg.Validate(); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	if previous := continuous.Config(tenant); previous != nil {
+		cfg.CreatedAt = previous.CreatedAt
+	}
+	if err := continuous.PutConfig(cfg); err != nil {
+		log.WithError(err).WithField("tenant", tenant).Error("Failed to save continuous crawl")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to save continuous crawl", nil)
+	}
+
+	seeds := make([]string, len(cfg.Domains))
+	for i, domain := range cfg.Domains {
+		seeds[i] = "https://" + domain + "/"
+	}
+	seeded := continuous.Add(tenant, seeds)
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "tenant.continuous_crawl",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Tenant: tenant,
+		Details: map[string]interface{}{
+			"domains":       cfg.Domains,
+			"pages_per_run": cfg.PagesPerRun,
+		},
+	})
+
+	response := fiber.Map{
+		"continuous": cfg,
+		"seeded":     seeded,
+	}
+	if !inMaintenance() {
+		if job := runContinuousCrawl(cfg); job != nil {
+			response["job_id"] = job.ID
+		}
+	}
+	return c.JSON(response)
+}
+
+// DeleteContinuousCrawl stops a tenant's continuous crawl and forgets its
+// frontier. A run in progress finishes as an ordinary job.
+func DeleteContinuousCrawl(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+	if !continuous.DeleteConfig(tenant) {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "No continuous crawl for tenant", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "tenant.continuous_crawl_delete",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Tenant: tenant,
+	})
+	return c.JSON(fiber.Map{"deleted": true, "tenant": tenant})
+}
+
+// GetContinuousFrontier lists the URLs of a tenant's continuous crawl, the
+// soonest due first; limit defaults to 100 and is at most 1000
+func GetContinuousFrontier(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+	if continuous.Config(tenant) == nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "No continuous crawl for tenant", nil)
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > 1000 {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "limit must be between 1 and 1000", nil)
+	}
+	entries := continuous.List(tenant, limit)
+	return c.JSON(fiber.Map{
+		"urls":  entries,
+		"total": len(entries),
+	})
+}
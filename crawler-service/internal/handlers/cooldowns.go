@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetCooldowns lists the hosts whose requests are paused after answering
+// 429 Too Many Requests, and for how much longer
+func GetCooldowns(c *fiber.Ctx) error {
+	cooldowns := crawlerService.Policies().Cooldowns()
+	list := make([]fiber.Map, 0, len(cooldowns))
+	for _, cd := range cooldowns {
+		list = append(list, fiber.Map{
+			"host":              cd.Host,
+			"until":             cd.Until,
+			"remaining_seconds": int(time.Until(cd.Until).Seconds()),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"cooldowns": list,
+		"total":     len(list),
+	})
+}
+
+// ClearCooldown ends a host's cool-down early
+func ClearCooldown(c *fiber.Ctx) error {
+	host := c.Params("host")
+	if !crawlerService.Policies().ClearCooldown(host) {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Host is not cooling down", nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Cool-down cleared",
+		"host":    host,
+	})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// coverageRow is one domain of a job's coverage report
+type coverageRow struct {
+	Domain string `json:"domain"`
+	// SkippedTotal sums the per-reason skip counts
+	SkippedTotal int `json:"skipped_total"`
+	models.DomainCoverage
+}
+
+// coverageReport returns a job's per-domain coverage, domains with the most
+// skipped URLs first
+func coverageReport(job *models.CrawlJob) []coverageRow {
+	report := make([]coverageRow, 0, len(job.Coverage))
+	for domain, cov := range job.Coverage {
+		row := coverageRow{Domain: domain, DomainCoverage: cov}
+		for _, n := range cov.Skipped {
+			row.SkippedTotal += n
+		}
+		report = append(report, row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].SkippedTotal != report[j].SkippedTotal {
+			return report[i].SkippedTotal > report[j].SkippedTotal
+		}
+		return report[i].Domain < report[j].Domain
+	})
+	return report
+}
+
+// GetJobCoverage reports, per domain, the URLs a finished crawl discovered
+// but did not visit and why, as JSON or, with format=csv, as a CSV file of
+// the skipped URL samples
+func GetJobCoverage(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	if job.Coverage == nil {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Coverage is reported when a crawl finishes", fiber.Map{
+			"status": job.Status,
+		})
+	}
+
+	report := coverageReport(job)
+
+	if c.Query("format") == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s-coverage.csv"`, job.ID))
+
+		w := csv.NewWriter(c.Response().BodyWriter())
+		w.Write([]string{"domain", "reason", "skipped", "url"})
+		for _, row := range report {
+			reasons := make([]string, 0, len(row.Skipped))
+			for reason := range row.Skipped {
+				reasons = append(reasons, reason)
+			}
+			sort.Strings(reasons)
+			for _, reason := range reasons {
+				count := strconv.Itoa(row.Skipped[reason])
+				for _, link := range row.Samples[reason] {
+					w.Write([]string{row.Domain, reason, count, link})
+				}
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	skipped := 0
+	for _, row := range report {
+		skipped += row.SkippedTotal
+	}
+	return c.JSON(fiber.Map{
+		"job_id":  job.ID,
+		"skipped": skipped,
+		"domains": report,
+	})
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/crawler"
+	"html/template"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var crawlerInfoPage = template.Must(template.New("crawler-info").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Name}} crawler</title></head>
+<body>
+<h1>{{.Name}}</h1>
+<p>You are seeing this page because a request to your site identified itself as <code>{{.UserAgent}}</code>.</p>
+{{if .Operator}}<p><strong>Operated by:</strong> {{.Operator}}</p>{{end}}
+{{if .Purpose}}<p><strong>Purpose:</strong> {{.Purpose}}</p>{{end}}
+{{if .Contact}}<p><strong>Contact:</strong> <a href="mailto:{{.Contact}}">{{.Contact}}</a></p>{{end}}
+<h2>Opting out</h2>
+<p>{{.OptOut}}</p>
+<pre>User-agent: {{.RobotsToken}}
+Disallow: /</pre>
+</body>
+</html>
+`))
+
+// GetCrawlerInfo serves the public page the crawler's user agent links to:
+// who operates it, why, and how to opt out. Clients asking for JSON get
+// the same as JSON.
+func GetCrawlerInfo(c *fiber.Ctx) error {
+	info := crawler.CrawlerInfo()
+	if c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		return c.JSON(info)
+	}
+	c.Type("html", "utf-8")
+	return crawlerInfoPage.Execute(c, info)
+}
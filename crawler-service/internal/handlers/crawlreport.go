@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// domainReportRow is one domain of a job's crawl report
+type domainReportRow struct {
+	Domain string `json:"domain"`
+	// ErrorRate is the share of the domain's requests that failed
+	ErrorRate float64 `json:"error_rate"`
+	models.DomainStats
+}
+
+// domainReport returns a job's per-domain statistics ordered by sortBy:
+// requests (most first), errors (most failed first, by error rate then
+// count) or domain (by name)
+func domainReport(job *models.CrawlJob, sortBy string) []domainReportRow {
+	report := make([]domainReportRow, 0, len(job.DomainStats))
+	for domain, stats := range job.DomainStats {
+		row := domainReportRow{Domain: domain, DomainStats: stats}
+		if stats.Requests > 0 {
+			row.ErrorRate = math.Round(float64(stats.Errors)/float64(stats.Requests)*1000) / 1000
+		}
+		report = append(report, row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		switch sortBy {
+		case "errors":
+			if a.ErrorRate != b.ErrorRate {
+				return a.ErrorRate > b.ErrorRate
+			}
+			if a.Errors != b.Errors {
+				return a.Errors > b.Errors
+			}
+		case "requests":
+			if a.Requests != b.Requests {
+				return a.Requests > b.Requests
+			}
+		}
+		return a.Domain < b.Domain
+	})
+	return report
+}
+
+// GetJobReport breaks a finished crawl down per domain: the requests made,
+// pages kept, bytes downloaded, average response time, status codes, error
+// codes and most frequent content types. It is JSON or, with format=csv, a
+// CSV file; sort=errors puts the domains that failed most first.
+func GetJobReport(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	if job.DomainStats == nil {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Crawl reports are made when a crawl finishes", fiber.Map{
+			"status": job.Status,
+		})
+	}
+
+	sortBy := c.Query("sort", "requests")
+	switch sortBy {
+	case "requests", "errors", "domain":
+	default:
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "sort must be requests, errors or domain", nil)
+	}
+	report := domainReport(job, sortBy)
+
+	if c.Query("format") == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s-report.csv"`, job.ID))
+
+		w := csv.NewWriter(c.Response().BodyWriter())
+		w.Write([]string{"domain", "requests", "pages", "errors", "error_rate", "bytes", "avg_response_ms", "status_codes", "error_codes", "content_types"})
+		for _, row := range report {
+			types := make([]string, len(row.ContentTypes))
+			for i, t := range row.ContentTypes {
+				types[i] = t.ContentType + "=" + strconv.Itoa(t.Responses)
+			}
+			w.Write([]string{
+				row.Domain,
+				strconv.Itoa(row.Requests),
+				strconv.Itoa(row.Pages),
+				strconv.Itoa(row.Errors),
+				strconv.FormatFloat(row.ErrorRate, 'f', -1, 64),
+				strconv.FormatInt(row.Bytes, 10),
+				strconv.FormatInt(row.AvgResponseMS, 10),
+				joinCounts(row.StatusCodes),
+				joinCounts(row.ErrorCodes),
+				strings.Join(types, ";"),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	var totals models.DomainStats
+	for _, row := range report {
+		totals.Requests += row.Requests
+		totals.Pages += row.Pages
+		totals.Errors += row.Errors
+		totals.Bytes += row.Bytes
+	}
+	return c.JSON(fiber.Map{
+		"job_id":   job.ID,
+		"status":   job.Status,
+		"requests": totals.Requests,
+		"pages":    totals.Pages,
+		"errors":   totals.Errors,
+		"bytes":    totals.Bytes,
+		"domains":  report,
+	})
+}
+
+// joinCounts renders counts as key=count pairs joined by ";", ordered by key
+func joinCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + strconv.Itoa(counts[k])
+	}
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/crawler"
+	"definitelynotaspy/crawler-service/internal/custody"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportJobEvidence streams a signed chain-of-custody bundle of a job: its
+// results, archived pages, digests, provenance and timestamp tokens, with a
+// manifest signed by the service key. Every export is audited.
+func ExportJobEvidence(c *fiber.Ctx) error {
+	signer := crawlerService.CustodySigner()
+	if signer == nil {
+		return respondError(c, fiber.StatusNotImplemented, errcode.NotImplemented, "Evidence signing is not configured", nil)
+	}
+
+	jobID := c.Params("id")
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	if job.Status == "pending" || job.Status == "running" {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Job is still in progress", nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load results for evidence export")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	results = roleMask(c).Apply(results)
+
+	html := make(map[string][]byte)
+	for _, result := range results {
+		if result.HTMLRef == "" {
+			continue
+		}
+		data, err := loadArtifact(job, result.HTMLRef)
+		if err != nil {
+			log.WithError(err).WithField("ref", result.HTMLRef).Warn("Archived HTML missing from evidence export")
+			continue
+		}
+		html[result.HTMLRef] = data
+	}
+
+	actor := c.Get("X-Actor", c.IP())
+	var buf bytes.Buffer
+	manifest, err := custody.Write(&buf, &custody.Export{
+		Job:        *job,
+		Results:    results,
+		HTML:       html,
+		ExportedBy: actor,
+		Service:    crawler.ServiceIdentity(),
+	}, signer)
+	if err != nil {
+		return err
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "job.evidence_export",
+		Tenant: job.Tenant,
+		JobID:  job.ID,
+		Actor:  actor,
+		Details: map[string]interface{}{
+			"manifest_sha256": custody.Digest(manifest),
+			"key_id":          manifest.SigningKey.KeyID,
+			"results":         len(manifest.Evidence),
+			"files":           len(manifest.Files),
+		},
+	})
+
+	c.Set(fiber.HeaderContentType, "application/zstd")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"evidence-%s.tar.zst\"", job.ID))
+	return c.Send(buf.Bytes())
+}
+
+// GetCustodyKey returns the public key evidence manifests are signed with
+func GetCustodyKey(c *fiber.Ctx) error {
+	signer := crawlerService.CustodySigner()
+	if signer == nil {
+		return respondError(c, fiber.StatusNotImplemented, errcode.NotImplemented, "Evidence signing is not configured", nil)
+	}
+	return c.JSON(signer.PublicKey())
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// dedupeMu serialises the check for a running duplicate with the launch of
+// a new job, so identical requests arriving together start one job
+var dedupeMu sync.Mutex
+
+// dedupeWindow returns how long after a job starts an identical request is
+// given that job instead of a new one; zero turns deduplication off
+func dedupeWindow(req models.CrawlRequest) time.Duration {
+	seconds := req.DedupeWindow
+	if seconds == 0 {
+		seconds, _ = strconv.Atoi(os.Getenv("CRAWL_DEDUPE_WINDOW"))
+	}
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// runningDuplicate returns the tenant's pending or running job started
+// within window whose request had the same query and parameters, or nil
+func runningDuplicate(req models.CrawlRequest, window time.Duration) (*models.CrawlJob, error) {
+	fingerprint := requestFingerprint(req)
+	if fingerprint == nil {
+		return nil, nil
+	}
+
+	unfinished, err := jobs.Find(store.JobFilter{Tenant: req.Tenant, Since: time.Now().Add(-window), Unfinished: true})
+	if err != nil {
+		return nil, err
+	}
+	var match *models.CrawlJob
+	for _, job := range unfinished {
+		if job.Tenant != req.Tenant || job.Options == nil || job.DeletedAt != nil {
+			continue
+		}
+		if job.Status != "pending" && job.Status != "running" && job.Status != "stalled" {
+			continue
+		}
+		if !bytes.Equal(requestFingerprint(*job.Options), fingerprint) {
+			continue
+		}
+		if match == nil || job.StartedAt.After(match.StartedAt) {
+			match = job
+		}
+	}
+	return match, nil
+}
+
+// requestFingerprint encodes the parameters that make two requests the same
+// crawl. The dedupe window itself does not count.
+func requestFingerprint(req models.CrawlRequest) []byte {
+	req.DedupeWindow = 0
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil
+	}
+	return data
+}
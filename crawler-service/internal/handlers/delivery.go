@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetJobDelivery reports how far a job's results have got: to each output
+// it declares, to the intel service through the outbox, and the state of
+// its completion callback
+func GetJobDelivery(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists || job.DeletedAt != nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	response := fiber.Map{
+		"job_id":  job.ID,
+		"outputs": job.Outputs,
+	}
+	if intel, ok := crawlerService.IntelDelivery(job.ID); ok {
+		response["intel"] = intel
+	}
+	if job.Callback != nil {
+		response["callback"] = job.Callback
+	}
+	return c.JSON(response)
+}
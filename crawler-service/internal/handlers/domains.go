@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// topLinkedDomains is how many linked domains the job status shows
+const topLinkedDomains = 10
+
+// linkedDomainReport returns the external domains a job's pages link to,
+// most linked first, at most limit of them when limit is positive
+func linkedDomainReport(job *models.CrawlJob, limit int) []models.DomainLinks {
+	report := make([]models.DomainLinks, 0, len(job.LinkedDomains))
+	for domain, counts := range job.LinkedDomains {
+		report = append(report, models.DomainLinks{Domain: domain, LinkedDomain: counts})
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Links != report[j].Links {
+			return report[i].Links > report[j].Links
+		}
+		if report[i].Pages != report[j].Pages {
+			return report[i].Pages > report[j].Pages
+		}
+		return report[i].Domain < report[j].Domain
+	})
+
+	if limit > 0 && len(report) > limit {
+		report = report[:limit]
+	}
+	return report
+}
+
+// GetJobLinkedDomains reports which external domains a job's pages link to
+// most, as JSON or, with format=csv, as a CSV file
+func GetJobLinkedDomains(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	report := linkedDomainReport(job, c.QueryInt("limit"))
+
+	if c.Query("format") == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s-domains.csv"`, job.ID))
+
+		w := csv.NewWriter(c.Response().BodyWriter())
+		w.Write([]string{"domain", "links", "pages"})
+		for _, row := range report {
+			w.Write([]string{row.Domain, strconv.Itoa(row.Links), strconv.Itoa(row.Pages)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	return c.JSON(fiber.Map{
+		"job_id":  job.ID,
+		"total":   len(job.LinkedDomains),
+		"domains": report,
+	})
+}
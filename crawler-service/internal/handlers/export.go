@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"definitelynotaspy/crawler-service/internal/confidence"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportJobZip streams a ZIP of a finished job: job.json, its results as
+// NDJSON (one result per line) and the archived raw HTML of its pages under
+// html/. The archive is written as it is sent, without temporary files, so
+// large jobs are retrieved in one call.
+func ExportJobZip(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	if job.Status == "pending" || job.Status == "running" {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Job is still in progress", nil)
+	}
+
+	minConf, err := minConfidence(c)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load results for export")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	results = confidence.Filter(roleMask(c).Apply(results), minConf)
+
+	meta := *job
+	meta.Results = nil
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s.zip"`, job.ID))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		zw := zip.NewWriter(w)
+		modified := job.CompletedAt
+		if modified.IsZero() {
+			modified = time.Now().UTC()
+		}
+		create := func(name string) (io.Writer, error) {
+			return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		}
+
+		// Headers and data go out as each file is written; a failure
+		// midway leaves the client a truncated archive
+		err := func() error {
+			f, err := create("job.json")
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(meta); err != nil {
+				return err
+			}
+
+			f, err = create("results.ndjson")
+			if err != nil {
+				return err
+			}
+			enc = json.NewEncoder(f)
+			for _, result := range results {
+				if err := enc.Encode(result); err != nil {
+					return err
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			written := make(map[string]bool)
+			for _, result := range results {
+				if result.HTMLRef == "" || written[result.HTMLRef] {
+					continue
+				}
+				written[result.HTMLRef] = true
+
+				data, err := loadArtifact(job, result.HTMLRef)
+				if err != nil {
+					log.WithError(err).WithField("ref", result.HTMLRef).Warn("Archived HTML missing from export")
+					continue
+				}
+				html, err := gunzip(data)
+				if err != nil {
+					log.WithError(err).WithField("ref", result.HTMLRef).Warn("Corrupt archived HTML left out of export")
+					continue
+				}
+				f, err := create("html/" + result.HTMLRef + ".html")
+				if err != nil {
+					return err
+				}
+				if _, err := f.Write(html); err != nil {
+					return err
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			return w.Flush()
+		}()
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Job export interrupted")
+		}
+	})
+	return nil
+}
+
+// gunzip decompresses an archived page
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/crawler"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/protocols"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Bounds on scrolling a rendered page, which holds the synchronous request
+// open while it runs
+const (
+	maxScrollCount      = 50
+	maxScrollIntervalMS = 10000
+)
+
+// FetchURL synchronously fetches and extracts a single URL
+func FetchURL(c *fiber.Ctx) error {
+	var req models.FetchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	if req.URL == "" {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "URL is required", nil)
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || !protocols.Supported(u.Scheme) || (u.Host == "" && u.Scheme != "file") {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "URL must be an absolute URL with a supported scheme", nil)
+	}
+
+	if len(req.CaptureNetwork) > 0 && !req.RenderJS {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "capture_network needs render_js", nil)
+	}
+	for _, pattern := range req.CaptureNetwork {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid capture_network pattern", fiber.Map{
+				"pattern": pattern,
+			})
+		}
+	}
+
+	if (req.ScrollCount != 0 || req.ScrollIntervalMS != 0) && !req.RenderJS {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "scroll_count and scroll_interval_ms need render_js", nil)
+	}
+	if req.ScrollCount < 0 || req.ScrollCount > maxScrollCount || req.ScrollIntervalMS < 0 || req.ScrollIntervalMS > maxScrollIntervalMS {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("scroll_count must be 0-%d and scroll_interval_ms 0-%d", maxScrollCount, maxScrollIntervalMS), nil)
+	}
+
+	if req.Emulation != nil && !req.RenderJS {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "emulation needs render_js", nil)
+	}
+	if err := crawler.ValidateEmulation(req.Emulation); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	if req.CompareRender && !req.RenderJS {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "compare_render needs render_js", nil)
+	}
+
+	result, err := crawlerService.Fetch(req)
+	if err != nil {
+		if errors.Is(err, crawler.ErrRenderUnavailable) {
+			return respondError(c, fiber.StatusNotImplemented, errcode.NotImplemented, err.Error(), nil)
+		}
+		log.WithError(err).WithField("url", req.URL).Error("Fetch failed")
+		return respondError(c, fiber.StatusBadGateway, errcode.Classify(err, 0), err.Error(), nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"result": result,
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/apikey"
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/fieldmask"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// fieldMaskRequest sets the result fields hidden from a role
+type fieldMaskRequest struct {
+	Hidden []string `json:"hidden"`
+}
+
+// requestRole returns the requester's role: the role of their API key,
+// else DEFAULT_ROLE
+func requestRole(c *fiber.Ctx) string {
+	return keyRole(requestKey(c))
+}
+
+// keyRole returns the role of key, else DEFAULT_ROLE
+func keyRole(key *apikey.Key) string {
+	if key != nil && key.Role != "" {
+		return key.Role
+	}
+	return os.Getenv("DEFAULT_ROLE")
+}
+
+// roleMask returns the field mask of the requester's role, or the
+// strictest mask when the role has none. Admin keys without a role see
+// every field.
+func roleMask(c *fiber.Ctx) *fieldmask.Rule {
+	return keyMask(requestKey(c))
+}
+
+// keyMask returns the field mask of key's role, as roleMask does
+func keyMask(key *apikey.Key) *fieldmask.Rule {
+	if key != nil && key.Role == "" && key.Scope == apikey.ScopeAdmin {
+		return nil
+	}
+	return crawlerService.FieldMasks().ForRole(keyRole(key))
+}
+
+// ListFieldMasks lists the result fields hidden per role, and the groups
+// of fields that can be hidden together
+func ListFieldMasks(c *fiber.Ctx) error {
+	rules := crawlerService.FieldMasks().List()
+	return c.JSON(fiber.Map{
+		"roles":  rules,
+		"groups": fieldmask.Groups,
+		"total":  len(rules),
+	})
+}
+
+// PutFieldMask sets the result fields a role may not see, in the results
+// endpoint and every export
+func PutFieldMask(c *fiber.Ctx) error {
+	var req fieldMaskRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	rule, err := fieldmask.NewRule(c.Params("role"), req.Hidden)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	if err := crawlerService.FieldMasks().Put(*rule); err != nil {
+		log.WithError(err).WithField("role", c.Params("role")).Error("Failed to persist field mask")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to save field mask", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "policy.field_mask",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"role":   rule.Role,
+			"hidden": rule.Hidden,
+		},
+	})
+
+	return c.JSON(rule)
+}
+
+// DeleteFieldMask lets a role see every result field again
+func DeleteFieldMask(c *fiber.Ctx) error {
+	role := c.Params("role")
+	if !crawlerService.FieldMasks().Delete(role) {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Role has no field mask", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action:  "policy.field_mask_delete",
+		Actor:   c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{"role": role},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Field mask removed",
+		"role":    role,
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FollowUpCrawls starts a crawl of each host announced by a HostsDiscovered
+// event and each profile announced by a ProfilesFound event whose source job
+// asked for follow-up crawls
+func FollowUpCrawls(e events.Event) {
+	var seeds []string
+	switch e.Type {
+	case events.HostsDiscovered:
+		hosts, _ := e.Data["hosts"].([]string)
+		for _, host := range hosts {
+			seeds = append(seeds, "https://"+host+"/")
+		}
+	case events.ProfilesFound:
+		seeds, _ = e.Data["urls"].([]string)
+	default:
+		return
+	}
+	if followUp, _ := e.Data["follow_up"].(bool); !followUp {
+		return
+	}
+	if inMaintenance() {
+		log.WithField("job_id", e.JobID).Warn("Skipping follow-up crawls, service in maintenance mode")
+		return
+	}
+	maxPages, _ := e.Data["max_pages"].(int)
+	maxDepth, _ := e.Data["max_depth"].(int)
+
+	// Follow-ups run under the constraints of the job that found them and
+	// deliver to its outputs
+	var profile string
+	var outputs []string
+	if parent, ok := jobs.Get(e.JobID); ok {
+		if parent.Compliance != nil {
+			profile = parent.Compliance.Name
+		}
+		if parent.Options != nil {
+			outputs = parent.Options.Outputs
+		}
+	}
+
+	for _, seed := range seeds {
+		if crawlerService.Quota().TenantExceeded(e.Tenant) {
+			log.WithField("tenant", e.Tenant).Warn("Skipping follow-up crawls, tenant storage quota exceeded")
+			return
+		}
+		exceeded, err := budgetExceeded(e.Tenant)
+		if err != nil {
+			log.WithError(err).WithField("tenant", e.Tenant).Warn("Skipping follow-up crawls, tenant budget could not be checked")
+			return
+		}
+		if len(exceeded) > 0 {
+			log.WithFields(log.Fields{
+				"tenant":   e.Tenant,
+				"exceeded": exceeded,
+			}).Warn("Skipping follow-up crawls, tenant monthly budget exhausted")
+			return
+		}
+
+		job := launchJob(models.CrawlRequest{
+			Type:              models.JobTypeCrawl,
+			Query:             seed,
+			Tenant:            e.Tenant,
+			MaxPages:          maxPages,
+			MaxDepth:          maxDepth,
+			FollowUpOf:        e.JobID,
+			ComplianceProfile: profile,
+			Outputs:           outputs,
+		}, nil)
+
+		log.WithFields(log.Fields{
+			"job_id":       job.ID,
+			"follow_up_of": e.JobID,
+			"seed":         seed,
+		}).Info("Follow-up crawl started")
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportJobGeoJSON returns the coordinates found in a job's results as a
+// GeoJSON FeatureCollection of points
+func ExportJobGeoJSON(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load job results")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	results = roleMask(c).Apply(results)
+
+	features := make([]fiber.Map, 0)
+	for _, result := range results {
+		if result.Geo == nil {
+			continue
+		}
+		for _, p := range result.Geo.Points {
+			properties := fiber.Map{
+				"url":    result.URL,
+				"title":  result.Title,
+				"source": p.Source,
+			}
+			if p.Image != "" {
+				properties["image"] = p.Image
+			}
+			if len(result.Geo.Places) > 0 {
+				properties["places"] = result.Geo.Places
+			}
+
+			features = append(features, fiber.Map{
+				"type": "Feature",
+				"geometry": fiber.Map{
+					"type":        "Point",
+					"coordinates": []float64{p.Lon, p.Lat},
+				},
+				"properties": properties,
+			})
+		}
+	}
+
+	body, err := json.Marshal(fiber.Map{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, "application/geo+json")
+	return c.Send(body)
+}
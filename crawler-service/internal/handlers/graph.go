@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/confidence"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/graph"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/tabular"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// jobGraph loads a job's results and derives its entity graph. When the
+// job cannot be loaded it writes the error response and returns a nil graph.
+func jobGraph(c *fiber.Ctx) (*models.CrawlJob, []models.CrawlResult, *graph.Graph, error) {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return nil, nil, nil, respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	minConf, err := minConfidence(c)
+	if err != nil {
+		return nil, nil, nil, respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load job results")
+		return nil, nil, nil, respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	results = confidence.Filter(roleMask(c).Apply(results), minConf)
+	return job, results, graph.Build(job, results), nil
+}
+
+// ExportJobGraph exports a job's entities and relationships as Cypher
+// statements (format=cypher, default), a zip of neo4j-admin import CSVs
+// (format=csv), or a zip of Parquet files that also holds the results
+// (format=parquet)
+func ExportJobGraph(c *fiber.Ctx) error {
+	job, results, g, err := jobGraph(c)
+	if g == nil {
+		return err
+	}
+	jobID := job.ID
+
+	switch c.Query("format", "cypher") {
+	case "cypher":
+		c.Set(fiber.HeaderContentType, "application/x-cypher-query; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s.cypher"`, jobID))
+		return c.SendString(g.Cypher())
+	case "csv":
+		var buf bytes.Buffer
+		if err := g.WriteCSV(&buf); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "application/zip")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s-graph.zip"`, jobID))
+		return c.Send(buf.Bytes())
+	case "parquet":
+		var buf bytes.Buffer
+		if err := tabular.WriteParquet(&buf, job, results, g); err != nil {
+			log.WithError(err).WithField("job_id", jobID).Error("Failed to write Parquet export")
+			return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to write Parquet export", nil)
+		}
+		c.Set(fiber.HeaderContentType, "application/zip")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s-parquet.zip"`, jobID))
+		return c.Send(buf.Bytes())
+	}
+
+	return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "format must be cypher, csv or parquet", nil)
+}
+
+// WriteJobGraph merges a job's entities and relationships into Neo4j
+func WriteJobGraph(c *fiber.Ctx) error {
+	writer := crawlerService.Neo4j()
+	if writer == nil {
+		return respondError(c, fiber.StatusNotImplemented, errcode.NotImplemented, "Neo4j is not configured", nil)
+	}
+
+	job, _, g, err := jobGraph(c)
+	if g == nil {
+		return err
+	}
+	jobID := job.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if err := writer.Write(ctx, g); err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to write job graph")
+		return respondError(c, fiber.StatusBadGateway, errcode.Upstream, "Failed to write graph to Neo4j", nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":       "Graph written to Neo4j",
+		"job_id":        jobID,
+		"nodes":         len(g.Nodes()),
+		"relationships": len(g.Edges()),
+	})
+}
+
+// GetJobLinkGraph returns the graph of links between a job's pages, with
+// the pages each links to and is linked from counted as their out and in
+// degree, as JSON (format=json, default) or GraphML (format=graphml). By
+// default only links between crawled pages are kept; scope=all adds the
+// pages they link to that the job did not crawl.
+func GetJobLinkGraph(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "graphml" {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "format must be json or graphml", nil)
+	}
+	scope := c.Query("scope", "crawled")
+	if scope != "crawled" && scope != "all" {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "scope must be crawled or all", nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load job results")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	links := graph.Links(roleMask(c).Apply(results), scope == "crawled")
+
+	if format == "graphml" {
+		var buf bytes.Buffer
+		if err := links.WriteGraphML(&buf); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "application/graphml+xml")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s-links.graphml"`, job.ID))
+		return c.Send(buf.Bytes())
+	}
+
+	return c.JSON(fiber.Map{
+		"job_id": job.ID,
+		"scope":  scope,
+		"nodes":  links.Nodes,
+		"edges":  links.Edges,
+	})
+}
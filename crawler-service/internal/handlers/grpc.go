@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/apikey"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Caller makes calls through the gRPC API (internal/grpcapi). Its methods
+// run the checks of the matching REST routes: the scope of the caller's
+// API key, its tenant, read-only replicas and maintenance mode.
+type Caller struct {
+	key *apikey.Key
+}
+
+// AuthenticateCaller authenticates a gRPC call by its x-api-key or
+// authorization metadata, as Authenticate does a REST request. The call
+// counts against the key's per-minute allowance once, however long it
+// lasts.
+func AuthenticateCaller(apiKey, authorization string) (*Caller, *APIError) {
+	key, _, err := authenticateSecret(apiKeySecret(apiKey, authorization))
+	if err != nil {
+		return nil, err
+	}
+	return &Caller{key: key}, nil
+}
+
+// write refuses calls that change state when the caller may not write or
+// the instance is a read-only replica
+func (caller *Caller) write() *APIError {
+	if err := scopeError(caller.key, apikey.ScopeWrite); err != nil {
+		return err
+	}
+	if ReadReplica() {
+		return readOnlyRefusal()
+	}
+	return nil
+}
+
+// StartCrawl starts a job, as POST /crawl does
+func (caller *Caller) StartCrawl(req models.CrawlRequest) (models.JobResponse, *APIError) {
+	if err := caller.write(); err != nil {
+		return models.JobResponse{}, err
+	}
+	if inMaintenance() {
+		return models.JobResponse{}, maintenanceRefusal()
+	}
+	return startCrawl(caller.key, req)
+}
+
+// Status returns a job's status, as GET /status/:id does
+func (caller *Caller) Status(jobID string) (models.StatusResponse, *APIError) {
+	if err := scopeError(caller.key, apikey.ScopeRead); err != nil {
+		return models.StatusResponse{}, err
+	}
+	job, exists := keyJob(caller.key, jobID)
+	if !exists {
+		return models.StatusResponse{}, refuse(fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	return jobStatus(job), nil
+}
+
+// Results returns a job's results, without the fields the caller's role
+// may not see
+func (caller *Caller) Results(jobID string) ([]models.CrawlResult, *APIError) {
+	if err := scopeError(caller.key, apikey.ScopeRead); err != nil {
+		return nil, err
+	}
+	job, exists := keyJob(caller.key, jobID)
+	if !exists {
+		return nil, refuse(fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load job results")
+		return nil, refuse(fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	return keyMask(caller.key).Apply(results), nil
+}
+
+// JobListing selects the jobs ListJobs returns
+type JobListing struct {
+	Statuses   []string
+	Query      string
+	ExternalID string
+	CaseID     string
+	// Limit is the page size, zero for every job
+	Limit int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+}
+
+// ListJobs returns a page of jobs, newest first, as GET /jobs does
+func (caller *Caller) ListJobs(listing JobListing) (models.JobListResponse, *APIError) {
+	if err := scopeError(caller.key, apikey.ScopeRead); err != nil {
+		return models.JobListResponse{}, err
+	}
+	after, err := store.ParseCursor(listing.Cursor)
+	if err != nil {
+		return models.JobListResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	if listing.Limit < 0 {
+		return models.JobListResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "limit must not be negative", nil)
+	}
+
+	filter := jobFilter{
+		statuses:   listing.Statuses,
+		query:      listing.Query,
+		externalID: listing.ExternalID,
+		caseID:     listing.CaseID,
+	}
+	page, err := jobPage(store.PageQuery{
+		After:  after,
+		Limit:  min(listing.Limit, maxJobsPage),
+		Newest: true,
+		Match:  filter.matcher(caller.key),
+	})
+	if err != nil {
+		return models.JobListResponse{}, jobsUnavailable(err)
+	}
+	return page, nil
+}
+
+// CancelJob cancels a job, as POST /jobs/:id/cancel does
+func (caller *Caller) CancelJob(jobID string) (*models.CrawlJob, *APIError) {
+	if err := caller.write(); err != nil {
+		return nil, err
+	}
+	return cancelJob(caller.key, jobID)
+}
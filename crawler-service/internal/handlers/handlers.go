@@ -1,57 +1,711 @@
 package handlers
 
 import (
+	"definitelynotaspy/crawler-service/internal/apikey"
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/compliance"
+	"definitelynotaspy/crawler-service/internal/contentfilter"
 	"definitelynotaspy/crawler-service/internal/crawler"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/frontier"
+	"definitelynotaspy/crawler-service/internal/httpauth"
+	"definitelynotaspy/crawler-service/internal/jobqueue"
 	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/phone"
+	"definitelynotaspy/crawler-service/internal/recipe"
+	"definitelynotaspy/crawler-service/internal/recon"
+	"definitelynotaspy/crawler-service/internal/revisit"
+	"definitelynotaspy/crawler-service/internal/search"
+	"definitelynotaspy/crawler-service/internal/secrets"
+	"definitelynotaspy/crawler-service/internal/store"
+	"definitelynotaspy/crawler-service/internal/urlkey"
+	"definitelynotaspy/crawler-service/internal/variants"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpguts"
 )
 
 var (
-	jobStore = make(map[string]*models.CrawlJob)
-	crawlerService = crawler.NewCrawlerService()
+	jobs           store.Store = store.NewMemory()
+	crawlerService *crawler.CrawlerService
+	queue          *jobqueue.Queue
 )
 
+// Services are what the handlers run jobs with. They read the environment
+// and connect to Redis when built, so main builds them once both are set
+// up.
+type Services struct {
+	Crawler    *crawler.CrawlerService
+	Queue      *jobqueue.Queue
+	Continuous *frontier.Store
+}
+
+// NewServicesFromEnv builds the services the environment configures
+func NewServicesFromEnv() Services {
+	return Services{
+		Crawler:    crawler.NewCrawlerService(),
+		Queue:      jobqueue.NewFromEnv(),
+		Continuous: frontier.NewStoreFromEnv(),
+	}
+}
+
+// Init hands the handlers their services. It must run before the job store
+// is opened and before the API serves requests.
+func Init(s Services) {
+	crawlerService = s.Crawler
+	queue = s.Queue
+	continuous = s.Continuous
+	if preemptionEnabled() {
+		queue.PreemptWith(preemptJob)
+	}
+}
+
+// InitJobStore switches to the storage driver selected by the environment.
+// It must run before the API serves requests. Read replicas open the
+// shared store read-only.
+func InitJobStore() error {
+	var s store.Store
+	var err error
+	if ReadReplica() {
+		s, err = store.OpenReplicaFromEnv()
+	} else {
+		s, err = store.NewFromEnv()
+	}
+	if err != nil {
+		return err
+	}
+
+	jobs = s
+	crawlerService.UseResultStore(s)
+	if !ReadReplica() {
+		// Stored content still counts against the tenant quotas
+		stored, err := s.List()
+		if err != nil {
+			return err
+		}
+		crawlerService.Quota().Rebuild(stored)
+	}
+	crawlerService.UseJobSaver(func(job *models.CrawlJob) {
+		// A job purged meanwhile is not brought back
+		if _, exists := jobs.Get(job.ID); exists {
+			saveJob(job)
+		}
+	})
+
+	log.WithField("driver", s.Driver()).Info("Job store ready")
+	return nil
+}
+
+// jobNamespace derives deterministic job IDs from tenant and external ID
+var jobNamespace = uuid.MustParse("6f1c9a52-8a0e-4c1b-9d3e-2f6b7c8d9e01")
+
+// jobIDFor returns the ID a job for req gets: derived from the external ID
+// when the client supplied one, random otherwise
+func jobIDFor(req models.CrawlRequest) string {
+	if req.ExternalID == "" {
+		return uuid.New().String()
+	}
+	return uuid.NewSHA1(jobNamespace, []byte(req.Tenant+"\x00"+req.ExternalID)).String()
+}
+
+// saveJob persists the current state of a job
+func saveJob(job *models.CrawlJob) {
+	if err := jobs.Put(job); err != nil {
+		log.WithError(err).WithField("job_id", job.ID).Error("Failed to save job")
+	}
+}
+
+// forgetJob removes a job from the store
+func forgetJob(job *models.CrawlJob) {
+	if err := jobs.Delete(job.ID); err != nil {
+		log.WithError(err).WithField("job_id", job.ID).Error("Failed to delete stored job")
+	}
+}
+
+// defaultTenant is used when a request does not name a tenant
+const defaultTenant = "default"
+
+// maxSeedURLs caps the seed_urls of a crawl request
+const maxSeedURLs = 1000
+
+// maxMonitorKeyLength caps the monitor_key of a crawl request
+const maxMonitorKeyLength = 128
+
+// Service returns the shared crawler service
+func Service() *crawler.CrawlerService {
+	return crawlerService
+}
+
 // HealthCheck returns the health status of the service
 func HealthCheck(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
-		"status":    "healthy",
-		"service":   "crawler",
-		"timestamp": time.Now().UTC(),
+	return c.JSON(models.HealthResponse{
+		Status:      "healthy",
+		Service:     "crawler",
+		Maintenance: inMaintenance(),
+		ReadReplica: ReadReplica(),
+		Timestamp:   time.Now().UTC(),
 	})
 }
 
 // StartCrawl initiates a new crawl job
 func StartCrawl(c *fiber.Ctx) error {
+	if inMaintenance() {
+		return rejectForMaintenance(c)
+	}
+
 	var req models.CrawlRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	resp, err := startCrawl(requestKey(c), req)
+	if err != nil {
+		return respondAPIError(c, err)
+	}
+	if resp.Deduplicated {
+		return c.JSON(resp)
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// startCrawl validates a crawl request made with key, nil when keys are not
+// required, and starts its job. An identical job already running is
+// returned instead, marked Deduplicated.
+func startCrawl(key *apikey.Key, req models.CrawlRequest) (models.JobResponse, *APIError) {
+	if req.Type == "" {
+		req.Type = models.JobTypeCrawl
+	}
+
+	var parent *models.CrawlJob
+	switch req.Type {
+	case models.JobTypeCrawl:
+		if _, err := crawlerService.SearchProviders().Get(req.SearchProvider); err != nil {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+		}
+		if req.SearchResults < 0 || req.SearchResults > search.MaxResults {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("search_results must be between 0 and %d", search.MaxResults), nil)
+		}
+		if len(req.SeedURLs) > 0 {
+			if req.Mode != "" {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "seed_urls is only available for web crawls", nil)
+			}
+			if len(req.SeedURLs) > maxSeedURLs {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("seed_urls holds at most %d URLs", maxSeedURLs), nil)
+			}
+			seeds := make([]string, 0, len(req.SeedURLs))
+			seen := make(map[string]bool, len(req.SeedURLs))
+			for i, raw := range req.SeedURLs {
+				seed, err := crawler.NormalizeSeedURL(raw)
+				if err != nil {
+					return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), fiber.Map{
+						"index": i,
+					})
+				}
+				if !seen[seed] {
+					seen[seed] = true
+					seeds = append(seeds, seed)
+				}
+			}
+			req.SeedURLs = seeds
+			if req.Query == "" {
+				req.Query = strings.Join(seeds, ", ")
+			}
+		}
+	case models.JobTypeReplay:
+		var exists bool
+		parent, exists = keyJob(key, req.ReplayOf)
+		if !exists {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "replay_of must reference an existing job", nil)
+		}
+		if parent.Status == "pending" || parent.Status == "running" {
+			return models.JobResponse{}, refuse(fiber.StatusConflict, errcode.Conflict, "Cannot replay a job that is still in progress", nil)
+		}
+		if req.Query == "" {
+			req.Query = parent.Query
+		}
+		if req.Tenant == "" {
+			req.Tenant = parent.Tenant
+		}
+	case models.JobTypeCTMonitor:
+		if len(req.DomainPatterns) == 0 {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "domain_patterns is required for ct_monitor jobs", nil)
+		}
+		if req.Query == "" {
+			req.Query = strings.Join(req.DomainPatterns, ", ")
+		}
+	case models.JobTypeUsername:
+		if !recon.ValidUsername(req.Username) {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "username must be 1-64 letters, digits, '.', '_' or '-'", nil)
+		}
+		if req.Query == "" {
+			req.Query = req.Username
+		}
+	case models.JobTypePageMonitor:
+		if u, err := url.Parse(req.Query); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "query must be the http(s) URL of the page to monitor", nil)
+		}
+		if req.WatchSelector == "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "watch_selector is required for page_monitor jobs", nil)
+		}
+		if err := crawler.ValidateSelector(req.WatchSelector); err != nil {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+		}
+		if req.MinChangeScore < 0 || req.MinChangeScore > 1 {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "min_change_score must be between 0 and 1", nil)
+		}
+	case models.JobTypeCodeSearch:
+		if _, err := crawlerService.CodeSearchProviders().Select(req.CodeSearchProviders); err != nil {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+		}
+	default:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Unknown job type", nil)
+	}
+	if len(req.SeedURLs) > 0 && req.Type != models.JobTypeCrawl {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "seed_urls is only available for crawl jobs", nil)
+	}
+
+	switch req.Mode {
+	case "":
+	case models.CrawlModeLinkCheck:
+		if req.Type != models.JobTypeCrawl {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "linkcheck mode is only available for crawl jobs", nil)
+		}
+		if u, err := url.Parse(req.Query); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "query must be the http(s) URL of the site to check", nil)
+		}
+	case models.CrawlModeAPI:
+		if req.Type != models.JobTypeCrawl {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "api mode is only available for crawl jobs", nil)
+		}
+		if u, err := url.Parse(req.Query); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "query must be the http(s) URL of the API endpoint", nil)
+		}
+		if err := crawler.ValidateAPIRules(req.API); err != nil {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+		}
+	default:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "mode must be linkcheck or api", nil)
+	}
+
+	if req.WarmStart && (req.Type != models.JobTypeCrawl || req.Mode != "") {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "warm_start is only available for crawl jobs", nil)
+	}
+	switch req.CrawlStrategy {
+	case "":
+	case models.CrawlStrategyBFS, models.CrawlStrategyDFS, models.CrawlStrategyFocused:
+		if req.Type != models.JobTypeCrawl || req.Mode != "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "crawl_strategy is only available for crawl jobs", nil)
+		}
+	default:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "crawl_strategy must be bfs, dfs or focused", nil)
+	}
+	switch {
+	case req.Monitor && (req.Type != models.JobTypeCrawl || req.Mode != ""):
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "monitor is only available for crawl jobs", nil)
+	case req.MonitorKey != "" && !req.Monitor:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "monitor_key requires monitor", nil)
+	case len(req.MonitorKey) > maxMonitorKeyLength:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("monitor_key must be at most %d characters", maxMonitorKeyLength), nil)
+	case req.Monitor && req.MonitorKey == "":
+		req.MonitorKey = revisit.DefaultKey(req.Query, req.SeedURLs)
+	}
+	switch {
+	case req.RetentionHours < 0:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "retention_hours must not be negative", nil)
+	case req.RetentionHours == 0:
+		req.RetentionHours = defaultRetentionHours()
+	}
+	switch req.Priority {
+	case "":
+		req.Priority = models.PriorityNormal
+	case models.PriorityHigh, models.PriorityNormal, models.PriorityLow:
+	default:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "priority must be high, normal or low", nil)
+	}
+
+	if err := bindAPIKey(key, &req); err != nil {
+		return models.JobResponse{}, err
+	}
+	if req.Tenant == "" {
+		req.Tenant = defaultTenant
 	}
 
 	// Validate request
 	if req.Query == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Query is required",
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Query or seed_urls is required", nil)
+	}
+
+	if err := crawlerService.ValidateProcessors(req.Processors); err != nil {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	if err := crawler.ValidateLinkPatterns(req); err != nil {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	if err := recipe.Validate(req.ExtractionRules, req.DomainExtractionRules); err != nil {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	for _, name := range req.Scripts {
+		_, ok, err := crawlerService.Scripts().Get(req.Tenant, name)
+		if err != nil {
+			log.WithError(err).Error("Failed to read extraction scripts")
+			return models.JobResponse{}, refuse(fiber.StatusServiceUnavailable, errcode.Unavailable, "Extraction scripts are currently unavailable", nil)
+		}
+		if !ok {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Unknown extraction script", fiber.Map{
+				"script": name,
+			})
+		}
+	}
+
+	for name, ref := range req.Secrets {
+		if err := crawlerService.Secrets().Validate(ref); err != nil {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), fiber.Map{
+				"secret": name,
+			})
+		}
+	}
+	for header, value := range req.Headers {
+		if name := undeclaredSecret(req, value); name != "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Header references an undeclared secret", fiber.Map{
+				"header": header,
+				"secret": name,
+			})
+		}
+	}
+	for domain, cred := range req.DomainCredentials {
+		if cred.Type != "" && cred.Type != httpauth.Basic && cred.Type != httpauth.Digest && cred.Type != httpauth.OAuth2 {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Credential type must be basic, digest or oauth2", fiber.Map{
+				"domain": domain,
+			})
+		}
+		if cred.Type == httpauth.OAuth2 {
+			if u, err := url.Parse(cred.TokenURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "OAuth2 credentials need an http or https token_url", fiber.Map{
+					"domain": domain,
+				})
+			}
+		}
+		if cred.Username == "" && (cred.Type != "" || cred.Password != "" || (len(cred.Headers) == 0 && len(cred.Cookies) == 0)) {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Credential username is required", fiber.Map{
+				"domain": domain,
+			})
+		}
+		for header := range cred.Headers {
+			if !httpguts.ValidHeaderFieldName(header) {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Credential header name is invalid", fiber.Map{
+					"domain": domain,
+					"header": header,
+				})
+			}
+		}
+		for cookie := range cred.Cookies {
+			if !httpguts.ValidHeaderFieldName(cookie) {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Credential cookie name is invalid", fiber.Map{
+					"domain": domain,
+					"cookie": cookie,
+				})
+			}
+		}
+		values := []string{cred.Username, cred.Password}
+		for _, value := range cred.Headers {
+			values = append(values, value)
+		}
+		for _, value := range cred.Cookies {
+			values = append(values, value)
+		}
+		for _, value := range values {
+			if name := undeclaredSecret(req, value); name != "" {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Credential references an undeclared secret", fiber.Map{
+					"domain": domain,
+					"secret": name,
+				})
+			}
+		}
+	}
+
+	for i, cc := range req.ClientCertificates {
+		if len(cc.Domains) == 0 || cc.Certificate == "" || cc.PrivateKey == "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Client certificates need domains, certificate and private_key", fiber.Map{
+				"index": i,
+			})
+		}
+		for _, value := range []string{cc.Certificate, cc.PrivateKey} {
+			if name := undeclaredSecret(req, value); name != "" {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Client certificate references an undeclared secret", fiber.Map{
+					"index":  i,
+					"secret": name,
+				})
+			}
+		}
+	}
+
+	for i, spec := range req.Outputs {
+		if err := crawlerService.ValidateOutput(spec); err != nil {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), fiber.Map{
+				"index": i,
+			})
+		}
+	}
+
+	if req.CallbackURL != "" {
+		if u, err := url.Parse(req.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "callback_url must be an http or https url", nil)
+		}
+	}
+
+	for i, hook := range req.Webhooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Webhooks need an http or https url", fiber.Map{
+				"index": i,
+			})
+		}
+		for _, t := range hook.Events {
+			if t != events.PageCrawled && t != events.JobFinished {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Webhook events must be page.crawled or job.finished", fiber.Map{
+					"index": i,
+				})
+			}
+		}
+		if hook.BatchSize < 0 || hook.BatchSeconds < 0 || hook.MinQuality < 0 || hook.MinQuality > 1 {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Webhook batch_size and batch_seconds must not be negative and min_quality must be between 0 and 1", fiber.Map{
+				"index": i,
+			})
+		}
+		if name := undeclaredSecret(req, hook.Secret); name != "" {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Webhook secret references an undeclared secret", fiber.Map{
+				"index":  i,
+				"secret": name,
+			})
+		}
+	}
+
+	if err := urlkey.Validate(req.QueryParams); err != nil {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	switch req.DedupeScope {
+	case "", models.DedupeScopeJob, models.DedupeScopeGlobal:
+	default:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "dedupe_scope must be job or global", nil)
+	}
+
+	switch req.PreferVariant {
+	case "", variants.KindAMP, variants.KindPrint:
+	default:
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "prefer_variant must be amp or print", nil)
+	}
+
+	if req.MinQuality < 0 || req.MinQuality > 1 {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "min_quality must be between 0 and 1", nil)
+	}
+	if req.Filters != nil {
+		if _, err := contentfilter.New(req.Filters); err != nil {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+		}
+	}
+
+	if _, err := crawlerService.BrowserProfiles().Select(req.BrowserProfiles); err != nil {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	if len(req.ExcludeCategories) > 0 {
+		known := crawlerService.Policies().Current().CategorySizes
+		for _, category := range req.ExcludeCategories {
+			if _, ok := known[category]; !ok {
+				return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Unknown category: "+category, fiber.Map{
+					"categories": crawlerService.Policies().Current().CategoryNames(),
+				})
+			}
+		}
+	}
+
+	if req.PhoneRegion != "" {
+		if !phone.Known(req.PhoneRegion) {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Unknown phone_region", fiber.Map{
+				"phone_region": req.PhoneRegion,
+			})
+		}
+		req.PhoneRegion = strings.ToUpper(req.PhoneRegion)
+	}
+
+	if req.CheckBreaches && !crawlerService.BreachLookupEnabled() {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Breach lookups are not configured", nil)
+	}
+
+	if req.TimestampHTML && !req.CaptureHTML {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "timestamp_html needs capture_html", nil)
+	}
+	if req.TimestampHTML && !crawlerService.TimestampingEnabled() {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Trusted timestamping is not configured", nil)
+	}
+
+	if req.ReverseImageSearch && !crawlerService.ReverseImageSearchEnabled() {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Reverse image search is not configured", nil)
+	}
+
+	if req.RenderJS && !crawlerService.RenderingEnabled() {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "JS rendering is not configured", nil)
+	}
+	if req.CaptureScreenshot && !crawlerService.RenderingEnabled() {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "capture_screenshot needs JS rendering, which is not configured", nil)
+	}
+	if req.Emulation != nil && !req.RenderJS && !req.CaptureScreenshot {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "emulation needs render_js or capture_screenshot", nil)
+	}
+	if err := crawler.ValidateEmulation(req.Emulation); err != nil {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	profile, err := crawlerService.Compliance().Get(req.ComplianceProfile)
+	if err != nil {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	if violations := compliance.Violations(profile, req); len(violations) > 0 {
+		return models.JobResponse{}, refuse(fiber.StatusForbidden, errcode.ComplianceDenied, "Request violates the compliance profile", fiber.Map{
+			"compliance_profile": profile.Name,
+			"violations":         violations,
 		})
 	}
+	req.ComplianceProfile = profile.Name
+
+	if req.Region != "" {
+		if !crawlerService.Regions().Has(req.Region) {
+			return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Unknown region", fiber.Map{
+				"region":  req.Region,
+				"regions": crawlerService.Regions().Names(),
+			})
+		}
+		req.Region = strings.ToLower(req.Region)
+	} else if len(req.SeedURLs) > 0 {
+		req.Region = crawlerService.Regions().ForURL(req.SeedURLs[0])
+	} else {
+		req.Region = crawlerService.Regions().ForURL(req.Query)
+	}
 
 	if req.MaxPages <= 0 {
-		req.MaxPages = 50
+		req.MaxPages = defaultMaxPages
 	}
 
 	if req.MaxDepth <= 0 {
-		req.MaxDepth = 2
+		req.MaxDepth = defaultMaxDepth
+	}
+
+	if limit := crawlLimit("CRAWL_MAX_PAGES"); limit > 0 && req.MaxPages > limit {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("max_pages must not exceed %d", limit), nil)
+	}
+	if limit := crawlLimit("CRAWL_MAX_DEPTH"); limit > 0 && req.MaxDepth > limit {
+		return models.JobResponse{}, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("max_depth must not exceed %d", limit), nil)
+	}
+
+	if crawlerService.Quota().TenantExceeded(req.Tenant) {
+		return models.JobResponse{}, refuse(fiber.StatusInsufficientStorage, errcode.QuotaExceeded, "Tenant storage quota exceeded", fiber.Map{
+			"tenant": req.Tenant,
+		})
+	}
+	exceeded, err := budgetExceeded(req.Tenant)
+	if err != nil {
+		return models.JobResponse{}, jobsUnavailable(err)
+	}
+	if len(exceeded) > 0 {
+		return models.JobResponse{}, refuse(fiber.StatusPaymentRequired, errcode.BudgetExhausted, "Tenant monthly budget exhausted", fiber.Map{
+			"tenant":   req.Tenant,
+			"exceeded": exceeded,
+		})
+	}
+
+	if req.ExternalID != "" {
+		if existing, exists := jobs.Get(jobIDFor(req)); exists {
+			return models.JobResponse{}, refuse(fiber.StatusConflict, errcode.Conflict, "A job with this external_id already exists", fiber.Map{
+				"job_id":      existing.ID,
+				"external_id": req.ExternalID,
+			})
+		}
+	}
+
+	if window := dedupeWindow(req); window > 0 {
+		dedupeMu.Lock()
+		defer dedupeMu.Unlock()
+		existing, err := runningDuplicate(req, window)
+		if err != nil {
+			return models.JobResponse{}, jobsUnavailable(err)
+		}
+		if existing != nil {
+			log.WithFields(log.Fields{
+				"job_id": existing.ID,
+				"tenant": req.Tenant,
+				"query":  req.Query,
+			}).Info("Identical crawl already running, returning it")
+			return models.JobResponse{
+				JobID:        existing.ID,
+				Status:       existing.Status,
+				Message:      "An identical job is already running",
+				Deduplicated: true,
+				Job:          existing,
+			}, nil
+		}
+	}
+
+	// Warm starts add the prior crawl's best pages to the search results;
+	// content it already collected is marked as previously seen
+	if req.WarmStart {
+		prior, err := priorCrawl(req)
+		if err != nil {
+			return models.JobResponse{}, jobsUnavailable(err)
+		}
+		if prior != nil {
+			req.WarmStartOf = prior.ID
+			req.WarmSeeds = warmSeeds(prior)
+			req.SkipPreviouslySeen = true
+		}
 	}
 
-	// Create job
-	jobID := uuid.New().String()
+	job := launchJob(req, parent)
+	jobID := job.ID
+
+	log.WithFields(log.Fields{
+		"job_id":    jobID,
+		"query":     req.Query,
+		"max_pages": req.MaxPages,
+	}).Info("Crawl job started")
+
+	return models.JobResponse{
+		JobID:       jobID,
+		Status:      "pending",
+		Message:     "Crawl job created successfully",
+		WarmStartOf: req.WarmStartOf,
+		Seeds:       len(req.WarmSeeds),
+		Job:         job,
+	}, nil
+}
+
+// launchJob creates and stores a job for a validated request and queues it
+// to run in the background once a worker is free
+func launchJob(req models.CrawlRequest, parent *models.CrawlJob) *models.CrawlJob {
+	jobID := jobIDFor(req)
 	job := &models.CrawlJob{
 		ID:           jobID,
+		Tenant:       req.Tenant,
+		ExternalID:   req.ExternalID,
+		CaseID:       req.CaseID,
+		Type:         req.Type,
+		Mode:         req.Mode,
+		ReplayOf:     req.ReplayOf,
+		FollowUpOf:   req.FollowUpOf,
+		ContinueOf:   req.ContinueOf,
+		WarmStartOf:  req.WarmStartOf,
+		Region:       req.Region,
+		Processors:   req.Processors,
+		Secrets:      secretNames(req.Secrets),
+		Priority:     req.Priority,
 		Query:        req.Query,
 		Status:       "pending",
 		MaxPages:     req.MaxPages,
@@ -59,45 +713,94 @@ func StartCrawl(c *fiber.Ctx) error {
 		PagesCrawled: 0,
 		URLsFound:    0,
 		StartedAt:    time.Now().UTC(),
+		Options:      &req,
 	}
 
-	jobStore[jobID] = job
+	// Record the constraints the job runs under; a profile removed from the
+	// configuration since the request was accepted falls back to strict
+	profile, err := crawlerService.Compliance().Get(req.ComplianceProfile)
+	if err != nil {
+		profile, _ = crawlerService.Compliance().Get(compliance.Strict)
+	}
+	job.Compliance = &profile
+	job.APIKey = req.APIKeyID
+	job.Continuous = req.Continuous
+	job.RetentionHours = req.RetentionHours
+	if req.CallbackURL != "" {
+		job.Callback = &models.CallbackDelivery{URL: req.CallbackURL, Status: models.OutputPending}
+	}
 
-	// Start crawl asynchronously
-	go func() {
-		if err := crawlerService.StartCrawl(job, req); err != nil {
-			log.WithError(err).WithField("job_id", jobID).Error("Crawl failed")
-			job.Status = "failed"
-			job.Error = err.Error()
-			job.CompletedAt = time.Now().UTC()
+	saveJob(job)
+
+	work := func() {
+		// A job cancelled or deleted while it waited is not started
+		if job.Status != "pending" || job.DeletedAt != nil {
+			return
 		}
-	}()
 
-	log.WithFields(log.Fields{
-		"job_id":    jobID,
-		"query":     req.Query,
-		"max_pages": req.MaxPages,
-	}).Info("Crawl job started")
+		run := func() error { return crawlerService.StartCrawl(job, req) }
+		if crawlerService.Distributed() {
+			run = func() error { return crawlerService.CrawlDistributed(job, req) }
+		}
+		switch req.Mode {
+		case models.CrawlModeLinkCheck:
+			run = func() error { return crawlerService.CheckLinks(job, req) }
+		case models.CrawlModeAPI:
+			run = func() error { return crawlerService.CrawlAPI(job, req) }
+		}
+		switch req.Type {
+		case models.JobTypeReplay:
+			run = func() error { return crawlerService.Replay(job, parent) }
+		case models.JobTypeCodeSearch:
+			run = func() error { return crawlerService.SearchCode(job, req) }
+		case models.JobTypeCTMonitor:
+			run = func() error { return crawlerService.MonitorCertificates(job, req) }
+		case models.JobTypeUsername:
+			run = func() error { return crawlerService.ReconUsername(job, req) }
+		case models.JobTypePageMonitor:
+			run = func() error { return crawlerService.MonitorPage(job, req) }
+		}
+		// The crawler marks the job failed itself, keeping partial results
+		if err := run(); err != nil {
+			log.WithError(err).WithField("job_id", jobID).Debug("Crawl returned error")
+		}
+		if job.Status == "paused" {
+			requeuePaused(job)
+			return
+		}
+		saveJob(job)
+	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"job_id":  jobID,
-		"status":  "pending",
-		"message": "Crawl job created successfully",
-		"job":     job,
-	})
+	// Monitors run until cancelled, so they do not take up a worker
+	if req.Type == models.JobTypeCTMonitor || req.Type == models.JobTypePageMonitor {
+		go work()
+		return job
+	}
+	if _, err := queue.Submit(queuedJob(job, req, work)); err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		job.ErrorCode = errcode.Maintenance
+		job.CompletedAt = time.Now().UTC()
+		saveJob(job)
+	}
+
+	return job
 }
 
 // GetCrawlStatus returns the status of a specific crawl job
 func GetCrawlStatus(c *fiber.Ctx) error {
 	jobID := c.Params("id")
-	
-	job, exists := jobStore[jobID]
+
+	job, exists := findJob(c, jobID)
 	if !exists {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Job not found",
-		})
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
 	}
 
+	return c.JSON(jobStatus(job))
+}
+
+// jobStatus reports the progress of a job
+func jobStatus(job *models.CrawlJob) models.StatusResponse {
 	progress := 0.0
 	if job.MaxPages > 0 {
 		progress = float64(job.PagesCrawled) / float64(job.MaxPages) * 100
@@ -106,55 +809,384 @@ func GetCrawlStatus(c *fiber.Ctx) error {
 		}
 	}
 
-	return c.JSON(fiber.Map{
-		"job_id":        job.ID,
-		"status":        job.Status,
-		"pages_crawled": job.PagesCrawled,
-		"urls_found":    job.URLsFound,
-		"progress":      progress,
-		"started_at":    job.StartedAt,
-		"completed_at":  job.CompletedAt,
-		"error":         job.Error,
-	})
+	return models.StatusResponse{
+		JobID:         job.ID,
+		ExternalID:    job.ExternalID,
+		CaseID:        job.CaseID,
+		Status:        job.Status,
+		QueuePosition: queue.Position(job.ID),
+		Priority:      job.Priority,
+		Preemptions:   job.Preemptions,
+		Region:        job.Region,
+		PagesCrawled:  job.PagesCrawled,
+		URLsFound:     job.URLsFound,
+		Progress:      progress,
+		StartedAt:     job.StartedAt,
+		CompletedAt:   job.CompletedAt,
+		Error:         job.Error,
+		ErrorCode:     job.ErrorCode,
+		ErrorCounts:   job.ErrorCounts,
+		Partial:       job.Partial,
+		StorageBytes:  job.StorageBytes,
+		QuotaStatus:   job.QuotaStatus,
+		Countries:     job.CountryCounts,
+		LowQuality:    job.LowQualityPages,
+		Soft404:       job.Soft404Pages,
+		NeedsRender:   job.RenderCandidates,
+		Rendered:      job.PagesRendered,
+		DuplicateURLs: job.DuplicateURLs,
+		Duplicates:    job.DuplicatePages,
+		Unchanged:     job.PagesUnchanged,
+		Filtered:      job.FilteredPages,
+		RobotsBlocked: job.RobotsBlocked,
+		Cost:          crawlerService.JobCost(job),
+		ParkedDomains: job.ParkedDomains,
+		LinkedDomains: linkedDomainReport(job, topLinkedDomains),
+		Compliance:    job.Compliance,
+		Outputs:       job.Outputs,
+		Callback:      job.Callback,
+		ResponseTimes: job.ResponseTimes,
+		Parallelism:   job.Parallelism,
+		Retries:       job.Retries,
+		FailedURLs:    job.FailedURLs,
+		DeletedAt:     job.DeletedAt,
+
+		ExpiresAt:        jobExpiry(job),
+		ResultsDeletedAt: job.ResultsDeletedAt,
+	}
 }
 
-// ListJobs returns all crawl jobs
+// maxJobsPage caps the page size of job listings
+const maxJobsPage = 500
+
+// ListJobs lists crawl jobs by creation time, newest first or, with
+// order=asc, oldest first. With limit, jobs are returned a page at a time
+// and next_cursor fetches the following page; ties in creation time are
+// broken by ID, so pages neither skip nor repeat jobs. sort=pages_crawled
+// orders them by pages crawled instead, and page numbers pages (from 1)
+// in place of cursors. Jobs can be filtered by status (comma-separated),
+// query (a case-insensitive substring) and start time (started_after,
+// started_before). Soft-deleted jobs are only listed with
+// include_deleted=true. Keys bound to a tenant only list the tenant's
+// jobs. Listed jobs omit their results, which the results and export
+// endpoints serve.
 func ListJobs(c *fiber.Ctx) error {
-	jobs := make([]*models.CrawlJob, 0, len(jobStore))
-	for _, job := range jobStore {
-		jobs = append(jobs, job)
+	after, err := store.ParseCursor(c.Query("cursor"))
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	limit := c.QueryInt("limit")
+	if limit < 0 {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "limit must not be negative", nil)
+	}
+	if limit > maxJobsPage {
+		limit = maxJobsPage
+	}
+	order := c.Query("order", "desc")
+	if order != "asc" && order != "desc" {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "order must be asc or desc", nil)
+	}
+	sortBy := c.Query("sort", sortStartedAt)
+	if sortBy != sortStartedAt && sortBy != sortPagesCrawled {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "sort must be started_at or pages_crawled", nil)
+	}
+	pageNum := c.QueryInt("page")
+	if pageNum < 0 {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "page must not be negative", nil)
+	}
+	byPage := pageNum > 0 || sortBy != sortStartedAt
+	if byPage && !after.IsZero() {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "cursor cannot be combined with page or sort=pages_crawled", nil)
 	}
 
-	return c.JSON(fiber.Map{
-		"total": len(jobs),
-		"jobs":  jobs,
+	var startedAfter, startedBefore time.Time
+	for _, bound := range []struct {
+		param string
+		value *time.Time
+	}{{"started_after", &startedAfter}, {"started_before", &startedBefore}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, err := parseTimeBound(raw)
+		if err != nil {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, bound.param+" must be an RFC 3339 time or a YYYY-MM-DD date", fiber.Map{
+				bound.param: raw,
+			})
+		}
+		*bound.value = t
+	}
+
+	filter := jobFilter{
+		query:          c.Query("query"),
+		externalID:     c.Query("external_id"),
+		caseID:         c.Query("case_id"),
+		startedAfter:   startedAfter,
+		startedBefore:  startedBefore,
+		includeDeleted: c.QueryBool("include_deleted"),
+	}
+	if raw := c.Query("status"); raw != "" {
+		filter.statuses = strings.Split(raw, ",")
+	}
+	q := store.PageQuery{
+		After:  after,
+		Limit:  limit,
+		Newest: order == "desc",
+		Match:  filter.matcher(requestKey(c)),
+	}
+
+	if !byPage {
+		page, err := jobPage(q)
+		if err != nil {
+			return respondAPIError(c, jobsUnavailable(err))
+		}
+		return c.JSON(page)
+	}
+
+	// Numbered pages are cut from every matching job, in creation order
+	// and then, stably, by pages crawled
+	q.Limit = 0
+	listed, err := jobs.ListPage(q)
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+	matched := listed.Jobs
+	if sortBy == sortPagesCrawled {
+		sort.SliceStable(matched, func(i, j int) bool {
+			if order == "asc" {
+				return matched[i].PagesCrawled < matched[j].PagesCrawled
+			}
+			return matched[i].PagesCrawled > matched[j].PagesCrawled
+		})
+	}
+	if pageNum == 0 {
+		pageNum = 1
+	}
+	page := matched
+	if limit > 0 {
+		from := (pageNum - 1) * limit
+		if from > len(matched) {
+			from = len(matched)
+		}
+		page = matched[from:]
+		if len(page) > limit {
+			page = page[:limit]
+		}
+	} else if pageNum > 1 {
+		page = nil
+	}
+	return c.JSON(models.JobListResponse{
+		Total: len(matched),
+		Jobs:  withoutResults(page),
+		Page:  pageNum,
 	})
 }
 
+// jobFilter selects the jobs a listing returns
+type jobFilter struct {
+	statuses                    []string
+	query                       string
+	externalID, caseID          string
+	startedAfter, startedBefore time.Time
+	includeDeleted              bool
+}
+
+// matcher returns whether a job passes the filter and may be seen with
+// key. query matches a case-insensitive substring of the job's query.
+func (f jobFilter) matcher(key *apikey.Key) func(*models.CrawlJob) bool {
+	var statuses map[string]bool
+	if len(f.statuses) > 0 {
+		statuses = make(map[string]bool)
+		for _, status := range f.statuses {
+			statuses[strings.TrimSpace(status)] = true
+		}
+	}
+	query := strings.ToLower(f.query)
+	return func(job *models.CrawlJob) bool {
+		return keyAllowsTenant(key, job.Tenant) &&
+			(f.externalID == "" || job.ExternalID == f.externalID) &&
+			(f.caseID == "" || job.CaseID == f.caseID) &&
+			(statuses == nil || statuses[job.Status]) &&
+			(query == "" || strings.Contains(strings.ToLower(job.Query), query)) &&
+			(f.startedAfter.IsZero() || !job.StartedAt.Before(f.startedAfter)) &&
+			(f.startedBefore.IsZero() || job.StartedAt.Before(f.startedBefore)) &&
+			(job.DeletedAt == nil || f.includeDeleted)
+	}
+}
+
+// jobPage lists a page of jobs by creation time
+func jobPage(q store.PageQuery) (models.JobListResponse, error) {
+	page, err := jobs.ListPage(q)
+	if err != nil {
+		return models.JobListResponse{}, err
+	}
+	return models.JobListResponse{
+		Total:      page.Total,
+		Jobs:       withoutResults(page.Jobs),
+		NextCursor: page.Next.String(),
+	}, nil
+}
+
+// jobsUnavailable refuses a request the job store failed to serve
+func jobsUnavailable(err error) *APIError {
+	log.WithError(err).Error("Failed to read the job store")
+	return refuse(fiber.StatusServiceUnavailable, errcode.Unavailable, "Jobs are currently unavailable", nil)
+}
+
+// Job listing sort orders
+const (
+	sortStartedAt    = "started_at"
+	sortPagesCrawled = "pages_crawled"
+)
+
+// parseTimeBound reads an RFC 3339 time or a date, taken as midnight UTC
+func parseTimeBound(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
+// withoutResults returns copies of jobs without their results, for
+// listings
+func withoutResults(list []*models.CrawlJob) []*models.CrawlJob {
+	out := make([]*models.CrawlJob, len(list))
+	for i, job := range list {
+		listed := *job
+		listed.Results = nil
+		out[i] = &listed
+	}
+	return out
+}
+
 // CancelJob cancels a running crawl job
 func CancelJob(c *fiber.Ctx) error {
-	jobID := c.Params("id")
-	
-	job, exists := jobStore[jobID]
+	job, err := cancelJob(requestKey(c), c.Params("id"))
+	if err != nil {
+		return respondAPIError(c, err)
+	}
+
+	return c.JSON(models.MessageResponse{
+		JobID:   job.ID,
+		Message: "Job cancelled successfully",
+	})
+}
+
+// cancelJob cancels a job a call made with key may see
+func cancelJob(key *apikey.Key, jobID string) (*models.CrawlJob, *APIError) {
+	job, exists := keyJob(key, jobID)
 	if !exists {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Job not found",
-		})
+		return nil, refuse(fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
 	}
 
 	if job.Status == "completed" || job.Status == "failed" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot cancel a completed or failed job",
-		})
+		return nil, refuse(fiber.StatusBadRequest, errcode.InvalidRequest, "Cannot cancel a completed or failed job", nil)
 	}
 
-	job.Status = "cancelled"
-	job.CompletedAt = time.Now().UTC()
+	// A running crawl is stopped and marks itself cancelled with the results
+	// it collected; other jobs (queued, monitors) see the status and stop
+	queue.Remove(job.ID)
+	if !crawlerService.Cancel(job) {
+		job.Status = "cancelled"
+		job.CompletedAt = time.Now().UTC()
+		saveJob(job)
+	}
 
 	log.WithField("job_id", jobID).Info("Crawl job cancelled")
+	return job, nil
+}
+
+// DeleteJobV1 answers DELETE /jobs/:id under API v1, which cancels the job
+// as it always has there. Jobs are deleted with DELETE under v2.
+func DeleteJobV1(c *fiber.Ctx) error {
+	return CancelJob(c)
+}
+
+// DeleteJob deletes a crawl job, stopping it first if it is still running.
+// By default the job is soft-deleted: it is hidden from listings but keeps
+// its results. With purge=true the job and every stored artifact (results,
+// offloaded results, archived pages, content-index entries) are removed for
+// good. Both are recorded in the audit log. It serves DELETE /jobs/:id from
+// API v2 on.
+func DeleteJob(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	record := audit.Record{
+		Tenant: job.Tenant,
+		JobID:  job.ID,
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"external_id": job.ExternalID,
+			"case_id":     job.CaseID,
+			"reason":      c.Query("reason"),
+		},
+	}
 
-	return c.JSON(fiber.Map{
-		"message": "Job cancelled successfully",
-		"job_id":  jobID,
+	queue.Remove(job.ID)
+	if !c.QueryBool("purge") {
+		crawlerService.Halt(job)
+		if job.DeletedAt == nil {
+			now := time.Now().UTC()
+			job.DeletedAt = &now
+		}
+		saveJob(job)
+
+		record.Action = "job.soft_delete"
+		crawlerService.Audit().Append(record)
+
+		return c.JSON(models.DeleteResponse{
+			JobID:     jobID,
+			Message:   "Job deleted",
+			DeletedAt: job.DeletedAt,
+		})
+	}
+
+	report, err := crawlerService.PurgeJob(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to purge job")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, err.Error(), nil)
+	}
+	forgetJob(job)
+
+	record.Action = "job.purge"
+	record.Details["results"] = report.Results
+	record.Details["index_entries"] = report.IndexEntries
+	record.Details["bytes_released"] = report.BytesReleased
+	crawlerService.Audit().Append(record)
+
+	return c.JSON(models.DeleteResponse{
+		JobID:   jobID,
+		Message: "Job purged",
+		Purged:  true,
+		Removed: &report,
 	})
 }
+
+// secretNames returns the sorted logical names of a job's secrets
+func secretNames(refs map[string]string) []string {
+	if len(refs) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// undeclaredSecret returns the first ${secret:name} placeholder in value
+// that the request does not declare, or ""
+func undeclaredSecret(req models.CrawlRequest, value string) string {
+	for _, name := range secrets.Placeholders(value) {
+		if _, ok := req.Secrets[name]; !ok {
+			return name
+		}
+	}
+	return ""
+}
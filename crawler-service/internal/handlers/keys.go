@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/keyring"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetTenantKeys lists the versions of a tenant's data keys and the master
+// keys wrapping them, without key material
+func GetTenantKeys(c *fiber.Ctx) error {
+	keys := crawlerService.Keyring()
+	if keys == nil {
+		return respondError(c, fiber.StatusNotImplemented, errcode.NotImplemented, "Encryption at rest is not configured", nil)
+	}
+
+	status, err := keys.Status(c.Params("id"))
+	if err != nil {
+		log.WithError(err).WithField("tenant", c.Params("id")).Error("Failed to read tenant keys")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Tenant keys are currently unavailable", nil)
+	}
+	if status == nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Tenant has no data key yet", nil)
+	}
+	return c.JSON(tenantKeys(status, keys.MasterKeyID(), ""))
+}
+
+// RotateTenantKey starts a new data key for a tenant's new data and
+// re-wraps its existing data keys with the current master key. Stored
+// content is not re-encrypted.
+func RotateTenantKey(c *fiber.Ctx) error {
+	keys := crawlerService.Keyring()
+	if keys == nil {
+		return respondError(c, fiber.StatusNotImplemented, errcode.NotImplemented, "Encryption at rest is not configured", nil)
+	}
+
+	tenant := c.Params("id")
+	status, err := keys.Rotate(tenant)
+	if err != nil {
+		log.WithError(err).WithField("tenant", tenant).Error("Failed to rotate tenant key")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to rotate tenant key", fiber.Map{
+			"reason": err.Error(),
+		})
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "tenant.rotate_key",
+		Tenant: tenant,
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"version":    status.Current,
+			"rewrapped":  len(status.Keys) - 1,
+			"master_key": keys.MasterKeyID(),
+		},
+	})
+
+	return c.JSON(tenantKeys(status, keys.MasterKeyID(), "Tenant key rotated"))
+}
+
+// tenantKeys describes a tenant's key versions
+func tenantKeys(status *keyring.TenantKeys, masterKey, message string) models.TenantKeysResponse {
+	resp := models.TenantKeysResponse{
+		Message:   message,
+		Tenant:    status.Tenant,
+		Current:   status.Current,
+		Keys:      make([]models.DataKeyVersion, len(status.Keys)),
+		MasterKey: masterKey,
+	}
+	for i, key := range status.Keys {
+		resp.Keys[i] = models.DataKeyVersion{
+			Version:   key.Version,
+			MasterKey: key.MasterKey,
+			CreatedAt: key.CreatedAt,
+			WrappedAt: key.WrappedAt,
+		}
+	}
+	return resp
+}
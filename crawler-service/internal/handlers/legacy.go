@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// legacyJobPrefix is where job routes were before they moved under /jobs
+const legacyJobPrefix = "/job/"
+
+// LegacyJobRoutes serves the job routes at their former /job/:id paths,
+// which older clients and links handed out before still use. The path is
+// rewritten to /jobs/:id before routing, and the response is marked
+// deprecated with a Link to the new path. /job/:id/graph, the graph
+// export, is now /jobs/:id/graph/export.
+func LegacyJobRoutes(c *fiber.Ctx) error {
+	prefix := "/api/" + apiVersion(c)
+	rest := strings.TrimPrefix(c.Path(), prefix)
+	if !strings.HasPrefix(rest, legacyJobPrefix) {
+		return c.Next()
+	}
+
+	path := prefix + "/jobs/" + strings.TrimPrefix(rest, legacyJobPrefix)
+	if parts := strings.Split(strings.Trim(rest, "/"), "/"); len(parts) == 3 && parts[2] == "graph" {
+		path += "/export"
+	}
+	c.Set("Deprecation", "true")
+	c.Set(fiber.HeaderLink, "<"+path+`>; rel="successor-version"`)
+	c.Path(path)
+	return c.Next()
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetJobBrokenLinks returns the broken link report of a linkcheck crawl as
+// JSON or, with format=csv, as a CSV file with one row per referring page
+func GetJobBrokenLinks(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	if job.Mode != models.CrawlModeLinkCheck {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Broken links are reported by linkcheck crawls", nil)
+	}
+	if job.LinkCheck == nil {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Broken links are reported when the link check finishes", fiber.Map{
+			"status": job.Status,
+		})
+	}
+
+	if c.Query("format") == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s-broken-links.csv"`, job.ID))
+
+		w := csv.NewWriter(c.Response().BodyWriter())
+		w.Write([]string{"url", "status", "error", "external", "referring_page", "anchor_text"})
+		for _, link := range job.LinkCheck.Broken {
+			status := ""
+			if link.StatusCode > 0 {
+				status = strconv.Itoa(link.StatusCode)
+			}
+			row := []string{link.URL, status, link.Error, strconv.FormatBool(link.External)}
+			if len(link.Referrers) == 0 {
+				w.Write(append(row, "", ""))
+			}
+			for _, ref := range link.Referrers {
+				w.Write(append(row, ref.Page, ref.AnchorText))
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	return c.JSON(fiber.Map{
+		"job_id": job.ID,
+		"status": job.Status,
+		"report": job.LinkCheck,
+	})
+}
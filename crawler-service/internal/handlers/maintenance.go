@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// maintenanceRetryAfter is the Retry-After sent with rejected submissions
+const maintenanceRetryAfter = "60"
+
+// maintenance is the drain state of this instance during a rolling deploy
+var maintenance struct {
+	sync.Mutex
+	enabled      bool
+	since        time.Time
+	reason       string
+	checkpointed []string
+}
+
+// maintenanceRequest turns maintenance mode on or off
+type maintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+	// Checkpoint stops running crawls when maintenance starts (default
+	// true); they keep their results and can be continued afterwards
+	Checkpoint *bool `json:"checkpoint,omitempty"`
+}
+
+// inMaintenance reports whether new submissions are being rejected
+func inMaintenance() bool {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+	return maintenance.enabled
+}
+
+// rejectForMaintenance answers a submission with 503 while in maintenance
+func rejectForMaintenance(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderRetryAfter, maintenanceRetryAfter)
+	return respondAPIError(c, maintenanceRefusal())
+}
+
+// maintenanceRefusal is the error submissions are refused with while in
+// maintenance
+func maintenanceRefusal() *APIError {
+	maintenance.Lock()
+	reason := maintenance.reason
+	maintenance.Unlock()
+
+	return refuse(fiber.StatusServiceUnavailable, errcode.Maintenance, "Service is in maintenance mode, not accepting new jobs", fiber.Map{
+		"reason": reason,
+	})
+}
+
+// SetMaintenance turns maintenance mode on or off. While it is on, new job
+// submissions are rejected with 503; turning it on also checkpoints running
+// crawls unless checkpoint is false.
+func SetMaintenance(c *fiber.Ctx) error {
+	var req maintenanceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	maintenance.Lock()
+	wasEnabled := maintenance.enabled
+	maintenance.enabled = req.Enabled
+	maintenance.reason = req.Reason
+	if req.Enabled && !wasEnabled {
+		maintenance.since = time.Now().UTC()
+		maintenance.checkpointed = nil
+	}
+	if !req.Enabled {
+		maintenance.since = time.Time{}
+		maintenance.checkpointed = nil
+	}
+	maintenance.Unlock()
+
+	if req.Enabled && (req.Checkpoint == nil || *req.Checkpoint) {
+		ids := crawlerService.Checkpoint()
+		maintenance.Lock()
+		maintenance.checkpointed = append(maintenance.checkpointed, ids...)
+		maintenance.Unlock()
+	}
+
+	log.WithFields(log.Fields{
+		"enabled": req.Enabled,
+		"reason":  req.Reason,
+	}).Warn("Maintenance mode changed")
+
+	return GetMaintenance(c)
+}
+
+// GetMaintenance reports whether maintenance mode is on, the crawls still
+// running or queued and the jobs checkpointed when it started
+func GetMaintenance(c *fiber.Ctx) error {
+	queued, _, _ := queue.Stats()
+	maintenance.Lock()
+	status := fiber.Map{
+		"enabled":      maintenance.enabled,
+		"reason":       maintenance.reason,
+		"running_jobs": crawlerService.Running(),
+		"queued_jobs":  queued,
+		"checkpointed": append([]string{}, maintenance.checkpointed...),
+	}
+	if maintenance.enabled {
+		status["since"] = maintenance.since
+	}
+	maintenance.Unlock()
+
+	return c.JSON(status)
+}
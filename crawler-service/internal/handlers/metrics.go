@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_http_requests_total",
+		Help: "API requests served, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	httpLatency = promauto.With(metrics.Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crawler_http_request_duration_seconds",
+		Help:    "Time taken to serve API requests, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	promauto.With(metrics.Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "crawler_active_jobs",
+		Help: "Jobs running now.",
+	}, func() float64 {
+		_, running, _ := queue.Stats()
+		return float64(running)
+	})
+	promauto.With(metrics.Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "crawler_queue_depth",
+		Help: "Jobs waiting for a worker.",
+	}, func() float64 {
+		queued, _, _ := queue.Stats()
+		return float64(queued)
+	})
+}
+
+// GetMetrics serves the service's metrics in the Prometheus text or
+// OpenMetrics format, as the scraper asks
+var GetMetrics = adaptor.HTTPHandler(metrics.Handler())
+
+// InstrumentRequests counts API requests and times them. Requests are
+// labelled by the route they matched, not their path, so job IDs do not
+// become series of their own.
+func InstrumentRequests(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		var e *fiber.Error
+		if errors.As(err, &e) {
+			status = e.Code
+		}
+	}
+	route := c.Route().Path
+	httpRequests.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Inc()
+	httpLatency.WithLabelValues(c.Method(), route).Observe(time.Since(start).Seconds())
+	return err
+}
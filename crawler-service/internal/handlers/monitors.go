@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// pasteMonitorRequest is the body of a paste monitor subscription
+type pasteMonitorRequest struct {
+	Keywords   []string `json:"keywords"`
+	Processors []string `json:"processors,omitempty"`
+}
+
+// GetPasteMonitor returns a tenant's paste monitor subscription
+func GetPasteMonitor(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+
+	job, keywords, ok := crawlerService.PasteWatch(tenant)
+	if !ok {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "No paste monitor for tenant", nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"tenant":   tenant,
+		"job_id":   job.ID,
+		"keywords": keywords,
+		"sources":  crawlerService.PasteSources(),
+		"matches":  job.PagesCrawled,
+	})
+}
+
+// PutPasteMonitor subscribes a tenant to pastes matching its keywords.
+// Matches are collected as results of a paste_monitor job.
+func PutPasteMonitor(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+
+	var req pasteMonitorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	var keywords []string
+	for _, kw := range req.Keywords {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			keywords = append(keywords, kw)
+		}
+	}
+	if len(keywords) == 0 {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "At least one keyword is required", nil)
+	}
+
+	if err := crawlerService.ValidateProcessors(req.Processors); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	job := &models.CrawlJob{
+		ID:         uuid.New().String(),
+		Tenant:     tenant,
+		Type:       models.JobTypePasteMonitor,
+		Processors: req.Processors,
+		Query:      strings.Join(keywords, ", "),
+		Status:     "pending",
+		StartedAt:  time.Now().UTC(),
+	}
+
+	previous, err := crawlerService.WatchPastes(job, keywords)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	saveJob(job)
+	if previous != nil {
+		saveJob(previous)
+	}
+
+	log.WithFields(log.Fields{
+		"tenant":   tenant,
+		"job_id":   job.ID,
+		"keywords": len(keywords),
+	}).Info("Paste monitor configured")
+
+	response := fiber.Map{
+		"message":  "Paste monitor started",
+		"job_id":   job.ID,
+		"keywords": keywords,
+		"sources":  crawlerService.PasteSources(),
+	}
+	if previous != nil {
+		response["replaced_job_id"] = previous.ID
+	}
+	return c.JSON(response)
+}
+
+// DeletePasteMonitor stops a tenant's paste monitor
+func DeletePasteMonitor(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+
+	job, ok := crawlerService.UnwatchPastes(tenant)
+	if !ok {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "No paste monitor for tenant", nil)
+	}
+	saveJob(job)
+
+	return c.JSON(fiber.Map{
+		"message": "Paste monitor stopped",
+		"job_id":  job.ID,
+	})
+}
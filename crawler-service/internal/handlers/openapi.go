@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/crawler"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/openapi"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiEndpoints describes the bodies and query parameters of operations,
+// by the name of their handler. Routes missing here are still listed in
+// the OpenAPI document, without schemas.
+var apiEndpoints = map[string]openapi.Endpoint{
+	"StartCrawl": {
+		Tag:      "jobs",
+		Request:  models.CrawlRequest{},
+		Response: models.JobResponse{},
+		Status:   http.StatusCreated,
+	},
+	"FindSimilarJobs": {
+		Tag:      "jobs",
+		Request:  models.CrawlRequest{},
+		Response: models.SimilarJobsResponse{},
+		Query: []openapi.Query{
+			{Name: "days", Type: "integer", Description: "How far back to look for similar jobs"},
+			{Name: "limit", Type: "integer"},
+			{Name: "min_similarity", Type: "number"},
+		},
+	},
+	"GetCrawlStatus": {Tag: "jobs", Response: models.StatusResponse{}},
+	"WaitForJob": {
+		Tag:      "jobs",
+		Summary:  "Wait for a job to finish; 202 when it is still going at the timeout",
+		Response: models.StatusResponse{},
+		Query:    []openapi.Query{{Name: "timeout", Description: "e.g. 60s; default 30s, at most 5m"}},
+	},
+	"ListJobs": {
+		Tag:      "jobs",
+		Response: models.JobListResponse{},
+		Query: []openapi.Query{
+			{Name: "cursor"},
+			{Name: "limit", Type: "integer"},
+			{Name: "order", Enum: []string{"asc", "desc"}},
+			{Name: "sort", Enum: []string{"started_at", "pages_crawled"}},
+			{Name: "page", Type: "integer"},
+			{Name: "status", Description: "Comma-separated statuses"},
+			{Name: "query"},
+			{Name: "started_after", Description: "RFC 3339 time"},
+			{Name: "started_before", Description: "RFC 3339 time"},
+			{Name: "external_id"},
+			{Name: "case_id"},
+			{Name: "include_deleted", Type: "boolean"},
+		},
+	},
+	"StreamJob": {Tag: "jobs", Summary: "Stream a job's progress as Server-Sent Events", ContentType: "text/event-stream"},
+	"CancelJob": {Tag: "jobs", Response: models.MessageResponse{}},
+	"DeleteJobV1": {
+		Tag:      "jobs",
+		Summary:  "Cancel job",
+		Response: models.MessageResponse{},
+	},
+	"DeleteJob": {
+		Tag:      "jobs",
+		Response: models.DeleteResponse{},
+		Query: []openapi.Query{
+			{Name: "purge", Type: "boolean", Description: "Remove the job and everything stored for it for good"},
+			{Name: "reason", Description: "Recorded in the audit log"},
+		},
+	},
+	"DeleteJobResults": {Tag: "results", Response: models.ResultsDeletedResponse{}},
+	"ContinueJob": {
+		Tag:      "jobs",
+		Response: models.JobResponse{},
+		Status:   http.StatusCreated,
+	},
+	"ResumeJob": {Tag: "jobs", Response: models.JobResponse{}},
+	"GetJobResults": {
+		Tag:      "results",
+		Response: models.ResultsResponse{},
+		Query: []openapi.Query{
+			{Name: "offset", Type: "integer"},
+			{Name: "limit", Type: "integer"},
+			{Name: "since_seq", Type: "integer", Description: "Only results after this sequence number"},
+			{Name: "max_depth", Type: "integer"},
+			{Name: "format", Description: "Download format instead of JSON pages"},
+		},
+	},
+	"GetJobSitemap": {
+		Tag:      "results",
+		Response: models.SitemapResponse{},
+		Query:    []openapi.Query{{Name: "depth", Type: "integer"}},
+	},
+	"GetJobReport": {
+		Tag: "results",
+		Query: []openapi.Query{
+			{Name: "sort", Enum: []string{"requests", "errors", "domain"}},
+			{Name: "format", Enum: []string{"csv"}},
+		},
+	},
+	"GetJobLinkGraph": {
+		Tag: "results",
+		Query: []openapi.Query{
+			{Name: "format", Enum: []string{"json", "graphml"}},
+			{Name: "scope", Enum: []string{"crawled", "all"}},
+		},
+	},
+	"FetchURL":        {Tag: "fetch", Request: models.FetchRequest{}},
+	"DeleteView":      {Tag: "results", Response: models.DeletedResponse{}},
+	"DeleteAPIKey":    {Tag: "admin", Response: models.DeletedResponse{}},
+	"GetTenantKeys":   {Tag: "admin", Response: models.TenantKeysResponse{}},
+	"RotateTenantKey": {Tag: "admin", Response: models.TenantKeysResponse{}},
+}
+
+// openAPIDocs caches the OpenAPI document of each API version
+var openAPIDocs sync.Map
+
+// GetOpenAPISpec serves an OpenAPI 3 description of the API version it is
+// requested under. Every registered route is listed; bodies are described
+// from the models they encode.
+func GetOpenAPISpec(c *fiber.Ctx) error {
+	version := apiVersion(c)
+	if doc, ok := openAPIDocs.Load(version); ok {
+		return c.JSON(doc)
+	}
+	doc := buildOpenAPI(c.App(), version)
+	openAPIDocs.Store(version, doc)
+	return c.JSON(doc)
+}
+
+// buildOpenAPI describes the routes of an API version
+func buildOpenAPI(app *fiber.App, version string) *openapi.Document {
+	prefix := "/api/" + version
+	doc := openapi.New(openapi.Info{
+		Title:   "Crawler service API",
+		Version: crawler.Version,
+	})
+	doc.Servers = []openapi.Server{{URL: prefix}}
+	doc.BearerAuth("X-API-Key")
+
+	// v1 error bodies carry their details next to the message
+	var errorBody interface{} = models.ErrorResponse{}
+	if version == models.APIVersion1 {
+		errorBody = map[string]interface{}{}
+	}
+
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead || !strings.HasPrefix(route.Path, prefix+"/") || len(route.Handlers) == 0 {
+			continue
+		}
+		name := handlerName(route.Handlers[len(route.Handlers)-1])
+		endpoint := apiEndpoints[name]
+		endpoint.Method = route.Method
+		endpoint.Path = strings.TrimPrefix(route.Path, prefix)
+		endpoint.ID = name
+		doc.Add(endpoint, errorBody)
+	}
+	return doc
+}
+
+// handlerName returns the name of a handler function, e.g. GetJobReport
+func handlerName(h fiber.Handler) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(h).Pointer())
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
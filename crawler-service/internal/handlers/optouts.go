@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/policy"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// optOutRequest asks for a domain never to be crawled
+type optOutRequest struct {
+	Domain  string `json:"domain"`
+	Reason  string `json:"reason,omitempty"`
+	Contact string `json:"contact,omitempty"`
+}
+
+// RegisterOptOut records a permanent opt-out for a domain and its
+// subdomains. Requests to it stop immediately across all running jobs, its
+// URLs are purged from the frontiers of stopped jobs, and the opt-out is
+// audited.
+func RegisterOptOut(c *fiber.Ctx) error {
+	var req optOutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	domain, err := policy.NormalizeDomain(req.Domain)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	existed, err := crawlerService.Policies().AddOptOut(policy.OptOut{
+		Domain:  domain,
+		Reason:  req.Reason,
+		Contact: req.Contact,
+	})
+	if err != nil {
+		log.WithError(err).WithField("domain", domain).Error("Failed to persist opt-out")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to record opt-out", nil)
+	}
+	if existed {
+		return c.JSON(fiber.Map{
+			"domain":  domain,
+			"message": "Domain is already opted out",
+		})
+	}
+
+	stored, err := jobs.List()
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+	changed, purged := crawlerService.PurgeDenied(stored)
+	for _, job := range changed {
+		saveJob(job)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "policy.opt_out",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"domain":  domain,
+			"reason":  req.Reason,
+			"contact": req.Contact,
+			"purged":  purged,
+		},
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"domain":        domain,
+		"message":       "Domain opted out; it will not be crawled",
+		"urls_purged":   purged,
+		"jobs_affected": len(changed),
+	})
+}
+
+// ListOptOuts returns every registered opt-out
+func ListOptOuts(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"opt_outs": crawlerService.Policies().OptOuts(),
+	})
+}
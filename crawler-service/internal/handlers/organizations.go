@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetJobOrganizations lists the organisations a job's contact, about and
+// imprint pages describe, one per registrable domain. Roles that may not
+// see the organization result field get an empty list.
+func GetJobOrganizations(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	organizations := make([]models.Organization, 0, len(job.Organizations))
+	if !roleMask(c).Hides("organization") {
+		for _, org := range job.Organizations {
+			organizations = append(organizations, *org)
+		}
+	}
+	sort.Slice(organizations, func(i, j int) bool {
+		return organizations[i].Domain < organizations[j].Domain
+	})
+
+	return c.JSON(fiber.Map{
+		"job_id":        job.ID,
+		"total":         len(organizations),
+		"organizations": organizations,
+	})
+}
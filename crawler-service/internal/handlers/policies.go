@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/policy"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetPolicies returns the operator policies in force and, if the last
+// reload of the policy files failed, why
+func GetPolicies(c *fiber.Ctx) error {
+	dir, set, err := crawlerService.Policies().Status()
+
+	status := fiber.Map{
+		"dir":      dir,
+		"policies": set,
+	}
+	if err != nil {
+		status["reload_error"] = err.Error()
+	}
+	return c.JSON(status)
+}
+
+// PutCategory uploads a domain category list, one domain per line in the
+// request body, replacing any list of the same category. Results on the
+// listed domains and their subdomains are tagged with the category, and
+// jobs can exclude it.
+func PutCategory(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if !policy.ValidCategory(name) {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Category must be 1-64 lowercase letters, digits, '-' or '_'", nil)
+	}
+
+	domains, err := crawlerService.Policies().PutCategory(name, c.Body())
+	if errors.Is(err, policy.ErrNoPolicyDir) {
+		return respondError(c, fiber.StatusNotImplemented, errcode.NotImplemented, "Category lists need POLICY_DIR", nil)
+	}
+	if err != nil {
+		log.WithError(err).WithField("category", name).Error("Failed to load category list")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to load category list", fiber.Map{
+			"reason": err.Error(),
+		})
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "policy.category",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"category": name,
+			"domains":  domains,
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"category": name,
+		"domains":  domains,
+	})
+}
+
+// DeleteCategory removes a domain category list
+func DeleteCategory(c *fiber.Ctx) error {
+	name := c.Params("name")
+	deleted, err := crawlerService.Policies().DeleteCategory(name)
+	if err != nil {
+		log.WithError(err).WithField("category", name).Error("Failed to delete category list")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to delete category list", nil)
+	}
+	if !deleted {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Category not found", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action:  "policy.category_delete",
+		Actor:   c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{"category": name},
+	})
+
+	return c.JSON(fiber.Map{
+		"message":  "Category removed",
+		"category": name,
+	})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/jobqueue"
+	"definitelynotaspy/crawler-service/internal/models"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// preemptionEnabled reports whether high priority jobs may pause running
+// low priority crawls when every worker is busy, JOB_PREEMPTION=true
+func preemptionEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("JOB_PREEMPTION"))
+	return enabled
+}
+
+// queuedJob wraps a job's work for the queue at the job's priority. Low
+// priority crawls that can be resumed in place may be preempted.
+func queuedJob(job *models.CrawlJob, req models.CrawlRequest, work func()) jobqueue.Job {
+	priority := jobqueue.Normal
+	switch job.Priority {
+	case models.PriorityHigh:
+		priority = jobqueue.High
+	case models.PriorityLow:
+		priority = jobqueue.Low
+	}
+	return jobqueue.Job{
+		ID:       job.ID,
+		Priority: priority,
+		Preemptible: priority == jobqueue.Low &&
+			(job.Type == "" || job.Type == models.JobTypeCrawl) && job.Mode == "" &&
+			!crawlerService.Distributed(),
+		Run: work,
+	}
+}
+
+// preemptJob pauses a running crawl for a job of higher priority
+func preemptJob(id string) {
+	job, exists := jobs.Get(id)
+	if !exists {
+		return
+	}
+	if crawlerService.Preempt(job) {
+		log.WithField("job_id", id).Info("Pausing low priority job for a high priority job")
+	}
+}
+
+// requeuePaused queues a crawl paused for a job of higher priority to
+// resume once a worker is free. A paused crawl with nothing left to visit
+// ends cancelled, keeping its results.
+func requeuePaused(job *models.CrawlJob) {
+	_, _, err := resume(job)
+	switch {
+	case errors.Is(err, errNothingToResume):
+		job.Status = "cancelled"
+		job.Error = "job paused for a job of higher priority with no unvisited URLs left"
+		job.Partial = len(job.Results) > 0
+		job.CompletedAt = time.Now().UTC()
+		saveJob(job)
+	case err != nil && !errors.Is(err, jobqueue.ErrClosed):
+		job.Status = "failed"
+		job.Error = err.Error()
+		job.ErrorCode = errcode.Internal
+		job.CompletedAt = time.Now().UTC()
+		saveJob(job)
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListProxies reports on the proxy pool: whether each proxy is in rotation
+// and how its requests have been doing
+func ListProxies(c *fiber.Ctx) error {
+	stats := crawlerService.Proxies().Stats()
+	alive := 0
+	for _, s := range stats {
+		if s.Alive {
+			alive++
+		}
+	}
+	return c.JSON(fiber.Map{
+		"proxies": stats,
+		"total":   len(stats),
+		"alive":   alive,
+	})
+}
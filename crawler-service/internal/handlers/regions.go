@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListRegions reports on the regions crawls can be routed to: whether
+// their proxies are healthy, how they have been doing and how many jobs
+// are crawling through them
+func ListRegions(c *fiber.Ctx) error {
+	unfinished, err := jobs.Find(store.JobFilter{Unfinished: true})
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+	running := make(map[string]int)
+	for _, job := range unfinished {
+		if job.Region != "" && (job.Status == "pending" || job.Status == "running") {
+			running[job.Region]++
+		}
+	}
+
+	health := crawlerService.Regions().Health()
+	list := make([]fiber.Map, 0, len(health))
+	for _, h := range health {
+		list = append(list, fiber.Map{
+			"region":       h.Region,
+			"healthy":      h.Healthy,
+			"tlds":         h.TLDs,
+			"proxies":      h.Proxies,
+			"running_jobs": running[h.Region],
+		})
+	}
+	return c.JSON(fiber.Map{
+		"regions": list,
+		"total":   len(list),
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// replicaReads are the POST routes that only read, served by replicas too
+var replicaReads = []string{"/crawl/similar"}
+
+// ReadReplica reports whether this instance is a read replica,
+// READ_REPLICA=true. Replicas serve reads from the shared job store and
+// reject writes, so read traffic scales apart from crawling.
+func ReadReplica() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("READ_REPLICA"))
+	return enabled
+}
+
+// RejectWrites refuses requests that would change state with 403, for
+// read replicas
+func RejectWrites(c *fiber.Ctx) error {
+	if readRequest(c) {
+		return c.Next()
+	}
+	return respondAPIError(c, readOnlyRefusal())
+}
+
+// readOnlyRefusal is the error replicas refuse writes with
+func readOnlyRefusal() *APIError {
+	return refuse(fiber.StatusForbidden, errcode.ReadOnly, "This instance is a read-only replica, send writes to a primary instance", nil)
+}
+
+// readRequest reports whether a request only reads
+func readRequest(c *fiber.Ctx) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	case fiber.MethodPost:
+		for _, route := range replicaReads {
+			if strings.HasSuffix(strings.TrimSuffix(c.Path(), "/"), route) {
+				return true
+			}
+		}
+	}
+	return false
+}
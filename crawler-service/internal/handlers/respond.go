@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiVersion returns the API version a request was made under
+func apiVersion(c *fiber.Ctx) string {
+	if strings.HasPrefix(c.Path(), "/api/"+models.APIVersion2+"/") {
+		return models.APIVersion2
+	}
+	return models.APIVersion1
+}
+
+// respondError writes an error response in the shape of the request's API
+// version: v1 puts the details next to the message, v2 returns a
+// models.ErrorResponse with a machine-readable code
+func respondError(c *fiber.Ctx, status int, code, message string, details fiber.Map) error {
+	if apiVersion(c) == models.APIVersion2 {
+		return c.Status(status).JSON(models.ErrorResponse{
+			Error:   message,
+			Code:    code,
+			Details: details,
+		})
+	}
+
+	body := fiber.Map{"error": message}
+	for k, v := range details {
+		body[k] = v
+	}
+	return c.Status(status).JSON(body)
+}
+
+// APIError is a refused request: the status and error code it is answered
+// with. The functions behind the REST handlers that other APIs call return
+// it in place of writing a response.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details fiber.Map
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// refuse returns an APIError
+func refuse(status int, code, message string, details fiber.Map) *APIError {
+	return &APIError{Status: status, Code: code, Message: message, Details: details}
+}
+
+// respondAPIError writes the error response for err
+func respondAPIError(c *fiber.Ctx, err *APIError) error {
+	return respondError(c, err.Status, err.Code, err.Message, err.Details)
+}
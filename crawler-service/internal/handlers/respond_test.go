@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// contractApp serves the routes under test in both API versions, with an
+// empty in-memory job store
+func contractApp(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("ENCRYPTION_MASTER_KEYS", "")
+	if crawlerService == nil {
+		Init(NewServicesFromEnv())
+	}
+	jobs = store.NewMemory()
+
+	app := fiber.New()
+	for _, version := range []string{models.APIVersion1, models.APIVersion2} {
+		api := app.Group("/api/" + version)
+		api.Use(LegacyJobRoutes)
+		if version == models.APIVersion1 {
+			api.Delete("/jobs/:id", DeleteJobV1)
+		} else {
+			api.Delete("/jobs/:id", DeleteJob)
+		}
+		api.Delete("/jobs/:id/results", DeleteJobResults)
+		api.Post("/jobs/:id/views", CreateView)
+		api.Delete("/jobs/:id/views/:view", DeleteView)
+		api.Delete("/admin/api-keys/:id", DeleteAPIKey)
+		api.Get("/admin/tenants/:id/keys", GetTenantKeys)
+	}
+	return app
+}
+
+// addJob stores a job of the default tenant
+func addJob(status string) *models.CrawlJob {
+	job := &models.CrawlJob{
+		ID:          "job-" + status,
+		Tenant:      defaultTenant,
+		Status:      status,
+		StartedAt:   time.Now().UTC(),
+		CompletedAt: time.Now().UTC(),
+	}
+	jobs.Put(job)
+	return job
+}
+
+// call makes a request and returns the status and body of the response
+func call(t *testing.T, app *fiber.App, method, path, body string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// decodeStrict decodes a body into v, failing on fields v does not declare
+func decodeStrict(t *testing.T, data []byte, v interface{}) {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		t.Fatalf("body %s does not match %T: %v", data, v, err)
+	}
+}
+
+func TestErrorResponsesFollowAPIVersion(t *testing.T) {
+	app := contractApp(t)
+	addJob("running")
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int
+		code    string
+		details map[string]interface{}
+	}{
+		{"delete missing job", http.MethodDelete, "/jobs/missing", "", http.StatusNotFound, errcode.NotFound, nil},
+		{"delete results of missing job", http.MethodDelete, "/jobs/missing/results", "", http.StatusNotFound, errcode.NotFound, nil},
+		{"delete results of running job", http.MethodDelete, "/jobs/job-running/results", "", http.StatusConflict, errcode.Conflict, map[string]interface{}{"status": "running"}},
+		{"create view with bad body", http.MethodPost, "/jobs/job-running/views", "{", http.StatusBadRequest, errcode.InvalidRequest, nil},
+		{"delete missing view", http.MethodDelete, "/jobs/job-running/views/missing", "", http.StatusNotFound, errcode.NotFound, nil},
+		{"delete missing API key", http.MethodDelete, "/admin/api-keys/missing", "", http.StatusNotFound, errcode.NotFound, nil},
+		{"keys without encryption", http.MethodGet, "/admin/tenants/default/keys", "", http.StatusNotImplemented, errcode.NotImplemented, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// v1 puts the details next to the message
+			status, data := call(t, app, tt.method, "/api/v1"+tt.path, tt.body)
+			if status != tt.status {
+				t.Fatalf("v1 status = %d, want %d: %s", status, tt.status, data)
+			}
+			var v1 map[string]interface{}
+			decodeStrict(t, data, &v1)
+			if msg, ok := v1["error"].(string); !ok || msg == "" {
+				t.Errorf("v1 body %s has no error message", data)
+			}
+			if _, ok := v1["code"]; ok {
+				t.Errorf("v1 body %s has a code", data)
+			}
+			for k, want := range tt.details {
+				if v1[k] != want {
+					t.Errorf("v1 %s = %v, want %v", k, v1[k], want)
+				}
+			}
+
+			// v2 returns an ErrorResponse with a code
+			status, data = call(t, app, tt.method, "/api/v2"+tt.path, tt.body)
+			if status != tt.status {
+				t.Fatalf("v2 status = %d, want %d: %s", status, tt.status, data)
+			}
+			var v2 models.ErrorResponse
+			decodeStrict(t, data, &v2)
+			if v2.Error == "" || v2.Code != tt.code {
+				t.Errorf("v2 body %s, want code %q and a message", data, tt.code)
+			}
+			for k, want := range tt.details {
+				if v2.Details[k] != want {
+					t.Errorf("v2 details.%s = %v, want %v", k, v2.Details[k], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteResponses(t *testing.T) {
+	app := contractApp(t)
+
+	for _, version := range []string{models.APIVersion1, models.APIVersion2} {
+		prefix := "/api/" + version
+		t.Run(version, func(t *testing.T) {
+			jobs = store.NewMemory()
+			job := addJob("completed")
+
+			status, data := call(t, app, http.MethodDelete, prefix+"/jobs/"+job.ID+"/results", "")
+			if status != http.StatusOK {
+				t.Fatalf("delete results: status %d: %s", status, data)
+			}
+			var results models.ResultsDeletedResponse
+			decodeStrict(t, data, &results)
+			if results.JobID != job.ID {
+				t.Errorf("delete results: job_id = %q", results.JobID)
+			}
+
+			if version == models.APIVersion1 {
+				// v1 cancels on DELETE, as it always has
+				running := addJob("running")
+				status, data = call(t, app, http.MethodDelete, prefix+"/jobs/"+running.ID, "")
+				if status != http.StatusOK {
+					t.Fatalf("cancel: status %d: %s", status, data)
+				}
+				var cancelled models.MessageResponse
+				decodeStrict(t, data, &cancelled)
+				if cancelled.JobID != running.ID || running.Status != "cancelled" || running.DeletedAt != nil {
+					t.Errorf("cancel: %s, job %s", data, running.Status)
+				}
+				return
+			}
+
+			status, data = call(t, app, http.MethodDelete, prefix+"/jobs/"+job.ID, "")
+			if status != http.StatusOK {
+				t.Fatalf("delete: status %d: %s", status, data)
+			}
+			var deleted models.DeleteResponse
+			decodeStrict(t, data, &deleted)
+			if deleted.JobID != job.ID || deleted.Purged || deleted.DeletedAt == nil || deleted.Removed != nil {
+				t.Errorf("delete: %s", data)
+			}
+
+			status, data = call(t, app, http.MethodDelete, prefix+"/jobs/"+job.ID+"?purge=true", "")
+			if status != http.StatusOK {
+				t.Fatalf("purge: status %d: %s", status, data)
+			}
+			var purged models.DeleteResponse
+			decodeStrict(t, data, &purged)
+			if purged.JobID != job.ID || !purged.Purged || purged.Removed == nil {
+				t.Errorf("purge: %s", data)
+			}
+			if _, exists := jobs.Get(job.ID); exists {
+				t.Error("purged job is still stored")
+			}
+		})
+	}
+}
+
+func TestLegacyJobRoutes(t *testing.T) {
+	app := contractApp(t)
+	job := addJob("completed")
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/job/"+job.ID+"/results", nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Deprecation") != "true" {
+		t.Error("response is not marked deprecated")
+	}
+	if link, want := resp.Header.Get("Link"), "</api/v1/jobs/"+job.ID+`/results>; rel="successor-version"`; link != want {
+		t.Errorf("Link = %q, want %q", link, want)
+	}
+}
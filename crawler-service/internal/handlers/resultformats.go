@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bufio"
+	"definitelynotaspy/crawler-service/internal/crawler"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/warc"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Formats results can be streamed in
+const (
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatWARC   = "warc"
+)
+
+// streamFlushEvery is how many results are written between flushes
+const streamFlushEvery = 100
+
+// resultColumns are the columns of a CSV results export
+var resultColumns = []string{
+	"seq", "url", "title", "status_code", "crawled_at", "depth", "discovered_from", "source",
+	"content_hash", "duplicate_of", "error", "error_code", "links", "emails", "phones", "content",
+}
+
+// validResultFormat reports whether results can be streamed in format
+func validResultFormat(format string) bool {
+	switch format {
+	case formatNDJSON, formatCSV, formatWARC:
+		return true
+	}
+	return false
+}
+
+// streamResults sends results as NDJSON, CSV or WARC, written as they are
+// sent. first is the index of the first result among the job's, for
+// numbering results that predate sequence numbers.
+func streamResults(c *fiber.Ctx, job *models.CrawlJob, results []models.CrawlResult, first int, format string) error {
+	var write func(w *bufio.Writer) error
+	switch format {
+	case formatNDJSON:
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		write = func(w *bufio.Writer) error {
+			enc := json.NewEncoder(w)
+			for i, result := range results {
+				result.Seq = resultSeq(result, first+i)
+				if err := enc.Encode(result); err != nil {
+					return err
+				}
+				if (i+1)%streamFlushEvery == 0 {
+					if err := w.Flush(); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+	case formatCSV:
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%s-results.csv"`, job.ID))
+		write = func(w *bufio.Writer) error {
+			cw := csv.NewWriter(w)
+			if err := cw.Write(resultColumns); err != nil {
+				return err
+			}
+			for i, result := range results {
+				if err := cw.Write(resultRecord(result, first+i)); err != nil {
+					return err
+				}
+				if (i+1)%streamFlushEvery == 0 {
+					cw.Flush()
+					if err := w.Flush(); err != nil {
+						return err
+					}
+				}
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+	case formatWARC:
+		filename := fmt.Sprintf("job-%s.warc.gz", job.ID)
+		c.Set(fiber.HeaderContentType, "application/warc")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+		write = func(w *bufio.Writer) error {
+			return writeWARC(w, job, results, first, filename)
+		}
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// A failure midway leaves the client a truncated file
+		err := write(w)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"job_id": job.ID,
+				"format": format,
+			}).Warn("Results stream interrupted")
+		}
+	})
+	return nil
+}
+
+// resultRecord flattens a result to a CSV row of resultColumns
+func resultRecord(r models.CrawlResult, i int) []string {
+	emails := make([]string, len(r.Emails))
+	for j, e := range r.Emails {
+		emails[j] = e.Address
+	}
+	phones := make([]string, len(r.Phones))
+	for j, p := range r.Phones {
+		phones[j] = p.Number
+	}
+	return []string{
+		strconv.FormatInt(resultSeq(r, i), 10),
+		r.URL,
+		r.Title,
+		strconv.Itoa(r.StatusCode),
+		r.CrawledAt.UTC().Format(time.RFC3339),
+		strconv.Itoa(r.Depth),
+		r.DiscoveredFrom,
+		r.Source,
+		r.ContentHash,
+		r.DuplicateOf,
+		r.Error,
+		r.ErrorCode,
+		strconv.Itoa(len(r.Links)),
+		strings.Join(emails, ";"),
+		strings.Join(phones, ";"),
+		r.Content,
+	}
+}
+
+// writeWARC writes a warcinfo record, then for each result a response
+// record of its archived HTML, when it was captured, and a metadata record
+// of the result itself. Archived HTML is sanitised and its response
+// headers are not kept, so responses carry the status and a text/html
+// content type only.
+func writeWARC(w *bufio.Writer, job *models.CrawlJob, results []models.CrawlResult, first int, filename string) error {
+	ww := warc.NewWriter(w)
+	if _, err := ww.WriteInfo(filename, map[string]string{
+		"software":    "DefinitelyNotASpy crawler " + crawler.Version,
+		"format":      "WARC File Format 1.1",
+		"description": fmt.Sprintf("Crawl job %s: %s", job.ID, job.Query),
+	}); err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		var responseID string
+		if result.HTMLRef != "" {
+			html, err := archivedHTML(job, result.HTMLRef)
+			if err != nil {
+				log.WithError(err).WithField("ref", result.HTMLRef).Warn("Archived HTML left out of WARC export")
+			} else {
+				status := result.StatusCode
+				if status == 0 {
+					status = http.StatusOK
+				}
+				header := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+				if responseID, err = ww.WriteRecord(warc.Record{
+					Type:        warc.TypeResponse,
+					TargetURI:   result.URL,
+					Date:        result.CrawledAt,
+					ContentType: warc.ContentTypeHTTPResponse,
+					Fields:      map[string]string{"WARC-Payload-Digest": warc.Digest(html)},
+				}, warc.HTTPResponse(status, header, html)); err != nil {
+					return err
+				}
+			}
+		}
+
+		result.Seq = resultSeq(result, first+i)
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		if _, err := ww.WriteRecord(warc.Record{
+			Type:         warc.TypeMetadata,
+			TargetURI:    result.URL,
+			Date:         result.CrawledAt,
+			ContentType:  "application/json",
+			ConcurrentTo: responseID,
+		}, data); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivedHTML loads and decompresses a page's archived HTML
+func archivedHTML(job *models.CrawlJob, ref string) ([]byte, error) {
+	data, err := loadArtifact(job, ref)
+	if err != nil {
+		return nil, err
+	}
+	return gunzip(data)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/confidence"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+)
+
+// GetJobResults returns the results of a job, or a presigned download URL
+// when the results have been offloaded to object storage. With format=
+// ndjson, csv or warc the results are streamed in that format instead.
+func GetJobResults(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	format := c.Query("format")
+	if format != "" && !validResultFormat(format) {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "format must be ndjson, csv or warc", nil)
+	}
+
+	maxDepth := -1
+	if v := c.Query("max_depth"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "max_depth must be a non-negative integer", nil)
+		}
+		maxDepth = d
+	}
+
+	// since_seq leaves out the results consumers have already seen
+	var sinceSeq int64
+	if v := c.Query("since_seq"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "since_seq must be a non-negative integer", nil)
+		}
+		sinceSeq = n
+	}
+
+	minConf, err := minConfidence(c)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	// offset and limit page through the results; without a limit the rest
+	// are returned
+	offset, limit := c.QueryInt("offset"), c.QueryInt("limit")
+	if offset < 0 || limit < 0 {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "offset and limit must not be negative", nil)
+	}
+
+	// Masked roles are served the filtered results rather than a link to
+	// the complete offloaded ones
+	mask := roleMask(c)
+	if job.ResultsRef != "" && maxDepth < 0 && sinceSeq == 0 && minConf == 0 && mask == nil && format == "" {
+		url, expiresAt, err := crawlerService.ResultsDownloadURL(job)
+		if err != nil {
+			log.WithError(err).WithField("job_id", jobID).Error("Failed to presign results URL")
+			return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Offloaded results are currently unavailable", nil)
+		}
+
+		return c.JSON(models.OffloadedResultsResponse{
+			JobID:       job.ID,
+			Offloaded:   true,
+			DownloadURL: url,
+			ExpiresAt:   expiresAt,
+		})
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load job results")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	results = confidence.Filter(mask.Apply(results), minConf)
+
+	if maxDepth >= 0 || sinceSeq > 0 {
+		filtered := make([]models.CrawlResult, 0, len(results))
+		for i, result := range results {
+			if maxDepth >= 0 && result.Depth > maxDepth {
+				continue
+			}
+			if result.Seq = resultSeq(result, i); result.Seq <= sinceSeq {
+				continue
+			}
+			filtered = append(filtered, result)
+		}
+		results = filtered
+	}
+
+	total := len(results)
+	if offset > total {
+		offset = total
+	}
+	page := results[offset:]
+	if limit > 0 && limit < len(page) {
+		page = page[:limit]
+	}
+
+	if format != "" {
+		return streamResults(c, job, page, offset, format)
+	}
+
+	lastSeq := sinceSeq
+	if len(page) > 0 {
+		lastSeq = resultSeq(page[len(page)-1], offset+len(page)-1)
+	}
+
+	return c.JSON(models.ResultsResponse{
+		JobID:   job.ID,
+		Total:   total,
+		Offset:  offset,
+		Results: page,
+		LastSeq: lastSeq,
+	})
+}
+
+// resultSeq returns the sequence number of the i-th result of a job. Jobs
+// finished before results were numbered are numbered in order.
+func resultSeq(result models.CrawlResult, i int) int64 {
+	if result.Seq > 0 {
+		return result.Seq
+	}
+	return int64(i + 1)
+}
+
+// minConfidence reads the min_confidence query parameter, which leaves the
+// entities scored below it out of results and exports; 0 when absent
+func minConfidence(c *fiber.Ctx) (float64, error) {
+	v := c.Query("min_confidence")
+	if v == "" {
+		return 0, nil
+	}
+	min, err := strconv.ParseFloat(v, 64)
+	if err != nil || min < 0 || min > 1 {
+		return 0, errors.New("min_confidence must be between 0 and 1")
+	}
+	return min, nil
+}
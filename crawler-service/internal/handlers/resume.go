@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/jobqueue"
+	"definitelynotaspy/crawler-service/internal/models"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ResumeJob carries on an interrupted crawl in place: one checkpointed
+// when the service shut down, or one that was running when the service
+// died. The job keeps its ID, results and page count and crawls on from
+// the progress it last saved, or from its frontier when it saved none,
+// skipping the pages it already visited.
+func ResumeJob(c *fiber.Ctx) error {
+	if inMaintenance() {
+		return rejectForMaintenance(c)
+	}
+
+	job, exists := findJob(c, c.Params("id"))
+	if !exists || job.DeletedAt != nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	if (job.Type != "" && job.Type != models.JobTypeCrawl) || job.Mode != "" {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Only crawl jobs can be resumed", nil)
+	}
+	if job.Status == "pending" || job.Status == "running" || job.Status == "stalled" || job.Status == "paused" {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Cannot resume a job that is still in progress", nil)
+	}
+	if job.ErrorCode != errcode.Maintenance && job.ErrorCode != errcode.Interrupted && job.ErrorCode != errcode.Preempted {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Only interrupted jobs can be resumed; continue the job instead", fiber.Map{
+			"status":     job.Status,
+			"error_code": job.ErrorCode,
+		})
+	}
+
+	req, results, err := resume(job)
+	switch {
+	case errors.Is(err, errNothingToResume):
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Job has no unvisited URLs to resume from", nil)
+	case errors.Is(err, jobqueue.ErrClosed):
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Maintenance, "Job could not be queued", nil)
+	case err != nil:
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to load the job's results", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "job.resume",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Tenant: job.Tenant,
+		Details: map[string]interface{}{
+			"job_id":  job.ID,
+			"seeds":   len(req.SeedURLs),
+			"results": len(results),
+		},
+	})
+
+	log.WithFields(log.Fields{
+		"job_id":  job.ID,
+		"seeds":   len(req.SeedURLs),
+		"results": len(results),
+		"resumes": job.Resumes,
+	}).Info("Interrupted crawl resumed")
+
+	return c.JSON(models.JobResponse{
+		JobID:   job.ID,
+		Status:  "pending",
+		Message: "Job resumed",
+		Seeds:   len(req.SeedURLs),
+		Job:     job,
+	})
+}
+
+// errNothingToResume is returned for interrupted jobs that left no
+// unvisited URLs
+var errNothingToResume = errors.New("job has no unvisited URLs to resume from")
+
+// resume queues an interrupted crawl job to carry on from the progress it
+// last saved, or from its frontier, and returns the request and results it
+// resumes with. A job the queue does not take is marked failed.
+func resume(job *models.CrawlJob) (models.CrawlRequest, []models.CrawlResult, error) {
+	req := requestOf(job)
+	var results []models.CrawlResult
+	pages := job.PagesCrawled
+	if saved, ok := crawlerService.SavedRun(job.ID); ok {
+		req.SeedURLs = saved.Frontier
+		req.Visited = saved.Visited
+		req.Cookies = saved.Cookies
+		results = saved.Results
+		pages = saved.PagesCrawled
+	} else {
+		var err error
+		if results, err = crawlerService.JobResults(job); err != nil {
+			return req, nil, err
+		}
+		req.SeedURLs = job.Frontier
+		req.Visited = visitedURLs(job)
+		req.Cookies = job.Cookies
+	}
+	if len(req.SeedURLs) == 0 {
+		return req, nil, errNothingToResume
+	}
+	req.Resume = true
+
+	now := time.Now().UTC()
+	job.Status = "pending"
+	job.Error = ""
+	job.ErrorCode = ""
+	job.Partial = false
+	job.CompletedAt = time.Time{}
+	job.Results = results
+	job.ResultsRef = ""
+	job.PagesCrawled = pages
+	job.Frontier = nil
+	job.Resumes++
+	job.ResumedAt = &now
+	job.Options = &req
+	saveJob(job)
+
+	work := func() {
+		// A job deleted while it waited is not resumed
+		if job.Status != "pending" || job.DeletedAt != nil {
+			return
+		}
+		if err := crawlerService.StartCrawl(job, req); err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Debug("Crawl returned error")
+		}
+		if job.Status == "paused" {
+			requeuePaused(job)
+			return
+		}
+		saveJob(job)
+	}
+	if _, err := queue.Submit(queuedJob(job, req, work)); err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		job.ErrorCode = errcode.Maintenance
+		job.CompletedAt = time.Now().UTC()
+		saveJob(job)
+		return req, nil, err
+	}
+	return req, results, nil
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/metrics"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+// reapInterval is how often finished jobs are checked for expiry
+const reapInterval = 10 * time.Minute
+
+var jobsExpired = promauto.With(metrics.Registry).NewCounter(prometheus.CounterOpts{
+	Name: "crawler_jobs_expired_total",
+	Help: "Finished jobs purged once their retention ran out.",
+})
+
+func init() {
+	promauto.With(metrics.Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "crawler_storage_bytes",
+		Help: "Bytes of results stored for jobs.",
+	}, func() float64 {
+		return float64(storeStats().StorageBytes)
+	})
+	promauto.With(metrics.Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "crawler_jobs_stored",
+		Help: "Jobs kept in the job store, deleted ones included.",
+	}, func() float64 {
+		return float64(storeStats().Jobs)
+	})
+}
+
+// storeStats sums up the stored jobs for the gauges, as zero when the
+// store cannot be read
+func storeStats() store.Stats {
+	stats, err := jobs.Stats()
+	if err != nil {
+		log.WithError(err).Warn("Failed to read job store stats")
+	}
+	return stats
+}
+
+// defaultRetentionHours returns how long finished jobs are kept when their
+// request does not say: JOB_RETENTION_HOURS, by default until deleted
+func defaultRetentionHours() int {
+	if n, err := strconv.Atoi(os.Getenv("JOB_RETENTION_HOURS")); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// jobExpiry returns when a finished job is purged, or nil if it is kept
+// until deleted or has not finished
+func jobExpiry(job *models.CrawlJob) *time.Time {
+	return store.Expiry(job)
+}
+
+// StartRetentionReaper purges finished jobs whose retention ran out, with
+// everything stored for them, every reapInterval until ctx is done
+func StartRetentionReaper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(reapInterval)
+		defer ticker.Stop()
+		for {
+			reapExpiredJobs(time.Now().UTC())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// reapExpiredJobs purges the jobs expired at now and returns how many
+func reapExpiredJobs(now time.Time) int {
+	expired, err := jobs.Expiring(now)
+	if err != nil {
+		log.WithError(err).Error("Failed to list expired jobs")
+		return 0
+	}
+	reaped := 0
+	for _, job := range expired {
+		report, err := crawlerService.PurgeJob(job)
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Error("Failed to purge expired job")
+			continue
+		}
+		forgetJob(job)
+		jobsExpired.Inc()
+		reaped++
+
+		crawlerService.Audit().Append(audit.Record{
+			Action: "job.expire",
+			Actor:  "retention",
+			Tenant: job.Tenant,
+			JobID:  job.ID,
+			Details: map[string]interface{}{
+				"retention_hours": job.RetentionHours,
+				"results":         report.Results,
+				"bytes_released":  report.BytesReleased,
+			},
+		})
+	}
+	if reaped > 0 {
+		log.WithField("jobs", reaped).Info("Purged expired jobs")
+	}
+	return reaped
+}
+
+// DeleteJobResults frees the storage of a finished job ahead of its
+// retention: its results, archived pages, offloaded results and
+// content-index entries are removed. The job itself and its statistics
+// are kept.
+func DeleteJobResults(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	if !jobDone(job) {
+		return respondError(c, fiber.StatusConflict, errcode.Conflict, "Results can only be deleted once the job has finished", fiber.Map{
+			"status": job.Status,
+		})
+	}
+
+	report, err := crawlerService.DeleteResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", job.ID).Error("Failed to delete job results")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, err.Error(), nil)
+	}
+	now := time.Now().UTC()
+	job.ResultsDeletedAt = &now
+	saveJob(job)
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "job.delete_results",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Tenant: job.Tenant,
+		JobID:  job.ID,
+		Details: map[string]interface{}{
+			"results":        report.Results,
+			"index_entries":  report.IndexEntries,
+			"bytes_released": report.BytesReleased,
+		},
+	})
+
+	return c.JSON(models.ResultsDeletedResponse{
+		JobID:   job.ID,
+		Message: "Job results deleted",
+		Removed: report,
+	})
+}
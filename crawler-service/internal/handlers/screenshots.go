@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetJobScreenshot returns the archived PNG screenshot of one of a job's
+// pages, named by the last part of its result's screenshot_ref. Roles whose
+// field mask hides screenshot_ref cannot read screenshots.
+func GetJobScreenshot(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load job results")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	ref := job.ID + "/" + c.Params("file")
+	found := false
+	for _, result := range roleMask(c).Apply(results) {
+		if result.ScreenshotRef == ref {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Screenshot not found", nil)
+	}
+
+	png, err := loadScreenshot(job, ref)
+	if err != nil {
+		log.WithError(err).WithField("ref", ref).Error("Failed to load archived screenshot")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Screenshot is currently unavailable", nil)
+	}
+	c.Set(fiber.HeaderContentType, "image/png")
+	return c.Send(png)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/scripts"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// scriptUpload is the body of a script upload
+type scriptUpload struct {
+	Source string `json:"source"`
+}
+
+// ListScripts returns a tenant's extraction scripts
+func ListScripts(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+	list, err := crawlerService.Scripts().List(tenant)
+	if err != nil {
+		return scriptsUnavailable(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"tenant":  tenant,
+		"total":   len(list),
+		"scripts": list,
+	})
+}
+
+// PutScript uploads or replaces a tenant extraction script
+func PutScript(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+	name := c.Params("name")
+
+	var body scriptUpload
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+
+	script, err := crawlerService.Scripts().Put(tenant, name, body.Source)
+	if errors.Is(err, scripts.ErrUnavailable) {
+		return scriptsUnavailable(c, err)
+	}
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+
+	log.WithFields(log.Fields{
+		"tenant": tenant,
+		"script": name,
+	}).Info("Extraction script uploaded")
+
+	return c.JSON(fiber.Map{
+		"message": "Script saved successfully",
+		"script":  script,
+	})
+}
+
+// DeleteScript removes a tenant extraction script
+func DeleteScript(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+	name := c.Params("name")
+
+	deleted, err := crawlerService.Scripts().Delete(tenant, name)
+	if err != nil {
+		return scriptsUnavailable(c, err)
+	}
+	if !deleted {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Script not found", nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Script deleted successfully",
+		"script":  name,
+	})
+}
+
+// scriptsUnavailable responds 503 when the scripts kept in Redis cannot be
+// read or written
+func scriptsUnavailable(c *fiber.Ctx, err error) error {
+	log.WithError(err).Error("Failed to access extraction scripts")
+	return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Extraction scripts are currently unavailable", nil)
+}
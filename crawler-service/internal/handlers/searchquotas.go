@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetSearchQuotas reports how much of each search provider's daily quota
+// is left, and how often its cached responses were reused
+func GetSearchQuotas(c *fiber.Ctx) error {
+	usage := crawlerService.SearchProviders().Usage()
+	return c.JSON(fiber.Map{
+		"providers": usage,
+		"total":     len(usage),
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkpointWait is how long a shutdown waits for checkpointed crawls to
+// save their results
+const checkpointWait = 15 * time.Second
+
+// Shutdown drains the job queue before the process exits. New submissions
+// are rejected as in maintenance mode and queued jobs that never started
+// are cancelled. Running jobs may finish until ctx is done; those still
+// running then are checkpointed, so they can be continued elsewhere. The
+// headless browser is stopped last.
+func Shutdown(ctx context.Context) {
+	defer crawlerService.StopRendering()
+
+	maintenance.Lock()
+	if !maintenance.enabled {
+		maintenance.enabled = true
+		maintenance.since = time.Now().UTC()
+		maintenance.reason = "shutting down"
+	}
+	maintenance.Unlock()
+
+	queued, running, _ := queue.Stats()
+	log.WithFields(log.Fields{
+		"queued":  queued,
+		"running": running,
+	}).Warn("Draining job queue")
+
+	dropped, err := queue.Drain(ctx)
+	for _, id := range dropped {
+		job, exists := jobs.Get(id)
+		if !exists || job.Status != "pending" {
+			continue
+		}
+		job.Status = "cancelled"
+		job.Error = "service shut down before the job started"
+		job.ErrorCode = errcode.Maintenance
+		job.CompletedAt = time.Now().UTC()
+		saveJob(job)
+	}
+	if err == nil {
+		return
+	}
+
+	ids := crawlerService.Checkpoint()
+	log.WithField("jobs", ids).Warn("Drain timed out, checkpointed running jobs")
+	wait, cancel := context.WithTimeout(context.Background(), checkpointWait)
+	defer cancel()
+	if _, err := queue.Drain(wait); err != nil {
+		log.WithError(err).Error("Checkpointed jobs did not finish saving")
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Similar job reports look back similarDays days by default, up to
+// maxSimilarDays, and list the similarLimit jobs overlapping the proposal
+// by at least similarMinOverlap
+const (
+	similarDays       = 90
+	maxSimilarDays    = 3650
+	similarLimit      = 10
+	maxSimilarLimit   = 100
+	similarMinOverlap = 0.3
+)
+
+// crawlTerms returns the terms a crawl is compared by: its lower-cased
+// query words and, for each seed URL, its host and its host and path
+func crawlTerms(req models.CrawlRequest) map[string]bool {
+	terms := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(req.Query), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	for _, word := range append(words, req.SeedURLs...) {
+		if !strings.Contains(word, "://") {
+			terms[word] = true
+			continue
+		}
+		u, err := url.Parse(strings.ToLower(word))
+		if err != nil || u.Host == "" {
+			continue
+		}
+		host := strings.TrimPrefix(u.Hostname(), "www.")
+		terms[host] = true
+		if path := strings.TrimSuffix(u.EscapedPath(), "/"); path != "" {
+			terms[host+path] = true
+		}
+	}
+	return terms
+}
+
+// termOverlap returns the Jaccard similarity of two term sets and the terms
+// they share, sorted
+func termOverlap(a, b map[string]bool) (float64, []string) {
+	var shared []string
+	for term := range a {
+		if b[term] {
+			shared = append(shared, term)
+		}
+	}
+	union := len(a) + len(b) - len(shared)
+	if union == 0 {
+		return 0, nil
+	}
+	sort.Strings(shared)
+	return float64(len(shared)) / float64(union), shared
+}
+
+// similarJobs returns the tenant's jobs of the same kind started since
+// cutoff whose crawl overlaps the proposed one by at least minOverlap, most
+// similar and then most recent first
+func similarJobs(req models.CrawlRequest, cutoff time.Time, minOverlap float64) ([]models.SimilarJob, error) {
+	recent, err := jobs.Find(store.JobFilter{Tenant: req.Tenant, Since: cutoff})
+	if err != nil {
+		return nil, err
+	}
+	proposed := crawlTerms(req)
+	fingerprint := requestFingerprint(req)
+	now := time.Now()
+
+	var found []models.SimilarJob
+	for _, job := range recent {
+		if job.Tenant != req.Tenant || job.Type != req.Type || job.Mode != req.Mode || job.DeletedAt != nil {
+			continue
+		}
+
+		past := models.CrawlRequest{Query: job.Query}
+		if job.Options != nil {
+			past = *job.Options
+		}
+		similarity, shared := termOverlap(proposed, crawlTerms(past))
+		if similarity < minOverlap {
+			continue
+		}
+
+		found = append(found, models.SimilarJob{
+			JobID:        job.ID,
+			Query:        job.Query,
+			Status:       job.Status,
+			Similarity:   math.Round(similarity*1000) / 1000,
+			SharedTerms:  shared,
+			SameRequest:  job.Options != nil && fingerprint != nil && bytes.Equal(requestFingerprint(*job.Options), fingerprint),
+			StartedAt:    job.StartedAt,
+			CompletedAt:  job.CompletedAt,
+			AgeHours:     math.Round(now.Sub(job.StartedAt).Hours()*10) / 10,
+			PagesCrawled: job.PagesCrawled,
+			URLsFound:    job.URLsFound,
+			Partial:      job.Partial,
+			ErrorCode:    job.ErrorCode,
+		})
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Similarity != found[j].Similarity {
+			return found[i].Similarity > found[j].Similarity
+		}
+		return found[i].StartedAt.After(found[j].StartedAt)
+	})
+	return found, nil
+}
+
+// FindSimilarJobs reports the past jobs resembling a proposed crawl request
+// and how they ended, so a team can reuse one instead of collecting the
+// same data again. The request is not started.
+func FindSimilarJobs(c *fiber.Ctx) error {
+	var req models.CrawlRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+	if req.Type == "" {
+		req.Type = models.JobTypeCrawl
+	}
+	if req.Tenant == "" {
+		req.Tenant = boundTenant(c)
+	}
+	if req.Tenant == "" {
+		req.Tenant = defaultTenant
+	}
+	if ok, err := authorizeTenant(c, req.Tenant); !ok {
+		return err
+	}
+	if req.Query == "" && len(req.SeedURLs) == 0 {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Query or seed_urls is required", nil)
+	}
+	// Crawls of seeds alone are recorded with the seeds as their query
+	if req.Query == "" {
+		req.Query = strings.Join(req.SeedURLs, ", ")
+	}
+
+	days := c.QueryInt("days", similarDays)
+	if days < 1 || days > maxSimilarDays {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("days must be between 1 and %d", maxSimilarDays), nil)
+	}
+	limit := c.QueryInt("limit", similarLimit)
+	if limit < 1 || limit > maxSimilarLimit {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxSimilarLimit), nil)
+	}
+	minOverlap := similarMinOverlap
+	if raw := c.Query("min_similarity"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v <= 0 || v > 1 {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "min_similarity must be greater than 0 and at most 1", nil)
+		}
+		minOverlap = v
+	}
+
+	found, err := similarJobs(req, time.Now().AddDate(0, 0, -days), minOverlap)
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+	total := len(found)
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	if found == nil {
+		found = []models.SimilarJob{}
+	}
+
+	return c.JSON(models.SimilarJobsResponse{
+		Query: req.Query,
+		Days:  days,
+		Total: total,
+		Jobs:  found,
+	})
+}
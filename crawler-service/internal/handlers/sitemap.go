@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// sitemapBuilder files results into a tree of domains and path segments
+type sitemapBuilder struct {
+	domains map[string]*models.SitemapNode
+	// children indexes each node's children by name
+	children map[*models.SitemapNode]map[string]*models.SitemapNode
+	// depth is how many path segments deep the tree goes; results deeper
+	// are counted at the last level. Zero is unlimited.
+	depth int
+}
+
+func newSitemapBuilder(depth int) *sitemapBuilder {
+	return &sitemapBuilder{
+		domains:  make(map[string]*models.SitemapNode),
+		children: make(map[*models.SitemapNode]map[string]*models.SitemapNode),
+		depth:    depth,
+	}
+}
+
+// add files a result under its host and path, counting it on every node
+// on the way
+func (b *sitemapBuilder) add(result models.CrawlResult) bool {
+	u, err := url.Parse(result.URL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	node, ok := b.domains[host]
+	if !ok {
+		node = &models.SitemapNode{Name: host, Path: "/"}
+		b.domains[host] = node
+	}
+	node.Pages++
+
+	var segments []string
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	deeper := b.depth > 0 && len(segments) > b.depth
+	if deeper {
+		segments = segments[:b.depth]
+	}
+
+	path := ""
+	for _, segment := range segments {
+		path += "/" + segment
+		byName, ok := b.children[node]
+		if !ok {
+			byName = make(map[string]*models.SitemapNode)
+			b.children[node] = byName
+		}
+		child, ok := byName[segment]
+		if !ok {
+			name := segment
+			if unescaped, err := url.PathUnescape(segment); err == nil {
+				name = unescaped
+			}
+			child = &models.SitemapNode{Name: name, Path: path}
+			byName[segment] = child
+			node.Children = append(node.Children, child)
+		}
+		child.Pages++
+		node = child
+	}
+
+	// Of several results at one node, e.g. differing in their query, the
+	// first names it
+	if !deeper && node.URL == "" {
+		node.URL = result.URL
+		node.Title = result.Title
+	}
+	return true
+}
+
+// tree returns the domains, most pages first, with their children sorted
+// by name
+func (b *sitemapBuilder) tree() []*models.SitemapNode {
+	domains := make([]*models.SitemapNode, 0, len(b.domains))
+	for _, node := range b.domains {
+		sortSitemap(node)
+		domains = append(domains, node)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Pages != domains[j].Pages {
+			return domains[i].Pages > domains[j].Pages
+		}
+		return domains[i].Name < domains[j].Name
+	})
+	return domains
+}
+
+func sortSitemap(node *models.SitemapNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		return node.Children[i].Name < node.Children[j].Name
+	})
+	for _, child := range node.Children {
+		sortSitemap(child)
+	}
+}
+
+// GetJobSitemap organises a job's results into a tree of domains and URL
+// path segments, counting the pages at or below each node. depth limits
+// how many path segments deep the tree goes.
+func GetJobSitemap(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	depth := c.QueryInt("depth")
+	if depth < 0 {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "depth must not be negative", nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load job results")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	results = roleMask(c).Apply(results)
+
+	builder := newSitemapBuilder(depth)
+	total := 0
+	for _, result := range results {
+		if builder.add(result) {
+			total++
+		}
+	}
+
+	return c.JSON(models.SitemapResponse{
+		JobID:   job.ID,
+		Total:   total,
+		Domains: builder.tree(),
+	})
+}
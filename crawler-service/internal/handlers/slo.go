@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/slo"
+	"definitelynotaspy/crawler-service/internal/store"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sloAlerts holds the operational alerts raised for each tenant
+var sloAlerts = slo.NewAlertLog()
+
+// SLOAlerts logs the operational alerts raised for tenants, stalled jobs
+// and budget thresholds crossed, for their service level reports
+func SLOAlerts(e events.Event) {
+	if (e.Type != events.JobStalled && e.Type != events.BudgetThreshold) || e.Tenant == "" {
+		return
+	}
+	at := e.Time
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+	// Writing to Redis from within a handler would hold up the bus
+	go sloAlerts.Record(e.Tenant, slo.Alert{Type: e.Type, JobID: e.JobID, Time: at})
+}
+
+// GetTenantSLO reports a tenant's service level over rolling windows: job
+// success and failure rates against SLO_SUCCESS_TARGET, the error budget
+// left, crawl times and the alerts raised
+func GetTenantSLO(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+	cfg := slo.ConfigFromEnv()
+	now := time.Now().UTC()
+
+	longest := cfg.Windows[0].Duration
+	for _, w := range cfg.Windows {
+		if w.Duration > longest {
+			longest = w.Duration
+		}
+	}
+
+	tenantJobs, err := jobs.Find(store.JobFilter{Tenant: tenant})
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+	alerts := sloAlerts.Since(tenant, now.Add(-longest))
+	return c.JSON(slo.Build(tenant, tenantJobs, alerts, cfg, now))
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bufio"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/fieldmask"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// streamQueueSize bounds the events held for a client that reads
+	// slower than the crawl makes them
+	streamQueueSize = 256
+	// streamHeartbeat is how often an idle stream sends a comment, so
+	// proxies do not close it
+	streamHeartbeat = 15 * time.Second
+)
+
+// StreamJob pushes a job's progress as Server-Sent Events. The stream
+// opens with a status snapshot, then carries job.status, page.crawled,
+// page.failed and url.discovered events as the crawl makes them, and
+// ends after job.finished. Events are dropped rather than holding up the
+// crawl when the client falls behind; a fresh snapshot then follows.
+func StreamJob(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	mask := roleMask(c)
+
+	// Subscribe before the snapshot is taken, so no event falls between
+	queue := make(chan events.Event, streamQueueSize)
+	var dropped int32
+	unsubscribe := crawlerService.Events().Subscribe(func(e events.Event) {
+		if e.JobID != job.ID {
+			return
+		}
+		select {
+		case queue <- e:
+		default:
+			atomic.StoreInt32(&dropped, 1)
+		}
+	})
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		id := 0
+		send := func(event string, data interface{}) error {
+			body, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			id++
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, body); err != nil {
+				return err
+			}
+			return w.Flush()
+		}
+		snapshot := func() error {
+			return send("snapshot", jobStatus(job))
+		}
+
+		if err := snapshot(); err != nil || jobDone(job) {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case e := <-queue:
+				if err := send(e.Type, streamEvent(e, mask)); err != nil {
+					return
+				}
+				if e.Type == events.JobFinished {
+					return
+				}
+				if atomic.CompareAndSwapInt32(&dropped, 1, 0) {
+					if err := snapshot(); err != nil {
+						return
+					}
+				}
+			case <-heartbeat.C:
+				if _, err := w.WriteString(": heartbeat\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+				// A job that finished on another instance publishes nothing
+				// here
+				if jobDone(job) {
+					snapshot()
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// streamEvent trims an event for a progress stream: crawled pages are
+// reduced to what a dashboard shows, after the caller's field mask
+func streamEvent(e events.Event, mask *fieldmask.Rule) events.Event {
+	result, ok := e.Data["result"].(models.CrawlResult)
+	if e.Type != events.PageCrawled || !ok {
+		return e
+	}
+	masked := mask.Apply([]models.CrawlResult{result})[0]
+	e.Data = map[string]interface{}{
+		"url":           masked.URL,
+		"title":         masked.Title,
+		"status_code":   masked.StatusCode,
+		"quality_score": masked.QualityScore,
+	}
+	return e
+}
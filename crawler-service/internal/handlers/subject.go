@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// minSubjectQuery is the shortest identifier a data-subject search accepts,
+// so a stray short query cannot flag most of a tenant's data
+const minSubjectQuery = 3
+
+// subjectMatch is a page whose stored data mentions the searched identifier
+type subjectMatch struct {
+	URL       string   `json:"url"`
+	Locations []string `json:"locations"`
+}
+
+// subjectJob lists the matches found in one job
+type subjectJob struct {
+	JobID      string         `json:"job_id"`
+	ExternalID string         `json:"external_id,omitempty"`
+	CaseID     string         `json:"case_id,omitempty"`
+	Deleted    bool           `json:"deleted"`
+	PurgeURL   string         `json:"purge_url"`
+	Matches    []subjectMatch `json:"matches"`
+}
+
+// SearchDataSubject searches every stored result of a tenant, soft-deleted
+// jobs included, for an identifier such as an email address or a name and
+// reports where it appears. Each matching job carries the URL that purges
+// it. With archives=true archived page HTML is searched as well.
+func SearchDataSubject(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	query := strings.TrimSpace(c.Query("q"))
+	if len(query) < minSubjectQuery {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, fmt.Sprintf("q must be at least %d characters", minSubjectQuery), nil)
+	}
+	needle := strings.ToLower(query)
+	archives := c.QueryBool("archives")
+
+	var found []subjectJob
+	var failed []string
+	tenantJobs, err := jobs.Find(store.JobFilter{Tenant: tenant})
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+	searched, total := 0, 0
+	for _, job := range tenantJobs {
+		searched++
+
+		results, err := crawlerService.JobResults(job)
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to load results for data-subject search")
+			failed = append(failed, job.ID)
+			continue
+		}
+
+		var matches []subjectMatch
+		for _, result := range results {
+			locations := subjectLocations(result, needle)
+			if archives && result.HTMLRef != "" && ownsArtifact(job, result.HTMLRef) {
+				if html, err := crawlerService.Archive().Load(result.HTMLRef); err == nil && strings.Contains(strings.ToLower(string(html)), needle) {
+					locations = append(locations, "archive")
+				}
+			}
+			if len(locations) > 0 {
+				matches = append(matches, subjectMatch{URL: result.URL, Locations: locations})
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		total += len(matches)
+		found = append(found, subjectJob{
+			JobID:      job.ID,
+			ExternalID: job.ExternalID,
+			CaseID:     job.CaseID,
+			Deleted:    job.DeletedAt != nil,
+			PurgeURL:   fmt.Sprintf("/api/%s/jobs/%s?purge=true", models.APIVersion2, job.ID),
+			Matches:    matches,
+		})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].JobID < found[j].JobID })
+	sort.Strings(failed)
+
+	// The identifier itself is personal data, so only the outcome is audited
+	crawlerService.Audit().Append(audit.Record{
+		Action: "subject.search",
+		Tenant: tenant,
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"jobs_searched": searched,
+			"jobs_matched":  len(found),
+			"matches":       total,
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"tenant":        tenant,
+		"jobs_searched": searched,
+		"total_matches": total,
+		"jobs":          found,
+		"unsearchable":  failed,
+	})
+}
+
+// subjectLocations returns the parts of a result that mention needle, which
+// must already be lower-case
+func subjectLocations(result models.CrawlResult, needle string) []string {
+	contains := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), needle)
+	}
+
+	var locations []string
+	if contains(result.URL) {
+		locations = append(locations, "url")
+	}
+	if contains(result.Title) {
+		locations = append(locations, "title")
+	}
+	if contains(result.Content) {
+		locations = append(locations, "content")
+	}
+	for _, email := range result.Emails {
+		if contains(email.Address) {
+			locations = append(locations, "emails")
+			break
+		}
+	}
+	for _, link := range result.Links {
+		if contains(link.URL) || contains(link.Text) {
+			locations = append(locations, "links")
+			break
+		}
+	}
+
+	names := make([]string, 0, len(result.Fields))
+	for name := range result.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if contains(result.Fields[name]) {
+			locations = append(locations, "fields."+name)
+		}
+	}
+	return locations
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/timeline"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetJobTimeline returns a job's crawls and the dates found on its pages in
+// chronological order
+func GetJobTimeline(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+
+	job, exists := findJob(c, jobID)
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", jobID).Error("Failed to load job results")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	results = roleMask(c).Apply(results)
+
+	entries := timeline.Build(results)
+	response := fiber.Map{
+		"job_id":  job.ID,
+		"total":   len(entries),
+		"entries": entries,
+	}
+	if len(entries) > 0 {
+		response["start"] = entries[0].Time
+		response["end"] = entries[len(entries)-1].Time
+	}
+	return c.JSON(response)
+}
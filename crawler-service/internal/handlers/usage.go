@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTenantUsage returns stored content usage and quota for a tenant
+func GetTenantUsage(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+	tracker := crawlerService.Quota()
+
+	tenantJobs, err := jobs.Find(store.JobFilter{Tenant: tenant})
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+
+	return c.JSON(fiber.Map{
+		"tenant":      tenant,
+		"jobs":        len(tenantJobs),
+		"used_bytes":  tracker.TenantUsage(tenant),
+		"quota_bytes": tracker.TenantLimit(),
+		"exceeded":    tracker.TenantExceeded(tenant),
+		"quota_mode":  tracker.Mode(),
+		"enrichment": fiber.Map{
+			"lookups_today": crawlerService.Enricher().Usage(tenant),
+			"daily_limit":   crawlerService.Enricher().DailyLimit(),
+		},
+	})
+}
+
+// jobUsage is the cost of one job in a usage export
+type jobUsage struct {
+	JobID     string         `json:"job_id"`
+	Mode      string         `json:"mode"`
+	Status    string         `json:"status"`
+	StartedAt time.Time      `json:"started_at"`
+	Cost      models.JobCost `json:"cost"`
+}
+
+// ExportTenantUsage exports the resources consumed by a tenant's jobs
+// started in a calendar month (month=YYYY-MM, UTC, by default the current
+// one) for chargeback: one row per job and their totals, as JSON or, with
+// format=csv, as a CSV file whose last row holds the totals
+func ExportTenantUsage(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+
+	month := currentMonth()
+	if raw := c.Query("month"); raw != "" {
+		parsed, err := time.Parse("2006-01", raw)
+		if err != nil {
+			return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "month must be formatted YYYY-MM", fiber.Map{
+				"month": raw,
+			})
+		}
+		month = parsed
+	}
+	rows, total, err := tenantMonthUsage(tenant, month)
+	if err != nil {
+		return respondAPIError(c, jobsUnavailable(err))
+	}
+
+	period := month.Format("2006-01")
+	if c.Query("format") == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="usage-%s-%s.csv"`, tenant, period))
+
+		// Each external service gets a column
+		services := make([]string, 0, len(total.APICalls))
+		for service := range total.APICalls {
+			services = append(services, service)
+		}
+		sort.Strings(services)
+
+		w := csv.NewWriter(c.Response().BodyWriter())
+		header := []string{"job_id", "mode", "status", "started_at", "pages", "requests", "bytes", "proxy_bytes", "render_minutes"}
+		for _, service := range services {
+			header = append(header, "api_"+service)
+		}
+		w.Write(header)
+		record := func(id, mode, status, started string, cost models.JobCost) {
+			row := []string{id, mode, status, started,
+				strconv.Itoa(cost.Pages),
+				strconv.Itoa(cost.Requests),
+				strconv.FormatInt(cost.Bytes, 10),
+				strconv.FormatInt(cost.ProxyBytes, 10),
+				strconv.FormatFloat(cost.RenderMinutes, 'f', 2, 64),
+			}
+			for _, service := range services {
+				row = append(row, strconv.Itoa(cost.APICalls[service]))
+			}
+			w.Write(row)
+		}
+		for _, row := range rows {
+			record(row.JobID, row.Mode, row.Status, row.StartedAt.Format(time.RFC3339), row.Cost)
+		}
+		record("total", "", "", "", total)
+		w.Flush()
+		return w.Error()
+	}
+
+	return c.JSON(fiber.Map{
+		"tenant": tenant,
+		"month":  period,
+		"jobs":   rows,
+		"total":  total,
+	})
+}
+
+// tenantMonthUsage returns the cost of each of a tenant's jobs started in
+// the month beginning at month, oldest first, and their total. Deleted jobs
+// count too: their resources were consumed.
+func tenantMonthUsage(tenant string, month time.Time) ([]jobUsage, models.JobCost, error) {
+	started, err := jobs.Find(store.JobFilter{Tenant: tenant, Since: month})
+	if err != nil {
+		return nil, models.JobCost{}, err
+	}
+	end := month.AddDate(0, 1, 0)
+
+	var rows []jobUsage
+	total := models.JobCost{APICalls: make(map[string]int)}
+	for _, job := range started {
+		if job.Tenant != tenant || !job.StartedAt.Before(end) {
+			continue
+		}
+		cost := crawlerService.JobCost(job)
+		rows = append(rows, jobUsage{
+			JobID:     job.ID,
+			Mode:      job.Mode,
+			Status:    job.Status,
+			StartedAt: job.StartedAt,
+			Cost:      cost,
+		})
+		total.Pages += cost.Pages
+		total.Requests += cost.Requests
+		total.Bytes += cost.Bytes
+		total.ProxyBytes += cost.ProxyBytes
+		total.RenderMinutes += cost.RenderMinutes
+		for service, n := range cost.APICalls {
+			total.APICalls[service] += n
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].StartedAt.Equal(rows[j].StartedAt) {
+			return rows[i].StartedAt.Before(rows[j].StartedAt)
+		}
+		return rows[i].JobID < rows[j].JobID
+	})
+	return rows, total, nil
+}
+
+// currentMonth returns the start of the current calendar month, UTC
+func currentMonth() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// GetTenantAudit returns the audit records of a tenant
+func GetTenantAudit(c *fiber.Ctx) error {
+	tenant := c.Params("id")
+	if ok, err := authorizeTenant(c, tenant); !ok {
+		return err
+	}
+
+	records, err := crawlerService.Audit().Records(tenant)
+	if err != nil {
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, err.Error(), nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"tenant":  tenant,
+		"total":   len(records),
+		"records": records,
+	})
+}
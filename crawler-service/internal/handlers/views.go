@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/audit"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/fieldmask"
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/views"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// viewRequest saves a named filter over a job's results
+type viewRequest struct {
+	Name   string       `json:"name"`
+	Filter views.Filter `json:"filter"`
+}
+
+// sharePath is where a view's share token opens it
+func sharePath(c *fiber.Ctx, view *views.View) string {
+	return "/api/" + apiVersion(c) + "/shared/" + view.Token
+}
+
+// viewResults returns the page of a job's results a view selects, masked
+// for role
+func viewResults(c *fiber.Ctx, job *models.CrawlJob, view *views.View, mask *fieldmask.Rule) error {
+	offset, limit := c.QueryInt("offset"), c.QueryInt("limit")
+	if offset < 0 || limit < 0 {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "offset and limit must not be negative", nil)
+	}
+
+	results, err := crawlerService.JobResults(job)
+	if err != nil {
+		log.WithError(err).WithField("job_id", job.ID).Error("Failed to load job results")
+		return respondError(c, fiber.StatusServiceUnavailable, errcode.Unavailable, "Job results are currently unavailable", nil)
+	}
+	// Filter before masking, so hidden fields still select results but are
+	// not shown
+	results = mask.Apply(view.Filter.Apply(results))
+
+	total := len(results)
+	if offset > total {
+		offset = total
+	}
+	page := results[offset:]
+	if limit > 0 && limit < len(page) {
+		page = page[:limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"job_id":  job.ID,
+		"view":    view.Name,
+		"filter":  view.Filter,
+		"total":   total,
+		"offset":  offset,
+		"results": page,
+	})
+}
+
+// CreateView saves a named filter over a job's results, with a token that
+// opens it read-only for anyone it is shared with
+func CreateView(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists || job.DeletedAt != nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	var req viewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "Invalid request body", nil)
+	}
+	view, err := views.New(job.ID, req.Name, requestRole(c), req.Filter)
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, err.Error(), nil)
+	}
+	if err := crawlerService.Views().Put(*view); err != nil {
+		log.WithError(err).WithField("job_id", job.ID).Error("Failed to persist view")
+		return respondError(c, fiber.StatusInternalServerError, errcode.Internal, "Failed to save view", nil)
+	}
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "view.share",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"job_id":  job.ID,
+			"view_id": view.ID,
+			"name":    view.Name,
+		},
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"view":       view,
+		"share_path": sharePath(c, view),
+	})
+}
+
+// ListViews returns a job's saved views
+func ListViews(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	list := crawlerService.Views().ForJob(job.ID)
+	return c.JSON(fiber.Map{
+		"job_id": job.ID,
+		"total":  len(list),
+		"views":  list,
+	})
+}
+
+// GetViewResults returns the results a saved view selects
+func GetViewResults(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+	view, ok := crawlerService.Views().Get(c.Params("view"))
+	if !ok || view.JobID != job.ID {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "View not found", nil)
+	}
+	return viewResults(c, job, view, roleMask(c))
+}
+
+// DeleteView removes a saved view, revoking its share link
+func DeleteView(c *fiber.Ctx) error {
+	view, ok := crawlerService.Views().Get(c.Params("view"))
+	if !ok || view.JobID != c.Params("id") {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "View not found", nil)
+	}
+	crawlerService.Views().Delete(view.ID)
+
+	crawlerService.Audit().Append(audit.Record{
+		Action: "view.revoke",
+		Actor:  c.Get("X-Actor", c.IP()),
+		Details: map[string]interface{}{
+			"job_id":  view.JobID,
+			"view_id": view.ID,
+		},
+	})
+
+	return c.JSON(models.DeletedResponse{
+		ID:      view.ID,
+		Deleted: true,
+		Message: "View deleted, its share link no longer works",
+	})
+}
+
+// GetSharedView opens a shared view by its token. The results are masked
+// for the role of the view's creator, so a link never shows more than its
+// creator could see.
+func GetSharedView(c *fiber.Ctx) error {
+	view, ok := crawlerService.Views().ByToken(c.Params("token"))
+	if !ok {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Shared view not found", nil)
+	}
+	job, exists := jobs.Get(view.JobID)
+	if !exists || job.DeletedAt != nil {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Shared view not found", nil)
+	}
+	return viewResults(c, job, view, crawlerService.FieldMasks().ForRole(view.Role))
+}
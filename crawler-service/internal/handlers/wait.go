@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Wait timeouts: the default and the longest a request may block
+const (
+	defaultWait = 30 * time.Second
+	maxWait     = 5 * time.Minute
+)
+
+// waitPollInterval is how often a waiting request rechecks the job, for
+// job types that finish without announcing it
+const waitPollInterval = time.Second
+
+// WaitForJob blocks until a job reaches a final status or the timeout
+// (e.g. timeout=60s, or seconds; default 30s, at most 5m) expires, then
+// returns its status: 200 when it finished, 202 when it is still going
+func WaitForJob(c *fiber.Ctx) error {
+	job, exists := findJob(c, c.Params("id"))
+	if !exists {
+		return respondError(c, fiber.StatusNotFound, errcode.NotFound, "Job not found", nil)
+	}
+
+	timeout, err := waitTimeout(c.Query("timeout"))
+	if err != nil {
+		return respondError(c, fiber.StatusBadRequest, errcode.InvalidRequest, "timeout must be a positive duration such as 60s", nil)
+	}
+
+	finished := make(chan struct{}, 1)
+	unsubscribe := crawlerService.Events().Subscribe(func(e events.Event) {
+		if e.Type == events.JobFinished && e.JobID == job.ID {
+			select {
+			case finished <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer unsubscribe()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for !jobDone(job) {
+		select {
+		case <-finished:
+		case <-ticker.C:
+		case <-deadline.C:
+			return c.Status(fiber.StatusAccepted).JSON(jobStatus(job))
+		case <-c.Context().Done():
+			return nil
+		}
+	}
+	return c.JSON(jobStatus(job))
+}
+
+// waitTimeout parses the timeout of a wait request
+func waitTimeout(raw string) (time.Duration, error) {
+	if raw == "" {
+		return defaultWait, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(raw)
+		if convErr != nil {
+			return 0, err
+		}
+		d = time.Duration(seconds) * time.Second
+	}
+	if d <= 0 {
+		return 0, strconv.ErrRange
+	}
+	if d > maxWait {
+		d = maxWait
+	}
+	return d, nil
+}
+
+// jobDone reports whether a job reached a final status
+func jobDone(job *models.CrawlJob) bool {
+	switch job.Status {
+	case "completed", "failed", "cancelled":
+		return true
+	}
+	return false
+}
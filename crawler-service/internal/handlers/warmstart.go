@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"definitelynotaspy/crawler-service/internal/store"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A warm start seeds a crawl with at most warmStartSeeds of the prior
+// crawl's pages, those scoring at least warmStartMinQuality
+const (
+	warmStartSeeds      = 25
+	warmStartMinQuality = 0.5
+)
+
+// priorCrawl returns the tenant's most recently finished crawl of the same
+// query that kept results, or nil
+func priorCrawl(req models.CrawlRequest) (*models.CrawlJob, error) {
+	tenantJobs, err := jobs.Find(store.JobFilter{Tenant: req.Tenant})
+	if err != nil {
+		return nil, err
+	}
+	query := strings.ToLower(strings.TrimSpace(req.Query))
+	var prior *models.CrawlJob
+	for _, job := range tenantJobs {
+		if job.Tenant != req.Tenant || job.Type != models.JobTypeCrawl || job.Mode != "" || job.DeletedAt != nil {
+			continue
+		}
+		if strings.ToLower(strings.TrimSpace(job.Query)) != query {
+			continue
+		}
+		if job.Status != "completed" && !job.Partial {
+			continue
+		}
+		if prior == nil || job.CompletedAt.After(prior.CompletedAt) {
+			prior = job
+		}
+	}
+	return prior, nil
+}
+
+// warmSeeds returns the URLs of a prior crawl's most relevant pages, best
+// first. Error pages, soft 404s, parked domains and duplicates are left out.
+func warmSeeds(prior *models.CrawlJob) []string {
+	results, err := crawlerService.JobResults(prior)
+	if err != nil {
+		log.WithError(err).WithField("job_id", prior.ID).Warn("Failed to load results of prior crawl")
+		return nil
+	}
+
+	var candidates []models.CrawlResult
+	for _, r := range results {
+		if r.Error != "" || r.StatusCode >= 400 || r.Soft404 || r.Parked || r.DuplicateOf != "" {
+			continue
+		}
+		if r.QualityScore < warmStartMinQuality {
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].QualityScore > candidates[j].QualityScore
+	})
+	if len(candidates) > warmStartSeeds {
+		candidates = candidates[:warmStartSeeds]
+	}
+
+	seeds := make([]string, len(candidates))
+	for i, r := range candidates {
+		seeds[i] = r.URL
+	}
+	return seeds
+}
@@ -0,0 +1,250 @@
+package hibp
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Breach summarises a breach an address appeared in
+type Breach struct {
+	Name        string   `json:"name"`
+	Title       string   `json:"title,omitempty"`
+	Domain      string   `json:"domain,omitempty"`
+	BreachDate  string   `json:"breach_date,omitempty"`
+	DataClasses []string `json:"data_classes,omitempty"`
+}
+
+// Client queries the Have I Been Pwned v3 API. Requests are spaced to stay
+// within the subscription's rate limit and answers are cached per address.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	kAnonymity bool
+	http       *http.Client
+
+	rateMu   sync.Mutex
+	interval time.Duration
+	next     time.Time
+
+	cacheMu  sync.Mutex
+	cache    map[string]cachedBreaches
+	cacheTTL time.Duration
+}
+
+type cachedBreaches struct {
+	breaches []Breach
+	expires  time.Time
+}
+
+// NewClientFromEnv returns a client when HIBP_API_KEY is set, or nil.
+// HIBP_RATE_PER_MINUTE matches the subscription (default 10) and
+// HIBP_K_ANONYMITY=true queries by hash prefix so full addresses never
+// leave the service.
+func NewClientFromEnv() *Client {
+	key := os.Getenv("HIBP_API_KEY")
+	if key == "" {
+		return nil
+	}
+
+	rate := 10
+	if n, err := strconv.Atoi(os.Getenv("HIBP_RATE_PER_MINUTE")); err == nil && n > 0 {
+		rate = n
+	}
+	baseURL := os.Getenv("HIBP_API_URL")
+	if baseURL == "" {
+		baseURL = "https://haveibeenpwned.com/api/v3"
+	}
+
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     key,
+		kAnonymity: os.Getenv("HIBP_K_ANONYMITY") == "true",
+		http:       &http.Client{Timeout: 20 * time.Second},
+		interval:   time.Minute / time.Duration(rate),
+		cache:      make(map[string]cachedBreaches),
+		cacheTTL:   24 * time.Hour,
+	}
+}
+
+var emailPattern = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+
+// ExtractEmails returns up to limit distinct lower-cased addresses in text
+func ExtractEmails(text string, limit int) []string {
+	seen := make(map[string]bool)
+	var emails []string
+	for _, m := range emailPattern.FindAllString(text, -1) {
+		email := strings.ToLower(strings.TrimRight(m, "."))
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		emails = append(emails, email)
+		if len(emails) == limit {
+			break
+		}
+	}
+	return emails
+}
+
+// Breaches returns the breaches email appeared in
+func (c *Client) Breaches(ctx context.Context, email string) ([]Breach, error) {
+	email = strings.ToLower(email)
+
+	c.cacheMu.Lock()
+	entry, ok := c.cache[email]
+	c.cacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.breaches, nil
+	}
+
+	var breaches []Breach
+	var err error
+	if c.kAnonymity {
+		breaches, err = c.lookupRange(ctx, email)
+	} else {
+		breaches, err = c.lookupAccount(ctx, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.cacheMu.Lock()
+	c.cache[email] = cachedBreaches{breaches: breaches, expires: time.Now().Add(c.cacheTTL)}
+	c.cacheMu.Unlock()
+	return breaches, nil
+}
+
+// lookupAccount queries the breaches of a full address
+func (c *Client) lookupAccount(ctx context.Context, email string) ([]Breach, error) {
+	body, err := c.get(ctx, "/breachedaccount/"+url.PathEscape(email)+"?truncateResponse=false")
+	if err != nil || body == nil {
+		return nil, err
+	}
+
+	var res []struct {
+		Name        string   `json:"Name"`
+		Title       string   `json:"Title"`
+		Domain      string   `json:"Domain"`
+		BreachDate  string   `json:"BreachDate"`
+		DataClasses []string `json:"DataClasses"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("invalid HIBP response: %w", err)
+	}
+
+	breaches := make([]Breach, 0, len(res))
+	for _, b := range res {
+		breaches = append(breaches, Breach(b))
+	}
+	return breaches, nil
+}
+
+// lookupRange queries by the first six hex characters of the address's
+// SHA-1 and matches the returned suffixes locally
+func (c *Client) lookupRange(ctx context.Context, email string) ([]Breach, error) {
+	sum := sha1.Sum([]byte(email))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	body, err := c.get(ctx, "/breachedaccount/range/"+hash[:6])
+	if err != nil || body == nil {
+		return nil, err
+	}
+
+	var res []struct {
+		HashSuffix string   `json:"HashSuffix"`
+		Websites   []string `json:"Websites"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("invalid HIBP response: %w", err)
+	}
+
+	for _, r := range res {
+		if strings.EqualFold(r.HashSuffix, hash[6:]) {
+			breaches := make([]Breach, 0, len(r.Websites))
+			for _, name := range r.Websites {
+				breaches = append(breaches, Breach{Name: name})
+			}
+			return breaches, nil
+		}
+	}
+	return nil, nil
+}
+
+// get performs a rate-limited request, retrying once after a 429. A 404
+// (address not breached) yields a nil body.
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("hibp-api-key", c.apiKey)
+		req.Header.Set("User-Agent", "DefinitelyNotASpy-Crawler")
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return body, nil
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, nil
+		case resp.StatusCode == http.StatusTooManyRequests && attempt == 0:
+			retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			c.backoff(time.Duration(retryAfter+1) * time.Second)
+			continue
+		}
+		return nil, fmt.Errorf("HIBP returned %d: %.200s", resp.StatusCode, body)
+	}
+}
+
+// wait blocks until the next request slot is available
+func (c *Client) wait(ctx context.Context) error {
+	c.rateMu.Lock()
+	now := time.Now()
+	slot := c.next
+	if slot.Before(now) {
+		slot = now
+	}
+	c.next = slot.Add(c.interval)
+	c.rateMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(slot)):
+		return nil
+	}
+}
+
+// backoff delays all further requests by d
+func (c *Client) backoff(d time.Duration) {
+	c.rateMu.Lock()
+	defer c.rateMu.Unlock()
+	if until := time.Now().Add(d); until.After(c.next) {
+		c.next = until
+	}
+}
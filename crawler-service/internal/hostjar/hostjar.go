@@ -0,0 +1,168 @@
+// Package hostjar provides a cookie jar that keeps a separate jar for every
+// host, so a session one target sets is never sent to another, and that can
+// be saved and restored so resumed crawls keep their sessions.
+package hostjar
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Jar is an http.CookieJar isolating cookies per host
+type Jar struct {
+	mu   sync.Mutex
+	jars map[string]*cookiejar.Jar
+	// saved are the cookies each host set, keyed by host and then by
+	// domain, path and name, for Snapshot
+	saved map[string]map[string]models.JobCookie
+}
+
+// New returns a jar holding the given saved cookies
+func New(saved []models.JobCookie) *Jar {
+	j := &Jar{
+		jars:  make(map[string]*cookiejar.Jar),
+		saved: make(map[string]map[string]models.JobCookie),
+	}
+	for _, c := range saved {
+		if c.Expires != nil && c.Expires.Before(time.Now()) {
+			continue
+		}
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		u := &url.URL{Scheme: scheme, Host: c.Host, Path: c.Path}
+		j.SetCookies(u, []*http.Cookie{toHTTP(c)})
+	}
+	return j
+}
+
+// hostJar returns the jar of a host, creating it on first use
+func (j *Jar) hostJar(host string) *cookiejar.Jar {
+	jar, ok := j.jars[host]
+	if !ok {
+		jar, _ = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		j.jars[host] = jar
+	}
+	return jar
+}
+
+// SetCookies stores cookies a response from u set, in u's host jar only
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := strings.ToLower(u.Hostname())
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.hostJar(host).SetCookies(u, cookies)
+
+	saved, ok := j.saved[host]
+	if !ok {
+		saved = make(map[string]models.JobCookie)
+		j.saved[host] = saved
+	}
+	for _, c := range cookies {
+		stored := fromHTTP(host, u, c)
+		key := stored.Domain + ";" + stored.Path + ";" + stored.Name
+		if c.MaxAge < 0 || (stored.Expires != nil && stored.Expires.Before(time.Now())) {
+			delete(saved, key)
+			continue
+		}
+		saved[key] = stored
+	}
+}
+
+// Cookies returns the cookies to send to u, taken from u's host jar only
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jar, ok := j.jars[strings.ToLower(u.Hostname())]
+	if !ok {
+		return nil
+	}
+	return jar.Cookies(u)
+}
+
+// Snapshot returns every unexpired cookie in the jar, sorted by host and
+// name, for restoring with New
+func (j *Jar) Snapshot() []models.JobCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	var cookies []models.JobCookie
+	for _, saved := range j.saved {
+		for _, c := range saved {
+			if c.Expires != nil && c.Expires.Before(now) {
+				continue
+			}
+			cookies = append(cookies, c)
+		}
+	}
+	sort.Slice(cookies, func(a, b int) bool {
+		if cookies[a].Host != cookies[b].Host {
+			return cookies[a].Host < cookies[b].Host
+		}
+		if cookies[a].Name != cookies[b].Name {
+			return cookies[a].Name < cookies[b].Name
+		}
+		return cookies[a].Path < cookies[b].Path
+	})
+	return cookies
+}
+
+// fromHTTP records a cookie set by a response from u. A cookie without a
+// path gets the default path of u, as the jar applies it.
+func fromHTTP(host string, u *url.URL, c *http.Cookie) models.JobCookie {
+	stored := models.JobCookie{
+		Host:     host,
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	if stored.Path == "" || !strings.HasPrefix(stored.Path, "/") {
+		stored.Path = defaultPath(u.Path)
+	}
+	switch {
+	case c.MaxAge > 0:
+		expires := time.Now().Add(time.Duration(c.MaxAge) * time.Second).UTC()
+		stored.Expires = &expires
+	case !c.Expires.IsZero():
+		expires := c.Expires.UTC()
+		stored.Expires = &expires
+	}
+	return stored
+}
+
+func toHTTP(c models.JobCookie) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	if c.Expires != nil {
+		cookie.Expires = *c.Expires
+	}
+	return cookie
+}
+
+// defaultPath is the directory of a request path (RFC 6265 section 5.1.4)
+func defaultPath(p string) string {
+	i := strings.LastIndex(p, "/")
+	if i <= 0 || p[0] != '/' {
+		return "/"
+	}
+	return p[:i]
+}
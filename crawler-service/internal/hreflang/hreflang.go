@@ -0,0 +1,73 @@
+package hreflang
+
+import (
+	"net/url"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// XDefault is the hreflang value of the fallback version of a page
+const XDefault = "x-default"
+
+// Find returns the language of the page at pageURL and its hreflang
+// alternates in other languages. The page's language is taken from the
+// alternate pointing back at it, or else from <html lang>.
+func Find(doc *goquery.Selection, pageURL *url.URL) (string, []models.Alternate) {
+	self := pageURL.String()
+	lang := ""
+	var alternates []models.Alternate
+	seen := make(map[string]bool)
+
+	doc.Find(`link[rel~="alternate"][hreflang][href]`).Each(func(_ int, s *goquery.Selection) {
+		code := Normalize(s.AttrOr("hreflang", ""))
+		u, err := pageURL.Parse(strings.TrimSpace(s.AttrOr("href", "")))
+		if code == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		href := u.String()
+
+		if href == self {
+			if lang == "" && code != XDefault {
+				lang = code
+			}
+			return
+		}
+		if seen[code+" "+href] {
+			return
+		}
+		seen[code+" "+href] = true
+		alternates = append(alternates, models.Alternate{Language: code, URL: href})
+	})
+
+	if lang == "" {
+		html := doc.Closest("html")
+		if html.Length() == 0 {
+			html = doc.Find("html").First()
+		}
+		lang = Normalize(html.AttrOr("lang", ""))
+	}
+	return lang, alternates
+}
+
+// Normalize lower-cases a language tag and uses hyphens as separators
+func Normalize(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+// Match reports whether a language tag is one of the wanted languages. A
+// wanted language without a region matches every region of it, so "de"
+// matches "de-at".
+func Match(tag string, wanted []string) bool {
+	tag = Normalize(tag)
+	for _, w := range wanted {
+		w = Normalize(w)
+		if tag == w || (!strings.Contains(w, "-") && strings.HasPrefix(tag, w+"-")) {
+			return true
+		}
+	}
+	return false
+}
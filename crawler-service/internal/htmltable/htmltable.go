@@ -0,0 +1,228 @@
+package htmltable
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Limits applied per page
+const (
+	maxTables = 20
+	maxRows   = 500
+	maxSpan   = 50
+)
+
+// Header sources, recording how a table's headers were found
+const (
+	HeaderTHead    = "thead"
+	HeaderTH       = "th"
+	HeaderInferred = "inferred"
+)
+
+// Extract returns the data tables of a page as rows of cell text. Layout
+// tables (nested tables, a single row or a single column) are skipped.
+// Spanning cells are repeated in every row and column they cover, and
+// headers are taken from thead, a leading row of th cells or, failing
+// those, a first row of labels above numeric data.
+func Extract(doc *goquery.Selection) []models.Table {
+	var tables []models.Table
+	doc.Find("table").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if s.Find("table").Length() > 0 {
+			return true
+		}
+		if table, ok := extractTable(s); ok {
+			tables = append(tables, table)
+		}
+		return len(tables) < maxTables
+	})
+	return tables
+}
+
+// cell is one grid cell and whether it came from a th element
+type cell struct {
+	text   string
+	header bool
+}
+
+// pending carries a rowspan cell into later rows
+type pending struct {
+	cell
+	rows int
+}
+
+func extractTable(s *goquery.Selection) (models.Table, bool) {
+	table := models.Table{
+		Caption: clean(s.ChildrenFiltered("caption").First().Text()),
+		ID:      s.AttrOr("id", ""),
+	}
+
+	var grid [][]cell
+	spans := make(map[int]*pending)
+	theadRows := 0
+
+	s.Find("tr").EachWithBreak(func(_ int, tr *goquery.Selection) bool {
+		var row []cell
+		col := 0
+		fill := func() {
+			for p, ok := spans[col]; ok; p, ok = spans[col] {
+				row = append(row, p.cell)
+				if p.rows--; p.rows == 0 {
+					delete(spans, col)
+				}
+				col++
+			}
+		}
+
+		tr.ChildrenFiltered("th, td").Each(func(_ int, td *goquery.Selection) {
+			fill()
+			c := cell{text: clean(td.Text()), header: goquery.NodeName(td) == "th"}
+			colspan := span(td.AttrOr("colspan", "1"))
+			rowspan := span(td.AttrOr("rowspan", "1"))
+			for i := 0; i < colspan; i++ {
+				row = append(row, c)
+				if rowspan > 1 {
+					spans[col] = &pending{cell: c, rows: rowspan - 1}
+				}
+				col++
+			}
+		})
+		fill()
+
+		if len(row) > 0 {
+			if tr.ParentsFiltered("thead").Length() > 0 {
+				theadRows++
+			}
+			grid = append(grid, row)
+		}
+		return len(grid) < maxRows
+	})
+
+	width := 0
+	for _, row := range grid {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if len(grid) < 2 || width < 2 {
+		return table, false
+	}
+
+	body := grid
+	switch {
+	case theadRows > 0:
+		table.Headers = headers(grid[theadRows-1], width)
+		table.HeaderSource = HeaderTHead
+		body = grid[theadRows:]
+	case allHeaders(grid[0]):
+		table.Headers = headers(grid[0], width)
+		table.HeaderSource = HeaderTH
+		body = grid[1:]
+	case labelRow(grid):
+		table.Headers = headers(grid[0], width)
+		table.HeaderSource = HeaderInferred
+		body = grid[1:]
+	}
+
+	for _, row := range body {
+		values := make([]string, width)
+		for i, c := range row {
+			values[i] = c.text
+		}
+		table.Rows = append(table.Rows, values)
+	}
+	if len(table.Rows) == 0 {
+		return table, false
+	}
+	return table, true
+}
+
+// allHeaders reports whether every cell of a row is a th
+func allHeaders(row []cell) bool {
+	for _, c := range row {
+		if !c.header {
+			return false
+		}
+	}
+	return true
+}
+
+// labelRow reports whether the first row looks like column labels: every
+// cell is non-empty text and some column holding a label there holds
+// numbers in at least half of the rows below
+func labelRow(grid [][]cell) bool {
+	for _, c := range grid[0] {
+		if c.text == "" || numeric(c.text) {
+			return false
+		}
+	}
+
+	for col := range grid[0] {
+		numbers := 0
+		for _, row := range grid[1:] {
+			if col < len(row) && numeric(row[col].text) {
+				numbers++
+			}
+		}
+		if numbers > 0 && numbers*2 >= len(grid)-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// headers names the width columns of a table from its header row, filling
+// blanks and disambiguating repeats so headers can be used as keys
+func headers(row []cell, width int) []string {
+	names := make([]string, width)
+	seen := make(map[string]int)
+	for i := range names {
+		name := ""
+		if i < len(row) {
+			name = row[i].text
+		}
+		if name == "" {
+			name = "column_" + strconv.Itoa(i+1)
+		}
+		if seen[name]++; seen[name] > 1 {
+			name += "_" + strconv.Itoa(seen[name])
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// numeric reports whether s is a number, amount or percentage
+func numeric(s string) bool {
+	digits := 0
+	for _, r := range s {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case strings.ContainsRune(" .,-+%$€£¥()", r):
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// span parses a colspan or rowspan attribute
+func span(v string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 1 {
+		return 1
+	}
+	if n > maxSpan {
+		return maxSpan
+	}
+	return n
+}
+
+func clean(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
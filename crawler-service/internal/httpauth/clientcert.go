@@ -0,0 +1,62 @@
+package httpauth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// ClientCert is a TLS client certificate presented to hosts matching any of
+// Domains
+type ClientCert struct {
+	Domains []string
+	CertPEM string
+	KeyPEM  string
+}
+
+// CertTransport routes requests to hosts that require a client certificate
+// through a dedicated transport presenting it
+type CertTransport struct {
+	base   http.RoundTripper
+	routes []certRoute
+}
+
+type certRoute struct {
+	domains   []string
+	transport *http.Transport
+}
+
+// NewCertTransport builds a transport for each client certificate, cloned
+// from base
+func NewCertTransport(base *http.Transport, certs []ClientCert) (*CertTransport, error) {
+	t := &CertTransport{base: base}
+
+	for i, cc := range certs {
+		pair, err := tls.X509KeyPair([]byte(cc.CertPEM), []byte(cc.KeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate %d: %w", i, err)
+		}
+
+		transport := base.Clone()
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{pair}
+
+		t.routes = append(t.routes, certRoute{domains: cc.Domains, transport: transport})
+	}
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *CertTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	for _, route := range t.routes {
+		for _, domain := range route.domains {
+			if MatchDomain(domain, host) {
+				return route.transport.RoundTrip(req)
+			}
+		}
+	}
+	return t.base.RoundTrip(req)
+}
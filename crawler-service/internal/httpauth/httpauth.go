@@ -0,0 +1,240 @@
+package httpauth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Supported authentication schemes
+const (
+	Basic  = "basic"
+	Digest = "digest"
+	OAuth2 = "oauth2"
+)
+
+// Credential authenticates requests to hosts matching Domain. For OAuth2
+// client credentials, Username and Password are the client ID and secret
+// exchanged at TokenURL for a bearer token.
+type Credential struct {
+	Domain   string
+	Type     string
+	Username string
+	Password string
+	TokenURL string
+	Scopes   []string
+}
+
+// MatchDomain reports whether host matches a domain glob such as
+// example.com or *.example.com
+func MatchDomain(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	host = strings.ToLower(host)
+	if pattern == host {
+		return true
+	}
+	ok, err := path.Match(pattern, host)
+	return err == nil && ok
+}
+
+// Transport applies basic, digest or OAuth2 credentials to matching
+// requests
+type Transport struct {
+	Base        http.RoundTripper
+	Credentials []Credential
+
+	mu     sync.Mutex
+	nonce  map[string]*digestState
+	tokens map[*Credential]*tokenSource
+}
+
+type digestState struct {
+	challenge map[string]string
+	count     int
+}
+
+// NewTransport wraps base with the given credentials
+func NewTransport(base http.RoundTripper, creds []Credential) *Transport {
+	return &Transport{
+		Base:        base,
+		Credentials: creds,
+		nonce:       make(map[string]*digestState),
+		tokens:      make(map[*Credential]*tokenSource),
+	}
+}
+
+func (t *Transport) credentialFor(host string) *Credential {
+	for i := range t.Credentials {
+		if MatchDomain(t.Credentials[i].Domain, host) {
+			return &t.Credentials[i]
+		}
+	}
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cred := t.credentialFor(req.URL.Hostname())
+	if cred == nil || req.Header.Get("Authorization") != "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	if cred.Type == OAuth2 {
+		return t.roundTripOAuth2(cred, req)
+	}
+
+	if cred.Type != Digest {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(cred.Username, cred.Password)
+		return t.Base.RoundTrip(req)
+	}
+
+	// Reuse a known digest challenge for the host when we have one
+	if header := t.digestHeader(cred, req); header != "" {
+		authed := req.Clone(req.Context())
+		authed.Header.Set("Authorization", header)
+		resp, err := t.Base.RoundTrip(authed)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Body != nil {
+		return resp, err
+	}
+
+	challenge := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	if challenge == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	t.mu.Lock()
+	t.nonce[req.URL.Host] = &digestState{challenge: challenge}
+	t.mu.Unlock()
+
+	authed := req.Clone(req.Context())
+	authed.Header.Set("Authorization", t.digestHeader(cred, req))
+	return t.Base.RoundTrip(authed)
+}
+
+// digestHeader computes an Authorization header from the host's last
+// challenge, or returns "" if none is known
+func (t *Transport) digestHeader(cred *Credential, req *http.Request) string {
+	t.mu.Lock()
+	state, ok := t.nonce[req.URL.Host]
+	if !ok {
+		t.mu.Unlock()
+		return ""
+	}
+	state.count++
+	nc := fmt.Sprintf("%08x", state.count)
+	ch := state.challenge
+	t.mu.Unlock()
+
+	algorithm := ch["algorithm"]
+	var newHash func() hash.Hash = md5.New
+	if strings.HasPrefix(strings.ToUpper(algorithm), "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	cnonce := randomHex(8)
+	uri := req.URL.RequestURI()
+
+	ha1 := h(cred.Username + ":" + ch["realm"] + ":" + cred.Password)
+	if strings.HasSuffix(strings.ToLower(algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + ch["nonce"] + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(ch["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+
+	var response string
+	if qop != "" {
+		response = h(strings.Join([]string{ha1, ch["nonce"], nc, cnonce, qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + ch["nonce"] + ":" + ha2)
+	}
+
+	parts := []string{
+		fmt.Sprintf(`username="%s"`, cred.Username),
+		fmt.Sprintf(`realm="%s"`, ch["realm"]),
+		fmt.Sprintf(`nonce="%s"`, ch["nonce"]),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if algorithm != "" {
+		parts = append(parts, "algorithm="+algorithm)
+	}
+	if ch["opaque"] != "" {
+		parts = append(parts, fmt.Sprintf(`opaque="%s"`, ch["opaque"]))
+	}
+	if qop != "" {
+		parts = append(parts, "qop="+qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	return "Digest " + strings.Join(parts, ", ")
+}
+
+// parseChallenge parses a Digest WWW-Authenticate header into its params
+func parseChallenge(header string) map[string]string {
+	if !strings.HasPrefix(strings.ToLower(header), "digest ") {
+		return nil
+	}
+
+	params := make(map[string]string)
+	rest := header[len("digest "):]
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.IndexByte(rest, ','); comma >= 0 {
+			value, rest = strings.TrimSpace(rest[:comma]), rest[comma+1:]
+		} else {
+			value, rest = strings.TrimSpace(rest), ""
+		}
+		params[key] = value
+	}
+
+	if params["nonce"] == "" {
+		return nil
+	}
+	return params
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
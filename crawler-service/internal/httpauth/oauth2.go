@@ -0,0 +1,167 @@
+package httpauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryMargin renews a token this long before it expires, so a
+// request does not race its expiry
+const tokenExpiryMargin = 30 * time.Second
+
+// defaultTokenLifetime applies when a token response has no expires_in
+const defaultTokenLifetime = time.Hour
+
+// tokenSource obtains and caches the access token of one OAuth2
+// client-credentials credential. Username and Password are the client ID
+// and secret.
+type tokenSource struct {
+	cred *Credential
+	base http.RoundTripper
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Token returns a valid access token, fetching a new one when none is
+// cached or the cached one is about to expire
+func (s *tokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	// Client authentication goes in a basic Authorization header; token
+	// endpoints that only read it from the body reject that, and get a
+	// second request with the client credentials posted instead
+	tok, status, err := s.fetch(false)
+	if err != nil && (status == http.StatusBadRequest || status == http.StatusUnauthorized) {
+		tok, _, err = s.fetch(true)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	lifetime := defaultTokenLifetime
+	if tok.ExpiresIn > 0 {
+		lifetime = time.Duration(tok.ExpiresIn) * time.Second
+	}
+	if lifetime > 2*tokenExpiryMargin {
+		lifetime -= tokenExpiryMargin
+	}
+	s.token = tok.AccessToken
+	s.expires = time.Now().Add(lifetime)
+	return s.token, nil
+}
+
+// Invalidate drops a token the resource server rejected, unless it was
+// already replaced
+func (s *tokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	if s.token == token {
+		s.token = ""
+	}
+	s.mu.Unlock()
+}
+
+// fetch requests a token, returning the token endpoint's status code with
+// any error
+func (s *tokenSource) fetch(postCredentials bool) (*tokenResponse, int, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.cred.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cred.Scopes, " "))
+	}
+	if postCredentials {
+		form.Set("client_id", s.cred.Username)
+		form.Set("client_secret", s.cred.Password)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.cred.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !postCredentials {
+		req.SetBasicAuth(url.QueryEscape(s.cred.Username), url.QueryEscape(s.cred.Password))
+	}
+
+	client := &http.Client{Transport: s.base, Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("token request to %s failed: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("token endpoint %s returned %d", req.URL.Host, resp.StatusCode)
+	}
+
+	var tok tokenResponse
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return nil, resp.StatusCode, fmt.Errorf("token response from %s has no access_token", req.URL.Host)
+	}
+	if tok.TokenType != "" && !strings.EqualFold(tok.TokenType, "bearer") {
+		return nil, resp.StatusCode, fmt.Errorf("unsupported token type %q", tok.TokenType)
+	}
+	return &tok, resp.StatusCode, nil
+}
+
+// roundTripOAuth2 sends req with a bearer token, retrying once with a fresh
+// token if the server rejects it
+func (t *Transport) roundTripOAuth2(cred *Credential, req *http.Request) (*http.Response, error) {
+	source := t.tokenSource(cred)
+	token, err := source.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	authed := req.Clone(req.Context())
+	authed.Header.Set("Authorization", "Bearer "+token)
+	resp, err := t.Base.RoundTrip(authed)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Body != nil {
+		return resp, err
+	}
+
+	source.Invalidate(token)
+	fresh, err := source.Token()
+	if err != nil || fresh == token {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	authed = req.Clone(req.Context())
+	authed.Header.Set("Authorization", "Bearer "+fresh)
+	return t.Base.RoundTrip(authed)
+}
+
+func (t *Transport) tokenSource(cred *Credential) *tokenSource {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	source, ok := t.tokens[cred]
+	if !ok {
+		source = &tokenSource{cred: cred, base: t.Base}
+		t.tokens[cred] = source
+	}
+	return source
+}
@@ -0,0 +1,393 @@
+// Package imprint reads what contact, about and imprint (Impressum) pages
+// say about the organisation behind a site: its name and legal form,
+// postal addresses, company register numbers, VAT IDs and officers.
+// schema.org Organization markup is read first; the page text fills in the
+// rest through labelled lines such as "Geschäftsführer: ..." or
+// "VAT ID: ...".
+package imprint
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxValues bounds each list of an organisation record
+const maxValues = 20
+
+// pagePattern matches the URL paths and titles of contact, about and
+// imprint pages in the languages crawled most
+var pagePattern = regexp.MustCompile(`(?i)\b(contact|contacts|contact[-_ ]us|kontakt|contatti|contacto|contactez|impressum|imprint|legal[-_ ]notice|legal|mentions[-_ ]legales|aviso[-_ ]legal|note[-_ ]legali|colofon|about|about[-_ ]us|ueber[-_ ]uns|uber[-_ ]uns|über[-_ ]uns|qui[-_ ]sommes[-_ ]nous|chi[-_ ]siamo|quienes[-_ ]somos|company|unternehmen|team|management|leadership)\b`)
+
+// IsContactPage reports whether a page's URL or title marks it as a
+// contact, about or imprint page
+func IsContactPage(pageURL, title string) bool {
+	if u, err := url.Parse(pageURL); err == nil && pagePattern.MatchString(strings.ReplaceAll(u.Path, "/", " ")) {
+		return true
+	}
+	return pagePattern.MatchString(title)
+}
+
+var (
+	// legalForm matches a company name ending in its legal form, longer
+	// forms first within a family
+	legalForm = regexp.MustCompile(`\b([\p{Lu}][\p{L}0-9&.,'\- ]{1,80}?)\s+(GmbH & Co\. KG|GmbH|gGmbH|UG \(haftungsbeschränkt\)|AG|KGaA|KG|OHG|e\.\s?V\.|SE|Ltd\.?|Limited|LLP|PLC|plc|LLC|Inc\.?|Corp\.?|Corporation|S\.A\.S\.?|SAS|SARL|S\.A\.R\.L\.|S\.A\.|SA|S\.p\.A\.|S\.r\.l\.|SRL|S\.L\.|B\.V\.|N\.V\.|ApS|A/S|AB|Oy|sp\. z o\.o\.)(?:\s|$|[,.;)])`)
+
+	// registers are the company register numbers read from labelled text
+	registers = []struct {
+		kind    string
+		pattern *regexp.Regexp
+	}{
+		{"handelsregister", regexp.MustCompile(`\b(HR[AB]\s?\d{1,6}(?:\s?[A-Z]{1,2})?)\b`)},
+		{"companies_house", regexp.MustCompile(`(?i)\bcompany\s+(?:registration\s+)?(?:number|no\.?)\s*:?\s*([A-Z]{0,2}\d{6,8})\b`)},
+		{"rcs", regexp.MustCompile(`\b(RCS\s+[\p{L}\- ]{2,30}?\s+[AB]?\s?\d{3}\s?\d{3}\s?\d{3})\b`)},
+		{"siret", regexp.MustCompile(`(?i)\bSIRE[NT]\s*:?\s*(\d{3}\s?\d{3}\s?\d{3}(?:\s?\d{5})?)\b`)},
+		{"kvk", regexp.MustCompile(`(?i)\b(?:KvK|Kamer van Koophandel)(?:[- ]?nummer)?\s*:?\s*(\d{8})\b`)},
+		{"uid", regexp.MustCompile(`\b(CHE[- ]?\d{3}\.\d{3}\.\d{3})\b`)},
+		{"firmenbuch", regexp.MustCompile(`(?i)\b(?:Firmenbuch(?:nummer)?|FN)\s*:?\s*(\d{1,6}\s?[a-z])\b`)},
+		{"rea", regexp.MustCompile(`(?i)\bREA\s*:?\s*([A-Z]{2}[- ]?\d{4,7})\b`)},
+	}
+
+	// registerCourt names the court keeping a German register
+	registerCourt = regexp.MustCompile(`\b(?:Amtsgericht|Registergericht|AG)\s*:?\s+([\p{Lu}][\p{L}\-]+(?:\s[\p{Lu}][\p{L}\-]+)?)`)
+
+	// vatLabel marks lines giving a VAT ID; vatID matches the IDs of EU
+	// member states, the UK, Switzerland and Norway
+	vatLabel = regexp.MustCompile(`(?i)\b(VAT|USt\.?[- ]?Id|Umsatzsteuer|UID|TVA|IVA|P\.\s?IVA|Partita IVA|BTW|NIF|CIF|MwSt|moms|ALV)\b`)
+	vatID    = regexp.MustCompile(`\b(ATU\d{8}|BE\s?[01]\d{3}\.?\d{3}\.?\d{3}|DE\s?\d{9}|DK\s?\d{8}|(?:EL|GR)\d{9}|ES\s?[0-9A-Z]\d{7}[0-9A-Z]|FI\d{8}|FR\s?[0-9A-Z]{2}\s?\d{9}|GB\s?(?:\d{9}|\d{12})|IE\d{7}[A-Z]{1,2}|IT\s?\d{11}|LU\d{8}|NL\s?\d{9}B\d{2}|PL\s?\d{10}|PT\s?\d{9}|SE\s?\d{12}|CHE[- ]?\d{3}\.\d{3}\.\d{3}(?:\s?(?:MWST|TVA|IVA))?|NO\s?\d{9}(?:\s?MVA)?|(?:BG|CY|CZ|EE|HR|HU|LT|LV|MT|RO|SI|SK)\s?\d{8,10}[A-Z]?)\b`)
+
+	// officerLabel marks lines naming officers; the names follow it
+	officerLabel  = regexp.MustCompile(`(?i)^\s*(Geschäftsführer(?:in)?|Geschäftsführung|Vorstand(?:svorsitzende[rn]?)?|Vertreten durch|Vertretungsberechtigte[rn]? Geschäftsführer|Inhaber(?:in)?|Managing Directors?|Directors?|CEO|Chief Executive Officer|Founders?|Co-Founders?|Owner|Président(?:e)?|Directeur(?:rice)? (?:général|de la publication)|Gérant(?:e)?|Amministratore(?: Delegato| Unico)?|Legale rappresentante|Director General|Administrador(?:a)?|Bestuurder|Directeur)s?\s*[:\-–]\s*(.+)$`)
+	nameSeparator = regexp.MustCompile(`\s*(?:,|;|/|&|\band\b|\bund\b|\bet\b|\be\b|\by\b|\ben\b)\s*`)
+	personName    = regexp.MustCompile(`^(?:(?:Dr|Prof|Dipl|Ing|Mag|Mr|Mrs|Ms|M|Mme)\.?\s+)*[\p{Lu}][\p{Ll}'\-]+(?:\s+(?:von|van|de|der|den|di|da|du|le|la|zu)?\s*[\p{Lu}][\p{L}'\-]+){1,3}$`)
+
+	// phoneLabel marks lines giving a phone number
+	phoneLabel  = regexp.MustCompile(`(?i)\b(tel|telefon|telephone|phone|téléphone|telefono|teléfono|fon|mobil|mobile)\b`)
+	phoneNumber = regexp.MustCompile(`\+?\(?\d[\d\s()/.\-]{6,}\d`)
+
+	// postcodeLine matches the postcode and town line of an address
+	postcodeLine = regexp.MustCompile(`^(?:[A-Z]{1,2}[- ])?\d{4,5}\s+[\p{Lu}][\p{L}.\- ]+$|^[A-Z]{1,2}\d[A-Z\d]?\s\d[A-Z]{2}\b|\b[A-Z]{2}\s\d{5}(?:-\d{4})?$`)
+	// streetLine matches a street and house number
+	streetLine = regexp.MustCompile(`^[\p{L}.' \-]{3,60}\s\d{1,5}[a-zA-Z]?(?:\s?[-/]\s?\d{1,5}[a-zA-Z]?)?$|^\d{1,5}[a-zA-Z]?,?\s[\p{L}.' \-]{3,60}$`)
+)
+
+// Extract reads the organisation a contact, about or imprint page
+// describes. emails are the addresses already found on the page. ok is
+// false when the page says nothing about one.
+func Extract(doc *goquery.Selection, pageURL string, emails []string) (org models.Organization, ok bool) {
+	fromSchema(doc, &org)
+
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript, template, nav, header nav").Remove()
+	body.Find("br").ReplaceWithHtml("\n")
+	body.Find("p, div, li, tr, address, h1, h2, h3, h4, h5, h6, dd, dt, td, section, article").Each(func(_ int, s *goquery.Selection) {
+		s.AppendHtml("\n")
+	})
+	lines := textLines(body.Text())
+	fromText(lines, &org)
+
+	for _, email := range emails {
+		org.Emails = addValue(org.Emails, email)
+	}
+	if org.Name == "" && org.LegalForm == "" && len(org.Addresses) == 0 && len(org.RegistrationNumbers) == 0 && len(org.VATIDs) == 0 && len(org.People) == 0 {
+		return models.Organization{}, false
+	}
+	org.Sources = []string{pageURL}
+	return org, true
+}
+
+// textLines splits text into its trimmed, non-empty lines with runs of
+// spaces collapsed
+func textLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// fromText fills in the organisation from labelled lines of the page
+func fromText(lines []string, org *models.Organization) {
+	for i, line := range lines {
+		if org.Name == "" {
+			if m := legalForm.FindStringSubmatch(line); m != nil && len(line) <= 120 {
+				org.Name = strings.TrimSpace(m[1] + " " + m[2])
+				org.LegalForm = m[2]
+			}
+		}
+
+		for _, r := range registers {
+			for _, m := range r.pattern.FindAllStringSubmatch(line, -1) {
+				reg := models.RegistrationNumber{Type: r.kind, Number: strings.Join(strings.Fields(m[1]), " ")}
+				if r.kind == "handelsregister" {
+					// The court is named on the same line or the one before
+					nearby := line
+					if i > 0 {
+						nearby = lines[i-1] + " " + line
+					}
+					if c := registerCourt.FindStringSubmatch(nearby); c != nil {
+						reg.Authority = "Amtsgericht " + c[1]
+					}
+				}
+				org.RegistrationNumbers = addRegistration(org.RegistrationNumbers, reg)
+			}
+		}
+
+		if vatLabel.MatchString(line) || (i > 0 && vatLabel.MatchString(lines[i-1]) && len(lines[i-1]) < 60) {
+			for _, id := range vatID.FindAllString(line, -1) {
+				org.VATIDs = addValue(org.VATIDs, normalizeVAT(id))
+			}
+		}
+
+		if m := officerLabel.FindStringSubmatch(line); m != nil {
+			for _, name := range splitNames(m[2]) {
+				org.People = addPerson(org.People, models.OrganizationPerson{Name: name, Role: m[1]})
+			}
+		}
+
+		if phoneLabel.MatchString(line) {
+			for _, number := range phoneNumber.FindAllString(line, -1) {
+				if digits := countDigits(number); digits >= 7 && digits <= 15 {
+					org.Phones = addValue(org.Phones, strings.TrimSpace(number))
+				}
+			}
+		}
+
+		if postcodeLine.MatchString(line) && i > 0 && streetLine.MatchString(lines[i-1]) {
+			org.Addresses = addValue(org.Addresses, lines[i-1]+", "+line)
+		}
+	}
+}
+
+// splitNames reads the people an officer line names: "Jane Doe, John Roe
+// und Max Mustermann"
+func splitNames(raw string) []string {
+	parts := nameSeparator.Split(raw, -1)
+	var names []string
+	for _, p := range parts {
+		p = strings.TrimRight(strings.TrimSpace(p), ".")
+		if personName.MatchString(p) {
+			names = append(names, p)
+		}
+	}
+	return names
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// normalizeVAT removes the spaces and dots from a VAT ID
+func normalizeVAT(id string) string {
+	return strings.NewReplacer(" ", "", ".", "", "-", "").Replace(strings.ToUpper(id))
+}
+
+// fromSchema reads schema.org Organization markup, including nodes nested
+// in @graph, given as JSON-LD
+func fromSchema(doc *goquery.Selection, org *models.Organization) {
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var data interface{}
+		if json.Unmarshal([]byte(s.Text()), &data) == nil {
+			walkJSONLD(data, org)
+		}
+	})
+}
+
+// organizationTypes are the schema.org types describing an organisation
+var organizationTypes = map[string]bool{
+	"Organization":          true,
+	"Corporation":           true,
+	"LocalBusiness":         true,
+	"NGO":                   true,
+	"OnlineBusiness":        true,
+	"OnlineStore":           true,
+	"NewsMediaOrganization": true,
+	"ProfessionalService":   true,
+	"Store":                 true,
+}
+
+func walkJSONLD(v interface{}, org *models.Organization) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			walkJSONLD(item, org)
+		}
+	case map[string]interface{}:
+		if graph, ok := v["@graph"]; ok {
+			walkJSONLD(graph, org)
+		}
+		if !hasType(v["@type"], organizationTypes) {
+			return
+		}
+		if org.Name == "" {
+			org.Name = stringValue(v["legalName"])
+			if org.Name == "" {
+				org.Name = stringValue(v["name"])
+			}
+		}
+		for _, key := range []string{"vatID", "taxID"} {
+			if id := stringValue(v[key]); id != "" && vatID.MatchString(normalizeVAT(id)) {
+				org.VATIDs = addValue(org.VATIDs, normalizeVAT(id))
+			}
+		}
+		if email := strings.TrimPrefix(stringValue(v["email"]), "mailto:"); email != "" {
+			org.Emails = addValue(org.Emails, strings.ToLower(email))
+		}
+		if phone := stringValue(v["telephone"]); phone != "" {
+			org.Phones = addValue(org.Phones, phone)
+		}
+		for _, address := range asList(v["address"]) {
+			if a := postalAddress(address); a != "" {
+				org.Addresses = addValue(org.Addresses, a)
+			}
+		}
+		for _, key := range []string{"founder", "founders", "employee", "employees", "member"} {
+			for _, p := range asList(v[key]) {
+				person, ok := p.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				role := stringValue(person["jobTitle"])
+				if role == "" && strings.HasPrefix(key, "founder") {
+					role = "Founder"
+				}
+				if name := stringValue(person["name"]); name != "" {
+					org.People = addPerson(org.People, models.OrganizationPerson{Name: name, Role: role})
+				}
+			}
+		}
+	}
+}
+
+// postalAddress formats a schema.org PostalAddress, or returns a plain
+// address string as is
+func postalAddress(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.Join(strings.Fields(v), " ")
+	case map[string]interface{}:
+		var parts []string
+		for _, key := range []string{"streetAddress", "postalCode", "addressLocality", "addressRegion", "addressCountry"} {
+			value := stringValue(v[key])
+			if country, ok := v[key].(map[string]interface{}); ok {
+				value = stringValue(country["name"])
+			}
+			if value != "" {
+				parts = append(parts, value)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
+
+func hasType(v interface{}, types map[string]bool) bool {
+	for _, t := range asList(v) {
+		if s, ok := t.(string); ok && types[strings.TrimPrefix(s, "http://schema.org/")] {
+			return true
+		}
+	}
+	return false
+}
+
+func asList(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return strings.TrimSpace(s)
+}
+
+// addValue appends value unless it is already listed, ignoring case, or
+// the list is full
+func addValue(list []string, value string) []string {
+	if value == "" || len(list) >= maxValues {
+		return list
+	}
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+func addRegistration(list []models.RegistrationNumber, reg models.RegistrationNumber) []models.RegistrationNumber {
+	if len(list) >= maxValues {
+		return list
+	}
+	for i, r := range list {
+		if r.Type == reg.Type && strings.EqualFold(r.Number, reg.Number) {
+			if r.Authority == "" {
+				list[i].Authority = reg.Authority
+			}
+			return list
+		}
+	}
+	return append(list, reg)
+}
+
+func addPerson(list []models.OrganizationPerson, p models.OrganizationPerson) []models.OrganizationPerson {
+	if len(list) >= maxValues {
+		return list
+	}
+	for i, existing := range list {
+		if strings.EqualFold(existing.Name, p.Name) {
+			if existing.Role == "" {
+				list[i].Role = p.Role
+			}
+			return list
+		}
+	}
+	return append(list, p)
+}
+
+// Merge adds what another page says about an organisation to org, keeping
+// the values org already has
+func Merge(org *models.Organization, other models.Organization) {
+	if org.Name == "" {
+		org.Name, org.LegalForm = other.Name, other.LegalForm
+	}
+	for _, v := range other.Addresses {
+		org.Addresses = addValue(org.Addresses, v)
+	}
+	for _, r := range other.RegistrationNumbers {
+		org.RegistrationNumbers = addRegistration(org.RegistrationNumbers, r)
+	}
+	for _, v := range other.VATIDs {
+		org.VATIDs = addValue(org.VATIDs, v)
+	}
+	for _, p := range other.People {
+		org.People = addPerson(org.People, p)
+	}
+	for _, v := range other.Emails {
+		org.Emails = addValue(org.Emails, v)
+	}
+	for _, v := range other.Phones {
+		org.Phones = addValue(org.Phones, v)
+	}
+	for _, v := range other.Sources {
+		org.Sources = addValue(org.Sources, v)
+	}
+}
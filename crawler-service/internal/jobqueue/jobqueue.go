@@ -0,0 +1,238 @@
+// Package jobqueue runs submitted jobs on a bounded pool of workers, in
+// order of priority and then of submission, so a burst of submissions waits
+// its turn instead of running all at once. Running jobs that allow it can
+// be asked to give up their worker to a job of higher priority.
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// DefaultWorkers is how many jobs run at once without MAX_CONCURRENT_JOBS
+const DefaultWorkers = 4
+
+// ErrClosed is returned for submissions once the queue is draining
+var ErrClosed = errors.New("job queue is shutting down")
+
+// Priorities of jobs; jobs of higher priority run first
+const (
+	Low    = -1
+	Normal = 0
+	High   = 1
+)
+
+// Job is work submitted to the queue
+type Job struct {
+	ID       string
+	Priority int
+	// Preemptible jobs may be asked to give up their worker while running
+	Preemptible bool
+	Run         func()
+}
+
+// Queue is a priority queue of jobs served by a fixed number of workers
+type Queue struct {
+	mu      sync.Mutex
+	workers int
+	running int
+	pending []Job
+	closed  bool
+	idle    chan struct{}
+
+	// preempt asks a running job to give up its worker; preemptible holds
+	// the running jobs that can be asked
+	preempt     func(id string)
+	preemptible map[string]*runningJob
+}
+
+// runningJob is a preemptible job on a worker
+type runningJob struct {
+	priority int
+	// yielding is set once the job was asked to give up its worker
+	yielding bool
+}
+
+// New starts a queue running at most workers jobs at once
+func New(workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Queue{
+		workers:     workers,
+		preemptible: make(map[string]*runningJob),
+	}
+}
+
+// NewFromEnv starts a queue of MAX_CONCURRENT_JOBS workers (default
+// DefaultWorkers)
+func NewFromEnv() *Queue {
+	workers := DefaultWorkers
+	if n, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_JOBS")); err == nil && n > 0 {
+		workers = n
+	}
+	return New(workers)
+}
+
+// PreemptWith has High priority jobs submitted while every worker is busy
+// ask a running preemptible job of lower priority to give up its worker, by calling
+// preempt with its ID. The job is expected to return soon; the worker then
+// goes to the waiting job of highest priority.
+func (q *Queue) PreemptWith(preempt func(id string)) {
+	q.mu.Lock()
+	q.preempt = preempt
+	q.mu.Unlock()
+}
+
+// Submit queues a job and returns its position in the queue: 0 if it
+// started straight away, 1 if it is next, and so on. It waits behind the
+// jobs of its priority or higher submitted before it.
+func (q *Queue) Submit(job Job) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrClosed
+	}
+	if q.running < q.workers {
+		q.start(job)
+		return 0, nil
+	}
+	i := len(q.pending)
+	for i > 0 && q.pending[i-1].Priority < job.Priority {
+		i--
+	}
+	q.pending = append(q.pending, Job{})
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = job
+
+	if job.Priority < High {
+		return i + 1, nil
+	}
+	if id, victim := q.victim(job.Priority); victim != nil {
+		victim.yielding = true
+		go q.preempt(id)
+	}
+	return i + 1, nil
+}
+
+// victim picks the running job to preempt for a job of the given
+// priority: the one of lowest priority below it that was not already
+// asked to give up its worker, or none. q.mu must be held.
+func (q *Queue) victim(priority int) (string, *runningJob) {
+	if q.preempt == nil {
+		return "", nil
+	}
+	var id string
+	var victim *runningJob
+	for runningID, r := range q.preemptible {
+		if r.priority < priority && !r.yielding && (victim == nil || r.priority < victim.priority) {
+			id, victim = runningID, r
+		}
+	}
+	return id, victim
+}
+
+// start runs a job on a new worker; q.mu must be held
+func (q *Queue) start(job Job) {
+	q.running++
+	var r *runningJob
+	if job.Preemptible {
+		r = &runningJob{priority: job.Priority}
+		q.preemptible[job.ID] = r
+	}
+	go func() {
+		defer q.done(job.ID, r)
+		job.Run()
+	}()
+}
+
+// done frees a worker, handing it the next queued job. A job requeued
+// while it ran may have started again under the same ID, so only the run
+// that finished is forgotten.
+func (q *Queue) done(id string, r *runningJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	if r != nil && q.preemptible[id] == r {
+		delete(q.preemptible, id)
+	}
+	if len(q.pending) > 0 && !q.closed {
+		next := q.pending[0]
+		q.pending = q.pending[1:]
+		q.start(next)
+	}
+	if q.running == 0 && q.idle != nil {
+		close(q.idle)
+		q.idle = nil
+	}
+}
+
+// Position returns a queued job's position, 1 being next, or 0 if the job
+// is not waiting
+func (q *Queue) Position(id string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, job := range q.pending {
+		if job.ID == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Remove takes a job out of the queue before it starts and reports
+// whether it was waiting
+func (q *Queue) Remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, job := range q.pending {
+		if job.ID == id {
+			q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns how many jobs are waiting and running, and the number of
+// workers
+func (q *Queue) Stats() (queued, running, workers int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending), q.running, q.workers
+}
+
+// Drain stops the queue taking submissions and starting queued jobs, and
+// returns the IDs of the jobs that never started. It then waits for the
+// running jobs to finish, or for ctx to be done.
+func (q *Queue) Drain(ctx context.Context) ([]string, error) {
+	q.mu.Lock()
+	q.closed = true
+	dropped := make([]string, 0, len(q.pending))
+	for _, job := range q.pending {
+		dropped = append(dropped, job.ID)
+	}
+	q.pending = nil
+
+	if q.running == 0 {
+		q.mu.Unlock()
+		return dropped, nil
+	}
+	if q.idle == nil {
+		q.idle = make(chan struct{})
+	}
+	idle := q.idle
+	q.mu.Unlock()
+
+	select {
+	case <-idle:
+		return dropped, nil
+	case <-ctx.Done():
+		return dropped, ctx.Err()
+	}
+}
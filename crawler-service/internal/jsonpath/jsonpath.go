@@ -0,0 +1,163 @@
+// Package jsonpath evaluates the subset of JSONPath used by extraction
+// rules: member access ($.a.b, $['a b']), array indexes ($.items[0],
+// $.items[-1]) and wildcards ($.items[*].id, $.*). Paths may omit the
+// leading "$".
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type stepKind int
+
+const (
+	stepKey stepKind = iota
+	stepIndex
+	stepWildcard
+)
+
+type step struct {
+	kind  stepKind
+	key   string
+	index int
+}
+
+// Path is a compiled JSONPath
+type Path struct {
+	expr  string
+	steps []step
+}
+
+// String returns the expression the path was compiled from
+func (p Path) String() string { return p.expr }
+
+// Compile parses a JSONPath expression
+func Compile(expr string) (Path, error) {
+	p := Path{expr: expr}
+	rest := strings.TrimSpace(expr)
+	rest = strings.TrimPrefix(rest, "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, ".") {
+				return Path{}, fmt.Errorf("jsonpath %q: recursive descent is not supported", expr)
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			switch name {
+			case "":
+				return Path{}, fmt.Errorf("jsonpath %q: empty member name", expr)
+			case "*":
+				p.steps = append(p.steps, step{kind: stepWildcard})
+			default:
+				p.steps = append(p.steps, step{kind: stepKey, key: name})
+			}
+		case '[':
+			end := closingBracket(rest)
+			if end < 0 {
+				return Path{}, fmt.Errorf("jsonpath %q: unclosed [", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			s, err := bracketStep(inner)
+			if err != nil {
+				return Path{}, fmt.Errorf("jsonpath %q: %w", expr, err)
+			}
+			p.steps = append(p.steps, s)
+		default:
+			return Path{}, fmt.Errorf("jsonpath %q: unexpected %q", expr, rest[0])
+		}
+	}
+	return p, nil
+}
+
+// closingBracket returns the index of the ] closing the [ at the start of
+// s, skipping brackets inside quoted names
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func bracketStep(inner string) (step, error) {
+	switch {
+	case inner == "*":
+		return step{kind: stepWildcard}, nil
+	case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		return step{kind: stepKey, key: inner[1 : len(inner)-1]}, nil
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil {
+		return step{}, fmt.Errorf("unsupported selector [%s]", inner)
+	}
+	return step{kind: stepIndex, index: n}, nil
+}
+
+// Eval returns the values the path selects in a document decoded with
+// encoding/json; missing members and out-of-range indexes select nothing
+func (p Path) Eval(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+	for _, s := range p.steps {
+		var next []interface{}
+		for _, v := range current {
+			switch s.kind {
+			case stepKey:
+				if obj, ok := v.(map[string]interface{}); ok {
+					if child, ok := obj[s.key]; ok {
+						next = append(next, child)
+					}
+				}
+			case stepIndex:
+				if arr, ok := v.([]interface{}); ok {
+					i := s.index
+					if i < 0 {
+						i += len(arr)
+					}
+					if i >= 0 && i < len(arr) {
+						next = append(next, arr[i])
+					}
+				}
+			case stepWildcard:
+				switch v := v.(type) {
+				case []interface{}:
+					next = append(next, v...)
+				case map[string]interface{}:
+					// Members are visited in key order, so results are stable
+					keys := make([]string, 0, len(v))
+					for key := range v {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, v[key])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
@@ -0,0 +1,471 @@
+// Package keyring encrypts data at rest with per-tenant data keys. Data
+// keys are stored wrapped (encrypted) by a master key, so rotating either
+// only re-wraps keys and never re-encrypts stored content.
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// keysKey is the Redis hash of wrapped tenant keys, keyed by tenant
+const keysKey = "tenant_keys"
+
+// magic starts every envelope, so encrypted and plaintext data can be told
+// apart
+var magic = []byte("GEK1")
+
+// ErrUnknownKey is returned for envelopes whose data key is not available
+var ErrUnknownKey = errors.New("data key not available")
+
+// TenantKeys are the data keys of a tenant. New data is encrypted with the
+// Current version; older versions are kept to decrypt what they encrypted.
+type TenantKeys struct {
+	Tenant  string       `json:"tenant"`
+	Current int          `json:"current"`
+	Keys    []WrappedKey `json:"keys"`
+}
+
+// WrappedKey is a data key encrypted by the master key MasterKey
+type WrappedKey struct {
+	Version   int       `json:"version"`
+	MasterKey string    `json:"master_key"`
+	Wrapped   []byte    `json:"wrapped,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	WrappedAt time.Time `json:"wrapped_at"`
+}
+
+// Keyring holds the master keys and the tenants' data keys
+type Keyring struct {
+	// masters maps master key IDs to keys; current wraps new data keys
+	masters map[string][]byte
+	current string
+	file    string
+
+	mu      sync.Mutex
+	tenants map[string]*TenantKeys
+	// plain caches unwrapped data keys by tenant and version
+	plain map[string]map[int][]byte
+}
+
+// NewFromEnv reads the master keys from ENCRYPTION_MASTER_KEYS, a comma
+// separated list of id:base64 AES-256 keys, the first of which is current.
+// Wrapped data keys are kept in Redis when connected, else in KEYRING_FILE
+// (default data/keys.json). It returns nil when no master key is set.
+func NewFromEnv() (*Keyring, error) {
+	spec := strings.TrimSpace(os.Getenv("ENCRYPTION_MASTER_KEYS"))
+	if spec == "" {
+		return nil, nil
+	}
+
+	k := &Keyring{
+		masters: make(map[string][]byte),
+		file:    os.Getenv("KEYRING_FILE"),
+		tenants: make(map[string]*TenantKeys),
+		plain:   make(map[string]map[int][]byte),
+	}
+	if k.file == "" {
+		k.file = filepath.Join("data", "keys.json")
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("master key %q must be id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("master key %s must be 32 base64-encoded bytes", id)
+		}
+		if _, dup := k.masters[id]; dup {
+			return nil, fmt.Errorf("duplicate master key %s", id)
+		}
+		k.masters[id] = key
+		if k.current == "" {
+			k.current = id
+		}
+	}
+	return k, nil
+}
+
+// MasterKeyID returns the ID of the master key new data keys are wrapped
+// with
+func (k *Keyring) MasterKeyID() string {
+	return k.current
+}
+
+// IsEncrypted reports whether data is an envelope written by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Encrypt seals data with the tenant's current data key, creating the key
+// on first use. The envelope records the tenant and key version.
+func (k *Keyring) Encrypt(tenant string, data []byte) ([]byte, error) {
+	version, key, err := k.currentKey(tenant)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	header.Write(magic)
+	binary.Write(&header, binary.BigEndian, uint16(len(tenant)))
+	header.WriteString(tenant)
+	binary.Write(&header, binary.BigEndian, uint32(version))
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	aad := header.Bytes()
+	out := append(append([]byte{}, aad...), nonce...)
+	// The header is authenticated so an envelope can't be passed off as
+	// another tenant's
+	return gcm.Seal(out, nonce, data, aad), nil
+}
+
+// Decrypt opens an envelope written by Encrypt
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) || len(data) < len(magic)+2 {
+		return nil, errors.New("not an encrypted envelope")
+	}
+	rest := data[len(magic):]
+	n := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+n+4 {
+		return nil, errors.New("truncated envelope")
+	}
+	tenant := string(rest[2 : 2+n])
+	version := int(binary.BigEndian.Uint32(rest[2+n:]))
+	headerLen := len(magic) + 2 + n + 4
+
+	key, err := k.versionKey(tenant, version)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerLen+gcm.NonceSize() {
+		return nil, errors.New("truncated envelope")
+	}
+	nonce := data[headerLen : headerLen+gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, data[headerLen+gcm.NonceSize():], data[:headerLen])
+	if err != nil {
+		return nil, fmt.Errorf("envelope of tenant %s failed authentication", tenant)
+	}
+	return plain, nil
+}
+
+// Rotate starts a new data key version for the tenant's new data and
+// re-wraps all of its data keys with the current master key. Data written
+// under older versions stays readable without being re-encrypted.
+func (k *Keyring) Rotate(tenant string) (*TenantKeys, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys, err := k.load(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = &TenantKeys{Tenant: tenant}
+	}
+
+	now := time.Now().UTC()
+	rotated := &TenantKeys{Tenant: tenant, Current: keys.Current + 1}
+	for _, wk := range keys.Keys {
+		plain, err := k.unwrap(wk)
+		if err != nil {
+			return nil, fmt.Errorf("data key version %d: %w", wk.Version, err)
+		}
+		rewrapped, err := k.wrap(plain)
+		if err != nil {
+			return nil, err
+		}
+		rotated.Keys = append(rotated.Keys, WrappedKey{
+			Version:   wk.Version,
+			MasterKey: k.current,
+			Wrapped:   rewrapped,
+			CreatedAt: wk.CreatedAt,
+			WrappedAt: now,
+		})
+	}
+	fresh, err := k.newKey(rotated.Current, now)
+	if err != nil {
+		return nil, err
+	}
+	rotated.Keys = append(rotated.Keys, fresh)
+
+	if err := k.save(rotated, false); err != nil {
+		return nil, err
+	}
+	k.tenants[tenant] = rotated
+	delete(k.plain, tenant)
+	return redacted(rotated), nil
+}
+
+// Status returns a tenant's key versions without their key material, or
+// nil when the tenant has no data key yet
+func (k *Keyring) Status(tenant string) (*TenantKeys, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys, err := k.load(tenant)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+	return redacted(keys), nil
+}
+
+// currentKey returns the tenant's current data key, creating the first one
+func (k *Keyring) currentKey(tenant string) (int, []byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys, err := k.cached(tenant)
+	if err != nil {
+		return 0, nil, err
+	}
+	if keys == nil {
+		now := time.Now().UTC()
+		first, err := k.newKey(1, now)
+		if err != nil {
+			return 0, nil, err
+		}
+		keys = &TenantKeys{Tenant: tenant, Current: 1, Keys: []WrappedKey{first}}
+		if err := k.save(keys, true); err != nil {
+			return 0, nil, err
+		}
+		// Another instance may have created the tenant's key first
+		if keys, err = k.load(tenant); err != nil {
+			return 0, nil, err
+		}
+		if keys == nil {
+			return 0, nil, fmt.Errorf("%w: failed to create a data key for tenant %s", ErrUnknownKey, tenant)
+		}
+	}
+	key, err := k.plainKey(keys, keys.Current)
+	return keys.Current, key, err
+}
+
+// versionKey returns a version of the tenant's data key, reloading the
+// tenant's keys once when the version was created elsewhere since
+func (k *Keyring) versionKey(tenant string, version int) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys, err := k.cached(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil || version > keys.Current {
+		if keys, err = k.load(tenant); err != nil {
+			return nil, err
+		}
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("%w: tenant %s has no data keys", ErrUnknownKey, tenant)
+	}
+	return k.plainKey(keys, version)
+}
+
+// cached returns the tenant's keys from memory, loading them on first use.
+// Callers hold mu.
+func (k *Keyring) cached(tenant string) (*TenantKeys, error) {
+	if keys, ok := k.tenants[tenant]; ok {
+		return keys, nil
+	}
+	return k.load(tenant)
+}
+
+// plainKey unwraps a version of a tenant's data key. Callers hold mu.
+func (k *Keyring) plainKey(keys *TenantKeys, version int) ([]byte, error) {
+	if key, ok := k.plain[keys.Tenant][version]; ok {
+		return key, nil
+	}
+	for _, wk := range keys.Keys {
+		if wk.Version != version {
+			continue
+		}
+		key, err := k.unwrap(wk)
+		if err != nil {
+			return nil, err
+		}
+		if k.plain[keys.Tenant] == nil {
+			k.plain[keys.Tenant] = make(map[int][]byte)
+		}
+		k.plain[keys.Tenant][version] = key
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: tenant %s has no version %d", ErrUnknownKey, keys.Tenant, version)
+}
+
+// newKey generates a data key wrapped with the current master key
+func (k *Keyring) newKey(version int, now time.Time) (WrappedKey, error) {
+	plain := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, plain); err != nil {
+		return WrappedKey{}, err
+	}
+	wrapped, err := k.wrap(plain)
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	return WrappedKey{Version: version, MasterKey: k.current, Wrapped: wrapped, CreatedAt: now, WrappedAt: now}, nil
+}
+
+func (k *Keyring) wrap(plain []byte) ([]byte, error) {
+	gcm, err := newGCM(k.masters[k.current])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func (k *Keyring) unwrap(wk WrappedKey) ([]byte, error) {
+	master, ok := k.masters[wk.MasterKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: master key %s is not configured", ErrUnknownKey, wk.MasterKey)
+	}
+	gcm, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wk.Wrapped) < gcm.NonceSize() {
+		return nil, errors.New("corrupt wrapped key")
+	}
+	nonce, sealed := wk.Wrapped[:gcm.NonceSize()], wk.Wrapped[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("master key %s does not unwrap the data key", wk.MasterKey)
+	}
+	return plain, nil
+}
+
+// load reads a tenant's keys from Redis or the key file into the cache,
+// returning nil when the tenant has none. Callers hold mu.
+func (k *Keyring) load(tenant string) (*TenantKeys, error) {
+	var keys *TenantKeys
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		data, err := rdb.HGet(ctx, keysKey, tenant).Bytes()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to read tenant keys: %w", err)
+		}
+		if err == nil {
+			keys = &TenantKeys{}
+			if err := json.Unmarshal(data, keys); err != nil {
+				return nil, fmt.Errorf("corrupt keys of tenant %s: %w", tenant, err)
+			}
+		}
+	} else {
+		all, err := k.readFile()
+		if err != nil {
+			return nil, err
+		}
+		keys = all[tenant]
+	}
+
+	if keys != nil {
+		k.tenants[tenant] = keys
+	}
+	return keys, nil
+}
+
+// save persists a tenant's keys. With create set, keys a tenant already
+// has are never replaced. Callers hold mu.
+func (k *Keyring) save(keys *TenantKeys, create bool) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if create {
+			return rdb.HSetNX(ctx, keysKey, keys.Tenant, data).Err()
+		}
+		return rdb.HSet(ctx, keysKey, keys.Tenant, data).Err()
+	}
+
+	all, err := k.readFile()
+	if err != nil {
+		return err
+	}
+	if _, exists := all[keys.Tenant]; exists && create {
+		return nil
+	}
+	all[keys.Tenant] = keys
+	data, err = json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.file), 0o700); err != nil {
+		return err
+	}
+	tmp := k.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.file)
+}
+
+func (k *Keyring) readFile() (map[string]*TenantKeys, error) {
+	all := make(map[string]*TenantKeys)
+	data, err := os.ReadFile(k.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("corrupt key file %s: %w", k.file, err)
+	}
+	return all, nil
+}
+
+// redacted copies keys without the wrapped key material
+func redacted(keys *TenantKeys) *TenantKeys {
+	out := &TenantKeys{Tenant: keys.Tenant, Current: keys.Current, Keys: make([]WrappedKey, len(keys.Keys))}
+	for i, wk := range keys.Keys {
+		wk.Wrapped = nil
+		out.Keys[i] = wk
+	}
+	return out
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,207 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// masterKey returns a master key spec entry of id with a key derived from
+// seed
+func masterKey(id string, seed byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{seed}, 32))
+}
+
+// testKeyring opens a keyring with the master keys given, keeping data
+// keys in file
+func testKeyring(t *testing.T, file string, masters ...string) *Keyring {
+	t.Helper()
+	t.Setenv("ENCRYPTION_MASTER_KEYS", strings.Join(masters, ","))
+	t.Setenv("KEYRING_FILE", file)
+	k, err := NewFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("ENCRYPTION_MASTER_KEYS", "")
+	if k, err := NewFromEnv(); k != nil || err != nil {
+		t.Errorf("keyring without master keys = %v, %v; want none", k, err)
+	}
+
+	for _, spec := range []string{
+		"nokey",
+		"short:" + base64.StdEncoding.EncodeToString([]byte("too short")),
+		"bad:not base64!",
+		masterKey("m1", 1) + "," + masterKey("m1", 2),
+	} {
+		t.Setenv("ENCRYPTION_MASTER_KEYS", spec)
+		if _, err := NewFromEnv(); err == nil {
+			t.Errorf("master keys %q accepted", spec)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := testKeyring(t, filepath.Join(t.TempDir(), "keys.json"), masterKey("m1", 1))
+	plain := []byte("<html>archived page</html>")
+
+	sealed, err := k.Encrypt("acme", plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(sealed) || bytes.Contains(sealed, plain) {
+		t.Fatal("Encrypt did not produce an envelope hiding the data")
+	}
+	again, _ := k.Encrypt("acme", plain)
+	if bytes.Equal(sealed, again) {
+		t.Error("two encryptions of the same data are identical")
+	}
+	opened, err := k.Decrypt(sealed)
+	if err != nil || !bytes.Equal(opened, plain) {
+		t.Fatalf("Decrypt = %q, %v", opened, err)
+	}
+
+	if _, err := k.Decrypt(plain); err == nil {
+		t.Error("plaintext decrypted")
+	}
+	if _, err := k.Decrypt(sealed[:len(sealed)-1]); err == nil {
+		t.Error("truncated envelope decrypted")
+	}
+	if _, err := k.Decrypt(sealed[:len(magic)+3]); err == nil {
+		t.Error("envelope cut in its header decrypted")
+	}
+}
+
+func TestEnvelopeBoundToTenant(t *testing.T) {
+	k := testKeyring(t, filepath.Join(t.TempDir(), "keys.json"), masterKey("m1", 1))
+	sealed, err := k.Encrypt("acme", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Encrypt("evil", []byte("own data")); err != nil {
+		t.Fatal(err)
+	}
+
+	// An envelope relabelled as another tenant's fails authentication
+	forged := bytes.Replace(sealed, []byte("acme"), []byte("evil"), 1)
+	if _, err := k.Decrypt(forged); err == nil {
+		t.Error("envelope relabelled to another tenant decrypted")
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := k.Decrypt(tampered); err == nil {
+		t.Error("tampered envelope decrypted")
+	}
+}
+
+func TestRotateKeepsOldDataReadable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+	k := testKeyring(t, file, masterKey("m1", 1))
+	old, err := k.Encrypt("acme", []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := k.Rotate("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Current != 2 || len(keys.Keys) != 2 {
+		t.Fatalf("rotated keys = %+v, want versions 1 and 2", keys)
+	}
+	for _, wk := range keys.Keys {
+		if wk.Wrapped != nil {
+			t.Error("Rotate returned wrapped key material")
+		}
+	}
+
+	fresh, _ := k.Encrypt("acme", []byte("after"))
+	for _, sealed := range [][]byte{old, fresh} {
+		if _, err := k.Decrypt(sealed); err != nil {
+			t.Errorf("Decrypt after rotation: %v", err)
+		}
+	}
+
+	// Another process reads both versions from the key file
+	reopened := testKeyring(t, file, masterKey("m1", 1))
+	if plain, err := reopened.Decrypt(old); err != nil || string(plain) != "before" {
+		t.Errorf("Decrypt after reopening = %q, %v", plain, err)
+	}
+}
+
+func TestMasterKeyRotation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+	k := testKeyring(t, file, masterKey("m1", 1))
+	sealed, err := k.Encrypt("acme", []byte("archived"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without its master key, a tenant's data keys cannot be unwrapped
+	withoutOld := testKeyring(t, file, masterKey("m2", 2))
+	if _, err := withoutOld.Decrypt(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt without the wrapping master key = %v, want ErrUnknownKey", err)
+	}
+
+	// Rotating under a new master key re-wraps the tenant's keys, after
+	// which the old master key can be retired
+	both := testKeyring(t, file, masterKey("m2", 2), masterKey("m1", 1))
+	keys, err := both.Rotate("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, wk := range keys.Keys {
+		if wk.MasterKey != "m2" {
+			t.Errorf("version %d still wrapped by %s", wk.Version, wk.MasterKey)
+		}
+	}
+	retired := testKeyring(t, file, masterKey("m2", 2))
+	if plain, err := retired.Decrypt(sealed); err != nil || string(plain) != "archived" {
+		t.Errorf("Decrypt after retiring the old master key = %q, %v", plain, err)
+	}
+}
+
+func TestKeysSharedThroughRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_HOST", mr.Addr())
+	if err := database.InitRedis(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseRedis() })
+
+	a := testKeyring(t, filepath.Join(t.TempDir(), "a.json"), masterKey("m1", 1))
+	b := testKeyring(t, filepath.Join(t.TempDir(), "b.json"), masterKey("m1", 1))
+
+	sealed, err := a.Encrypt("acme", []byte("shared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := b.Decrypt(sealed); err != nil || string(plain) != "shared" {
+		t.Fatalf("Decrypt on another instance = %q, %v", plain, err)
+	}
+
+	// A version rotated in on one instance is picked up by the other
+	if _, err := b.Rotate("acme"); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _ := b.Encrypt("acme", []byte("rotated"))
+	if plain, err := a.Decrypt(rotated); err != nil || string(plain) != "rotated" {
+		t.Errorf("Decrypt of a version rotated elsewhere = %q, %v", plain, err)
+	}
+
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	if _, err := a.Encrypt("new-tenant", []byte("data")); err == nil {
+		t.Error("data key created while Redis fails")
+	}
+}
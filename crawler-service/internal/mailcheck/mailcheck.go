@@ -0,0 +1,145 @@
+// Package mailcheck tells whether email addresses can receive mail, from
+// the MX records of their domains. Mailboxes themselves are not probed:
+// a deliverable address is one whose domain accepts mail. Results are
+// cached in Redis when connected, else in memory.
+package mailcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+)
+
+// Deliverability of an address
+const (
+	Deliverable   = "deliverable"
+	Undeliverable = "undeliverable"
+	Unknown       = "unknown"
+)
+
+const (
+	defaultCacheTTL = 24 * time.Hour
+	// lookupTimeout bounds the DNS lookups of one domain
+	lookupTimeout = 5 * time.Second
+)
+
+// Checker looks up and caches whether domains accept mail
+type Checker struct {
+	resolver *net.Resolver
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedResult
+}
+
+type cachedResult struct {
+	deliverability string
+	expires        time.Time
+}
+
+// NewCheckerFromEnv returns a checker caching results for MX_CACHE_TTL
+// (default 24h)
+func NewCheckerFromEnv() *Checker {
+	ttl := defaultCacheTTL
+	if d, err := time.ParseDuration(os.Getenv("MX_CACHE_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+	return &Checker{
+		resolver: net.DefaultResolver,
+		cacheTTL: ttl,
+		cache:    make(map[string]cachedResult),
+	}
+}
+
+// Check returns the deliverability of an address. Lookups that fail for
+// reasons other than the domain's records, such as timeouts, return
+// Unknown and are not cached.
+func (c *Checker) Check(ctx context.Context, address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 || at == len(address)-1 {
+		return Undeliverable
+	}
+	domain := strings.TrimSuffix(strings.ToLower(address[at+1:]), ".")
+
+	if result, ok := c.cached(domain); ok {
+		return result
+	}
+	result := c.lookup(ctx, domain)
+	if result != Unknown {
+		c.store(domain, result)
+	}
+	return result
+}
+
+// lookup resolves a domain's mail exchangers. A domain without MX records
+// receives mail at its own address (RFC 5321); a null MX (RFC 7505) says it
+// accepts none.
+func (c *Checker) lookup(ctx context.Context, domain string) string {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	records, err := c.resolver.LookupMX(ctx, domain)
+	switch {
+	case err == nil && len(records) == 1 && (records[0].Host == "." || records[0].Host == ""):
+		return Undeliverable
+	case err == nil && len(records) > 0:
+		return Deliverable
+	case err != nil && !notFound(err):
+		return Unknown
+	}
+
+	addrs, err := c.resolver.LookupHost(ctx, domain)
+	switch {
+	case err == nil && len(addrs) > 0:
+		return Deliverable
+	case err != nil && !notFound(err):
+		return Unknown
+	}
+	return Undeliverable
+}
+
+// notFound reports whether a lookup failed because the records do not
+// exist
+func notFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+func (c *Checker) cached(domain string) (string, bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if result, err := rdb.Get(context.Background(), cacheKey(domain)).Result(); err == nil {
+			return result, true
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[domain]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.cache, domain)
+		return "", false
+	}
+	return entry.deliverability, true
+}
+
+func (c *Checker) store(domain, result string) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if rdb.Set(context.Background(), cacheKey(domain), result, c.cacheTTL).Err() == nil {
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache[domain] = cachedResult{deliverability: result, expires: time.Now().Add(c.cacheTTL)}
+}
+
+func cacheKey(domain string) string {
+	return "mx:" + domain
+}
@@ -0,0 +1,298 @@
+package markdown
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// skipped elements never contribute to the Markdown output
+var skipped = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "iframe": true, "head": true, "nav": true, "form": true,
+	"button": true, "select": true,
+}
+
+// blocks are rendered as paragraphs separated by blank lines
+var blocks = map[string]bool{
+	"html": true, "body": true, "p": true, "div": true, "section": true,
+	"article": true, "main": true, "header": true, "footer": true,
+	"aside": true, "figure": true, "figcaption": true, "dl": true, "dt": true,
+	"dd": true, "address": true, "details": true, "summary": true,
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// Convert renders the selected HTML as Markdown, keeping headings, lists,
+// links, emphasis, code, quotes and tables. Relative links and images are
+// resolved against base when it is set.
+func Convert(sel *goquery.Selection, base *url.URL) string {
+	r := &renderer{b: &strings.Builder{}, base: base}
+	for _, n := range sel.Nodes {
+		r.node(n)
+	}
+	return tidy(r.b.String())
+}
+
+// list is the state of an open ul or ol
+type list struct {
+	ordered bool
+	items   int
+}
+
+type renderer struct {
+	b     *strings.Builder
+	base  *url.URL
+	lists []*list
+}
+
+func (r *renderer) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.children(n)
+		return
+	}
+
+	name := n.Data
+	switch {
+	case skipped[name]:
+	case blocks[name]:
+		r.blank()
+		r.children(n)
+		r.blank()
+	case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+		if text := r.inline(n); text != "" {
+			r.blank()
+			r.b.WriteString(strings.Repeat("#", int(name[1]-'0')) + " " + text)
+			r.blank()
+		}
+	case name == "a":
+		text := r.inline(n)
+		href := r.resolve(attr(n, "href"))
+		switch {
+		case text == "":
+		case href == "" || strings.HasPrefix(href, "javascript:"):
+			r.b.WriteString(text)
+		default:
+			r.b.WriteString("[" + text + "](" + href + ")")
+		}
+	case name == "img":
+		if src := r.resolve(attr(n, "src")); src != "" {
+			r.b.WriteString("![" + attr(n, "alt") + "](" + src + ")")
+		}
+	case name == "strong" || name == "b":
+		r.wrap(n, "**")
+	case name == "em" || name == "i":
+		r.wrap(n, "*")
+	case name == "code":
+		r.wrap(n, "`")
+	case name == "br":
+		r.b.WriteString("\n")
+	case name == "hr":
+		r.blank()
+		r.b.WriteString("---")
+		r.blank()
+	case name == "pre":
+		r.blank()
+		r.b.WriteString("```\n" + strings.TrimRight(rawText(n), "\n") + "\n```")
+		r.blank()
+	case name == "blockquote":
+		quoted := tidy(r.capture(n))
+		if quoted != "" {
+			r.blank()
+			r.b.WriteString("> " + strings.ReplaceAll(quoted, "\n", "\n> "))
+			r.blank()
+		}
+	case name == "ul" || name == "ol":
+		if len(r.lists) == 0 {
+			r.blank()
+		}
+		r.lists = append(r.lists, &list{ordered: name == "ol"})
+		r.children(n)
+		r.lists = r.lists[:len(r.lists)-1]
+		if len(r.lists) == 0 {
+			r.blank()
+		}
+	case name == "li":
+		r.item(n)
+	case name == "table":
+		r.table(n)
+	default:
+		r.children(n)
+	}
+}
+
+func (r *renderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.node(c)
+	}
+}
+
+// text writes a text node with its whitespace collapsed
+func (r *renderer) text(s string) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			r.space()
+		}
+		return
+	}
+	if first := s[0]; first == ' ' || first == '\t' || first == '\n' || first == '\r' {
+		r.space()
+	}
+	r.b.WriteString(strings.Join(words, " "))
+	if last := s[len(s)-1]; last == ' ' || last == '\t' || last == '\n' || last == '\r' {
+		r.space()
+	}
+}
+
+// space writes a single space unless the output already ends in whitespace
+func (r *renderer) space() {
+	out := r.b.String()
+	if out == "" || strings.HasSuffix(out, " ") || strings.HasSuffix(out, "\n") {
+		return
+	}
+	r.b.WriteString(" ")
+}
+
+// blank starts a new paragraph
+func (r *renderer) blank() {
+	r.b.WriteString("\n\n")
+}
+
+// capture renders the children of n into a separate buffer
+func (r *renderer) capture(n *html.Node) string {
+	saved := r.b
+	r.b = &strings.Builder{}
+	r.children(n)
+	out := r.b.String()
+	r.b = saved
+	return out
+}
+
+// inline renders the children of n as a single line
+func (r *renderer) inline(n *html.Node) string {
+	return strings.Join(strings.Fields(r.capture(n)), " ")
+}
+
+// wrap writes the inline content of n between markers
+func (r *renderer) wrap(n *html.Node, marker string) {
+	if text := r.inline(n); text != "" {
+		r.b.WriteString(marker + text + marker)
+	}
+}
+
+// item writes a list item, indented by its nesting depth
+func (r *renderer) item(n *html.Node) {
+	depth := len(r.lists)
+	current := &list{}
+	if depth > 0 {
+		current = r.lists[depth-1]
+	} else {
+		depth = 1
+	}
+	current.items++
+
+	marker := "- "
+	if current.ordered {
+		marker = fmt.Sprintf("%d. ", current.items)
+	}
+
+	content := blankLines.ReplaceAllString(strings.TrimSpace(r.capture(n)), "\n")
+	content = strings.ReplaceAll(content, "\n\n", "\n")
+	r.b.WriteString("\n" + strings.Repeat("  ", depth-1) + marker + content)
+}
+
+// table writes a table as a pipe table whose first row is the header
+func (r *renderer) table(n *html.Node) {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.Data != "tr" {
+				walk(c)
+				continue
+			}
+			var cells []string
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+					cells = append(cells, strings.ReplaceAll(r.inline(cell), "|", `\|`))
+				}
+			}
+			if len(cells) > 0 {
+				rows = append(rows, cells)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	r.blank()
+	for i, row := range rows {
+		r.b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			r.b.WriteString("|" + strings.Repeat(" --- |", len(row)) + "\n")
+		}
+	}
+	r.blank()
+}
+
+// resolve makes ref absolute against the base URL
+func (r *renderer) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || r.base == nil {
+		return ref
+	}
+	u, err := r.base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// rawText returns the text of n with whitespace preserved
+func rawText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// tidy trims trailing spaces from lines and collapses runs of blank lines
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
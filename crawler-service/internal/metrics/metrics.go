@@ -0,0 +1,70 @@
+// Package metrics holds the registry of the service's Prometheus metrics
+// and serves it. Metrics are registered at package initialisation with
+// promauto.With(Registry), next to the Go runtime and process collectors.
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// OtherDomain is the domain label of domains past the cardinality cap
+const OtherDomain = "other"
+
+// defaultMaxDomains caps the distinct domain labels without
+// METRICS_MAX_DOMAINS
+const defaultMaxDomains = 500
+
+// Registry holds the service's metrics
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the registry, in the OpenMetrics format to scrapers that
+// ask for it and the Prometheus text format otherwise
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+		Registry:          Registry,
+		EnableOpenMetrics: true,
+	})
+}
+
+var (
+	domainsMu  sync.Mutex
+	domains    = make(map[string]bool)
+	maxDomains = func() int {
+		if n, err := strconv.Atoi(os.Getenv("METRICS_MAX_DOMAINS")); err == nil && n > 0 {
+			return n
+		}
+		return defaultMaxDomains
+	}()
+)
+
+// Domain returns the label a domain is counted under: the domain itself for
+// the first METRICS_MAX_DOMAINS (default 500) seen, OtherDomain after that,
+// so crawling many sites cannot grow the series without bound
+func Domain(domain string) string {
+	domain = strings.ToLower(domain)
+	domainsMu.Lock()
+	defer domainsMu.Unlock()
+	if domains[domain] {
+		return domain
+	}
+	if len(domains) >= maxDomains {
+		return OtherDomain
+	}
+	domains[domain] = true
+	return domain
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var testRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+	Name: "test_requests_total",
+	Help: "Requests made by the tests.",
+}, []string{"domain"})
+
+// scrape fetches the registry with an Accept header, returning the content
+// type and body of the response
+func scrape(t *testing.T, accept string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Header().Get("Content-Type"), string(body)
+}
+
+func TestHandlerNegotiatesFormat(t *testing.T) {
+	testRequests.WithLabelValues(Domain("Example.com")).Inc()
+
+	contentType, body := scrape(t, "")
+	if !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("default content type = %q", contentType)
+	}
+	for _, want := range []string{
+		`test_requests_total{domain="example.com"} 1`,
+		"go_goroutines ",
+		"process_cpu_seconds_total ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape misses %q", want)
+		}
+	}
+
+	contentType, body = scrape(t, "application/openmetrics-text; version=1.0.0")
+	if !strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Errorf("OpenMetrics content type = %q", contentType)
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("OpenMetrics scrape does not end with # EOF")
+	}
+}
+
+func TestDomainCapsLabels(t *testing.T) {
+	defer func(n int) { maxDomains = n }(maxDomains)
+	domainsMu.Lock()
+	maxDomains = len(domains) + 2
+	domainsMu.Unlock()
+
+	if got := Domain("First.example"); got != "first.example" {
+		t.Errorf("Domain = %q, want first.example", got)
+	}
+	Domain("second.example")
+	if got := Domain("third.example"); got != OtherDomain {
+		t.Errorf("Domain past the cap = %q, want %q", got, OtherDomain)
+	}
+	if got := Domain("first.example"); got != "first.example" {
+		t.Errorf("Domain seen before the cap = %q, want first.example", got)
+	}
+}
@@ -1,40 +1,1270 @@
 package models
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Job types
+const (
+	JobTypeCrawl        = "crawl"
+	JobTypeReplay       = "replay"
+	JobTypePasteMonitor = "paste_monitor"
+	JobTypeCodeSearch   = "code_search"
+	JobTypeCTMonitor    = "ct_monitor"
+	JobTypeUsername     = "username_recon"
+	JobTypePageMonitor  = "page_monitor"
+)
+
+// Crawl job modes
+const (
+	CrawlModeLinkCheck = "linkcheck"
+	CrawlModeAPI       = "api"
+)
+
+// Job priorities
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Orders a crawl can visit the links it discovers in
+const (
+	CrawlStrategyBFS     = "bfs"
+	CrawlStrategyDFS     = "dfs"
+	CrawlStrategyFocused = "focused"
+)
+
+// Result sources other than regular crawling
+const (
+	SourcePaste    = "paste"
+	SourceCode     = "code"
+	SourceCT       = "ct"
+	SourceUsername = "username"
+	SourceMonitor  = "monitor"
+	SourceAPI      = "api"
+)
+
+// Page change statuses of monitoring crawls
+const (
+	ChangeNew     = "new"
+	ChangeChanged = "changed"
+)
+
+// Render modes recorded in result provenance
+const (
+	// RenderStatic pages were fetched over HTTP and parsed without running
+	// scripts
+	RenderStatic = "static"
+	// RenderArchive pages were re-extracted from archived HTML
+	RenderArchive = "archive"
+	// RenderAPI results were built from a source's API responses
+	RenderAPI = "api"
+)
 
 // CrawlRequest represents a request to start a crawl
+// Scopes pages are compared in for duplicate content
+const (
+	DedupeScopeJob    = "job"
+	DedupeScopeGlobal = "global"
+)
+
 type CrawlRequest struct {
-	Query         string   `json:"query"`
-	MaxPages      int      `json:"max_pages"`
-	MaxDepth      int      `json:"max_depth"`
+	Query          string   `json:"query"`
+	MaxPages       int      `json:"max_pages"`
+	MaxDepth       int      `json:"max_depth"`
 	AllowedDomains []string `json:"allowed_domains,omitempty"`
-	UserAgent     string   `json:"user_agent,omitempty"`
+	UserAgent      string   `json:"user_agent,omitempty"`
+	Tenant         string   `json:"tenant,omitempty"`
+	// IncludePatterns and ExcludePatterns filter the discovered links a
+	// crawl follows by URL: globs, or regular expressions between slashes.
+	// A link is followed if it matches an include pattern, when there are
+	// any, and no exclude pattern.
+	IncludePatterns []string `json:"include_patterns,omitempty"`
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	// SameDomainOnly keeps a crawl on the hosts of its seed URLs
+	SameDomainOnly bool `json:"same_domain_only,omitempty"`
+	// IgnoreRobots crawls without keeping to robots.txt, where the
+	// compliance profile allows it. By default its Disallow rules and
+	// Crawl-delay are obeyed.
+	IgnoreRobots bool `json:"ignore_robots,omitempty"`
+	// DiscoverSeeds also starts the crawl from the pages the seeds' sites
+	// list in /sitemap.xml, the sitemaps of their robots.txt and the RSS
+	// and Atom feeds the seed pages advertise, newest first
+	DiscoverSeeds bool `json:"discover_seeds,omitempty"`
+	// Region routes the crawl through the egress of a configured region.
+	// Without one, a URL query may be routed by its top-level domain.
+	Region string `json:"region,omitempty"`
+	// ExternalID is the client's own reference for the job; it makes the
+	// job ID deterministic per tenant, so a resubmission is detected
+	ExternalID string `json:"external_id,omitempty"`
+	// CaseID groups jobs belonging to one investigation
+	CaseID string `json:"case_id,omitempty"`
+	// SearchProvider names the search engine that finds the pages a query
+	// crawl starts from (google, bing, serpapi, duckduckgo); empty uses
+	// the deployment's default
+	SearchProvider string `json:"search_provider,omitempty"`
+	// SearchResults is the number of search results crawled from, 10 by
+	// default
+	SearchResults int `json:"search_results,omitempty"`
+
+	// SkipPreviouslySeen marks pages whose content was already crawled for
+	// the tenant as duplicates and withholds them from the intel service
+	SkipPreviouslySeen bool `json:"skip_previously_seen,omitempty"`
+	// DedupeScope marks pages as duplicates of one with the same content
+	// crawled earlier in the same job (job) or for the tenant (global).
+	// NearDuplicates also catches pages whose content differs only in a
+	// few words, by SimHash, and DropDuplicates leaves duplicates out of
+	// the results instead of marking them, without counting them against
+	// max_pages.
+	DedupeScope    string `json:"dedupe_scope,omitempty"`
+	NearDuplicates bool   `json:"near_duplicates,omitempty"`
+	DropDuplicates bool   `json:"drop_duplicates,omitempty"`
+
+	// MaxStorageBytes lowers the configured per-job storage quota
+	MaxStorageBytes int64 `json:"max_storage_bytes,omitempty"`
+
+	// Type selects the job type: crawl (default) or replay
+	Type string `json:"type,omitempty"`
+	// Mode changes what a crawl job does: linkcheck crawls the site at the
+	// query URL and reports broken links instead of storing content; api
+	// reads the JSON API endpoint at the query URL, following its
+	// pagination, and extracts records with the API rules
+	Mode string `json:"mode,omitempty"`
+	// API holds the extraction and pagination rules of an api mode crawl
+	API *APIRules `json:"api,omitempty"`
+	// ReplayOf names the job whose archived HTML a replay job re-extracts
+	ReplayOf string `json:"replay_of,omitempty"`
+	// CodeSearchProviders selects the code hosts a code_search job queries
+	// (github, gitlab); empty queries all configured hosts
+	CodeSearchProviders []string `json:"code_search_providers,omitempty"`
+	// DomainPatterns lists the domains a ct_monitor job watches certificate
+	// transparency logs for; a leading "*." matches subdomains
+	DomainPatterns []string `json:"domain_patterns,omitempty"`
+	// Username is the handle a username_recon job probes platforms for
+	Username string `json:"username,omitempty"`
+	// FollowUpCrawl starts a crawl of every host newly seen by a ct_monitor
+	// job and of every profile found by a username_recon job
+	FollowUpCrawl bool `json:"follow_up_crawl,omitempty"`
+	// CheckBreaches looks up email addresses found on crawled pages in
+	// Have I Been Pwned
+	CheckBreaches bool `json:"check_breaches,omitempty"`
+	// VerifyEmails marks the email addresses found on crawled pages
+	// deliverable or not by the MX records of their domains
+	VerifyEmails bool `json:"verify_emails,omitempty"`
+	// ReverseImageSearch submits the images found on crawled pages to the
+	// configured reverse image search provider
+	ReverseImageSearch bool `json:"reverse_image_search,omitempty"`
+	// RenderJS renders pages that are script-rendered shells when fetched
+	// statically in headless Chrome; other pages are kept as fetched
+	RenderJS bool `json:"render_js,omitempty"`
+	// GeoEXIF downloads the first images of each page to read EXIF GPS
+	// positions into the result's geo block and capture times into its
+	// dates
+	GeoEXIF bool `json:"geo_exif,omitempty"`
+	// WatchSelector is the CSS selector of the section a page_monitor job
+	// watches; only changes inside it raise alerts
+	WatchSelector string `json:"watch_selector,omitempty"`
+	// MonitorIntervalSeconds sets how often a page_monitor job polls
+	MonitorIntervalSeconds int `json:"monitor_interval_seconds,omitempty"`
+	// MinChangeScore is the change significance (0-1) a page_monitor job
+	// needs before it alerts; smaller changes are recorded silently
+	MinChangeScore float64 `json:"min_change_score,omitempty"`
+	// FollowUpOf is set internally on crawls started by another job
+	FollowUpOf string `json:"-"`
+	// SeedURLs are crawled directly instead of searching for the query,
+	// which becomes optional. Continuations seed themselves with their
+	// parent's unvisited URLs.
+	SeedURLs []string `json:"seed_urls,omitempty"`
+	// ContinueOf, Visited and SlowDomains are set internally on crawls
+	// continuing another: the URLs the parent visited are not fetched again
+	// and domains that rate limited it are crawled gently
+	ContinueOf  string   `json:"-"`
+	Visited     []string `json:"-"`
+	SlowDomains []string `json:"-"`
+	// Cookies are the sessions a continuation resumes with
+	Cookies []JobCookie `json:"-"`
+	// Resume is set internally on a crawl resumed in place: it keeps the
+	// job's results and page count and carries on from there
+	Resume bool `json:"-"`
+	// Continuous is set internally on the runs of a tenant's continuous
+	// crawl, whose pages go back into its frontier
+	Continuous bool `json:"-"`
+	// WarmStart seeds the crawl with the most relevant pages of the
+	// tenant's last crawl of the same query, alongside the search results;
+	// pages whose content was already collected are marked as previously
+	// seen. WarmStartOf and WarmSeeds are set internally to that crawl and
+	// its pages.
+	WarmStart   bool     `json:"warm_start,omitempty"`
+	WarmStartOf string   `json:"-"`
+	WarmSeeds   []string `json:"-"`
+	// Monitor re-crawls the pages earlier monitoring crawls under the same
+	// MonitorKey saw, alongside the seeds, fetching each conditionally with
+	// the ETag and Last-Modified it was served with. Unchanged pages are
+	// left out of the results, so only new and changed pages reach the
+	// intel service, each with a Change describing what differs.
+	// MonitorKey defaults to one derived from the query, or the seed URLs.
+	Monitor    bool   `json:"monitor,omitempty"`
+	MonitorKey string `json:"monitor_key,omitempty"`
+	// MinQuality skips pages whose quality score (0-1) is lower; they do
+	// not count against max_pages
+	MinQuality float64 `json:"min_quality,omitempty"`
+	// Filters drop or flag pages by their content before they are stored
+	Filters *ContentFilters `json:"filters,omitempty"`
+	// QueryParams are rules for the query parameters that decide whether a
+	// link is new. Tracking and session parameters (utm_*, fbclid, gclid,
+	// sessionid, ...) are always ignored unless kept by a rule.
+	QueryParams []QueryParamRule `json:"query_params,omitempty"`
+	// Languages crawls the hreflang alternates of crawled pages in these
+	// languages ("de" covers de-at and de-ch) and skips alternates in
+	// others. SkipAlternates skips every alternate instead.
+	Languages      []string `json:"languages,omitempty"`
+	SkipAlternates bool     `json:"skip_alternates,omitempty"`
+	// PreferVariant (amp or print) extracts a page's AMP or print-friendly
+	// version in place of the page when it has one
+	PreferVariant string `json:"prefer_variant,omitempty"`
+	// CaptureHTML archives the raw HTML of every crawled page
+	CaptureHTML bool `json:"capture_html,omitempty"`
+	// CaptureScreenshot archives a PNG screenshot of every crawled page,
+	// taken in the renderer; it needs JS rendering configured
+	CaptureScreenshot bool `json:"capture_screenshot,omitempty"`
+	// Emulation sets the device and locale the pages the job renders or
+	// screenshots are loaded as; it needs render_js or capture_screenshot
+	Emulation *RenderEmulation `json:"emulation,omitempty"`
+	// IncludeDocuments takes the PDFs, Word files and plain text files a
+	// crawl reaches as pages, read into text; otherwise only HTML pages are
+	// taken. Documents over MaxDocumentBytes (default DOCUMENT_MAX_BYTES)
+	// are skipped.
+	IncludeDocuments bool  `json:"include_documents,omitempty"`
+	MaxDocumentBytes int64 `json:"max_document_bytes,omitempty"`
+	// ExtractProducts parses product offers (name, price, currency,
+	// availability, SKU) from schema.org markup and storefront pages
+	ExtractProducts bool `json:"extract_products,omitempty"`
+	// ExtractOrganizations reads names, addresses, register numbers, VAT
+	// IDs and officers from contact, about and imprint pages into a record
+	// per domain
+	ExtractOrganizations bool `json:"extract_organizations,omitempty"`
+	// ExtractPhones lists the phone numbers on every page in E.164 with
+	// their country and line type. Numbers in national format are read in
+	// the country of the page's country-code TLD, else in PhoneRegion (an
+	// ISO 3166-1 alpha-2 code).
+	ExtractPhones bool   `json:"extract_phones,omitempty"`
+	PhoneRegion   string `json:"phone_region,omitempty"`
+	// ExtractionRules map result field names to a CSS selector whose first
+	// match's text is read into the page's fields, or its attribute with a
+	// trailing @attribute (e.g. "time.published@datetime"). The title and
+	// content fields replace the page's own.
+	ExtractionRules map[string]string `json:"extraction_rules,omitempty"`
+	// DomainExtractionRules holds rule sets for particular domains and
+	// their subdomains; on their pages, a set's rules take precedence over
+	// ExtractionRules
+	DomainExtractionRules map[string]map[string]string `json:"domain_extraction_rules,omitempty"`
+	// TimestampHTML obtains a trusted timestamp for the digest of every
+	// archived page; it needs capture_html and TSA_URL
+	TimestampHTML bool `json:"timestamp_html,omitempty"`
+	// Processors selects which registered result processors run for this
+	// job; empty runs all of them
+	Processors []string `json:"processors,omitempty"`
+	// Scripts names tenant extraction scripts to run on every page
+	Scripts []string `json:"scripts,omitempty"`
+	// Secrets maps logical names to secret manager references
+	// (provider:path[#key]); values are resolved when the crawl starts and
+	// never stored on the job
+	Secrets map[string]string `json:"secrets,omitempty"`
+	// Headers are sent with every request and may reference secrets as
+	// ${secret:name}
+	Headers map[string]string `json:"headers,omitempty"`
+	// MaxRuntimeSeconds lowers the configured wall-clock ceiling for the job
+	MaxRuntimeSeconds int `json:"max_runtime_seconds,omitempty"`
+	// MaxParallelism caps how many requests the crawl ramps up to having
+	// in flight (default 4, at most 16)
+	MaxParallelism int `json:"max_parallelism,omitempty"`
+	// MaxRetries is how often a request failing transiently is retried;
+	// zero uses the deployment's default and a negative value turns
+	// retries off
+	MaxRetries int `json:"max_retries,omitempty"`
+	// Priority orders the job in the queue: high, normal (default) or low.
+	// Where the deployment allows, a high priority job waiting for a worker
+	// pauses a running low priority crawl, which resumes afterwards.
+	Priority string `json:"priority,omitempty"`
+	// CrawlStrategy orders the links the crawl follows across all pages:
+	// bfs (shallowest first), dfs (deepest first) or focused (most
+	// relevant to the query first). Without one, each page's links are
+	// ranked by the URL scorer and fetched as they are found.
+	CrawlStrategy string `json:"crawl_strategy,omitempty"`
+	// DomainCredentials authenticates requests to hosts matching each domain
+	// glob (e.g. *.intranet.example); values may reference secrets
+	DomainCredentials map[string]DomainCredential `json:"domain_credentials,omitempty"`
+	// ClientCertificates are presented to matching domains during the TLS
+	// handshake; certificate and key are PEM and usually secret references
+	ClientCertificates []ClientCertificate `json:"client_certificates,omitempty"`
+	// Webhooks receive the job's page and completion events as it runs
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+	// CallbackURL is POSTed a signed summary of the job once it completes,
+	// fails or is cancelled
+	CallbackURL string `json:"callback_url,omitempty"`
+	// APIKeyID is the API key the job was requested with, set by the API
+	APIKeyID string `json:"-"`
+	// ComplianceProfile names the constraints the job collects under
+	// (strict, standard, permissive or an operator-defined profile);
+	// empty uses the deployment default
+	ComplianceProfile string `json:"compliance_profile,omitempty"`
+	// Outputs are the sinks the job's results are delivered to: intel,
+	// s3://bucket/prefix, kafka:topic or webhook:url; empty delivers to the
+	// intel service only
+	Outputs []string `json:"outputs,omitempty"`
+	// BrowserProfiles limits the browser header profiles a crawl rotates
+	// through to the named profiles or browser families (chrome, firefox,
+	// safari); empty rotates through all of them. A set user_agent turns
+	// rotation off.
+	BrowserProfiles []string `json:"browser_profiles,omitempty"`
+	// Identify sends the crawler's own user agent, linking to its info
+	// page, and a From header with the operator's contact instead of
+	// rotating browser profiles
+	Identify bool `json:"identify,omitempty"`
+	// ExcludeCategories skips hosts in any of the operator's domain
+	// categories named (e.g. adult)
+	ExcludeCategories []string `json:"exclude_categories,omitempty"`
+	// DedupeWindow, in seconds, returns the tenant's pending or running job
+	// with the same query and parameters, if it started within the window,
+	// instead of starting an identical crawl alongside it. Zero uses
+	// CRAWL_DEDUPE_WINDOW; a negative window always starts a new job.
+	DedupeWindow int `json:"dedupe_window,omitempty"`
+	// RetentionHours is how long the job and its results are kept once it
+	// finishes; zero uses the deployment's default, JOB_RETENTION_HOURS
+	RetentionHours int `json:"retention_hours,omitempty"`
+}
+
+// APIRules describe how an api mode crawl reads JSON responses. Paths are
+// JSONPath expressions ($.data[*], $.meta.next).
+type APIRules struct {
+	// Endpoints are further API URLs crawled after the query URL
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Items selects the records of a response; a selected array counts as
+	// its elements. Empty makes each response one record.
+	Items string `json:"items,omitempty"`
+	// Fields maps result field names to paths evaluated on each record.
+	// The url, title and content fields fill the result's own; content
+	// defaults to the record's JSON.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Next selects the next page pointer of a response: a URL, resolved
+	// against the response's, or, when CursorParam is set, a cursor sent in
+	// that query parameter of the current URL
+	Next        string `json:"next,omitempty"`
+	CursorParam string `json:"cursor_param,omitempty"`
+}
+
+// DomainCredential holds HTTP authentication for a domain. An oauth2
+// credential is a client-credentials grant: username and password are the
+// client ID and secret, exchanged at token_url for bearer tokens that are
+// renewed as they expire. Headers and cookies are sent with every request
+// to the domain, alongside or instead of authentication; like the username
+// and password their values may reference secrets.
+type DomainCredential struct {
+	Type     string            `json:"type,omitempty"` // basic (default), digest or oauth2
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	TokenURL string            `json:"token_url,omitempty"`
+	Scopes   []string          `json:"scopes,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+}
+
+// QueryParamRule decides how a query parameter counts when telling whether
+// a URL has been seen before
+type QueryParamRule struct {
+	// Param is the parameter name; a trailing * matches a prefix (utm_*)
+	Param string `json:"param"`
+	// Action is strip (ignore the parameter), keep (let it distinguish
+	// URLs, overriding the built-in strip list) or canonicalize (treat
+	// every value as Value)
+	Action string `json:"action"`
+	Value  string `json:"value,omitempty"`
+}
+
+// ClientCertificate is a TLS client certificate for a set of domains
+type ClientCertificate struct {
+	Domains     []string `json:"domains"`
+	Certificate string   `json:"certificate"`
+	PrivateKey  string   `json:"private_key"`
+}
+
+// ComplianceProfile is a named set of legal and ethical constraints a job
+// is held to by the server
+type ComplianceProfile struct {
+	Name string `json:"name"`
+	// RespectRobots obeys robots.txt
+	RespectRobots bool `json:"respect_robots"`
+	// AllowLogins permits domain credentials, client certificates and
+	// authorization or cookie headers
+	AllowLogins bool `json:"allow_logins"`
+	// AllowTor permits .onion hosts
+	AllowTor bool `json:"allow_tor"`
+	// PublicOnly refuses private and internal network addresses and
+	// local files
+	PublicOnly bool `json:"public_only"`
+}
+
+// ContentFilters decide which crawled pages a job keeps. Pages failing a
+// filter are dropped, or with the flag action kept and marked with the
+// filters they failed.
+type ContentFilters struct {
+	// Languages keeps pages in these languages ("de" covers de-at), as
+	// declared by the page or detected from its text. Pages whose language
+	// cannot be told are kept.
+	Languages []string `json:"languages,omitempty"`
+	// Require keeps pages mentioning one of the patterns and Exclude drops
+	// pages mentioning any. A pattern between slashes is a regular
+	// expression, any other a keyword matched ignoring case, in the title
+	// and content.
+	Require []string `json:"require,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// MinContentLength drops pages with fewer characters of content
+	MinContentLength int `json:"min_content_length,omitempty"`
+	// Action is drop (default) or flag
+	Action string `json:"action,omitempty"`
+}
+
+// Webhook delivers a job's events to a URL in batches
+type Webhook struct {
+	URL string `json:"url"`
+	// Secret signs each delivery (X-GodsEye-Signature: sha256=<hmac>) and
+	// may reference a secret as ${secret:name}
+	Secret string `json:"secret,omitempty"`
+	// Events selects page.crawled and/or job.finished; empty sends both
+	Events []string `json:"events,omitempty"`
+	// Domains, MinQuality and Keywords limit which pages are sent; a page
+	// must be on one of the domains (or a subdomain), score at least
+	// MinQuality and mention one of the keywords
+	Domains    []string `json:"domains,omitempty"`
+	MinQuality float64  `json:"min_quality,omitempty"`
+	Keywords   []string `json:"keywords,omitempty"`
+	// BatchSize events are sent together (default 1); BatchSeconds sends a
+	// partial batch once it has waited that long
+	BatchSize    int `json:"batch_size,omitempty"`
+	BatchSeconds int `json:"batch_seconds,omitempty"`
+}
+
+// FetchRequest represents a request to synchronously fetch a single URL
+type FetchRequest struct {
+	URL            string `json:"url"`
+	UserAgent      string `json:"user_agent,omitempty"`
+	RenderJS       bool   `json:"render_js,omitempty"`
+	Screenshot     bool   `json:"screenshot,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	// CaptureNetwork lists URL patterns (globs such as */api/*) of the XHR
+	// and fetch requests whose JSON responses are kept with the rendered
+	// page; it needs render_js
+	CaptureNetwork []string `json:"capture_network,omitempty"`
+	// ScrollCount scrolls a rendered page to the bottom up to this many
+	// times before extraction, waiting ScrollIntervalMS (default 1000)
+	// after each scroll and stopping once the page stops growing, so
+	// infinite-scroll listings are expanded; it needs render_js
+	ScrollCount      int `json:"scroll_count,omitempty"`
+	ScrollIntervalMS int `json:"scroll_interval_ms,omitempty"`
+	// Emulation sets the device and locale the page is rendered as; it
+	// needs render_js
+	Emulation *RenderEmulation `json:"emulation,omitempty"`
+	// CompareRender fetches the page both statically and rendered and
+	// reports in the result's render_diff how much content rendering
+	// added; it needs render_js
+	CompareRender bool `json:"compare_render,omitempty"`
+}
+
+// RenderEmulation is the device and locale a rendered page sees. Unset
+// values keep the renderer's defaults.
+type RenderEmulation struct {
+	ViewportWidth     int     `json:"viewport_width,omitempty"`
+	ViewportHeight    int     `json:"viewport_height,omitempty"`
+	DeviceScaleFactor float64 `json:"device_scale_factor,omitempty"`
+	// Timezone is an IANA time zone name (Europe/Berlin)
+	Timezone string `json:"timezone,omitempty"`
+	// Language is the BCP 47 tag reported as navigator.language and sent
+	// as Accept-Language (de-DE)
+	Language string `json:"language,omitempty"`
 }
 
 // CrawlJob represents a crawl job
 type CrawlJob struct {
-	ID            string    `json:"id"`
-	Query         string    `json:"query"`
-	Status        string    `json:"status"` // pending, running, completed, failed
-	MaxPages      int       `json:"max_pages"`
-	MaxDepth      int       `json:"max_depth"`
-	PagesCrawled  int       `json:"pages_crawled"`
-	URLsFound     int       `json:"urls_found"`
-	StartedAt     time.Time `json:"started_at,omitempty"`
-	CompletedAt   time.Time `json:"completed_at,omitempty"`
-	Error         string    `json:"error,omitempty"`
-	Results       []CrawlResult `json:"results,omitempty"`
+	ID           string        `json:"id"`
+	Query        string        `json:"query"`
+	Status       string        `json:"status"` // pending, running, stalled, completed, failed, cancelled
+	MaxPages     int           `json:"max_pages"`
+	MaxDepth     int           `json:"max_depth"`
+	PagesCrawled int           `json:"pages_crawled"`
+	URLsFound    int           `json:"urls_found"`
+	StartedAt    time.Time     `json:"started_at,omitempty"`
+	CompletedAt  time.Time     `json:"completed_at,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	Results      []CrawlResult `json:"results,omitempty"`
+	Tenant       string        `json:"tenant"`
+	ExternalID   string        `json:"external_id,omitempty"`
+	CaseID       string        `json:"case_id,omitempty"`
+	StorageBytes int64         `json:"storage_bytes"`
+	QuotaStatus  string        `json:"quota_status,omitempty"` // truncated, rejected
+	ResultsRef   string        `json:"results_ref,omitempty"`
+	// ResultSeq is the sequence number last given to one of the job's
+	// results
+	ResultSeq   int64          `json:"result_seq,omitempty"`
+	Type        string         `json:"type,omitempty"`
+	Mode        string         `json:"mode,omitempty"`
+	ReplayOf    string         `json:"replay_of,omitempty"`
+	Processors  []string       `json:"processors,omitempty"`
+	Secrets     []string       `json:"secrets,omitempty"`
+	ErrorCode   string         `json:"error_code,omitempty"`
+	ErrorCounts map[string]int `json:"error_counts,omitempty"`
+	Partial     bool           `json:"partial,omitempty"`
+	Restarts    int            `json:"restarts,omitempty"`
+	FollowUpOf  string         `json:"follow_up_of,omitempty"`
+	ContinueOf  string         `json:"continue_of,omitempty"`
+	// Continuous marks a run of a tenant's continuous crawl
+	Continuous bool `json:"continuous,omitempty"`
+	// Resumes counts the times the crawl was resumed after being
+	// interrupted, the last at ResumedAt
+	Resumes   int        `json:"resumes,omitempty"`
+	ResumedAt *time.Time `json:"resumed_at,omitempty"`
+	// Priority is the job's queue priority; Preemptions counts the times
+	// the crawl was paused to free its worker for a job of higher priority
+	Priority    string `json:"priority,omitempty"`
+	Preemptions int    `json:"preemptions,omitempty"`
+	// WarmStartOf is the prior crawl of the same query a warm start took
+	// seeds from
+	WarmStartOf string `json:"warm_start_of,omitempty"`
+	// Region is the region the crawl's requests were routed through
+	Region string `json:"region,omitempty"`
+	// Frontier lists URLs the crawl discovered but did not visit for lack
+	// of budget, depth, quota or time, or because it was rate limited; a
+	// continuation job starts from them
+	Frontier []string `json:"frontier,omitempty"`
+	// Options is the request the job was started with, kept while the
+	// service runs so continuations inherit it
+	Options *CrawlRequest `json:"-"`
+	// Cookies are the cookies the crawled hosts set, each kept to its own
+	// host, saved when the crawl stops so restarts and continuations
+	// resume the same sessions
+	Cookies []JobCookie `json:"cookies,omitempty"`
+	// CountryCounts counts crawled pages per hosting country
+	CountryCounts map[string]int `json:"country_counts,omitempty"`
+	// LowQualityPages counts pages skipped for scoring below min_quality
+	LowQualityPages int `json:"low_quality_pages,omitempty"`
+	// Coverage reports, per domain, how many URLs the crawl requested and
+	// which discovered URLs it did not visit and why
+	Coverage map[string]DomainCoverage `json:"coverage,omitempty"`
+	// ResponseTimes summarises, per host, how quickly the crawl's requests
+	// were answered and the timeout they were given
+	ResponseTimes map[string]DomainTiming `json:"response_times,omitempty"`
+	// DomainStats breaks the crawl's requests, pages, bytes and errors
+	// down per host
+	DomainStats map[string]DomainStats `json:"domain_stats,omitempty"`
+	// Parallelism is the state of the crawl's concurrency ramp
+	Parallelism *ParallelismRamp `json:"parallelism,omitempty"`
+	// Retries counts requests retried after failing transiently
+	Retries int `json:"retries,omitempty"`
+	// FailedURLs lists the URLs that could not be fetched, after any
+	// retries
+	FailedURLs []FailedURL `json:"failed_urls,omitempty"`
+	// DuplicateURLs counts links skipped because a URL differing only in
+	// ignored query parameters was already queued
+	DuplicateURLs int `json:"duplicate_urls,omitempty"`
+	// SeedsDiscovered counts the pages a discover_seeds crawl was seeded
+	// with from sitemaps and feeds
+	SeedsDiscovered int `json:"seeds_discovered,omitempty"`
+	// DuplicatePages counts pages found to duplicate another under the
+	// job's dedupe_scope
+	DuplicatePages int `json:"duplicate_pages,omitempty"`
+	// FilteredPages counts the pages failing each of the job's content
+	// filters; a page failing several counts under each
+	FilteredPages map[string]int `json:"filtered_pages,omitempty"`
+	// PagesUnchanged counts pages a monitoring crawl found unchanged since
+	// it last saw them, answered 304 Not Modified or with the same content
+	PagesUnchanged int `json:"pages_unchanged,omitempty"`
+	// RobotsBlocked counts URLs left unvisited because robots.txt
+	// disallows them
+	RobotsBlocked int `json:"robots_blocked,omitempty"`
+	// Soft404Pages counts error pages served with a success status, which
+	// are not counted in PagesCrawled
+	Soft404Pages int `json:"soft_404_pages,omitempty"`
+	// RenderCandidates counts pages that looked rendered by scripts when
+	// fetched statically
+	RenderCandidates int `json:"render_candidates,omitempty"`
+	// PagesRendered counts pages read from headless Chrome for render_js
+	PagesRendered int `json:"pages_rendered,omitempty"`
+	// ParkedDomains maps crawled hosts serving parking landers to the
+	// parking provider
+	ParkedDomains map[string]string `json:"parked_domains,omitempty"`
+	// Organizations maps registrable domains to what their contact and
+	// imprint pages say about the organisation behind them
+	Organizations map[string]*Organization `json:"organizations,omitempty"`
+	// LinkedDomains counts outbound links per external registrable domain
+	LinkedDomains map[string]LinkedDomain `json:"linked_domains,omitempty"`
+	// LinkCheck is the broken link report of a linkcheck crawl
+	LinkCheck *LinkCheckReport `json:"link_check,omitempty"`
+	// Compliance records the constraints the job collected under
+	Compliance *ComplianceProfile `json:"compliance,omitempty"`
+	// Outputs reports the delivery of the job's results to each declared
+	// output
+	Outputs []OutputDelivery `json:"outputs,omitempty"`
+	// Callback reports the delivery of the job's completion callback
+	Callback *CallbackDelivery `json:"callback,omitempty"`
+	// APIKey is the ID of the API key that started the job, whose quotas
+	// it counts against
+	APIKey string `json:"api_key,omitempty"`
+	// Cost accounts the resources the job consumed, for chargeback
+	Cost JobCost `json:"cost"`
+	// DeletedAt is set when the job has been soft-deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// RetentionHours is how long the job is kept once it finishes before
+	// it is purged; zero keeps it until deleted
+	RetentionHours int `json:"retention_hours,omitempty"`
+	// ResultsDeletedAt is set when the job's results were deleted ahead of
+	// the job
+	ResultsDeletedAt *time.Time `json:"results_deleted_at,omitempty"`
+	// Notes are the analysts' notes on the job, oldest first
+	Notes []JobNote `json:"notes,omitempty"`
+	// Assignees are the analysts the job is assigned to
+	Assignees []string `json:"assignees,omitempty"`
+	// History records every change made to the job's case, assignees
+	// and notes after it was created, oldest first
+	History []JobChange `json:"history,omitempty"`
+}
+
+// FailedURL is a URL a crawl could not fetch
+type FailedURL struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error"`
+	ErrorCode  string `json:"error_code"`
+	// Attempts counts the requests made, retries included
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// JobNote is a free-text note attached to a job
+type JobNote struct {
+	At     time.Time `json:"at"`
+	Author string    `json:"author"`
+	Text   string    `json:"text"`
+}
+
+// JobChange is one change to a job's annotations: the field changed, by
+// whom, and its values before and after. Notes are only ever added, so
+// their changes carry the new note alone.
+type JobChange struct {
+	At    time.Time   `json:"at"`
+	Actor string      `json:"actor"`
+	Field string      `json:"field"`
+	From  interface{} `json:"from,omitempty"`
+	To    interface{} `json:"to,omitempty"`
+}
+
+// JobAnnotationRequest changes a job's annotations. Fields left out are
+// kept; an empty case_id or assignees list clears them.
+type JobAnnotationRequest struct {
+	CaseID    *string   `json:"case_id"`
+	Assignees *[]string `json:"assignees"`
+	// Note is added to the job's notes
+	Note string `json:"note"`
+}
+
+// JobCost is the resource consumption of a job
+type JobCost struct {
+	Pages int `json:"pages"`
+	// Requests counts HTTP requests made, including failed ones and
+	// requests for images and other assets
+	Requests int `json:"requests"`
+	// Bytes counts response bytes downloaded; ProxyBytes those that went
+	// through a proxy
+	Bytes      int64 `json:"bytes"`
+	ProxyBytes int64 `json:"proxy_bytes"`
+	// RenderMinutes is the time spent rendering pages in a headless browser
+	RenderMinutes float64 `json:"render_minutes"`
+	// APICalls counts calls to external services (hibp, tsa, ...)
+	APICalls map[string]int `json:"api_calls,omitempty"`
+}
+
+// JobCookie is a cookie a host set during a crawl
+type JobCookie struct {
+	Host     string     `json:"host"`
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+	HttpOnly bool       `json:"http_only,omitempty"`
+}
+
+// Output delivery statuses
+const (
+	OutputPending   = "pending"
+	OutputRetrying  = "retrying"
+	OutputDelivered = "delivered"
+	OutputFailed    = "failed"
+	// OutputQueued is an intel output whose results wait in the intel
+	// outbox; the job's intel delivery tracks them from there
+	OutputQueued = "queued"
+)
+
+// OutputDelivery is the state of result delivery to one of a job's outputs.
+// Monitors deliver repeatedly; the state describes the latest delivery.
+type OutputDelivery struct {
+	Output   string `json:"output"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// Results counts the results handed to the output so far
+	Results     int        `json:"results"`
+	Error       string     `json:"error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// IntelDelivery is the state of a job's deliveries to the intel service.
+// Results are queued in an outbox in batches, and each batch is retried on
+// its own until it is delivered or runs out of attempts.
+type IntelDelivery struct {
+	Status string `json:"status"`
+	// Batches counts the batches queued so far, and Results the results in
+	// them
+	Batches          int `json:"batches"`
+	BatchesDelivered int `json:"batches_delivered"`
+	BatchesFailed    int `json:"batches_failed"`
+	Results          int `json:"results"`
+	ResultsDelivered int `json:"results_delivered"`
+	// Recent holds the latest batches, oldest first
+	Recent    []IntelBatchDelivery `json:"recent"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// IntelBatchDelivery is the state of one batch of results queued for the
+// intel service
+type IntelBatchDelivery struct {
+	ID            string     `json:"id"`
+	Results       int        `json:"results"`
+	Bytes         int        `json:"bytes"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	Error         string     `json:"error,omitempty"`
+	QueuedAt      time.Time  `json:"queued_at"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// CallbackDelivery is the state of a job's completion callback. It stays
+// pending until the job finishes.
+type CallbackDelivery struct {
+	URL         string     `json:"url"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	Error       string     `json:"error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// LinkCheckReport lists the broken links a linkcheck crawl found
+type LinkCheckReport struct {
+	PagesCrawled int          `json:"pages_crawled"`
+	LinksChecked int          `json:"links_checked"`
+	Broken       []BrokenLink `json:"broken"`
+}
+
+// BrokenLink is a link that returned an error status or could not be
+// fetched, with the pages linking to it
+type BrokenLink struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	External   bool   `json:"external"`
+	// Referrers are the first pages found linking here (capped), with the
+	// anchor text each used
+	Referrers []LinkReferrer `json:"referrers"`
+}
+
+// LinkReferrer is a page linking to a checked URL
+type LinkReferrer struct {
+	Page       string `json:"page"`
+	AnchorText string `json:"anchor_text,omitempty"`
+}
+
+// LinkedDomain counts how often crawled pages link to an external domain
+type LinkedDomain struct {
+	Links int `json:"links"`
+	Pages int `json:"pages"`
 }
 
 // CrawlResult represents a single crawled page
 type CrawlResult struct {
-	URL         string    `json:"url"`
-	Title       string    `json:"title"`
-	Content     string    `json:"content"`
-	Links       []string  `json:"links"`
-	CrawledAt   time.Time `json:"crawled_at"`
-	StatusCode  int       `json:"status_code"`
-	Error       string    `json:"error,omitempty"`
+	// Seq numbers the results of a job in the order they were added; it
+	// only grows, so consumers can ask for the results after the last one
+	// they saw
+	Seq            int64             `json:"seq,omitempty"`
+	URL            string            `json:"url"`
+	Title          string            `json:"title"`
+	Content        string            `json:"content"`
+	Links          []Link            `json:"links"`
+	CrawledAt      time.Time         `json:"crawled_at"`
+	StatusCode     int               `json:"status_code"`
+	Error          string            `json:"error,omitempty"`
+	ContentHash    string            `json:"content_hash,omitempty"`
+	DuplicateOf    string            `json:"duplicate_of,omitempty"`
+	HTMLRef        string            `json:"html_ref,omitempty"`
+	ScreenshotRef  string            `json:"screenshot_ref,omitempty"`
+	Fields         map[string]string `json:"fields,omitempty"`
+	ErrorCode      string            `json:"error_code,omitempty"`
+	Depth          int               `json:"depth"`
+	DiscoveredFrom string            `json:"discovered_from,omitempty"`
+	CID            string            `json:"cid,omitempty"` // IPFS content identifier
+	Source         string            `json:"source,omitempty"`
+	HostIntel      []HostIntel       `json:"host_intel,omitempty"`
+	Emails         []EmailEntity     `json:"emails,omitempty"`
+	Phones         []PhoneEntity     `json:"phones,omitempty"`
+	Media          []MediaAsset      `json:"media,omitempty"`
+	Hosting        *GeoInfo          `json:"hosting,omitempty"`
+	Geo            *ContentGeo       `json:"geo,omitempty"`
+	Dates          []DatedEvent      `json:"dates,omitempty"`
+
+	// ContentMarkdown is the main content converted to Markdown
+	ContentMarkdown string `json:"content_markdown,omitempty"`
+	// Tables are the data tables found on the page
+	Tables []Table `json:"tables,omitempty"`
+	// Network holds the JSON responses to the page's XHR and fetch requests
+	// captured while it was rendered
+	Network []NetworkCapture `json:"network,omitempty"`
+	// Screenshot is a PNG of the page taken for a fetch that asked for
+	// one; crawls archive theirs under ScreenshotRef instead
+	Screenshot []byte `json:"screenshot,omitempty"`
+	// RenderDiff compares the page's static and rendered content when the
+	// fetch asked for compare_render
+	RenderDiff *RenderDiff `json:"render_diff,omitempty"`
+	// FilteredBy lists the content filters the page failed, when the job
+	// flags such pages instead of dropping them
+	FilteredBy []string `json:"filtered_by,omitempty"`
+	// Change describes how the page differs from when a monitoring crawl
+	// last saw it
+	Change *PageChange `json:"change,omitempty"`
+	// Parked marks domain-parking and for-sale landers; ParkingProvider
+	// names the parking service or, failing that, the kind of lander
+	Parked          bool   `json:"parked,omitempty"`
+	ParkingProvider string `json:"parking_provider,omitempty"`
+	// AMPURL and PrintURL are the page's AMP and print-friendly versions
+	AMPURL   string `json:"amp_url,omitempty"`
+	PrintURL string `json:"print_url,omitempty"`
+	// Variant (amp or print) is set when the page is itself such a version
+	// of the page at VariantOf; the original is then not crawled again
+	Variant   string `json:"variant,omitempty"`
+	VariantOf string `json:"variant_of,omitempty"`
+	// Language is the page's language and Alternates its hreflang
+	// versions in other languages. Alternates crawled in the same job are
+	// folded into this result as Translations instead of results of their
+	// own.
+	Language     string        `json:"language,omitempty"`
+	Alternates   []Alternate   `json:"alternates,omitempty"`
+	Translations []Translation `json:"translations,omitempty"`
+	// Encoding is the character encoding the page was served in; content
+	// is always transcoded to UTF-8
+	Encoding string `json:"encoding,omitempty"`
+	// ContentType is the media type the page was served as, e.g.
+	// application/pdf for a document, and SizeBytes the size of the body
+	// as served
+	ContentType string `json:"content_type,omitempty"`
+	SizeBytes   int    `json:"size_bytes,omitempty"`
+	// Soft404 marks error pages served with a success status;
+	// Soft404Reason says which heuristic caught the page
+	Soft404       bool   `json:"soft_404,omitempty"`
+	Soft404Reason string `json:"soft_404_reason,omitempty"`
+	// NeedsRender marks near-empty pages that look rendered by scripts, so
+	// a static fetch misses their content; RenderHint names the framework
+	// or marker that gave them away. Rendered marks such pages whose content
+	// was read from headless Chrome instead.
+	NeedsRender bool   `json:"needs_render,omitempty"`
+	RenderHint  string `json:"render_hint,omitempty"`
+	Rendered    bool   `json:"rendered,omitempty"`
+	// QualityScore rates how much real content the page carries, from 0
+	// (empty or boilerplate) to 1
+	QualityScore float64 `json:"quality_score,omitempty"`
+	// RelevanceScore is how relevant the link to the page looked to the
+	// query when a focused crawl queued it, from 0 to 1
+	RelevanceScore float64 `json:"relevance_score,omitempty"`
+	// HTMLSHA256 is the SHA-256 digest of the archived HTML, as stored in
+	// the archive entry; HTMLTimestamp is a trusted timestamp of it, when
+	// the job asked for one
+	HTMLSHA256    string            `json:"html_sha256,omitempty"`
+	HTMLTimestamp *TrustedTimestamp `json:"html_timestamp,omitempty"`
+	// Provenance records how the result was obtained
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// Categories are the operator domain categories of the page's host
+	Categories []string `json:"categories,omitempty"`
+	// Products are the product offers found on the page, when the job
+	// extracts them
+	Products []Product `json:"products,omitempty"`
+	// Organization is what a contact, about or imprint page says about
+	// the site's owner, when the job extracts organizations
+	Organization *Organization `json:"organization,omitempty"`
+	// MetaDescription and CanonicalURL are read from the page's head
+	MetaDescription string `json:"meta_description,omitempty"`
+	CanonicalURL    string `json:"canonical_url,omitempty"`
+	// OpenGraph and TwitterCard hold the page's og: and twitter: meta
+	// properties, keyed without the prefix
+	OpenGraph   map[string]string `json:"open_graph,omitempty"`
+	TwitterCard map[string]string `json:"twitter_card,omitempty"`
+	// Headings are the page's h1-h3 headings in document order
+	Headings []Heading `json:"headings,omitempty"`
+	// PublishedAt is the earliest publication date the page states
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+}
+
+// TrustedTimestamp is an RFC 3161 timestamp token proving a digest existed
+// at GenTime
+type TrustedTimestamp struct {
+	// Authority is the URL of the timestamping authority that issued it
+	Authority string    `json:"authority"`
+	GenTime   time.Time `json:"gen_time"`
+	// Token is the DER-encoded token; verifying its signature needs the
+	// authority's certificate
+	Token []byte `json:"token"`
+}
+
+// Provenance describes how a result was obtained, so products built on it
+// can cite the collection method
+type Provenance struct {
+	CrawlerVersion string    `json:"crawler_version"`
+	WorkerID       string    `json:"worker_id"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	Proxy          string    `json:"proxy,omitempty"`
+	Region         string    `json:"region,omitempty"`
+	RenderMode     string    `json:"render_mode"`
+	FetchedAt      time.Time `json:"fetched_at"`
+	// FetchDurationMs is the round trip of the final request, measured on
+	// the monotonic clock and excluding rate limiting delays
+	FetchDurationMs int64 `json:"fetch_duration_ms"`
+	// PolicyProfile is the compliance profile the job ran under
+	PolicyProfile string `json:"policy_profile,omitempty"`
+}
+
+// DomainCoverage is the crawl coverage of one domain: the URLs requested
+// and the URLs discovered but skipped, counted per reason (budget, depth,
+// robots, filter, duplicate, variant, language, quota, stopped,
+// rate_limited) with a sample of each
+type DomainCoverage struct {
+	Visited int                 `json:"visited"`
+	Skipped map[string]int      `json:"skipped"`
+	Samples map[string][]string `json:"samples,omitempty"`
+}
+
+// RenderDiff compares the content extracted from a page fetched
+// statically with the content of its rendered version
+type RenderDiff struct {
+	StaticWords   int `json:"static_words"`
+	RenderedWords int `json:"rendered_words"`
+	StaticLinks   int `json:"static_links"`
+	RenderedLinks int `json:"rendered_links"`
+	// Gain is the share of the rendered page's words missing from the
+	// static fetch (0-1)
+	Gain float64 `json:"gain"`
+	// NeedsRender is set when rendering revealed substantially more
+	// content, so the page's domain is worth crawling with render_js
+	NeedsRender bool `json:"needs_render"`
+}
+
+// PageChange is how a page fetched by a monitoring crawl differs from when
+// the monitor last saw it. Status is new for pages it had not seen. The
+// score and its components rate the change as page_monitor jobs do, and
+// Added and Removed are the lines of content that differ.
+type PageChange struct {
+	Status            string     `json:"status"`
+	PreviousHash      string     `json:"previous_hash,omitempty"`
+	PreviousCrawledAt *time.Time `json:"previous_crawled_at,omitempty"`
+	// PreviousTitle is set when the title changed
+	PreviousTitle string   `json:"previous_title,omitempty"`
+	Score         float64  `json:"score"`
+	TextChange    float64  `json:"text_change"`
+	NewEntities   []string `json:"new_entities,omitempty"`
+	NewDomains    []string `json:"new_domains,omitempty"`
+	Added         []string `json:"added,omitempty"`
+	Removed       []string `json:"removed,omitempty"`
+}
+
+// NetworkCapture is a JSON response a rendered page fetched by XHR or fetch
+type NetworkCapture struct {
+	URL         string `json:"url"`
+	Method      string `json:"method"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// DomainTiming is the response time summary of one host over a crawl
+type DomainTiming struct {
+	Requests int `json:"requests"`
+	// TimedOut counts requests abandoned for exceeding the host's timeout
+	TimedOut int   `json:"timed_out"`
+	P95MS    int64 `json:"p95_ms"`
+	// TimeoutMS is the adaptive timeout the host's requests got last
+	TimeoutMS int64 `json:"timeout_ms"`
+}
+
+// DomainStats summarises a crawl's requests to one host. Requests counts
+// those answered or failed for good, retried attempts aside; the average
+// response time is of those answered.
+type DomainStats struct {
+	Requests      int                `json:"requests"`
+	Pages         int                `json:"pages"`
+	Errors        int                `json:"errors"`
+	Bytes         int64              `json:"bytes"`
+	AvgResponseMS int64              `json:"avg_response_ms"`
+	StatusCodes   map[string]int     `json:"status_codes,omitempty"`
+	ErrorCodes    map[string]int     `json:"error_codes,omitempty"`
+	ContentTypes  []ContentTypeCount `json:"content_types,omitempty"`
+}
+
+// ContentTypeCount counts the responses of one media type
+type ContentTypeCount struct {
+	ContentType string `json:"content_type"`
+	Responses   int    `json:"responses"`
+}
+
+// ParallelismRamp is how many requests a crawl may have in flight, ramped
+// up while its targets answer without errors and down when they fail
+type ParallelismRamp struct {
+	Current int `json:"current"`
+	Max     int `json:"max"`
+	// State is ramping_up, steady or cooling_down
+	State   string `json:"state"`
+	Changes int    `json:"changes"`
+	// ErrorRate is the share of failed requests in the last window
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// Alternate is a version of a page in another language
+type Alternate struct {
+	Language string `json:"language"`
+	URL      string `json:"url"`
+}
+
+// Translation is the content of a crawled language alternate of a page
+type Translation struct {
+	Language        string `json:"language"`
+	URL             string `json:"url"`
+	Title           string `json:"title"`
+	Content         string `json:"content"`
+	ContentMarkdown string `json:"content_markdown,omitempty"`
+}
+
+// Product is a product offered on a page. Source says where it was read
+// from: schema (JSON-LD), microdata, meta (Open Graph) or selector (a
+// storefront price element, least reliable).
+type Product struct {
+	Name         string  `json:"name,omitempty"`
+	Brand        string  `json:"brand,omitempty"`
+	SKU          string  `json:"sku,omitempty"`
+	GTIN         string  `json:"gtin,omitempty"`
+	Price        float64 `json:"price,omitempty"`
+	Currency     string  `json:"currency,omitempty"`
+	Availability string  `json:"availability,omitempty"`
+	URL          string  `json:"url,omitempty"`
+	Image        string  `json:"image,omitempty"`
+	Source       string  `json:"source"`
+	Confidence   float64 `json:"confidence,omitempty"`
+}
+
+// Organization is what a site's contact, about and imprint pages say about
+// the organisation behind it. On a job it gathers every such page of a
+// registrable domain; Sources lists them.
+type Organization struct {
+	Domain              string               `json:"domain,omitempty"`
+	Name                string               `json:"name,omitempty"`
+	LegalForm           string               `json:"legal_form,omitempty"`
+	Addresses           []string             `json:"addresses,omitempty"`
+	RegistrationNumbers []RegistrationNumber `json:"registration_numbers,omitempty"`
+	VATIDs              []string             `json:"vat_ids,omitempty"`
+	People              []OrganizationPerson `json:"people,omitempty"`
+	Emails              []string             `json:"emails,omitempty"`
+	Phones              []string             `json:"phones,omitempty"`
+	Sources             []string             `json:"sources,omitempty"`
+	Confidence          float64              `json:"confidence,omitempty"`
+}
+
+// RegistrationNumber is a company register entry, e.g. an HRB number with
+// its register court or a UK company number
+type RegistrationNumber struct {
+	Type      string `json:"type"`
+	Number    string `json:"number"`
+	Authority string `json:"authority,omitempty"`
+}
+
+// OrganizationPerson is a named officer of an organisation and their role
+type OrganizationPerson struct {
+	Name string `json:"name"`
+	Role string `json:"role,omitempty"`
+}
+
+// Table is a data table extracted from a page. Every row has one value
+// per column; Headers, when known, name the columns.
+type Table struct {
+	Caption      string     `json:"caption,omitempty"`
+	ID           string     `json:"id,omitempty"`
+	Headers      []string   `json:"headers,omitempty"`
+	HeaderSource string     `json:"header_source,omitempty"` // thead, th, inferred
+	Rows         [][]string `json:"rows"`
+}
+
+// DatedEvent is a date found on a page, such as its publication time
+type DatedEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"` // published, modified, exif
+	Source string    `json:"source"`
+	Image  string    `json:"image,omitempty"` // for exif events
+}
+
+// ContentGeo holds the locations a page refers to
+type ContentGeo struct {
+	Points []GeoPoint `json:"points,omitempty"`
+	Places []string   `json:"places,omitempty"`
+}
+
+// GeoPoint is a coordinate found on a page
+type GeoPoint struct {
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Source string  `json:"source"`          // text, meta, schema, exif
+	Image  string  `json:"image,omitempty"` // for exif points
+}
+
+// Add records a coordinate given as strings, ignoring unparsable,
+// out-of-range and repeated values
+func (g *ContentGeo) Add(lat, lon, source string) {
+	la, err1 := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	lo, err2 := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	g.AddPoint(GeoPoint{Lat: la, Lon: lo, Source: source})
+}
+
+// AddPoint records a coordinate unless it is out of range or repeated
+func (g *ContentGeo) AddPoint(p GeoPoint) {
+	if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 || (p.Lat == 0 && p.Lon == 0) {
+		return
+	}
+	for _, existing := range g.Points {
+		if existing.Lat == p.Lat && existing.Lon == p.Lon {
+			return
+		}
+	}
+	g.Points = append(g.Points, p)
+}
+
+// AddPlace records a place name once
+func (g *ContentGeo) AddPlace(name string) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return
+	}
+	for _, existing := range g.Places {
+		if strings.EqualFold(existing, name) {
+			return
+		}
+	}
+	g.Places = append(g.Places, name)
+}
+
+// GeoInfo locates the IP a host resolved to
+type GeoInfo struct {
+	IP           string `json:"ip"`
+	Country      string `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	CountryName  string `json:"country_name,omitempty"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// Heading is a heading of a page; Level is 1-3 for h1-h3
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// MediaAsset is an image referenced by a page
+type MediaAsset struct {
+	URL     string       `json:"url"`
+	Alt     string       `json:"alt,omitempty"`
+	Matches []ImageMatch `json:"matches,omitempty"`
+}
+
+// ImageMatch is another page where a media asset was found by reverse
+// image search
+type ImageMatch struct {
+	URL      string  `json:"url"`
+	ImageURL string  `json:"image_url,omitempty"`
+	Domain   string  `json:"domain,omitempty"`
+	Score    float64 `json:"score,omitempty"`
+	Provider string  `json:"provider"`
+}
+
+// EmailEntity is an email address found on a page with the breaches it
+// appeared in
+type EmailEntity struct {
+	Address  string          `json:"address"`
+	Breaches []BreachSummary `json:"breaches,omitempty"`
+	// Source is link for mailto: links, text otherwise
+	Source string `json:"source,omitempty"`
+	// Deliverability is deliverable, undeliverable or unknown by the MX
+	// records of the address's domain, when the job verifies emails
+	Deliverability string  `json:"deliverability,omitempty"`
+	Confidence     float64 `json:"confidence,omitempty"`
+}
+
+// Where an email address or phone number was found on a page
+const (
+	EntitySourceLink = "link" // mailto: or tel: link
+	EntitySourceText = "text"
+)
+
+// PhoneEntity is a phone number found on a page, in E.164 with the
+// country it belongs to and its line type (mobile, landline, voip,
+// toll_free, ...)
+type PhoneEntity struct {
+	Number     string  `json:"number"`
+	Country    string  `json:"country,omitempty"`
+	Type       string  `json:"type,omitempty"`
+	Source     string  `json:"source,omitempty"` // link or text
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// BreachSummary describes a breach from Have I Been Pwned
+type BreachSummary struct {
+	Name        string   `json:"name"`
+	Title       string   `json:"title,omitempty"`
+	Domain      string   `json:"domain,omitempty"`
+	BreachDate  string   `json:"breach_date,omitempty"`
+	DataClasses []string `json:"data_classes,omitempty"`
+}
+
+// HostIntel is third-party data about the host a page was served from
+type HostIntel struct {
+	Host      string        `json:"host"`
+	IP        string        `json:"ip"`
+	Provider  string        `json:"provider"` // shodan, censys
+	Ports     []int         `json:"ports,omitempty"`
+	Services  []HostService `json:"services,omitempty"`
+	Tags      []string      `json:"tags,omitempty"`
+	Org       string        `json:"org,omitempty"`
+	Geo       *GeoInfo      `json:"geo,omitempty"`
+	FetchedAt time.Time     `json:"fetched_at"`
+}
+
+// HostService is an open service reported for a host
+type HostService struct {
+	Port      int    `json:"port"`
+	Transport string `json:"transport,omitempty"`
+	Product   string `json:"product,omitempty"`
+	Banner    string `json:"banner,omitempty"`
+}
+
+// Link is an outgoing link found on a crawled page
+type Link struct {
+	URL      string `json:"url"`
+	Text     string `json:"text,omitempty"`
+	Rel      string `json:"rel,omitempty"`
+	External bool   `json:"external"`
 }
 
 // JobStatus represents the current status of a job
@@ -50,6 +1280,15 @@ type JobStatus struct {
 
 // IntelServiceRequest represents data sent to the intel service
 type IntelServiceRequest struct {
-	JobID   string        `json:"job_id"`
-	Results []CrawlResult `json:"results"`
+	JobID         string        `json:"job_id"`
+	Tenant        string        `json:"tenant,omitempty"`
+	Results       []CrawlResult `json:"results"`
+	Partial       bool          `json:"partial,omitempty"`
+	FailureReason string        `json:"failure_reason,omitempty"`
+	// BatchID identifies the batch, so the service can recognise a batch
+	// retried after it had already been processed; Batch counts from 1 of
+	// the Batches a delivery was split into
+	BatchID string `json:"batch_id,omitempty"`
+	Batch   int    `json:"batch,omitempty"`
+	Batches int    `json:"batches,omitempty"`
 }
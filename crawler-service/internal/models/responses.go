@@ -0,0 +1,259 @@
+package models
+
+import "time"
+
+// API versions. v1 error bodies carry their details next to the message;
+// v2 error bodies are ErrorResponses. Successful responses are the same in
+// both.
+const (
+	APIVersion1 = "v1"
+	APIVersion2 = "v2"
+)
+
+// ErrorResponse is the body of a failed v2 API request
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Code is a machine-readable error code from the errcode package
+	Code    string                 `json:"code"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// JobResponse is returned when a job is created
+type JobResponse struct {
+	JobID   string `json:"job_id"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// ContinueOf and Seeds are set for continuations: the job continued
+	// and how many unvisited URLs it starts from
+	ContinueOf string `json:"continue_of,omitempty"`
+	// WarmStartOf is the prior crawl a warm start took its seeds from;
+	// Seeds then counts those seeds
+	WarmStartOf string `json:"warm_start_of,omitempty"`
+	Seeds       int    `json:"seeds,omitempty"`
+	// Deduplicated is set when an identical job was already running and is
+	// returned in place of a new one
+	Deduplicated bool      `json:"deduplicated,omitempty"`
+	Job          *CrawlJob `json:"job"`
+}
+
+// HealthResponse reports whether the service is up
+type HealthResponse struct {
+	Status      string    `json:"status"`
+	Service     string    `json:"service"`
+	Maintenance bool      `json:"maintenance"`
+	ReadReplica bool      `json:"read_replica,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// CrawlerInfo is the public description of the crawler for the sites it
+// visits
+type CrawlerInfo struct {
+	Name        string `json:"name"`
+	UserAgent   string `json:"user_agent"`
+	RobotsToken string `json:"robots_token"`
+	Operator    string `json:"operator,omitempty"`
+	Contact     string `json:"contact,omitempty"`
+	Purpose     string `json:"purpose,omitempty"`
+	InfoURL     string `json:"info_url,omitempty"`
+	OptOut      string `json:"opt_out"`
+}
+
+// MessageResponse acknowledges an action on a job
+type MessageResponse struct {
+	JobID   string `json:"job_id,omitempty"`
+	Message string `json:"message"`
+}
+
+// DeleteResponse is returned when a job is deleted. A soft-deleted job
+// keeps its results and is hidden from listings; a purged one is gone, and
+// Removed says what was removed with it.
+type DeleteResponse struct {
+	JobID     string       `json:"job_id"`
+	Message   string       `json:"message"`
+	Purged    bool         `json:"purged"`
+	DeletedAt *time.Time   `json:"deleted_at,omitempty"`
+	Removed   *PurgeReport `json:"removed,omitempty"`
+}
+
+// PurgeReport summarises the artifacts removed for a purged job, or with
+// its results
+type PurgeReport struct {
+	Results        int   `json:"results"`
+	ArchiveDeleted bool  `json:"archive_deleted"`
+	OffloadDeleted bool  `json:"offload_deleted"`
+	IndexEntries   int   `json:"index_entries"`
+	BytesReleased  int64 `json:"bytes_released"`
+}
+
+// ResultsDeletedResponse is returned when a job's results are deleted
+type ResultsDeletedResponse struct {
+	JobID   string      `json:"job_id"`
+	Message string      `json:"message"`
+	Removed PurgeReport `json:"removed"`
+}
+
+// DeletedResponse acknowledges the removal of something other than a job
+type DeletedResponse struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+	Message string `json:"message,omitempty"`
+}
+
+// TenantKeysResponse lists the versions of a tenant's data keys, without
+// their key material
+type TenantKeysResponse struct {
+	Message string           `json:"message,omitempty"`
+	Tenant  string           `json:"tenant"`
+	Current int              `json:"current"`
+	Keys    []DataKeyVersion `json:"keys"`
+	// MasterKey is the current master key, which new data keys are
+	// wrapped with
+	MasterKey string `json:"master_key"`
+}
+
+// DataKeyVersion is a version of a tenant's data key
+type DataKeyVersion struct {
+	Version int `json:"version"`
+	// MasterKey is the master key it is wrapped with
+	MasterKey string    `json:"master_key"`
+	CreatedAt time.Time `json:"created_at"`
+	WrappedAt time.Time `json:"wrapped_at"`
+}
+
+// JobListResponse is a page of jobs
+type JobListResponse struct {
+	// Total counts the jobs matching the listing on all pages
+	Total int         `json:"total"`
+	Jobs  []*CrawlJob `json:"jobs"`
+	// NextCursor fetches the following page; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Page is the number of the page, when jobs are listed by page number
+	Page int `json:"page,omitempty"`
+}
+
+// StatusResponse is the progress of a job
+type StatusResponse struct {
+	JobID         string                  `json:"job_id"`
+	ExternalID    string                  `json:"external_id"`
+	CaseID        string                  `json:"case_id"`
+	Status        string                  `json:"status"`
+	QueuePosition int                     `json:"queue_position,omitempty"`
+	Priority      string                  `json:"priority,omitempty"`
+	Preemptions   int                     `json:"preemptions,omitempty"`
+	Region        string                  `json:"region,omitempty"`
+	PagesCrawled  int                     `json:"pages_crawled"`
+	URLsFound     int                     `json:"urls_found"`
+	Progress      float64                 `json:"progress"`
+	StartedAt     time.Time               `json:"started_at"`
+	CompletedAt   time.Time               `json:"completed_at"`
+	Error         string                  `json:"error"`
+	ErrorCode     string                  `json:"error_code"`
+	ErrorCounts   map[string]int          `json:"error_counts"`
+	Partial       bool                    `json:"partial"`
+	StorageBytes  int64                   `json:"storage_bytes"`
+	QuotaStatus   string                  `json:"quota_status"`
+	Countries     map[string]int          `json:"countries"`
+	LowQuality    int                     `json:"low_quality"`
+	Soft404       int                     `json:"soft_404"`
+	NeedsRender   int                     `json:"needs_render"`
+	Rendered      int                     `json:"rendered"`
+	DuplicateURLs int                     `json:"duplicate_urls"`
+	Duplicates    int                     `json:"duplicates"`
+	Unchanged     int                     `json:"unchanged,omitempty"`
+	Filtered      map[string]int          `json:"filtered,omitempty"`
+	RobotsBlocked int                     `json:"robots_blocked"`
+	Cost          JobCost                 `json:"cost"`
+	ResponseTimes map[string]DomainTiming `json:"response_times"`
+	Parallelism   *ParallelismRamp        `json:"parallelism,omitempty"`
+	Retries       int                     `json:"retries"`
+	FailedURLs    []FailedURL             `json:"failed_urls"`
+	ParkedDomains map[string]string       `json:"parked_domains"`
+	LinkedDomains []DomainLinks           `json:"linked_domains"`
+	Compliance    *ComplianceProfile      `json:"compliance"`
+	Outputs       []OutputDelivery        `json:"outputs,omitempty"`
+	Callback      *CallbackDelivery       `json:"callback,omitempty"`
+	DeletedAt     *time.Time              `json:"deleted_at"`
+	// ExpiresAt is when the finished job is purged, if it is kept for a
+	// limited time
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	ResultsDeletedAt *time.Time `json:"results_deleted_at,omitempty"`
+}
+
+// DomainLinks counts the links from a job's pages to one external domain
+type DomainLinks struct {
+	Domain string `json:"domain"`
+	LinkedDomain
+}
+
+// ResultsResponse is one page of a job's results
+type ResultsResponse struct {
+	JobID     string        `json:"job_id"`
+	Offloaded bool          `json:"offloaded"`
+	Total     int           `json:"total"`
+	Offset    int           `json:"offset"`
+	Results   []CrawlResult `json:"results"`
+	// LastSeq is the sequence number of the last result returned, or the
+	// since_seq asked for when there is none; asking for the results since
+	// it returns only newer ones
+	LastSeq int64 `json:"last_seq"`
+}
+
+// OffloadedResultsResponse points to a job's results in object storage
+type OffloadedResultsResponse struct {
+	JobID       string    `json:"job_id"`
+	Offloaded   bool      `json:"offloaded"`
+	DownloadURL string    `json:"download_url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// SitemapNode is a domain, or a path segment below one, in the sitemap of
+// a job's results
+type SitemapNode struct {
+	Name string `json:"name"`
+	// Path is the URL path the node stands for; "/" for domains
+	Path string `json:"path"`
+	// Pages counts the results at or below the node
+	Pages int `json:"pages"`
+	// URL and Title are set when a result is at the node itself
+	URL      string         `json:"url,omitempty"`
+	Title    string         `json:"title,omitempty"`
+	Children []*SitemapNode `json:"children,omitempty"`
+}
+
+// SitemapResponse is the sitemap of a job's results
+type SitemapResponse struct {
+	JobID   string         `json:"job_id"`
+	Total   int            `json:"total"`
+	Domains []*SitemapNode `json:"domains"`
+}
+
+// SimilarJob is a past job resembling a proposed crawl, with its outcome
+type SimilarJob struct {
+	JobID  string `json:"job_id"`
+	Query  string `json:"query"`
+	Status string `json:"status"`
+	// Similarity is the overlap of the two crawls' query terms and seed
+	// URLs, from 0 to 1
+	Similarity float64 `json:"similarity"`
+	// SharedTerms are the query terms and seed hosts and URLs both have
+	SharedTerms []string `json:"shared_terms,omitempty"`
+	// SameRequest is set when the job was started with identical
+	// parameters
+	SameRequest  bool      `json:"same_request,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	CompletedAt  time.Time `json:"completed_at,omitempty"`
+	AgeHours     float64   `json:"age_hours"`
+	PagesCrawled int       `json:"pages_crawled"`
+	URLsFound    int       `json:"urls_found"`
+	Partial      bool      `json:"partial,omitempty"`
+	ErrorCode    string    `json:"error_code,omitempty"`
+}
+
+// SimilarJobsResponse reports the past jobs resembling a proposed crawl,
+// most similar first
+type SimilarJobsResponse struct {
+	Query string       `json:"query"`
+	Days  int          `json:"days"`
+	Total int          `json:"total"`
+	Jobs  []SimilarJob `json:"jobs"`
+}
@@ -0,0 +1,377 @@
+// Package openapi describes an HTTP API as an OpenAPI 3 document. Request
+// and response schemas are derived from the Go types the API encodes as
+// JSON, following their json tags, so the document keeps up with the
+// models it describes.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Version is the OpenAPI version of the documents built
+const Version = "3.0.3"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                    `json:"openapi"`
+	Info       Info                      `json:"info"`
+	Servers    []Server                  `json:"servers,omitempty"`
+	Paths      map[string]map[string]*Op `json:"paths"`
+	Components Components                `json:"components"`
+	Security   []map[string][]string     `json:"security,omitempty"`
+
+	// schemas names the component of each struct type described, and
+	// names the type of each component
+	schemas map[reflect.Type]string
+	names   map[string]reflect.Type
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is a base URL the API is served at
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Components holds the schemas operations refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way requests authenticate
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Op is an operation on a path
+type Op struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation takes
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is a response an operation gives
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body in one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema describes a JSON value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Query is a query parameter of an endpoint
+type Query struct {
+	Name string
+	// Type is string (the default), integer, number or boolean
+	Type        string
+	Description string
+	Enum        []string
+}
+
+// Endpoint is an API operation to describe
+type Endpoint struct {
+	Method string
+	// Path uses the router's syntax, e.g. /jobs/:id/results
+	Path string
+	// ID names the operation; Summary defaults to it, split into words
+	ID      string
+	Summary string
+	Tag     string
+	Query   []Query
+	// Request and Response are values of the types of the JSON bodies,
+	// nil when the operation takes or describes none
+	Request  interface{}
+	Response interface{}
+	// Status is the status of a successful response, 200 by default
+	Status int
+	// ContentType is the type of a successful response that is not JSON
+	ContentType string
+}
+
+// New returns an empty document
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      make(map[string]map[string]*Op),
+		Components: Components{Schemas: make(map[string]*Schema)},
+		schemas:    make(map[reflect.Type]string),
+		names:      make(map[string]reflect.Type),
+	}
+}
+
+// BearerAuth has every operation accept an API key as a bearer token or in
+// the given header
+func (d *Document) BearerAuth(header string) {
+	d.Components.SecuritySchemes = map[string]*SecurityScheme{
+		"bearer": {Type: "http", Scheme: "bearer"},
+		"header": {Type: "apiKey", In: "header", Name: header},
+	}
+	d.Security = []map[string][]string{{"bearer": {}}, {"header": {}}}
+}
+
+// Add describes an endpoint. Failed requests answer with errorBody, a value
+// of the error type, when given.
+func (d *Document) Add(e Endpoint, errorBody interface{}) {
+	path, params := pathTemplate(e.Path)
+	op := &Op{
+		OperationID: e.ID,
+		Summary:     e.Summary,
+		Responses:   make(map[string]*Response),
+	}
+	if op.Summary == "" {
+		op.Summary = words(e.ID)
+	}
+	if e.Tag != "" {
+		op.Tags = []string{e.Tag}
+	}
+	for _, name := range params {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	for _, q := range e.Query {
+		typ := q.Type
+		if typ == "" {
+			typ = "string"
+		}
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:        q.Name,
+			In:          "query",
+			Description: q.Description,
+			Schema:      &Schema{Type: typ, Enum: q.Enum},
+		})
+	}
+	if e.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: d.Schema(reflect.TypeOf(e.Request))}},
+		}
+	}
+
+	status := e.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &Response{Description: http.StatusText(status)}
+	switch {
+	case e.ContentType != "":
+		success.Content = map[string]*MediaType{e.ContentType: {Schema: &Schema{Type: "string", Format: "binary"}}}
+	case e.Response != nil:
+		success.Content = map[string]*MediaType{"application/json": {Schema: d.Schema(reflect.TypeOf(e.Response))}}
+	}
+	op.Responses[strconv.Itoa(status)] = success
+	failed := &Response{Description: "Error"}
+	if errorBody != nil {
+		failed.Content = map[string]*MediaType{"application/json": {Schema: d.Schema(reflect.TypeOf(errorBody))}}
+	}
+	op.Responses["default"] = failed
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = make(map[string]*Op)
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(e.Method)] = op
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schema returns the schema of a Go type. Named structs become components
+// and are referred to, so recursive types are described once.
+func (d *Document) Schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := d.Schema(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		if t == reflect.TypeOf(time.Duration(0)) {
+			return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+		}
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.Schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + d.component(t)}
+	}
+	// Interfaces hold any value
+	return &Schema{}
+}
+
+// component registers a named struct type as a component schema and
+// returns its name
+func (d *Document) component(t reflect.Type) string {
+	if name, ok := d.schemas[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := d.names[name]; taken {
+		// A type of the same name from another package
+		pkg := t.PkgPath()
+		pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	d.schemas[t] = name
+	d.names[name] = t
+	d.Components.Schemas[name] = d.object(t)
+	return name
+}
+
+// object describes the JSON object a struct encodes as
+func (d *Document) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.fields(t, s)
+	sort.Strings(s.Required)
+	return s
+}
+
+// fields adds the properties of a struct's fields to s, flattening
+// embedded structs as encoding/json does
+func (d *Document) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				d.fields(ft, s)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := d.Schema(f.Type)
+		if strings.Contains(opts, "string") && prop.Ref == "" {
+			prop = &Schema{Type: "string"}
+		}
+		s.Properties[name] = prop
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// pathTemplate turns a router path (/jobs/:id) into an OpenAPI path
+// template (/jobs/{id}) and returns its parameters
+func pathTemplate(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") {
+			name := strings.TrimSuffix(seg[1:], "?")
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// words splits an identifier such as GetJobReport into "Get job report"
+func words(id string) string {
+	var b strings.Builder
+	runes := []rune(id)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteByte(' ')
+			if i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				r = unicode.ToLower(r)
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
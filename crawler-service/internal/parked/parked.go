@@ -0,0 +1,61 @@
+package parked
+
+import (
+	"regexp"
+	"strings"
+)
+
+// signature identifies the lander of one parking provider or registrar
+type signature struct {
+	provider string
+	pattern  *regexp.Regexp
+}
+
+// markup signatures match provider scripts, assets and links in the HTML
+var markup = []signature{
+	{"sedo", regexp.MustCompile(`(?i)sedoparking\.com|sedo\.com/search/details|sedo\.com/checkdomainoffer`)},
+	{"godaddy", regexp.MustCompile(`(?i)img1\.wsimg\.com/parking-lander|godaddy\.com/domain-?search|window\.park\s*=|parking-lander`)},
+	{"parkingcrew", regexp.MustCompile(`(?i)parkingcrew\.net`)},
+	{"bodis", regexp.MustCompile(`(?i)bodis\.com|bodiscdn`)},
+	{"afternic", regexp.MustCompile(`(?i)afternic\.com/(forsale|domain)`)},
+	{"dan", regexp.MustCompile(`(?i)dan\.com/(buy-domain|lander)|dan-lander`)},
+	{"hugedomains", regexp.MustCompile(`(?i)hugedomains\.com/domain_profile`)},
+	{"namecheap", regexp.MustCompile(`(?i)namecheap\.com/domains/registration.*parking|parkingpage\.namecheap\.com`)},
+	{"above", regexp.MustCompile(`(?i)above\.com/marketplace|trafficz\.com`)},
+	{"uniregistry", regexp.MustCompile(`(?i)uniregistry\.com/(buy|market)`)},
+	{"skenzo", regexp.MustCompile(`(?i)skenzo\.com`)},
+}
+
+// text signatures match registrar and marketplace lander wording
+var text = []signature{
+	{"for_sale", regexp.MustCompile(`(?i)\b(this|the) domain( name)?( \S+)? (is|may be) for sale\b`)},
+	{"for_sale", regexp.MustCompile(`(?i)\bbuy this domain\b|\bmake an offer on this domain\b|\binquire about this domain\b`)},
+	{"registrar", regexp.MustCompile(`(?i)\bparked free,? courtesy of\b|\bthis domain (has been|is) (registered|parked) (at|with|by)\b`)},
+	{"registrar", regexp.MustCompile(`(?i)\bthis (web ?page|domain) is parked\b|\bdomain parking\b`)},
+	{"registrar", regexp.MustCompile(`(?i)\bfuture home of something quite cool\b|\bcoming soon[.!]? this domain was recently registered\b`)},
+}
+
+// maxWords is the longest page that can be flagged. Parking landers are
+// short; long pages that merely link to or mention domain sales are not.
+const maxWords = 400
+
+// Detect reports whether a page is a domain-parking or for-sale lander and
+// names the parking provider, or the kind of lander when only its wording
+// gives it away
+func Detect(html []byte, visibleText string) (provider string, ok bool) {
+	if len(strings.Fields(visibleText)) > maxWords {
+		return "", false
+	}
+
+	for _, sig := range markup {
+		if sig.pattern.Match(html) {
+			return sig.provider, true
+		}
+	}
+	for _, sig := range text {
+		if sig.pattern.MatchString(visibleText) {
+			return sig.provider, true
+		}
+	}
+	return "", false
+}
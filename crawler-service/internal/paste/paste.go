@@ -0,0 +1,155 @@
+package paste
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Paste is a single paste published on a paste site
+type Paste struct {
+	Site     string    `json:"site"`
+	Key      string    `json:"key"`
+	URL      string    `json:"url"`
+	Title    string    `json:"title"`
+	Author   string    `json:"author,omitempty"`
+	Syntax   string    `json:"syntax,omitempty"`
+	PostedAt time.Time `json:"posted_at"`
+	Content  string    `json:"content"`
+}
+
+// Source lists recently published pastes of one site
+type Source interface {
+	Name() string
+	// Recent returns pastes published since the previous call
+	Recent(ctx context.Context) ([]Paste, error)
+}
+
+// Monitor polls paste sources and hands each new paste to a callback
+type Monitor struct {
+	sources  []Source
+	interval time.Duration
+}
+
+// NewMonitor creates a monitor over the given sources
+func NewMonitor(interval time.Duration, sources ...Source) *Monitor {
+	return &Monitor{sources: sources, interval: interval}
+}
+
+// NewMonitorFromEnv configures sources from the environment:
+// PASTEBIN_SCRAPING_ENABLED enables the Pastebin scraping API (which requires
+// a whitelisted IP), PASTE_FEEDS lists name=url RSS feeds of other paste
+// sites and PASTE_POLL_INTERVAL sets the poll interval (default 1m)
+func NewMonitorFromEnv() *Monitor {
+	var sources []Source
+	if os.Getenv("PASTEBIN_SCRAPING_ENABLED") == "true" {
+		sources = append(sources, NewPastebinSource(os.Getenv("PASTEBIN_SCRAPING_URL")))
+	}
+	for _, entry := range strings.Split(os.Getenv("PASTE_FEEDS"), ",") {
+		name, url, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if ok && name != "" && url != "" {
+			sources = append(sources, NewFeedSource(name, url))
+		}
+	}
+
+	interval := time.Minute
+	if d, err := time.ParseDuration(os.Getenv("PASTE_POLL_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+	return NewMonitor(interval, sources...)
+}
+
+// Sources returns the names of the configured sources
+func (m *Monitor) Sources() []string {
+	names := make([]string, len(m.sources))
+	for i, s := range m.sources {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// Run polls all sources until ctx is done
+func (m *Monitor) Run(ctx context.Context, handle func(Paste)) {
+	if len(m.sources) == 0 {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"sources":  m.Sources(),
+		"interval": m.interval.String(),
+	}).Info("Paste monitor started")
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.poll(ctx, handle)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) poll(ctx context.Context, handle func(Paste)) {
+	var wg sync.WaitGroup
+	for _, s := range m.sources {
+		wg.Add(1)
+		go func(s Source) {
+			defer wg.Done()
+
+			pastes, err := s.Recent(ctx)
+			if err != nil {
+				log.WithError(err).WithField("source", s.Name()).Warn("Failed to poll paste source")
+			}
+			for _, p := range pastes {
+				handle(p)
+			}
+		}(s)
+	}
+	wg.Wait()
+}
+
+// Match returns the keywords contained in content, ignoring case
+func Match(content string, keywords []string) []string {
+	lower := strings.ToLower(content)
+
+	var matched []string
+	for _, kw := range keywords {
+		if kw != "" && strings.Contains(lower, strings.ToLower(kw)) {
+			matched = append(matched, kw)
+		}
+	}
+	return matched
+}
+
+// seenSet remembers recently seen paste keys with bounded memory
+type seenSet struct {
+	keys  map[string]bool
+	order []string
+	limit int
+}
+
+func newSeenSet(limit int) *seenSet {
+	return &seenSet{keys: make(map[string]bool), limit: limit}
+}
+
+// add records key and reports whether it was new
+func (s *seenSet) add(key string) bool {
+	if s.keys[key] {
+		return false
+	}
+	s.keys[key] = true
+	s.order = append(s.order, key)
+	if len(s.order) > s.limit {
+		delete(s.keys, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package paste
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPasteBytes caps the size of a single fetched paste
+const maxPasteBytes = 1 << 20
+
+// PastebinSource polls the Pastebin scraping API
+type PastebinSource struct {
+	baseURL string
+	http    *http.Client
+	seen    *seenSet
+}
+
+// NewPastebinSource creates a source for the scraping API at baseURL
+// (default https://scrape.pastebin.com)
+func NewPastebinSource(baseURL string) *PastebinSource {
+	if baseURL == "" {
+		baseURL = "https://scrape.pastebin.com"
+	}
+	return &PastebinSource{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+		seen:    newSeenSet(10000),
+	}
+}
+
+// Name implements Source
+func (s *PastebinSource) Name() string {
+	return "pastebin"
+}
+
+// pastebinItem is an entry of the scraping API listing
+type pastebinItem struct {
+	Key       string `json:"key"`
+	FullURL   string `json:"full_url"`
+	ScrapeURL string `json:"scrape_url"`
+	Date      string `json:"date"`
+	Title     string `json:"title"`
+	Syntax    string `json:"syntax"`
+	User      string `json:"user"`
+}
+
+// Recent implements Source
+func (s *PastebinSource) Recent(ctx context.Context) ([]Paste, error) {
+	body, err := s.get(ctx, s.baseURL+"/api_scraping.php?limit=100")
+	if err != nil {
+		return nil, err
+	}
+
+	var items []pastebinItem
+	if err := json.Unmarshal(body, &items); err != nil {
+		// The API answers with a plain-text message when the IP is not whitelisted
+		return nil, fmt.Errorf("unexpected scraping API response: %.200s", body)
+	}
+
+	var pastes []Paste
+	for _, item := range items {
+		if !s.seen.add(item.Key) {
+			continue
+		}
+
+		content, err := s.get(ctx, s.baseURL+"/api_scrape_item.php?i="+item.Key)
+		if err != nil {
+			continue
+		}
+
+		p := Paste{
+			Site:    s.Name(),
+			Key:     item.Key,
+			URL:     item.FullURL,
+			Title:   item.Title,
+			Author:  item.User,
+			Syntax:  item.Syntax,
+			Content: string(content),
+		}
+		if sec, err := strconv.ParseInt(item.Date, 10, 64); err == nil {
+			p.PostedAt = time.Unix(sec, 0).UTC()
+		}
+		pastes = append(pastes, p)
+	}
+	return pastes, nil
+}
+
+func (s *PastebinSource) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pastebin returned %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxPasteBytes))
+}
+
+// FeedSource polls the RSS feed of a paste site, using each item's
+// description as the paste content
+type FeedSource struct {
+	name string
+	url  string
+	http *http.Client
+	seen *seenSet
+}
+
+// NewFeedSource creates a source for an RSS feed
+func NewFeedSource(name, url string) *FeedSource {
+	return &FeedSource{
+		name: name,
+		url:  url,
+		http: &http.Client{Timeout: 30 * time.Second},
+		seen: newSeenSet(10000),
+	}
+}
+
+// Name implements Source
+func (s *FeedSource) Name() string {
+	return s.name
+}
+
+type rssFeed struct {
+	Items []struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		GUID        string `xml:"guid"`
+		Author      string `xml:"author"`
+		Description string `xml:"description"`
+		PubDate     string `xml:"pubDate"`
+	} `xml:"channel>item"`
+}
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// Recent implements Source
+func (s *FeedSource) Recent(ctx context.Context) ([]Paste, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %d", resp.StatusCode)
+	}
+
+	var feed rssFeed
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 10*maxPasteBytes)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	var pastes []Paste
+	for _, item := range feed.Items {
+		key := item.GUID
+		if key == "" {
+			key = item.Link
+		}
+		if !s.seen.add(key) {
+			continue
+		}
+
+		p := Paste{
+			Site:    s.name,
+			Key:     key,
+			URL:     item.Link,
+			Title:   item.Title,
+			Author:  item.Author,
+			Content: html.UnescapeString(tagPattern.ReplaceAllString(item.Description, "")),
+		}
+		if t, err := time.Parse(time.RFC1123Z, item.PubDate); err == nil {
+			p.PostedAt = t.UTC()
+		}
+		pastes = append(pastes, p)
+	}
+	return pastes, nil
+}
@@ -0,0 +1,162 @@
+// Package phone finds the phone numbers on pages and normalises them to
+// E.164 with their country and line type (mobile, landline, VoIP, ...).
+// Numbers are parsed and validated with libphonenumber's metadata, through
+// github.com/nyaruka/phonenumbers; this package only finds the candidates
+// in a page and removes duplicates.
+package phone
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nyaruka/phonenumbers"
+)
+
+// Line types
+const (
+	TypeMobile           = "mobile"
+	TypeLandline         = "landline"
+	TypeLandlineOrMobile = "landline_or_mobile"
+	TypeVoIP             = "voip"
+	TypeTollFree         = "toll_free"
+	TypePremiumRate      = "premium_rate"
+	TypeSharedCost       = "shared_cost"
+	TypePersonal         = "personal"
+	TypePager            = "pager"
+	TypeUAN              = "uan"
+	TypeVoicemail        = "voicemail"
+	TypeUnknown          = "unknown"
+)
+
+// types maps libphonenumber's number types to line types
+var types = map[phonenumbers.PhoneNumberType]string{
+	phonenumbers.MOBILE:               TypeMobile,
+	phonenumbers.FIXED_LINE:           TypeLandline,
+	phonenumbers.FIXED_LINE_OR_MOBILE: TypeLandlineOrMobile,
+	phonenumbers.VOIP:                 TypeVoIP,
+	phonenumbers.TOLL_FREE:            TypeTollFree,
+	phonenumbers.PREMIUM_RATE:         TypePremiumRate,
+	phonenumbers.SHARED_COST:          TypeSharedCost,
+	phonenumbers.PERSONAL_NUMBER:      TypePersonal,
+	phonenumbers.PAGER:                TypePager,
+	phonenumbers.UAN:                  TypeUAN,
+	phonenumbers.VOICEMAIL:            TypeVoicemail,
+}
+
+var (
+	// candidatePattern finds digit runs in text that may be phone numbers
+	candidatePattern = regexp.MustCompile(`\+?\(?\d[\d ().\-/]{5,22}\d`)
+	// datePattern matches dates a candidate may really be
+	datePattern = regexp.MustCompile(`^\d{1,4}[./\-]\d{1,2}[./\-]\d{1,4}$`)
+)
+
+// Known reports whether region, an ISO 3166-1 alpha-2 code, has a
+// numbering plan
+func Known(region string) bool {
+	return phonenumbers.GetSupportedRegions()[strings.ToUpper(region)]
+}
+
+// RegionForURL returns the region national-format numbers on a page are
+// read in: the country of its country-code TLD when known, else fallback
+func RegionForURL(pageURL, fallback string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return strings.ToUpper(fallback)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	tld := strings.ToUpper(host[strings.LastIndex(host, ".")+1:])
+	if tld == "UK" {
+		tld = "GB"
+	}
+	if Known(tld) {
+		return tld
+	}
+	return strings.ToUpper(fallback)
+}
+
+// Parse normalises a phone number. Numbers in international format are
+// read by their calling code; others are read in defaultRegion. ok is
+// false for numbers that are not valid in the region they are read in.
+func Parse(raw, defaultRegion string) (number models.PhoneEntity, ok bool) {
+	raw = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(raw), "tel:"))
+	parsed, err := phonenumbers.Parse(raw, strings.ToUpper(defaultRegion))
+	if err != nil || !phonenumbers.IsValidNumber(parsed) {
+		return models.PhoneEntity{}, false
+	}
+	kind, ok := types[phonenumbers.GetNumberType(parsed)]
+	if !ok {
+		kind = TypeUnknown
+	}
+	return models.PhoneEntity{
+		Number:  phonenumbers.Format(parsed, phonenumbers.E164),
+		Country: phonenumbers.GetRegionCodeForNumber(parsed),
+		Type:    kind,
+	}, true
+}
+
+// Find returns up to limit distinct numbers a page gives, from its tel:
+// links and then its text, read in region when in national format
+func Find(doc *goquery.Selection, text, region string, limit int) []models.PhoneEntity {
+	var found []models.PhoneEntity
+	seen := make(map[string]bool)
+	add := func(raw, source string) bool {
+		if number, ok := Parse(raw, region); ok && !seen[number.Number] {
+			seen[number.Number] = true
+			number.Source = source
+			found = append(found, number)
+		}
+		return len(found) < limit
+	}
+
+	more := true
+	if doc != nil {
+		doc.Find(`a[href^="tel:"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			href, _ := s.Attr("href")
+			raw, err := url.PathUnescape(href)
+			if err != nil {
+				raw = href
+			}
+			more = add(raw, models.EntitySourceLink)
+			return more
+		})
+	}
+	if !more {
+		return found
+	}
+
+	for _, loc := range candidatePattern.FindAllStringIndex(text, -1) {
+		candidate := strings.TrimSpace(text[loc[0]:loc[1]])
+		// digits run on from a word, as in order or ID numbers
+		if loc[0] > 0 && endsInWord(text[:loc[0]]) {
+			continue
+		}
+		if datePattern.MatchString(candidate) {
+			continue
+		}
+		if !add(candidate, models.EntitySourceText) {
+			break
+		}
+	}
+	return found
+}
+
+// Normalize returns raw in E.164 when it parses in region, else raw as it
+// was written
+func Normalize(raw, region string) string {
+	if number, ok := Parse(raw, region); ok {
+		return number.Number
+	}
+	return raw
+}
+
+// endsInWord reports whether text ends in a letter or digit
+func endsInWord(text string) bool {
+	last, _ := utf8.DecodeLastRuneInString(text)
+	return unicode.IsLetter(last) || unicode.IsDigit(last)
+}
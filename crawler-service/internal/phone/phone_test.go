@@ -0,0 +1,96 @@
+package phone
+
+import (
+	"strings"
+	"testing"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw, region string
+		want        models.PhoneEntity
+		ok          bool
+	}{
+		{"+44 20 7946 0958", "", models.PhoneEntity{Number: "+442079460958", Country: "GB", Type: TypeLandline}, true},
+		{"020 7946 0958", "gb", models.PhoneEntity{Number: "+442079460958", Country: "GB", Type: TypeLandline}, true},
+		{"+44 (0)20 7946 0958", "US", models.PhoneEntity{Number: "+442079460958", Country: "GB", Type: TypeLandline}, true},
+		{"0044 20 7946 0958", "DE", models.PhoneEntity{Number: "+442079460958", Country: "GB", Type: TypeLandline}, true},
+		{"tel:+44-7400-123456", "", models.PhoneEntity{Number: "+447400123456", Country: "GB", Type: TypeMobile}, true},
+		{"+44 20 7946 0958 ext. 12", "", models.PhoneEntity{Number: "+442079460958", Country: "GB", Type: TypeLandline}, true},
+		{"0800 890 567", "GB", models.PhoneEntity{Number: "+44800890567", Country: "GB", Type: TypeTollFree}, true},
+		{"(650) 253-0000", "US", models.PhoneEntity{Number: "+16502530000", Country: "US", Type: TypeLandlineOrMobile}, true},
+		{"(123) 456-7890", "US", models.PhoneEntity{}, false},
+		{"+1 416 979 5000", "", models.PhoneEntity{Number: "+14169795000", Country: "CA", Type: TypeLandlineOrMobile}, true},
+		{"01512 3456789", "DE", models.PhoneEntity{Number: "+4915123456789", Country: "DE", Type: TypeMobile}, true},
+		// national format without a region to read it in
+		{"020 7946 0958", "", models.PhoneEntity{}, false},
+		{"12345", "GB", models.PhoneEntity{}, false},
+		{"+999 1234 5678", "", models.PhoneEntity{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.raw, tt.region)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Parse(%q, %q) = %+v, %v; want %+v, %v", tt.raw, tt.region, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRegions(t *testing.T) {
+	for region, want := range map[string]bool{"gb": true, "US": true, "DE": true, "XX": false, "": false} {
+		if got := Known(region); got != want {
+			t.Errorf("Known(%q) = %v, want %v", region, got, want)
+		}
+	}
+
+	tests := []struct {
+		url, fallback, want string
+	}{
+		{"https://shop.example.co.uk/contact", "US", "GB"},
+		{"https://example.de./impressum", "", "DE"},
+		{"https://example.com/", "fr", "FR"},
+		{"https://example.eu/", "", ""},
+		{"://bad", "us", "US"},
+	}
+	for _, tt := range tests {
+		if got := RegionForURL(tt.url, tt.fallback); got != tt.want {
+			t.Errorf("RegionForURL(%q, %q) = %q, want %q", tt.url, tt.fallback, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>
+		<a href="tel:+44%2020%207946%200958">Call us</a>
+		<a href="tel:not-a-number">Fax</a>
+	</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "Call 020 7946 0958 or our mobile 07400 123456. " +
+		"Order ABC12345678 shipped 2024-01-15; invoice 15/01/2024."
+
+	found := Find(doc.Selection, text, "GB", 10)
+	want := []models.PhoneEntity{
+		{Number: "+442079460958", Country: "GB", Type: TypeLandline, Source: models.EntitySourceLink},
+		{Number: "+447400123456", Country: "GB", Type: TypeMobile, Source: models.EntitySourceText},
+	}
+	if len(found) != len(want) {
+		t.Fatalf("Find = %+v, want %+v", found, want)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("Find[%d] = %+v, want %+v", i, found[i], want[i])
+		}
+	}
+
+	if found := Find(doc.Selection, text, "GB", 1); len(found) != 1 {
+		t.Errorf("Find with limit 1 = %+v", found)
+	}
+	if found := Find(nil, text, "", 10); len(found) != 0 {
+		t.Errorf("Find without a region = %+v, want none", found)
+	}
+}
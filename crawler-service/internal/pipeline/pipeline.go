@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// ErrDrop is returned by a processor to discard the current result without
+// running the remaining processors
+var ErrDrop = errors.New("result dropped")
+
+// ErrSkip drops the current result like ErrDrop, but the page also does not
+// count against the job's page budget
+var ErrSkip = fmt.Errorf("%w: page skipped", ErrDrop)
+
+// Context carries the page and job being processed through the pipeline
+type Context struct {
+	Job     *models.CrawlJob
+	Request *models.CrawlRequest
+	Element *colly.HTMLElement
+
+	// DiscoveredFrom is the URL of the page that linked to this one; empty
+	// for seed URLs
+	DiscoveredFrom string
+}
+
+// ResultProcessor is a single step in result processing
+type ResultProcessor interface {
+	// Name identifies the processor in per-job configuration
+	Name() string
+	// Process inspects or modifies the result. Returning ErrDrop discards
+	// the result.
+	Process(ctx *Context, result *models.CrawlResult) error
+}
+
+// ProcessorFunc adapts a function to the ResultProcessor interface
+type ProcessorFunc struct {
+	ProcessorName string
+	Fn            func(ctx *Context, result *models.CrawlResult) error
+}
+
+// Name returns the processor name
+func (p ProcessorFunc) Name() string { return p.ProcessorName }
+
+// Process calls the wrapped function
+func (p ProcessorFunc) Process(ctx *Context, result *models.CrawlResult) error {
+	return p.Fn(ctx, result)
+}
+
+// Registry holds the ordered set of processors registered at startup
+type Registry struct {
+	mu         sync.RWMutex
+	processors []ResultProcessor
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register appends a processor to the pipeline, replacing any processor
+// already registered under the same name in place
+func (r *Registry) Register(p ResultProcessor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.processors {
+		if existing.Name() == p.Name() {
+			r.processors[i] = p
+			return
+		}
+	}
+	r.processors = append(r.processors, p)
+}
+
+// Names returns the registered processor names in pipeline order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.processors))
+	for i, p := range r.processors {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Select returns the processors to run for a job. An empty selection runs
+// every registered processor; otherwise only the named ones run, still in
+// registration order.
+func (r *Registry) Select(names []string) ([]ResultProcessor, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(names) == 0 {
+		return append([]ResultProcessor(nil), r.processors...), nil
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var selected []ResultProcessor
+	for _, p := range r.processors {
+		if wanted[p.Name()] {
+			selected = append(selected, p)
+			delete(wanted, p.Name())
+		}
+	}
+	for name := range wanted {
+		return nil, fmt.Errorf("unknown result processor %q", name)
+	}
+	return selected, nil
+}
+
+// Run passes result through each processor in order
+func Run(processors []ResultProcessor, ctx *Context, result *models.CrawlResult) error {
+	for _, p := range processors {
+		if err := p.Process(ctx, result); err != nil {
+			if errors.Is(err, ErrDrop) {
+				return err
+			}
+			return fmt.Errorf("processor %s: %w", p.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoPolicyDir is returned when policies cannot be changed because
+// POLICY_DIR is not set
+var ErrNoPolicyDir = errors.New("POLICY_DIR is not configured")
+
+// PutCategory replaces a category list with list, one domain per line, and
+// reloads the policies. It returns the number of domains in force for the
+// category.
+func (s *Store) PutCategory(name string, list []byte) (int, error) {
+	if !ValidCategory(name) {
+		return 0, errors.New("category must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if s.dir == "" {
+		return 0, ErrNoPolicyDir
+	}
+
+	dir := filepath.Join(s.dir, CategoriesDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	path := filepath.Join(dir, name+".txt")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, list, 0o640); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+
+	s.reload()
+	_, set, err := s.Status()
+	if err != nil {
+		return 0, err
+	}
+	return set.CategorySizes[name], nil
+}
+
+// DeleteCategory removes a category list and reloads the policies. It
+// reports whether the list existed.
+func (s *Store) DeleteCategory(name string) (bool, error) {
+	if !ValidCategory(name) || s.dir == "" {
+		return false, nil
+	}
+	err := os.Remove(filepath.Join(s.dir, CategoriesDir, name+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s.reload()
+	return true, nil
+}
@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cooldownsKey is the Redis hash of host cool-downs, keyed by host, holding
+// when each ends in Unix milliseconds
+const cooldownsKey = "policy_cooldowns"
+
+// Cool-down lengths: the default when a 429 carries no usable Retry-After,
+// and the longest a host's Retry-After can pause it
+const (
+	DefaultCooldown = 30 * time.Second
+	MaxCooldown     = 10 * time.Minute
+)
+
+// Cooldown is a host paused after answering 429 Too Many Requests
+type Cooldown struct {
+	Host  string    `json:"host"`
+	Until time.Time `json:"until"`
+}
+
+// RetryAfter reads a Retry-After header, in seconds or as an HTTP date,
+// falling back to DefaultCooldown and capped at MaxCooldown
+func RetryAfter(h http.Header) time.Duration {
+	d := DefaultCooldown
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		d = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil && time.Until(at) > 0 {
+		d = time.Until(at)
+	}
+	if d > MaxCooldown {
+		d = MaxCooldown
+	}
+	return d
+}
+
+// CoolDown pauses requests to host for d across every job, and across
+// every instance when Redis is connected. A shorter cool-down never cuts
+// a longer one short.
+func (s *Store) CoolDown(host string, d time.Duration) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	until := time.Now().Add(d)
+
+	s.throttleMu.Lock()
+	if until.After(s.cooldowns[host]) {
+		s.cooldowns[host] = until
+	}
+	s.throttleMu.Unlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		current, _ := rdb.HGet(ctx, cooldownsKey, host).Int64()
+		if until.UnixMilli() > current {
+			if err := rdb.HSet(ctx, cooldownsKey, host, until.UnixMilli()).Err(); err != nil {
+				log.WithError(err).WithField("host", host).Warn("Failed to share host cool-down")
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"host":  host,
+		"until": until.UTC().Format(time.RFC3339),
+	}).Info("Host rate limited, pausing requests to it")
+}
+
+// CooldownLeft returns how long requests to host must still wait for its
+// cool-down to end; zero when it is not cooling down
+func (s *Store) CooldownLeft(ctx context.Context, host string) time.Duration {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	s.throttleMu.Lock()
+	until := s.cooldowns[host]
+	s.throttleMu.Unlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		if ms, err := rdb.HGet(ctx, cooldownsKey, host).Int64(); err == nil {
+			if shared := time.UnixMilli(ms); shared.After(until) {
+				until = shared
+			}
+		}
+	}
+
+	if left := time.Until(until); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Cooldowns returns the hosts currently cooling down, sorted by host
+func (s *Store) Cooldowns() []Cooldown {
+	now := time.Now()
+	active := make(map[string]time.Time)
+
+	s.throttleMu.Lock()
+	for host, until := range s.cooldowns {
+		if until.After(now) {
+			active[host] = until
+		} else {
+			delete(s.cooldowns, host)
+		}
+	}
+	s.throttleMu.Unlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		items, err := rdb.HGetAll(ctx, cooldownsKey).Result()
+		if err != nil {
+			log.WithError(err).Warn("Failed to read host cool-downs from Redis")
+		}
+		var expired []string
+		for host, value := range items {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			until := time.UnixMilli(ms)
+			if !until.After(now) {
+				expired = append(expired, host)
+				continue
+			}
+			if until.After(active[host]) {
+				active[host] = until
+			}
+		}
+		if len(expired) > 0 {
+			rdb.HDel(ctx, cooldownsKey, expired...)
+		}
+	}
+
+	list := make([]Cooldown, 0, len(active))
+	for host, until := range active {
+		list = append(list, Cooldown{Host: host, Until: until.UTC()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Host < list[j].Host })
+	return list
+}
+
+// ClearCooldown ends a host's cool-down early. It reports whether the host
+// was cooling down.
+func (s *Store) ClearCooldown(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	s.throttleMu.Lock()
+	cleared := s.cooldowns[host].After(time.Now())
+	delete(s.cooldowns, host)
+	s.throttleMu.Unlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if n, err := rdb.HDel(ctx, cooldownsKey, host).Result(); err == nil && n > 0 {
+			cleared = true
+		}
+	}
+	return cleared
+}
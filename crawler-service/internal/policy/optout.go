@@ -0,0 +1,169 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// OptOutsFile holds opt-outs in the policy directory when Redis is not
+// connected
+const OptOutsFile = "optouts.json"
+
+// optOutsKey is the Redis hash of opt-outs, keyed by domain
+const optOutsKey = "policy_optouts"
+
+// OptOut is a domain its owner or the operators asked never to be crawled.
+// Opt-outs are permanent and cover the domain's subdomains.
+type OptOut struct {
+	Domain    string    `json:"domain"`
+	Reason    string    `json:"reason,omitempty"`
+	Contact   string    `json:"contact,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NormalizeDomain reduces a domain or URL to a lowercase host name
+func NormalizeDomain(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid URL %q", raw)
+		}
+		raw = u.Hostname()
+	}
+	host := strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(raw), "."), "www.")
+	if net.ParseIP(host) == nil && (!strings.Contains(host, ".") || strings.ContainsAny(host, "*?[]/:@ ")) {
+		return "", fmt.Errorf("%q is not a domain name", raw)
+	}
+	return host, nil
+}
+
+// OptOuts returns the registered opt-outs, sorted by domain
+func (s *Store) OptOuts() []OptOut {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]OptOut, 0, len(s.optOuts))
+	for _, o := range s.optOuts {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Domain < list[j].Domain })
+	return list
+}
+
+// AddOptOut registers an opt-out, taking effect for every request from now
+// on, and persists it. It reports whether the domain was already opted out.
+func (s *Store) AddOptOut(o OptOut) (bool, error) {
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	if _, exists := s.optOuts[o.Domain]; exists {
+		s.mu.Unlock()
+		return true, nil
+	}
+	s.optOuts[o.Domain] = o
+	all := make([]OptOut, 0, len(s.optOuts))
+	for _, v := range s.optOuts {
+		all = append(all, v)
+	}
+	s.mu.Unlock()
+
+	return false, s.persistOptOut(o, all)
+}
+
+// persistOptOut stores an opt-out in Redis when connected, else rewrites
+// the opt-out file in the policy directory
+func (s *Store) persistOptOut(o OptOut, all []OptOut) error {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		return rdb.HSet(context.Background(), optOutsKey, o.Domain, data).Err()
+	}
+
+	if s.dir == "" {
+		log.WithField("domain", o.Domain).Warn("Neither Redis nor POLICY_DIR is configured, opt-out will not survive a restart")
+		return nil
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].Domain < all[j].Domain })
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, OptOutsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadOptOuts merges the opt-outs stored in Redis and the policy directory
+// into the store; opt-outs are never removed
+func (s *Store) loadOptOuts() {
+	var loaded []OptOut
+
+	if s.dir != "" {
+		var fromFile []OptOut
+		if err := readJSON(filepath.Join(s.dir, OptOutsFile), &fromFile); err != nil {
+			log.WithError(err).Error("Failed to read opt-outs")
+		}
+		loaded = append(loaded, fromFile...)
+	}
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		items, err := rdb.HGetAll(context.Background(), optOutsKey).Result()
+		if err != nil {
+			log.WithError(err).Warn("Failed to read opt-outs from Redis")
+		}
+		for _, item := range items {
+			var o OptOut
+			if json.Unmarshal([]byte(item), &o) == nil {
+				loaded = append(loaded, o)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range loaded {
+		if _, ok := s.optOuts[o.Domain]; !ok && o.Domain != "" {
+			s.optOuts[o.Domain] = o
+		}
+	}
+}
+
+// optedOut reports whether host is an opted-out domain or one of its
+// subdomains
+func (s *Store) optedOut(host string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for len(host) > 0 {
+		if _, ok := s.optOuts[host]; ok {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+	return false
+}
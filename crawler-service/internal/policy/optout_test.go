@@ -0,0 +1,106 @@
+package policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		raw, want string
+		ok        bool
+	}{
+		{"Example.com", "example.com", true},
+		{"www.example.com.", "example.com", true},
+		{"https://WWW.Example.com:8443/path?q=1", "example.com", true},
+		{"sub.example.co.uk", "sub.example.co.uk", true},
+		{"203.0.113.7", "203.0.113.7", true},
+		{"localhost", "", false},
+		{"*.example.com", "", false},
+		{"example.com/path", "", false},
+		{"user@example.com", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeDomain(tt.raw)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q, %v; want %q, ok %v", tt.raw, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestOptOutCoversSubdomains(t *testing.T) {
+	s := testStore(t, nil)
+	existed, err := s.AddOptOut(OptOut{Domain: "owner.example", Reason: "asked by owner"})
+	if err != nil || existed {
+		t.Fatalf("AddOptOut = %v, %v", existed, err)
+	}
+	if existed, _ := s.AddOptOut(OptOut{Domain: "owner.example"}); !existed {
+		t.Error("second opt-out of a domain not reported as existing")
+	}
+
+	for host, want := range map[string]bool{
+		"owner.example":          true,
+		"www.owner.example":      true,
+		"shop.eu.owner.example":  true,
+		"OWNER.EXAMPLE.":         true,
+		"notowner.example":       false,
+		"owner.example.attacker": false,
+	} {
+		if got := s.Denied(host); got != want {
+			t.Errorf("Denied(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://blog.owner.example/", nil)
+	if err := s.Check(req); !denied(err) {
+		t.Errorf("Check of an opted-out host = %v, want a policy denial", err)
+	}
+	if list := s.OptOuts(); len(list) != 1 || list[0].CreatedAt.IsZero() {
+		t.Errorf("OptOuts = %+v, want one dated opt-out", list)
+	}
+}
+
+func TestOptOutsSurviveRestartInPolicyDir(t *testing.T) {
+	s := testStore(t, nil)
+	if _, err := s.AddOptOut(OptOut{Domain: "owner.example"}); err != nil {
+		t.Fatal(err)
+	}
+	dir, _, _ := s.Status()
+	if _, err := os.Stat(filepath.Join(dir, OptOutsFile)); err != nil {
+		t.Fatalf("opt-out file not written: %v", err)
+	}
+
+	restarted := NewStoreFromEnv()
+	if !restarted.Denied("www.owner.example") {
+		t.Error("opt-out lost on restart")
+	}
+}
+
+func TestOptOutsSharedThroughRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_HOST", mr.Addr())
+	if err := database.InitRedis(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseRedis() })
+
+	a, b := testStore(t, nil), testStore(t, nil)
+	if _, err := a.AddOptOut(OptOut{Domain: "owner.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if b.Denied("owner.example") {
+		t.Fatal("opt-out seen by another instance before it reloaded")
+	}
+	b.loadOptOuts()
+	if !b.Denied("owner.example") {
+		t.Error("opt-out registered on another instance not picked up")
+	}
+}
@@ -0,0 +1,359 @@
+// Package policy holds operator rules applied to every outgoing request:
+// a domain denylist, network (SSRF) rules, per-domain crawl profiles and
+// domain category lists.
+// They are loaded from files in POLICY_DIR and reloaded when the files
+// change, so running jobs pick up new rules without a restart.
+package policy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/httpauth"
+)
+
+// Policy files read from the policy directory; each is optional
+const (
+	DenylistFile = "denylist.txt"
+	NetworksFile = "networks.json"
+	ProfilesFile = "profiles.json"
+	// CategoriesDir holds one list of domains per category, named
+	// <category>.txt
+	CategoriesDir = "categories"
+)
+
+var categoryPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// ValidCategory reports whether name can name a category list
+func ValidCategory(name string) bool {
+	return categoryPattern.MatchString(name)
+}
+
+// privateNetworks are blocked by block_private: loopback, RFC 1918,
+// carrier-grade NAT, link-local (including cloud metadata) and unique local
+var privateNetworks = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"169.254.0.0/16",
+	"0.0.0.0/8",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// privateNets are privateNetworks parsed
+var privateNets, _ = parseCIDRs(privateNetworks)
+
+// Private reports whether ip is a loopback, private or link-local address
+func Private(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Networks are the address rules checked on every connection
+type Networks struct {
+	// BlockPrivate blocks loopback, private and link-local addresses
+	BlockPrivate bool     `json:"block_private,omitempty"`
+	Blocked      []string `json:"blocked,omitempty"`
+	// Allowed are exceptions to the blocked ranges
+	Allowed []string `json:"allowed,omitempty"`
+
+	blocked []*net.IPNet
+	allowed []*net.IPNet
+}
+
+// Profile adjusts how hosts matching its domain globs are fetched
+type Profile struct {
+	Domains []string `json:"domains"`
+	// DelayMS is the minimum time between requests to one host, across
+	// all jobs
+	DelayMS   int               `json:"delay_ms,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	// Windows limit fetching to times of day in TimeZone (an IANA zone
+	// such as the target's "Europe/Berlin", default UTC); outside them
+	// crawls hold the hosts' URLs until the next window opens
+	Windows  []Window `json:"windows,omitempty"`
+	TimeZone string   `json:"time_zone,omitempty"`
+
+	location *time.Location
+}
+
+// Apply sets the profile's user agent and headers on a request
+func (p *Profile) Apply(h *http.Header) {
+	if p.UserAgent != "" {
+		h.Set("User-Agent", p.UserAgent)
+	}
+	for name, value := range p.Headers {
+		h.Set(name, value)
+	}
+}
+
+// Set is one loaded version of the policy files
+type Set struct {
+	// Denylist holds domains (matching their subdomains too) and domain
+	// globs that are never fetched
+	Denylist []string  `json:"denylist"`
+	Networks Networks  `json:"networks"`
+	Profiles []Profile `json:"profiles"`
+	// CategorySizes counts the domains listed per category
+	CategorySizes map[string]int `json:"categories,omitempty"`
+	LoadedAt      time.Time      `json:"loaded_at"`
+
+	// categories maps listed domains to their categories
+	categories map[string][]string
+}
+
+// Denied reports whether host is on the denylist
+func (s *Set) Denied(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range s.Denylist {
+		if httpauth.MatchDomain(entry, host) || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocked reports whether connecting to ip is forbidden
+func (s *Set) Blocked(ip net.IP) bool {
+	for _, n := range s.Networks.allowed {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	for _, n := range s.Networks.blocked {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile returns the first profile matching host, or nil
+func (s *Set) Profile(host string) *Profile {
+	for i := range s.Profiles {
+		for _, domain := range s.Profiles[i].Domains {
+			if httpauth.MatchDomain(domain, host) {
+				return &s.Profiles[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Categories returns the sorted categories of host, from the lists naming
+// it or one of its parent domains
+func (s *Set) Categories(host string) []string {
+	if len(s.categories) == 0 {
+		return nil
+	}
+	host = strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(host, ".")), "www.")
+	seen := make(map[string]bool)
+	var found []string
+	for domain := host; domain != ""; {
+		for _, category := range s.categories[domain] {
+			if !seen[category] {
+				seen[category] = true
+				found = append(found, category)
+			}
+		}
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	sort.Strings(found)
+	return found
+}
+
+// CategoryNames returns the loaded categories, sorted
+func (s *Set) CategoryNames() []string {
+	names := make([]string, 0, len(s.CategorySizes))
+	for name := range s.CategorySizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load reads the policy files in dir; missing files leave their part empty
+func Load(dir string) (*Set, error) {
+	set := &Set{LoadedAt: time.Now().UTC()}
+	if dir == "" {
+		return set, nil
+	}
+
+	denylist, err := readDenylist(filepath.Join(dir, DenylistFile))
+	if err != nil {
+		return nil, err
+	}
+	set.Denylist = denylist
+
+	if err := readJSON(filepath.Join(dir, NetworksFile), &set.Networks); err != nil {
+		return nil, err
+	}
+	if err := set.Networks.parse(); err != nil {
+		return nil, fmt.Errorf("%s: %w", NetworksFile, err)
+	}
+
+	if err := readJSON(filepath.Join(dir, ProfilesFile), &set.Profiles); err != nil {
+		return nil, err
+	}
+	for i := range set.Profiles {
+		p := &set.Profiles[i]
+		if len(p.Domains) == 0 || p.DelayMS < 0 {
+			return nil, fmt.Errorf("%s: profile %d needs domains and a non-negative delay_ms", ProfilesFile, i)
+		}
+		if err := p.parseWindows(); err != nil {
+			return nil, fmt.Errorf("%s: profile %d: %w", ProfilesFile, i, err)
+		}
+	}
+
+	if err := set.readCategories(filepath.Join(dir, CategoriesDir)); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// readCategories reads the category lists in dir, one domain per line in
+// the denylist format
+func (s *Set) readCategories(dir string) error {
+	files, err := categoryFiles(dir)
+	if err != nil {
+		return err
+	}
+	for name, path := range files {
+		domains, err := readDenylist(path)
+		if err != nil {
+			return fmt.Errorf("%s/%s.txt: %w", CategoriesDir, name, err)
+		}
+		if s.categories == nil {
+			s.categories = make(map[string][]string)
+			s.CategorySizes = make(map[string]int)
+		}
+		for _, domain := range domains {
+			domain = strings.TrimPrefix(strings.TrimSuffix(domain, "."), "www.")
+			s.categories[domain] = append(s.categories[domain], name)
+		}
+		s.CategorySizes[name] = len(domains)
+	}
+	return nil
+}
+
+// categoryFiles returns the category list files in dir by category
+func categoryFiles(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".txt")
+		if entry.IsDir() || name == entry.Name() || !ValidCategory(name) {
+			continue
+		}
+		files[name] = filepath.Join(dir, entry.Name())
+	}
+	return files, nil
+}
+
+// readDenylist reads one domain or glob per line, ignoring blank lines and
+// # comments
+func readDenylist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.ToLower(strings.TrimSpace(line)); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// parse compiles the network rules
+func (n *Networks) parse() error {
+	blocked := n.Blocked
+	if n.BlockPrivate {
+		blocked = append(append([]string{}, privateNetworks...), blocked...)
+	}
+	var err error
+	if n.blocked, err = parseCIDRs(blocked); err != nil {
+		return err
+	}
+	n.allowed, err = parseCIDRs(n.Allowed)
+	return err
+}
+
+// parseCIDRs parses CIDR ranges; a bare address is a single-host range
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", v)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
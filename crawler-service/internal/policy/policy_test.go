@@ -0,0 +1,206 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"definitelynotaspy/crawler-service/internal/errcode"
+)
+
+// testStore loads the policy files into a temporary POLICY_DIR
+func testStore(t *testing.T, files map[string]string) *Store {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	t.Setenv("POLICY_DIR", dir)
+	return NewStoreFromEnv()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// denied reports whether err is a refusal by policy
+func denied(err error) bool {
+	var coded *errcode.Error
+	return errors.As(err, &coded) && coded.Code == errcode.PolicyDenied
+}
+
+func TestDenylist(t *testing.T) {
+	s := testStore(t, map[string]string{
+		DenylistFile: "# operators' list\nBlocked.example\n*.tracker.example  # globs too\n\n",
+	})
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"blocked.example", true},
+		{"BLOCKED.example.", true},
+		{"www.blocked.example", true},
+		{"deep.sub.blocked.example", true},
+		{"notblocked.example", false},
+		{"blocked.example.org", false},
+		{"cdn.tracker.example", true},
+		{"tracker.example", false},
+		{"allowed.example", false},
+	}
+	for _, tt := range tests {
+		if got := s.Denied(tt.host); got != tt.want {
+			t.Errorf("Denied(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://www.blocked.example/page", nil)
+	if err := s.Check(req); !denied(err) {
+		t.Errorf("Check of a denied host = %v, want a policy denial", err)
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	s := testStore(t, map[string]string{
+		NetworksFile: `{"block_private": true, "blocked": ["203.0.113.0/24"], "allowed": ["10.1.2.3"]}`,
+	})
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.0.0.5", true},
+		{"172.20.1.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"203.0.113.9", true},
+		{"10.1.2.3", false},
+		{"93.184.216.34", false},
+		{"2606:2800:220:1::1", false},
+	}
+	for _, tt := range tests {
+		err := s.Control("tcp", net.JoinHostPort(tt.ip, "80"), nil)
+		if got := denied(err); got != tt.want {
+			t.Errorf("Control(%s) = %v, want blocked %v", tt.ip, err, tt.want)
+		}
+	}
+}
+
+func TestInvalidNetworks(t *testing.T) {
+	for _, networks := range []string{
+		`{"blocked": ["10.0.0.0/33"]}`,
+		`{"allowed": ["not-an-address"]}`,
+		`{"block_private": "yes"}`,
+	} {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{NetworksFile: networks})
+		if _, err := Load(dir); err == nil {
+			t.Errorf("Load accepted %s", networks)
+		}
+	}
+}
+
+func TestClientRefusesBlockedAddresses(t *testing.T) {
+	var reached bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer srv.Close()
+
+	s := testStore(t, map[string]string{NetworksFile: `{"block_private": true}`})
+	_, err := s.Client(0).Get(srv.URL)
+	if !denied(err) || reached {
+		t.Errorf("delivery to a loopback address = %v (reached %v), want a policy denial", err, reached)
+	}
+
+	// Names resolving to blocked addresses are caught at the dial
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	if _, err := s.Client(0).Get("http://localhost:" + port); !denied(err) || reached {
+		t.Errorf("delivery to localhost = %v (reached %v), want a policy denial", err, reached)
+	}
+
+	open := testStore(t, nil)
+	resp, err := open.Client(0).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("delivery without network rules: %v", err)
+	}
+	resp.Body.Close()
+	if !reached {
+		t.Error("delivery without network rules did not reach the server")
+	}
+}
+
+func TestDialContextRefusesDeniedHosts(t *testing.T) {
+	s := testStore(t, map[string]string{DenylistFile: "denied.example\n"})
+	if _, err := s.DialContext(context.Background(), "tcp", "denied.example:70"); !denied(err) {
+		t.Errorf("DialContext to a denied host = %v, want a policy denial", err)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	s := testStore(t, map[string]string{DenylistFile: "denied.example\n"})
+	var calls int
+	next := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+	})
+	client := &http.Client{Transport: s.Guard(next)}
+
+	if _, err := client.Get("http://denied.example/"); !denied(err) {
+		t.Errorf("guarded request to a denied host = %v, want a policy denial", err)
+	}
+	resp, err := client.Get("http://allowed.example/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("inner transport called %d times, want 1", calls)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestReloadKeepsLastGoodSet(t *testing.T) {
+	s := testStore(t, nil)
+	dir, _, _ := s.Status()
+	if s.Denied("late.example") {
+		t.Fatal("host denied before any policy was written")
+	}
+
+	writeFiles(t, dir, map[string]string{DenylistFile: "late.example\n"})
+	s.reload()
+	if !s.Denied("late.example") {
+		t.Error("denylist written after startup not picked up")
+	}
+
+	// A broken file is reported and the previous rules stay in force
+	writeFiles(t, dir, map[string]string{NetworksFile: "{"})
+	s.reload()
+	if _, _, err := s.Status(); err == nil {
+		t.Error("broken networks file not reported")
+	}
+	if !s.Denied("late.example") {
+		t.Error("broken networks file dropped the denylist in force")
+	}
+}
@@ -0,0 +1,253 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/errcode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Store holds the current policy set and reloads it when its files change
+type Store struct {
+	dir string
+
+	mu      sync.RWMutex
+	set     *Set
+	mods    map[string]time.Time
+	lastErr error
+	optOuts map[string]OptOut
+
+	throttleMu sync.Mutex
+	next       map[string]time.Time
+	cooldowns  map[string]time.Time
+}
+
+// NewStoreFromEnv loads the policies in POLICY_DIR; with it unset every
+// request is allowed
+func NewStoreFromEnv() *Store {
+	s := &Store{
+		dir:       os.Getenv("POLICY_DIR"),
+		set:       &Set{},
+		optOuts:   make(map[string]OptOut),
+		next:      make(map[string]time.Time),
+		cooldowns: make(map[string]time.Time),
+	}
+	s.reload()
+	s.loadOptOuts()
+	return s
+}
+
+// Current returns the policy set in force
+func (s *Store) Current() *Set {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.set
+}
+
+// Status returns the policy directory, the set in force and the error of
+// the last reload, if it failed
+func (s *Store) Status() (string, *Set, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dir, s.set, s.lastErr
+}
+
+// Watch reloads the policies every interval, when their files changed,
+// and picks up opt-outs registered on other instances, until ctx is done
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	s.loadOptOuts()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.reload()
+				s.loadOptOuts()
+			}
+		}
+	}()
+}
+
+// reload re-reads the policy files if any was added, changed or removed. A
+// set that fails to load is reported and the previous one stays in force.
+func (s *Store) reload() {
+	if s.dir == "" {
+		return
+	}
+
+	mods := make(map[string]time.Time)
+	for _, name := range []string{DenylistFile, NetworksFile, ProfilesFile} {
+		if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+			mods[name] = info.ModTime()
+		}
+	}
+	categories, _ := categoryFiles(filepath.Join(s.dir, CategoriesDir))
+	for name, path := range categories {
+		if info, err := os.Stat(path); err == nil {
+			mods[CategoriesDir+"/"+name] = info.ModTime()
+		}
+	}
+
+	s.mu.RLock()
+	unchanged := s.mods != nil && sameMods(s.mods, mods)
+	s.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	set, err := Load(s.dir)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mods = mods
+	s.lastErr = err
+	if err != nil {
+		log.WithError(err).WithField("dir", s.dir).Error("Failed to load policies, keeping previous set")
+		return
+	}
+	s.set = set
+	log.WithFields(log.Fields{
+		"dir":        s.dir,
+		"denylist":   len(set.Denylist),
+		"profiles":   len(set.Profiles),
+		"categories": len(set.CategorySizes),
+	}).Info("Policies loaded")
+}
+
+func sameMods(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, mod := range a {
+		if !b[name].Equal(mod) {
+			return false
+		}
+	}
+	return true
+}
+
+// Denied reports whether host is on the denylist or opted out
+func (s *Store) Denied(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return s.Current().Denied(host) || s.optedOut(host)
+}
+
+// Check refuses requests to denied hosts and to hosts outside their crawl
+// windows, and holds requests to hosts with a profile delay until their
+// turn
+func (s *Store) Check(r *http.Request) error {
+	host := strings.ToLower(r.URL.Hostname())
+	if s.Denied(host) {
+		return errcode.Wrap(errcode.PolicyDenied, fmt.Errorf("%s is denied by policy", host))
+	}
+	p := s.Current().Profile(host)
+	if p == nil {
+		return nil
+	}
+	if wait := p.WindowWait(time.Now()); wait > 0 {
+		return errcode.Wrap(errcode.OutsideWindow, fmt.Errorf("%s is outside its crawl window for another %s", host, wait.Round(time.Minute)))
+	}
+	if p.DelayMS > 0 {
+		return s.wait(r.Context(), host, time.Duration(p.DelayMS)*time.Millisecond)
+	}
+	return nil
+}
+
+// wait reserves the next request slot for host, delay after the previous
+// one, and sleeps until it
+func (s *Store) wait(ctx context.Context, host string, delay time.Duration) error {
+	s.throttleMu.Lock()
+	now := time.Now()
+	slot := s.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	s.next[host] = slot.Add(delay)
+	s.throttleMu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Control is a net.Dialer Control function refusing connections to blocked
+// networks. It sees the resolved address, so DNS names pointing at internal
+// addresses are caught too.
+func (s *Store) Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && s.Current().Blocked(ip) {
+		return errcode.Wrap(errcode.PolicyDenied, fmt.Errorf("connection to %s is blocked by policy", ip))
+	}
+	return nil
+}
+
+// DialContext connects as net.Dialer does, refusing denied hosts and
+// blocked networks
+func (s *Store) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if s.Denied(host) {
+		return nil, errcode.Wrap(errcode.PolicyDenied, fmt.Errorf("%s is denied by policy", host))
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   s.Control,
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// Client returns an HTTP client for deliveries to URLs users supply, such
+// as webhooks and callbacks. It connects directly, never through a proxy,
+// so the policy sees the address it connects to, and redirects are held
+// to the policy too.
+func (s *Store) Client(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = s.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// Guard wraps a transport that does not dial, such as the fixture site, so
+// the denylist and profile delays still apply
+func (s *Store) Guard(next http.RoundTripper) http.RoundTripper {
+	return guard{store: s, next: next}
+}
+
+type guard struct {
+	store *Store
+	next  http.RoundTripper
+}
+
+func (g guard) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := g.store.Check(r); err != nil {
+		return nil, err
+	}
+	return g.next.RoundTrip(r)
+}
@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a time of day, from Start up to End ("HH:MM"), during which
+// the hosts of a profile may be fetched. A window whose end comes before
+// its start runs past midnight.
+type Window struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	start, end time.Duration
+}
+
+// parseClock reads an "HH:MM" time of day as the time since midnight
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseWindows checks a profile's windows and time zone
+func (p *Profile) parseWindows() error {
+	p.location = time.UTC
+	if p.TimeZone != "" {
+		loc, err := time.LoadLocation(p.TimeZone)
+		if err != nil {
+			return fmt.Errorf("unknown time_zone %q", p.TimeZone)
+		}
+		p.location = loc
+	}
+	for i := range p.Windows {
+		w := &p.Windows[i]
+		var err error
+		if w.start, err = parseClock(w.Start); err != nil {
+			return err
+		}
+		if w.end, err = parseClock(w.End); err != nil {
+			return err
+		}
+		if w.start == w.end {
+			return fmt.Errorf("window %s-%s is empty", w.Start, w.End)
+		}
+	}
+	return nil
+}
+
+// WindowWait returns how long after now the profile's hosts may next be
+// fetched: zero during one of its windows, or when it sets none
+func (p *Profile) WindowWait(now time.Time) time.Duration {
+	if len(p.Windows) == 0 {
+		return 0
+	}
+	loc := p.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t := now.In(loc)
+	h, m, s := t.Clock()
+	clock := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+
+	var wait time.Duration
+	for _, w := range p.Windows {
+		inside := clock >= w.start && clock < w.end
+		if w.end < w.start {
+			inside = clock >= w.start || clock < w.end
+		}
+		if inside {
+			return 0
+		}
+
+		// Opening times are built from the date, so they stay right across
+		// daylight saving changes
+		year, month, day := t.Date()
+		opens := time.Date(year, month, day, 0, 0, 0, 0, loc).Add(w.start)
+		if !opens.After(t) {
+			opens = time.Date(year, month, day+1, 0, 0, 0, 0, loc).Add(w.start)
+		}
+		if d := opens.Sub(t); wait == 0 || d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// WindowWait returns how long requests to host must wait for one of its
+// profile's crawl windows to open; zero when they may be sent now
+func (s *Store) WindowWait(host string) time.Duration {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if p := s.Current().Profile(host); p != nil {
+		return p.WindowWait(time.Now())
+	}
+	return 0
+}
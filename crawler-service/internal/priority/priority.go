@@ -0,0 +1,355 @@
+// Package priority rates discovered links by how promising they are to
+// crawl, so crawls visit the best of a page's links first and continuations
+// start from the best of a frontier. The default scorer is a linear model
+// over features of the link with built-in weights. Deployments can tune the
+// weights, or hand scoring to a remote endpoint. Focused crawls instead
+// rate links by their relevance to the query alone.
+package priority
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Link is a discovered link, as known before it is fetched
+type Link struct {
+	URL string `json:"url"`
+	// Anchor is the link's text
+	Anchor string `json:"anchor,omitempty"`
+	// From is the page linking to it
+	From string `json:"from,omitempty"`
+	// Depth is the depth it would be fetched at
+	Depth int `json:"depth"`
+	// Query is the query of the crawl that found it
+	Query string `json:"query,omitempty"`
+	// Context is the text around the link on the page linking to it, when
+	// the crawl reads it
+	Context string `json:"context,omitempty"`
+}
+
+// URLScorer scores links; higher scores are crawled first. Scores are
+// only compared with each other, so any scale will do.
+type URLScorer interface {
+	Name() string
+	Score(ctx context.Context, links []Link) []float64
+}
+
+// Features a linear model weighs
+const (
+	FeatureBias         = "bias"
+	FeatureQueryURL     = "query_url"
+	FeatureQueryAnchor  = "query_anchor"
+	FeatureDepth        = "depth"
+	FeatureSameSite     = "same_site"
+	FeatureContactPage  = "contact_page"
+	FeatureTrapPage     = "trap_page"
+	FeatureQueryParams  = "query_params"
+	FeaturePathSegments = "path_segments"
+	FeatureFile         = "file"
+)
+
+// DefaultWeights are the weights of the heuristic scorer: links mentioning
+// the query and pages that tend to carry contact details come first, deep
+// links, faceted or paginated listings and downloads last
+func DefaultWeights() map[string]float64 {
+	return map[string]float64{
+		FeatureBias:         0,
+		FeatureQueryURL:     2,
+		FeatureQueryAnchor:  3,
+		FeatureDepth:        -0.5,
+		FeatureSameSite:     0.5,
+		FeatureContactPage:  2,
+		FeatureTrapPage:     -3,
+		FeatureQueryParams:  -0.5,
+		FeaturePathSegments: -0.2,
+		FeatureFile:         -1,
+	}
+}
+
+var (
+	contactPath = regexp.MustCompile(`(?i)(contact|kontakt|about|impressum|imprint|legal|team|staff|people|press|support)`)
+	trapPath    = regexp.MustCompile(`(?i)(login|logout|signin|signup|register|cart|checkout|basket|calendar|/tag/|/tags/|share|print=|sort=|order=|filter=|replytocom=|sessionid|[?&]page=\d{2,})`)
+	fileExt     = regexp.MustCompile(`(?i)\.(pdf|zip|gz|tar|rar|7z|exe|dmg|iso|jpe?g|png|gif|webp|svg|mp3|mp4|avi|mov|docx?|xlsx?|pptx?)$`)
+	termSplit   = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// Features extracts the features a linear model weighs from a link
+func Features(link Link) map[string]float64 {
+	f := map[string]float64{
+		FeatureBias:  1,
+		FeatureDepth: float64(link.Depth),
+	}
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		return f
+	}
+
+	terms := queryTerms(link.Query)
+	f[FeatureQueryURL] = matched(terms, strings.ToLower(u.Host+u.Path))
+	f[FeatureQueryAnchor] = matched(terms, strings.ToLower(link.Anchor))
+
+	if from, err := url.Parse(link.From); err == nil && site(from.Hostname()) == site(u.Hostname()) {
+		f[FeatureSameSite] = 1
+	}
+	if contactPath.MatchString(u.Path) || contactPath.MatchString(link.Anchor) {
+		f[FeatureContactPage] = 1
+	}
+	if trapPath.MatchString(u.RequestURI()) {
+		f[FeatureTrapPage] = 1
+	}
+	f[FeatureQueryParams] = float64(len(u.Query()))
+	f[FeaturePathSegments] = float64(len(strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })))
+	if fileExt.MatchString(u.Path) {
+		f[FeatureFile] = 1
+	}
+	return f
+}
+
+// Weights of where query terms are found in a link's relevance
+const (
+	relevanceAnchor  = 0.5
+	relevanceURL     = 0.3
+	relevanceContext = 0.2
+)
+
+// Relevance rates how relevant a link looks to its query, from 0 to 1: the
+// share of query terms in its anchor text, in the tokens of its URL and in
+// the text around it, weighted in that order. Links of a crawl without a
+// query all score 0.
+func Relevance(link Link) float64 {
+	terms := queryTerms(link.Query)
+	if len(terms) == 0 {
+		return 0
+	}
+	var tokens []string
+	if u, err := url.Parse(link.URL); err == nil {
+		tokens = termSplit.Split(strings.ToLower(u.Host+u.Path+" "+u.RawQuery), -1)
+	}
+	return relevanceAnchor*matched(terms, strings.ToLower(link.Anchor)) +
+		relevanceURL*matched(terms, strings.Join(tokens, " ")) +
+		relevanceContext*matched(terms, strings.ToLower(link.Context))
+}
+
+// queryTerms splits a query into lower-case terms of three letters or more
+func queryTerms(query string) []string {
+	var terms []string
+	for _, t := range termSplit.Split(strings.ToLower(query), -1) {
+		if len([]rune(t)) >= 3 {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// matched returns the share of terms found in s
+func matched(terms []string, s string) float64 {
+	if len(terms) == 0 || s == "" {
+		return 0
+	}
+	n := 0
+	for _, t := range terms {
+		if strings.Contains(s, t) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(terms))
+}
+
+// site returns the registrable domain of a host
+func site(host string) string {
+	host = strings.ToLower(host)
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// Linear scores links as the weighted sum of their features
+type Linear struct {
+	name    string
+	weights map[string]float64
+}
+
+// NewHeuristic returns the linear scorer with the default weights
+func NewHeuristic() *Linear {
+	return &Linear{name: "heuristic", weights: DefaultWeights()}
+}
+
+// NewLinear returns a linear scorer whose weights override the defaults;
+// features left out keep their default weight
+func NewLinear(weights map[string]float64) (*Linear, error) {
+	w := DefaultWeights()
+	for feature, weight := range weights {
+		if _, ok := w[feature]; !ok {
+			return nil, fmt.Errorf("unknown URL scoring feature %q", feature)
+		}
+		w[feature] = weight
+	}
+	return &Linear{name: "linear", weights: w}, nil
+}
+
+// Name implements URLScorer
+func (l *Linear) Name() string {
+	return l.name
+}
+
+// Weights returns the weights in use
+func (l *Linear) Weights() map[string]float64 {
+	w := make(map[string]float64, len(l.weights))
+	for feature, weight := range l.weights {
+		w[feature] = weight
+	}
+	return w
+}
+
+// Score implements URLScorer
+func (l *Linear) Score(_ context.Context, links []Link) []float64 {
+	scores := make([]float64, len(links))
+	for i, link := range links {
+		for feature, value := range Features(link) {
+			scores[i] += l.weights[feature] * value
+		}
+	}
+	return scores
+}
+
+// Remote asks an HTTP endpoint to score links: it POSTs {"links": [...]}
+// and expects {"scores": [...]} in the same order. When the endpoint
+// fails or times out, the local fallback scores the links instead.
+type Remote struct {
+	endpoint string
+	http     *http.Client
+	fallback URLScorer
+}
+
+// NewRemote returns a scorer calling endpoint, falling back to fallback
+func NewRemote(endpoint string, timeout time.Duration, fallback URLScorer) *Remote {
+	return &Remote{
+		endpoint: endpoint,
+		http:     &http.Client{Timeout: timeout},
+		fallback: fallback,
+	}
+}
+
+// Name implements URLScorer
+func (r *Remote) Name() string {
+	return "remote"
+}
+
+// Score implements URLScorer
+func (r *Remote) Score(ctx context.Context, links []Link) []float64 {
+	if len(links) == 0 {
+		return nil
+	}
+	scores, err := r.score(ctx, links)
+	if err != nil {
+		log.WithError(err).WithField("endpoint", r.endpoint).Debug("Remote URL scoring failed, scoring locally")
+		return r.fallback.Score(ctx, links)
+	}
+	return scores
+}
+
+func (r *Remote) score(ctx context.Context, links []Link) ([]float64, error) {
+	body, err := json.Marshal(map[string][]Link{"links": links})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scoring endpoint returned %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Scores []float64 `json:"scores"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid scoring response: %w", err)
+	}
+	if len(out.Scores) != len(links) {
+		return nil, fmt.Errorf("scoring endpoint returned %d scores for %d links", len(out.Scores), len(links))
+	}
+	return out.Scores, nil
+}
+
+// NewFromEnv returns the scorer the deployment configures: a linear model
+// with the weights in the JSON object file URL_SCORER_WEIGHTS_FILE, or the
+// heuristic without one. With URL_SCORER_ENDPOINT set, links are scored
+// remotely (timeout URL_SCORER_TIMEOUT, default 2s) and that model scores
+// them when the endpoint fails. On a configuration error the heuristic is
+// used alongside the error.
+func NewFromEnv() (URLScorer, error) {
+	local := NewHeuristic()
+	var scorer URLScorer = local
+
+	if path := os.Getenv("URL_SCORER_WEIGHTS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return local, err
+		}
+		var weights map[string]float64
+		if err := json.Unmarshal(data, &weights); err != nil {
+			return local, fmt.Errorf("invalid URL scorer weights: %w", err)
+		}
+		linear, err := NewLinear(weights)
+		if err != nil {
+			return local, err
+		}
+		scorer = linear
+	}
+
+	if endpoint := os.Getenv("URL_SCORER_ENDPOINT"); endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return local, fmt.Errorf("invalid URL_SCORER_ENDPOINT %q", endpoint)
+		}
+		timeout := 2 * time.Second
+		if d, err := time.ParseDuration(os.Getenv("URL_SCORER_TIMEOUT")); err == nil && d > 0 {
+			timeout = d
+		}
+		scorer = NewRemote(endpoint, timeout, scorer)
+	}
+	return scorer, nil
+}
+
+// Rank orders links best first, keeping the discovery order of links that
+// score the same
+func Rank(ctx context.Context, scorer URLScorer, links []Link) []Link {
+	if scorer == nil || len(links) < 2 {
+		return links
+	}
+	scores := scorer.Score(ctx, links)
+	order := make([]int, len(links))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	ranked := make([]Link, len(links))
+	for i, j := range order {
+		ranked[i] = links[j]
+	}
+	return ranked
+}
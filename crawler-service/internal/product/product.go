@@ -0,0 +1,401 @@
+// Package product extracts structured product offers from e-commerce pages:
+// schema.org Product markup in JSON-LD or microdata, Open Graph product
+// tags and, failing those, common storefront price selectors.
+package product
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Where a product record was read from
+const (
+	SourceSchema    = "schema"
+	SourceMicrodata = "microdata"
+	SourceMeta      = "meta"
+	SourceSelector  = "selector"
+)
+
+// maxProducts bounds the products kept per page, e.g. on category pages
+const maxProducts = 50
+
+// priceSelectors are storefront price elements used when a page has no
+// product markup
+var priceSelectors = []string{
+	"#priceblock_ourprice",
+	"#priceblock_dealprice",
+	".a-price .a-offscreen",
+	".product-price",
+	".price-current",
+	".product__price",
+	".woocommerce-Price-amount",
+	"[data-price]",
+	".price",
+}
+
+// currencySymbols map price symbols to currency codes, longest first so
+// "US$" is not read as "$"
+var currencySymbols = []struct{ symbol, code string }{
+	{"US$", "USD"},
+	{"R$", "BRL"},
+	{"C$", "CAD"},
+	{"A$", "AUD"},
+	{"$", "USD"},
+	{"€", "EUR"},
+	{"£", "GBP"},
+	{"¥", "JPY"},
+	{"₹", "INR"},
+	{"₩", "KRW"},
+	{"₽", "RUB"},
+}
+
+var (
+	pricePattern    = regexp.MustCompile(`\d+(?:[.,' \x{00a0}]\d+)*`)
+	currencyPattern = regexp.MustCompile(`\b(USD|EUR|GBP|JPY|CNY|INR|KRW|RUB|BRL|CAD|AUD|CHF|SEK|NOK|DKK|PLN|MXN)\b`)
+)
+
+// Extract returns the products offered on a page
+func Extract(doc *goquery.Selection, pageURL string) []models.Product {
+	var products []models.Product
+	seen := make(map[string]bool)
+	add := func(p models.Product) {
+		if p.Name == "" && p.SKU == "" && p.Price == 0 {
+			return
+		}
+		key := strings.ToLower(p.Name) + "|" + p.SKU + "|" + strconv.FormatFloat(p.Price, 'f', -1, 64)
+		if seen[key] || len(products) == maxProducts {
+			return
+		}
+		seen[key] = true
+		p.URL = resolve(pageURL, p.URL)
+		p.Image = resolve(pageURL, p.Image)
+		products = append(products, p)
+	}
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var data interface{}
+		if json.Unmarshal([]byte(s.Text()), &data) == nil {
+			walkJSONLD(data, add)
+		}
+	})
+
+	doc.Find(`[itemtype*="schema.org/Product"]`).Each(func(_ int, s *goquery.Selection) {
+		add(fromMicrodata(s))
+	})
+
+	if len(products) == 0 {
+		add(fromMeta(doc))
+	}
+	if len(products) == 0 {
+		add(fromSelectors(doc))
+	}
+	return products
+}
+
+// walkJSONLD collects Product nodes, including those nested in @graph or
+// ItemList elements
+func walkJSONLD(v interface{}, add func(models.Product)) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			walkJSONLD(item, add)
+		}
+	case map[string]interface{}:
+		if hasType(v["@type"], "Product") {
+			add(fromSchema(v))
+			return
+		}
+		for _, child := range v {
+			walkJSONLD(child, add)
+		}
+	}
+}
+
+func fromSchema(v map[string]interface{}) models.Product {
+	p := models.Product{
+		Name:   text(v["name"]),
+		SKU:    text(v["sku"]),
+		GTIN:   firstText(v, "gtin", "gtin13", "gtin12", "gtin14", "gtin8"),
+		Brand:  name(v["brand"]),
+		URL:    text(v["url"]),
+		Image:  image(v["image"]),
+		Source: SourceSchema,
+	}
+	if p.SKU == "" {
+		p.SKU = text(v["mpn"])
+	}
+
+	offers := v["offers"]
+	if list, ok := offers.([]interface{}); ok && len(list) > 0 {
+		offers = list[0]
+	}
+	if offer, ok := offers.(map[string]interface{}); ok {
+		price := offer["price"]
+		if price == nil {
+			price = offer["lowPrice"]
+		}
+		if spec, ok := offer["priceSpecification"].(map[string]interface{}); ok && price == nil {
+			price = spec["price"]
+			if offer["priceCurrency"] == nil {
+				offer["priceCurrency"] = spec["priceCurrency"]
+			}
+		}
+		p.Price, _ = ParsePrice(text(price))
+		p.Currency = strings.ToUpper(text(offer["priceCurrency"]))
+		p.Availability = Availability(text(offer["availability"]))
+		if p.SKU == "" {
+			p.SKU = text(offer["sku"])
+		}
+		if p.URL == "" {
+			p.URL = text(offer["url"])
+		}
+	}
+	return p
+}
+
+func fromMicrodata(s *goquery.Selection) models.Product {
+	p := models.Product{
+		Name:   itemprop(s, "name"),
+		SKU:    itemprop(s, "sku"),
+		GTIN:   itemprop(s, "gtin13"),
+		Brand:  itemprop(s, "brand"),
+		Image:  itemprop(s, "image"),
+		Source: SourceMicrodata,
+	}
+	if p.SKU == "" {
+		p.SKU = itemprop(s, "mpn")
+	}
+	price := itemprop(s, "price")
+	if price == "" {
+		price = itemprop(s, "lowPrice")
+	}
+	var symbol string
+	p.Price, symbol = ParsePrice(price)
+	p.Currency = strings.ToUpper(itemprop(s, "priceCurrency"))
+	if p.Currency == "" {
+		p.Currency = symbol
+	}
+	p.Availability = Availability(itemprop(s, "availability"))
+	return p
+}
+
+// fromMeta reads Open Graph product tags
+func fromMeta(doc *goquery.Selection) models.Product {
+	meta := func(names ...string) string {
+		for _, name := range names {
+			if content, ok := doc.Find(`meta[property="` + name + `"]`).Attr("content"); ok {
+				return strings.TrimSpace(content)
+			}
+		}
+		return ""
+	}
+	price := meta("product:price:amount", "og:price:amount")
+	if price == "" {
+		return models.Product{}
+	}
+	p := models.Product{
+		Name:         meta("og:title"),
+		Image:        meta("og:image"),
+		URL:          meta("og:url"),
+		Brand:        meta("product:brand"),
+		SKU:          meta("product:retailer_item_id"),
+		Currency:     strings.ToUpper(meta("product:price:currency", "og:price:currency")),
+		Availability: Availability(meta("product:availability", "og:availability")),
+		Source:       SourceMeta,
+	}
+	p.Price, _ = ParsePrice(price)
+	return p
+}
+
+// fromSelectors falls back to the first storefront price element, naming
+// the product after the page's main heading
+func fromSelectors(doc *goquery.Selection) models.Product {
+	for _, selector := range priceSelectors {
+		el := doc.Find(selector).First()
+		if el.Length() == 0 {
+			continue
+		}
+		raw, ok := el.Attr("data-price")
+		if !ok {
+			raw = el.Text()
+		}
+		price, currency := ParsePrice(raw)
+		if price == 0 {
+			continue
+		}
+		return models.Product{
+			Name:     strings.TrimSpace(doc.Find("h1").First().Text()),
+			Price:    price,
+			Currency: currency,
+			Source:   SourceSelector,
+		}
+	}
+	return models.Product{}
+}
+
+// ParsePrice reads a price written with any common grouping and decimal
+// separators ("$1,299.99", "1.299,99 €", "1 299"), returning it and the
+// currency its symbol or code names, if any
+func ParsePrice(raw string) (float64, string) {
+	raw = strings.TrimSpace(raw)
+	currency := ""
+	for _, c := range currencySymbols {
+		if strings.Contains(raw, c.symbol) {
+			currency = c.code
+			break
+		}
+	}
+	if code := currencyPattern.FindString(raw); code != "" {
+		currency = code
+	}
+
+	// Spaces, no-break spaces and apostrophes only ever group digits
+	number := strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(pricePattern.FindString(raw))
+	if number == "" {
+		return 0, currency
+	}
+
+	lastDot, lastComma := strings.LastIndex(number, "."), strings.LastIndex(number, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// The later separator is the decimal one
+		if lastComma > lastDot {
+			number = strings.ReplaceAll(number, ".", "")
+			number = strings.Replace(number, ",", ".", 1)
+		} else {
+			number = strings.ReplaceAll(number, ",", "")
+		}
+	case lastComma >= 0:
+		// A single comma followed by one or two digits is a decimal comma
+		if strings.Count(number, ",") == 1 && len(number)-lastComma-1 <= 2 {
+			number = strings.Replace(number, ",", ".", 1)
+		} else {
+			number = strings.ReplaceAll(number, ",", "")
+		}
+	case strings.Count(number, ".") > 1:
+		number = strings.ReplaceAll(number, ".", "")
+	}
+
+	price, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, currency
+	}
+	return price, currency
+}
+
+// Availability reduces a schema.org ItemAvailability ("InStock",
+// "https://schema.org/OutOfStock", "in stock") to snake case
+func Availability(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if i := strings.LastIndex(raw, "/"); i >= 0 {
+		raw = raw[i+1:]
+	}
+	var b strings.Builder
+	for i, r := range raw {
+		switch {
+		case r == ' ' || r == '-' || r == '_':
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+		case r >= 'A' && r <= 'Z':
+			if i > 0 && b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r + ('a' - 'A'))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func hasType(v interface{}, want string) bool {
+	switch t := v.(type) {
+	case string:
+		return t == want || strings.HasSuffix(t, "/"+want)
+	case []interface{}:
+		for _, item := range t {
+			if hasType(item, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func firstText(v map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s := text(v[key]); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// name reads a Brand or Organization given as a node or a plain name
+func name(v interface{}) string {
+	if node, ok := v.(map[string]interface{}); ok {
+		return text(node["name"])
+	}
+	return text(v)
+}
+
+// image reads an image given as a URL, an ImageObject or a list of either
+func image(v interface{}) string {
+	switch v := v.(type) {
+	case []interface{}:
+		if len(v) > 0 {
+			return image(v[0])
+		}
+	case map[string]interface{}:
+		return text(v["url"])
+	}
+	return text(v)
+}
+
+// itemprop reads a microdata property; a property that is itself an item,
+// such as a brand, is read as its name
+func itemprop(s *goquery.Selection, name string) string {
+	el := s.Find(`[itemprop="` + name + `"]`).First()
+	for _, attr := range []string{"content", "href", "src"} {
+		if value, ok := el.Attr(attr); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	if _, nested := el.Attr("itemscope"); nested && name != "name" {
+		return itemprop(el, "name")
+	}
+	return strings.TrimSpace(el.Text())
+}
+
+func resolve(base, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	u, err := b.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
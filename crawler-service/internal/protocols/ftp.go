@@ -0,0 +1,103 @@
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// maxFTPFileBytes caps the size of files downloaded over FTP
+const maxFTPFileBytes = 50 << 20
+
+// FTPTransport serves ftp:// URLs: directories become HTML listings and
+// files are returned with a guessed content type. Control and data
+// connections are made with Dial.
+type FTPTransport struct {
+	Dial DialFunc
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *FTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return newResponse(req, http.StatusMethodNotAllowed, "", nil), nil
+	}
+
+	host := req.URL.Host
+	if req.URL.Port() == "" {
+		host += ":21"
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Minute)
+	defer cancel()
+	dial := dialer(t.Dial)
+	conn, err := ftp.Dial(host, ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+		dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		return dial(dialCtx, network, address)
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("ftp connect %s: %w", req.URL.Host, err)
+	}
+	defer conn.Quit()
+
+	user, pass := "anonymous", "anonymous@"
+	if req.URL.User != nil {
+		user = req.URL.User.Username()
+		pass, _ = req.URL.User.Password()
+	}
+	if err := conn.Login(user, pass); err != nil {
+		return newResponse(req, http.StatusUnauthorized, "", nil), nil
+	}
+
+	p := req.URL.Path
+	if p == "" {
+		p = "/"
+	}
+
+	// Try the path as a directory first
+	if strings.HasSuffix(p, "/") || conn.ChangeDir(p) == nil {
+		entries, err := conn.List(p)
+		if err != nil {
+			return newResponse(req, http.StatusNotFound, "", nil), nil
+		}
+
+		listing := make([]listingEntry, 0, len(entries))
+		for _, e := range entries {
+			if e.Name == "." || e.Name == ".." {
+				continue
+			}
+			listing = append(listing, listingEntry{Name: e.Name, IsDir: e.Type == ftp.EntryTypeFolder})
+		}
+
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			// Redirect so relative links in the listing resolve correctly
+			resp := newResponse(req, http.StatusMovedPermanently, "", nil)
+			u := *req.URL
+			u.Path = p + "/"
+			resp.Header.Set("Location", u.String())
+			return resp, nil
+		}
+		return newResponse(req, http.StatusOK, "text/html; charset=utf-8",
+			renderListing("Index of "+p, listing)), nil
+	}
+
+	r, err := conn.Retr(p)
+	if err != nil {
+		return newResponse(req, http.StatusNotFound, "", nil), nil
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, maxFTPFileBytes))
+	if err != nil {
+		return nil, fmt.Errorf("ftp download %s: %w", p, err)
+	}
+
+	return newResponse(req, http.StatusOK, contentTypeFor(path.Base(p), data), data), nil
+}
@@ -0,0 +1,191 @@
+package protocols
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxSmallWebBytes caps responses over Gemini and Gopher
+const maxSmallWebBytes = 10 << 20
+
+// GeminiTransport serves gemini:// URLs, converting text/gemini documents to
+// HTML so they flow through the regular extraction pipeline. Connections
+// are made with Dial, and server certificates are checked against Hosts.
+type GeminiTransport struct {
+	Dial  DialFunc
+	Hosts *KnownHosts
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *GeminiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if req.URL.Port() == "" {
+		host += ":1965"
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 30*time.Second)
+	defer cancel()
+	raw, err := dialer(t.Dial)(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("gemini connect %s: %w", req.URL.Host, err)
+	}
+
+	hosts := t.Hosts
+	if hosts == nil {
+		hosts = sharedKnownHosts()
+	}
+	hostname := req.URL.Hostname()
+	conn := tls.Client(raw, &tls.Config{
+		ServerName: hostname,
+		MinVersion: tls.VersionTLS12,
+		// Gemini servers commonly use self-signed certificates, so the
+		// chain is not verified; the certificate is pinned on first use
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("gemini server %s sent no certificate", hostname)
+			}
+			return hosts.Verify(hostname, state.PeerCertificates[0])
+		},
+	})
+	defer conn.Close()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("gemini connect %s: %w", req.URL.Host, err)
+	}
+	conn.SetDeadline(time.Now().Add(60 * time.Second))
+
+	if _, err := fmt.Fprintf(conn, "%s\r\n", req.URL.String()); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(io.LimitReader(conn, maxSmallWebBytes))
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("gemini read header: %w", err)
+	}
+	header = strings.TrimRight(header, "\r\n")
+
+	status, meta, _ := strings.Cut(header, " ")
+	if len(status) != 2 {
+		return nil, fmt.Errorf("invalid gemini header %q", header)
+	}
+
+	switch status[0] {
+	case '2':
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if meta == "" || strings.HasPrefix(meta, "text/gemini") {
+			return newResponse(req, http.StatusOK, "text/html; charset=utf-8", GemtextToHTML(body)), nil
+		}
+		return newResponse(req, http.StatusOK, meta, body), nil
+	case '3':
+		resp := newResponse(req, http.StatusFound, "", nil)
+		resp.Header.Set("Location", meta)
+		return resp, nil
+	case '1', '6':
+		return newResponse(req, http.StatusUnauthorized, "", []byte(meta)), nil
+	case '4':
+		return newResponse(req, http.StatusServiceUnavailable, "", []byte(meta)), nil
+	case '5':
+		if status == "51" {
+			return newResponse(req, http.StatusNotFound, "", []byte(meta)), nil
+		}
+		return newResponse(req, http.StatusBadRequest, "", []byte(meta)), nil
+	}
+	return nil, fmt.Errorf("unknown gemini status %s", status)
+}
+
+// GemtextToHTML converts a text/gemini document to HTML
+func GemtextToHTML(doc []byte) []byte {
+	var b bytes.Buffer
+	title := ""
+	var body bytes.Buffer
+	pre := false
+	inList := false
+
+	closeList := func() {
+		if inList {
+			body.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+
+	for _, line := range strings.Split(string(doc), "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if strings.HasPrefix(line, "```") {
+			closeList()
+			if pre {
+				body.WriteString("</pre>\n")
+			} else {
+				body.WriteString("<pre>")
+			}
+			pre = !pre
+			continue
+		}
+		if pre {
+			body.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "=>"):
+			closeList()
+			fields := strings.Fields(strings.TrimPrefix(line, "=>"))
+			if len(fields) == 0 {
+				continue
+			}
+			label := fields[0]
+			if len(fields) > 1 {
+				label = strings.Join(fields[1:], " ")
+			}
+			fmt.Fprintf(&body, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(fields[0]), html.EscapeString(label))
+		case strings.HasPrefix(line, "###"):
+			closeList()
+			fmt.Fprintf(&body, "<h3>%s</h3>\n", html.EscapeString(strings.TrimSpace(line[3:])))
+		case strings.HasPrefix(line, "##"):
+			closeList()
+			fmt.Fprintf(&body, "<h2>%s</h2>\n", html.EscapeString(strings.TrimSpace(line[2:])))
+		case strings.HasPrefix(line, "#"):
+			closeList()
+			text := strings.TrimSpace(line[1:])
+			if title == "" {
+				title = text
+			}
+			fmt.Fprintf(&body, "<h1>%s</h1>\n", html.EscapeString(text))
+		case strings.HasPrefix(line, "* "):
+			if !inList {
+				body.WriteString("<ul>\n")
+				inList = true
+			}
+			fmt.Fprintf(&body, "<li>%s</li>\n", html.EscapeString(line[2:]))
+		case strings.HasPrefix(line, ">"):
+			closeList()
+			fmt.Fprintf(&body, "<blockquote>%s</blockquote>\n", html.EscapeString(strings.TrimSpace(line[1:])))
+		case strings.TrimSpace(line) == "":
+			closeList()
+		default:
+			closeList()
+			fmt.Fprintf(&body, "<p>%s</p>\n", html.EscapeString(line))
+		}
+	}
+	closeList()
+	if pre {
+		body.WriteString("</pre>\n")
+	}
+
+	fmt.Fprintf(&b, "<html><head><title>%s</title></head><body>\n", html.EscapeString(title))
+	b.Write(body.Bytes())
+	b.WriteString("</body></html>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,122 @@
+package protocols
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// GopherTransport serves gopher:// URLs. Menus become HTML link lists and
+// text files are wrapped in a preformatted HTML page. Connections are made
+// with Dial.
+type GopherTransport struct {
+	Dial DialFunc
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *GopherTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if req.URL.Port() == "" {
+		host += ":70"
+	}
+
+	// The first path character is the item type, the rest the selector
+	itemType := byte('1')
+	selector := ""
+	if p := req.URL.Path; len(p) > 1 {
+		itemType = p[1]
+		selector = p[2:]
+	}
+	if req.URL.RawQuery != "" && itemType == '7' {
+		selector += "\t" + req.URL.RawQuery
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 30*time.Second)
+	defer cancel()
+	conn, err := dialer(t.Dial)(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("gopher connect %s: %w", req.URL.Host, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(60 * time.Second))
+
+	if _, err := fmt.Fprintf(conn, "%s\r\n", selector); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(conn, maxSmallWebBytes))
+	if err != nil {
+		return nil, fmt.Errorf("gopher read: %w", err)
+	}
+
+	switch itemType {
+	case '1', '7':
+		return newResponse(req, http.StatusOK, "text/html; charset=utf-8", gopherMenuToHTML(selector, data)), nil
+	case '0':
+		return newResponse(req, http.StatusOK, "text/html; charset=utf-8", gopherTextToHTML(selector, data)), nil
+	case 'h':
+		return newResponse(req, http.StatusOK, "text/html; charset=utf-8", data), nil
+	}
+	return newResponse(req, http.StatusOK, contentTypeFor(path.Base(selector), data), data), nil
+}
+
+// gopherMenuToHTML renders a gopher menu as an HTML page of links
+func gopherMenuToHTML(selector string, data []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<html><head><title>%s</title></head><body>\n", html.EscapeString(selector))
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "." || line == "" {
+			continue
+		}
+
+		fields := strings.Split(line[1:], "\t")
+		display := html.EscapeString(fields[0])
+		itemType := line[0]
+
+		if itemType == 'i' || itemType == '3' || len(fields) < 4 {
+			fmt.Fprintf(&b, "<p>%s</p>\n", display)
+			continue
+		}
+
+		target := ""
+		if itemType == 'h' && strings.HasPrefix(fields[1], "URL:") {
+			target = strings.TrimPrefix(fields[1], "URL:")
+		} else {
+			u := url.URL{
+				Scheme: "gopher",
+				Host:   net.JoinHostPort(fields[2], strings.TrimSpace(fields[3])),
+				Path:   "/" + string(itemType) + fields[1],
+			}
+			target = u.String()
+		}
+		fmt.Fprintf(&b, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(target), display)
+	}
+
+	b.WriteString("</body></html>\n")
+	return b.Bytes()
+}
+
+// gopherTextToHTML wraps a gopher text file in an HTML page
+func gopherTextToHTML(selector string, data []byte) []byte {
+	text := strings.TrimSuffix(strings.TrimRight(string(data), "\r\n"), "\n.")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<html><head><title>%s</title></head><body>\n", html.EscapeString(path.Base(selector)))
+	for _, para := range strings.Split(text, "\n\n") {
+		if strings.TrimSpace(para) != "" {
+			fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(para))
+		}
+	}
+	b.WriteString("</body></html>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,126 @@
+package protocols
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CIDHeader carries the content identifier of an IPFS response
+const CIDHeader = "X-Ipfs-Cid"
+
+var (
+	ipfsOnce      sync.Once
+	ipfsTransport *IPFSTransport
+)
+
+// IPFSTransport serves ipfs:// and ipns:// URLs through HTTP gateways,
+// rotating between them and falling back to the next on failure
+type IPFSTransport struct {
+	gateways []string
+	next     uint32
+	client   *http.Client
+}
+
+// NewIPFSTransport creates a transport over the given gateway base URLs
+func NewIPFSTransport(gateways []string) *IPFSTransport {
+	return &IPFSTransport{
+		gateways: gateways,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// sharedIPFSTransport returns the process-wide gateway transport configured
+// from IPFS_GATEWAYS, so rotation is spread across all crawls
+func sharedIPFSTransport() *IPFSTransport {
+	ipfsOnce.Do(func() {
+		ipfsTransport = NewIPFSTransport(ipfsGateways())
+	})
+	return ipfsTransport
+}
+
+func ipfsGateways() []string {
+	raw := os.Getenv("IPFS_GATEWAYS")
+	if raw == "" {
+		raw = "https://ipfs.io,https://dweb.link"
+	}
+	var gateways []string
+	for _, g := range strings.Split(raw, ",") {
+		if g = strings.TrimRight(strings.TrimSpace(g), "/"); g != "" {
+			gateways = append(gateways, g)
+		}
+	}
+	return gateways
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *IPFSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.gateways) == 0 {
+		return nil, fmt.Errorf("no IPFS gateways configured")
+	}
+
+	gatewayPath := "/" + req.URL.Scheme + "/" + req.URL.Host + req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		gatewayPath += "?" + req.URL.RawQuery
+	}
+
+	start := int(atomic.AddUint32(&t.next, 1))
+	var lastErr error
+	for i := range t.gateways {
+		gateway := t.gateways[(start+i)%len(t.gateways)]
+
+		greq, err := http.NewRequestWithContext(req.Context(), req.Method, gateway+gatewayPath, nil)
+		if err != nil {
+			return nil, err
+		}
+		greq.Header = req.Header.Clone()
+
+		resp, err := t.client.Do(greq)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("gateway %s returned %d", gateway, resp.StatusCode)
+			continue
+		}
+
+		// The gateway redirected a directory to its trailing-slash form;
+		// mirror that on the ipfs URL so relative links resolve correctly
+		if strings.HasSuffix(resp.Request.URL.Path, "/") && !strings.HasSuffix(req.URL.Path, "/") {
+			resp.Body.Close()
+			u := *req.URL
+			u.Path += "/"
+			redirect := newResponse(req, http.StatusMovedPermanently, "", nil)
+			redirect.Header.Set("Location", u.String())
+			return redirect, nil
+		}
+
+		if cid := responseCID(req, resp); cid != "" {
+			resp.Header.Set(CIDHeader, cid)
+		}
+		resp.Request = req
+		return resp, nil
+	}
+	return nil, fmt.Errorf("all IPFS gateways failed: %w", lastErr)
+}
+
+// responseCID determines the CID of a gateway response; ipns names are
+// resolved via the gateway's X-Ipfs-Roots or X-Ipfs-Path headers
+func responseCID(req *http.Request, resp *http.Response) string {
+	if req.URL.Scheme == "ipfs" {
+		return req.URL.Host
+	}
+	if roots := resp.Header.Get("X-Ipfs-Roots"); roots != "" {
+		return strings.TrimSpace(strings.Split(roots, ",")[0])
+	}
+	if p := strings.TrimPrefix(resp.Header.Get("X-Ipfs-Path"), "/ipfs/"); p != resp.Header.Get("X-Ipfs-Path") {
+		return strings.SplitN(p, "/", 2)[0]
+	}
+	return ""
+}
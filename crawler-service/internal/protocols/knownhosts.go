@@ -0,0 +1,149 @@
+package protocols
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// knownHostsKey is the Redis hash of pinned Gemini certificates, keyed by
+// host
+const knownHostsKey = "gemini_known_hosts"
+
+var (
+	knownHostsOnce sync.Once
+	knownHosts     *KnownHosts
+)
+
+// KnownHosts pins the certificates of Gemini servers on first use. Gemini
+// servers commonly present self-signed certificates, so the first one seen
+// for a host is trusted and later connections must present the same one
+// until it expires.
+type KnownHosts struct {
+	file string
+
+	mu    sync.Mutex
+	hosts map[string]KnownHost
+}
+
+// KnownHost is the certificate pinned for a host
+type KnownHost struct {
+	Fingerprint string    `json:"fingerprint"`
+	Expires     time.Time `json:"expires"`
+}
+
+// NewKnownHosts creates a store of pinned certificates, shared through Redis
+// when connected and else kept in file, when not empty
+func NewKnownHosts(file string) *KnownHosts {
+	k := &KnownHosts{file: file, hosts: make(map[string]KnownHost)}
+	if file != "" {
+		if data, err := os.ReadFile(file); err == nil {
+			if err := json.Unmarshal(data, &k.hosts); err != nil {
+				log.WithError(err).WithField("file", file).Error("Invalid Gemini known hosts file")
+			}
+		}
+	}
+	return k
+}
+
+// sharedKnownHosts returns the process-wide store, kept in
+// GEMINI_KNOWN_HOSTS (default data/gemini_known_hosts.json) without Redis
+func sharedKnownHosts() *KnownHosts {
+	knownHostsOnce.Do(func() {
+		file := os.Getenv("GEMINI_KNOWN_HOSTS")
+		if file == "" {
+			file = filepath.Join("data", "gemini_known_hosts.json")
+		}
+		knownHosts = NewKnownHosts(file)
+	})
+	return knownHosts
+}
+
+// Verify checks the certificate host presented against the one pinned for
+// it, pinning it when there is none or the pinned one has expired
+func (k *KnownHosts) Verify(host string, cert *x509.Certificate) error {
+	now := time.Now()
+	if now.After(cert.NotAfter) || now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate of %s is not valid now", host)
+	}
+	sum := sha256.Sum256(cert.Raw)
+	seen := KnownHost{Fingerprint: hex.EncodeToString(sum[:]), Expires: cert.NotAfter}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	known, ok := k.load(host)
+	if ok && known.Fingerprint == seen.Fingerprint {
+		return nil
+	}
+	if ok && now.Before(known.Expires) {
+		return fmt.Errorf("certificate of %s does not match the one pinned until %s", host, known.Expires.Format(time.RFC3339))
+	}
+	k.hosts[host] = seen
+	if err := k.save(host, seen); err != nil {
+		log.WithError(err).WithField("host", host).Warn("Failed to save pinned Gemini certificate")
+	}
+	return nil
+}
+
+// load returns the certificate pinned for host, checking Redis for one
+// pinned by another instance
+func (k *KnownHosts) load(host string) (KnownHost, bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		data, err := rdb.HGet(ctx, knownHostsKey, host).Bytes()
+		var known KnownHost
+		if err == nil && json.Unmarshal(data, &known) == nil {
+			k.hosts[host] = known
+			return known, true
+		}
+		if err != nil && !errors.Is(err, redis.Nil) {
+			log.WithError(err).Warn("Failed to read pinned Gemini certificate, using local pins")
+		}
+	}
+	known, ok := k.hosts[host]
+	return known, ok
+}
+
+// save stores the certificate pinned for host
+func (k *KnownHosts) save(host string, known KnownHost) error {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(known)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return rdb.HSet(ctx, knownHostsKey, host, data).Err()
+	}
+	if k.file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(k.hosts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.file), 0o755); err != nil {
+		return err
+	}
+	tmp := k.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.file)
+}
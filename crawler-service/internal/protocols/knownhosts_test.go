@@ -0,0 +1,79 @@
+package protocols
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSigned returns a self-signed certificate valid from notBefore to
+// notAfter
+func selfSigned(t *testing.T, notBefore, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gemini.example"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestKnownHostsPinsFirstCertificate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts.json")
+	hosts := NewKnownHosts(file)
+	now := time.Now()
+	first := selfSigned(t, now.Add(-time.Hour), now.Add(time.Hour))
+	other := selfSigned(t, now.Add(-time.Hour), now.Add(time.Hour))
+
+	if err := hosts.Verify("gemini.example", first); err != nil {
+		t.Fatalf("first certificate refused: %v", err)
+	}
+	if err := hosts.Verify("gemini.example", first); err != nil {
+		t.Errorf("pinned certificate refused: %v", err)
+	}
+	if err := hosts.Verify("gemini.example", other); err == nil {
+		t.Error("changed certificate accepted before the pinned one expired")
+	}
+	if err := hosts.Verify("other.example", other); err != nil {
+		t.Errorf("certificate of another host refused: %v", err)
+	}
+
+	// Pins survive a restart
+	if err := NewKnownHosts(file).Verify("gemini.example", other); err == nil {
+		t.Error("changed certificate accepted after reloading the pins")
+	}
+
+	expired := selfSigned(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	if err := hosts.Verify("expired.example", expired); err == nil {
+		t.Error("expired certificate accepted")
+	}
+}
+
+func TestKnownHostsReplacesExpiredPin(t *testing.T) {
+	hosts := NewKnownHosts("")
+	hosts.hosts["gemini.example"] = KnownHost{Fingerprint: "old", Expires: time.Now().Add(-time.Minute)}
+
+	now := time.Now()
+	if err := hosts.Verify("gemini.example", selfSigned(t, now.Add(-time.Hour), now.Add(time.Hour))); err != nil {
+		t.Errorf("certificate replacing an expired pin refused: %v", err)
+	}
+}
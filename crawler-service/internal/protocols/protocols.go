@@ -0,0 +1,127 @@
+package protocols
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+// DialFunc connects to an address as net.Dialer.DialContext does
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// Register adds the non-HTTP schemes this deployment supports to t: ftp://,
+// gemini://, gopher://, ipfs:// and ipns:// always, and file:// only when
+// FILE_SEED_ROOT names a directory, which then acts as the root of all
+// file:// paths. Each transport is wrapped by guard, which applies the
+// operator policies to its requests, and connects through t.DialContext as
+// it is when the connection is made, so the network rules of HTTP
+// connections hold for every scheme.
+func Register(t *http.Transport, guard func(http.RoundTripper) http.RoundTripper) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return t.DialContext(ctx, network, address)
+	}
+	t.RegisterProtocol("ftp", guard(&FTPTransport{Dial: dial}))
+	t.RegisterProtocol("gemini", guard(&GeminiTransport{Dial: dial, Hosts: sharedKnownHosts()}))
+	t.RegisterProtocol("gopher", guard(&GopherTransport{Dial: dial}))
+	t.RegisterProtocol("ipfs", guard(sharedIPFSTransport()))
+	t.RegisterProtocol("ipns", guard(sharedIPFSTransport()))
+	if root := FileRoot(); root != "" {
+		t.RegisterProtocol("file", guard(http.NewFileTransport(http.Dir(root))))
+	}
+}
+
+// dialer returns dial, or a plain dialer when it is nil
+func dialer(dial DialFunc) DialFunc {
+	if dial != nil {
+		return dial
+	}
+	return (&net.Dialer{Timeout: 30 * time.Second}).DialContext
+}
+
+// FileRoot returns the operator-configured root for file:// URLs, or "" when
+// file access is disabled
+func FileRoot() string {
+	root := os.Getenv("FILE_SEED_ROOT")
+	if root == "" {
+		return ""
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return ""
+	}
+	return root
+}
+
+// Supported reports whether scheme can be fetched by this deployment
+func Supported(scheme string) bool {
+	switch scheme {
+	case "http", "https", "ftp", "gemini", "gopher", "ipfs", "ipns":
+		return true
+	case "file":
+		return FileRoot() != ""
+	}
+	return false
+}
+
+// listingEntry is a directory entry rendered into an HTML listing
+type listingEntry struct {
+	Name  string
+	IsDir bool
+}
+
+// renderListing renders a directory listing as HTML so the regular
+// extraction and link-following pipeline can walk it
+func renderListing(title string, entries []listingEntry) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<html><head><title>%s</title></head><body><h1>%s</h1><ul>\n",
+		html.EscapeString(title), html.EscapeString(title))
+	for _, e := range entries {
+		name := e.Name
+		if e.IsDir {
+			name += "/"
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n",
+			html.EscapeString(pathEscape(name)), html.EscapeString(name))
+	}
+	b.WriteString("</ul></body></html>\n")
+	return b.Bytes()
+}
+
+// pathEscape escapes an entry name as a relative link
+func pathEscape(name string) string {
+	return "./" + (&url.URL{Path: name}).EscapedPath()
+}
+
+// newResponse builds a synthetic HTTP response for a non-HTTP fetch
+func newResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// contentTypeFor guesses a file's content type from its name and content
+func contentTypeFor(name string, data []byte) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
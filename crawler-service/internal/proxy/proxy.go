@@ -0,0 +1,350 @@
+// Package proxy rotates crawl traffic over a pool of HTTP and SOCKS5
+// proxies, taking proxies that time out or get banned out of rotation and
+// putting them back once a health check gets through them again.
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// deadAfter is how many failures in a row take a proxy out of
+	// rotation
+	deadAfter = 3
+	// checkTimeout bounds a health check request
+	checkTimeout = 10 * time.Second
+	// defaultCheckURL is requested through dead proxies to see whether
+	// they work again
+	defaultCheckURL = "https://www.gstatic.com/generate_204"
+)
+
+// ErrNoProxies is returned for requests made while every proxy of the pool
+// is out of rotation. They are refused rather than sent without a proxy.
+var ErrNoProxies = errors.New("no live proxy in the pool")
+
+// Kinds of proxy failure
+const (
+	failureConnect = "connect"
+	failureTimeout = "timeout"
+	failureBanned  = "banned"
+)
+
+// Stats describes how one proxy of the pool has been doing
+type Stats struct {
+	Proxy               string     `json:"proxy"`
+	Alive               bool       `json:"alive"`
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	Timeouts            int64      `json:"timeouts"`
+	Bans                int64      `json:"bans"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	AvgLatencyMs        int64      `json:"avg_latency_ms"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastUsedAt          *time.Time `json:"last_used_at,omitempty"`
+	RemovedAt           *time.Time `json:"removed_at,omitempty"`
+	LastCheckedAt       *time.Time `json:"last_checked_at,omitempty"`
+}
+
+type entry struct {
+	url *url.URL
+
+	mu          sync.Mutex
+	requests    int64
+	failures    int64
+	timeouts    int64
+	bans        int64
+	consecutive int
+	latency     time.Duration
+	lastError   string
+	lastUsed    time.Time
+	removed     time.Time
+	lastChecked time.Time
+}
+
+// Pool is the deployment's proxy pool
+type Pool struct {
+	proxies  []*entry
+	next     uint32
+	checkURL string
+}
+
+// NewPoolFromEnv loads the proxies listed in PROXY_LIST, separated by
+// commas or spaces, and in the file PROXY_FILE, one per line with #
+// comments. Dead proxies are checked by requesting PROXY_CHECK_URL. Without
+// proxies the pool is empty and crawls use the deployment's own egress. On
+// a configuration error the pool is empty, alongside the error.
+func NewPoolFromEnv() (*Pool, error) {
+	empty := &Pool{}
+	raw := strings.FieldsFunc(os.Getenv("PROXY_LIST"), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	if path := os.Getenv("PROXY_FILE"); path != "" {
+		listed, err := readFile(path)
+		if err != nil {
+			return empty, err
+		}
+		raw = append(raw, listed...)
+	}
+
+	p := &Pool{checkURL: os.Getenv("PROXY_CHECK_URL")}
+	if p.checkURL == "" {
+		p.checkURL = defaultCheckURL
+	}
+	seen := make(map[string]bool)
+	for _, r := range raw {
+		u, err := url.Parse(r)
+		if err != nil || u.Host == "" {
+			return empty, fmt.Errorf("invalid proxy URL %q", redact(r))
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return empty, fmt.Errorf("proxy %s must be http, https or socks5", u.Redacted())
+		}
+		if seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		p.proxies = append(p.proxies, &entry{url: u})
+	}
+	return p, nil
+}
+
+func readFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var listed []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		listed = append(listed, line)
+	}
+	return listed, scanner.Err()
+}
+
+// redact hides the credentials of a proxy URL that did not parse
+func redact(raw string) string {
+	if i := strings.LastIndex(raw, "@"); i >= 0 {
+		return "…" + raw[i:]
+	}
+	return raw
+}
+
+// Enabled reports whether the pool has proxies
+func (p *Pool) Enabled() bool {
+	return len(p.proxies) > 0
+}
+
+// Transport sends the requests of next through the pool's live proxies, in
+// turn. The transports under next must take their proxy from FromContext.
+// Without proxies next is returned as is.
+func (p *Pool) Transport(next http.RoundTripper) http.RoundTripper {
+	if !p.Enabled() {
+		return next
+	}
+	return &transport{next: next, pool: p}
+}
+
+// Stats reports on every proxy of the pool, in configured order
+func (p *Pool) Stats() []Stats {
+	stats := make([]Stats, 0, len(p.proxies))
+	for _, e := range p.proxies {
+		stats = append(stats, e.stats())
+	}
+	return stats
+}
+
+// Watch checks the dead proxies every interval until ctx is done, putting
+// those that answer back into rotation
+func (p *Pool) Watch(ctx context.Context, interval time.Duration) {
+	if !p.Enabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.checkDead(ctx)
+			}
+		}
+	}()
+}
+
+func (p *Pool) checkDead(ctx context.Context) {
+	for _, e := range p.proxies {
+		if !e.dead() {
+			continue
+		}
+		ok := p.check(ctx, e.url)
+
+		e.mu.Lock()
+		e.lastChecked = time.Now()
+		if ok {
+			e.consecutive = 0
+			e.removed = time.Time{}
+		}
+		e.mu.Unlock()
+	}
+}
+
+// check reports whether the check URL answers through a proxy without
+// being refused
+func (p *Pool) check(ctx context.Context, proxyURL *url.URL) bool {
+	client := &http.Client{
+		Timeout:   checkTimeout,
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.checkURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusBadRequest
+}
+
+type proxyKey struct{}
+
+// FromContext returns the proxy the pool chose for a request, or nil
+func FromContext(ctx context.Context) *url.URL {
+	u, _ := ctx.Value(proxyKey{}).(*url.URL)
+	return u
+}
+
+type transport struct {
+	next http.RoundTripper
+	pool *Pool
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := t.pool.pick()
+	if e == nil {
+		return nil, ErrNoProxies
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyKey{}, e.url)))
+	e.record(time.Since(start), resp, err)
+	return resp, err
+}
+
+// pick returns the next live proxy in turn, or nil if all are dead
+func (p *Pool) pick() *entry {
+	n := uint32(len(p.proxies))
+	start := atomic.AddUint32(&p.next, 1) - 1
+	for i := uint32(0); i < n; i++ {
+		if e := p.proxies[(start+i)%n]; !e.dead() {
+			return e
+		}
+	}
+	return nil
+}
+
+// failure classifies a request sent through a proxy: failing to reach the
+// proxy, timing out or being refused with 403 count against the proxy
+func failure(resp *http.Response, err error) (string, string) {
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "proxyconnect":
+		return failureConnect, opErr.Error()
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return failureTimeout, err.Error()
+	case err == nil && resp.StatusCode == http.StatusProxyAuthRequired:
+		return failureConnect, resp.Status
+	case err == nil && resp.StatusCode == http.StatusForbidden:
+		return failureBanned, resp.Status
+	}
+	return "", ""
+}
+
+func (e *entry) record(took time.Duration, resp *http.Response, err error) {
+	kind, reason := failure(resp, err)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests++
+	e.lastUsed = time.Now()
+	if kind == "" {
+		e.consecutive = 0
+		e.latency += took
+		return
+	}
+	e.failures++
+	switch kind {
+	case failureTimeout:
+		e.timeouts++
+	case failureBanned:
+		e.bans++
+	}
+	e.consecutive++
+	e.lastError = reason
+	if e.consecutive >= deadAfter && e.removed.IsZero() {
+		e.removed = time.Now()
+	}
+}
+
+func (e *entry) dead() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !e.removed.IsZero()
+}
+
+func (e *entry) stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := Stats{
+		Proxy:               e.url.Redacted(),
+		Alive:               e.removed.IsZero(),
+		Requests:            e.requests,
+		Failures:            e.failures,
+		Timeouts:            e.timeouts,
+		Bans:                e.bans,
+		ConsecutiveFailures: e.consecutive,
+		LastError:           e.lastError,
+	}
+	if ok := e.requests - e.failures; ok > 0 {
+		s.AvgLatencyMs = (e.latency / time.Duration(ok)).Milliseconds()
+	}
+	s.LastUsedAt = timestamp(e.lastUsed)
+	s.RemovedAt = timestamp(e.removed)
+	s.LastCheckedAt = timestamp(e.lastChecked)
+	return s
+}
+
+// timestamp returns t in UTC, or nil if it is unset
+func timestamp(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
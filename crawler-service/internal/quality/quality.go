@@ -0,0 +1,113 @@
+package quality
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Score weights; they sum to 1
+const (
+	wordWeight        = 0.4
+	textRatioWeight   = 0.3
+	boilerplateWeight = 0.3
+)
+
+// Levels at which the word count and text-to-markup components are full
+const (
+	fullWords     = 300
+	fullTextRatio = 0.25
+)
+
+// boilerplateSelector matches page chrome whose text is not content
+const boilerplateSelector = "nav, header, footer, aside, form, [role=navigation], [role=banner], [role=contentinfo]"
+
+// boilerplateName matches class or id values of banners, menus and walls
+var boilerplateName = regexp.MustCompile(`(?i)cookie|consent|gdpr|banner|menu|sidebar|footer|navbar|breadcrumb|newsletter|subscribe|popup|modal`)
+
+// Assessment describes how much real content a page carries
+type Assessment struct {
+	// Score runs from 0 (no content) to 1 (substantial, content-dense page)
+	Score     float64 `json:"score"`
+	WordCount int     `json:"word_count"`
+	// TextRatio is the share of the HTML that is visible text
+	TextRatio float64 `json:"text_ratio"`
+	// Boilerplate is the share of the visible text that is navigation,
+	// banners, cookie notices or link lists
+	Boilerplate float64 `json:"boilerplate"`
+}
+
+// Assess scores a page from its parsed document and raw HTML. Four tenths
+// of the score come from the word count, three from the text-to-markup
+// ratio and three from how little of the text is boilerplate.
+func Assess(doc *goquery.Selection, html []byte) Assessment {
+	body := doc.Find("body").First()
+	if body.Length() == 0 {
+		body = doc.First()
+	}
+	body = body.Clone()
+	body.Find("script, style, noscript, template, svg").Remove()
+
+	text := visible(body)
+	a := Assessment{WordCount: len(strings.Fields(text))}
+	if len(html) > 0 {
+		a.TextRatio = math.Min(1, float64(len(text))/float64(len(html)))
+	}
+
+	if len(text) > 0 {
+		boilerplate := 0
+		strip := func(s *goquery.Selection) {
+			// Skip elements already removed along with a boilerplate parent
+			if attached(s, body) {
+				boilerplate += len(visible(s))
+				s.Remove()
+			}
+		}
+		body.Find(boilerplateSelector).Each(func(_ int, s *goquery.Selection) {
+			strip(s)
+		})
+		body.Find("[class], [id]").Each(func(_ int, s *goquery.Selection) {
+			if boilerplateName.MatchString(s.AttrOr("class", "") + " " + s.AttrOr("id", "")) {
+				strip(s)
+			}
+		})
+		// Links left in the content still count as boilerplate: link lists
+		// and tag clouds are navigation by another name
+		body.Find("a").Each(func(_ int, s *goquery.Selection) {
+			boilerplate += len(visible(s))
+		})
+		a.Boilerplate = math.Min(1, float64(boilerplate)/float64(len(text)))
+	}
+
+	score := wordWeight*math.Min(1, float64(a.WordCount)/fullWords) +
+		textRatioWeight*math.Min(1, a.TextRatio/fullTextRatio) +
+		boilerplateWeight*(1-a.Boilerplate)
+	if a.WordCount == 0 {
+		score = 0
+	}
+	a.Score = round(score)
+	a.TextRatio = round(a.TextRatio)
+	a.Boilerplate = round(a.Boilerplate)
+	return a
+}
+
+// attached reports whether s is still inside root
+func attached(s, root *goquery.Selection) bool {
+	for n := s.Get(0); n != nil; n = n.Parent {
+		if n == root.Get(0) {
+			return true
+		}
+	}
+	return false
+}
+
+// visible returns the whitespace-normalised text of a selection
+func visible(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
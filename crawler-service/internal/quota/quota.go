@@ -0,0 +1,237 @@
+package quota
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// usagePrefix keys each tenant's stored bytes in Redis
+const usagePrefix = "quota:usage:"
+
+// Quota modes
+const (
+	ModeTruncate = "truncate"
+	ModeReject   = "reject"
+)
+
+// Quota outcomes recorded on a job
+const (
+	StatusTruncated = "truncated"
+	StatusRejected  = "rejected"
+)
+
+// Tracker accounts stored content bytes per tenant and enforces job and
+// tenant storage quotas. Usage is kept in Redis when connected, so every
+// instance shares it, else in memory.
+type Tracker struct {
+	mu          sync.Mutex
+	usage       map[string]int64
+	jobLimit    int64
+	tenantLimit int64
+	mode        string
+}
+
+// NewTrackerFromEnv creates a tracker configured from JOB_STORAGE_QUOTA_BYTES,
+// TENANT_STORAGE_QUOTA_BYTES and STORAGE_QUOTA_MODE. A limit of 0 disables
+// that quota.
+func NewTrackerFromEnv() *Tracker {
+	mode := os.Getenv("STORAGE_QUOTA_MODE")
+	if mode != ModeReject {
+		mode = ModeTruncate
+	}
+
+	return &Tracker{
+		usage:       make(map[string]int64),
+		jobLimit:    envInt64("JOB_STORAGE_QUOTA_BYTES", 50<<20),
+		tenantLimit: envInt64("TENANT_STORAGE_QUOTA_BYTES", 0),
+		mode:        mode,
+	}
+}
+
+func envInt64(key string, def int64) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
+
+// Mode returns the configured quota mode
+func (t *Tracker) Mode() string {
+	return t.mode
+}
+
+// JobLimit returns the effective quota for a job, honouring a smaller
+// per-request limit
+func (t *Tracker) JobLimit(requested int64) int64 {
+	if requested > 0 && (t.jobLimit == 0 || requested < t.jobLimit) {
+		return requested
+	}
+	return t.jobLimit
+}
+
+// TenantLimit returns the tenant quota (0 means unlimited)
+func (t *Tracker) TenantLimit() int64 {
+	return t.tenantLimit
+}
+
+// Rebuild accounts the content the stored jobs hold, as a restarted
+// service finds them. Tenants whose usage Redis already keeps are left
+// alone: the instances sharing it have kept it current.
+func (t *Tracker) Rebuild(jobs []*models.CrawlJob) {
+	usage := make(map[string]int64)
+	for _, job := range jobs {
+		if job.StorageBytes > 0 {
+			usage[job.Tenant] += job.StorageBytes
+		}
+	}
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		pipe := rdb.Pipeline()
+		for tenant, bytes := range usage {
+			pipe.SetNX(ctx, usagePrefix+tenant, bytes, 0)
+		}
+		_, err := pipe.Exec(ctx)
+		if err == nil {
+			return
+		}
+		log.WithError(err).Warn("Failed to seed storage usage in Redis, keeping it locally")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage = usage
+}
+
+// TenantUsage returns the bytes currently stored for a tenant
+func (t *Tracker) TenantUsage(tenant string) int64 {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		n, err := rdb.Get(context.Background(), usagePrefix+tenant).Int64()
+		if err == nil {
+			return n
+		}
+		if err == redis.Nil {
+			return 0
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.usage[tenant]
+}
+
+// TenantExceeded reports whether a tenant has used up its quota
+func (t *Tracker) TenantExceeded(tenant string) bool {
+	return t.tenantLimit > 0 && t.TenantUsage(tenant) >= t.tenantLimit
+}
+
+// Reserve accounts size bytes for a job and its tenant. It returns the number
+// of bytes that fit within both quotas; a value below size means the quota was
+// hit and the caller must truncate or reject the result.
+func (t *Tracker) Reserve(tenant string, jobUsed, jobLimit, size int64) int64 {
+	allowed := size
+	if jobLimit > 0 && jobUsed+allowed > jobLimit {
+		allowed = jobLimit - jobUsed
+	}
+	if allowed < 0 {
+		allowed = 0
+	}
+	if allowed < size && t.mode == ModeReject {
+		return 0
+	}
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		key := usagePrefix + tenant
+		used, err := rdb.IncrBy(ctx, key, allowed).Result()
+		if err == nil {
+			// Hand back what went past the tenant quota, all of it when
+			// results past it are rejected
+			if over := used - t.tenantLimit; t.tenantLimit > 0 && over > 0 {
+				back := min(over, allowed)
+				if t.mode == ModeReject {
+					back = allowed
+				}
+				rdb.DecrBy(ctx, key, back)
+				allowed -= back
+			}
+			return allowed
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to account storage usage in Redis, keeping it locally")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tenantLimit > 0 && t.usage[tenant]+allowed > t.tenantLimit {
+		allowed = t.tenantLimit - t.usage[tenant]
+	}
+	if allowed < 0 {
+		allowed = 0
+	}
+	if allowed < size && t.mode == ModeReject {
+		return 0
+	}
+
+	t.usage[tenant] += allowed
+	return allowed
+}
+
+// Release returns bytes to a tenant, e.g. when stored results are deleted
+func (t *Tracker) Release(tenant string, size int64) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		used, err := rdb.DecrBy(ctx, usagePrefix+tenant, size).Result()
+		if err == nil {
+			if used <= 0 {
+				rdb.Del(ctx, usagePrefix+tenant)
+			}
+			return
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to release storage usage in Redis, keeping it locally")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.usage[tenant] -= size
+	if t.usage[tenant] <= 0 {
+		delete(t.usage, tenant)
+	}
+}
+
+// ResultSize estimates the stored size of a result in bytes
+func ResultSize(r models.CrawlResult) int64 {
+	size := len(r.URL) + len(r.Title) + len(r.Content) + len(r.Error)
+	for _, link := range r.Links {
+		size += len(link.URL) + len(link.Text) + len(link.Rel)
+	}
+	return int64(size)
+}
+
+// TruncateResult shrinks the result's content so that it fits in limit bytes
+func TruncateResult(r *models.CrawlResult, limit int64) {
+	overhead := ResultSize(*r) - int64(len(r.Content))
+	keep := limit - overhead
+	if keep <= 0 {
+		r.Content = ""
+		return
+	}
+	if int64(len(r.Content)) <= keep {
+		return
+	}
+
+	content := r.Content[:keep]
+	for len(content) > 0 && !utf8.ValidString(content) {
+		content = content[:len(content)-1]
+	}
+	r.Content = content
+}
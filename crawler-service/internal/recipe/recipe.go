@@ -0,0 +1,139 @@
+// Package recipe reads structured fields, such as a price, author or date,
+// from pages with CSS selector rules ("scrape recipes"), for sites whose
+// layout is known in advance. A rule is a selector, optionally followed by
+// @attribute to read an attribute of the first match instead of its text:
+// ".price", "time.published@datetime", "meta[name=author]@content".
+package recipe
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// maxFieldLength bounds the length of an extracted value
+const maxFieldLength = 10000
+
+// attrSuffix is an @attribute suffix of a rule
+var attrSuffix = regexp.MustCompile(`@([A-Za-z_:][A-Za-z0-9_:.-]*)$`)
+
+// urlAttributes hold URLs, which are resolved against the page's
+var urlAttributes = map[string]bool{"href": true, "src": true, "action": true, "poster": true, "data-src": true}
+
+// Rule is a parsed extraction rule
+type Rule struct {
+	Selector  string
+	Attribute string
+}
+
+// Parse parses a rule
+func Parse(spec string) (Rule, error) {
+	spec = strings.TrimSpace(spec)
+	var rule Rule
+	if m := attrSuffix.FindStringSubmatchIndex(spec); m != nil {
+		rule.Attribute = strings.ToLower(spec[m[2]:m[3]])
+		spec = strings.TrimSpace(spec[:m[0]])
+	}
+	if spec == "" {
+		return Rule{}, fmt.Errorf("extraction rule needs a selector")
+	}
+	if _, err := cascadia.Compile(spec); err != nil {
+		return Rule{}, fmt.Errorf("invalid selector %q: %w", spec, err)
+	}
+	rule.Selector = spec
+	return rule, nil
+}
+
+// Validate checks a job's rules and its per-domain rule sets
+func Validate(rules map[string]string, byDomain map[string]map[string]string) error {
+	if err := validateSet(rules); err != nil {
+		return err
+	}
+	for domain, set := range byDomain {
+		if domain == "" || strings.ContainsAny(domain, "/:*") {
+			return fmt.Errorf("extraction rules domain %q must be a host name", domain)
+		}
+		if err := validateSet(set); err != nil {
+			return fmt.Errorf("domain %s: %w", domain, err)
+		}
+	}
+	return nil
+}
+
+func validateSet(rules map[string]string) error {
+	for field, spec := range rules {
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("extraction rules need field names")
+		}
+		if _, err := Parse(spec); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// ForHost returns the rules that apply to a host: the job's rules, with
+// those of the most specific domain set covering the host taking
+// precedence field by field. A domain covers its subdomains.
+func ForHost(rules map[string]string, byDomain map[string]map[string]string, host string) map[string]string {
+	host = strings.ToLower(strings.TrimPrefix(host, "www."))
+	best := ""
+	for domain := range byDomain {
+		d := strings.ToLower(strings.TrimPrefix(domain, "www."))
+		if (host == d || strings.HasSuffix(host, "."+d)) && len(domain) > len(best) {
+			best = domain
+		}
+	}
+	if best == "" {
+		return rules
+	}
+
+	merged := make(map[string]string, len(rules)+len(byDomain[best]))
+	for field, spec := range rules {
+		merged[field] = spec
+	}
+	for field, spec := range byDomain[best] {
+		merged[field] = spec
+	}
+	return merged
+}
+
+// Extract applies rules to a page. Fields whose selector matches nothing,
+// or whose value is empty, are left out.
+func Extract(doc *goquery.Selection, pageURL *url.URL, rules map[string]string) map[string]string {
+	fields := make(map[string]string)
+	for field, spec := range rules {
+		rule, err := Parse(spec)
+		if err != nil {
+			continue
+		}
+		match := doc.Find(rule.Selector).First()
+		if match.Length() == 0 {
+			continue
+		}
+
+		var value string
+		if rule.Attribute == "" {
+			value = strings.Join(strings.Fields(match.Text()), " ")
+		} else {
+			value = strings.TrimSpace(match.AttrOr(rule.Attribute, ""))
+			if urlAttributes[rule.Attribute] && value != "" && pageURL != nil {
+				if u, err := pageURL.Parse(value); err == nil {
+					value = u.String()
+				}
+			}
+		}
+		if value == "" {
+			continue
+		}
+		if len(value) > maxFieldLength {
+			value = strings.ToValidUTF8(value[:maxFieldLength], "")
+		}
+		fields[field] = value
+	}
+	return fields
+}
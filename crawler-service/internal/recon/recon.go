@@ -0,0 +1,163 @@
+package recon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// How a platform signals that a profile does not exist
+const (
+	ErrorStatusCode = "status_code" // any non-2xx status
+	ErrorMessage    = "message"     // the page contains ErrorMessage
+	ErrorRedirect   = "redirect"    // the profile URL redirects elsewhere
+)
+
+// maxProfileBytes caps the profile page read per probe
+const maxProfileBytes = 2 << 20
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Platform describes where a platform serves user profiles
+type Platform struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"` // profile URL with {} for the username
+	ErrorType    string `json:"error_type"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// Profile is the outcome of probing one platform
+type Profile struct {
+	Platform string
+	URL      string
+	Exists   bool
+	Title    string
+	Avatar   string
+	Status   int
+	Body     []byte
+	Err      error
+}
+
+// defaultCatalog is used unless USERNAME_CATALOG names a JSON catalog file
+var defaultCatalog = []Platform{
+	{Name: "github", URL: "https://github.com/{}", ErrorType: ErrorStatusCode},
+	{Name: "gitlab", URL: "https://gitlab.com/{}", ErrorType: ErrorStatusCode},
+	{Name: "reddit", URL: "https://old.reddit.com/user/{}", ErrorType: ErrorStatusCode},
+	{Name: "keybase", URL: "https://keybase.io/{}", ErrorType: ErrorStatusCode},
+	{Name: "hackernews", URL: "https://news.ycombinator.com/user?id={}", ErrorType: ErrorMessage, ErrorMessage: "No such user."},
+	{Name: "devto", URL: "https://dev.to/{}", ErrorType: ErrorStatusCode},
+	{Name: "medium", URL: "https://medium.com/@{}", ErrorType: ErrorStatusCode},
+	{Name: "steam", URL: "https://steamcommunity.com/id/{}", ErrorType: ErrorMessage, ErrorMessage: "The specified profile could not be found."},
+	{Name: "pastebin", URL: "https://pastebin.com/u/{}", ErrorType: ErrorStatusCode},
+	{Name: "pypi", URL: "https://pypi.org/user/{}/", ErrorType: ErrorStatusCode},
+	{Name: "npm", URL: "https://www.npmjs.com/~{}", ErrorType: ErrorStatusCode},
+	{Name: "mastodon", URL: "https://mastodon.social/@{}", ErrorType: ErrorStatusCode},
+	{Name: "soundcloud", URL: "https://soundcloud.com/{}", ErrorType: ErrorStatusCode},
+	{Name: "gravatar", URL: "https://en.gravatar.com/{}", ErrorType: ErrorStatusCode},
+}
+
+// Catalog returns the configured platform catalog
+func Catalog() ([]Platform, error) {
+	path := os.Getenv("USERNAME_CATALOG")
+	if path == "" {
+		return defaultCatalog, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read username catalog: %w", err)
+	}
+	var catalog []Platform
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("invalid username catalog: %w", err)
+	}
+	return catalog, nil
+}
+
+// ValidUsername reports whether name is safe to substitute into URLs
+func ValidUsername(name string) bool {
+	return usernamePattern.MatchString(name)
+}
+
+// Probe checks every platform for username with at most concurrency
+// requests in flight, calling found for each probed platform
+func Probe(ctx context.Context, client *http.Client, userAgent, username string, catalog []Platform, concurrency int, found func(Profile)) {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for _, p := range catalog {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(p Platform) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			found(probe(ctx, client, userAgent, username, p))
+		}(p)
+	}
+	wg.Wait()
+}
+
+func probe(ctx context.Context, client *http.Client, userAgent, username string, p Platform) Profile {
+	profile := Profile{
+		Platform: p.Name,
+		URL:      strings.ReplaceAll(p.URL, "{}", username),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, profile.URL, nil)
+	if err != nil {
+		profile.Err = err
+		return profile
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	c := *client
+	if p.ErrorType == ErrorRedirect {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		profile.Err = err
+		return profile
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProfileBytes))
+	if err != nil {
+		profile.Err = err
+		return profile
+	}
+	profile.Status = resp.StatusCode
+
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+	switch p.ErrorType {
+	case ErrorMessage:
+		profile.Exists = ok && !bytes.Contains(body, []byte(p.ErrorMessage))
+	default:
+		profile.Exists = ok
+	}
+	if !profile.Exists {
+		return profile
+	}
+
+	profile.Body = body
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+		profile.Title = strings.TrimSpace(doc.Find("title").First().Text())
+		profile.Avatar, _ = doc.Find(`meta[property="og:image"]`).Attr("content")
+		if profile.Avatar != "" {
+			if u, err := resp.Request.URL.Parse(profile.Avatar); err == nil {
+				profile.Avatar = u.String()
+			}
+		}
+	}
+	return profile
+}
@@ -0,0 +1,311 @@
+// Package region routes crawl traffic through egress pools in other
+// regions, so content that varies by where it is requested from is crawled
+// from the right place, and tracks how healthy each pool is.
+package region
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// unhealthyAfter is how many proxy failures in a row take a proxy out
+	// of rotation
+	unhealthyAfter = 3
+	// retryAfter is how long an unhealthy proxy is left out before it is
+	// tried again
+	retryAfter = time.Minute
+)
+
+// Pool is a region's egress: the proxies its requests go through and the
+// top-level domains routed to it when a job names no region
+type Pool struct {
+	Name    string   `json:"name"`
+	Proxies []string `json:"proxies"`
+	// TLDs are domain suffixes such as "de" or "co.uk"
+	TLDs []string `json:"tlds"`
+}
+
+// ProxyHealth describes how one proxy of a region has been doing
+type ProxyHealth struct {
+	Proxy               string     `json:"proxy"`
+	Healthy             bool       `json:"healthy"`
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	AvgLatencyMs        int64      `json:"avg_latency_ms"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+}
+
+// Health describes a region; it is healthy while any of its proxies is
+type Health struct {
+	Region  string        `json:"region"`
+	Healthy bool          `json:"healthy"`
+	TLDs    []string      `json:"tlds"`
+	Proxies []ProxyHealth `json:"proxies"`
+}
+
+type pool struct {
+	name    string
+	tlds    []string
+	proxies []*proxy
+	next    uint32
+}
+
+type proxy struct {
+	url *url.URL
+
+	mu          sync.Mutex
+	requests    int64
+	failures    int64
+	consecutive int
+	latency     time.Duration
+	lastError   string
+	lastFailure time.Time
+}
+
+// Registry holds the regions jobs can be routed to
+type Registry struct {
+	pools map[string]*pool
+	tlds  map[string]string
+}
+
+// NewRegistryFromEnv loads regions from the JSON array file
+// CRAWL_REGIONS_FILE. Without it no regions are offered and every job
+// uses the deployment's own egress. On a configuration error no regions
+// are offered, alongside the error.
+func NewRegistryFromEnv() (*Registry, error) {
+	r := &Registry{pools: make(map[string]*pool), tlds: make(map[string]string)}
+	path := os.Getenv("CRAWL_REGIONS_FILE")
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	var defined []Pool
+	if err := json.Unmarshal(data, &defined); err != nil {
+		return r, fmt.Errorf("invalid regions: %w", err)
+	}
+
+	configured := &Registry{pools: make(map[string]*pool), tlds: make(map[string]string)}
+	for _, def := range defined {
+		if err := configured.add(def); err != nil {
+			return r, err
+		}
+	}
+	return configured, nil
+}
+
+func (r *Registry) add(def Pool) error {
+	name := strings.ToLower(strings.TrimSpace(def.Name))
+	if name == "" {
+		return errors.New("regions need a name")
+	}
+	if _, exists := r.pools[name]; exists {
+		return fmt.Errorf("region %q is defined twice", name)
+	}
+	if len(def.Proxies) == 0 {
+		return fmt.Errorf("region %q has no proxies", name)
+	}
+
+	p := &pool{name: name}
+	for _, raw := range def.Proxies {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("region %q has an invalid proxy URL", name)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("region %q proxies must be http, https or socks5", name)
+		}
+		p.proxies = append(p.proxies, &proxy{url: u})
+	}
+	for _, tld := range def.TLDs {
+		tld = strings.Trim(strings.ToLower(strings.TrimSpace(tld)), ".")
+		if tld == "" {
+			continue
+		}
+		if other, taken := r.tlds[tld]; taken {
+			return fmt.Errorf("top-level domain %q is routed to both %q and %q", tld, other, name)
+		}
+		r.tlds[tld] = name
+		p.tlds = append(p.tlds, tld)
+	}
+	sort.Strings(p.tlds)
+	r.pools[name] = p
+	return nil
+}
+
+// Names returns the names of the regions, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.pools))
+	for name := range r.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has reports whether a region is configured
+func (r *Registry) Has(name string) bool {
+	_, ok := r.pools[strings.ToLower(name)]
+	return ok
+}
+
+// ForURL returns the region whose top-level domains match the host of
+// rawURL most specifically, or "" if none does
+func (r *Registry) ForURL(rawURL string) string {
+	if len(r.tlds) == 0 {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), ".")
+	for i := 1; i < len(labels); i++ {
+		if name, ok := r.tlds[strings.Join(labels[i:], ".")]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Transport routes the requests of next through the proxies of the named
+// region, in turn, leaving out proxies that keep failing. The transports
+// under next must take their proxy from ProxyFromContext. Without a region
+// next is returned as is.
+func (r *Registry) Transport(name string, next http.RoundTripper) http.RoundTripper {
+	p, ok := r.pools[strings.ToLower(name)]
+	if !ok {
+		return next
+	}
+	return &transport{next: next, pool: p}
+}
+
+// Health reports on every region, sorted by name
+func (r *Registry) Health() []Health {
+	now := time.Now()
+	health := make([]Health, 0, len(r.pools))
+	for _, name := range r.Names() {
+		p := r.pools[name]
+		h := Health{Region: name, TLDs: p.tlds, Proxies: make([]ProxyHealth, 0, len(p.proxies))}
+		if h.TLDs == nil {
+			h.TLDs = []string{}
+		}
+		for _, px := range p.proxies {
+			ph := px.health(now)
+			h.Healthy = h.Healthy || ph.Healthy
+			h.Proxies = append(h.Proxies, ph)
+		}
+		health = append(health, h)
+	}
+	return health
+}
+
+type proxyKey struct{}
+
+// ProxyFromContext returns the proxy a region transport chose for a
+// request, or nil
+func ProxyFromContext(ctx context.Context) *url.URL {
+	u, _ := ctx.Value(proxyKey{}).(*url.URL)
+	return u
+}
+
+type transport struct {
+	next http.RoundTripper
+	pool *pool
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	px := t.pool.pick(time.Now())
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyKey{}, px.url)))
+	px.record(time.Since(start), resp, err)
+	return resp, err
+}
+
+// pick returns the next healthy proxy in turn, or the next proxy if none
+// is healthy
+func (p *pool) pick(now time.Time) *proxy {
+	n := uint32(len(p.proxies))
+	start := atomic.AddUint32(&p.next, 1) - 1
+	for i := uint32(0); i < n; i++ {
+		px := p.proxies[(start+i)%n]
+		if px.healthy(now) {
+			return px
+		}
+	}
+	return p.proxies[start%n]
+}
+
+// record counts a request sent through the proxy. Only failures of the
+// proxy itself count against it, not those of the site behind it.
+func (px *proxy) record(took time.Duration, resp *http.Response, err error) {
+	var failure string
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "proxyconnect":
+		failure = opErr.Error()
+	case err == nil && resp.StatusCode == http.StatusProxyAuthRequired:
+		failure = resp.Status
+	}
+
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	px.requests++
+	if failure == "" {
+		px.consecutive = 0
+		px.latency += took
+		return
+	}
+	px.failures++
+	px.consecutive++
+	px.lastError = failure
+	px.lastFailure = time.Now()
+}
+
+func (px *proxy) healthy(now time.Time) bool {
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	return px.consecutive < unhealthyAfter || now.Sub(px.lastFailure) >= retryAfter
+}
+
+func (px *proxy) health(now time.Time) ProxyHealth {
+	healthy := px.healthy(now)
+
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	h := ProxyHealth{
+		Proxy:               px.url.Redacted(),
+		Healthy:             healthy,
+		Requests:            px.requests,
+		Failures:            px.failures,
+		ConsecutiveFailures: px.consecutive,
+		LastError:           px.lastError,
+	}
+	if ok := px.requests - px.failures; ok > 0 {
+		h.AvgLatencyMs = (px.latency / time.Duration(ok)).Milliseconds()
+	}
+	if !px.lastFailure.IsZero() {
+		at := px.lastFailure.UTC()
+		h.LastFailureAt = &at
+	}
+	return h
+}
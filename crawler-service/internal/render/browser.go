@@ -0,0 +1,122 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cdpbrowser "github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// startTimeout bounds how long a starting browser has to answer
+	startTimeout = 30 * time.Second
+	// closeTimeout bounds how long a closing browser has to exit before it
+	// is killed
+	closeTimeout = 5 * time.Second
+)
+
+// browser is a headless Chrome process driven with chromedp. Pages
+// render in browser contexts of their own, which share nothing.
+type browser struct {
+	// ctx is the chromedp context of the browser, cancelled when it exits
+	ctx         context.Context
+	cancel      context.CancelFunc
+	cancelAlloc context.CancelFunc
+	log         *tailBuffer
+	// userAgent is the browser's own user agent
+	userAgent string
+}
+
+// launch starts a browser whose own connections go through the proxy at
+// proxyURL
+func (r *Renderer) launch(proxyURL string) (*browser, error) {
+	b := &browser{log: &tailBuffer{}}
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ExecPath(r.binary),
+		chromedp.Flag("headless", "new"),
+		chromedp.DisableGPU,
+		chromedp.Flag("disable-component-update", true),
+		chromedp.ProxyServer(proxyURL),
+		// Loopback addresses go through the proxy too, so the network
+		// policy decides whether they may be reached
+		chromedp.Flag("proxy-bypass-list", "<-loopback>"),
+		// chromedp turns the sandbox off for root unless told otherwise
+		chromedp.Flag("no-sandbox", r.noSandbox),
+		chromedp.CombinedOutput(b.log),
+		chromedp.WSURLReadTimeout(startTimeout),
+	)
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	b.ctx, b.cancel = chromedp.NewContext(allocCtx)
+	b.cancelAlloc = cancelAlloc
+
+	if err := chromedp.Run(b.ctx); err != nil {
+		b.close()
+		return nil, fmt.Errorf("browser did not start: %w: %s", err, b.log.lastLine())
+	}
+	ctx, cancel := context.WithTimeout(b.ctx, startTimeout)
+	defer cancel()
+	_, _, _, userAgent, _, err := cdpbrowser.GetVersion().Do(cdp.WithExecutor(ctx, chromedp.FromContext(b.ctx).Browser))
+	if err != nil {
+		b.close()
+		return nil, fmt.Errorf("browser did not start: %w: %s", err, b.log.lastLine())
+	}
+	b.userAgent = userAgent
+	return b, nil
+}
+
+// alive reports whether the browser is still running
+func (b *browser) alive() bool {
+	return b.ctx.Err() == nil
+}
+
+// close asks the browser to exit, and kills it if it has not shortly after
+func (b *browser) close() {
+	ctx, cancel := context.WithTimeout(b.ctx, closeTimeout)
+	chromedp.Cancel(ctx)
+	cancel()
+	b.cancel()
+	b.cancelAlloc()
+}
+
+// failure explains why a render failed, with the last line of the
+// browser's log when the browser exited
+func (b *browser) failure(err error) error {
+	if b.alive() || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("browser failed: %w: %s", err, b.log.lastLine())
+}
+
+// tailBuffer keeps the last few kilobytes of the browser's log
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+const maxLogBytes = 8 << 10
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf.Write(p)
+	if extra := t.buf.Len() - maxLogBytes; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+// lastLine returns the last non-empty line of the log, which usually says
+// why the browser failed
+func (t *tailBuffer) lastLine() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := strings.Split(strings.TrimSpace(t.buf.String()), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,96 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxCaptures bounds the responses captured from one page
+	maxCaptures = 100
+	// maxCaptureBytes bounds the body of a captured response; larger
+	// responses are not captured
+	maxCaptureBytes = 1 << 20
+)
+
+// Capture is a JSON response to an XHR or fetch request of a rendered page
+type Capture struct {
+	URL         string
+	Method      string
+	StatusCode  int
+	ContentType string
+	Body        string
+}
+
+// compileGlobs turns URL patterns into regular expressions matching whole
+// URLs. In a pattern * matches any run of characters, slashes included,
+// ? any one character, and [...] a character class, as in path.Match.
+func compileGlobs(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		var expr strings.Builder
+		expr.WriteString("^")
+		for i := 0; i < len(pattern); i++ {
+			switch c := pattern[i]; c {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			case '[':
+				end := strings.IndexByte(pattern[i+1:], ']')
+				if end < 0 {
+					expr.WriteString(regexp.QuoteMeta(pattern[i:]))
+					i = len(pattern)
+					continue
+				}
+				class := pattern[i+1 : i+1+end]
+				if strings.HasPrefix(class, "^") {
+					class = "^" + strings.ReplaceAll(class[1:], `\`, `\\`)
+				} else {
+					class = strings.ReplaceAll(class, `\`, `\\`)
+				}
+				expr.WriteString("[" + class + "]")
+				i += end + 1
+			case '\\':
+				if i+1 < len(pattern) {
+					i++
+				}
+				expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		expr.WriteString("$")
+		if re, err := regexp.Compile(expr.String()); err == nil {
+			compiled = append(compiled, re)
+		}
+	}
+	return compiled
+}
+
+// captures reports whether a response to a request of the page is kept:
+// an XHR or fetch request whose URL matches a capture pattern, answered
+// with JSON
+func (t *tab) captures(resourceType, requestURL, contentType string) bool {
+	if len(t.capture) == 0 || (resourceType != "XHR" && resourceType != "Fetch") {
+		return false
+	}
+	if !strings.Contains(strings.ToLower(contentType), "json") {
+		return false
+	}
+	for _, re := range t.capture {
+		if re.MatchString(requestURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// record keeps a captured response, up to maxCaptures per page
+func (t *tab) record(c Capture) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.captured) < maxCaptures {
+		t.captured = append(t.captured, c)
+	}
+}
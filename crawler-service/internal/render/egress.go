@@ -0,0 +1,122 @@
+package render
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DialFunc connects to a network address, as net.Dialer.DialContext does
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// egress is the proxy the browser is started with. Requests of rendered
+// pages are intercepted and made through the crawl's transport, so what
+// reaches the proxy is what the browser connects for itself, such as
+// WebSockets. The proxy dials it with the dial function it was given, under
+// the same network policy as the crawl.
+type egress struct {
+	listener  net.Listener
+	dial      DialFunc
+	transport *http.Transport
+}
+
+// newEgress starts the proxy on a loopback port
+func newEgress(dial DialFunc) (*egress, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	e := &egress{
+		listener: listener,
+		dial:     dial,
+		transport: &http.Transport{
+			DialContext:       dial,
+			DisableKeepAlives: true,
+		},
+	}
+	go http.Serve(listener, e)
+	return e, nil
+}
+
+// url returns the address the browser is pointed at
+func (e *egress) url() string {
+	return "http://" + e.listener.Addr().String()
+}
+
+func (e *egress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		e.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	out.Header.Del("Proxy-Authorization")
+	resp, err := e.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel connects a CONNECT request to its target and relays bytes both
+// ways until either side closes
+func (e *egress) tunnel(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	target, err := e.dial(ctx, "tcp", r.Host)
+	cancel()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		target.Close()
+		http.Error(w, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		target.Close()
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		target.Close()
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Bytes the client sent along with the CONNECT are already buffered
+		io.Copy(target, buffered)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, target)
+		done <- struct{}{}
+	}()
+	<-done
+	client.Close()
+	target.Close()
+	<-done
+}
+
+func (e *egress) close() error {
+	return e.listener.Close()
+}
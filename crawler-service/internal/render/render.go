@@ -0,0 +1,319 @@
+// Package render loads pages in headless Chrome, driven with chromedp, so
+// the content scripts add to them can be extracted. One browser runs per
+// renderer, started when it is first needed and restarted if it exits. Each
+// render runs in a browser context of its own, which shares no cookies or
+// storage with any other, and a pool bounds how many run at once. The browser never reaches the web
+// by itself: the requests of a page are made through the transport of the
+// crawl rendering it, and anything else it connects to goes through a local
+// proxy dialing under the crawler's network policy.
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultContexts = 2
+	maxContexts     = 32
+	defaultTimeout  = 30 * time.Second
+	// settleTime is how long scripts of a loaded page get to run before
+	// the DOM is read, unless the page goes quiet sooner
+	settleTime = 5 * time.Second
+	// maxDOMBytes bounds the rendered DOM read back from the browser
+	maxDOMBytes = 20 << 20
+	// screenshotWidth is the width of the window screenshots are taken in
+	screenshotWidth         = 1366
+	defaultScreenshotHeight = 4096
+	maxScreenshotHeight     = 16384
+)
+
+// ErrTimeout is returned for pages that did not render in time
+var ErrTimeout = errors.New("page did not render in time")
+
+// Renderer renders pages in headless Chrome
+type Renderer struct {
+	binary    string
+	noSandbox bool
+	timeout   time.Duration
+	// screenshotHeight is the height of the window pages are captured in;
+	// pages taller than it are cut off
+	screenshotHeight int
+	// contexts holds a token per browser context that may be open
+	contexts chan struct{}
+	// dial connects what the browser connects to by itself
+	dial DialFunc
+
+	mu      sync.Mutex
+	browser *browser
+	egress  *egress
+}
+
+// Access is how the pages of a render reach the web. Every request a page
+// makes goes through Transport, as the requests of the crawl rendering it
+// do, and is refused when Allow refuses its URL.
+type Access struct {
+	Transport http.RoundTripper
+	// Allow, when set, is asked before each request of the page
+	Allow func(ctx context.Context, u *url.URL) bool
+}
+
+// Page is a page to render
+type Page struct {
+	URL       string
+	UserAgent string
+	Access    Access
+	// Screenshot takes a screenshot of the page once it has settled
+	Screenshot bool
+	// CaptureNetwork lists URL patterns of the XHR and fetch requests whose
+	// JSON responses are kept; see compileGlobs
+	CaptureNetwork []string
+	// Scrolls is how many times the settled page is scrolled to the bottom,
+	// waiting ScrollInterval after each, so content loaded on scrolling is
+	// rendered. The render's timeout is extended by the time this may take.
+	Scrolls        int
+	ScrollInterval time.Duration
+	// Emulation, when set, is the device and locale the page sees
+	Emulation *Emulation
+}
+
+// Emulation is the device and locale a page is rendered as. Zero values
+// keep the browser's defaults.
+type Emulation struct {
+	Width, Height     int
+	DeviceScaleFactor float64
+	// Timezone is an IANA time zone name
+	Timezone string
+	// Language is a BCP 47 tag, reported as navigator.language and sent
+	// as Accept-Language
+	Language string
+}
+
+// Result is a rendered page
+type Result struct {
+	DOM []byte
+	// Screenshot is a PNG of the page, when one was asked for
+	Screenshot []byte
+	// Network holds the captured XHR and fetch responses, in the order they
+	// arrived
+	Network []Capture
+}
+
+// NewFromEnv returns a renderer running the Chrome or Chromium binary at
+// CHROME_PATH, with up to RENDER_CONTEXTS (default 2) pages rendering at
+// once and each given RENDER_TIMEOUT (default 30s). Screenshots capture
+// the top RENDER_SCREENSHOT_HEIGHT (default 4096) pixels of a page, 1366
+// wide. CHROME_NO_SANDBOX turns Chrome's sandbox off, which it needs to run
+// as root in containers.
+// What the browser connects to by itself, outside the requests of the pages
+// it renders, is dialed with dial.
+// Without CHROME_PATH rendering is disabled and the renderer is nil; on a
+// configuration error it is nil alongside the error.
+func NewFromEnv(dial DialFunc) (*Renderer, error) {
+	browser := os.Getenv("CHROME_PATH")
+	if browser == "" {
+		return nil, nil
+	}
+	path, err := exec.LookPath(browser)
+	if err != nil {
+		return nil, fmt.Errorf("browser %q not found: %w", browser, err)
+	}
+
+	contexts := defaultContexts
+	if raw := os.Getenv("RENDER_CONTEXTS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxContexts {
+			return nil, fmt.Errorf("RENDER_CONTEXTS must be 1-%d", maxContexts)
+		}
+		contexts = n
+	}
+	timeout := defaultTimeout
+	if raw := os.Getenv("RENDER_TIMEOUT"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= settleTime {
+			return nil, fmt.Errorf("RENDER_TIMEOUT must be a duration longer than %s", settleTime)
+		}
+		timeout = d
+	}
+	screenshotHeight := defaultScreenshotHeight
+	if raw := os.Getenv("RENDER_SCREENSHOT_HEIGHT"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxScreenshotHeight {
+			return nil, fmt.Errorf("RENDER_SCREENSHOT_HEIGHT must be 1-%d", maxScreenshotHeight)
+		}
+		screenshotHeight = n
+	}
+	noSandbox, _ := strconv.ParseBool(os.Getenv("CHROME_NO_SANDBOX"))
+
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second}).DialContext
+	}
+
+	return &Renderer{
+		binary:           path,
+		noSandbox:        noSandbox,
+		timeout:          timeout,
+		screenshotHeight: screenshotHeight,
+		contexts:         make(chan struct{}, contexts),
+		dial:             dial,
+	}, nil
+}
+
+// Contexts returns how many pages may render at once
+func (r *Renderer) Contexts() int {
+	return cap(r.contexts)
+}
+
+// Render loads a page in a browser context of its own and returns its DOM
+// once scripts have settled. It waits for a free context as long as ctx
+// allows; the render itself is bounded by the renderer's timeout.
+func (r *Renderer) Render(ctx context.Context, page Page) ([]byte, error) {
+	result, err := r.Load(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.DOM) == 0 {
+		return nil, errors.New("browser returned no DOM")
+	}
+	return result.DOM, nil
+}
+
+// Screenshot loads a page like Render and returns a PNG screenshot of it
+// once scripts have settled
+func (r *Renderer) Screenshot(ctx context.Context, page Page) ([]byte, error) {
+	page.Screenshot = true
+	result, err := r.Load(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Screenshot) == 0 {
+		return nil, errors.New("browser returned no screenshot")
+	}
+	return result.Screenshot, nil
+}
+
+// Load renders a page in a browser context of its own. It waits for a free
+// context as long as ctx allows; the render itself is bounded by the
+// renderer's timeout.
+func (r *Renderer) Load(ctx context.Context, page Page) (*Result, error) {
+	if page.Access.Transport == nil {
+		return nil, errors.New("render has no transport to fetch the page with")
+	}
+
+	select {
+	case r.contexts <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-r.contexts }()
+
+	b, err := r.running()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout+time.Duration(page.Scrolls)*page.ScrollInterval)
+	defer cancel()
+	result, err := r.load(ctx, b, page)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, ErrTimeout
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil:
+		return nil, b.failure(err)
+	}
+	return result, nil
+}
+
+func (r *Renderer) load(ctx context.Context, b *browser, page Page) (*Result, error) {
+	t, closeTab, err := b.open(ctx, page.Access)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTab()
+	t.capture = compileGlobs(page.CaptureNetwork)
+
+	var window [2]int
+	if page.Screenshot {
+		window = [2]int{screenshotWidth, r.screenshotHeight}
+	}
+	if err := t.prepare(page, window, b.userAgent); err != nil {
+		return nil, err
+	}
+	if err := t.navigate(page.URL); err != nil {
+		return nil, err
+	}
+	if err := t.settle(); err != nil {
+		return nil, err
+	}
+	if page.Scrolls > 0 {
+		if err := t.scroll(page.Scrolls, page.ScrollInterval); err != nil {
+			return nil, err
+		}
+		// Content loaded by the last scroll may still be arriving
+		if err := t.settle(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{}
+	if result.DOM, err = t.dom(); err != nil {
+		return nil, err
+	}
+	if page.Screenshot {
+		if result.Screenshot, err = t.screenshot(); err != nil {
+			return nil, err
+		}
+	}
+	t.mu.Lock()
+	result.Network = append([]Capture(nil), t.captured...)
+	t.mu.Unlock()
+	return result, nil
+}
+
+// running returns the renderer's browser, starting it, and the proxy it
+// connects through, if it is not running
+func (r *Renderer) running() (*browser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.browser != nil && r.browser.alive() {
+		return r.browser, nil
+	}
+	if r.egress == nil {
+		e, err := newEgress(r.dial)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start browser proxy: %w", err)
+		}
+		r.egress = e
+	}
+	b, err := r.launch(r.egress.url())
+	if err != nil {
+		return nil, err
+	}
+	r.browser = b
+	return b, nil
+}
+
+// Close stops the browser and its proxy. A later render starts them again.
+func (r *Renderer) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.browser != nil {
+		r.browser.close()
+		r.browser = nil
+	}
+	if r.egress != nil {
+		r.egress.close()
+		r.egress = nil
+	}
+}
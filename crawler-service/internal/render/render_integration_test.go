@@ -0,0 +1,107 @@
+//go:build integration
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixturePage builds its list from a JSON API once loaded, so only a
+// rendered DOM holds the items
+const fixturePage = `<!DOCTYPE html>
+<html><head><title>Fixture</title></head>
+<body>
+<ul id="items"></ul>
+<img src="/blocked.png">
+<script>
+fetch("/api/items").then(r => r.json()).then(items => {
+	for (const item of items) {
+		const li = document.createElement("li");
+		li.textContent = item.name;
+		document.getElementById("items").appendChild(li);
+	}
+	document.title = navigator.language;
+});
+</script>
+</body></html>`
+
+// TestRenderFixture renders a script-built page in the Chrome at
+// CHROME_PATH:
+//
+//	CHROME_PATH=chromium go test -tags integration ./internal/render
+func TestRenderFixture(t *testing.T) {
+	var blocked bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(fixturePage))
+	})
+	mux.HandleFunc("/api/items", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name": "Rendered item one"}, {"name": "Rendered item two"}]`))
+	})
+	mux.HandleFunc("/blocked.png", func(w http.ResponseWriter, r *http.Request) {
+		blocked = true
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	r, err := NewFromEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil {
+		t.Skip("CHROME_PATH is not set")
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := r.Load(ctx, Page{
+		URL: srv.URL + "/",
+		Access: Access{
+			Transport: http.DefaultTransport,
+			Allow: func(_ context.Context, u *url.URL) bool {
+				return u.Path != "/blocked.png"
+			},
+		},
+		Screenshot:     true,
+		CaptureNetwork: []string{"*/api/*"},
+		Emulation:      &Emulation{Width: 800, Height: 600, Language: "de-DE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dom := string(result.DOM)
+	for _, want := range []string{"<li>Rendered item one</li>", "<li>Rendered item two</li>", "<title>de-DE</title>"} {
+		if !strings.Contains(dom, want) {
+			t.Errorf("rendered DOM misses %q:\n%s", want, dom)
+		}
+	}
+	if blocked {
+		t.Error("a request Allow refused reached the server")
+	}
+	if len(result.Network) != 1 || result.Network[0].URL != srv.URL+"/api/items" || result.Network[0].StatusCode != http.StatusOK {
+		t.Errorf("captured %+v, want the /api/items response", result.Network)
+	}
+	if !bytes.HasPrefix(result.Screenshot, []byte("\x89PNG")) {
+		t.Error("screenshot is not a PNG")
+	}
+
+	// A second render runs in a fresh browser context of the same browser
+	dom2, err := r.Render(ctx, Page{URL: srv.URL + "/", Access: Access{Transport: http.DefaultTransport}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dom2), "Rendered item one") {
+		t.Error("second render misses the items")
+	}
+}
@@ -0,0 +1,338 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// idleTime is how long a loaded page makes no requests before it is
+	// taken to have settled
+	idleTime = 500 * time.Millisecond
+	// maxResourceBytes bounds each response handed to a rendered page
+	maxResourceBytes = 20 << 20
+)
+
+// tab is a page open in a browser context of its own
+type tab struct {
+	// ctx is the chromedp context of the page
+	ctx    context.Context
+	access Access
+	// capture matches the URLs of the XHR and fetch responses kept
+	capture []*regexp.Regexp
+
+	mu       sync.Mutex
+	inflight int
+	// active is when a request of the page last started or finished
+	active   time.Time
+	captured []Capture
+}
+
+// open opens a blank page in a new browser context, which is disposed of
+// with its cookies and storage when the returned cancel function is called
+// or ctx is done
+func (b *browser) open(ctx context.Context, access Access) (*tab, context.CancelFunc, error) {
+	tabCtx, cancel := chromedp.NewContext(b.ctx, chromedp.WithNewBrowserContext())
+	stop := context.AfterFunc(ctx, cancel)
+	closeTab := func() {
+		stop()
+		cancel()
+	}
+
+	t := &tab{ctx: tabCtx, access: access}
+	chromedp.ListenTarget(tabCtx, t.handle)
+	if err := chromedp.Run(tabCtx); err != nil {
+		closeTab()
+		return nil, nil, err
+	}
+	return t, closeTab, nil
+}
+
+// run runs actions on the page
+func (t *tab) run(actions ...chromedp.Action) error {
+	return chromedp.Run(t.ctx, actions...)
+}
+
+// prepare has every request of the page paused, to be made through the
+// page's transport, and sets the user agent, window size and emulated
+// device and locale. defaultUserAgent is sent when the page sets no user
+// agent but its language is emulated.
+func (t *tab) prepare(page Page, window [2]int, defaultUserAgent string) error {
+	actions := []chromedp.Action{
+		fetch.Enable().WithPatterns([]*fetch.RequestPattern{{URLPattern: "*", RequestStage: fetch.RequestStageRequest}}),
+		// Service workers would fetch outside the page's interception
+		network.SetBypassServiceWorker(true),
+	}
+
+	e := page.Emulation
+	if e == nil {
+		e = &Emulation{}
+	}
+	if page.UserAgent != "" || e.Language != "" {
+		userAgent := page.UserAgent
+		if userAgent == "" {
+			userAgent = defaultUserAgent
+		}
+		actions = append(actions, emulation.SetUserAgentOverride(userAgent).WithAcceptLanguage(e.Language))
+	}
+	if e.Language != "" {
+		actions = append(actions, emulation.SetLocaleOverride().WithLocale(e.Language))
+	}
+	if e.Timezone != "" {
+		actions = append(actions, emulation.SetTimezoneOverride(e.Timezone))
+	}
+
+	// An emulated viewport takes the place of the window screenshots are
+	// taken in
+	if e.Width > 0 {
+		window[0] = e.Width
+	}
+	if e.Height > 0 {
+		window[1] = e.Height
+	}
+	if window[0] > 0 || window[1] > 0 || e.DeviceScaleFactor > 0 {
+		actions = append(actions, emulation.SetDeviceMetricsOverride(int64(window[0]), int64(window[1]), e.DeviceScaleFactor, false))
+	}
+	return t.run(actions...)
+}
+
+// navigate loads the page's URL and waits for its load event
+func (t *tab) navigate(pageURL string) error {
+	if err := t.run(chromedp.Navigate(pageURL)); err != nil {
+		return fmt.Errorf("navigation failed: %w", err)
+	}
+	t.mu.Lock()
+	t.active = time.Now()
+	t.mu.Unlock()
+	return nil
+}
+
+// settle waits until the loaded page has made no requests for idleTime,
+// or for at most settleTime
+func (t *tab) settle() error {
+	deadline := time.Now().Add(settleTime)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		t.mu.Lock()
+		idle := t.inflight == 0 && time.Since(t.active) >= idleTime
+		t.mu.Unlock()
+		if idle || time.Now().After(deadline) {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-t.ctx.Done():
+			return t.ctx.Err()
+		}
+	}
+}
+
+// dom returns the page's DOM as HTML
+func (t *tab) dom() ([]byte, error) {
+	var dom string
+	if err := t.run(chromedp.Evaluate("document.documentElement ? document.documentElement.outerHTML : ''", &dom)); err != nil {
+		return nil, fmt.Errorf("failed to read DOM: %w", err)
+	}
+	if len(dom) > maxDOMBytes {
+		dom = dom[:maxDOMBytes]
+	}
+	return []byte(dom), nil
+}
+
+// scroll scrolls the page to the bottom up to times times, waiting interval
+// after each scroll for content to load, and stops early once a scroll no
+// longer makes the page taller or adds elements to it
+func (t *tab) scroll(times int, interval time.Duration) error {
+	const measure = "[document.documentElement ? document.documentElement.scrollHeight : 0, document.getElementsByTagName('*').length]"
+	var before [2]int
+	if err := t.run(chromedp.Evaluate(measure, &before)); err != nil {
+		return fmt.Errorf("failed to measure page: %w", err)
+	}
+	for i := 0; i < times; i++ {
+		var after [2]int
+		err := t.run(
+			chromedp.Evaluate("window.scrollTo(0, document.documentElement ? document.documentElement.scrollHeight : 0)", nil),
+			chromedp.Sleep(interval),
+			chromedp.Evaluate(measure, &after),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scroll page: %w", err)
+		}
+		if after == before {
+			return nil
+		}
+		before = after
+	}
+	return nil
+}
+
+// screenshot returns a PNG of the page's window
+func (t *tab) screenshot() ([]byte, error) {
+	var shot []byte
+	if err := t.run(chromedp.CaptureScreenshot(&shot)); err != nil {
+		return nil, err
+	}
+	return shot, nil
+}
+
+// handle is called with each event of the page; paused requests are made
+// through the page's transport. Events are handled in the order they
+// arrive, so handle must not block.
+func (t *tab) handle(ev interface{}) {
+	paused, ok := ev.(*fetch.EventRequestPaused)
+	if !ok {
+		return
+	}
+	t.begin()
+	go func() {
+		defer t.end()
+		t.forward(paused)
+	}()
+}
+
+func (t *tab) begin() {
+	t.mu.Lock()
+	t.inflight++
+	t.active = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *tab) end() {
+	t.mu.Lock()
+	t.inflight--
+	t.active = time.Now()
+	t.mu.Unlock()
+}
+
+// hopHeaders are not passed between the browser and the transport, which
+// handles connections and content encoding itself
+var hopHeaders = map[string]bool{
+	"accept-encoding":   true,
+	"connection":        true,
+	"content-encoding":  true,
+	"content-length":    true,
+	"host":              true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// forward makes a paused request through the page's transport and hands the
+// response to the browser. Requests Allow refuses, and requests that are
+// not HTTP, are failed as blocked.
+func (t *tab) forward(paused *fetch.EventRequestPaused) {
+	// Commands about the request are sent from outside the event handler,
+	// straight to the page
+	ctx := cdp.WithExecutor(t.ctx, chromedp.FromContext(t.ctx).Target)
+	fail := func(reason network.ErrorReason) {
+		fetch.FailRequest(paused.RequestID, reason).Do(ctx)
+	}
+
+	u, err := url.Parse(paused.Request.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || (t.access.Allow != nil && !t.access.Allow(ctx, u)) {
+		fail(network.ErrorReasonBlockedByClient)
+		return
+	}
+
+	var body []byte
+	for _, entry := range paused.Request.PostDataEntries {
+		data, err := base64.StdEncoding.DecodeString(entry.Bytes)
+		if err != nil {
+			fail(network.ErrorReasonFailed)
+			return
+		}
+		body = append(body, data...)
+	}
+	req, err := http.NewRequestWithContext(ctx, paused.Request.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		fail(network.ErrorReasonFailed)
+		return
+	}
+	if len(body) == 0 {
+		req.Body, req.ContentLength = http.NoBody, 0
+	}
+	for name, value := range paused.Request.Headers {
+		if s, ok := value.(string); ok && !hopHeaders[strings.ToLower(name)] {
+			req.Header.Set(name, s)
+		}
+	}
+	if req.Header.Get("Cookie") == "" {
+		// Cookies are added after interception; the page's own are sent
+		// along from its browser context
+		if cookie := cookies(ctx, u); cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+	}
+
+	resp, err := t.access.Transport.RoundTrip(req)
+	if err != nil {
+		reason := network.ErrorReasonFailed
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			reason = network.ErrorReasonAborted
+		}
+		fail(reason)
+		return
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResourceBytes))
+	if err != nil {
+		fail(network.ErrorReasonFailed)
+		return
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); len(data) <= maxCaptureBytes && t.captures(string(paused.ResourceType), paused.Request.URL, contentType) {
+		t.record(Capture{
+			URL:         paused.Request.URL,
+			Method:      paused.Request.Method,
+			StatusCode:  resp.StatusCode,
+			ContentType: contentType,
+			Body:        string(data),
+		})
+	}
+
+	headers := make([]*fetch.HeaderEntry, 0, len(resp.Header))
+	for name, values := range resp.Header {
+		if hopHeaders[strings.ToLower(name)] {
+			continue
+		}
+		for _, value := range values {
+			headers = append(headers, &fetch.HeaderEntry{Name: name, Value: value})
+		}
+	}
+	fetch.FulfillRequest(paused.RequestID, int64(resp.StatusCode)).
+		WithResponseHeaders(headers).
+		WithBody(base64.StdEncoding.EncodeToString(data)).
+		Do(ctx)
+}
+
+// cookies returns the Cookie header the page's browser context holds for
+// u
+func cookies(ctx context.Context, u *url.URL) string {
+	held, err := network.GetCookies().WithUrls([]string{u.String()}).Do(ctx)
+	if err != nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(held))
+	for _, c := range held {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
@@ -0,0 +1,166 @@
+package reverseimage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Match is a page where a searched image was found
+type Match struct {
+	URL      string  `json:"url"`
+	ImageURL string  `json:"image_url,omitempty"`
+	Domain   string  `json:"domain,omitempty"`
+	Score    float64 `json:"score,omitempty"`
+}
+
+// Provider finds other occurrences of an image on the web
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, imageURL string) ([]Match, error)
+}
+
+// NewProviderFromEnv returns the provider named by REVERSE_IMAGE_PROVIDER,
+// or nil when reverse image search is not configured
+func NewProviderFromEnv() (Provider, error) {
+	switch name := os.Getenv("REVERSE_IMAGE_PROVIDER"); name {
+	case "":
+		return nil, nil
+	case "tineye":
+		key := os.Getenv("TINEYE_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("TINEYE_API_KEY is required for the tineye provider")
+		}
+		return NewCache(NewTinEye(os.Getenv("TINEYE_API_URL"), key), 24*time.Hour), nil
+	default:
+		return nil, fmt.Errorf("unknown reverse image provider %q", name)
+	}
+}
+
+// TinEye searches the TinEye API by image URL
+type TinEye struct {
+	baseURL string
+	key     string
+	http    *http.Client
+}
+
+// NewTinEye creates a TinEye provider; baseURL defaults to the public API
+func NewTinEye(baseURL, key string) *TinEye {
+	if baseURL == "" {
+		baseURL = "https://api.tineye.com/rest"
+	}
+	return &TinEye{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		key:     key,
+		http:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Name implements Provider
+func (t *TinEye) Name() string {
+	return "tineye"
+}
+
+// Search implements Provider
+func (t *TinEye) Search(ctx context.Context, imageURL string) ([]Match, error) {
+	q := url.Values{"image_url": {imageURL}, "limit": {"20"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"/search/?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", t.key)
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("tineye returned %d: %s", resp.StatusCode, body)
+	}
+
+	var res struct {
+		Results struct {
+			Matches []struct {
+				Domain    string  `json:"domain"`
+				ImageURL  string  `json:"image_url"`
+				Score     float64 `json:"score"`
+				Backlinks []struct {
+					Backlink string `json:"backlink"`
+				} `json:"backlinks"`
+			} `json:"matches"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("invalid tineye response: %w", err)
+	}
+
+	var matches []Match
+	for _, m := range res.Results.Matches {
+		for _, b := range m.Backlinks {
+			matches = append(matches, Match{
+				URL:      b.Backlink,
+				ImageURL: m.ImageURL,
+				Domain:   m.Domain,
+				Score:    m.Score,
+			})
+		}
+	}
+	return matches, nil
+}
+
+// Cache wraps a provider so each image URL is searched at most once per
+// TTL; logos and avatars repeat on every page of a site
+type Cache struct {
+	Provider
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	matches []Match
+	expires time.Time
+}
+
+// NewCache creates a caching provider
+func NewCache(p Provider, ttl time.Duration) *Cache {
+	return &Cache{Provider: p, ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// Search implements Provider
+func (c *Cache) Search(ctx context.Context, imageURL string) ([]Match, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[imageURL]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.matches, nil
+	}
+
+	matches, err := c.Provider.Search(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[imageURL] = cacheEntry{matches: matches, expires: now.Add(c.ttl)}
+	return matches, nil
+}
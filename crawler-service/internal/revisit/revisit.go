@@ -0,0 +1,154 @@
+// Package revisit remembers what monitoring crawls last saw of each page:
+// the validators to fetch it conditionally with, and the content to tell
+// what changed when it is fetched again. Pages are kept per tenant and
+// monitor key, in Redis when connected and in process otherwise.
+package revisit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	keyPrefix = "revisit:"
+	// retention is how long the pages of a monitor are kept after its last
+	// run
+	retention = 90 * 24 * time.Hour
+	// maxText and maxLinks bound the content kept of a page
+	maxText  = 64 << 10
+	maxLinks = 500
+)
+
+// Page is what a monitoring crawl saw of a page
+type Page struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentHash  string    `json:"content_hash"`
+	Title        string    `json:"title,omitempty"`
+	Text         string    `json:"text,omitempty"`
+	Links        []string  `json:"links,omitempty"`
+	CrawledAt    time.Time `json:"crawled_at"`
+	// JobID is the crawl that saw the page and Change how the page had
+	// changed when it did, so a restarted run of that crawl reports the
+	// same change again
+	JobID  string             `json:"job_id,omitempty"`
+	Change *models.PageChange `json:"change,omitempty"`
+}
+
+// DefaultKey returns the monitor key of a crawl that does not name one,
+// derived from its query, or its seed URLs when it has none
+func DefaultKey(query string, seeds []string) string {
+	material := strings.ToLower(strings.TrimSpace(query))
+	if material == "" {
+		sorted := append([]string(nil), seeds...)
+		sort.Strings(sorted)
+		material = strings.Join(sorted, "\n")
+	}
+	sum := sha256.Sum256([]byte(material))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Store keeps the pages seen by each monitor
+type Store struct {
+	mu    sync.Mutex
+	local map[string]map[string]Page
+}
+
+// NewStore returns an empty store
+func NewStore() *Store {
+	return &Store{local: make(map[string]map[string]Page)}
+}
+
+func redisKey(tenant, key string) string {
+	return keyPrefix + tenant + ":" + key
+}
+
+// URLs returns the URLs of the pages a monitor has seen, sorted
+func (s *Store) URLs(tenant, key string) []string {
+	var urls []string
+	if rdb := database.GetRedisClient(); rdb != nil {
+		keys, err := rdb.HKeys(context.Background(), redisKey(tenant, key)).Result()
+		if err == nil {
+			sort.Strings(keys)
+			return keys
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to read monitored pages from Redis, using local copy")
+	}
+
+	s.mu.Lock()
+	for u := range s.local[redisKey(tenant, key)] {
+		urls = append(urls, u)
+	}
+	s.mu.Unlock()
+	sort.Strings(urls)
+	return urls
+}
+
+// Get returns what a monitor last saw of a page
+func (s *Store) Get(tenant, key, url string) (Page, bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := rdb.HGet(context.Background(), redisKey(tenant, key), url).Bytes()
+		switch {
+		case err == redis.Nil:
+			return Page{}, false
+		case err != nil:
+			log.WithError(err).WithField("tenant", tenant).Warn("Failed to read monitored page from Redis, using local copy")
+		default:
+			var page Page
+			if err := json.Unmarshal(data, &page); err == nil {
+				return page, true
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page, ok := s.local[redisKey(tenant, key)][url]
+	return page, ok
+}
+
+// Put records what a monitor saw of a page
+func (s *Store) Put(tenant, key, url string, page Page) {
+	if len(page.Text) > maxText {
+		page.Text = strings.ToValidUTF8(page.Text[:maxText], "")
+	}
+	if len(page.Links) > maxLinks {
+		page.Links = page.Links[:maxLinks]
+	}
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(page)
+		if err == nil {
+			ctx := context.Background()
+			pipe := rdb.TxPipeline()
+			pipe.HSet(ctx, redisKey(tenant, key), url, data)
+			pipe.Expire(ctx, redisKey(tenant, key), retention)
+			_, err = pipe.Exec(ctx)
+		}
+		if err == nil {
+			return
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to record monitored page in Redis, keeping it locally")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pages, ok := s.local[redisKey(tenant, key)]
+	if !ok {
+		pages = make(map[string]Page)
+		s.local[redisKey(tenant, key)] = pages
+	}
+	pages[url] = page
+}
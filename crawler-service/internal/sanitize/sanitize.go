@@ -0,0 +1,74 @@
+package sanitize
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// policy keeps the structure and text extraction relies on - document
+// skeleton, headings, links, lists, tables, media and class and id
+// attributes - and drops scripts, event handlers, iframes, objects, forms
+// and styles
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	p.AllowStandardAttributes()
+	p.AllowAttrs("class").Globally()
+	p.AllowImages()
+	p.AllowLists()
+	p.AllowTables()
+
+	p.AllowElements(
+		"html", "head", "title", "body",
+		"main", "article", "section", "header", "footer", "nav", "aside",
+		"h1", "h2", "h3", "h4", "h5", "h6", "p", "div", "span", "br", "hr",
+		"blockquote", "pre", "code", "em", "strong", "b", "i", "u", "small",
+		"sub", "sup", "abbr", "address", "cite", "q", "mark", "del", "ins",
+		"figure", "figcaption", "picture",
+	)
+	p.AllowAttrs("href", "rel", "hreflang").OnElements("a")
+	p.AllowAttrs("datetime").OnElements("time", "del", "ins")
+	p.AllowAttrs("cite").OnElements("blockquote", "q")
+	p.AllowAttrs("lang").OnElements("html")
+	// Only descriptive meta tags: http-equiv could refresh or redirect
+	p.AllowAttrs("name", "property", "content", "charset", "itemprop").OnElements("meta")
+	p.AllowAttrs("itemscope", "itemtype", "itemprop").Globally()
+	return p
+}
+
+// jsonLD finds JSON-LD blocks, which carry dates and places extraction uses
+const jsonLD = `script[type="application/ld+json"]`
+
+// HTML returns a page with everything that could run in a browser removed.
+// JSON-LD data blocks are kept, rewritten so they cannot break out of their
+// element; browsers never execute them. Sanitising already sanitised HTML
+// leaves it unchanged.
+func HTML(raw []byte) []byte {
+	var blocks []string
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(raw)); err == nil {
+		doc.Find(jsonLD).Each(func(_ int, s *goquery.Selection) {
+			if data := strings.TrimSpace(s.Text()); data != "" {
+				blocks = append(blocks, strings.ReplaceAll(data, "</", `<\/`))
+			}
+		})
+	}
+
+	clean := policy.SanitizeBytes(raw)
+	if len(blocks) == 0 {
+		return clean
+	}
+
+	var out bytes.Buffer
+	out.Write(clean)
+	for _, block := range blocks {
+		out.WriteString(`<script type="application/ld+json">`)
+		out.WriteString(block)
+		out.WriteString(`</script>`)
+	}
+	return out.Bytes()
+}
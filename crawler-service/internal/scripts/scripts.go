@@ -0,0 +1,267 @@
+package scripts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/go-redis/redis/v8"
+	"go.starlark.net/starlark"
+)
+
+// Limits applied to every script
+const (
+	MaxSourceBytes = 64 << 10
+	// MaxFields and MaxValueBytes bound what one run may add to a result
+	MaxFields     = 64
+	MaxValueBytes = 16 << 10
+	maxSteps      = 1_000_000
+)
+
+// runTimeout bounds one run of a script, a variable so tests can shorten it
+var runTimeout = 2 * time.Second
+
+// scriptsPrefix starts the Redis hash of a tenant's scripts, keyed by name
+const scriptsPrefix = "tenant_scripts:"
+
+// ErrUnavailable is returned when the scripts kept in Redis cannot be read
+// or written
+var ErrUnavailable = errors.New("extraction scripts are unavailable")
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Script is a tenant-provided Starlark extraction script. It must define
+// extract(page), receiving a dict with url, title, text and content and
+// returning a dict of custom fields.
+type Script struct {
+	Name      string    `json:"name"`
+	Tenant    string    `json:"tenant"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store holds uploaded scripts per tenant. Scripts are kept in Redis when
+// connected, so every instance runs the same scripts and they survive
+// restarts, else in memory.
+type Store struct {
+	mu      sync.RWMutex
+	scripts map[string]map[string]*Script
+}
+
+// NewStore creates an empty script store
+func NewStore() *Store {
+	return &Store{scripts: make(map[string]map[string]*Script)}
+}
+
+// Put validates and stores a script, replacing any script with the same name
+func (s *Store) Put(tenant, name, source string) (*Script, error) {
+	if !namePattern.MatchString(name) {
+		return nil, errors.New("script name must be 1-64 letters, digits, '-' or '_'")
+	}
+	if len(source) > MaxSourceBytes {
+		return nil, fmt.Errorf("script exceeds %d bytes", MaxSourceBytes)
+	}
+	if _, err := compile(name, source); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	script := &Script{Name: name, Tenant: tenant, Source: source, CreatedAt: now, UpdatedAt: now}
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		existing, ok, err := s.Get(tenant, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			script.CreatedAt = existing.CreatedAt
+		}
+		data, err := json.Marshal(script)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := rdb.HSet(ctx, scriptsPrefix+tenant, name, data).Err(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return script, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantScripts, ok := s.scripts[tenant]
+	if !ok {
+		tenantScripts = make(map[string]*Script)
+		s.scripts[tenant] = tenantScripts
+	}
+	if existing, ok := tenantScripts[name]; ok {
+		script.CreatedAt = existing.CreatedAt
+	}
+	tenantScripts[name] = script
+	return script, nil
+}
+
+// Get returns a tenant's script by name
+func (s *Store) Get(tenant, name string) (*Script, bool, error) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		data, err := rdb.HGet(ctx, scriptsPrefix+tenant, name).Bytes()
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		var script Script
+		if err := json.Unmarshal(data, &script); err != nil {
+			return nil, false, fmt.Errorf("corrupt script %s of tenant %s: %w", name, tenant, err)
+		}
+		return &script, true, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	script, ok := s.scripts[tenant][name]
+	return script, ok, nil
+}
+
+// List returns a tenant's scripts sorted by name
+func (s *Store) List(tenant string) ([]*Script, error) {
+	var list []*Script
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		items, err := rdb.HGetAll(ctx, scriptsPrefix+tenant).Result()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		list = make([]*Script, 0, len(items))
+		for _, item := range items {
+			var script Script
+			if json.Unmarshal([]byte(item), &script) == nil {
+				list = append(list, &script)
+			}
+		}
+	} else {
+		s.mu.RLock()
+		list = make([]*Script, 0, len(s.scripts[tenant]))
+		for _, script := range s.scripts[tenant] {
+			list = append(list, script)
+		}
+		s.mu.RUnlock()
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Delete removes a tenant's script, reporting whether it existed
+func (s *Store) Delete(tenant, name string) (bool, error) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		n, err := rdb.HDel(ctx, scriptsPrefix+tenant, name).Result()
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return n > 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.scripts[tenant][name]; !ok {
+		return false, nil
+	}
+	delete(s.scripts[tenant], name)
+	return true, nil
+}
+
+// Page is the data exposed to a script
+type Page struct {
+	URL     string
+	Title   string
+	Text    string
+	Content string
+}
+
+// Run executes the script's extract function against a page and returns the
+// fields it produced. A run is stopped after maxSteps steps or runTimeout,
+// and fails when it returns more than MaxFields fields or a value longer
+// than MaxValueBytes.
+func (sc *Script) Run(page Page) (map[string]string, error) {
+	thread := &starlark.Thread{Name: sc.Name}
+	thread.SetMaxExecutionSteps(maxSteps)
+	timer := time.AfterFunc(runTimeout, func() { thread.Cancel("timeout") })
+	defer timer.Stop()
+
+	globals, err := starlark.ExecFile(thread, sc.Name+".star", sc.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	extract := globals["extract"]
+
+	input := starlark.NewDict(4)
+	input.SetKey(starlark.String("url"), starlark.String(page.URL))
+	input.SetKey(starlark.String("title"), starlark.String(page.Title))
+	input.SetKey(starlark.String("text"), starlark.String(page.Text))
+	input.SetKey(starlark.String("content"), starlark.String(page.Content))
+
+	out, err := starlark.Call(thread, extract, starlark.Tuple{input}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dict, ok := out.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("extract must return a dict, got %s", out.Type())
+	}
+
+	if dict.Len() > MaxFields {
+		return nil, fmt.Errorf("extract returned %d fields, more than %d", dict.Len(), MaxFields)
+	}
+
+	fields := make(map[string]string, dict.Len())
+	for _, item := range dict.Items() {
+		key, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("field names must be strings, got %s", item[0].Type())
+		}
+		value, ok := starlark.AsString(item[1])
+		if !ok {
+			value = item[1].String()
+		}
+		if len(key)+len(value) > MaxValueBytes {
+			return nil, fmt.Errorf("field %.64q exceeds %d bytes", key, MaxValueBytes)
+		}
+		fields[key] = value
+	}
+	return fields, nil
+}
+
+// compile checks the script parses and defines a callable extract
+func compile(name, source string) (starlark.StringDict, error) {
+	thread := &starlark.Thread{Name: name}
+	thread.SetMaxExecutionSteps(maxSteps)
+
+	globals, err := starlark.ExecFile(thread, name+".star", source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	if _, ok := globals["extract"].(starlark.Callable); !ok {
+		return nil, errors.New("script must define extract(page)")
+	}
+	return globals, nil
+}
@@ -0,0 +1,173 @@
+package scripts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+const titleScript = `
+def extract(page):
+    return {"title": page["title"].upper(), "words": len(page["text"].split())}
+`
+
+func TestPutValidates(t *testing.T) {
+	s := NewStore()
+	tests := []struct {
+		name, source string
+	}{
+		{"bad name!", titleScript},
+		{strings.Repeat("a", 65), titleScript},
+		{"no_extract", "def other(page):\n    return {}\n"},
+		{"syntax", "def extract(page)\n"},
+		{"not_callable", "extract = 1\n"},
+		{"too_big", titleScript + "#" + strings.Repeat("x", MaxSourceBytes)},
+	}
+	for _, tt := range tests {
+		if _, err := s.Put("acme", tt.name, tt.source); err == nil {
+			t.Errorf("Put accepted script %q", tt.name)
+		}
+	}
+	if list, _ := s.List("acme"); len(list) != 0 {
+		t.Errorf("invalid scripts stored: %d", len(list))
+	}
+}
+
+func TestStoreKeepsTenantsApart(t *testing.T) {
+	s := NewStore()
+	first, err := s.Put("acme", "title", titleScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	replaced, err := s.Put("acme", "title", titleScript+"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replaced.CreatedAt.Equal(first.CreatedAt) || !replaced.UpdatedAt.After(first.UpdatedAt) {
+		t.Errorf("replacement dates = %v / %v, want created %v kept", replaced.CreatedAt, replaced.UpdatedAt, first.CreatedAt)
+	}
+
+	if _, ok, _ := s.Get("other", "title"); ok {
+		t.Error("script visible to another tenant")
+	}
+	if deleted, _ := s.Delete("other", "title"); deleted {
+		t.Error("script deleted by another tenant")
+	}
+	if deleted, err := s.Delete("acme", "title"); err != nil || !deleted {
+		t.Errorf("Delete = %v, %v", deleted, err)
+	}
+	if _, ok, _ := s.Get("acme", "title"); ok {
+		t.Error("deleted script still found")
+	}
+}
+
+func TestScriptsSharedThroughRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_HOST", mr.Addr())
+	if err := database.InitRedis(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseRedis() })
+
+	a, b := NewStore(), NewStore()
+	if _, err := a.Put("acme", "title", titleScript); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Put("acme", "second", titleScript); err != nil {
+		t.Fatal(err)
+	}
+
+	script, ok, err := b.Get("acme", "title")
+	if err != nil || !ok || script.Source != titleScript {
+		t.Fatalf("Get on another instance = %+v, %v, %v", script, ok, err)
+	}
+	list, err := b.List("acme")
+	if err != nil || len(list) != 2 || list[0].Name != "second" {
+		t.Errorf("List on another instance = %d scripts, %v", len(list), err)
+	}
+	if deleted, err := b.Delete("acme", "title"); err != nil || !deleted {
+		t.Fatalf("Delete = %v, %v", deleted, err)
+	}
+	if _, ok, _ := a.Get("acme", "title"); ok {
+		t.Error("script deleted on another instance still found")
+	}
+
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	if _, _, err := a.Get("acme", "second"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Get with Redis failing = %v, want ErrUnavailable", err)
+	}
+	if _, err := a.Put("acme", "third", titleScript); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Put with Redis failing = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	script := &Script{Name: "title", Source: titleScript}
+	fields, err := script.Run(Page{Title: "Home", Text: "three short words"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["title"] != "HOME" || fields["words"] != "3" {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{"not a dict", "def extract(page):\n    return [1]\n", "must return a dict"},
+		{"field name", "def extract(page):\n    return {1: 2}\n", "field names must be strings"},
+		{"failing", "def extract(page):\n    return {}[1]\n", "key"},
+		{"steps", `
+def extract(page):
+    n = 0
+    for i in range(10000000):
+        n += i
+    return {"n": n}
+`, "too many steps"},
+		{"fields", `
+def extract(page):
+    return {str(i): i for i in range(100)}
+`, "more than"},
+		{"value size", `
+def extract(page):
+    return {"big": "x" * 100000}
+`, "exceeds"},
+	}
+	for _, tt := range tests {
+		_, err := (&Script{Name: "limits", Source: tt.source}).Run(Page{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Run = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	defer func(d time.Duration) { runTimeout = d }(runTimeout)
+	runTimeout = 10 * time.Millisecond
+
+	// Each step copies a large string, so the timeout hits well before the
+	// step limit
+	script := &Script{Name: "slow", Source: `
+def extract(page):
+    s = "x" * 1000000
+    for i in range(900000):
+        s = s[1:] + "y"
+    return {"s": s[:10]}
+`}
+	start := time.Now()
+	_, err := script.Run(Page{})
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Run = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out run took %s", elapsed)
+	}
+}
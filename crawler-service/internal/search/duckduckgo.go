@@ -0,0 +1,123 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// duckDuckGoURL is the script-free results page scraped for results
+const duckDuckGoURL = "https://html.duckduckgo.com/html/"
+
+// DuckDuckGo searches by scraping DuckDuckGo's HTML results page. It needs
+// no key, which makes it the fallback when no search API is configured or
+// the configured one fails.
+type DuckDuckGo struct {
+	client apiClient
+}
+
+// NewDuckDuckGo creates a DuckDuckGo provider
+func NewDuckDuckGo() *DuckDuckGo {
+	return &DuckDuckGo{client: newAPIClient(http.Header{
+		"User-Agent":      {"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0"},
+		"Accept":          {"text/html,application/xhtml+xml"},
+		"Accept-Language": {"en-US,en;q=0.5"},
+		"Content-Type":    {"application/x-www-form-urlencoded"},
+	})}
+}
+
+func (d *DuckDuckGo) useMeter(m *Meter) {
+	d.client.meter, d.client.provider = m, d.Name()
+}
+
+// Name implements Provider
+func (d *DuckDuckGo) Name() string {
+	return "duckduckgo"
+}
+
+// Search implements Provider. Each results page holds a form requesting
+// the next one; it is followed until enough results are found.
+func (d *DuckDuckGo) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	var results []Result
+	form := url.Values{"q": {query}}
+	for form != nil && len(results) < limit {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, duckDuckGoURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return results, err
+		}
+		body, err := d.client.do(req)
+		if err != nil {
+			return results, err
+		}
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return results, fmt.Errorf("invalid DuckDuckGo results page: %w", err)
+		}
+
+		found := 0
+		doc.Find("div.result").Not(".result--ad").Each(func(_ int, s *goquery.Selection) {
+			link := s.Find("a.result__a").First()
+			target := resultURL(link.AttrOr("href", ""))
+			if target == "" {
+				return
+			}
+			found++
+			results = append(results, Result{
+				URL:     target,
+				Title:   strings.TrimSpace(link.Text()),
+				Snippet: strings.TrimSpace(s.Find(".result__snippet").Text()),
+			})
+		})
+		// Suspected automation gets a challenge page instead of results
+		if found == 0 && len(results) == 0 && doc.Find("form#challenge-form, .anomaly-modal__modal").Length() > 0 {
+			return nil, fmt.Errorf("duckduckgo refused the search with a bot challenge")
+		}
+		if found == 0 {
+			break
+		}
+		form = nextPage(doc)
+	}
+	return truncate(results, limit), nil
+}
+
+// resultURL returns the destination of a result link, unwrapping
+// DuckDuckGo's redirect links
+func resultURL(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if strings.HasSuffix(u.Host, "duckduckgo.com") && u.Path == "/l/" {
+		if target := u.Query().Get("uddg"); target != "" {
+			return target
+		}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+// nextPage returns the fields of the form requesting the next results
+// page, or nil on the last page
+func nextPage(doc *goquery.Document) url.Values {
+	var next url.Values
+	doc.Find("div.nav-link form").EachWithBreak(func(_ int, f *goquery.Selection) bool {
+		if !strings.EqualFold(f.Find(`input[type="submit"]`).AttrOr("value", ""), "next") {
+			return true
+		}
+		next = url.Values{}
+		f.Find(`input[type="hidden"]`).Each(func(_ int, in *goquery.Selection) {
+			if name, ok := in.Attr("name"); ok {
+				next.Add(name, in.AttrOr("value", ""))
+			}
+		})
+		return false
+	})
+	return next
+}
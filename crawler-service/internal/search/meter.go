@@ -0,0 +1,246 @@
+package search
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+)
+
+// ErrQuotaExhausted is returned for searches through a provider whose daily
+// quota is used up
+var ErrQuotaExhausted = errors.New("search provider daily quota exhausted")
+
+const (
+	cachePrefix = "search:cache:"
+	usagePrefix = "search:usage:"
+	// defaultCacheTTL is how long responses are cached without
+	// SEARCH_CACHE_TTL
+	defaultCacheTTL = 24 * time.Hour
+	// maxCachedPages bounds the in-memory cache used without Redis
+	maxCachedPages = 1000
+)
+
+// Meter caches provider responses and counts the requests made to each
+// provider per UTC day against its quota. Both are kept in Redis when
+// connected, so every instance shares them, else in memory.
+type Meter struct {
+	ttl    time.Duration
+	quotas map[string]int
+
+	mu     sync.Mutex
+	pages  map[string]cachedPage
+	usage  map[string]int
+	hits   map[string]int64
+	misses map[string]int64
+}
+
+type cachedPage struct {
+	body    []byte
+	expires time.Time
+}
+
+// Usage is a provider's use of its daily quota and of the cache
+type Usage struct {
+	Provider string `json:"provider"`
+	// UsedToday counts requests made to the provider today (UTC)
+	UsedToday int `json:"used_today"`
+	// DailyQuota is 0 when the provider has no quota
+	DailyQuota int `json:"daily_quota"`
+	// Remaining is set when the provider has a quota
+	Remaining *int      `json:"remaining,omitempty"`
+	ResetsAt  time.Time `json:"resets_at"`
+	// CacheHits and CacheMisses count this instance's lookups since it
+	// started
+	CacheHits   int64 `json:"cache_hits"`
+	CacheMisses int64 `json:"cache_misses"`
+}
+
+// NewMeterFromEnv caches responses for SEARCH_CACHE_TTL (default 24h; 0
+// turns caching off) and enforces the quotas in SEARCH_DAILY_QUOTAS, e.g.
+// "google=100,serpapi=250"
+func NewMeterFromEnv() *Meter {
+	ttl := defaultCacheTTL
+	if d, err := time.ParseDuration(os.Getenv("SEARCH_CACHE_TTL")); err == nil && d >= 0 {
+		ttl = d
+	}
+	return &Meter{
+		ttl:    ttl,
+		quotas: parseQuotas(os.Getenv("SEARCH_DAILY_QUOTAS")),
+		pages:  make(map[string]cachedPage),
+		usage:  make(map[string]int),
+		hits:   make(map[string]int64),
+		misses: make(map[string]int64),
+	}
+}
+
+func parseQuotas(s string) map[string]int {
+	quotas := make(map[string]int)
+	for _, field := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n > 0 {
+			quotas[strings.ToLower(strings.TrimSpace(name))] = n
+		}
+	}
+	return quotas
+}
+
+// pageKey identifies a provider request by its method, URL and body, which
+// carry the query and the page asked for. Keys in URLs are hashed along
+// with them and never stored.
+func pageKey(provider string, req *http.Request) string {
+	h := sha256.New()
+	io.WriteString(h, req.Method+" "+req.URL.String()+"\n")
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			io.Copy(h, body)
+			body.Close()
+		}
+	}
+	return cachePrefix + provider + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// cached returns a cached response
+func (m *Meter) cached(provider, key string) ([]byte, bool) {
+	if m.ttl == 0 {
+		return nil, false
+	}
+	body, ok := m.lookup(key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ok {
+		m.hits[provider]++
+	} else {
+		m.misses[provider]++
+	}
+	return body, ok
+}
+
+func (m *Meter) lookup(key string) ([]byte, bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if body, err := rdb.Get(context.Background(), key).Bytes(); err == nil {
+			return body, true
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	page, ok := m.pages[key]
+	if !ok || time.Now().After(page.expires) {
+		delete(m.pages, key)
+		return nil, false
+	}
+	return page.body, true
+}
+
+// store caches a response
+func (m *Meter) store(key string, body []byte) {
+	if m.ttl == 0 {
+		return
+	}
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if rdb.Set(context.Background(), key, body, m.ttl).Err() == nil {
+			return
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.pages) >= maxCachedPages {
+		now := time.Now()
+		for k, page := range m.pages {
+			if now.After(page.expires) {
+				delete(m.pages, k)
+			}
+		}
+		// Still full: make room by dropping any one page
+		for k := range m.pages {
+			if len(m.pages) < maxCachedPages {
+				break
+			}
+			delete(m.pages, k)
+		}
+	}
+	m.pages[key] = cachedPage{body: body, expires: time.Now().Add(m.ttl)}
+}
+
+// charge counts a request to a provider against today's quota, or returns
+// ErrQuotaExhausted when it is used up
+func (m *Meter) charge(provider string) error {
+	quota := m.quotas[provider]
+	key := usageKey(provider, time.Now())
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx := context.Background()
+		n, err := rdb.Incr(ctx, key).Result()
+		if err == nil {
+			rdb.Expire(ctx, key, 48*time.Hour)
+			if quota > 0 && n > int64(quota) {
+				rdb.Decr(ctx, key)
+				return fmt.Errorf("%s: %w", provider, ErrQuotaExhausted)
+			}
+			return nil
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if quota > 0 && m.usage[key] >= quota {
+		return fmt.Errorf("%s: %w", provider, ErrQuotaExhausted)
+	}
+	m.usage[key]++
+	return nil
+}
+
+// Usage reports a provider's use of its quota today and of the cache
+func (m *Meter) Usage(provider string) Usage {
+	now := time.Now().UTC()
+	key := usageKey(provider, now)
+
+	used, fromRedis := 0, false
+	if rdb := database.GetRedisClient(); rdb != nil {
+		if n, err := rdb.Get(context.Background(), key).Int(); err == nil {
+			used, fromRedis = n, true
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !fromRedis {
+		used = m.usage[key]
+	}
+	u := Usage{
+		Provider:    provider,
+		UsedToday:   used,
+		DailyQuota:  m.quotas[provider],
+		ResetsAt:    now.Truncate(24 * time.Hour).Add(24 * time.Hour),
+		CacheHits:   m.hits[provider],
+		CacheMisses: m.misses[provider],
+	}
+	if u.DailyQuota > 0 {
+		remaining := u.DailyQuota - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		u.Remaining = &remaining
+	}
+	return u
+}
+
+func usageKey(provider string, t time.Time) string {
+	return usagePrefix + provider + ":" + t.UTC().Format("2006-01-02")
+}
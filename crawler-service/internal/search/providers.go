@@ -0,0 +1,221 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Google searches through the Custom Search JSON API, which returns at
+// most 10 results a page and 100 in all
+type Google struct {
+	key    string
+	cx     string
+	client apiClient
+}
+
+// NewGoogle creates a Google provider for the search engine cx
+func NewGoogle(key, cx string) *Google {
+	return &Google{key: key, cx: cx, client: newAPIClient(nil)}
+}
+
+func (g *Google) useMeter(m *Meter) {
+	g.client.meter, g.client.provider = m, g.Name()
+}
+
+// Name implements Provider
+func (g *Google) Name() string {
+	return "google"
+}
+
+// Search implements Provider
+func (g *Google) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	var results []Result
+	for start := 1; len(results) < limit && start <= 91; start += 10 {
+		q := url.Values{
+			"key":   {g.key},
+			"cx":    {g.cx},
+			"q":     {query},
+			"num":   {fmt.Sprint(pageSize(limit-len(results), 10))},
+			"start": {fmt.Sprint(start)},
+		}
+		body, err := g.client.get(ctx, "https://www.googleapis.com/customsearch/v1?"+q.Encode())
+		if err != nil {
+			return results, err
+		}
+
+		var res struct {
+			Items []struct {
+				Link    string `json:"link"`
+				Title   string `json:"title"`
+				Snippet string `json:"snippet"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return results, fmt.Errorf("invalid Google search response: %w", err)
+		}
+
+		for _, item := range res.Items {
+			results = append(results, Result{URL: item.Link, Title: item.Title, Snippet: item.Snippet})
+		}
+		if len(res.Items) < 10 {
+			break
+		}
+	}
+	return truncate(results, limit), nil
+}
+
+// Bing searches through the Bing Web Search API, 50 results a page
+type Bing struct {
+	endpoint string
+	client   apiClient
+}
+
+// NewBing creates a Bing provider; endpoint defaults to the public v7.0
+// search endpoint
+func NewBing(endpoint, key string) *Bing {
+	if endpoint == "" {
+		endpoint = "https://api.bing.microsoft.com/v7.0/search"
+	}
+	return &Bing{
+		endpoint: endpoint,
+		client:   newAPIClient(http.Header{"Ocp-Apim-Subscription-Key": {key}}),
+	}
+}
+
+func (b *Bing) useMeter(m *Meter) {
+	b.client.meter, b.client.provider = m, b.Name()
+}
+
+// Name implements Provider
+func (b *Bing) Name() string {
+	return "bing"
+}
+
+// Search implements Provider
+func (b *Bing) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	var results []Result
+	for offset := 0; len(results) < limit; {
+		count := pageSize(limit-len(results), 50)
+		q := url.Values{
+			"q":              {query},
+			"count":          {fmt.Sprint(count)},
+			"offset":         {fmt.Sprint(offset)},
+			"responseFilter": {"Webpages"},
+		}
+		body, err := b.client.get(ctx, b.endpoint+"?"+q.Encode())
+		if err != nil {
+			return results, err
+		}
+
+		var res struct {
+			WebPages struct {
+				TotalEstimatedMatches int `json:"totalEstimatedMatches"`
+				Value                 []struct {
+					URL     string `json:"url"`
+					Name    string `json:"name"`
+					Snippet string `json:"snippet"`
+				} `json:"value"`
+			} `json:"webPages"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return results, fmt.Errorf("invalid Bing search response: %w", err)
+		}
+
+		for _, page := range res.WebPages.Value {
+			results = append(results, Result{URL: page.URL, Title: page.Name, Snippet: page.Snippet})
+		}
+		offset += len(res.WebPages.Value)
+		if len(res.WebPages.Value) == 0 || offset >= res.WebPages.TotalEstimatedMatches {
+			break
+		}
+	}
+	return truncate(results, limit), nil
+}
+
+// SerpAPI searches Google through SerpAPI
+type SerpAPI struct {
+	key    string
+	client apiClient
+}
+
+// NewSerpAPI creates a SerpAPI provider
+func NewSerpAPI(key string) *SerpAPI {
+	return &SerpAPI{key: key, client: newAPIClient(nil)}
+}
+
+func (s *SerpAPI) useMeter(m *Meter) {
+	s.client.meter, s.client.provider = m, s.Name()
+}
+
+// Name implements Provider
+func (s *SerpAPI) Name() string {
+	return "serpapi"
+}
+
+// Search implements Provider
+func (s *SerpAPI) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	var results []Result
+	for start := 0; len(results) < limit; {
+		q := url.Values{
+			"engine":  {"google"},
+			"q":       {query},
+			"api_key": {s.key},
+			"num":     {fmt.Sprint(pageSize(limit-len(results), 100))},
+			"start":   {fmt.Sprint(start)},
+		}
+		body, err := s.client.get(ctx, "https://serpapi.com/search.json?"+q.Encode())
+		if err != nil {
+			return results, err
+		}
+
+		var res struct {
+			Error          string `json:"error"`
+			OrganicResults []struct {
+				Link    string `json:"link"`
+				Title   string `json:"title"`
+				Snippet string `json:"snippet"`
+			} `json:"organic_results"`
+			Pagination struct {
+				Next string `json:"next"`
+			} `json:"serpapi_pagination"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return results, fmt.Errorf("invalid SerpAPI response: %w", err)
+		}
+		// SerpAPI reports an exhausted search as an error
+		if res.Error != "" {
+			if len(results) > 0 || strings.Contains(res.Error, "hasn't returned any results") {
+				break
+			}
+			return results, fmt.Errorf("serpapi: %s", res.Error)
+		}
+
+		for _, r := range res.OrganicResults {
+			results = append(results, Result{URL: r.Link, Title: r.Title, Snippet: r.Snippet})
+		}
+		start += len(res.OrganicResults)
+		if len(res.OrganicResults) == 0 || res.Pagination.Next == "" {
+			break
+		}
+	}
+	return truncate(results, limit), nil
+}
+
+// pageSize is the number of results to ask for in one page
+func pageSize(wanted, max int) int {
+	if wanted > max {
+		return max
+	}
+	return wanted
+}
+
+func truncate(results []Result, limit int) []Result {
+	if len(results) > limit {
+		return results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,220 @@
+// Package search finds the pages a crawl of a query starts from, through
+// web search engines: Google Custom Search, Bing Web Search and SerpAPI
+// when their keys are configured, and DuckDuckGo's HTML results page,
+// which needs none and serves as the fallback.
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxResults caps the results a search may ask for
+const MaxResults = 100
+
+// maxResponseBytes caps the size of a search response
+const maxResponseBytes = 4 << 20
+
+// Result is a page found by a search
+type Result struct {
+	URL     string
+	Title   string
+	Snippet string
+}
+
+// Provider searches the web through one engine
+type Provider interface {
+	Name() string
+	// Search returns up to limit results, paging through the engine's
+	// results as needed. Results found before an error are returned with it.
+	Search(ctx context.Context, query string, limit int) ([]Result, error)
+}
+
+// Registry holds the configured search providers
+type Registry struct {
+	providers map[string]Provider
+	fallback  Provider
+	preferred string
+	meter     *Meter
+}
+
+// metered is implemented by the providers whose requests are cached and
+// counted
+type metered interface {
+	useMeter(m *Meter)
+}
+
+// NewRegistryFromEnv enables Google Custom Search when GOOGLE_CSE_KEY and
+// GOOGLE_CSE_ID are set, Bing when BING_SEARCH_KEY is set and SerpAPI when
+// SERPAPI_KEY is set. DuckDuckGo is always available. SEARCH_PROVIDER names
+// the provider used by default; otherwise the first configured of google,
+// bing, serpapi and duckduckgo is. Responses are cached and requests
+// counted as NewMeterFromEnv configures.
+func NewRegistryFromEnv() *Registry {
+	r := &Registry{providers: make(map[string]Provider), meter: NewMeterFromEnv()}
+	if key, cx := os.Getenv("GOOGLE_CSE_KEY"), os.Getenv("GOOGLE_CSE_ID"); key != "" && cx != "" {
+		r.Register(NewGoogle(key, cx))
+	}
+	if key := os.Getenv("BING_SEARCH_KEY"); key != "" {
+		r.Register(NewBing(os.Getenv("BING_SEARCH_URL"), key))
+	}
+	if key := os.Getenv("SERPAPI_KEY"); key != "" {
+		r.Register(NewSerpAPI(key))
+	}
+	r.fallback = NewDuckDuckGo()
+	r.Register(r.fallback)
+	r.preferred = strings.ToLower(strings.TrimSpace(os.Getenv("SEARCH_PROVIDER")))
+	return r
+}
+
+// Register adds a provider, replacing one with the same name
+func (r *Registry) Register(p Provider) {
+	if mp, ok := p.(metered); ok && r.meter != nil {
+		mp.useMeter(r.meter)
+	}
+	r.providers[p.Name()] = p
+}
+
+// Usage reports each provider's use of its daily quota and of the cache
+func (r *Registry) Usage() []Usage {
+	var usage []Usage
+	if r.meter == nil {
+		return usage
+	}
+	for _, name := range r.Names() {
+		usage = append(usage, r.meter.Usage(name))
+	}
+	return usage
+}
+
+// Names returns the configured provider names in order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the name of the provider used when a request names none
+func (r *Registry) Default() string {
+	if _, ok := r.providers[r.preferred]; ok {
+		return r.preferred
+	}
+	for _, name := range []string{"google", "bing", "serpapi", "duckduckgo"} {
+		if _, ok := r.providers[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Get returns the named provider, or the default one when name is empty
+func (r *Registry) Get(name string) (Provider, error) {
+	if name == "" {
+		name = r.Default()
+	}
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown search provider %q (configured: %s)", name, strings.Join(r.Names(), ", "))
+	}
+	return p, nil
+}
+
+// Search queries the named provider, or the default one. If it fails
+// without finding anything, as when its quota is exhausted, DuckDuckGo is
+// tried instead.
+func (r *Registry) Search(ctx context.Context, name, query string, limit int) ([]Result, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxResults {
+		limit = MaxResults
+	}
+
+	results, err := p.Search(ctx, query, limit)
+	if err != nil && len(results) == 0 && r.fallback != nil && p != r.fallback {
+		fallback, fallbackErr := r.fallback.Search(ctx, query, limit)
+		if fallbackErr != nil {
+			return nil, fmt.Errorf("%s: %v; %s: %w", p.Name(), err, r.fallback.Name(), fallbackErr)
+		}
+		return fallback, nil
+	}
+	return results, err
+}
+
+// apiClient is the HTTP plumbing shared by the providers. With a meter,
+// responses are cached and requests counted under the provider's name.
+type apiClient struct {
+	http     *http.Client
+	header   http.Header
+	meter    *Meter
+	provider string
+}
+
+func newAPIClient(header http.Header) apiClient {
+	return apiClient{http: &http.Client{Timeout: 30 * time.Second}, header: header}
+}
+
+func (c apiClient) do(req *http.Request) ([]byte, error) {
+	if c.meter == nil {
+		return c.fetch(req)
+	}
+	key := pageKey(c.provider, req)
+	if body, ok := c.meter.cached(c.provider, key); ok {
+		return body, nil
+	}
+	if err := c.meter.charge(c.provider); err != nil {
+		return nil, err
+	}
+	body, err := c.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+	c.meter.store(key, body)
+	return body, nil
+}
+
+func (c apiClient) fetch(req *http.Request) ([]byte, error) {
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// Keys travel in the query of some APIs; keep the URL out of errors
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("%s %s: %w", urlErr.Op, req.URL.Host, urlErr.Err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d: %.200s", req.URL.Host, resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (c apiClient) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
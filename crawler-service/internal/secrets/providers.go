@@ -0,0 +1,163 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"definitelynotaspy/crawler-service/internal/sigv4"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// lookupKey extracts key from a JSON object secret value
+func lookupKey(value, key string) (string, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &obj); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, cannot select key %q", key)
+	}
+	v, ok := obj[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no key %q", key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	data, _ := json.Marshal(v)
+	return string(data), nil
+}
+
+// vaultProvider reads secrets from HashiCorp Vault over its HTTP API
+type vaultProvider struct {
+	addr      string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+func newVaultFromEnv() *vaultProvider {
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil
+	}
+	return &vaultProvider{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		http:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Resolve reads path (e.g. kv/data/crawler). KV v2 responses are unwrapped
+// so the value is the JSON object of secret fields.
+func (v *vaultProvider) Resolve(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d for %s", resp.StatusCode, path)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	data := body.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = inner
+		}
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// awsProvider reads secrets from AWS Secrets Manager
+type awsProvider struct {
+	endpoint string
+	signer   *sigv4.Signer
+	http     *http.Client
+}
+
+func newAWSFromEnv() *awsProvider {
+	region := os.Getenv("AWS_REGION")
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if region == "" || accessKey == "" || secretKey == "" {
+		return nil
+	}
+
+	endpoint := os.Getenv("AWS_SECRETS_MANAGER_ENDPOINT")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+
+	return &awsProvider{
+		endpoint: endpoint,
+		signer: &sigv4.Signer{
+			Credentials: sigv4.Credentials{
+				AccessKey:    accessKey,
+				SecretKey:    secretKey,
+				SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			},
+			Region:  region,
+			Service: "secretsmanager",
+		},
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Resolve fetches the SecretString of the secret with ID path
+func (a *awsProvider) Resolve(ctx context.Context, path string) (string, error) {
+	payload, _ := json.Marshal(map[string]string{"SecretId": path})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.signer.Sign(req, payload, time.Now())
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("secrets manager returned status %d: %s", resp.StatusCode, msg)
+	}
+
+	var body struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid secrets manager response: %w", err)
+	}
+	return body.SecretString, nil
+}
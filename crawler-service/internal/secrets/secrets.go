@@ -0,0 +1,177 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownProvider is returned for references to an unconfigured provider
+var ErrUnknownProvider = errors.New("secret provider is not configured")
+
+// Provider resolves secret paths from a single secret manager
+type Provider interface {
+	Resolve(ctx context.Context, path string) (string, error)
+}
+
+// Ref is a parsed secret reference of the form provider:path[#key], e.g.
+// vault:kv/data/crawler#password or aws:prod/crawler/api#token
+type Ref struct {
+	Provider string
+	Path     string
+	Key      string
+}
+
+// ParseRef parses a secret reference
+func ParseRef(s string) (Ref, error) {
+	provider, rest, ok := strings.Cut(s, ":")
+	if !ok || provider == "" || rest == "" {
+		return Ref{}, fmt.Errorf("invalid secret reference %q, expected provider:path[#key]", s)
+	}
+	path, key, _ := strings.Cut(rest, "#")
+	return Ref{Provider: provider, Path: path, Key: key}, nil
+}
+
+// Resolver dispatches references to the configured providers
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewResolverFromEnv registers the env provider, plus Vault and AWS Secrets
+// Manager when their environment is configured
+func NewResolverFromEnv() *Resolver {
+	r := &Resolver{providers: map[string]Provider{}}
+
+	if os.Getenv("SECRETS_ALLOW_ENV") == "true" {
+		r.Register("env", envProvider{})
+	}
+	if vault := newVaultFromEnv(); vault != nil {
+		r.Register("vault", vault)
+	}
+	if aws := newAWSFromEnv(); aws != nil {
+		r.Register("aws", aws)
+	}
+	return r
+}
+
+// Register adds or replaces a provider
+func (r *Resolver) Register(name string, p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = p
+}
+
+// Providers returns the configured provider names
+func (r *Resolver) Providers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Validate checks that a reference is well formed and its provider exists
+func (r *Resolver) Validate(ref string) error {
+	parsed, err := ParseRef(ref)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.providers[parsed.Provider]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, parsed.Provider)
+	}
+	return nil
+}
+
+// Resolve fetches the secret value for a reference
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	parsed, err := ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.RLock()
+	p, ok := r.providers[parsed.Provider]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownProvider, parsed.Provider)
+	}
+
+	value, err := p.Resolve(ctx, parsed.Path)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Key == "" {
+		return value, nil
+	}
+	return lookupKey(value, parsed.Key)
+}
+
+// ResolveAll resolves a map of logical names to references. Errors name the
+// secret but never include its value.
+func (r *Resolver) ResolveAll(ctx context.Context, refs map[string]string) (map[string]string, error) {
+	values := make(map[string]string, len(refs))
+	for name, ref := range refs {
+		value, err := r.Resolve(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret %q: %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+var placeholder = regexp.MustCompile(`\$\{secret:([a-zA-Z0-9_.-]+)\}`)
+
+// Interpolate replaces ${secret:name} placeholders in s with resolved values
+func Interpolate(s string, values map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return m
+	})
+}
+
+// Placeholders returns the secret names referenced in s
+func Placeholders(s string) []string {
+	var names []string
+	for _, m := range placeholder.FindAllStringSubmatch(s, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// Redact replaces any occurrence of the resolved secret values in s, for use
+// before logging text that may contain them
+func Redact(s string, values map[string]string) string {
+	for _, value := range values {
+		if len(value) >= 4 {
+			s = strings.ReplaceAll(s, value, "[REDACTED]")
+		}
+	}
+	return s
+}
+
+// envProvider resolves secrets from process environment variables; it is
+// only enabled with SECRETS_ALLOW_ENV=true, for development
+type envProvider struct{}
+
+func (envProvider) Resolve(_ context.Context, path string) (string, error) {
+	value, ok := os.LookupEnv(path)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", path)
+	}
+	return value, nil
+}
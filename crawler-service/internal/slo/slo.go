@@ -0,0 +1,331 @@
+// Package slo reports how reliably the platform served a tenant over
+// rolling windows: the share of its jobs that succeeded, how long they
+// took, the alerts raised for it, and how much of the error budget a
+// success target leaves has been spent.
+package slo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	alertsPrefix = "slo:alerts:"
+	// alertRetention is how long alerts are kept, the longest window
+	// reported by default
+	alertRetention = 30 * 24 * time.Hour
+	// maxLocalAlerts bounds the alerts kept in memory per tenant
+	maxLocalAlerts = 10000
+)
+
+// DefaultTarget is the share of finished jobs expected to succeed
+const DefaultTarget = 0.99
+
+// Window is a rolling reporting window
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+// DefaultWindows are the windows reported without SLO_WINDOWS
+func DefaultWindows() []Window {
+	return []Window{
+		{Name: "1h", Duration: time.Hour},
+		{Name: "24h", Duration: 24 * time.Hour},
+		{Name: "7d", Duration: 7 * 24 * time.Hour},
+		{Name: "30d", Duration: 30 * 24 * time.Hour},
+	}
+}
+
+// ParseWindows parses a comma-separated list of windows such as
+// "1h,24h,7d"; a d suffix counts days
+func ParseWindows(s string) ([]Window, error) {
+	var windows []Window
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var d time.Duration
+		if days, ok := strings.CutSuffix(name, "d"); ok {
+			n, err := strconv.Atoi(days)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SLO window %q", name)
+			}
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			var err error
+			if d, err = time.ParseDuration(name); err != nil {
+				return nil, fmt.Errorf("invalid SLO window %q", name)
+			}
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("SLO window %q must be positive", name)
+		}
+		windows = append(windows, Window{Name: name, Duration: d})
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no SLO windows given")
+	}
+	return windows, nil
+}
+
+// Config holds the deployment's SLO settings
+type Config struct {
+	Target  float64
+	Windows []Window
+}
+
+// ConfigFromEnv reads SLO_SUCCESS_TARGET (a fraction such as 0.995,
+// default 0.99) and SLO_WINDOWS (default 1h,24h,7d,30d). Invalid settings
+// are logged and the defaults used.
+func ConfigFromEnv() Config {
+	cfg := Config{Target: DefaultTarget, Windows: DefaultWindows()}
+	if raw := os.Getenv("SLO_SUCCESS_TARGET"); raw != "" {
+		if t, err := strconv.ParseFloat(raw, 64); err == nil && t > 0 && t < 1 {
+			cfg.Target = t
+		} else {
+			log.WithField("value", raw).Warn("Invalid SLO_SUCCESS_TARGET, using the default")
+		}
+	}
+	if raw := os.Getenv("SLO_WINDOWS"); raw != "" {
+		if windows, err := ParseWindows(raw); err == nil {
+			cfg.Windows = windows
+		} else {
+			log.WithError(err).Warn("Invalid SLO_WINDOWS, using the defaults")
+		}
+	}
+	return cfg
+}
+
+// Alert is an alert raised for a tenant
+type Alert struct {
+	Type  string    `json:"type"`
+	JobID string    `json:"job_id,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// AlertLog keeps the alerts raised for each tenant in Redis, or in memory
+// without it, for alertRetention
+type AlertLog struct {
+	mu    sync.Mutex
+	local map[string][]Alert
+}
+
+// NewAlertLog returns an empty alert log
+func NewAlertLog() *AlertLog {
+	return &AlertLog{local: make(map[string][]Alert)}
+}
+
+// Record adds an alert raised for a tenant
+func (l *AlertLog) Record(tenant string, alert Alert) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(alert)
+		if err == nil {
+			ctx := context.Background()
+			key := alertsPrefix + tenant
+			_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.ZAdd(ctx, key, &redis.Z{Score: float64(alert.Time.UnixMilli()), Member: data})
+				pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(alert.Time.Add(-alertRetention).UnixMilli(), 10))
+				pipe.Expire(ctx, key, alertRetention)
+				return nil
+			})
+		}
+		if err == nil {
+			return
+		}
+		log.WithError(err).WithField("tenant", tenant).Warn("Failed to record alert in Redis, keeping it locally")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	alerts := append(l.local[tenant], alert)
+	cutoff := alert.Time.Add(-alertRetention)
+	for len(alerts) > 0 && (alerts[0].Time.Before(cutoff) || len(alerts) > maxLocalAlerts) {
+		alerts = alerts[1:]
+	}
+	l.local[tenant] = alerts
+}
+
+// Since returns the alerts raised for a tenant since a time, oldest first
+func (l *AlertLog) Since(tenant string, since time.Time) []Alert {
+	var alerts []Alert
+	if rdb := database.GetRedisClient(); rdb != nil {
+		members, err := rdb.ZRangeByScore(context.Background(), alertsPrefix+tenant, &redis.ZRangeBy{
+			Min: strconv.FormatInt(since.UnixMilli(), 10),
+			Max: "+inf",
+		}).Result()
+		if err != nil {
+			log.WithError(err).WithField("tenant", tenant).Warn("Failed to read alerts from Redis, using local copy")
+		}
+		for _, member := range members {
+			var alert Alert
+			if json.Unmarshal([]byte(member), &alert) == nil {
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+
+	l.mu.Lock()
+	for _, alert := range l.local[tenant] {
+		if !alert.Time.Before(since) {
+			alerts = append(alerts, alert)
+		}
+	}
+	l.mu.Unlock()
+
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].Time.Before(alerts[j].Time) })
+	return alerts
+}
+
+// ErrorBudget is the failures a success target allows among a window's
+// finished jobs, and how many of them were spent. BurnRate is the failure
+// rate over the rate the target allows: above 1, the budget runs out
+// before the window ends.
+type ErrorBudget struct {
+	Allowed   float64 `json:"allowed"`
+	Consumed  int     `json:"consumed"`
+	Remaining float64 `json:"remaining"`
+	BurnRate  float64 `json:"burn_rate"`
+	Exhausted bool    `json:"exhausted"`
+}
+
+// WindowReport is a tenant's service level over one window. Jobs counts
+// the jobs started in the window; the outcome counts, rates and times are
+// of the jobs that finished in it. Cancelled jobs count toward neither
+// success nor failure.
+type WindowReport struct {
+	Window          string         `json:"window"`
+	Since           time.Time      `json:"since"`
+	Jobs            int            `json:"jobs"`
+	Finished        int            `json:"finished"`
+	Succeeded       int            `json:"succeeded"`
+	Failed          int            `json:"failed"`
+	Cancelled       int            `json:"cancelled"`
+	Partial         int            `json:"partial"`
+	SuccessRate     *float64       `json:"success_rate"`
+	FailureRate     *float64       `json:"failure_rate"`
+	AvgCrawlSeconds float64        `json:"avg_crawl_seconds"`
+	P95CrawlSeconds float64        `json:"p95_crawl_seconds"`
+	ErrorCodes      map[string]int `json:"error_codes,omitempty"`
+	Alerts          int            `json:"alerts"`
+	AlertTypes      map[string]int `json:"alert_types,omitempty"`
+	ErrorBudget     ErrorBudget    `json:"error_budget"`
+	// Met reports whether the success rate reaches the target; it is
+	// absent while no job has finished in the window
+	Met *bool `json:"met,omitempty"`
+}
+
+// Report is a tenant's service level over each window
+type Report struct {
+	Tenant      string         `json:"tenant"`
+	Target      float64        `json:"target"`
+	Windows     []WindowReport `json:"windows"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// Build reports on a tenant's jobs and alerts over each window ending at
+// now
+func Build(tenant string, jobs []*models.CrawlJob, alerts []Alert, cfg Config, now time.Time) Report {
+	report := Report{Tenant: tenant, Target: cfg.Target, GeneratedAt: now}
+	for _, w := range cfg.Windows {
+		report.Windows = append(report.Windows, window(w, jobs, alerts, cfg.Target, now))
+	}
+	return report
+}
+
+func window(w Window, jobs []*models.CrawlJob, alerts []Alert, target float64, now time.Time) WindowReport {
+	since := now.Add(-w.Duration)
+	r := WindowReport{Window: w.Name, Since: since}
+
+	var durations []float64
+	for _, job := range jobs {
+		if !job.StartedAt.Before(since) {
+			r.Jobs++
+		}
+		if job.CompletedAt.IsZero() || job.CompletedAt.Before(since) {
+			continue
+		}
+		switch job.Status {
+		case "completed":
+			r.Succeeded++
+			if job.Partial {
+				r.Partial++
+			}
+		case "failed":
+			r.Failed++
+			if r.ErrorCodes == nil {
+				r.ErrorCodes = make(map[string]int)
+			}
+			code := job.ErrorCode
+			if code == "" {
+				code = "unknown"
+			}
+			r.ErrorCodes[code]++
+		case "cancelled":
+			r.Cancelled++
+			continue
+		default:
+			continue
+		}
+		if !job.StartedAt.IsZero() && job.CompletedAt.After(job.StartedAt) {
+			durations = append(durations, job.CompletedAt.Sub(job.StartedAt).Seconds())
+		}
+	}
+	r.Finished = r.Succeeded + r.Failed
+
+	if r.Finished > 0 {
+		success := float64(r.Succeeded) / float64(r.Finished)
+		failure := float64(r.Failed) / float64(r.Finished)
+		met := success >= target
+		r.SuccessRate, r.FailureRate, r.Met = &success, &failure, &met
+
+		allowed := round((1 - target) * float64(r.Finished))
+		r.ErrorBudget = ErrorBudget{
+			Allowed:   allowed,
+			Consumed:  r.Failed,
+			Remaining: round(allowed - float64(r.Failed)),
+			BurnRate:  round(failure / (1 - target)),
+			Exhausted: float64(r.Failed) > allowed,
+		}
+	}
+	if len(durations) > 0 {
+		sort.Float64s(durations)
+		sum := 0.0
+		for _, d := range durations {
+			sum += d
+		}
+		r.AvgCrawlSeconds = round(sum / float64(len(durations)))
+		r.P95CrawlSeconds = round(durations[int(math.Ceil(0.95*float64(len(durations))))-1])
+	}
+
+	for _, alert := range alerts {
+		if alert.Time.Before(since) {
+			continue
+		}
+		r.Alerts++
+		if r.AlertTypes == nil {
+			r.AlertTypes = make(map[string]int)
+		}
+		r.AlertTypes[alert.Type]++
+	}
+	return r
+}
+
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
@@ -0,0 +1,98 @@
+package soft404
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Reasons a page is taken for an error page
+const (
+	ReasonTitle        = "title"
+	ReasonPhrase       = "phrase"
+	ReasonRedirectHome = "redirect_home"
+	ReasonEmpty        = "empty"
+)
+
+// notFound matches the wording of error pages in titles and headings
+var notFound = regexp.MustCompile(`(?i)\b(404|page not found|not found|file not found|page (does not|doesn't) exist|(cannot|can't|could not|couldn't) be found|no longer (exists|available)|nothing (was )?found|error 404)\b`)
+
+// Size limits below which a page is short enough to be an error page
+const (
+	// phraseWords is the longest page whose body wording alone flags it;
+	// longer pages may merely mention a missing page
+	phraseWords = 150
+	// emptyWords and emptyBytes bound a page with no content at all
+	emptyWords = 5
+	emptyBytes = 512
+)
+
+// Page is what detection looks at
+type Page struct {
+	// RequestedURL is the URL that was asked for; URL is where the
+	// response came from after redirects
+	RequestedURL string
+	URL          string
+	Title        string
+	// Heading is the first h1 of the page
+	Heading string
+	// Text is the visible, whitespace-normalised body text
+	Text string
+	// Size is the length of the raw HTML
+	Size int
+}
+
+// Detect reports whether a page served with a success status is an error
+// page in disguise and why
+func Detect(p Page) (reason string, ok bool) {
+	if redirectedHome(p.RequestedURL, p.URL) {
+		return ReasonRedirectHome, true
+	}
+	if notFound.MatchString(p.Title) || notFound.MatchString(p.Heading) {
+		return ReasonTitle, true
+	}
+
+	words := len(strings.Fields(p.Text))
+	if words <= phraseWords && notFound.MatchString(p.Text) {
+		return ReasonPhrase, true
+	}
+	if words <= emptyWords && p.Size < emptyBytes {
+		return ReasonEmpty, true
+	}
+	return "", false
+}
+
+// redirectedHome reports whether a request for a deep URL ended on the
+// home page of the same site, as sites that redirect missing pages do
+func redirectedHome(requested, final string) bool {
+	if requested == "" || requested == final {
+		return false
+	}
+	from, err := url.Parse(requested)
+	if err != nil {
+		return false
+	}
+	to, err := url.Parse(final)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(site(from.Hostname()), site(to.Hostname())) {
+		return false
+	}
+	return !root(from.Path) && root(to.Path) && to.RawQuery == ""
+}
+
+// root reports whether a path is the home page
+func root(path string) bool {
+	switch strings.ToLower(strings.TrimSuffix(path, "/")) {
+	case "", "/index.html", "/index.htm", "/index.php", "/home":
+		return true
+	}
+	return false
+}
+
+// site strips a leading www so redirects between the bare and www host
+// still count as the same site
+func site(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
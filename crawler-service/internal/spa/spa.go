@@ -0,0 +1,74 @@
+// Package spa recognises pages whose content is rendered by scripts: a
+// static fetch of them finds an application shell with next to no text.
+package spa
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Hints naming why a page is taken for a script-rendered shell
+const (
+	HintNext     = "next"
+	HintNuxt     = "nuxt"
+	HintAngular  = "angular"
+	HintReact    = "react"
+	HintVue      = "vue"
+	HintNoScript = "noscript"
+	HintScripts  = "scripts"
+)
+
+const (
+	// thinWords is the most visible words a shell may show; pages with
+	// more have content worth extracting statically
+	thinWords = 50
+	// heavyScripts and heavyScriptBytes mark pages that ship an
+	// application rather than enhance a document
+	heavyScripts     = 8
+	heavyScriptBytes = 100 << 10
+)
+
+// frameworks match the markers frameworks leave in the HTML they serve
+var frameworks = []struct {
+	hint    string
+	pattern *regexp.Regexp
+}{
+	{HintNext, regexp.MustCompile(`id="__NEXT_DATA__"|/_next/static/`)},
+	{HintNuxt, regexp.MustCompile(`window\.__NUXT__|id="__nuxt"|/_nuxt/`)},
+	{HintAngular, regexp.MustCompile(`ng-version=|<app-root[\s>]`)},
+	{HintReact, regexp.MustCompile(`data-reactroot|<div id="root">\s*</div>`)},
+	{HintVue, regexp.MustCompile(`<div id="app">\s*</div>`)},
+}
+
+// needsJS matches noscript notices asking for JavaScript
+var needsJS = regexp.MustCompile(`(?i)(enable|turn on|requires?)\s+javascript|javascript (is )?(required|disabled)`)
+
+// Detect reports whether a statically fetched page is a script-rendered
+// shell, and the strongest hint that it is. text is the page's visible
+// text and html its raw markup.
+func Detect(doc *goquery.Selection, text, html string) (hint string, ok bool) {
+	if len(strings.Fields(text)) > thinWords {
+		return "", false
+	}
+
+	for _, f := range frameworks {
+		if f.pattern.MatchString(html) {
+			return f.hint, true
+		}
+	}
+	if needsJS.MatchString(doc.Find("noscript").Text()) {
+		return HintNoScript, true
+	}
+
+	scripts := doc.Find("script")
+	inline := 0
+	scripts.Each(func(_ int, s *goquery.Selection) {
+		inline += len(s.Text())
+	})
+	if scripts.Length() >= heavyScripts || inline >= heavyScriptBytes {
+		return HintScripts, true
+	}
+	return "", false
+}
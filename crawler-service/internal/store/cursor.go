@@ -0,0 +1,86 @@
+package store
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// Cursor is a position in the creation order of jobs: jobs are ordered by
+// start time, then ID, so a position stays valid as jobs are added or
+// removed
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// cursorOf returns the position of a job
+func cursorOf(job *models.CrawlJob) Cursor {
+	return Cursor{CreatedAt: job.StartedAt, ID: job.ID}
+}
+
+// IsZero reports whether the cursor is unset, meaning the first page
+func (c Cursor) IsZero() bool {
+	return c.ID == "" && c.CreatedAt.IsZero()
+}
+
+// String encodes the cursor as an opaque token for API clients
+func (c Cursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a token made by Cursor.String; an empty token is the
+// zero cursor
+func ParseCursor(token string) (Cursor, error) {
+	if token == "" {
+		return Cursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil || id == "" {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	return Cursor{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+// before reports whether c comes before other in creation order
+func (c Cursor) before(other Cursor) bool {
+	if !c.CreatedAt.Equal(other.CreatedAt) {
+		return c.CreatedAt.Before(other.CreatedAt)
+	}
+	return c.ID < other.ID
+}
+
+// PageQuery selects a page of jobs
+type PageQuery struct {
+	// After is the cursor of the last job of the previous page; zero for
+	// the first page
+	After Cursor
+	// Limit is the page size; zero returns every remaining job
+	Limit int
+	// Newest lists the most recently created jobs first
+	Newest bool
+	// Match filters the jobs listed; nil lists every job
+	Match func(*models.CrawlJob) bool
+}
+
+// Page is a page of jobs
+type Page struct {
+	Jobs []*models.CrawlJob
+	// Total counts every job matching the query, on all pages
+	Total int
+	// Next is the cursor of the following page; zero on the last page
+	Next Cursor
+}
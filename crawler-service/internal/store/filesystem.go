@@ -0,0 +1,180 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// resultsSuffix names the results file stored next to a job file
+const resultsSuffix = ".results.json"
+
+// Filesystem persists jobs and results as JSON files in a directory,
+// keeping live jobs in memory. It suits single-node and offline use.
+type Filesystem struct {
+	*Memory
+	dir string
+}
+
+// NewFilesystem creates a filesystem store in dir and loads the jobs
+// already saved there
+func NewFilesystem(dir string) (*Filesystem, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory: %w", err)
+	}
+	s := &Filesystem{Memory: NewMemory(), dir: dir}
+
+	loaded, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range loaded {
+		interrupted(job)
+		s.Memory.Put(job)
+	}
+
+	log.WithFields(log.Fields{
+		"dir":  dir,
+		"jobs": len(s.Memory.jobs),
+	}).Info("Jobs loaded from filesystem")
+	return s, nil
+}
+
+// loadAll reads every stored job, skipping unreadable files
+func (s *Filesystem) loadAll() ([]*models.CrawlJob, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	loaded := make([]*models.CrawlJob, 0, len(names))
+	for _, name := range names {
+		if strings.HasSuffix(name, resultsSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			log.WithError(err).WithField("file", name).Warn("Skipping unreadable stored job")
+			continue
+		}
+		var job models.CrawlJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.WithError(err).WithField("file", name).Warn("Skipping corrupt stored job")
+			continue
+		}
+		loaded = append(loaded, &job)
+	}
+	return loaded, nil
+}
+
+// Driver names the backend
+func (s *Filesystem) Driver() string {
+	return DriverFilesystem
+}
+
+// Put stores the job's metadata and, once it has finished, its results
+func (s *Filesystem) Put(job *models.CrawlJob) error {
+	path, err := s.path(job.ID, ".json")
+	if err != nil {
+		return err
+	}
+	s.Memory.Put(job)
+
+	data, err := json.Marshal(metadata(job))
+	if err != nil {
+		return err
+	}
+	if err := writeFile(path, data); err != nil {
+		return err
+	}
+
+	if finished(job) && len(job.Results) > 0 {
+		return s.SaveResults(job.ID, job.Results)
+	}
+	return nil
+}
+
+// Delete removes a job and its results
+func (s *Filesystem) Delete(id string) error {
+	path, err := s.path(id, ".json")
+	if err != nil {
+		return err
+	}
+	s.Memory.Delete(id)
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return s.DeleteResults(id)
+}
+
+// SaveResults stores the results of a job
+func (s *Filesystem) SaveResults(jobID string, results []models.CrawlResult) error {
+	path, err := s.path(jobID, resultsSuffix)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// LoadResults returns the stored results of a job
+func (s *Filesystem) LoadResults(jobID string) ([]models.CrawlResult, error) {
+	path, err := s.path(jobID, resultsSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoResults
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.CrawlResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode stored results: %w", err)
+	}
+	return results, nil
+}
+
+// DeleteResults removes the stored results of a job
+func (s *Filesystem) DeleteResults(jobID string) error {
+	path, err := s.path(jobID, resultsSuffix)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file of a job, rejecting IDs that would escape the
+// store directory
+func (s *Filesystem) path(jobID, suffix string) (string, error) {
+	if jobID == "" || strings.ContainsAny(jobID, `/\`) || strings.HasPrefix(jobID, ".") {
+		return "", fmt.Errorf("invalid job ID %q", jobID)
+	}
+	return filepath.Join(s.dir, jobID+suffix), nil
+}
+
+// writeFile replaces a file atomically
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// Memory keeps jobs in process memory only; nothing survives a restart.
+// Results stay on the job itself.
+type Memory struct {
+	mu   sync.RWMutex
+	jobs map[string]*models.CrawlJob
+	// order holds the jobs sorted by creation, oldest first
+	order []*models.CrawlJob
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{jobs: make(map[string]*models.CrawlJob)}
+}
+
+// Driver names the backend
+func (m *Memory) Driver() string {
+	return DriverMemory
+}
+
+// Get returns a job by ID
+func (m *Memory) Get(id string) (*models.CrawlJob, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// Put adds or replaces a job
+func (m *Memory) Put(job *models.CrawlJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.jobs[job.ID]; ok {
+		if old == job {
+			return nil
+		}
+		m.unorder(old)
+	}
+	m.jobs[job.ID] = job
+
+	pos := cursorOf(job)
+	i := sort.Search(len(m.order), func(i int) bool { return pos.before(cursorOf(m.order[i])) })
+	m.order = append(m.order, nil)
+	copy(m.order[i+1:], m.order[i:])
+	m.order[i] = job
+	return nil
+}
+
+// Delete removes a job
+func (m *Memory) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, ok := m.jobs[id]; ok {
+		m.unorder(job)
+		delete(m.jobs, id)
+	}
+	return nil
+}
+
+// unorder removes a job from the creation order
+func (m *Memory) unorder(job *models.CrawlJob) {
+	for i, j := range m.order {
+		if j == job {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// List returns every job, oldest first
+func (m *Memory) List() ([]*models.CrawlJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*models.CrawlJob(nil), m.order...), nil
+}
+
+// ListPage returns a page of jobs in creation order
+func (m *Memory) ListPage(q PageQuery) (Page, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return pageOf(m.order, q), nil
+}
+
+// Find returns the jobs f selects, oldest first
+func (m *Memory) Find(f JobFilter) ([]*models.CrawlJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var found []*models.CrawlJob
+	for _, job := range m.order {
+		if f.Match(job) {
+			found = append(found, job)
+		}
+	}
+	return found, nil
+}
+
+// Expiring returns the finished jobs whose retention runs out before t
+func (m *Memory) Expiring(t time.Time) ([]*models.CrawlJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var found []*models.CrawlJob
+	for _, job := range m.order {
+		if expiry := Expiry(job); expiry != nil && expiry.Before(t) {
+			found = append(found, job)
+		}
+	}
+	return found, nil
+}
+
+// Stats counts the jobs and the bytes of results stored for them
+func (m *Memory) Stats() (Stats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := Stats{Jobs: len(m.order)}
+	for _, job := range m.order {
+		stats.StorageBytes += job.StorageBytes
+	}
+	return stats, nil
+}
+
+// pageOf returns the page of jobs q selects from jobs in creation order,
+// oldest first
+func pageOf(order []*models.CrawlJob, q PageQuery) Page {
+	var page Page
+	for k := range order {
+		i := k
+		if q.Newest {
+			i = len(order) - 1 - k
+		}
+		job := order[i]
+		if q.Match != nil && !q.Match(job) {
+			continue
+		}
+		page.Total++
+
+		pos := cursorOf(job)
+		if !q.After.IsZero() {
+			if q.Newest && !pos.before(q.After) || !q.Newest && !q.After.before(pos) {
+				continue
+			}
+		}
+		if q.Limit > 0 && len(page.Jobs) == q.Limit {
+			// A further job matches, so the page is not the last
+			page.Next = cursorOf(page.Jobs[len(page.Jobs)-1])
+			continue
+		}
+		page.Jobs = append(page.Jobs, job)
+	}
+	return page
+}
+
+// SaveResults is a no-op: in memory, results are kept on the job
+func (m *Memory) SaveResults(string, []models.CrawlResult) error {
+	return nil
+}
+
+// LoadResults always reports no results, as they are kept on the job
+func (m *Memory) LoadResults(string) ([]models.CrawlResult, error) {
+	return nil, ErrNoResults
+}
+
+// DeleteResults is a no-op: in memory, results are kept on the job
+func (m *Memory) DeleteResults(string) error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrJobExists is returned when importing a job the store already holds
+var ErrJobExists = errors.New("job already exists")
+
+// MigrateReport counts the jobs a migration or import moved
+type MigrateReport struct {
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Failed   int      `json:"failed"`
+	Results  int      `json:"results"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// maxReportedErrors caps the errors a report lists
+const maxReportedErrors = 50
+
+// Record counts the outcome of importing one job
+func (r *MigrateReport) Record(job *models.CrawlJob, err error) {
+	switch {
+	case err == nil:
+		r.Imported++
+		r.Results += len(job.Results)
+	case errors.Is(err, ErrJobExists):
+		r.Skipped++
+	default:
+		r.Failed++
+		if len(r.Errors) < maxReportedErrors {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s: %v", job.ID, err))
+		}
+	}
+}
+
+// Import stores a job carrying its results, as exported by a legacy store
+// or another instance. Unless overwrite is set, a job the store already
+// holds is left alone and ErrJobExists returned. Jobs that were still in
+// progress are imported failed, as they are when a store is reopened.
+func Import(dst Store, job *models.CrawlJob, overwrite bool) error {
+	if job.ID == "" {
+		return errors.New("job has no ID")
+	}
+	if _, exists := dst.Get(job.ID); exists && !overwrite {
+		return ErrJobExists
+	}
+	interrupted(job)
+	return dst.Put(job)
+}
+
+// Migrate copies every job of src, with its results, into dst. It reads
+// src only, so a failed migration can be run again; jobs already in dst
+// are skipped unless overwrite is set.
+func Migrate(src, dst Store, overwrite bool) MigrateReport {
+	var report MigrateReport
+	jobs, err := src.List()
+	if err != nil {
+		report.Failed++
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+	for _, job := range jobs {
+		copied := *job
+		results, err := src.LoadResults(job.ID)
+		switch {
+		case err == nil:
+			copied.Results = results
+		case !errors.Is(err, ErrNoResults):
+			report.Record(&copied, fmt.Errorf("failed to load results: %w", err))
+			continue
+		}
+
+		err = Import(dst, &copied, overwrite)
+		report.Record(&copied, err)
+		if err != nil && !errors.Is(err, ErrJobExists) {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to migrate job")
+		}
+	}
+	return report
+}
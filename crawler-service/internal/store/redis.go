@@ -0,0 +1,754 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Redis keys of the redis driver
+const (
+	redisJobPrefix    = "job:"
+	redisResultPrefix = "job_results:"
+	// redisJobOrder is a sorted set of every job, all scored 0 so they
+	// sort by member: the job's position (see orderMember)
+	redisJobOrder = "jobs:order"
+	// redisJobPositions maps job IDs to their members of redisJobOrder
+	redisJobPositions = "jobs:positions"
+	// redisTenantPrefix and redisKeyPrefix index, in creation order, the
+	// jobs of each tenant and of each API key
+	redisTenantPrefix = "jobs:tenant:"
+	redisKeyPrefix    = "jobs:apikey:"
+	// redisUnfinished indexes, in creation order, the jobs not yet finished
+	redisUnfinished = "jobs:unfinished"
+	// redisExpiry is a sorted set of the finished jobs with a retention,
+	// scored by when it runs out
+	redisExpiry = "jobs:expiry"
+	// redisStorageBytes maps job IDs to the bytes of results stored for
+	// them
+	redisStorageBytes = "jobs:storage_bytes"
+	// redisIndexVersion is the version of the indexes the store was last
+	// built with
+	redisIndexVersion = "jobs:index_version"
+	// redisLeasePrefix holds the instance running an unfinished job, for
+	// as long as it keeps renewing it
+	redisLeasePrefix = "job_lease:"
+	// redisLegacyIndex is the set of job IDs earlier versions kept
+	redisLegacyIndex = "jobs"
+)
+
+const (
+	// redisTimeout bounds every Redis round trip of the driver
+	redisTimeout = 10 * time.Second
+	// leaseTTL is how long an instance that stopped renewing its jobs'
+	// leases is still taken to be running them
+	leaseTTL     = 30 * time.Second
+	leaseRenewal = 10 * time.Second
+	// recoverInterval is how often jobs whose instance is gone are looked
+	// for, and the index is cleared of expired jobs
+	recoverInterval = time.Minute
+	// loadBatch is how many jobs are read in one round trip
+	loadBatch = 500
+	// indexVersion is bumped when indexes are added, so stores opened by
+	// earlier versions are indexed again
+	indexVersion = "2"
+)
+
+// Redis persists jobs and results in Redis, which is the source of truth
+// for every instance sharing it. The only jobs kept in memory are the
+// unfinished ones this instance runs, which the crawler updates in place;
+// every other job is read from Redis when asked for. Each instance holds a
+// lease on the jobs it runs and renews it while it is up, so the jobs of an
+// instance that stopped are marked interrupted once their lease expires.
+type Redis struct {
+	rdb *redis.Client
+	// ttl expires finished jobs and their results; zero keeps them
+	ttl time.Duration
+	// owner names this instance in the leases it holds
+	owner string
+
+	mu   sync.RWMutex
+	live map[string]*models.CrawlJob
+}
+
+// openRedis returns a Redis store without loading or recovering anything.
+// JOB_STORE_TTL (e.g. 720h) expires jobs that long after they finish.
+func openRedis(rdb *redis.Client) *Redis {
+	s := &Redis{
+		rdb:   rdb,
+		owner: uuid.New().String(),
+		live:  make(map[string]*models.CrawlJob),
+	}
+	if d, err := time.ParseDuration(os.Getenv("JOB_STORE_TTL")); err == nil && d > 0 {
+		s.ttl = d
+	}
+	return s
+}
+
+// NewRedis creates a Redis store. Jobs left unfinished by instances whose
+// lease has expired are marked interrupted now and whenever it is noticed
+// later.
+func NewRedis(rdb *redis.Client) (*Redis, error) {
+	s := openRedis(rdb)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := s.migrateIndex(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.buildIndexes(ctx); err != nil {
+		return nil, err
+	}
+	total, recovered, err := s.recoverOrphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go s.maintain()
+
+	log.WithFields(log.Fields{
+		"jobs":        total,
+		"interrupted": recovered,
+	}).Info("Job store opened in Redis")
+	return s, nil
+}
+
+// Driver names the backend
+func (s *Redis) Driver() string {
+	return DriverRedis
+}
+
+// orderMember returns the member of redisJobOrder placing a job in
+// creation order: its start time as a fixed-width number, then its ID, so
+// members sort as cursors do
+func orderMember(job *models.CrawlJob) string {
+	return positionOf(cursorOf(job))
+}
+
+// positionOf returns the member of redisJobOrder a cursor stands at
+func positionOf(c Cursor) string {
+	return fmt.Sprintf("%020d:%s", uint64(c.CreatedAt.UnixNano())^(1<<63), c.ID)
+}
+
+// migrateIndex moves the jobs of the index earlier versions kept into the
+// creation order
+func (s *Redis) migrateIndex(ctx context.Context) error {
+	ids, err := s.rdb.SMembers(ctx, redisLegacyIndex).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list stored jobs: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, id := range ids {
+		job, err := s.load(ctx, s.rdb, id)
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithField("job_id", id).Warn("Skipping unreadable stored job")
+			continue
+		}
+		member := orderMember(job)
+		pipe := s.rdb.TxPipeline()
+		pipe.ZAdd(ctx, redisJobOrder, &redis.Z{Member: member})
+		pipe.HSet(ctx, redisJobPositions, id, member)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to index stored jobs: %w", err)
+		}
+	}
+	log.WithField("jobs", len(ids)).Info("Job index migrated to creation order")
+	return s.rdb.Del(ctx, redisLegacyIndex).Err()
+}
+
+// buildIndexes indexes every stored job by tenant, API key, status,
+// retention and size, unless the store was indexed by this version
+func (s *Redis) buildIndexes(ctx context.Context) error {
+	version, err := s.rdb.Get(ctx, redisIndexVersion).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to read the job index version: %w", err)
+	}
+	if version == indexVersion {
+		return nil
+	}
+	jobs, err := s.loadAll(ctx)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(jobs); start += loadBatch {
+		pipe := s.rdb.Pipeline()
+		for _, job := range jobs[start:min(start+loadBatch, len(jobs))] {
+			indexJob(ctx, pipe, job, orderMember(job))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to index stored jobs: %w", err)
+		}
+	}
+	log.WithField("jobs", len(jobs)).Info("Stored jobs indexed")
+	return s.rdb.Set(ctx, redisIndexVersion, indexVersion, 0).Err()
+}
+
+// indexesOf returns the creation-order indexes a job is listed in besides
+// the one of every job
+func indexesOf(job *models.CrawlJob) []string {
+	indexes := []string{redisTenantPrefix + job.Tenant}
+	if job.APIKey != "" {
+		indexes = append(indexes, redisKeyPrefix+job.APIKey)
+	}
+	return indexes
+}
+
+// indexJob queues the commands listing a job, at member, in the indexes
+func indexJob(ctx context.Context, pipe redis.Pipeliner, job *models.CrawlJob, member string) {
+	pipe.ZAdd(ctx, redisJobOrder, &redis.Z{Member: member})
+	pipe.HSet(ctx, redisJobPositions, job.ID, member)
+	for _, index := range indexesOf(job) {
+		pipe.ZAdd(ctx, index, &redis.Z{Member: member})
+	}
+	if finished(job) {
+		pipe.ZRem(ctx, redisUnfinished, member)
+	} else {
+		pipe.ZAdd(ctx, redisUnfinished, &redis.Z{Member: member})
+	}
+	if expiry := Expiry(job); expiry != nil {
+		pipe.ZAdd(ctx, redisExpiry, &redis.Z{Score: float64(expiry.Unix()), Member: member})
+	} else {
+		pipe.ZRem(ctx, redisExpiry, member)
+	}
+	if job.StorageBytes > 0 {
+		pipe.HSet(ctx, redisStorageBytes, job.ID, job.StorageBytes)
+	} else {
+		pipe.HDel(ctx, redisStorageBytes, job.ID)
+	}
+}
+
+// unlist queues the commands dropping the job at member from the indexes;
+// indexes names those of its tenant and API key, when known
+func unlist(ctx context.Context, pipe redis.Pipeliner, member string, indexes ...string) {
+	for _, index := range append(indexes, redisJobOrder, redisUnfinished, redisExpiry) {
+		pipe.ZRem(ctx, index, member)
+	}
+}
+
+// maintain renews the leases of the jobs this instance runs and recovers
+// the jobs of instances that stopped, until the process exits
+func (s *Redis) maintain() {
+	renew := time.NewTicker(leaseRenewal)
+	defer renew.Stop()
+	orphans := time.NewTicker(recoverInterval)
+	defer orphans.Stop()
+	for {
+		select {
+		case <-renew.C:
+			if err := s.renewLeases(); err != nil {
+				log.WithError(err).Warn("Failed to renew job leases")
+			}
+		case <-orphans.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if _, recovered, err := s.recoverOrphans(ctx); err != nil {
+				log.WithError(err).Warn("Failed to recover interrupted jobs")
+			} else if recovered > 0 {
+				log.WithField("jobs", recovered).Info("Marked jobs of stopped instances interrupted")
+			}
+			cancel()
+		}
+	}
+}
+
+// renewLeases extends the leases of the jobs this instance runs
+func (s *Redis) renewLeases() error {
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.live))
+	for id := range s.live {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	pipe := s.rdb.Pipeline()
+	for _, id := range ids {
+		pipe.Set(ctx, redisLeasePrefix+id, s.owner, leaseTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// recoverOrphans marks interrupted the unfinished jobs no instance holds a
+// lease on, returning how many jobs are stored and how many it marked
+func (s *Redis) recoverOrphans(ctx context.Context) (int, int, error) {
+	total, err := s.rdb.ZCard(ctx, redisJobOrder).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count stored jobs: %w", err)
+	}
+	jobs, err := s.find(ctx, redisUnfinished, "-")
+	if err != nil {
+		return 0, 0, err
+	}
+	recovered := 0
+	for _, job := range jobs {
+		if finished(job) || s.running(job.ID) {
+			continue
+		}
+		marked, err := s.interruptOrphan(ctx, job.ID)
+		if err != nil {
+			log.WithError(err).WithField("job_id", job.ID).Warn("Failed to recover interrupted job")
+			continue
+		}
+		if marked {
+			recovered++
+		}
+	}
+	return int(total), recovered, nil
+}
+
+// interruptOrphan marks a job interrupted unless it has finished or an
+// instance holds its lease. The job is watched while it is checked, so a
+// job its instance saves meanwhile is left as saved.
+func (s *Redis) interruptOrphan(ctx context.Context, id string) (bool, error) {
+	marked := false
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		leased, err := tx.Exists(ctx, redisLeasePrefix+id).Result()
+		if err != nil || leased > 0 {
+			return err
+		}
+		job, err := s.load(ctx, tx, id)
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil || finished(job) {
+			return err
+		}
+
+		interrupted(job)
+		data, err := json.Marshal(metadata(job))
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, redisJobPrefix+id, data, s.expiry(job))
+			indexJob(ctx, pipe, job, orderMember(job))
+			return nil
+		})
+		marked = err == nil
+		return err
+	}, redisJobPrefix+id, redisLeasePrefix+id)
+	if err == redis.TxFailedErr {
+		// Saved meanwhile, so someone is looking after it
+		return false, nil
+	}
+	return marked, err
+}
+
+// running reports whether a job is one this instance runs
+func (s *Redis) running(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.live[id]
+	return ok
+}
+
+// loadAll reads every stored job in creation order, taking the jobs this
+// instance runs from memory. Jobs that expired are dropped from the index.
+func (s *Redis) loadAll(ctx context.Context) ([]*models.CrawlJob, error) {
+	return s.find(ctx, redisJobOrder, "-")
+}
+
+// find reads the jobs of a creation-order index from the position min on
+func (s *Redis) find(ctx context.Context, index, min string) ([]*models.CrawlJob, error) {
+	members, err := s.rdb.ZRangeByLex(ctx, index, &redis.ZRangeBy{Min: min, Max: "+"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored jobs: %w", err)
+	}
+	return s.loadMembers(ctx, index, members)
+}
+
+// loadMembers reads the jobs of members of an index, in their order
+func (s *Redis) loadMembers(ctx context.Context, index string, members []string) ([]*models.CrawlJob, error) {
+	loaded := make([]*models.CrawlJob, 0, len(members))
+	for start := 0; start < len(members); start += loadBatch {
+		batch := members[start:min(start+loadBatch, len(members))]
+		keys := make([]string, len(batch))
+		for i, member := range batch {
+			keys[i] = redisJobPrefix + member[21:]
+		}
+		values, err := s.rdb.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stored jobs: %w", err)
+		}
+
+		var expired []string
+		for i, value := range values {
+			id := batch[i][21:]
+			if job, ok := s.liveJob(id); ok {
+				loaded = append(loaded, job)
+				continue
+			}
+			data, ok := value.(string)
+			if !ok {
+				expired = append(expired, batch[i])
+				continue
+			}
+			job, err := decodeJob([]byte(data))
+			if err != nil {
+				log.WithError(err).WithField("job_id", id).Warn("Skipping unreadable stored job")
+				continue
+			}
+			loaded = append(loaded, job)
+		}
+		if len(expired) > 0 {
+			s.unindex(ctx, index, expired)
+		}
+	}
+	return loaded, nil
+}
+
+// unindex drops the entries of jobs whose keys expired from the index they
+// were found in and the indexes of every job. The entries in the indexes
+// of their tenant and key go when those are read.
+func (s *Redis) unindex(ctx context.Context, index string, members []string) {
+	pipe := s.rdb.Pipeline()
+	for _, member := range members {
+		unlist(ctx, pipe, member, index)
+		pipe.HDel(ctx, redisJobPositions, member[21:])
+		pipe.HDel(ctx, redisStorageBytes, member[21:])
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.WithError(err).Warn("Failed to drop expired jobs from the index")
+	}
+}
+
+// liveJob returns a job this instance runs
+func (s *Redis) liveJob(id string) (*models.CrawlJob, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.live[id]
+	return job, ok
+}
+
+// load reads a stored job; it returns redis.Nil when there is none
+func (s *Redis) load(ctx context.Context, rdb redis.Cmdable, id string) (*models.CrawlJob, error) {
+	data, err := rdb.Get(ctx, redisJobPrefix+id).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return decodeJob(data)
+}
+
+func decodeJob(data []byte) (*models.CrawlJob, error) {
+	var job models.CrawlJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode stored job: %w", err)
+	}
+	return &job, nil
+}
+
+// Get returns a job by ID: the live job when this instance runs it,
+// otherwise the job as stored now
+func (s *Redis) Get(id string) (*models.CrawlJob, bool) {
+	if job, ok := s.liveJob(id); ok {
+		return job, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	job, err := s.load(ctx, s.rdb, id)
+	if err != nil {
+		if err != redis.Nil {
+			log.WithError(err).WithField("job_id", id).Warn("Failed to read stored job")
+		}
+		return nil, false
+	}
+	return job, true
+}
+
+// List returns every stored job, oldest first
+func (s *Redis) List() ([]*models.CrawlJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return s.loadAll(ctx)
+}
+
+// Find returns the jobs f selects, oldest first. They are read from the
+// smallest index f narrows them to: the unfinished jobs, the key's or the
+// tenant's, from f.Since on.
+func (s *Redis) Find(f JobFilter) ([]*models.CrawlJob, error) {
+	index := redisJobOrder
+	switch {
+	case f.Unfinished:
+		index = redisUnfinished
+	case f.APIKey != "":
+		index = redisKeyPrefix + f.APIKey
+	case f.Tenant != "":
+		index = redisTenantPrefix + f.Tenant
+	}
+	min := "-"
+	if !f.Since.IsZero() {
+		min = "[" + positionOf(Cursor{CreatedAt: f.Since})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	jobs, err := s.find(ctx, index, min)
+	if err != nil {
+		return nil, err
+	}
+	found := jobs[:0]
+	for _, job := range jobs {
+		if f.Match(job) {
+			found = append(found, job)
+		}
+	}
+	return found, nil
+}
+
+// Expiring returns the finished jobs whose retention runs out before t
+func (s *Redis) Expiring(t time.Time) ([]*models.CrawlJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	members, err := s.rdb.ZRangeByScore(ctx, redisExpiry, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(t.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expiring jobs: %w", err)
+	}
+	jobs, err := s.loadMembers(ctx, redisExpiry, members)
+	if err != nil {
+		return nil, err
+	}
+	found := jobs[:0]
+	for _, job := range jobs {
+		if expiry := Expiry(job); expiry != nil && expiry.Before(t) {
+			found = append(found, job)
+		}
+	}
+	return found, nil
+}
+
+// Stats counts the stored jobs and the bytes of results stored for them
+// from the indexes
+func (s *Redis) Stats() (Stats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	pipe := s.rdb.Pipeline()
+	count := pipe.ZCard(ctx, redisJobOrder)
+	sizes := pipe.HVals(ctx, redisStorageBytes)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Stats{}, fmt.Errorf("failed to read job store stats: %w", err)
+	}
+	stats := Stats{Jobs: int(count.Val())}
+	for _, size := range sizes.Val() {
+		n, _ := strconv.ParseInt(size, 10, 64)
+		stats.StorageBytes += n
+	}
+	return stats, nil
+}
+
+// ListPage returns a page of stored jobs in creation order. Unfiltered
+// pages are read from the index alone; filtered ones read every job, as
+// Total counts them all.
+func (s *Redis) ListPage(q PageQuery) (Page, error) {
+	if q.Match != nil || q.Limit <= 0 {
+		jobs, err := s.List()
+		if err != nil {
+			return Page{}, err
+		}
+		return pageOf(jobs, q), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	rng := &redis.ZRangeBy{Min: "-", Max: "+", Count: int64(q.Limit) + 1}
+	var members []string
+	total, err := s.rdb.ZCard(ctx, redisJobOrder).Result()
+	if err == nil {
+		if q.Newest {
+			if !q.After.IsZero() {
+				rng.Max = "(" + positionOf(q.After)
+			}
+			members, err = s.rdb.ZRevRangeByLex(ctx, redisJobOrder, rng).Result()
+		} else {
+			if !q.After.IsZero() {
+				rng.Min = "(" + positionOf(q.After)
+			}
+			members, err = s.rdb.ZRangeByLex(ctx, redisJobOrder, rng).Result()
+		}
+	}
+	var loaded []*models.CrawlJob
+	if err == nil {
+		loaded, err = s.loadMembers(ctx, redisJobOrder, members)
+	}
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to list stored jobs: %w", err)
+	}
+
+	page := Page{Jobs: loaded, Total: int(total)}
+	if len(loaded) > q.Limit {
+		page.Jobs = loaded[:q.Limit]
+		page.Next = cursorOf(page.Jobs[q.Limit-1])
+	}
+	return page, nil
+}
+
+// expiry returns how long a job's keys are kept: ttl once it has finished,
+// forever before
+func (s *Redis) expiry(job *models.CrawlJob) time.Duration {
+	if finished(job) {
+		return s.ttl
+	}
+	return 0
+}
+
+// claim takes or renews the lease of an unfinished job, reporting whether
+// this instance holds it. A job leased by another instance is theirs.
+func (s *Redis) claim(ctx context.Context, id string) (bool, error) {
+	ok, err := s.rdb.SetNX(ctx, redisLeasePrefix+id, s.owner, leaseTTL).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+	holder, err := s.rdb.Get(ctx, redisLeasePrefix+id).Result()
+	if err == redis.Nil {
+		return s.claim(ctx, id)
+	}
+	if err != nil || holder != s.owner {
+		return false, err
+	}
+	return true, s.rdb.Expire(ctx, redisLeasePrefix+id, leaseTTL).Err()
+}
+
+// Put stores the job's metadata and, once it has finished, its results.
+// An unfinished job is leased to this instance and kept in memory unless
+// another instance runs it; a finished one is released.
+func (s *Redis) Put(job *models.CrawlJob) error {
+	data, err := json.Marshal(metadata(job))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	owned := false
+	if !finished(job) {
+		if owned, err = s.claim(ctx, job.ID); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	if owned {
+		s.live[job.ID] = job
+	} else {
+		delete(s.live, job.ID)
+	}
+	s.mu.Unlock()
+
+	member := orderMember(job)
+	previous, err := s.rdb.HGet(ctx, redisJobPositions, job.ID).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, redisJobPrefix+job.ID, data, s.expiry(job))
+	if previous != "" && previous != member {
+		unlist(ctx, pipe, previous, indexesOf(job)...)
+	}
+	indexJob(ctx, pipe, job, member)
+	if finished(job) {
+		pipe.Del(ctx, redisLeasePrefix+job.ID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if finished(job) && len(job.Results) > 0 {
+		return s.SaveResults(job.ID, job.Results)
+	}
+	return nil
+}
+
+// Delete removes a job and its results
+func (s *Redis) Delete(id string) error {
+	s.mu.Lock()
+	delete(s.live, id)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	member, err := s.rdb.HGet(ctx, redisJobPositions, id).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	var indexes []string
+	if job, err := s.load(ctx, s.rdb, id); err == nil {
+		indexes = indexesOf(job)
+	} else if err != redis.Nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, redisJobPrefix+id, redisResultPrefix+id, redisLeasePrefix+id)
+	if member != "" {
+		unlist(ctx, pipe, member, indexes...)
+	}
+	pipe.HDel(ctx, redisJobPositions, id)
+	pipe.HDel(ctx, redisStorageBytes, id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// SaveResults stores the results of a job; with JOB_STORE_TTL they expire
+// with it
+func (s *Redis) SaveResults(jobID string, results []models.CrawlResult) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.rdb.Set(ctx, redisResultPrefix+jobID, data, s.ttl).Err()
+}
+
+// LoadResults returns the stored results of a job
+func (s *Redis) LoadResults(jobID string) ([]models.CrawlResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := s.rdb.Get(ctx, redisResultPrefix+jobID).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNoResults
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.CrawlResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode stored results: %w", err)
+	}
+	return results, nil
+}
+
+// DeleteResults removes the stored results of a job
+func (s *Redis) DeleteResults(jobID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.rdb.Del(ctx, redisResultPrefix+jobID).Err()
+}
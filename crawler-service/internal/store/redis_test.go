@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// testRedis returns an in-memory Redis and a client of it
+func testRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, rdb
+}
+
+// ids returns the IDs of jobs, in order
+func ids(jobs []*models.CrawlJob) []string {
+	list := make([]string, len(jobs))
+	for i, job := range jobs {
+		list[i] = job.ID
+	}
+	return list
+}
+
+func equalIDs(got []*models.CrawlJob, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i, id := range ids(got) {
+		if id != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRedisRecoversJobsOfStoppedInstances(t *testing.T) {
+	mr, rdb := testRedis(t)
+	ctx := context.Background()
+	started := time.Now().UTC()
+
+	running := openRedis(rdb)
+	if err := running.Put(&models.CrawlJob{ID: "running", Status: "running", StartedAt: started}); err != nil {
+		t.Fatal(err)
+	}
+	if err := running.Put(&models.CrawlJob{ID: "done", Status: "completed", StartedAt: started}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance leaves the job alone while its lease is held
+	other := openRedis(rdb)
+	total, recovered, err := other.recoverOrphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || recovered != 0 {
+		t.Errorf("recoverOrphans = %d jobs, %d recovered; want 2, 0", total, recovered)
+	}
+	if job, _ := other.Get("running"); job.Status != "running" {
+		t.Errorf("leased job status = %s, want running", job.Status)
+	}
+
+	// A renewed lease keeps it
+	mr.FastForward(leaseTTL / 2)
+	if err := running.renewLeases(); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(leaseTTL / 2)
+	if _, recovered, _ := other.recoverOrphans(ctx); recovered != 0 {
+		t.Errorf("job with a renewed lease recovered")
+	}
+
+	// Once the lease runs out the job is marked interrupted, and only once
+	mr.FastForward(leaseTTL)
+	if _, recovered, _ := other.recoverOrphans(ctx); recovered != 1 {
+		t.Errorf("recovered %d jobs after the lease expired, want 1", recovered)
+	}
+	job, _ := other.Get("running")
+	if job.Status != "failed" || job.ErrorCode != errcode.Interrupted {
+		t.Errorf("orphaned job = %s (%s), want failed (%s)", job.Status, job.ErrorCode, errcode.Interrupted)
+	}
+	if _, recovered, _ := other.recoverOrphans(ctx); recovered != 0 {
+		t.Errorf("interrupted job recovered again")
+	}
+	if unfinished, _ := other.Find(JobFilter{Unfinished: true}); len(unfinished) != 0 {
+		t.Errorf("interrupted job still indexed unfinished: %v", ids(unfinished))
+	}
+}
+
+func TestRedisClaimKeepsOtherInstancesJobs(t *testing.T) {
+	_, rdb := testRedis(t)
+	a, b := openRedis(rdb), openRedis(rdb)
+	job := &models.CrawlJob{ID: "job", Status: "running", StartedAt: time.Now().UTC()}
+
+	if err := a.Put(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(job); err != nil {
+		t.Fatal(err)
+	}
+	if !a.running("job") || b.running("job") {
+		t.Errorf("running on a = %v, on b = %v; want only a", a.running("job"), b.running("job"))
+	}
+}
+
+func TestRedisFindReadsIndexes(t *testing.T) {
+	_, rdb := testRedis(t)
+	s := openRedis(rdb)
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	jobs := []*models.CrawlJob{
+		{ID: "a1", Tenant: "acme", APIKey: "ci", Status: "completed", StartedAt: day, CompletedAt: day.Add(time.Hour), RetentionHours: 24, StorageBytes: 100},
+		{ID: "a2", Tenant: "acme", APIKey: "ci", Status: "running", StartedAt: day.Add(2 * time.Hour)},
+		{ID: "a3", Tenant: "acme", Status: "failed", StartedAt: day.Add(3 * time.Hour), CompletedAt: day.Add(4 * time.Hour), StorageBytes: 50},
+		{ID: "b1", Tenant: "other", APIKey: "batch", Status: "pending", StartedAt: day.Add(time.Hour)},
+	}
+	for _, job := range jobs {
+		if err := s.Put(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter JobFilter
+		want   []string
+	}{
+		{"all", JobFilter{}, []string{"a1", "b1", "a2", "a3"}},
+		{"tenant", JobFilter{Tenant: "acme"}, []string{"a1", "a2", "a3"}},
+		{"tenant since", JobFilter{Tenant: "acme", Since: day.Add(2 * time.Hour)}, []string{"a2", "a3"}},
+		{"key", JobFilter{APIKey: "ci"}, []string{"a1", "a2"}},
+		{"unfinished", JobFilter{Unfinished: true}, []string{"b1", "a2"}},
+		{"key unfinished", JobFilter{APIKey: "ci", Unfinished: true}, []string{"a2"}},
+		{"unknown tenant", JobFilter{Tenant: "nobody"}, nil},
+	}
+	for _, tt := range tests {
+		found, err := s.Find(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !equalIDs(found, tt.want...) {
+			t.Errorf("%s: found %v, want %v", tt.name, ids(found), tt.want)
+		}
+	}
+
+	// The job finishing leaves the unfinished index
+	jobs[1].Status = "completed"
+	if err := s.Put(jobs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := s.Find(JobFilter{Unfinished: true}); !equalIDs(found, "b1") {
+		t.Errorf("unfinished after completion = %v, want [b1]", ids(found))
+	}
+
+	expiring, err := s.Expiring(day.Add(26 * time.Hour))
+	if err != nil || !equalIDs(expiring, "a1") {
+		t.Errorf("Expiring = %v, %v; want [a1]", ids(expiring), err)
+	}
+	if expiring, _ := s.Expiring(day.Add(24 * time.Hour)); len(expiring) != 0 {
+		t.Errorf("Expiring before retention ran out = %v", ids(expiring))
+	}
+
+	stats, err := s.Stats()
+	if err != nil || stats.Jobs != 4 || stats.StorageBytes != 150 {
+		t.Errorf("Stats = %+v, %v; want 4 jobs, 150 bytes", stats, err)
+	}
+
+	if err := s.Delete("a1"); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := s.Find(JobFilter{APIKey: "ci"}); !equalIDs(found, "a2") {
+		t.Errorf("key's jobs after delete = %v, want [a2]", ids(found))
+	}
+	if expiring, _ := s.Expiring(day.Add(26 * time.Hour)); len(expiring) != 0 {
+		t.Errorf("deleted job still expiring: %v", ids(expiring))
+	}
+	if stats, _ := s.Stats(); stats.Jobs != 3 || stats.StorageBytes != 50 {
+		t.Errorf("Stats after delete = %+v, want 3 jobs, 50 bytes", stats)
+	}
+}
+
+func TestRedisDropsExpiredJobsFromIndexes(t *testing.T) {
+	mr, rdb := testRedis(t)
+	t.Setenv("JOB_STORE_TTL", "1h")
+	s := openRedis(rdb)
+	now := time.Now().UTC()
+
+	if err := s.Put(&models.CrawlJob{ID: "old", Tenant: "acme", Status: "completed", StartedAt: now, StorageBytes: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(&models.CrawlJob{ID: "new", Tenant: "acme", Status: "running", StartedAt: now.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Hour)
+
+	if found, err := s.Find(JobFilter{Tenant: "acme"}); err != nil || !equalIDs(found, "new") {
+		t.Errorf("Find = %v, %v; want [new]", ids(found), err)
+	}
+	if members, _ := rdb.ZRange(context.Background(), redisTenantPrefix+"acme", 0, -1).Result(); len(members) != 1 {
+		t.Errorf("tenant index = %v, want the expired job dropped", members)
+	}
+	if stats, _ := s.Stats(); stats.Jobs != 1 || stats.StorageBytes != 0 {
+		t.Errorf("Stats = %+v, want the expired job dropped", stats)
+	}
+}
+
+func TestRedisIndexesStoresOfEarlierVersions(t *testing.T) {
+	_, rdb := testRedis(t)
+	ctx := context.Background()
+	started := time.Now().UTC()
+
+	// Jobs as an earlier version kept them, in the creation order only
+	for _, job := range []*models.CrawlJob{
+		{ID: "a", Tenant: "acme", APIKey: "ci", Status: "completed", StartedAt: started},
+		{ID: "b", Tenant: "other", Status: "completed", StartedAt: started.Add(time.Second)},
+	} {
+		data, _ := json.Marshal(job)
+		rdb.Set(ctx, redisJobPrefix+job.ID, data, 0)
+		rdb.ZAdd(ctx, redisJobOrder, &redis.Z{Member: orderMember(job)})
+		rdb.HSet(ctx, redisJobPositions, job.ID, orderMember(job))
+	}
+
+	s, err := NewRedis(rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := s.Find(JobFilter{Tenant: "acme"}); !equalIDs(found, "a") {
+		t.Errorf("tenant's jobs = %v, want [a]", ids(found))
+	}
+	if found, _ := s.Find(JobFilter{APIKey: "ci"}); !equalIDs(found, "a") {
+		t.Errorf("key's jobs = %v, want [a]", ids(found))
+	}
+	if version, _ := rdb.Get(ctx, redisIndexVersion).Result(); version != indexVersion {
+		t.Errorf("index version = %q, want %q", version, indexVersion)
+	}
+}
+
+func TestRedisListReturnsErrors(t *testing.T) {
+	mr, rdb := testRedis(t)
+	s := openRedis(rdb)
+	if err := s.Put(&models.CrawlJob{ID: "job", Status: "completed", StartedAt: time.Now().UTC()}); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	if jobs, err := s.List(); err == nil {
+		t.Errorf("List with Redis failing = %v, nil", ids(jobs))
+	}
+	if _, err := s.ListPage(PageQuery{Limit: 10}); err == nil {
+		t.Error("ListPage with Redis failing returned no error")
+	}
+	if _, err := s.Find(JobFilter{Tenant: "acme"}); err == nil {
+		t.Error("Find with Redis failing returned no error")
+	}
+}
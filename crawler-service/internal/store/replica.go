@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrReadOnly is returned for writes to a read replica
+var ErrReadOnly = errors.New("job store is a read-only replica")
+
+// defaultReplicaRefresh is how often a replica reloads the shared store
+const defaultReplicaRefresh = 5 * time.Second
+
+// Replica serves the jobs other instances save in a shared store, reloading
+// them periodically. It never writes to the store: jobs in progress are not
+// marked interrupted when loaded, and Put, Delete and SaveResults fail
+// with ErrReadOnly.
+type Replica struct {
+	// backend reads single jobs and results; its own memory stays empty
+	backend Store
+	loadAll func(ctx context.Context) ([]*models.CrawlJob, error)
+
+	mu      sync.RWMutex
+	current *Memory
+}
+
+// OpenReplicaFromEnv opens the store selected by JOB_STORE_DRIVER, which
+// must be redis or filesystem, as a read replica. It reloads the jobs
+// every REPLICA_REFRESH_INTERVAL (default 5s).
+func OpenReplicaFromEnv() (*Replica, error) {
+	refresh := defaultReplicaRefresh
+	if d, err := time.ParseDuration(os.Getenv("REPLICA_REFRESH_INTERVAL")); err == nil && d > 0 {
+		refresh = d
+	}
+	return OpenReplica(os.Getenv("JOB_STORE_DRIVER"), os.Getenv("JOB_STORE_DIR"), refresh)
+}
+
+// OpenReplica opens the shared store of a driver read-only, reloading its
+// jobs every refresh
+func OpenReplica(driver, dir string, refresh time.Duration) (*Replica, error) {
+	r := &Replica{}
+	switch driver = strings.ToLower(driver); driver {
+	case DriverRedis:
+		rdb := database.GetRedisClient()
+		if rdb == nil {
+			return nil, errors.New("a read replica of the redis job store needs Redis")
+		}
+		s := openRedis(rdb)
+		r.backend, r.loadAll = s, s.loadAll
+	case DriverFilesystem, "json":
+		if dir == "" {
+			dir = "./data/jobs"
+		}
+		s := &Filesystem{Memory: NewMemory(), dir: dir}
+		r.backend = s
+		r.loadAll = func(context.Context) ([]*models.CrawlJob, error) {
+			return s.loadAll()
+		}
+	case "", DriverMemory:
+		return nil, errors.New("a read replica needs a shared job store, redis or filesystem")
+	default:
+		return nil, fmt.Errorf("unknown job store driver %q", driver)
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := r.reload(); err != nil {
+				log.WithError(err).Warn("Failed to reload replicated jobs")
+			}
+		}
+	}()
+
+	log.WithFields(log.Fields{
+		"driver":  r.backend.Driver(),
+		"refresh": refresh.String(),
+	}).Info("Serving jobs as a read replica")
+	return r, nil
+}
+
+// reload replaces the replicated jobs with those stored now
+func (r *Replica) reload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	loaded, err := r.loadAll(ctx)
+	if err != nil {
+		return err
+	}
+	m := NewMemory()
+	for _, job := range loaded {
+		m.Put(job)
+	}
+
+	r.mu.Lock()
+	r.current = m
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Replica) jobs() *Memory {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Driver names the backend
+func (r *Replica) Driver() string {
+	return r.backend.Driver()
+}
+
+// Get returns a job by ID, reading jobs saved since the last reload from
+// the store when it allows
+func (r *Replica) Get(id string) (*models.CrawlJob, bool) {
+	if job, ok := r.jobs().Get(id); ok {
+		return job, true
+	}
+	return r.backend.Get(id)
+}
+
+// List returns every replicated job, oldest first
+func (r *Replica) List() ([]*models.CrawlJob, error) {
+	return r.jobs().List()
+}
+
+// ListPage returns a page of replicated jobs in creation order
+func (r *Replica) ListPage(q PageQuery) (Page, error) {
+	return r.jobs().ListPage(q)
+}
+
+// Find returns the jobs f selects as last loaded
+func (r *Replica) Find(f JobFilter) ([]*models.CrawlJob, error) {
+	return r.jobs().Find(f)
+}
+
+// Expiring returns the jobs last loaded whose retention runs out before t
+func (r *Replica) Expiring(t time.Time) ([]*models.CrawlJob, error) {
+	return r.jobs().Expiring(t)
+}
+
+// Stats sums up the jobs as last loaded
+func (r *Replica) Stats() (Stats, error) {
+	return r.jobs().Stats()
+}
+
+// Put fails: replicas do not write
+func (r *Replica) Put(*models.CrawlJob) error {
+	return ErrReadOnly
+}
+
+// Delete fails: replicas do not write
+func (r *Replica) Delete(string) error {
+	return ErrReadOnly
+}
+
+// SaveResults fails: replicas do not write
+func (r *Replica) SaveResults(string, []models.CrawlResult) error {
+	return ErrReadOnly
+}
+
+// LoadResults returns the stored results of a job
+func (r *Replica) LoadResults(jobID string) ([]models.CrawlResult, error) {
+	return r.backend.LoadResults(jobID)
+}
+
+// DeleteResults fails: replicas do not write
+func (r *Replica) DeleteResults(string) error {
+	return ErrReadOnly
+}
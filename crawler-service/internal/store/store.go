@@ -0,0 +1,155 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// Storage drivers selectable with JOB_STORE_DRIVER
+const (
+	DriverMemory     = "memory"
+	DriverRedis      = "redis"
+	DriverFilesystem = "filesystem"
+)
+
+// ErrNoResults is returned when a store holds no results for a job
+var ErrNoResults = errors.New("no stored results for job")
+
+// JobStore keeps crawl jobs. Jobs are shared, live objects: Get and List
+// return the same pointers the crawler updates, and Put persists the
+// current state of a job. List, ListPage and Find order jobs by creation
+// time, then ID.
+type JobStore interface {
+	Get(id string) (*models.CrawlJob, bool)
+	Put(job *models.CrawlJob) error
+	Delete(id string) error
+	List() ([]*models.CrawlJob, error)
+	ListPage(q PageQuery) (Page, error)
+	// Find returns the jobs f selects, reading only those the drivers
+	// index under its tenant, key or status where they can
+	Find(f JobFilter) ([]*models.CrawlJob, error)
+	// Expiring returns the finished jobs whose retention runs out before t
+	Expiring(t time.Time) ([]*models.CrawlJob, error)
+	// Stats counts the stored jobs and the bytes of results stored for them
+	Stats() (Stats, error)
+}
+
+// JobFilter selects jobs; zero fields select every job
+type JobFilter struct {
+	Tenant string
+	// APIKey is the ID of the API key the jobs were started with
+	APIKey string
+	// Since selects jobs started at or after it
+	Since time.Time
+	// Unfinished selects jobs not yet completed, failed or cancelled
+	Unfinished bool
+}
+
+// Match reports whether f selects a job
+func (f JobFilter) Match(job *models.CrawlJob) bool {
+	switch {
+	case f.Tenant != "" && job.Tenant != f.Tenant:
+		return false
+	case f.APIKey != "" && job.APIKey != f.APIKey:
+		return false
+	case !f.Since.IsZero() && job.StartedAt.Before(f.Since):
+		return false
+	case f.Unfinished && finished(job):
+		return false
+	}
+	return true
+}
+
+// Stats sums up the stored jobs
+type Stats struct {
+	Jobs         int
+	StorageBytes int64
+}
+
+// ResultStore keeps the results of finished jobs apart from job metadata
+type ResultStore interface {
+	SaveResults(jobID string, results []models.CrawlResult) error
+	LoadResults(jobID string) ([]models.CrawlResult, error)
+	DeleteResults(jobID string) error
+}
+
+// Store is a storage driver holding both jobs and their results
+type Store interface {
+	JobStore
+	ResultStore
+	// Driver names the backend
+	Driver() string
+}
+
+// NewFromEnv creates the store selected by JOB_STORE_DRIVER: memory
+// (default), redis, or filesystem (in JOB_STORE_DIR, default ./data/jobs).
+// The redis driver fails without a connected Redis.
+func NewFromEnv() (Store, error) {
+	return Open(os.Getenv("JOB_STORE_DRIVER"), os.Getenv("JOB_STORE_DIR"))
+}
+
+// Open creates the store of a driver; "json" is another name for the
+// filesystem driver, whose directory is dir
+func Open(driver, dir string) (Store, error) {
+	switch driver = strings.ToLower(driver); driver {
+	case "", DriverMemory:
+		return NewMemory(), nil
+	case DriverRedis:
+		rdb := database.GetRedisClient()
+		if rdb == nil {
+			return nil, errors.New("JOB_STORE_DRIVER=redis needs a connected Redis (check REDIS_HOST)")
+		}
+		return NewRedis(rdb)
+	case DriverFilesystem, "json":
+		if dir == "" {
+			dir = "./data/jobs"
+		}
+		return NewFilesystem(dir)
+	default:
+		return nil, fmt.Errorf("unknown job store driver %q", driver)
+	}
+}
+
+// interrupted marks a job loaded from persistent storage that was still
+// in progress when the service stopped
+func interrupted(job *models.CrawlJob) {
+	switch job.Status {
+	case "pending", "running", "stalled":
+		job.Status = "failed"
+		job.Error = "service restarted while the job was in progress"
+		job.ErrorCode = errcode.Interrupted
+	}
+}
+
+// metadata returns a copy of job without its results
+func metadata(job *models.CrawlJob) models.CrawlJob {
+	meta := *job
+	meta.Results = nil
+	return meta
+}
+
+// Expiry returns when a finished job's retention runs out, or nil if it is
+// kept until deleted or has not finished
+func Expiry(job *models.CrawlJob) *time.Time {
+	if job.RetentionHours <= 0 || !finished(job) || job.CompletedAt.IsZero() {
+		return nil
+	}
+	expiry := job.CompletedAt.Add(time.Duration(job.RetentionHours) * time.Hour)
+	return &expiry
+}
+
+// finished reports whether a job has reached a final status
+func finished(job *models.CrawlJob) bool {
+	switch job.Status {
+	case "completed", "failed", "cancelled":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package tabular
+
+import (
+	"archive/zip"
+	"definitelynotaspy/crawler-service/internal/graph"
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// resultRow is the flat columnar form of a crawl result
+type resultRow struct {
+	JobID          string    `parquet:"job_id"`
+	URL            string    `parquet:"url"`
+	Title          string    `parquet:"title"`
+	Content        string    `parquet:"content"`
+	StatusCode     int32     `parquet:"status_code"`
+	CrawledAt      time.Time `parquet:"crawled_at,timestamp"`
+	Depth          int32     `parquet:"depth"`
+	DiscoveredFrom string    `parquet:"discovered_from,optional"`
+	Source         string    `parquet:"source,optional"`
+	ContentHash    string    `parquet:"content_hash,optional"`
+	DuplicateOf    string    `parquet:"duplicate_of,optional"`
+	Error          string    `parquet:"error,optional"`
+	ErrorCode      string    `parquet:"error_code,optional"`
+	Links          []string  `parquet:"links,list"`
+	Emails         []string  `parquet:"emails,list"`
+	HostingCountry string    `parquet:"hosting_country,optional"`
+	HostingASN     int64     `parquet:"hosting_asn,optional"`
+	FieldsJSON     string    `parquet:"fields_json,optional"`
+}
+
+// entityRow is a graph node; props are kept as a JSON object
+type entityRow struct {
+	JobID     string `parquet:"job_id"`
+	Label     string `parquet:"label"`
+	Name      string `parquet:"name"`
+	PropsJSON string `parquet:"props_json,optional"`
+}
+
+// relationshipRow is a graph edge
+type relationshipRow struct {
+	JobID     string `parquet:"job_id"`
+	FromLabel string `parquet:"from_label"`
+	From      string `parquet:"from"`
+	Type      string `parquet:"type"`
+	ToLabel   string `parquet:"to_label"`
+	To        string `parquet:"to"`
+}
+
+// WriteParquet writes a zip holding results.parquet, entities.parquet and
+// relationships.parquet for a job, ready for pandas.read_parquet or Spark
+func WriteParquet(w io.Writer, job *models.CrawlJob, results []models.CrawlResult, g *graph.Graph) error {
+	zw := zip.NewWriter(w)
+
+	rows := make([]resultRow, 0, len(results))
+	for _, r := range results {
+		row := resultRow{
+			JobID:          job.ID,
+			URL:            r.URL,
+			Title:          r.Title,
+			Content:        r.Content,
+			StatusCode:     int32(r.StatusCode),
+			CrawledAt:      r.CrawledAt,
+			Depth:          int32(r.Depth),
+			DiscoveredFrom: r.DiscoveredFrom,
+			Source:         r.Source,
+			ContentHash:    r.ContentHash,
+			DuplicateOf:    r.DuplicateOf,
+			Error:          r.Error,
+			ErrorCode:      r.ErrorCode,
+		}
+		for _, link := range r.Links {
+			row.Links = append(row.Links, link.URL)
+		}
+		for _, email := range r.Emails {
+			row.Emails = append(row.Emails, email.Address)
+		}
+		if r.Hosting != nil {
+			row.HostingCountry = r.Hosting.Country
+			row.HostingASN = int64(r.Hosting.ASN)
+		}
+		if len(r.Fields) > 0 {
+			data, _ := json.Marshal(r.Fields)
+			row.FieldsJSON = string(data)
+		}
+		rows = append(rows, row)
+	}
+	if err := writeFile(zw, "results.parquet", rows); err != nil {
+		return err
+	}
+
+	nodes := g.Nodes()
+	entities := make([]entityRow, 0, len(nodes))
+	for _, n := range nodes {
+		row := entityRow{JobID: job.ID, Label: n.Label, Name: n.Name}
+		if len(n.Props) > 0 {
+			data, _ := json.Marshal(n.Props)
+			row.PropsJSON = string(data)
+		}
+		entities = append(entities, row)
+	}
+	if err := writeFile(zw, "entities.parquet", entities); err != nil {
+		return err
+	}
+
+	edges := g.Edges()
+	relationships := make([]relationshipRow, 0, len(edges))
+	for _, e := range edges {
+		relationships = append(relationships, relationshipRow{
+			JobID:     job.ID,
+			FromLabel: e.FromLabel,
+			From:      e.From,
+			Type:      e.Type,
+			ToLabel:   e.ToLabel,
+			To:        e.To,
+		})
+	}
+	if err := writeFile(zw, "relationships.parquet", relationships); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeFile[T any](zw *zip.Writer, name string, rows []T) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return parquet.Write(f, rows, parquet.Compression(&parquet.Snappy))
+}
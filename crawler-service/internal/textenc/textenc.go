@@ -0,0 +1,122 @@
+package textenc
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/saintfish/chardet"
+	"golang.org/x/net/html/charset"
+)
+
+// UTF8 is the name Decode reports for pages already in UTF-8
+const UTF8 = "utf-8"
+
+// prescanBytes is how far into a page a <meta> charset is looked for, as
+// browsers do
+const prescanBytes = 1024
+
+// metaCharset matches both <meta charset="..."> and the http-equiv form
+// <meta content="text/html; charset=...">
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.-]+)`)
+
+// boms are the byte-order marks that identify an encoding outright
+var boms = []struct {
+	mark []byte
+	name string
+}{
+	{[]byte{0xef, 0xbb, 0xbf}, UTF8},
+	{[]byte{0xfe, 0xff}, "utf-16be"},
+	{[]byte{0xff, 0xfe}, "utf-16le"},
+}
+
+// HeaderCharset returns the canonical name of the charset declared in a
+// Content-Type header, or "" when it declares none that is known
+func HeaderCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if _, name := charset.Lookup(params["charset"]); name != "" {
+		return name
+	}
+	return ""
+}
+
+// Decode converts a page to UTF-8 and names the encoding it was in. The
+// encoding is taken from a byte-order mark, then a <meta> declaration, and
+// is otherwise guessed from the bytes. A page that is valid UTF-8 with
+// multi-byte characters is kept as UTF-8 whatever its <meta> claims, since
+// a mislabelled UTF-8 page is far more common than a legacy page that
+// happens to decode as UTF-8.
+func Decode(body []byte) ([]byte, string, error) {
+	if len(body) == 0 {
+		return body, "", nil
+	}
+
+	name := detect(body)
+	if name == UTF8 {
+		return bytes.TrimPrefix(body, boms[0].mark), UTF8, nil
+	}
+
+	enc, canonical := charset.Lookup(name)
+	if enc == nil {
+		return body, "", fmt.Errorf("unsupported charset %q", name)
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, canonical, fmt.Errorf("failed to decode %s: %w", canonical, err)
+	}
+	return bytes.TrimPrefix(decoded, boms[0].mark), canonical, nil
+}
+
+// detect returns the label of the encoding a page is in
+func detect(body []byte) string {
+	for _, bom := range boms {
+		if bytes.HasPrefix(body, bom.mark) {
+			return bom.name
+		}
+	}
+
+	valid := utf8.Valid(body)
+	if valid && !ascii(body) {
+		return UTF8
+	}
+
+	head := body
+	if len(head) > prescanBytes {
+		head = head[:prescanBytes]
+	}
+	if m := metaCharset.FindSubmatch(head); m != nil {
+		if enc, name := charset.Lookup(string(m[1])); enc != nil {
+			// A page that could read its own <meta> is not UTF-16
+			if strings.HasPrefix(name, "utf-16") {
+				return UTF8
+			}
+			return name
+		}
+	}
+	if valid {
+		return UTF8
+	}
+
+	if guess, err := chardet.NewTextDetector().DetectBest(body); err == nil {
+		if enc, name := charset.Lookup(guess.Charset); enc != nil {
+			return name
+		}
+	}
+	return "windows-1252"
+}
+
+// ascii reports whether b holds only 7-bit bytes
+func ascii(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package timeline
+
+import (
+	"definitelynotaspy/crawler-service/internal/models"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Kinds of dated events
+const (
+	KindPublished = "published"
+	KindModified  = "modified"
+	KindEXIF      = "exif"
+	KindCrawled   = "crawled"
+	KindArchived  = "archived"
+)
+
+// maxTimeElements bounds the <time> elements read per page
+const maxTimeElements = 20
+
+var layouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// ParseTime parses the date formats commonly found in page metadata
+func ParseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Extract collects publish and modification dates from a page's meta tags,
+// <time> elements and schema.org JSON-LD
+func Extract(doc *goquery.Selection) []models.DatedEvent {
+	var events []models.DatedEvent
+	add := func(value, kind, source string) {
+		t, ok := ParseTime(value)
+		if !ok {
+			return
+		}
+		for _, e := range events {
+			if e.Kind == kind && e.Time.Equal(t) {
+				return
+			}
+		}
+		events = append(events, models.DatedEvent{Time: t, Kind: kind, Source: source})
+	}
+
+	metas := []struct{ selector, kind string }{
+		{`meta[property="article:published_time"]`, KindPublished},
+		{`meta[name="date"]`, KindPublished},
+		{`meta[name="pubdate"]`, KindPublished},
+		{`meta[name="DC.date.issued"]`, KindPublished},
+		{`meta[property="article:modified_time"]`, KindModified},
+		{`meta[property="og:updated_time"]`, KindModified},
+		{`meta[name="last-modified"]`, KindModified},
+	}
+	for _, m := range metas {
+		if content, ok := doc.Find(m.selector).Attr("content"); ok {
+			add(content, m.kind, "meta")
+		}
+	}
+
+	doc.Find("time[datetime]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		value, _ := s.Attr("datetime")
+		kind := KindPublished
+		if itemprop, _ := s.Attr("itemprop"); itemprop == "dateModified" {
+			kind = KindModified
+		}
+		add(value, kind, "time")
+		return i+1 < maxTimeElements
+	})
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var data interface{}
+		if json.Unmarshal([]byte(s.Text()), &data) == nil {
+			walkJSONLD(data, add)
+		}
+	})
+
+	return events
+}
+
+func walkJSONLD(v interface{}, add func(value, kind, source string)) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			walkJSONLD(item, add)
+		}
+	case map[string]interface{}:
+		for key, kind := range map[string]string{
+			"datePublished": KindPublished,
+			"dateCreated":   KindPublished,
+			"dateModified":  KindModified,
+		} {
+			if s, ok := v[key].(string); ok {
+				add(s, kind, "schema")
+			}
+		}
+		for _, child := range v {
+			walkJSONLD(child, add)
+		}
+	}
+}
+
+// Entry is one point on a job's timeline
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	URL    string    `json:"url"`
+	Title  string    `json:"title,omitempty"`
+	Source string    `json:"source,omitempty"`
+	Image  string    `json:"image,omitempty"`
+}
+
+// Build orders the crawl of each result and the dated events found on it
+// chronologically. Crawls whose HTML was archived appear as snapshots.
+func Build(results []models.CrawlResult) []Entry {
+	var entries []Entry
+	for _, r := range results {
+		kind := KindCrawled
+		if r.HTMLRef != "" {
+			kind = KindArchived
+		}
+		entries = append(entries, Entry{Time: r.CrawledAt, Kind: kind, URL: r.URL, Title: r.Title})
+
+		for _, d := range r.Dates {
+			entries = append(entries, Entry{
+				Time:   d.Time,
+				Kind:   d.Kind,
+				URL:    r.URL,
+				Title:  r.Title,
+				Source: d.Source,
+				Image:  d.Image,
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries
+}
@@ -0,0 +1,215 @@
+// Package tsa obtains RFC 3161 trusted timestamps, proving that a digest
+// existed at the time a timestamping authority signed it.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+var (
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type messageImprint struct {
+	HashAlgorithm algorithmIdentifier
+	HashedMessage []byte
+}
+
+// timeStampReq is the request of RFC 3161 section 2.4.1
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional,default:false"`
+}
+
+// timeStampResp is the response of RFC 3161 section 2.4.2
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapsulatedContentInfo
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+// tstInfo is the signed content of a token (RFC 3161 section 2.4.2); the
+// fields after the nonce are not needed
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// Client requests timestamps from one authority
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// NewClientFromEnv returns a client for the authority at TSA_URL, or nil
+// when it is not set
+func NewClientFromEnv() *Client {
+	u := os.Getenv("TSA_URL")
+	if u == "" {
+		return nil
+	}
+	return &Client{url: u, http: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Timestamp obtains a token for a SHA-256 digest. The token is checked to
+// cover the digest and answer this request, but its signature is not
+// verified.
+func (c *Client) Timestamp(ctx context.Context, digest []byte) (*models.TrustedTimestamp, error) {
+	if len(digest) != 32 {
+		return nil, errors.New("timestamps need a SHA-256 digest")
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return nil, err
+	}
+	body, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: algorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamping authority returned %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var tsr timeStampResp
+	if _, err := asn1.Unmarshal(data, &tsr); err != nil {
+		return nil, fmt.Errorf("invalid timestamp response: %w", err)
+	}
+	// 0 is granted, 1 granted with modifications
+	if tsr.Status.Status > 1 {
+		return nil, fmt.Errorf("timestamp refused with status %d%s", tsr.Status.Status, statusText(tsr.Status))
+	}
+	if len(tsr.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("timestamp response carries no token")
+	}
+
+	info, err := parseToken(tsr.TimeStampToken.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, errors.New("timestamp token covers a different digest")
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return nil, errors.New("timestamp token uses a different hash algorithm")
+	}
+	if info.Nonce != nil && info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("timestamp token answers a different request")
+	}
+
+	return &models.TrustedTimestamp{Authority: c.url, GenTime: info.GenTime.UTC(), Token: tsr.TimeStampToken.FullBytes}, nil
+}
+
+// parseToken extracts the TSTInfo from a token
+func parseToken(der []byte) (*tstInfo, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("timestamp token is not signed data")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, errors.New("timestamp token does not carry timestamp info")
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("invalid timestamp info: %w", err)
+	}
+	return &info, nil
+}
+
+func statusText(s pkiStatusInfo) string {
+	var parts []string
+	for _, raw := range s.StatusString {
+		var text string
+		if _, err := asn1.UnmarshalWithParams(raw.FullBytes, &text, "utf8"); err == nil {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(parts, "; ")
+}
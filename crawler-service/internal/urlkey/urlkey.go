@@ -0,0 +1,140 @@
+package urlkey
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// Query parameter rule actions
+const (
+	ActionStrip        = "strip"
+	ActionKeep         = "keep"
+	ActionCanonicalize = "canonicalize"
+)
+
+// defaultStrip are tracking and session parameters that never change what a
+// page shows. A job's keep rules override them.
+var defaultStrip = []string{
+	"utm_*", "fbclid", "gclid", "gclsrc", "dclid", "msclkid", "yclid", "igshid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi", "mkt_tok", "ref_src",
+	"sessionid", "session_id", "sid", "phpsessid", "jsessionid", "aspsessionid*", "sessid",
+}
+
+// pathSession matches session IDs carried as path parameters
+// (/page;jsessionid=...)
+var pathSession = regexp.MustCompile(`(?i);(jsessionid|phpsessid|sessionid)=[^/?#]*`)
+
+// rule is a compiled query parameter rule
+type rule struct {
+	name   string
+	prefix bool
+	action string
+	value  string
+}
+
+func (r rule) matches(param string) bool {
+	if r.prefix {
+		return strings.HasPrefix(param, r.name)
+	}
+	return param == r.name
+}
+
+// Normalizer turns URLs into keys that are equal when the URLs differ only
+// in parameters that do not change the page
+type Normalizer struct {
+	rules []rule
+}
+
+// New compiles a job's query parameter rules on top of the default strip
+// list. Parameter names are case-insensitive; a trailing * matches a
+// prefix.
+func New(rules []models.QueryParamRule) (*Normalizer, error) {
+	n := &Normalizer{}
+	for _, r := range rules {
+		compiled, err := compile(r.Param, r.Action, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		n.rules = append(n.rules, compiled)
+	}
+	// Job rules come first so they win over the defaults
+	for _, name := range defaultStrip {
+		compiled, _ := compile(name, ActionStrip, "")
+		n.rules = append(n.rules, compiled)
+	}
+	return n, nil
+}
+
+// Validate checks a job's query parameter rules
+func Validate(rules []models.QueryParamRule) error {
+	_, err := New(rules)
+	return err
+}
+
+func compile(param, action, value string) (rule, error) {
+	name := strings.ToLower(strings.TrimSpace(param))
+	r := rule{name: strings.TrimSuffix(name, "*"), prefix: strings.HasSuffix(name, "*"), action: action, value: value}
+	if r.name == "" {
+		return rule{}, fmt.Errorf("query parameter rule needs a param")
+	}
+	switch action {
+	case ActionStrip, ActionKeep, ActionCanonicalize:
+	default:
+		return rule{}, fmt.Errorf("query parameter rule for %q: action must be strip, keep or canonicalize", param)
+	}
+	return r, nil
+}
+
+// Key returns the key of a URL: the fragment and path session IDs dropped,
+// stripped parameters removed, canonicalized parameters set to their rule's
+// value and the rest sorted. URLs that do not parse are their own key.
+func (n *Normalizer) Key(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Host = strings.ToLower(u.Host)
+	if strings.Contains(u.Path, ";") {
+		u.Path = pathSession.ReplaceAllString(u.Path, "")
+		u.RawPath = ""
+	}
+	if u.RawQuery == "" {
+		return u.String()
+	}
+
+	query := u.Query()
+	for param, values := range query {
+		r, ok := n.match(strings.ToLower(param))
+		if !ok {
+			continue
+		}
+		switch r.action {
+		case ActionStrip:
+			query.Del(param)
+		case ActionCanonicalize:
+			for i := range values {
+				values[i] = r.value
+			}
+		}
+	}
+
+	// Encode sorts by parameter name; values keep their order
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// match returns the first rule matching a parameter
+func (n *Normalizer) match(param string) (rule, bool) {
+	for _, r := range n.rules {
+		if r.matches(param) {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
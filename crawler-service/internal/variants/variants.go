@@ -0,0 +1,114 @@
+package variants
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Variant kinds
+const (
+	KindAMP   = "amp"
+	KindPrint = "print"
+)
+
+// printURL matches the URL conventions of print-friendly pages
+var printURL = regexp.MustCompile(`(?i)[?&](print|printable|printer_friendly|printer-friendly)(=[^&]*)?(&|$)|[?&](view|output|format|mode)=print(&|$)|/print(/|$)|[-_.]print\.(html?|php|aspx?)$`)
+
+// Links describes the variants a page links to and, when the page is itself
+// a variant, the original it is a variant of
+type Links struct {
+	// AMP and Print are the page's AMP and print-friendly versions
+	AMP   string
+	Print string
+	// Kind is set when the page is itself an AMP or print version; Of is
+	// then its canonical original, when the page names one
+	Kind string
+	Of   string
+}
+
+// Find reads the variant links of the page at pageURL
+func Find(doc *goquery.Selection, pageURL *url.URL) Links {
+	var l Links
+	html := doc.Closest("html")
+	if html.Length() == 0 {
+		html = doc.Find("html").First()
+	}
+
+	l.AMP = resolve(pageURL, doc.Find(`link[rel~="amphtml"]`).First().AttrOr("href", ""))
+	l.Print = resolve(pageURL, doc.Find(`link[rel~="alternate"][media="print"]`).First().AttrOr("href", ""))
+	if l.Print == "" {
+		doc.Find("a[href]").EachWithBreak(func(_ int, a *goquery.Selection) bool {
+			href := resolve(pageURL, a.AttrOr("href", ""))
+			if href == "" || !sameHost(pageURL, href) || !printURL.MatchString(href) {
+				return true
+			}
+			l.Print = href
+			return false
+		})
+	}
+
+	_, amp := html.Attr("amp")
+	_, bolt := html.Attr("⚡")
+	switch {
+	case amp || bolt:
+		l.Kind = KindAMP
+	case printURL.MatchString(pageURL.String()):
+		l.Kind = KindPrint
+	}
+	if l.Kind != "" {
+		l.AMP, l.Print = "", ""
+		canonical := resolve(pageURL, doc.Find(`link[rel~="canonical"]`).First().AttrOr("href", ""))
+		if canonical != pageURL.String() {
+			l.Of = canonical
+		}
+	}
+
+	// A page naming itself as its own variant has none
+	if l.AMP == pageURL.String() {
+		l.AMP = ""
+	}
+	if l.Print == pageURL.String() {
+		l.Print = ""
+	}
+	return l
+}
+
+// Preferred returns the variant of kind the page links to, or ""
+func (l Links) Preferred(kind string) string {
+	switch kind {
+	case KindAMP:
+		return l.AMP
+	case KindPrint:
+		return l.Print
+	}
+	return ""
+}
+
+// resolve makes href absolute against the page, dropping the fragment;
+// only http and https URLs are kept
+func resolve(page *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return ""
+	}
+	u, err := page.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// sameHost reports whether href is on the page's host, ignoring a leading
+// www
+func sameHost(page *url.URL, href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") ==
+		strings.TrimPrefix(strings.ToLower(page.Hostname()), "www.")
+}
@@ -0,0 +1,320 @@
+// Package views saves named filters over a job's results, each shareable
+// through a read-only link, so curated subsets can be handed on without
+// exporting them.
+package views
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// Redis hashes of the views, keyed by view ID, and of their share tokens
+const (
+	viewsKey  = "result_views"
+	tokensKey = "result_view_tokens"
+)
+
+// maxNameLength bounds view names
+const maxNameLength = 128
+
+// Filter selects results. Every criterion set must match.
+type Filter struct {
+	// Query matches results whose URL, title or content contains it,
+	// ignoring case
+	Query string `json:"query,omitempty"`
+	// Domain matches results on the host or its subdomains
+	Domain string `json:"domain,omitempty"`
+	// MinScore and MaxScore bound the quality score
+	MinScore *float64 `json:"min_score,omitempty"`
+	MaxScore *float64 `json:"max_score,omitempty"`
+	// Tags match results whose host is in any of these categories
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Validate checks a filter's criteria
+func (f Filter) Validate() error {
+	for _, score := range []*float64{f.MinScore, f.MaxScore} {
+		if score != nil && (*score < 0 || *score > 1) {
+			return errors.New("min_score and max_score must be between 0 and 1")
+		}
+	}
+	if f.MinScore != nil && f.MaxScore != nil && *f.MinScore > *f.MaxScore {
+		return errors.New("min_score must not exceed max_score")
+	}
+	return nil
+}
+
+// Match reports whether a result passes the filter
+func (f Filter) Match(r models.CrawlResult) bool {
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(r.URL), q) &&
+			!strings.Contains(strings.ToLower(r.Title), q) &&
+			!strings.Contains(strings.ToLower(r.Content), q) {
+			return false
+		}
+	}
+	if f.Domain != "" {
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			return false
+		}
+		host, domain := strings.ToLower(u.Hostname()), strings.ToLower(f.Domain)
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	}
+	if f.MinScore != nil && r.QualityScore < *f.MinScore {
+		return false
+	}
+	if f.MaxScore != nil && r.QualityScore > *f.MaxScore {
+		return false
+	}
+	if len(f.Tags) > 0 && !anyTag(r.Categories, f.Tags) {
+		return false
+	}
+	return true
+}
+
+func anyTag(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if strings.EqualFold(h, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Apply returns the results passing the filter
+func (f Filter) Apply(results []models.CrawlResult) []models.CrawlResult {
+	matched := make([]models.CrawlResult, 0)
+	for _, r := range results {
+		if f.Match(r) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// View is a named filter over one job's results
+type View struct {
+	ID     string `json:"id"`
+	JobID  string `json:"job_id"`
+	Name   string `json:"name"`
+	Filter Filter `json:"filter"`
+	// Token opens the view read-only without any other credential
+	Token string `json:"token"`
+	// Role is the role of the view's creator, whose field mask applies to
+	// everyone the view is shared with
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// New validates a view and gives it an ID and share token
+func New(jobID, name, role string, filter Filter) (*View, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return nil, errors.New("view name must be 1-128 characters")
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return &View{
+		ID:        randomHex(8),
+		JobID:     jobID,
+		Name:      name,
+		Filter:    filter,
+		Token:     randomHex(24),
+		Role:      role,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Store holds the views, in Redis when connected so share links work on
+// every instance and survive restarts
+type Store struct {
+	mu     sync.RWMutex
+	views  map[string]View
+	tokens map[string]string
+}
+
+// NewStore creates an empty view store
+func NewStore() *Store {
+	return &Store{
+		views:  make(map[string]View),
+		tokens: make(map[string]string),
+	}
+}
+
+// Put stores a view
+func (s *Store) Put(view View) error {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		data, err := json.Marshal(view)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, viewsKey, view.ID, data)
+			pipe.HSet(ctx, tokensKey, view.Token, view.ID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.views[view.ID] = view
+	s.tokens[view.Token] = view.ID
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns a view by ID
+func (s *Store) Get(id string) (*View, bool) {
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		data, err := rdb.HGet(ctx, viewsKey, id).Bytes()
+		switch {
+		case err == redis.Nil:
+			return nil, false
+		case err != nil:
+			log.WithError(err).WithField("view_id", id).Warn("Failed to read view from Redis, using local copy")
+		default:
+			var view View
+			if err := json.Unmarshal(data, &view); err == nil {
+				return &view, true
+			}
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	view, ok := s.views[id]
+	if !ok {
+		return nil, false
+	}
+	return &view, true
+}
+
+// ByToken returns the view a share token opens
+func (s *Store) ByToken(token string) (*View, bool) {
+	if token == "" {
+		return nil, false
+	}
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		id, err := rdb.HGet(ctx, tokensKey, token).Result()
+		switch {
+		case err == redis.Nil:
+			return nil, false
+		case err != nil:
+			log.WithError(err).Warn("Failed to read view token from Redis, using local copy")
+		default:
+			return s.Get(id)
+		}
+	}
+
+	s.mu.RLock()
+	id, ok := s.tokens[token]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return s.Get(id)
+}
+
+// ForJob returns a job's views, oldest first
+func (s *Store) ForJob(jobID string) []View {
+	all := make(map[string]View)
+
+	s.mu.RLock()
+	for id, view := range s.views {
+		all[id] = view
+	}
+	s.mu.RUnlock()
+
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		items, err := rdb.HGetAll(ctx, viewsKey).Result()
+		if err != nil {
+			log.WithError(err).Warn("Failed to read views from Redis")
+		}
+		for id, value := range items {
+			var view View
+			if err := json.Unmarshal([]byte(value), &view); err == nil {
+				all[id] = view
+			}
+		}
+	}
+
+	list := make([]View, 0)
+	for _, view := range all {
+		if view.JobID == jobID {
+			list = append(list, view)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Delete removes a view, revoking its share link, and reports whether it
+// existed
+func (s *Store) Delete(id string) bool {
+	view, ok := s.Get(id)
+	if !ok {
+		return false
+	}
+	if rdb := database.GetRedisClient(); rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, viewsKey, id)
+			pipe.HDel(ctx, tokensKey, view.Token)
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).WithField("view_id", id).Warn("Failed to delete view from Redis")
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.views, id)
+	delete(s.tokens, view.Token)
+	s.mu.Unlock()
+	return true
+}
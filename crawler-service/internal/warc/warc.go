@@ -0,0 +1,139 @@
+// Package warc writes WARC 1.1 files (ISO 28500), the web archive format
+// replay tools such as pywb and the Wayback Machine read. Each record is
+// compressed as a gzip member of its own, as in .warc.gz files, so readers
+// can seek to any record.
+package warc
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Record types
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeResponse = "response"
+	TypeMetadata = "metadata"
+)
+
+// ContentTypeHTTPResponse is the content type of response records holding
+// an HTTP response
+const ContentTypeHTTPResponse = "application/http;msgtype=response"
+
+// Record is the header of a WARC record
+type Record struct {
+	Type        string
+	TargetURI   string
+	Date        time.Time
+	ContentType string
+	// ConcurrentTo is the ID of the record this one describes, e.g. the
+	// response of a metadata record
+	ConcurrentTo string
+	// Fields are further named WARC header fields
+	Fields map[string]string
+}
+
+// Writer writes gzipped WARC records
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a writer of records to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteRecord writes a record holding block and returns its record ID
+func (wr *Writer) WriteRecord(rec Record, block []byte) (string, error) {
+	id := "<urn:uuid:" + uuid.NewString() + ">"
+	date := rec.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var h strings.Builder
+	h.WriteString("WARC/1.1\r\n")
+	field := func(name, value string) {
+		if value != "" {
+			h.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	field("WARC-Type", rec.Type)
+	field("WARC-Record-ID", id)
+	field("WARC-Date", date.UTC().Format(time.RFC3339))
+	field("WARC-Target-URI", rec.TargetURI)
+	field("WARC-Concurrent-To", rec.ConcurrentTo)
+	field("WARC-Block-Digest", Digest(block))
+	names := make([]string, 0, len(rec.Fields))
+	for name := range rec.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field(name, rec.Fields[name])
+	}
+	field("Content-Type", rec.ContentType)
+	field("Content-Length", fmt.Sprint(len(block)))
+	h.WriteString("\r\n")
+
+	zw := gzip.NewWriter(wr.w)
+	if _, err := io.WriteString(zw, h.String()); err != nil {
+		return "", err
+	}
+	if _, err := zw.Write(block); err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(zw, "\r\n\r\n"); err != nil {
+		return "", err
+	}
+	return id, zw.Close()
+}
+
+// WriteInfo writes the warcinfo record that opens a file
+func (wr *Writer) WriteInfo(filename string, fields map[string]string) (string, error) {
+	var body strings.Builder
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		body.WriteString(name + ": " + fields[name] + "\r\n")
+	}
+	return wr.WriteRecord(Record{
+		Type:        TypeWarcinfo,
+		ContentType: "application/warc-fields",
+		Fields:      map[string]string{"WARC-Filename": filename},
+	}, []byte(body.String()))
+}
+
+// HTTPResponse renders an HTTP/1.1 response, the block of a response
+// record. Content-Length is set from body.
+func HTTPResponse(status int, header http.Header, body []byte) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Length", fmt.Sprint(len(body)))
+	header.Write(&b)
+	b.WriteString("\r\n")
+	return append([]byte(b.String()), body...)
+}
+
+// Digest returns the labelled SHA-1 digest of data, in base 32 as WARC
+// readers expect
+func Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// listen opens the TCP listener on the port and, when CRAWLER_SOCKET is
+// set, a Unix socket listener as well, so sidecars can reach the API
+// without a network port. Both are served through one listener.
+func listen(port string) (net.Listener, error) {
+	tcp, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return nil, err
+	}
+
+	path := os.Getenv("CRAWLER_SOCKET")
+	if path == "" {
+		return tcp, nil
+	}
+
+	unix, err := listenUnix(path)
+	if err != nil {
+		tcp.Close()
+		return nil, err
+	}
+	return newMultiListener(tcp, unix), nil
+}
+
+// listenUnix listens on a Unix socket, replacing a stale socket left by a
+// previous run, and applies CRAWLER_SOCKET_MODE (octal, default 0660) and
+// CRAWLER_SOCKET_GROUP (name or gid) to it
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	mode := os.FileMode(0o660)
+	if v := os.Getenv("CRAWLER_SOCKET_MODE"); v != "" {
+		m, err := strconv.ParseUint(v, 8, 32)
+		if err != nil || m > 0o777 {
+			return nil, fmt.Errorf("invalid CRAWLER_SOCKET_MODE %q", v)
+		}
+		mode = os.FileMode(m)
+	}
+
+	gid := -1
+	if group := os.Getenv("CRAWLER_SOCKET_GROUP"); group != "" {
+		id, err := strconv.Atoi(group)
+		if err != nil {
+			g, lookupErr := user.LookupGroup(group)
+			if lookupErr != nil {
+				return nil, lookupErr
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		gid = id
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// multiListener accepts connections from several listeners at once
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMultiListener(listeners ...net.Listener) *multiListener {
+	m := &multiListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error, len(listeners)),
+		closed:    make(chan struct{}),
+	}
+	for _, ln := range listeners {
+		go m.accept(ln)
+	}
+	return m
+}
+
+func (m *multiListener) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			m.errs <- err
+			return
+		}
+		select {
+		case m.conns <- conn:
+		case <-m.closed:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept returns the next connection from any listener
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-m.conns:
+		return conn, nil
+	case err := <-m.errs:
+		return nil, err
+	case <-m.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes every listener; a Unix socket file is removed with it
+func (m *multiListener) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		for _, ln := range m.listeners {
+			if cerr := ln.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first (TCP) listener
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
@@ -1,13 +1,26 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"definitelynotaspy/crawler-service/internal/cluster"
+	"definitelynotaspy/crawler-service/internal/crawler"
+	"definitelynotaspy/crawler-service/internal/database"
+	"definitelynotaspy/crawler-service/internal/errcode"
+	"definitelynotaspy/crawler-service/internal/events"
+	"definitelynotaspy/crawler-service/internal/fixture"
 	"definitelynotaspy/crawler-service/internal/handlers"
+	"definitelynotaspy/crawler-service/internal/models"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/etag"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/joho/godotenv"
@@ -35,31 +48,105 @@ func init() {
 }
 
 func main() {
+	// Connect to Redis (optional, features fall back to in-memory state)
+	if err := database.InitRedis(); err != nil {
+		log.Warn("Redis unavailable, continuing without it")
+	}
+	defer database.CloseRedis()
+
+	// migrate copies jobs between stores instead of serving the API
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrate(os.Args[2:])
+		database.CloseRedis()
+		os.Exit(code)
+	}
+
+	// Services read the environment and Redis as they are built, so they
+	// are built once both are set up
+	handlers.Init(handlers.NewServicesFromEnv())
+	if err := handlers.InitJobStore(); err != nil {
+		log.WithError(err).Fatal("Failed to open job store")
+	}
+	if err := handlers.InitAPIKeys(); err != nil {
+		log.WithError(err).Fatal("Failed to load API keys")
+	}
+
+	if fixture.Enabled() {
+		log.WithField("host", fixture.Host).Warn("Fixture mode: searches and fetches are served by the built-in test site")
+	}
+
+	// Background workers; read replicas crawl nothing and only serve reads
+	service := handlers.Service()
+	replica := handlers.ReadReplica()
+	service.GeoIP().Watch(context.Background(), time.Minute)
+	service.Policies().Watch(context.Background(), 10*time.Second)
+	if !replica {
+		if alertURL := os.Getenv("ALERT_WEBHOOK_URL"); alertURL != "" {
+			service.Events().Subscribe(events.NewWebhookNotifier(alertURL, events.JobStalled, events.SectionChanged, events.BudgetThreshold).Handle)
+		}
+		service.Events().Subscribe(handlers.FollowUpCrawls)
+		service.Events().Subscribe(handlers.BudgetAlerts)
+		service.Events().Subscribe(handlers.ContinuousCoverage)
+		service.Events().Subscribe(handlers.SLOAlerts)
+		service.StartWatchdog(context.Background())
+		service.StartIntelDelivery(context.Background())
+		service.Proxies().Watch(context.Background(), time.Minute)
+		service.StartPasteMonitor(context.Background())
+		handlers.StartContinuousCrawls(context.Background())
+		handlers.StartRetentionReaper(context.Background())
+	}
+
+	// Worker instances crawl the URLs coordinators queue in Redis
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	if nodes := service.Cluster(); !replica && nodes != nil && nodes.Role() == cluster.RoleWorker {
+		go func() {
+			service.RunWorker(workerCtx)
+			close(workerDone)
+		}()
+	} else {
+		close(workerDone)
+	}
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		AppName:      "DefinitelyNotASpy Crawler Service",
 		ErrorHandler: customErrorHandler,
+		BodyLimit:    bodyLimit(),
 	})
 
 	// Middleware
 	app.Use(recover.New())
 	app.Use(logger.New())
+	app.Use(handlers.InstrumentRequests)
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept",
+		AllowOrigins:  "*",
+		AllowHeaders:  "Origin, Content-Type, Accept, If-None-Match, Authorization, X-API-Key",
+		ExposeHeaders: "ETag",
 	}))
 
 	// Health check
 	app.Get("/health", handlers.HealthCheck)
 
-	// API routes
-	api := app.Group("/api/v1")
-	
-	// Crawler routes
-	api.Post("/crawl", handlers.StartCrawl)
-	api.Get("/status/:id", handlers.GetCrawlStatus)
-	api.Get("/jobs", handlers.ListJobs)
-	api.Delete("/job/:id", handlers.CancelJob)
+	// Prometheus metrics
+	app.Get("/metrics", handlers.GetMetrics)
+
+	// Public description of the crawler, linked from its user agent
+	app.Get(crawler.CrawlerInfoPath, handlers.GetCrawlerInfo)
+
+	// API routes; v2 differs from v1 in the shape of error responses and in
+	// deleting jobs on DELETE /jobs/:id, which cancels them in v1
+	for _, version := range []string{models.APIVersion1, models.APIVersion2} {
+		api := app.Group("/api/" + version)
+		// Job routes moved from /job/:id to /jobs/:id
+		api.Use(handlers.LegacyJobRoutes)
+		registerPublicRoutes(api)
+		api.Use(handlers.Authenticate)
+		if replica {
+			api.Use(handlers.RejectWrites)
+		}
+		registerRoutes(api, version)
+	}
 
 	// Get port from environment
 	port := os.Getenv("CRAWLER_PORT")
@@ -67,13 +154,172 @@ func main() {
 		port = "8080"
 	}
 
+	ln, err := listen(port)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to listen")
+	}
+	grpcServer := startGRPC()
+
+	// Drain the job queue on SIGINT or SIGTERM, then stop serving
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout())
+		stopWorker()
+		select {
+		case <-workerDone:
+		case <-ctx.Done():
+		}
+		handlers.Shutdown(ctx)
+		stopGRPC(ctx, grpcServer)
+		cancel()
+		if err := app.ShutdownWithTimeout(5 * time.Second); err != nil {
+			log.WithError(err).Warn("Server did not shut down cleanly")
+		}
+	}()
+
 	// Start server
-	log.WithField("port", port).Info("🚀 Crawler service starting")
-	if err := app.Listen(fmt.Sprintf(":%s", port)); err != nil {
+	log.WithFields(log.Fields{
+		"port":   port,
+		"socket": os.Getenv("CRAWLER_SOCKET"),
+	}).Info("🚀 Crawler service starting")
+	if err := app.Listener(ln); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// registerPublicRoutes adds the routes of an API version that need no API
+// key. They are registered ahead of authentication: shared views are
+// opened by whoever holds their token.
+func registerPublicRoutes(api fiber.Router) {
+	api.Get("/shared/:token", resultETags(), handlers.GetSharedView)
+}
+
+// registerRoutes adds the crawler routes under the prefix of an API
+// version
+func registerRoutes(api fiber.Router, version string) {
+	etags := resultETags()
+	// Each route declares the scope of API key it needs
+	read, write, admin := handlers.ReadAccess, handlers.WriteAccess, handlers.AdminAccess
+
+	api.Post("/crawl", write, handlers.StartCrawl)
+	api.Post("/crawl/similar", read, handlers.FindSimilarJobs)
+	api.Get("/status/:id", read, etags, handlers.GetCrawlStatus)
+	api.Get("/jobs", read, handlers.ListJobs)
+	api.Get("/jobs/:id/stream", read, handlers.StreamJob)
+	api.Get("/jobs/:id/delivery", read, handlers.GetJobDelivery)
+	api.Get("/jobs/:id/graph", read, handlers.GetJobLinkGraph)
+	api.Get("/jobs/:id/report", read, handlers.GetJobReport)
+	api.Delete("/jobs/:id/results", write, handlers.DeleteJobResults)
+	if version == models.APIVersion1 {
+		api.Delete("/jobs/:id", write, handlers.DeleteJobV1)
+	} else {
+		api.Delete("/jobs/:id", write, handlers.DeleteJob)
+	}
+	api.Patch("/jobs/:id", write, handlers.AnnotateJob)
+	api.Get("/jobs/:id/annotations", read, handlers.GetJobAnnotations)
+	api.Post("/jobs/:id/cancel", write, handlers.CancelJob)
+	api.Post("/jobs/:id/continue", write, handlers.ContinueJob)
+	api.Post("/jobs/:id/resume", write, handlers.ResumeJob)
+	api.Get("/jobs/:id/wait", read, handlers.WaitForJob)
+	api.Get("/jobs/:id/results", read, etags, handlers.GetJobResults)
+	api.Get("/jobs/:id/bundle", read, handlers.ExportJobBundle)
+	api.Get("/jobs/:id/export.zip", read, handlers.ExportJobZip)
+	api.Get("/jobs/:id/evidence", read, handlers.ExportJobEvidence)
+	api.Get("/jobs/:id/geojson", read, handlers.ExportJobGeoJSON)
+	api.Get("/jobs/:id/timeline", read, handlers.GetJobTimeline)
+	api.Get("/jobs/:id/screenshots/:file", read, handlers.GetJobScreenshot)
+	api.Get("/jobs/:id/domains", read, handlers.GetJobLinkedDomains)
+	api.Get("/jobs/:id/sitemap", read, handlers.GetJobSitemap)
+	api.Get("/jobs/:id/organizations", read, handlers.GetJobOrganizations)
+	api.Post("/jobs/:id/views", write, handlers.CreateView)
+	api.Get("/jobs/:id/views", read, handlers.ListViews)
+	api.Get("/jobs/:id/views/:view/results", read, etags, handlers.GetViewResults)
+	api.Delete("/jobs/:id/views/:view", write, handlers.DeleteView)
+	api.Get("/jobs/:id/coverage", read, handlers.GetJobCoverage)
+	api.Get("/jobs/:id/broken-links", read, handlers.GetJobBrokenLinks)
+	api.Get("/jobs/:id/graph/export", read, handlers.ExportJobGraph)
+	api.Post("/jobs/:id/graph/neo4j", write, handlers.WriteJobGraph)
+	api.Post("/jobs/import", write, handlers.ImportJobBundle)
+	api.Post("/fetch", write, handlers.FetchURL)
+	api.Get("/tenants/:id/usage", read, handlers.GetTenantUsage)
+	api.Get("/tenants/:id/usage/export", read, handlers.ExportTenantUsage)
+	api.Get("/tenants/:id/slo", read, handlers.GetTenantSLO)
+	api.Get("/tenants/:id/audit", read, handlers.GetTenantAudit)
+	api.Get("/admin/tenants/:id/subject-search", admin, handlers.SearchDataSubject)
+	api.Get("/admin/tenants/:id/keys", admin, handlers.GetTenantKeys)
+	api.Post("/admin/tenants/:id/rotate-key", admin, handlers.RotateTenantKey)
+	api.Post("/admin/jobs/import", admin, handlers.ImportJobs)
+	api.Get("/admin/tenants/:id/budget", admin, handlers.GetTenantBudget)
+	api.Put("/admin/tenants/:id/budget", admin, handlers.PutTenantBudget)
+	api.Delete("/admin/tenants/:id/budget", admin, handlers.DeleteTenantBudget)
+	api.Post("/admin/tenants/:id/budget/override", admin, handlers.OverrideTenantBudget)
+	api.Delete("/admin/tenants/:id/budget/override", admin, handlers.ClearTenantBudgetOverride)
+	api.Get("/admin/maintenance", admin, handlers.GetMaintenance)
+	api.Post("/admin/maintenance", admin, handlers.SetMaintenance)
+	api.Get("/admin/policies", admin, handlers.GetPolicies)
+	api.Put("/admin/categories/:name", admin, handlers.PutCategory)
+	api.Delete("/admin/categories/:name", admin, handlers.DeleteCategory)
+	api.Get("/admin/cooldowns", admin, handlers.GetCooldowns)
+	api.Get("/admin/api-keys", admin, handlers.ListAPIKeys)
+	api.Post("/admin/api-keys", admin, handlers.CreateAPIKey)
+	api.Delete("/admin/api-keys/:id", admin, handlers.DeleteAPIKey)
+	api.Get("/admin/field-masks", admin, handlers.ListFieldMasks)
+	api.Put("/admin/field-masks/:role", admin, handlers.PutFieldMask)
+	api.Delete("/admin/field-masks/:role", admin, handlers.DeleteFieldMask)
+	api.Delete("/admin/cooldowns/:host", admin, handlers.ClearCooldown)
+	api.Get("/admin/search/quotas", admin, handlers.GetSearchQuotas)
+	api.Get("/capabilities", read, handlers.GetCapabilities)
+	api.Get("/openapi.json", read, handlers.GetOpenAPISpec)
+	api.Get("/evidence/key", read, handlers.GetCustodyKey)
+	api.Get("/compliance-profiles", read, handlers.ListComplianceProfiles)
+	api.Get("/regions", read, handlers.ListRegions)
+	api.Get("/proxies", read, handlers.ListProxies)
+	api.Get("/opt-outs", read, handlers.ListOptOuts)
+	api.Post("/opt-outs", write, handlers.RegisterOptOut)
+	api.Get("/tenants/:id/scripts", read, handlers.ListScripts)
+	api.Put("/tenants/:id/scripts/:name", write, handlers.PutScript)
+	api.Delete("/tenants/:id/scripts/:name", write, handlers.DeleteScript)
+	api.Get("/tenants/:id/monitors/paste", read, handlers.GetPasteMonitor)
+	api.Put("/tenants/:id/monitors/paste", write, handlers.PutPasteMonitor)
+	api.Delete("/tenants/:id/monitors/paste", write, handlers.DeletePasteMonitor)
+	api.Get("/tenants/:id/continuous", read, handlers.GetContinuousCrawl)
+	api.Put("/tenants/:id/continuous", write, handlers.PutContinuousCrawl)
+	api.Delete("/tenants/:id/continuous", write, handlers.DeleteContinuousCrawl)
+	api.Get("/tenants/:id/continuous/frontier", read, handlers.GetContinuousFrontier)
+}
+
+// resultETags tags status and results with weak ETags, answering polls
+// with 304 while they are unchanged. Streamed results would have to be
+// buffered to be tagged, so they are not.
+func resultETags() fiber.Handler {
+	return etag.New(etag.Config{
+		Weak: true,
+		Next: func(c *fiber.Ctx) bool { return c.Query("format") != "" },
+	})
+}
+
+// drainTimeout returns how long running jobs may take to finish on
+// shutdown before they are checkpointed: SHUTDOWN_DRAIN_TIMEOUT, default
+// one minute
+func drainTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_DRAIN_TIMEOUT")); err == nil && d >= 0 {
+		return d
+	}
+	return time.Minute
+}
+
+// bodyLimit returns the maximum request body size, large enough for job
+// bundle imports
+func bodyLimit() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_BODY_BYTES")); err == nil && v > 0 {
+		return v
+	}
+	return 256 << 20
+}
+
 func customErrorHandler(c *fiber.Ctx, err error) error {
 	code := fiber.StatusInternalServerError
 	if e, ok := err.(*fiber.Error); ok {
@@ -86,6 +332,21 @@ func customErrorHandler(c *fiber.Ctx, err error) error {
 		"code":  code,
 	}).Error("Request error")
 
+	if strings.HasPrefix(c.Path(), "/api/"+models.APIVersion2+"/") {
+		errorCode := errcode.InvalidRequest
+		switch {
+		case code == fiber.StatusNotFound:
+			errorCode = errcode.NotFound
+		case code >= 500:
+			errorCode = errcode.Internal
+		}
+		return c.Status(code).JSON(models.ErrorResponse{
+			Error:   err.Error(),
+			Code:    errorCode,
+			Details: map[string]interface{}{"path": c.Path()},
+		})
+	}
+
 	return c.Status(code).JSON(fiber.Map{
 		"error":   err.Error(),
 		"code":    code,
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"definitelynotaspy/crawler-service/internal/store"
+)
+
+// runMigrate copies the jobs of one job store into another, e.g.
+//
+//	crawler-service migrate --from=json --from-dir=./data/jobs --to=redis
+//
+// It prints the migration report as JSON and returns the exit status.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := fs.String("from", "", "driver of the store to read: json (filesystem) or redis")
+	fromDir := fs.String("from-dir", "", "directory of a json source store (default ./data/jobs)")
+	to := fs.String("to", "", "driver of the store to write: json (filesystem) or redis")
+	toDir := fs.String("to-dir", "", "directory of a json destination store (default ./data/jobs)")
+	overwrite := fs.Bool("overwrite", false, "replace jobs the destination already holds")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	src, err := openPersistent(*from, *fromDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: source: %v\n", err)
+		return 2
+	}
+	dst, err := openPersistent(*to, *toDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: destination: %v\n", err)
+		return 2
+	}
+	if *from == *to && *fromDir == *toDir {
+		fmt.Fprintln(os.Stderr, "migrate: source and destination are the same store")
+		return 2
+	}
+
+	report := store.Migrate(src, dst, *overwrite)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// openPersistent opens a store that outlives the process; the memory
+// driver holds nothing to migrate
+func openPersistent(driver, dir string) (store.Store, error) {
+	if driver == "" {
+		return nil, fmt.Errorf("a driver is required (json or redis)")
+	}
+	s, err := store.Open(driver, dir)
+	if err != nil {
+		return nil, err
+	}
+	if s.Driver() == store.DriverMemory {
+		return nil, fmt.Errorf("the memory driver keeps no jobs to migrate")
+	}
+	return s, nil
+}
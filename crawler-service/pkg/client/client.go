@@ -0,0 +1,199 @@
+// Package client is a Go client for the crawler service API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// apiPrefix is the API version the client speaks
+const apiPrefix = "/api/" + models.APIVersion2
+
+// Request and result types shared with the service
+type (
+	CrawlRequest      = models.CrawlRequest
+	CrawlJob          = models.CrawlJob
+	CrawlResult       = models.CrawlResult
+	ComplianceProfile = models.ComplianceProfile
+)
+
+// Client calls the crawler service API. Its fields may be changed before
+// first use.
+type Client struct {
+	// BaseURL is the service address, e.g. http://crawler:8080
+	BaseURL string
+	// APIKey authenticates requests, when the service requires keys
+	APIKey string
+	// HTTPClient sends requests; http.DefaultClient when nil
+	HTTPClient *http.Client
+	// MaxRetries is how many times a request is retried after a transient
+	// failure
+	MaxRetries int
+	// Backoff is the delay before the first retry; it doubles with each
+	// further retry unless the service sends Retry-After
+	Backoff time.Duration
+}
+
+// New returns a client for the service at baseURL that retries transient
+// failures three times
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+		MaxRetries: 3,
+		Backoff:    500 * time.Millisecond,
+	}
+}
+
+// APIError is an error response from the service
+type APIError struct {
+	StatusCode int
+	// Code is the machine-readable error code, e.g. not_found or
+	// compliance_denied
+	Code    string
+	Message string
+	// Details may carry further information such as violations or
+	// conflicting job IDs
+	Details map[string]interface{}
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("crawler service returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("crawler service returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the service
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// do sends a request with a JSON body, if any, and decodes a JSON response
+// into out, if given. Requests the service refused without acting on (429,
+// 503) are always retried; GETs are also retried on network errors and
+// gateway failures.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, payload)
+
+		retry := false
+		var wait time.Duration
+		switch {
+		case err != nil:
+			retry = method == http.MethodGet && ctx.Err() == nil
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			retry = true
+			wait = retryAfter(resp)
+		case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout:
+			retry = method == http.MethodGet
+		}
+
+		if !retry || attempt >= c.MaxRetries {
+			if err != nil {
+				return err
+			}
+			return decode(resp, out)
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient().Do(req)
+}
+
+// newRequest builds an authenticated request for a JSON response
+func (c *Client) newRequest(ctx context.Context, method, path string, payload []byte) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// decode reads a response into out, or into an APIError for error statuses
+func decode(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var body models.ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Code:       body.Code,
+			Message:    body.Error,
+			Details:    body.Details,
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// retryAfter returns the delay a response asks for, or zero
+func retryAfter(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// Job statuses after which a job makes no further progress
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// JobStatus is the progress of a job
+type JobStatus struct {
+	models.StatusResponse
+}
+
+// Done reports whether the job has finished, successfully or not
+func (s *JobStatus) Done() bool {
+	switch s.Status {
+	case StatusCompleted, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// StartCrawl creates a job and returns it as accepted by the service
+func (c *Client) StartCrawl(ctx context.Context, req CrawlRequest) (*CrawlJob, error) {
+	var resp models.JobResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/crawl", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Job == nil {
+		return nil, fmt.Errorf("crawler service returned no job")
+	}
+	return resp.Job, nil
+}
+
+// Status returns the progress of a job
+func (c *Client) Status(ctx context.Context, jobID string) (*JobStatus, error) {
+	var status JobStatus
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/status/"+url.PathEscape(jobID), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// CancelJob stops a running job
+func (c *Client) CancelJob(ctx context.Context, jobID string) error {
+	return c.do(ctx, http.MethodPost, apiPrefix+"/jobs/"+url.PathEscape(jobID)+"/cancel", nil, nil)
+}
+
+// WaitForCompletion polls a job every interval until it finishes or ctx is
+// done, and returns its final status. A failed or cancelled job is not an
+// error; check the returned status.
+func (c *Client) WaitForCompletion(ctx context.Context, jobID string, interval time.Duration) (*JobStatus, error) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := c.Status(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if status.Done() {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// JobListOptions selects a page of jobs
+type JobListOptions struct {
+	// Cursor is the NextCursor of the previous page; empty for the first
+	Cursor string
+	// Limit is the page size; zero lists every job
+	Limit int
+	// Oldest lists the oldest jobs first instead of the newest, or with
+	// SortByPages the jobs that crawled fewest pages first
+	Oldest bool
+	// SortByPages orders jobs by pages crawled; pages are then selected by
+	// Page rather than Cursor
+	SortByPages bool
+	// Page is the number of the page to list, from 1
+	Page           int
+	Status         []string
+	Query          string
+	StartedAfter   time.Time
+	StartedBefore  time.Time
+	ExternalID     string
+	CaseID         string
+	IncludeDeleted bool
+}
+
+// ListJobs returns a page of jobs in creation order
+func (c *Client) ListJobs(ctx context.Context, opts JobListOptions) (*models.JobListResponse, error) {
+	query := url.Values{}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", fmt.Sprint(opts.Limit))
+	}
+	if opts.Oldest {
+		query.Set("order", "asc")
+	}
+	if opts.SortByPages {
+		query.Set("sort", "pages_crawled")
+	}
+	if opts.Page > 0 {
+		query.Set("page", fmt.Sprint(opts.Page))
+	}
+	if len(opts.Status) > 0 {
+		query.Set("status", strings.Join(opts.Status, ","))
+	}
+	if opts.Query != "" {
+		query.Set("query", opts.Query)
+	}
+	if !opts.StartedAfter.IsZero() {
+		query.Set("started_after", opts.StartedAfter.Format(time.RFC3339))
+	}
+	if !opts.StartedBefore.IsZero() {
+		query.Set("started_before", opts.StartedBefore.Format(time.RFC3339))
+	}
+	if opts.ExternalID != "" {
+		query.Set("external_id", opts.ExternalID)
+	}
+	if opts.CaseID != "" {
+		query.Set("case_id", opts.CaseID)
+	}
+	if opts.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+
+	var page models.JobListResponse
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/jobs?"+query.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// DeleteResults frees the storage of a finished job ahead of its retention,
+// keeping the job and its statistics
+func (c *Client) DeleteResults(ctx context.Context, jobID string) error {
+	return c.do(ctx, http.MethodDelete, apiPrefix+"/jobs/"+url.PathEscape(jobID)+"/results", nil, nil)
+}
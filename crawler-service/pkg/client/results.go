@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"definitelynotaspy/crawler-service/internal/models"
+)
+
+// defaultPageSize is how many results an iterator fetches per request
+const defaultPageSize = 100
+
+// resultsPage is one page of the results endpoint, which for offloaded
+// results holds only the download URL
+type resultsPage struct {
+	models.ResultsResponse
+	DownloadURL string `json:"download_url"`
+}
+
+// ResultIterator walks a job's results a page at a time:
+//
+//	it := c.Results(jobID)
+//	for it.Next(ctx) {
+//		result := it.Result()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ResultIterator struct {
+	client   *Client
+	jobID    string
+	pageSize int
+
+	page   []CrawlResult
+	index  int
+	offset int
+	done   bool
+	err    error
+}
+
+// Results returns an iterator over a job's results
+func (c *Client) Results(jobID string) *ResultIterator {
+	return &ResultIterator{client: c, jobID: jobID, pageSize: defaultPageSize, index: -1}
+}
+
+// PageSize sets how many results are fetched per request
+func (it *ResultIterator) PageSize(n int) *ResultIterator {
+	if n > 0 {
+		it.pageSize = n
+	}
+	return it
+}
+
+// Next advances to the next result, fetching another page when needed. It
+// returns false when the results are exhausted or on error.
+func (it *ResultIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if it.index+1 < len(it.page) {
+		it.index++
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	page, err := it.client.resultsPage(ctx, it.jobID, it.offset, it.pageSize)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.page, it.index = page.Results, 0
+	it.offset += len(page.Results)
+	// Offloaded results arrive whole
+	it.done = page.Offloaded || len(page.Results) < it.pageSize || it.offset >= page.Total
+	return len(it.page) > 0
+}
+
+// Result returns the current result
+func (it *ResultIterator) Result() CrawlResult {
+	return it.page[it.index]
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *ResultIterator) Err() error {
+	return it.err
+}
+
+// FetchResults returns all of a job's results
+func (c *Client) FetchResults(ctx context.Context, jobID string) ([]CrawlResult, error) {
+	var results []CrawlResult
+	it := c.Results(jobID)
+	for it.Next(ctx) {
+		results = append(results, it.Result())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StreamResults calls fn with each of a job's results as they appear,
+// polling every interval until the job finishes. Monitors never finish, so
+// their streams end only when ctx is done or fn returns an error.
+func (c *Client) StreamResults(ctx context.Context, jobID string, interval time.Duration, fn func(CrawlResult) error) error {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	seen := 0
+	for {
+		// Read the status first so results published before the job
+		// finished are not missed
+		status, err := c.Status(ctx, jobID)
+		if err != nil {
+			return err
+		}
+
+		for {
+			page, err := c.resultsPage(ctx, jobID, seen, defaultPageSize)
+			if err != nil {
+				return err
+			}
+			if page.Offloaded {
+				page.Results = page.Results[min(seen, len(page.Results)):]
+			}
+			for _, result := range page.Results {
+				if err := fn(result); err != nil {
+					return err
+				}
+			}
+			seen += len(page.Results)
+			if page.Offloaded || len(page.Results) < defaultPageSize {
+				break
+			}
+		}
+
+		if status.Done() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// resultsPage fetches one page of results, downloading offloaded results
+// whole
+func (c *Client) resultsPage(ctx context.Context, jobID string, offset, limit int) (*resultsPage, error) {
+	query := url.Values{}
+	query.Set("offset", fmt.Sprint(offset))
+	query.Set("limit", fmt.Sprint(limit))
+
+	var page resultsPage
+	path := apiPrefix + "/jobs/" + url.PathEscape(jobID) + "/results?" + query.Encode()
+	if err := c.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+		return nil, err
+	}
+	if !page.Offloaded {
+		return &page, nil
+	}
+
+	// The download URL is presigned, so it is fetched without the service
+	download := &Client{BaseURL: page.DownloadURL, HTTPClient: c.HTTPClient, MaxRetries: c.MaxRetries, Backoff: c.Backoff}
+	if err := download.do(ctx, http.MethodGet, "", nil, &page.Results); err != nil {
+		return nil, fmt.Errorf("failed to download offloaded results: %w", err)
+	}
+	page.Total = len(page.Results)
+	return &page, nil
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Types of the events of a job's progress stream
+const (
+	EventSnapshot      = "snapshot"
+	EventJobStatus     = "job.status"
+	EventPageCrawled   = "page.crawled"
+	EventPageFailed    = "page.failed"
+	EventURLDiscovered = "url.discovered"
+	EventJobFinished   = "job.finished"
+)
+
+// Event is one event of a job's progress stream
+type Event struct {
+	Type string
+	// Status is the job's status, for snapshots
+	Status *JobStatus
+	// Data is the payload of the other events, e.g. the url and title of
+	// a crawled page
+	Data map[string]interface{}
+	Time time.Time
+}
+
+// errStreamEnded is returned when a progress stream closes before the job
+// finished
+var errStreamEnded = errors.New("progress stream ended before the job finished")
+
+// WatchJob follows a job's progress as the service pushes it, calling fn
+// with each event. The stream opens with a snapshot of the job's status
+// and ends once the job finishes, when ctx is done or when fn returns an
+// error. Snapshots follow again whenever events were dropped because the
+// client fell behind.
+func (c *Client) WatchJob(ctx context.Context, jobID string, fn func(Event) error) error {
+	req, err := c.newRequest(ctx, http.MethodGet, apiPrefix+"/jobs/"+url.PathEscape(jobID)+"/stream", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The stream lasts as long as the job, beyond any client timeout
+	streaming := *c.httpClient()
+	streaming.Timeout = 0
+	resp, err := streaming.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return decode(resp, nil)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	var eventType string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimSpace(line[len("data:"):]))
+		case line == "" && data.Len() > 0:
+			event, err := parseEvent(eventType, data.String())
+			eventType = ""
+			data.Reset()
+			if err != nil {
+				return err
+			}
+			if err := fn(event); err != nil {
+				return err
+			}
+			if event.Type == EventJobFinished || (event.Status != nil && event.Status.Done()) {
+				return nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errStreamEnded
+}
+
+// parseEvent decodes the data of a progress stream event
+func parseEvent(eventType, data string) (Event, error) {
+	event := Event{Type: eventType}
+	if eventType == EventSnapshot {
+		var status JobStatus
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			return event, fmt.Errorf("failed to decode %s event: %w", eventType, err)
+		}
+		event.Status = &status
+		return event, nil
+	}
+
+	var body struct {
+		Time time.Time              `json:"time"`
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(data), &body); err != nil {
+		return event, fmt.Errorf("failed to decode %s event: %w", eventType, err)
+	}
+	event.Time, event.Data = body.Time, body.Data
+	return event, nil
+}
+
+// AwaitCompletion waits for a job to finish by following its progress
+// stream, and returns its final status. Should the stream break off, it
+// falls back to polling every pollInterval. A failed or cancelled job is
+// not an error; check the returned status.
+func (c *Client) AwaitCompletion(ctx context.Context, jobID string, pollInterval time.Duration) (*JobStatus, error) {
+	err := c.WatchJob(ctx, jobID, func(Event) error { return nil })
+	var apiErr *APIError
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case errors.As(err, &apiErr):
+		return nil, err
+	}
+	return c.WaitForCompletion(ctx, jobID, pollInterval)
+}
@@ -0,0 +1,262 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             v4.25.3
+// source: crawler/v1/crawler.proto
+
+package crawlerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	CrawlerService_StartCrawl_FullMethodName = "/crawler.v1.CrawlerService/StartCrawl"
+	CrawlerService_GetStatus_FullMethodName  = "/crawler.v1.CrawlerService/GetStatus"
+	CrawlerService_ListJobs_FullMethodName   = "/crawler.v1.CrawlerService/ListJobs"
+	CrawlerService_CancelJob_FullMethodName  = "/crawler.v1.CrawlerService/CancelJob"
+)
+
+// CrawlerServiceClient is the client API for CrawlerService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CrawlerServiceClient interface {
+	// StartCrawl creates a job, like POST /api/v2/crawl
+	StartCrawl(ctx context.Context, in *CrawlRequest, opts ...grpc.CallOption) (*CrawlJob, error)
+	// GetStatus sends the job's status, then again whenever it changes,
+	// until the job has finished
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (CrawlerService_GetStatusClient, error)
+	// ListJobs returns a page of jobs, newest first
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// CancelJob stops a pending or running job
+	CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*CancelJobResponse, error)
+}
+
+type crawlerServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCrawlerServiceClient(cc grpc.ClientConnInterface) CrawlerServiceClient {
+	return &crawlerServiceClient{cc}
+}
+
+func (c *crawlerServiceClient) StartCrawl(ctx context.Context, in *CrawlRequest, opts ...grpc.CallOption) (*CrawlJob, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CrawlJob)
+	err := c.cc.Invoke(ctx, CrawlerService_StartCrawl_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlerServiceClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (CrawlerService_GetStatusClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CrawlerService_ServiceDesc.Streams[0], CrawlerService_GetStatus_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &crawlerServiceGetStatusClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CrawlerService_GetStatusClient interface {
+	Recv() (*JobStatus, error)
+	grpc.ClientStream
+}
+
+type crawlerServiceGetStatusClient struct {
+	grpc.ClientStream
+}
+
+func (x *crawlerServiceGetStatusClient) Recv() (*JobStatus, error) {
+	m := new(JobStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *crawlerServiceClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, CrawlerService_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlerServiceClient) CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*CancelJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelJobResponse)
+	err := c.cc.Invoke(ctx, CrawlerService_CancelJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CrawlerServiceServer is the server API for CrawlerService service.
+// All implementations must embed UnimplementedCrawlerServiceServer
+// for forward compatibility
+type CrawlerServiceServer interface {
+	// StartCrawl creates a job, like POST /api/v2/crawl
+	StartCrawl(context.Context, *CrawlRequest) (*CrawlJob, error)
+	// GetStatus sends the job's status, then again whenever it changes,
+	// until the job has finished
+	GetStatus(*GetStatusRequest, CrawlerService_GetStatusServer) error
+	// ListJobs returns a page of jobs, newest first
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// CancelJob stops a pending or running job
+	CancelJob(context.Context, *CancelJobRequest) (*CancelJobResponse, error)
+	mustEmbedUnimplementedCrawlerServiceServer()
+}
+
+// UnimplementedCrawlerServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCrawlerServiceServer struct {
+}
+
+func (UnimplementedCrawlerServiceServer) StartCrawl(context.Context, *CrawlRequest) (*CrawlJob, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartCrawl not implemented")
+}
+func (UnimplementedCrawlerServiceServer) GetStatus(*GetStatusRequest, CrawlerService_GetStatusServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedCrawlerServiceServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedCrawlerServiceServer) CancelJob(context.Context, *CancelJobRequest) (*CancelJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelJob not implemented")
+}
+func (UnimplementedCrawlerServiceServer) mustEmbedUnimplementedCrawlerServiceServer() {}
+
+// UnsafeCrawlerServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CrawlerServiceServer will
+// result in compilation errors.
+type UnsafeCrawlerServiceServer interface {
+	mustEmbedUnimplementedCrawlerServiceServer()
+}
+
+func RegisterCrawlerServiceServer(s grpc.ServiceRegistrar, srv CrawlerServiceServer) {
+	s.RegisterService(&CrawlerService_ServiceDesc, srv)
+}
+
+func _CrawlerService_StartCrawl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CrawlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServiceServer).StartCrawl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CrawlerService_StartCrawl_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServiceServer).StartCrawl(ctx, req.(*CrawlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CrawlerService_GetStatus_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetStatusRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CrawlerServiceServer).GetStatus(m, &crawlerServiceGetStatusServer{ServerStream: stream})
+}
+
+type CrawlerService_GetStatusServer interface {
+	Send(*JobStatus) error
+	grpc.ServerStream
+}
+
+type crawlerServiceGetStatusServer struct {
+	grpc.ServerStream
+}
+
+func (x *crawlerServiceGetStatusServer) Send(m *JobStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CrawlerService_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServiceServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CrawlerService_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServiceServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CrawlerService_CancelJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServiceServer).CancelJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CrawlerService_CancelJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServiceServer).CancelJob(ctx, req.(*CancelJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CrawlerService_ServiceDesc is the grpc.ServiceDesc for CrawlerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CrawlerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "crawler.v1.CrawlerService",
+	HandlerType: (*CrawlerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "StartCrawl",
+			Handler:    _CrawlerService_StartCrawl_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _CrawlerService_ListJobs_Handler,
+		},
+		{
+			MethodName: "CancelJob",
+			Handler:    _CrawlerService_CancelJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetStatus",
+			Handler:       _CrawlerService_GetStatus_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "crawler/v1/crawler.proto",
+}
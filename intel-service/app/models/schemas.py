@@ -93,18 +93,58 @@ class SearchResponse(BaseModel):
     total: int
 
 
+class CrawlLink(BaseModel):
+    """Outgoing link found on a crawled page"""
+    url: str
+    text: Optional[str] = None
+    rel: Optional[str] = None
+    external: bool = False
+
+
+class CrawlHeading(BaseModel):
+    """h1-h3 heading of a crawled page"""
+    level: int
+    text: str
+
+
+class CrawlImage(BaseModel):
+    """Image referenced by a crawled page"""
+    url: str
+    alt: Optional[str] = None
+
+
 class CrawlResult(BaseModel):
     """Result from crawler service"""
     url: str
     title: str
     content: str
-    links: List[str]
+    content_markdown: Optional[str] = None
+    tables: List[dict] = []
+    organization: Optional[dict] = None
+    phones: List[dict] = []
+    quality_score: Optional[float] = None
+    parked: bool = False
+    links: List[CrawlLink] = []
     crawled_at: datetime
     status_code: int
     error: Optional[str] = None
+    source: Optional[str] = None
+    meta_description: Optional[str] = None
+    canonical_url: Optional[str] = None
+    open_graph: Dict[str, str] = {}
+    twitter_card: Dict[str, str] = {}
+    headings: List[CrawlHeading] = []
+    media: List[CrawlImage] = []
+    published_at: Optional[datetime] = None
+    language: Optional[str] = None
 
 
 class ProcessRequest(BaseModel):
     """Request to process crawled data"""
     job_id: str
+    tenant: Optional[str] = None
     results: List[CrawlResult]
+    # Larger deliveries arrive in batches; batch counts from 1 of batches
+    batch_id: Optional[str] = None
+    batch: Optional[int] = None
+    batches: Optional[int] = None
@@ -1,7 +1,7 @@
 """
 Analysis router for text processing and entity extraction
 """
-from fastapi import APIRouter, HTTPException, Depends
+from fastapi import APIRouter, HTTPException, Depends, Request
 from typing import List
 from loguru import logger
 
@@ -16,6 +16,7 @@ from app.models.schemas import (
 from app.services.nlp_service import NLPService
 from app.services.neo4j_service import Neo4jService
 from app.services.qdrant_service import QdrantService
+from app.utils.signing import DELIVERY_HEADER, DeliveryLog, delivery_log, verify_request
 
 
 router = APIRouter()
@@ -143,10 +144,32 @@ async def compare_entities(request: CompareRequest):
 
 
 @router.post("/process")
-async def process_crawl_results(request: ProcessRequest):
+async def process_crawl_results(request: ProcessRequest, http_request: Request):
     """
     Process crawled data from the crawler service
     """
+    rejected = verify_request(http_request.headers, await http_request.body())
+    if rejected:
+        logger.warning(f"Rejected crawler push for job {request.job_id}: {rejected}")
+        raise HTTPException(status_code=401, detail=rejected)
+
+    # A batch is processed once, however often the crawler retries it
+    delivery_id = http_request.headers.get(DELIVERY_HEADER) or request.batch_id
+    if delivery_id and request.batch_id and delivery_id != request.batch_id:
+        raise HTTPException(status_code=400, detail="delivery ID does not match the batch")
+    if delivery_id:
+        state = delivery_log.begin(delivery_id)
+        if state == DeliveryLog.DONE:
+            logger.info(f"Batch {delivery_id} of job {request.job_id} was already processed")
+            return {
+                "status": "duplicate",
+                "job_id": request.job_id,
+                "batch_id": delivery_id,
+                "message": "Batch already processed"
+            }
+        if state == DeliveryLog.PROCESSING:
+            raise HTTPException(status_code=409, detail="batch is already being processed")
+
     try:
         processed_count = 0
         entities_found = []
@@ -170,7 +193,8 @@ async def process_crawl_results(request: ProcessRequest):
                                 "source_url": result.url,
                                 "source_title": result.title,
                                 "crawled_at": result.crawled_at.isoformat(),
-                                "job_id": request.job_id
+                                "job_id": request.job_id,
+                                "tenant": request.tenant
                             }
                         )
                         
@@ -197,6 +221,8 @@ async def process_crawl_results(request: ProcessRequest):
                 logger.error(f"Failed to process result from {result.url}: {e}")
         
         logger.info(f"Processed {processed_count} crawl results, found {len(entities_found)} entities")
+        if delivery_id:
+            delivery_log.finish(delivery_id)
         
         return {
             "status": "success",
@@ -207,5 +233,7 @@ async def process_crawl_results(request: ProcessRequest):
         }
         
     except Exception as e:
+        if delivery_id:
+            delivery_log.abandon(delivery_id)
         logger.error(f"Error in process_crawl_results: {e}")
         raise HTTPException(status_code=500, detail=str(e))
@@ -0,0 +1,139 @@
+"""
+Verification of signed pushes from the crawler service
+"""
+import hashlib
+import hmac
+import os
+import time
+from threading import Lock
+from typing import Dict, Optional
+
+
+SIGNATURE_HEADER = "X-GodsEye-Signature"
+TIMESTAMP_HEADER = "X-GodsEye-Timestamp"
+NONCE_HEADER = "X-GodsEye-Nonce"
+# The batch a push delivers, the same on every attempt at it
+DELIVERY_HEADER = "X-GodsEye-Delivery"
+
+# Deliveries older or further in the future than this are rejected
+MAX_SKEW_SECONDS = 300
+
+# How long processed deliveries are remembered; the crawler gives up on a
+# batch well within this
+DELIVERY_TTL_SECONDS = 24 * 3600
+
+
+class NonceCache:
+    """
+    Remembers nonces for the skew window so each delivery is accepted once
+    """
+
+    def __init__(self, ttl: int = MAX_SKEW_SECONDS):
+        self.ttl = ttl
+        self._seen: Dict[str, float] = {}
+        self._lock = Lock()
+
+    def add(self, nonce: str, now: Optional[float] = None) -> bool:
+        """
+        Record a nonce; returns False if it was already seen
+        """
+        now = now if now is not None else time.time()
+        with self._lock:
+            for key, expires in list(self._seen.items()):
+                if expires <= now:
+                    del self._seen[key]
+            if nonce in self._seen:
+                return False
+            self._seen[nonce] = now + 2 * self.ttl
+            return True
+
+
+nonce_cache = NonceCache()
+
+
+class DeliveryLog:
+    """
+    Remembers the batches processed, so a batch the crawler retries after
+    it was processed (its response lost, say) is not processed again
+    """
+
+    NEW = "new"
+    PROCESSING = "processing"
+    DONE = "done"
+
+    def __init__(self, ttl: int = DELIVERY_TTL_SECONDS):
+        self.ttl = ttl
+        self._state: Dict[str, str] = {}
+        self._expires: Dict[str, float] = {}
+        self._lock = Lock()
+
+    def begin(self, delivery_id: str, now: Optional[float] = None) -> str:
+        """
+        Claim a delivery for processing. Returns NEW when the caller holds
+        it, PROCESSING when another attempt is still at it, or DONE when it
+        was already processed.
+        """
+        now = now if now is not None else time.time()
+        with self._lock:
+            for key, expires in list(self._expires.items()):
+                if expires <= now:
+                    del self._expires[key]
+                    del self._state[key]
+            state = self._state.get(delivery_id)
+            if state is not None:
+                return state
+            self._state[delivery_id] = self.PROCESSING
+            self._expires[delivery_id] = now + self.ttl
+            return self.NEW
+
+    def finish(self, delivery_id: str) -> None:
+        """
+        Record a claimed delivery as processed
+        """
+        with self._lock:
+            if delivery_id in self._state:
+                self._state[delivery_id] = self.DONE
+
+    def abandon(self, delivery_id: str) -> None:
+        """
+        Release a claimed delivery that failed, so a retry processes it
+        """
+        with self._lock:
+            self._state.pop(delivery_id, None)
+            self._expires.pop(delivery_id, None)
+
+
+delivery_log = DeliveryLog()
+
+
+def verify_request(headers, body: bytes, secret: Optional[str] = None) -> Optional[str]:
+    """
+    Check the signature, timestamp and nonce of a crawler push.
+    Returns None when the request is authentic, otherwise the reason it is not.
+    Verification is skipped when INTEL_SHARED_SECRET is not configured.
+    """
+    secret = secret if secret is not None else os.getenv("INTEL_SHARED_SECRET", "")
+    if not secret:
+        return None
+
+    signature = headers.get(SIGNATURE_HEADER, "")
+    timestamp = headers.get(TIMESTAMP_HEADER, "")
+    nonce = headers.get(NONCE_HEADER, "")
+    if not signature or not timestamp or not nonce:
+        return "missing signature headers"
+
+    try:
+        sent = int(timestamp)
+    except ValueError:
+        return "invalid timestamp"
+    if abs(time.time() - sent) > MAX_SKEW_SECONDS:
+        return "stale timestamp"
+
+    signed = f"{timestamp}.{nonce}.".encode() + body
+    expected = "sha256=" + hmac.new(secret.encode(), signed, hashlib.sha256).hexdigest()
+    if not hmac.compare_digest(expected, signature):
+        return "invalid signature"
+
+    if not nonce_cache.add(nonce):
+        return "replayed delivery"
+    return None
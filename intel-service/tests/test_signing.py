@@ -0,0 +1,27 @@
+"""
+Tests for the delivery log of crawler pushes
+"""
+from app.utils.signing import DeliveryLog
+
+
+def test_delivery_processed_once():
+    log = DeliveryLog()
+    assert log.begin("batch-1") == DeliveryLog.NEW
+    assert log.begin("batch-1") == DeliveryLog.PROCESSING
+    log.finish("batch-1")
+    assert log.begin("batch-1") == DeliveryLog.DONE
+
+
+def test_abandoned_delivery_is_retried():
+    log = DeliveryLog()
+    assert log.begin("batch-1") == DeliveryLog.NEW
+    log.abandon("batch-1")
+    assert log.begin("batch-1") == DeliveryLog.NEW
+
+
+def test_delivery_forgotten_after_ttl():
+    log = DeliveryLog(ttl=10)
+    assert log.begin("batch-1", now=0) == DeliveryLog.NEW
+    log.finish("batch-1")
+    assert log.begin("batch-1", now=5) == DeliveryLog.DONE
+    assert log.begin("batch-1", now=11) == DeliveryLog.NEW